@@ -0,0 +1,196 @@
+// Copyright 2011-2015 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package api
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"math/bits"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"tmsu/common/fingerprint"
+	"tmsu/common/log"
+	"tmsu/common/text"
+	"tmsu/entities"
+	"tmsu/storage"
+)
+
+// The algorithm under which acoustic fingerprints are recorded.
+const AcousticAlgorithm = "chromaprint"
+
+// The proportion of bits of two acoustic fingerprints that must match for the
+// recordings to be considered the same.
+const AcousticSimilarityThreshold = 0.85
+
+// The furthest, in fingerprint items, two acoustic fingerprints are shifted
+// against each other to allow for differences in the start of the recordings.
+const maxAcousticOffset = 80
+
+// The fewest fingerprint items that must overlap for a comparison.
+const minAcousticOverlap = 20
+
+// Calculates acoustic fingerprints of audio files, which identify a recording
+// regardless of its encoding or bit-rate.
+type AudioFingerprinter interface {
+	// Calculates the file's fingerprint: comma-separated 32-bit integers.
+	Fingerprint(path string) (fingerprint.Fingerprint, error)
+}
+
+// A fingerprinter run as a subprocess for each file, with the file's path as
+// its final argument. As for Chromaprint's 'fpcalc -raw', the command must
+// write a 'FINGERPRINT=' line listing the fingerprint's integers.
+type CommandAudioFingerprinter struct {
+	Command string // the command line, with arguments quoted as for a shell
+}
+
+func (fingerprinter CommandAudioFingerprinter) Fingerprint(path string) (fingerprint.Fingerprint, error) {
+	words := text.Tokenize(fingerprinter.Command)
+	if len(words) == 0 {
+		return fingerprint.Empty, fmt.Errorf("no audio fingerprinter command")
+	}
+
+	var stdout, stderr bytes.Buffer
+	command := exec.Command(words[0], append(words[1:], path)...)
+	command.Stdout = &stdout
+	command.Stderr = &stderr
+
+	if err := command.Run(); err != nil {
+		if stderr.Len() > 0 {
+			return fingerprint.Empty, fmt.Errorf("audio fingerprinter '%v' failed: %v: %v", words[0], err, string(bytes.TrimSpace(stderr.Bytes())))
+		}
+
+		return fingerprint.Empty, fmt.Errorf("audio fingerprinter '%v' failed: %v", words[0], err)
+	}
+
+	scanner := bufio.NewScanner(&stdout)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.HasPrefix(line, "FINGERPRINT=") {
+			return fingerprint.Fingerprint(strings.TrimPrefix(line, "FINGERPRINT=")), nil
+		}
+	}
+
+	return fingerprint.Empty, fmt.Errorf("audio fingerprinter '%v' gave no fingerprint", words[0])
+}
+
+// The audio fingerprinter configured by the 'audioFingerprinter' setting, or
+// nil if there is none.
+func NewAudioFingerprinter(settings entities.Settings) AudioFingerprinter {
+	command := settings.AudioFingerprinter()
+	if command == "" {
+		return nil
+	}
+
+	return CommandAudioFingerprinter{command}
+}
+
+// Retrieves the acoustic fingerprint of the file, calculating and recording it
+// if it has not been already. An empty fingerprint is returned for files that
+// are missing or have been modified since they were last recorded.
+func AudioFileFingerprint(store *storage.Storage, tx *storage.Tx, fingerprinter AudioFingerprinter, file *entities.File) (fingerprint.Fingerprint, error) {
+	fp, err := store.RecordedFileFingerprint(tx, file.Id, AcousticAlgorithm)
+	if err != nil || fp != fingerprint.Empty {
+		return fp, err
+	}
+
+	stat, err := os.Stat(file.Path())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return fingerprint.Empty, nil
+		}
+
+		return fingerprint.Empty, err
+	}
+	if stat.Size() != file.Size || !stat.ModTime().UTC().Equal(file.ModTime) {
+		return fingerprint.Empty, nil
+	}
+
+	log.Infof(2, "%v: calculating acoustic fingerprint", file.Path())
+
+	fp, err = fingerprinter.Fingerprint(file.Path())
+	if err != nil {
+		return fingerprint.Empty, err
+	}
+
+	if err := store.UpdateFileFingerprint(tx, file.Id, AcousticAlgorithm, fp); err != nil {
+		return fingerprint.Empty, err
+	}
+
+	return fp, nil
+}
+
+// The proportion, from 0 to 1, of the bits of two acoustic fingerprints that
+// match where they best align.
+func AudioSimilarity(fp, other fingerprint.Fingerprint) (float64, error) {
+	items, err := parseAcousticFingerprint(fp)
+	if err != nil {
+		return 0, err
+	}
+
+	otherItems, err := parseAcousticFingerprint(other)
+	if err != nil {
+		return 0, err
+	}
+
+	best := 0.0
+	for offset := -maxAcousticOffset; offset <= maxAcousticOffset; offset++ {
+		matching, total := 0, 0
+		for index, item := range items {
+			otherIndex := index + offset
+			if otherIndex < 0 || otherIndex >= len(otherItems) {
+				continue
+			}
+
+			matching += 32 - bits.OnesCount32(item^otherItems[otherIndex])
+			total += 32
+		}
+
+		if total < minAcousticOverlap*32 {
+			continue
+		}
+
+		if similarity := float64(matching) / float64(total); similarity > best {
+			best = similarity
+		}
+	}
+
+	return best, nil
+}
+
+// unexported
+
+func parseAcousticFingerprint(fp fingerprint.Fingerprint) ([]uint32, error) {
+	if fp == fingerprint.Empty {
+		return []uint32{}, nil
+	}
+
+	fields := strings.Split(string(fp), ",")
+	items := make([]uint32, len(fields))
+	for index, field := range fields {
+		value, err := strconv.ParseInt(strings.TrimSpace(field), 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid acoustic fingerprint: %v", err)
+		}
+
+		items[index] = uint32(value)
+	}
+
+	return items, nil
+}
@@ -0,0 +1,116 @@
+// Copyright 2011-2015 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+// Package api exposes the core TMSU operations for use by other programs.
+//
+// The functions taking a storage and transaction are the building blocks used
+// by the command-line interface. The Database type wraps these, running each
+// operation in its own transaction.
+package api
+
+import (
+	"tmsu/storage"
+)
+
+// A TMSU database opened for use.
+type Database struct {
+	store *storage.Storage
+}
+
+// Opens the database at the specified path.
+func Open(path string) (*Database, error) {
+	store, err := storage.OpenAt(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Database{store}, nil
+}
+
+// Wraps an already opened storage.
+func New(store *storage.Storage) *Database {
+	return &Database{store}
+}
+
+// Closes the database.
+func (db *Database) Close() error {
+	return db.store.Close()
+}
+
+// The underlying storage, for operations not covered by this package.
+func (db *Database) Storage() *storage.Storage {
+	return db.store
+}
+
+// unexported
+
+// Runs the function within a transaction, committing only if it succeeds. The
+// writer lock is held throughout: if another process holds it then a
+// storage.LockedError is returned rather than waiting. The operation and its
+// arguments are recorded in the audit log unless the command running it
+// records its changes itself.
+func (db *Database) update(operation string, args []string, fn func(tx *storage.Tx) error) (err error) {
+	if db.store.DryRun {
+		return db.view(fn)
+	}
+
+	lock, err := db.store.LockForWriting(db.command(), false, nil)
+	if err != nil {
+		return err
+	}
+	defer lock.Release()
+
+	if !db.store.Audited {
+		finishAudit := db.store.StartAudit(operation, args)
+		defer func() { finishAudit(err) }()
+	}
+
+	return db.view(fn)
+}
+
+// Runs the function, which does not modify the database, within a transaction.
+func (db *Database) view(fn func(tx *storage.Tx) error) error {
+	tx, err := db.store.Begin()
+	if err != nil {
+		return err
+	}
+
+	if err := fn(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// The paths followed by the tags, as recorded in the audit log.
+func auditArgs(paths []string, tagValues []TagValue) []string {
+	args := make([]string, 0, len(paths)+len(tagValues))
+	args = append(args, paths...)
+	for _, tagValue := range tagValues {
+		args = append(args, tagValue.String())
+	}
+
+	return args
+}
+
+// The command recorded as holding the writer lock.
+func (db *Database) command() string {
+	if db.store.Command == "" {
+		return "tmsu"
+	}
+
+	return "tmsu " + db.store.Command
+}
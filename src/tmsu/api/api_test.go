@@ -0,0 +1,248 @@
+// Copyright 2011-2015 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package api
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"tmsu/storage"
+)
+
+func TestTagQueryAndUntag(test *testing.T) {
+	// set-up
+
+	databasePath := filepath.Join(os.TempDir(), "tmsu_api_test.db")
+	defer os.Remove(databasePath)
+
+	db, err := Open(databasePath)
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer db.Close()
+
+	if err := os.MkdirAll("/tmp/tmsu", 0777); err != nil {
+		test.Fatal(err)
+	}
+	if err := ioutil.WriteFile("/tmp/tmsu/a", []byte("hello"), 0666); err != nil {
+		test.Fatal(err)
+	}
+	defer os.Remove("/tmp/tmsu/a")
+
+	// test
+
+	if err := db.Tag([]string{"/tmp/tmsu/a"}, []TagValue{ParseTagValue("apple"), ParseTagValue("year=2015")}, TagOptions{}); err != nil {
+		test.Fatal(err)
+	}
+
+	// validate
+
+	files, err := db.Query("apple and year = 2015", QueryOptions{Sort: "name"})
+	if err != nil {
+		test.Fatal(err)
+	}
+	if len(files) != 1 || files[0].Path() != "/tmp/tmsu/a" {
+		test.Fatalf("Expected '/tmp/tmsu/a' to match but matches are %v.", files)
+	}
+
+	if _, err := db.Query("banana", QueryOptions{}); err == nil {
+		test.Fatalf("Expected an error for a non-existent tag.")
+	} else if _, ok := err.(NoSuchTagsError); !ok {
+		test.Fatalf("Expected NoSuchTagsError but was %v.", err)
+	}
+
+	if err := db.Untag([]string{"/tmp/tmsu/a"}, []TagValue{ParseTagValue("apple")}, false); err != nil {
+		test.Fatal(err)
+	}
+
+	files, err = db.Query("apple", QueryOptions{})
+	if err != nil {
+		test.Fatal(err)
+	}
+	if len(files) != 0 {
+		test.Fatalf("Expected no matches but are %v.", len(files))
+	}
+
+	err = db.Untag([]string{"/tmp/tmsu/a"}, []TagValue{ParseTagValue("apple")}, false)
+	if _, ok := err.(TagNotAppliedError); !ok {
+		test.Fatalf("Expected TagNotAppliedError but was %v.", err)
+	}
+}
+
+func TestUpdateLocksDatabase(test *testing.T) {
+	// set-up
+
+	databasePath := filepath.Join(os.TempDir(), "tmsu_api_test.db")
+	defer os.Remove(databasePath)
+	defer os.Remove(databasePath + ".lock")
+
+	db, err := Open(databasePath)
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer db.Close()
+
+	if err := os.MkdirAll("/tmp/tmsu", 0777); err != nil {
+		test.Fatal(err)
+	}
+	if err := ioutil.WriteFile("/tmp/tmsu/a", []byte("hello"), 0666); err != nil {
+		test.Fatal(err)
+	}
+	defer os.Remove("/tmp/tmsu/a")
+
+	other, err := storage.OpenAt(databasePath)
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer other.Close()
+
+	lock, err := other.LockForWriting("tmsu repair", true, nil)
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	// test
+
+	err = db.Tag([]string{"/tmp/tmsu/a"}, []TagValue{ParseTagValue("apple")}, TagOptions{})
+
+	// validate
+
+	if lockedErr, ok := err.(storage.LockedError); !ok {
+		test.Fatalf("Expected LockedError but was %v.", err)
+	} else if lockedErr.Owner.Command != "tmsu repair" {
+		test.Fatalf("Expected the lock to be owned by 'tmsu repair' but was %v.", lockedErr.Owner)
+	}
+
+	if _, err := db.Tags(); err != nil {
+		test.Fatalf("Expected reading to succeed whilst locked but was %v.", err)
+	}
+
+	if err := lock.Release(); err != nil {
+		test.Fatal(err)
+	}
+
+	// a lock already held within the process is shared
+	lock, err = db.Storage().LockForWriting("tmsu sync", false, nil)
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer lock.Release()
+
+	if err := db.Tag([]string{"/tmp/tmsu/a"}, []TagValue{ParseTagValue("apple")}, TagOptions{}); err != nil {
+		test.Fatal(err)
+	}
+
+	if _, err := other.LockForWriting("tmsu repair", false, nil); err == nil {
+		test.Fatal("Expected the lock to remain held until its first holder releases it.")
+	}
+}
+
+func TestParseTagValue(test *testing.T) {
+	cases := map[string]TagValue{
+		"apple":     TagValue{"apple", ""},
+		"year=2015": TagValue{"year", "2015"},
+		"=2015":     TagValue{"=2015", ""},
+		"size=":     TagValue{"size", ""},
+		"a=b=c":     TagValue{"a", "b=c"},
+	}
+
+	for text, expected := range cases {
+		if actual := ParseTagValue(text); actual != expected {
+			test.Fatalf("'%v': expected %v but was %v.", text, expected, actual)
+		}
+	}
+}
+
+func TestUpdateRecordsAuditLog(test *testing.T) {
+	// set-up
+
+	databasePath := filepath.Join(os.TempDir(), "tmsu_api_test.db")
+	defer os.Remove(databasePath)
+	defer os.Remove(databasePath + ".lock")
+
+	db, err := Open(databasePath)
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer db.Close()
+
+	auditPath := db.Storage().AuditLogPath()
+	os.Remove(auditPath)
+	defer os.Remove(auditPath)
+
+	if err := os.Chmod(databasePath, 0600); err != nil {
+		test.Fatal(err)
+	}
+
+	tx, err := db.Storage().Begin()
+	if err != nil {
+		test.Fatal(err)
+	}
+	if _, err := db.Storage().UpdateSetting(tx, "auditLog", "yes"); err != nil {
+		test.Fatal(err)
+	}
+	if err := tx.Commit(); err != nil {
+		test.Fatal(err)
+	}
+
+	if err := os.MkdirAll("/tmp/tmsu", 0777); err != nil {
+		test.Fatal(err)
+	}
+	if err := ioutil.WriteFile("/tmp/tmsu/a", []byte("hello"), 0666); err != nil {
+		test.Fatal(err)
+	}
+	defer os.Remove("/tmp/tmsu/a")
+
+	// test
+
+	if err := db.Tag([]string{"/tmp/tmsu/a"}, []TagValue{ParseTagValue("apple")}, TagOptions{}); err != nil {
+		test.Fatal(err)
+	}
+	if _, err := db.FileTags("/tmp/tmsu/a", false); err != nil {
+		test.Fatal(err)
+	}
+
+	// validate
+
+	content, err := ioutil.ReadFile(auditPath)
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(string(content)), "\n")
+	if len(lines) != 1 {
+		test.Fatalf("Expected one audit record but got %v: %v", len(lines), lines)
+	}
+
+	var record storage.AuditRecord
+	if err := json.Unmarshal([]byte(lines[0]), &record); err != nil {
+		test.Fatal(err)
+	}
+	if record.Command != "tag" || strings.Join(record.Args, " ") != "/tmp/tmsu/a apple" {
+		test.Fatalf("Expected 'tag /tmp/tmsu/a apple' to be recorded but was '%v %v'.", record.Command, record.Args)
+	}
+
+	stat, err := os.Stat(auditPath)
+	if err != nil {
+		test.Fatal(err)
+	}
+	if stat.Mode().Perm() != 0600 {
+		test.Fatalf("Expected the audit log to have the database's permissions but was %v.", stat.Mode().Perm())
+	}
+}
@@ -0,0 +1,677 @@
+// Copyright 2011-2015 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package api
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+	"tmsu/common/log"
+	"tmsu/entities"
+	"tmsu/storage"
+)
+
+// The name of the archive entry listing the tags of the archived files.
+const ArchiveManifestName = "tmsu-manifest.json"
+
+type ArchiveOptions struct {
+	ExplicitOnly bool                             // only record explicitly applied tags
+	Force        bool                             // overwrite files that already exist when unarchiving
+	Pretend      bool                             // report what would be restored when unarchiving without restoring it
+	Report       func(path, name string)          // called for each file archived or restored
+	Tagged       func(path string, tags []string) // called with the tags applied to each file restored
+}
+
+// Packs the files into a tar archive, compressed with zstd or gzip if the
+// output path ends '.zst' or '.gz' ('.tgz'), with a manifest of their tags.
+// Files are stored at their paths relative to the directory containing them
+// all. A file with the same content as one already archived, as determined by
+// its fingerprint and confirmed by comparing the files, is stored as a hard
+// link to it. Directories are archived without their contents. Files that
+// cannot be read are skipped with a warning.
+func Archive(store *storage.Storage, tx *storage.Tx, files entities.Files, outputPath string, options ArchiveOptions) error {
+	baseDir := commonDirectory(files)
+
+	manifest := archiveManifest{Files: make([]archiveManifestFile, 0, len(files))}
+	for _, file := range files {
+		tagValues, err := FileTagValues(store, tx, file.Id, options.ExplicitOnly)
+		if err != nil {
+			return err
+		}
+
+		tags := make([]string, len(tagValues))
+		for index, tagValue := range tagValues {
+			tags[index] = tagValue.String()
+		}
+		sort.Strings(tags)
+
+		name, err := filepath.Rel(baseDir, file.Path())
+		if err != nil {
+			return fmt.Errorf("%v: could not determine archive path: %v", file.Path(), err)
+		}
+
+		manifest.Files = append(manifest.Files, archiveManifestFile{filepath.ToSlash(name), file.Path(), tags})
+	}
+
+	output, err := createArchive(outputPath)
+	if err != nil {
+		return err
+	}
+
+	writer := tar.NewWriter(output)
+
+	if err := writeArchiveManifest(writer, manifest); err != nil {
+		output.Close()
+		return err
+	}
+
+	stored := make(map[string]archivedFile) // by fingerprint and size
+	for index, file := range files {
+		name := manifest.Files[index].Name
+
+		written, err := writeArchiveEntry(writer, file, name, stored)
+		if err != nil {
+			output.Close()
+			return err
+		}
+		if !written {
+			continue
+		}
+
+		if options.Report != nil {
+			options.Report(file.Path(), name)
+		}
+	}
+
+	if err := writer.Close(); err != nil {
+		output.Close()
+		return fmt.Errorf("could not write archive '%v': %v", outputPath, err)
+	}
+
+	if err := output.Close(); err != nil {
+		return fmt.Errorf("could not write archive '%v': %v", outputPath, err)
+	}
+
+	return nil
+}
+
+// Restores the files from an archive written by Archive to the destination
+// directory and applies the tags recorded in its manifest, creating tags and
+// values where the settings allow. Files that already exist are skipped with
+// a warning unless forced. When pretending, the files and their tags are
+// reported but nothing is restored or tagged.
+func Unarchive(store *storage.Storage, tx *storage.Tx, archivePath, destPath string, options ArchiveOptions) error {
+	absDestPath, err := filepath.Abs(destPath)
+	if err != nil {
+		return fmt.Errorf("%v: could not get absolute path: %v", destPath, err)
+	}
+
+	input, err := openArchive(archivePath)
+	if err != nil {
+		return err
+	}
+	defer input.Close()
+
+	var manifest *archiveManifest
+	restored := make(map[string]bool)
+
+	reader := tar.NewReader(input)
+	for {
+		header, err := reader.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("could not read archive '%v': %v", archivePath, err)
+		}
+
+		if manifest == nil && header.Name == ArchiveManifestName {
+			manifest = &archiveManifest{}
+			if err := json.NewDecoder(reader).Decode(manifest); err != nil {
+				return fmt.Errorf("could not read archive manifest: %v", err)
+			}
+
+			continue
+		}
+
+		path, err := archiveEntryPath(absDestPath, header.Name)
+		if err != nil {
+			return err
+		}
+
+		var done bool
+		if options.Pretend {
+			done, err = checkArchiveEntry(header, path, absDestPath, options.Force)
+		} else {
+			done, err = restoreArchiveEntry(reader, header, path, absDestPath, options.Force)
+		}
+		if err != nil {
+			return err
+		}
+		if !done {
+			continue
+		}
+
+		restored[filepath.ToSlash(filepath.Clean(header.Name))] = true
+
+		if options.Report != nil {
+			options.Report(path, header.Name)
+		}
+	}
+
+	if manifest == nil {
+		return fmt.Errorf("'%v' is not a TMSU archive: it has no manifest", archivePath)
+	}
+
+	settings, err := store.Settings(tx)
+	if err != nil {
+		return err
+	}
+
+	for _, manifestFile := range manifest.Files {
+		if !restored[manifestFile.Name] || len(manifestFile.Tags) == 0 {
+			continue
+		}
+
+		path := filepath.Join(absDestPath, filepath.FromSlash(manifestFile.Name))
+		if options.Tagged != nil {
+			options.Tagged(path, manifestFile.Tags)
+		}
+		if options.Pretend {
+			continue
+		}
+
+		tagValues := make([]TagValue, len(manifestFile.Tags))
+		for index, tag := range manifestFile.Tags {
+			tagValues[index] = ParseTagValue(tag)
+		}
+
+		pairs, err := ResolveTagValues(store, tx, tagValues, settings.AutoCreateTags(), settings.AutoCreateValues())
+		if err != nil {
+			return fmt.Errorf("%v: %v", manifestFile.Name, err)
+		}
+
+		if err := TagPath(store, tx, path, pairs, settings, TagOptions{}); err != nil {
+			return fmt.Errorf("%v: could not apply tags: %v", path, err)
+		}
+	}
+
+	return nil
+}
+
+// unexported
+
+type archiveManifest struct {
+	Files []archiveManifestFile `json:"files"`
+}
+
+type archiveManifestFile struct {
+	Name     string   `json:"name"`     // the path within the archive
+	Original string   `json:"original"` // the path the file was archived from
+	Tags     []string `json:"tags"`
+}
+
+// A file whose content has been stored in the archive.
+type archivedFile struct {
+	path string
+	name string
+}
+
+// The deepest directory containing all of the files.
+func commonDirectory(files entities.Files) string {
+	if len(files) == 0 {
+		return string(filepath.Separator)
+	}
+
+	common := files[0].Directory
+	for _, file := range files[1:] {
+		for !isWithin(file.Directory, common) {
+			parent := filepath.Dir(common)
+			if parent == common {
+				break
+			}
+
+			common = parent
+		}
+	}
+
+	return common
+}
+
+func isWithin(path, dir string) bool {
+	return path == dir || strings.HasPrefix(path, strings.TrimSuffix(dir, string(filepath.Separator))+string(filepath.Separator))
+}
+
+func writeArchiveManifest(writer *tar.Writer, manifest archiveManifest) error {
+	content, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	header := &tar.Header{Name: ArchiveManifestName, Mode: 0644, Size: int64(len(content)), ModTime: time.Now(), Typeflag: tar.TypeReg}
+	if err := writer.WriteHeader(header); err != nil {
+		return fmt.Errorf("could not write archive manifest: %v", err)
+	}
+
+	if _, err := writer.Write(content); err != nil {
+		return fmt.Errorf("could not write archive manifest: %v", err)
+	}
+
+	return nil
+}
+
+// Writes the file to the archive, as a hard link to an earlier entry with the
+// same content if there is one, reporting whether it was written rather than
+// skipped.
+func writeArchiveEntry(writer *tar.Writer, file *entities.File, name string, stored map[string]archivedFile) (bool, error) {
+	path := file.Path()
+
+	stat, err := os.Lstat(path)
+	if err != nil {
+		log.Warnf("%v: skipping as it could not be read: %v", path, err)
+		return false, nil
+	}
+
+	linkTarget := ""
+	if stat.Mode()&os.ModeSymlink != 0 {
+		if linkTarget, err = os.Readlink(path); err != nil {
+			log.Warnf("%v: skipping as it could not be read: %v", path, err)
+			return false, nil
+		}
+	}
+
+	header, err := tar.FileInfoHeader(stat, linkTarget)
+	if err != nil {
+		log.Warnf("%v: skipping: %v", path, err)
+		return false, nil
+	}
+	header.Name = name
+
+	if !stat.Mode().IsRegular() {
+		if stat.IsDir() {
+			header.Name += "/"
+		}
+
+		if err := writer.WriteHeader(header); err != nil {
+			return false, fmt.Errorf("%v: could not write to archive: %v", path, err)
+		}
+
+		return true, nil
+	}
+
+	key := ""
+	if file.Fingerprint != "" {
+		key = fmt.Sprintf("%v:%v", file.Fingerprint, stat.Size())
+	}
+
+	if original, ok := stored[key]; ok && key != "" {
+		same, err := sameContent(original.path, path)
+		if err != nil {
+			log.Warnf("%v: could not compare with '%v': %v", path, original.path, err)
+		}
+		if same {
+			header.Typeflag, header.Linkname, header.Size = tar.TypeLink, original.name, 0
+
+			if err := writer.WriteHeader(header); err != nil {
+				return false, fmt.Errorf("%v: could not write to archive: %v", path, err)
+			}
+
+			return true, nil
+		}
+	}
+
+	input, err := os.Open(path)
+	if err != nil {
+		log.Warnf("%v: skipping as it could not be read: %v", path, err)
+		return false, nil
+	}
+	defer input.Close()
+
+	if err := writer.WriteHeader(header); err != nil {
+		return false, fmt.Errorf("%v: could not write to archive: %v", path, err)
+	}
+
+	if _, err := io.CopyN(writer, input, header.Size); err != nil {
+		return false, fmt.Errorf("%v: could not write to archive: %v", path, err)
+	}
+
+	if _, ok := stored[key]; !ok && key != "" {
+		stored[key] = archivedFile{path, name}
+	}
+
+	return true, nil
+}
+
+// Whether the two files have the same content.
+func sameContent(path1, path2 string) (bool, error) {
+	file1, err := os.Open(path1)
+	if err != nil {
+		return false, err
+	}
+	defer file1.Close()
+
+	file2, err := os.Open(path2)
+	if err != nil {
+		return false, err
+	}
+	defer file2.Close()
+
+	buffer1, buffer2 := make([]byte, 64*1024), make([]byte, 64*1024)
+	for {
+		count1, err1 := io.ReadFull(file1, buffer1)
+		count2, err2 := io.ReadFull(file2, buffer2)
+
+		if !bytes.Equal(buffer1[:count1], buffer2[:count2]) {
+			return false, nil
+		}
+
+		switch {
+		case err1 == io.EOF || err1 == io.ErrUnexpectedEOF:
+			return err2 == io.EOF || err2 == io.ErrUnexpectedEOF, nil
+		case err1 != nil:
+			return false, err1
+		case err2 != nil:
+			return false, err2
+		}
+	}
+}
+
+// The path within the destination directory of the archive entry, which must
+// not lie outside of it, either directly or through a symbolic link restored
+// by an earlier entry.
+func archiveEntryPath(destPath, name string) (string, error) {
+	path := filepath.Join(destPath, filepath.FromSlash(name))
+	if !isWithin(path, destPath) {
+		return "", fmt.Errorf("archive entry '%v' lies outside of the destination directory", name)
+	}
+
+	for dirPath := filepath.Dir(path); isWithin(dirPath, destPath) && dirPath != destPath; dirPath = filepath.Dir(dirPath) {
+		stat, err := os.Lstat(dirPath)
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+
+			return "", fmt.Errorf("%v: could not stat: %v", dirPath, err)
+		}
+
+		if stat.Mode()&os.ModeSymlink != 0 {
+			return "", fmt.Errorf("archive entry '%v' lies within symbolic link '%v'", name, dirPath)
+		}
+	}
+
+	return path, nil
+}
+
+// The path a symbolic link restored at the path with the specified target
+// would resolve to, which must not lie outside of the destination directory.
+func archiveLinkTarget(destPath, path, linkname string) (string, error) {
+	target := filepath.FromSlash(linkname)
+	if !filepath.IsAbs(target) {
+		target = filepath.Join(filepath.Dir(path), target)
+	}
+	target = filepath.Clean(target)
+
+	if !isWithin(target, destPath) {
+		return "", fmt.Errorf("%v: symbolic link to '%v' lies outside of the destination directory", path, linkname)
+	}
+
+	return target, nil
+}
+
+// Checks that the archive entry could be restored at the path, without
+// restoring it, reporting whether it would be.
+func checkArchiveEntry(header *tar.Header, path, destPath string, force bool) (bool, error) {
+	if _, err := os.Lstat(path); err == nil && header.Typeflag != tar.TypeDir && !force {
+		log.Warnf("%v: skipping as it already exists", path)
+		return false, nil
+	}
+
+	switch header.Typeflag {
+	case tar.TypeDir, tar.TypeReg, tar.TypeRegA:
+	case tar.TypeSymlink:
+		if _, err := archiveLinkTarget(destPath, path, header.Linkname); err != nil {
+			return false, err
+		}
+	case tar.TypeLink:
+		if _, err := archiveEntryPath(destPath, header.Linkname); err != nil {
+			return false, err
+		}
+	default:
+		log.Warnf("%v: skipping unsupported archive entry", path)
+		return false, nil
+	}
+
+	return true, nil
+}
+
+// Restores the archive entry at the path, reporting whether it was restored.
+func restoreArchiveEntry(reader io.Reader, header *tar.Header, path, destPath string, force bool) (bool, error) {
+	if _, err := os.Lstat(path); err == nil && header.Typeflag != tar.TypeDir {
+		if !force {
+			log.Warnf("%v: skipping as it already exists", path)
+			return false, nil
+		}
+
+		if err := os.Remove(path); err != nil {
+			return false, fmt.Errorf("%v: could not replace: %v", path, err)
+		}
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return false, fmt.Errorf("%v: could not create directory: %v", filepath.Dir(path), err)
+	}
+
+	mode := os.FileMode(header.Mode).Perm()
+
+	switch header.Typeflag {
+	case tar.TypeDir:
+		if stat, err := os.Lstat(path); err == nil && stat.Mode()&os.ModeSymlink != 0 {
+			return false, fmt.Errorf("%v: cannot restore directory over symbolic link", path)
+		}
+
+		if err := os.MkdirAll(path, mode|0700); err != nil {
+			return false, fmt.Errorf("%v: could not create directory: %v", path, err)
+		}
+	case tar.TypeSymlink:
+		if _, err := archiveLinkTarget(destPath, path, header.Linkname); err != nil {
+			return false, err
+		}
+
+		if err := os.Symlink(header.Linkname, path); err != nil {
+			return false, fmt.Errorf("%v: could not create symbolic link: %v", path, err)
+		}
+	case tar.TypeLink:
+		target, err := archiveEntryPath(destPath, header.Linkname)
+		if err != nil {
+			return false, err
+		}
+
+		if err := os.Link(target, path); err != nil {
+			return false, fmt.Errorf("%v: could not create hard link: %v", path, err)
+		}
+	case tar.TypeReg, tar.TypeRegA:
+		output, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, mode)
+		if err != nil {
+			return false, fmt.Errorf("%v: could not create: %v", path, err)
+		}
+
+		if _, err := io.Copy(output, reader); err != nil {
+			output.Close()
+			return false, fmt.Errorf("%v: could not write: %v", path, err)
+		}
+
+		if err := output.Close(); err != nil {
+			return false, fmt.Errorf("%v: could not write: %v", path, err)
+		}
+	default:
+		log.Warnf("%v: skipping unsupported archive entry", path)
+		return false, nil
+	}
+
+	if header.Typeflag != tar.TypeSymlink {
+		os.Chtimes(path, header.ModTime, header.ModTime)
+	}
+
+	return true, nil
+}
+
+// Creates the archive file, compressing what is written to it as its name
+// specifies.
+func createArchive(path string) (io.WriteCloser, error) {
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, fmt.Errorf("could not create archive '%v': %v", path, err)
+	}
+
+	switch archiveCompression(path) {
+	case "gzip":
+		return &chainedWriteCloser{gzip.NewWriter(file), file}, nil
+	case "zstd":
+		command := exec.Command("zstd", "-q", "-c", "-")
+		command.Stdout = file
+		command.Stderr = os.Stderr
+
+		stdin, err := command.StdinPipe()
+		if err != nil {
+			file.Close()
+			return nil, err
+		}
+
+		if err := command.Start(); err != nil {
+			file.Close()
+			return nil, fmt.Errorf("could not run 'zstd', which is needed to compress '%v': %v", path, err)
+		}
+
+		return &commandWriteCloser{stdin, command, file}, nil
+	default:
+		return file, nil
+	}
+}
+
+// Opens the archive file, decompressing it as its name specifies.
+func openArchive(path string) (io.ReadCloser, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("could not open archive '%v': %v", path, err)
+	}
+
+	switch archiveCompression(path) {
+	case "gzip":
+		reader, err := gzip.NewReader(file)
+		if err != nil {
+			file.Close()
+			return nil, fmt.Errorf("could not read archive '%v': %v", path, err)
+		}
+
+		return &chainedReadCloser{reader, file}, nil
+	case "zstd":
+		command := exec.Command("zstd", "-q", "-d", "-c")
+		command.Stdin = file
+		command.Stderr = os.Stderr
+
+		stdout, err := command.StdoutPipe()
+		if err != nil {
+			file.Close()
+			return nil, err
+		}
+
+		if err := command.Start(); err != nil {
+			file.Close()
+			return nil, fmt.Errorf("could not run 'zstd', which is needed to decompress '%v': %v", path, err)
+		}
+
+		return &commandReadCloser{stdout, command, file}, nil
+	default:
+		return file, nil
+	}
+}
+
+func archiveCompression(path string) string {
+	switch {
+	case strings.HasSuffix(path, ".gz"), strings.HasSuffix(path, ".tgz"):
+		return "gzip"
+	case strings.HasSuffix(path, ".zst"), strings.HasSuffix(path, ".tzst"):
+		return "zstd"
+	default:
+		return ""
+	}
+}
+
+// Closes the compressor and then the file beneath it.
+type chainedWriteCloser struct {
+	io.WriteCloser
+	file *os.File
+}
+
+func (writer *chainedWriteCloser) Close() error {
+	err := writer.WriteCloser.Close()
+	if fileErr := writer.file.Close(); err == nil {
+		err = fileErr
+	}
+
+	return err
+}
+
+type chainedReadCloser struct {
+	io.ReadCloser
+	file *os.File
+}
+
+func (reader *chainedReadCloser) Close() error {
+	reader.ReadCloser.Close()
+	return reader.file.Close()
+}
+
+// Writes to a compression command, waiting for it to finish on close.
+type commandWriteCloser struct {
+	io.WriteCloser
+	command *exec.Cmd
+	file    *os.File
+}
+
+func (writer *commandWriteCloser) Close() error {
+	err := writer.WriteCloser.Close()
+	if waitErr := writer.command.Wait(); err == nil && waitErr != nil {
+		err = fmt.Errorf("zstd failed: %v", waitErr)
+	}
+	if fileErr := writer.file.Close(); err == nil {
+		err = fileErr
+	}
+
+	return err
+}
+
+type commandReadCloser struct {
+	io.ReadCloser
+	command *exec.Cmd
+	file    *os.File
+}
+
+func (reader *commandReadCloser) Close() error {
+	reader.command.Process.Kill()
+	reader.command.Wait()
+	return reader.file.Close()
+}
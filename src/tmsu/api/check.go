@@ -0,0 +1,374 @@
+// Copyright 2011-2015 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package api
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"tmsu/entities"
+	"tmsu/storage"
+)
+
+// A problem found by a consistency check.
+type Problem struct {
+	Check       string // the name of the check that found the problem
+	Description string
+	Fixed       bool // whether the problem was repaired
+}
+
+// A consistency check of the database against itself and the filesystem.
+type Check struct {
+	Name        string
+	Description string
+	Fixable     bool // whether the check can repair the problems it finds
+
+	run func(store *storage.Storage, tx *storage.Tx, fix bool) ([]Problem, error)
+}
+
+// The consistency checks, in the order they are run: orphans are removed first
+// as they may otherwise hide untagged files.
+var Checks = []Check{
+	{"orphans", "taggings, implications and exclusions referring to missing files, tags or values", true, checkOrphans},
+	{"untagged", "files with neither tags nor a note", true, checkUntaggedFiles},
+	{"unused", "tags that are not applied to any file", false, checkUnusedTags},
+	{"duplicates", "files recorded more than once under equivalent paths", false, checkDuplicatePaths},
+	{"exclusions", "files with more than one tag of a set of mutually exclusive tags", false, checkExclusions},
+	{"redundant", "files tagged with a tag that is also applied to a directory containing them", false, checkRedundantTags},
+}
+
+// Runs the named checks, or all of them if none are named, repairing the
+// problems found where fix is set and the check can do so safely.
+func RunChecks(store *storage.Storage, tx *storage.Tx, names []string, fix bool) ([]Problem, error) {
+	selected := make(map[string]bool, len(names))
+	for _, name := range names {
+		if !isCheck(name) {
+			return nil, fmt.Errorf("no such check '%v'", name)
+		}
+
+		selected[name] = true
+	}
+
+	problems := make([]Problem, 0, 10)
+	for _, check := range Checks {
+		if len(selected) > 0 && !selected[check.Name] {
+			continue
+		}
+
+		checkProblems, err := check.run(store, tx, fix && check.Fixable)
+		if err != nil {
+			return nil, fmt.Errorf("%v check failed: %v", check.Name, err)
+		}
+
+		problems = append(problems, checkProblems...)
+	}
+
+	return problems, nil
+}
+
+// unexported
+
+func isCheck(name string) bool {
+	for _, check := range Checks {
+		if check.Name == name {
+			return true
+		}
+	}
+
+	return false
+}
+
+func checkOrphans(store *storage.Storage, tx *storage.Tx, fix bool) ([]Problem, error) {
+	counts, err := store.OrphanCounts(tx)
+	if err != nil {
+		return nil, fmt.Errorf("could not count orphans: %v", err)
+	}
+	if counts.Total() == 0 {
+		return nil, nil
+	}
+
+	if fix {
+		if err := store.DeleteOrphans(tx); err != nil {
+			return nil, fmt.Errorf("could not delete orphans: %v", err)
+		}
+	}
+
+	problems := make([]Problem, 0, 3)
+	if counts.FileTags > 0 {
+		problems = append(problems, Problem{"orphans", fmt.Sprintf("%v tagging(s) refer to missing files, tags or values", counts.FileTags), fix})
+	}
+	if counts.Implications > 0 {
+		problems = append(problems, Problem{"orphans", fmt.Sprintf("%v implication(s) refer to missing tags", counts.Implications), fix})
+	}
+	if counts.Exclusions > 0 {
+		problems = append(problems, Problem{"orphans", fmt.Sprintf("%v exclusion(s) refer to missing tags", counts.Exclusions), fix})
+	}
+
+	return problems, nil
+}
+
+func checkUntaggedFiles(store *storage.Storage, tx *storage.Tx, fix bool) ([]Problem, error) {
+	files, err := store.UntaggedFiles(tx)
+	if err != nil {
+		return nil, fmt.Errorf("could not retrieve untagged files: %v", err)
+	}
+
+	problems := make([]Problem, 0, len(files))
+	fileIds := make(entities.FileIds, 0, len(files))
+	for _, file := range files {
+		note, err := store.FileNote(tx, file.Id)
+		if err != nil {
+			return nil, fmt.Errorf("%v: could not retrieve note: %v", file.Path(), err)
+		}
+		if note != "" {
+			continue
+		}
+
+		problems = append(problems, Problem{"untagged", fmt.Sprintf("%v: file has no tags", file.Path()), fix})
+		fileIds = append(fileIds, file.Id)
+	}
+
+	if fix && len(fileIds) > 0 {
+		if err := store.DeleteUntaggedFiles(tx, fileIds); err != nil {
+			return nil, fmt.Errorf("could not delete untagged files: %v", err)
+		}
+	}
+
+	sortProblems(problems)
+
+	return problems, nil
+}
+
+func checkUnusedTags(store *storage.Storage, tx *storage.Tx, fix bool) ([]Problem, error) {
+	tags, err := store.Tags(tx)
+	if err != nil {
+		return nil, fmt.Errorf("could not retrieve tags: %v", err)
+	}
+
+	usages, err := store.TagUsage(tx)
+	if err != nil {
+		return nil, fmt.Errorf("could not retrieve tag usage: %v", err)
+	}
+
+	used := make(map[entities.TagId]bool, len(usages))
+	for _, usage := range usages {
+		used[usage.Id] = true
+	}
+
+	problems := make([]Problem, 0, 10)
+	for _, tag := range tags {
+		if !used[tag.Id] {
+			problems = append(problems, Problem{"unused", fmt.Sprintf("tag '%v' is not applied to any file", tag.Name), false})
+		}
+	}
+
+	return problems, nil
+}
+
+func checkDuplicatePaths(store *storage.Storage, tx *storage.Tx, fix bool) ([]Problem, error) {
+	files, err := store.Files(tx, "name")
+	if err != nil {
+		return nil, fmt.Errorf("could not retrieve files: %v", err)
+	}
+
+	counts := make(map[string]uint, len(files))
+	for _, file := range files {
+		counts[filepath.Clean(file.Path())]++
+	}
+
+	problems := make([]Problem, 0, 10)
+	for path, count := range counts {
+		if count > 1 {
+			problems = append(problems, Problem{"duplicates", fmt.Sprintf("%v: file is recorded %v times", path, count), false})
+		}
+	}
+
+	sortProblems(problems)
+
+	return problems, nil
+}
+
+func checkExclusions(store *storage.Storage, tx *storage.Tx, fix bool) ([]Problem, error) {
+	exclusions, err := store.Exclusions(tx)
+	if err != nil {
+		return nil, fmt.Errorf("could not retrieve exclusions: %v", err)
+	}
+
+	problems := make([]Problem, 0, 10)
+
+	for index := 0; index < len(exclusions); {
+		set := exclusions[index].Set
+
+		// the tags of the set applied to each file
+		tagNames := make(map[entities.FileId][]string)
+		for ; index < len(exclusions) && exclusions[index].Set == set; index++ {
+			tag := exclusions[index].Tag
+
+			fileTags, err := store.FileTagsByTagId(tx, tag.Id, false)
+			if err != nil {
+				return nil, fmt.Errorf("could not retrieve files for tag '%v': %v", tag.Name, err)
+			}
+
+			for _, fileId := range fileTags.FileIds().Uniq() {
+				tagNames[fileId] = append(tagNames[fileId], tag.Name)
+			}
+		}
+
+		fileIds := make(entities.FileIds, 0, len(tagNames))
+		for fileId, names := range tagNames {
+			if len(names) > 1 {
+				fileIds = append(fileIds, fileId)
+			}
+		}
+		sort.Sort(fileIds)
+
+		for _, fileId := range fileIds {
+			file, err := store.File(tx, fileId)
+			if err != nil {
+				return nil, fmt.Errorf("could not retrieve file #%v: %v", fileId, err)
+			}
+
+			description := fmt.Sprintf("%v: has mutually exclusive tags '%v' of set '%v'", file.Path(), joinNames(tagNames[fileId]), set)
+			problems = append(problems, Problem{"exclusions", description, false})
+		}
+	}
+
+	return problems, nil
+}
+
+func checkRedundantTags(store *storage.Storage, tx *storage.Tx, fix bool) ([]Problem, error) {
+	files, err := store.Files(tx, "none")
+	if err != nil {
+		return nil, fmt.Errorf("could not retrieve files: %v", err)
+	}
+
+	paths := make(map[entities.FileId]string, len(files))
+	fileIds := make(map[string]entities.FileId, len(files))
+	for _, file := range files {
+		paths[file.Id] = file.Path()
+		if file.IsDir {
+			fileIds[file.Path()] = file.Id
+		}
+	}
+	if len(fileIds) == 0 {
+		return nil, nil
+	}
+
+	fileTags, err := store.FileTags(tx)
+	if err != nil {
+		return nil, fmt.Errorf("could not retrieve taggings: %v", err)
+	}
+
+	tagNames, valueNames, err := tagAndValueNames(store, tx)
+	if err != nil {
+		return nil, err
+	}
+
+	type tagging struct {
+		fileId  entities.FileId
+		tagId   entities.TagId
+		valueId entities.ValueId
+	}
+
+	applied := make(map[tagging]bool, len(fileTags))
+	for _, fileTag := range fileTags {
+		applied[tagging{fileTag.FileId, fileTag.TagId, fileTag.ValueId}] = true
+	}
+
+	problems := make([]Problem, 0, 10)
+	for _, fileTag := range fileTags {
+		path, ok := paths[fileTag.FileId]
+		if !ok {
+			continue
+		}
+
+		for dir := filepath.Dir(path); ; dir = filepath.Dir(dir) {
+			dirId, ok := fileIds[dir]
+			if ok && applied[tagging{dirId, fileTag.TagId, fileTag.ValueId}] {
+				tagValue := TagValue{tagNames[fileTag.TagId], valueNames[fileTag.ValueId]}
+				description := fmt.Sprintf("%v: tag '%v' is also applied to the containing directory '%v'", path, tagValue, dir)
+				problems = append(problems, Problem{"redundant", description, false})
+				break
+			}
+
+			if dir == filepath.Dir(dir) {
+				break
+			}
+		}
+	}
+
+	sortProblems(problems)
+
+	return problems, nil
+}
+
+func tagAndValueNames(store *storage.Storage, tx *storage.Tx) (map[entities.TagId]string, map[entities.ValueId]string, error) {
+	tags, err := store.Tags(tx)
+	if err != nil {
+		return nil, nil, fmt.Errorf("could not retrieve tags: %v", err)
+	}
+
+	values, err := store.Values(tx)
+	if err != nil {
+		return nil, nil, fmt.Errorf("could not retrieve values: %v", err)
+	}
+
+	tagNames := make(map[entities.TagId]string, len(tags))
+	for _, tag := range tags {
+		tagNames[tag.Id] = tag.Name
+	}
+
+	valueNames := make(map[entities.ValueId]string, len(values))
+	for _, value := range values {
+		valueNames[value.Id] = value.Name
+	}
+
+	return tagNames, valueNames, nil
+}
+
+func sortProblems(problems []Problem) {
+	sort.Sort(problemsByDescription(problems))
+}
+
+type problemsByDescription []Problem
+
+func (problems problemsByDescription) Len() int {
+	return len(problems)
+}
+
+func (problems problemsByDescription) Less(i, j int) bool {
+	return problems[i].Description < problems[j].Description
+}
+
+func (problems problemsByDescription) Swap(i, j int) {
+	problems[i], problems[j] = problems[j], problems[i]
+}
+
+func joinNames(names []string) string {
+	joined := ""
+	for index, name := range names {
+		switch {
+		case index == 0:
+			joined = name
+		case index == len(names)-1:
+			joined += "' and '" + name
+		default:
+			joined += "', '" + name
+		}
+	}
+
+	return joined
+}
@@ -0,0 +1,238 @@
+// Copyright 2011-2015 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package api
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"runtime"
+	"sort"
+	"strings"
+	"time"
+	"tmsu/entities"
+	"tmsu/query"
+	"tmsu/storage"
+	"tmsu/version"
+)
+
+// A report on a database and the platform for attaching to bug reports. Paths
+// are replaced by hashes that are consistent within the report only.
+type Diagnostics struct {
+	Version      string                       `json:"version"`
+	Platform     string                       `json:"platform"`
+	GoVersion    string                       `json:"goVersion"`
+	Database     string                       `json:"database"`
+	RootPath     string                       `json:"rootPath"`
+	Size         int64                        `json:"size"`
+	Statistics   *entities.DatabaseStatistics `json:"statistics"`
+	Orphans      entities.OrphanCounts        `json:"orphans"`
+	Settings     entities.Settings            `json:"settings"`
+	QueryTimings []QueryTiming                `json:"queryTimings"` // slowest first
+}
+
+// The time taken by a representative query against the database.
+type QueryTiming struct {
+	Description string        `json:"description"`
+	Results     int           `json:"results"`
+	Duration    time.Duration `json:"duration"`
+}
+
+// Gathers the diagnostics report, timing a representative set of queries.
+func Diagnose(store *storage.Storage, tx *storage.Tx) (*Diagnostics, error) {
+	anonymiser, err := newAnonymiser()
+	if err != nil {
+		return nil, err
+	}
+
+	diagnostics := Diagnostics{Version: version.Version.String(),
+		Platform:  runtime.GOOS + "/" + runtime.GOARCH,
+		GoVersion: runtime.Version(),
+		Database:  anonymiser.path(store.DbPath),
+		RootPath:  anonymiser.path(store.RootPath)}
+
+	if info, err := os.Stat(store.DbPath); err == nil {
+		diagnostics.Size = info.Size()
+	}
+
+	diagnostics.Statistics, err = store.DatabaseStatistics(tx)
+	if err != nil {
+		return nil, fmt.Errorf("could not retrieve database statistics: %v", err)
+	}
+
+	diagnostics.Orphans, err = store.OrphanCounts(tx)
+	if err != nil {
+		return nil, fmt.Errorf("could not count orphans: %v", err)
+	}
+
+	settings, err := store.Settings(tx)
+	if err != nil {
+		return nil, fmt.Errorf("could not retrieve settings: %v", err)
+	}
+
+	diagnostics.Settings = make(entities.Settings, len(settings))
+	for index, setting := range settings {
+		diagnostics.Settings[index] = &entities.Setting{Name: setting.Name, Value: anonymiser.setting(setting.Name, setting.Value)}
+	}
+	sort.Sort(settingsByName(diagnostics.Settings))
+
+	diagnostics.QueryTimings, err = timeQueries(store, tx)
+	if err != nil {
+		return nil, err
+	}
+
+	return &diagnostics, nil
+}
+
+// unexported
+
+func timeQueries(store *storage.Storage, tx *storage.Tx) ([]QueryTiming, error) {
+	tagUsage, err := store.TagUsage(tx)
+	if err != nil {
+		return nil, fmt.Errorf("could not retrieve tag usage: %v", err)
+	}
+
+	var mostUsed entities.TagFileCount
+	for _, usage := range tagUsage {
+		if usage.FileCount > mostUsed.FileCount {
+			mostUsed = usage
+		}
+	}
+
+	queries := []struct {
+		description string
+		run         func() (int, error)
+	}{
+		{"list files", func() (int, error) {
+			files, err := store.Files(tx, "name")
+			return len(files), err
+		}},
+		{"list tags", func() (int, error) {
+			tags, err := store.Tags(tx)
+			return len(tags), err
+		}},
+		{"tag usage", func() (int, error) {
+			usage, err := store.TagUsage(tx)
+			return len(usage), err
+		}},
+		{"list taggings", func() (int, error) {
+			fileTags, err := store.FileTags(tx)
+			return len(fileTags), err
+		}},
+		{"query for the most used tag", func() (int, error) {
+			files, err := store.QueryFiles(tx, query.TagExpression{Name: mostUsed.Name}, "", false, "none", 0)
+			return len(files), err
+		}},
+		{"query excluding the most used tag", func() (int, error) {
+			files, err := store.QueryFiles(tx, query.NotExpression{Operand: query.TagExpression{Name: mostUsed.Name}}, "", false, "none", 0)
+			return len(files), err
+		}},
+		{"untagged files", func() (int, error) {
+			files, err := store.UntaggedFiles(tx)
+			return len(files), err
+		}},
+		{"duplicate files", func() (int, error) {
+			duplicates, err := store.DuplicateFiles(tx)
+			return len(duplicates), err
+		}},
+	}
+
+	timings := make([]QueryTiming, 0, len(queries))
+	for _, query := range queries {
+		if mostUsed.Name == "" && strings.Contains(query.description, "most used tag") {
+			continue
+		}
+
+		started := time.Now()
+		results, err := query.run()
+		if err != nil {
+			return nil, fmt.Errorf("could not time query '%v': %v", query.description, err)
+		}
+
+		timings = append(timings, QueryTiming{query.description, results, time.Since(started)})
+	}
+
+	sort.Sort(queryTimingsBySlowest(timings))
+
+	return timings, nil
+}
+
+// Replaces paths with salted hashes, so that the same path is replaced by the
+// same hash within a report but cannot be recovered by hashing likely paths.
+type anonymiser struct {
+	salt []byte
+}
+
+func newAnonymiser() (*anonymiser, error) {
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, fmt.Errorf("could not generate salt: %v", err)
+	}
+
+	return &anonymiser{salt}, nil
+}
+
+func (anonymiser *anonymiser) path(path string) string {
+	if path == "" {
+		return ""
+	}
+
+	hash := sha256.New()
+	hash.Write(anonymiser.salt)
+	hash.Write([]byte(path))
+
+	return "path:" + hex.EncodeToString(hash.Sum(nil))[:12]
+}
+
+// Anonymises the values of settings that may contain paths or identify the
+// database: the patterns, commands and identifier.
+func (anonymiser *anonymiser) setting(name, value string) string {
+	if name == "databaseId" || strings.ContainsAny(value, `/\`) {
+		return anonymiser.path(value)
+	}
+
+	return value
+}
+
+type settingsByName entities.Settings
+
+func (settings settingsByName) Len() int {
+	return len(settings)
+}
+
+func (settings settingsByName) Less(i, j int) bool {
+	return settings[i].Name < settings[j].Name
+}
+
+func (settings settingsByName) Swap(i, j int) {
+	settings[i], settings[j] = settings[j], settings[i]
+}
+
+type queryTimingsBySlowest []QueryTiming
+
+func (timings queryTimingsBySlowest) Len() int {
+	return len(timings)
+}
+
+func (timings queryTimingsBySlowest) Less(i, j int) bool {
+	return timings[i].Duration > timings[j].Duration
+}
+
+func (timings queryTimingsBySlowest) Swap(i, j int) {
+	timings[i], timings[j] = timings[j], timings[i]
+}
@@ -0,0 +1,274 @@
+// Copyright 2011-2015 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package api
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"tmsu/common/log"
+	_path "tmsu/common/path"
+	"tmsu/storage"
+)
+
+// The default pattern of file names with embedded tags, as in
+// 'beach [holiday year=2015].jpg'.
+const DefaultEmbedPattern = "{name} [{tags}]{ext}"
+
+// A pattern of file names with embedded tags, in which {name} stands for the
+// file's name without its extension, {tags} for its tags separated by spaces
+// and {ext} for its extension.
+type EmbedPattern struct {
+	text   string
+	regexp *regexp.Regexp
+}
+
+type EmbedOptions struct {
+	Pretend bool                       // report the changes without making them
+	Report  func(path, newPath string) // called for each file renamed
+}
+
+// Parses the pattern, which must include the {name} and {tags} placeholders.
+func ParseEmbedPattern(pattern string) (*EmbedPattern, error) {
+	expression := "^"
+	found := make(map[string]bool, 3)
+
+	for remaining := pattern; ; {
+		start := strings.IndexRune(remaining, '{')
+		if start == -1 {
+			expression += regexp.QuoteMeta(remaining)
+			break
+		}
+
+		end := strings.IndexRune(remaining[start:], '}')
+		if end == -1 {
+			return nil, fmt.Errorf("pattern '%v' has an unmatched '{'", pattern)
+		}
+		end += start
+
+		placeholder := remaining[start+1 : end]
+		if found[placeholder] {
+			return nil, fmt.Errorf("pattern '%v' has more than one {%v}", pattern, placeholder)
+		}
+		found[placeholder] = true
+
+		expression += regexp.QuoteMeta(remaining[:start])
+		switch placeholder {
+		case "name":
+			expression += "(?P<name>.+?)"
+		case "tags":
+			expression += "(?P<tags>.*?)"
+		case "ext":
+			expression += `(?P<ext>\.[^.]*)?`
+		default:
+			return nil, fmt.Errorf("pattern '%v' has an unknown placeholder {%v}: must be {name}, {tags} or {ext}", pattern, placeholder)
+		}
+
+		remaining = remaining[end+1:]
+	}
+
+	if !found["name"] || !found["tags"] {
+		return nil, fmt.Errorf("pattern '%v' must include {name} and {tags}", pattern)
+	}
+
+	compiled, err := regexp.Compile(expression + "$")
+	if err != nil {
+		return nil, fmt.Errorf("invalid pattern '%v': %v", pattern, err)
+	}
+
+	return &EmbedPattern{pattern, compiled}, nil
+}
+
+// The file name with the tags embedded or, if there are none, just the name
+// and extension.
+func (pattern *EmbedPattern) Expand(name string, tags []string, ext string) string {
+	if len(tags) == 0 {
+		return name + ext
+	}
+
+	expanded := strings.Replace(pattern.text, "{name}", name, 1)
+	expanded = strings.Replace(expanded, "{tags}", strings.Join(tags, " "), 1)
+
+	if strings.Contains(pattern.text, "{ext}") {
+		return strings.Replace(expanded, "{ext}", ext, 1)
+	}
+
+	return expanded + ext
+}
+
+// Splits a file name matching the pattern into the name, the embedded tags
+// and the extension, reporting whether it matched.
+func (pattern *EmbedPattern) Match(fileName string) (string, []string, string, bool) {
+	ext := ""
+	if !strings.Contains(pattern.text, "{ext}") {
+		ext = filepath.Ext(fileName)
+		fileName = fileName[:len(fileName)-len(ext)]
+	}
+
+	match := pattern.regexp.FindStringSubmatch(fileName)
+	if match == nil {
+		return "", nil, "", false
+	}
+
+	var name string
+	var tags []string
+	for index, group := range pattern.regexp.SubexpNames() {
+		switch group {
+		case "name":
+			name = match[index]
+		case "tags":
+			tags = strings.Fields(match[index])
+		case "ext":
+			ext = match[index]
+		}
+	}
+
+	return name, tags, ext, true
+}
+
+// Renames each of the files to include its tags in its name, as the pattern
+// specifies, updating its path in the database. Tags already embedded in the
+// name are replaced. Files that are not tagged are skipped with a warning.
+func Embed(store *storage.Storage, tx *storage.Tx, paths []string, pattern *EmbedPattern, options EmbedOptions) error {
+	for _, path := range paths {
+		absPath, err := _path.Abs(path)
+		if err != nil {
+			return fmt.Errorf("%v: could not get absolute path: %v", path, err)
+		}
+
+		file, err := store.FileByPath(tx, absPath)
+		if err != nil {
+			return fmt.Errorf("%v: could not retrieve file: %v", path, err)
+		}
+		if file == nil {
+			log.Warnf("%v: skipping as it is not tagged", path)
+			continue
+		}
+
+		tagValues, err := FileTagValues(store, tx, file.Id, true)
+		if err != nil {
+			return err
+		}
+
+		tags := make([]string, len(tagValues))
+		for index, tagValue := range tagValues {
+			tags[index] = tagValue.String()
+		}
+		sort.Strings(tags)
+
+		name, ext := splitEmbeddedName(pattern, file.Name, file.IsDir)
+		newPath := filepath.Join(file.Directory, pattern.Expand(name, tags, ext))
+
+		if _, err := renameEmbedded(store, tx, absPath, newPath, options); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Applies the tags embedded in the names of each of the files, as the pattern
+// specifies, and renames them to remove the tags from their names. Files
+// without embedded tags are skipped.
+func Extract(store *storage.Storage, tx *storage.Tx, paths []string, pattern *EmbedPattern, options EmbedOptions) error {
+	settings, err := store.Settings(tx)
+	if err != nil {
+		return err
+	}
+
+	for _, path := range paths {
+		absPath, err := _path.Abs(path)
+		if err != nil {
+			return fmt.Errorf("%v: could not get absolute path: %v", path, err)
+		}
+
+		name, tags, ext, matched := pattern.Match(filepath.Base(absPath))
+		if !matched || len(tags) == 0 {
+			log.Infof(2, "%v: no embedded tags", path)
+			continue
+		}
+
+		tagValues := make([]TagValue, len(tags))
+		for index, tag := range tags {
+			tagValues[index] = ParseTagValue(tag)
+		}
+
+		newPath := filepath.Join(filepath.Dir(absPath), name+ext)
+		renamed, err := renameEmbedded(store, tx, absPath, newPath, options)
+		if err != nil {
+			return err
+		}
+		if !renamed || options.Pretend {
+			continue
+		}
+
+		pairs, err := ResolveTagValues(store, tx, tagValues, settings.AutoCreateTags(), settings.AutoCreateValues())
+		if err != nil {
+			return fmt.Errorf("%v: %v", path, err)
+		}
+
+		if err := TagPath(store, tx, newPath, pairs, settings, TagOptions{}); err != nil {
+			return fmt.Errorf("%v: could not apply tags: %v", newPath, err)
+		}
+	}
+
+	return nil
+}
+
+// unexported
+
+// The file's name and extension, without any tags already embedded.
+func splitEmbeddedName(pattern *EmbedPattern, fileName string, isDir bool) (string, string) {
+	if name, _, ext, matched := pattern.Match(fileName); matched {
+		return name, ext
+	}
+
+	if isDir {
+		return fileName, ""
+	}
+
+	ext := filepath.Ext(fileName)
+
+	return fileName[:len(fileName)-len(ext)], ext
+}
+
+// Renames the file, reporting whether it was renamed: it is not if the new
+// path is already taken.
+func renameEmbedded(store *storage.Storage, tx *storage.Tx, path, newPath string, options EmbedOptions) (bool, error) {
+	if newPath == path {
+		return true, nil
+	}
+
+	if _, err := os.Lstat(newPath); err == nil {
+		log.Warnf("%v: skipping as '%v' already exists", path, newPath)
+		return false, nil
+	}
+
+	if !options.Pretend {
+		if err := moveFile(store, tx, path, newPath); err != nil {
+			return false, err
+		}
+	}
+
+	if options.Report != nil {
+		options.Report(path, newPath)
+	}
+
+	return true, nil
+}
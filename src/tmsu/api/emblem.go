@@ -0,0 +1,156 @@
+// Copyright 2011-2015 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package api
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"sort"
+	"strings"
+	"tmsu/common/log"
+	"tmsu/common/xattr"
+	"tmsu/entities"
+	"tmsu/storage"
+)
+
+const (
+	// The extended attribute holding a file's comma-separated tags, as read
+	// by KDE Dolphin.
+	XdgTagsAttribute = "user.xdg.tags"
+
+	// The GIO metadata attribute holding the emblems GNOME Files shows.
+	GnomeEmblemsAttribute = "metadata::emblems"
+)
+
+type EmblemOptions struct {
+	ExplicitOnly bool                             // only include explicitly applied tags
+	Gnome        bool                             // also set the emblems shown by GNOME Files
+	Clear        bool                             // remove the tags rather than writing them
+	Pretend      bool                             // report the changes without making them
+	Report       func(path string, tags []string) // called for each file updated
+}
+
+// Writes the tags of each file to the metadata that desktop file managers
+// display: the 'user.xdg.tags' extended attribute and, optionally, the GNOME
+// emblems. Only files whose extended attribute differs are reported. Files
+// that cannot be updated are skipped with a warning.
+func SyncEmblems(store *storage.Storage, tx *storage.Tx, files entities.Files, options EmblemOptions) error {
+	gio := ""
+	if options.Gnome {
+		var err error
+		if gio, err = exec.LookPath("gio"); err != nil {
+			return fmt.Errorf("could not find 'gio', which is needed to set GNOME emblems: %v", err)
+		}
+	}
+
+	for _, file := range files {
+		path := file.Path()
+
+		var tags []string
+		if !options.Clear {
+			tagValues, err := FileTagValues(store, tx, file.Id, options.ExplicitOnly)
+			if err != nil {
+				return err
+			}
+
+			tags = make([]string, len(tagValues))
+			for index, tagValue := range tagValues {
+				tags[index] = tagValue.String()
+			}
+
+			sort.Strings(tags)
+		}
+
+		changed, err := syncXdgTags(path, tags, options.Pretend)
+		if err != nil {
+			switch {
+			case os.IsNotExist(err):
+				log.Warnf("%v: no such file", path)
+			case os.IsPermission(err):
+				log.Warnf("%v: permission denied", path)
+			default:
+				log.Warnf("%v: could not update extended attribute: %v", path, err)
+			}
+
+			continue
+		}
+
+		if options.Gnome {
+			if err := setGnomeEmblems(gio, path, tags, options.Pretend); err != nil {
+				log.Warnf("%v: could not set emblems: %v", path, err)
+				continue
+			}
+		}
+
+		if changed && options.Report != nil {
+			options.Report(path, tags)
+		}
+	}
+
+	return nil
+}
+
+// unexported
+
+// Sets the file's 'user.xdg.tags' extended attribute to the tags, removing it
+// if there are none, and reports whether it differed.
+func syncXdgTags(path string, tags []string, pretend bool) (bool, error) {
+	if _, err := os.Stat(path); err != nil {
+		return false, err
+	}
+
+	current, err := xattr.Get(path, XdgTagsAttribute)
+	if err != nil {
+		return false, err
+	}
+
+	value := strings.Join(tags, ",")
+	if string(current) == value && (current != nil || value == "") {
+		return false, nil
+	}
+
+	if pretend {
+		return true, nil
+	}
+
+	if value == "" {
+		return true, xattr.Remove(path, XdgTagsAttribute)
+	}
+
+	return true, xattr.Set(path, XdgTagsAttribute, []byte(value))
+}
+
+func setGnomeEmblems(gio, path string, tags []string, pretend bool) error {
+	if pretend {
+		return nil
+	}
+
+	var command *exec.Cmd
+	if len(tags) == 0 {
+		command = exec.Command(gio, "set", "-t", "unset", path, GnomeEmblemsAttribute)
+	} else {
+		args := append([]string{"set", "-t", "stringv", path, GnomeEmblemsAttribute}, tags...)
+		command = exec.Command(gio, args...)
+	}
+
+	output, err := command.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("%v: %v", err, strings.TrimSpace(string(output)))
+	}
+
+	return nil
+}
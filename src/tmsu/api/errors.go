@@ -0,0 +1,94 @@
+// Copyright 2011-2015 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package api
+
+import (
+	"fmt"
+	"strings"
+)
+
+type NoSuchTagError struct {
+	Name string
+}
+
+func (err NoSuchTagError) Error() string {
+	return fmt.Sprintf("no such tag '%v'", err.Name)
+}
+
+type NoSuchValueError struct {
+	Name string
+}
+
+func (err NoSuchValueError) Error() string {
+	return fmt.Sprintf("no such value '%v'", err.Name)
+}
+
+type FileNotTaggedError struct {
+	Path string
+}
+
+func (err FileNotTaggedError) Error() string {
+	return fmt.Sprintf("%v: file is not tagged", err.Path)
+}
+
+type TagNotAppliedError struct {
+	Path     string
+	TagValue TagValue
+}
+
+func (err TagNotAppliedError) Error() string {
+	return fmt.Sprintf("%v: file is not tagged '%v'", err.Path, err.TagValue)
+}
+
+type TagImpliedError struct {
+	Path     string
+	TagValue TagValue
+}
+
+func (err TagImpliedError) Error() string {
+	return fmt.Sprintf("%v: cannot remove '%v': delete implication to remove this tag", err.Path, err.TagValue)
+}
+
+type ExclusiveTagsError struct {
+	Tag      string
+	OtherTag string
+}
+
+func (err ExclusiveTagsError) Error() string {
+	return fmt.Sprintf("tags '%v' and '%v' are mutually exclusive", err.Tag, err.OtherTag)
+}
+
+type QueryTooComplexError struct{}
+
+func (err QueryTooComplexError) Error() string {
+	return "the query is too complex (see the troubleshooting wiki for how to increase the stack size)"
+}
+
+type NoSuchTagsError struct {
+	Names []string
+}
+
+func (err NoSuchTagsError) Error() string {
+	return fmt.Sprintf("no such tag '%v'", strings.Join(err.Names, "', '"))
+}
+
+type NoThumbnailError struct {
+	Path string
+}
+
+func (err NoThumbnailError) Error() string {
+	return fmt.Sprintf("%v: no thumbnail available for this type of file", err.Path)
+}
@@ -0,0 +1,98 @@
+// Copyright 2011-2015 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package api
+
+import (
+	"fmt"
+	"time"
+	"tmsu/entities"
+	"tmsu/storage"
+)
+
+// The tag applied in place of an expired tag, with the expired tag's name as
+// its value, when the 'expiredTags' setting is 'archive'.
+const ExpiredTag = "expired"
+
+// Removes the file tags whose expiry has passed, returning their expiries.
+// When the 'expiredTags' setting is 'archive' the files are instead tagged
+// 'expired' with the names of the tags removed as values, so that they remain
+// queryable, e.g. as 'expired = urgent'.
+func ExpireTags(store *storage.Storage, tx *storage.Tx, now time.Time) (entities.FileTagExpiries, error) {
+	expiries, err := store.ExpiredFileTags(tx, now)
+	if err != nil {
+		return nil, fmt.Errorf("could not retrieve expired tags: %v", err)
+	}
+	if len(expiries) == 0 {
+		return expiries, nil
+	}
+
+	settings, err := store.Settings(tx)
+	if err != nil {
+		return nil, err
+	}
+
+	expired := make(entities.FileTagExpiries, 0, len(expiries))
+	for _, expiry := range expiries {
+		if settings.ExpiredTags() == "archive" {
+			// applied before the tag is removed so that the file, if it has no
+			// other tags, is not removed from the database in between
+			if err := archiveFileTag(store, tx, expiry); err != nil {
+				return nil, err
+			}
+		}
+
+		err := store.DeleteFileTag(tx, expiry.FileId, expiry.TagId, expiry.ValueId)
+		if err != nil {
+			if _, ok := err.(storage.FileTagDoesNotExist); !ok {
+				return nil, fmt.Errorf("could not remove expired tag: %v", err)
+			}
+
+			// the tag has since been removed by other means
+			if err := store.DeleteFileTagExpiry(tx, expiry.FileId, expiry.TagId, expiry.ValueId); err != nil {
+				return nil, fmt.Errorf("could not remove expiry: %v", err)
+			}
+
+			continue
+		}
+
+		expired = append(expired, expiry)
+	}
+
+	return expired, nil
+}
+
+// unexported
+
+func archiveFileTag(store *storage.Storage, tx *storage.Tx, expiry *entities.FileTagExpiry) error {
+	tag, err := store.Tag(tx, expiry.TagId)
+	if err != nil {
+		return fmt.Errorf("could not retrieve tag: %v", err)
+	}
+	if tag == nil || tag.Name == ExpiredTag {
+		return nil
+	}
+
+	pairs, err := ResolveTagValues(store, tx, []TagValue{{ExpiredTag, tag.Name}}, true, true)
+	if err != nil {
+		return err
+	}
+
+	if _, err := store.ApplyFileTags(tx, expiry.FileId, pairs); err != nil {
+		return fmt.Errorf("could not archive expired tag '%v': %v", tag.Name, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,217 @@
+// Copyright 2011-2015 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+	"tmsu/common/fingerprint"
+	"tmsu/common/log"
+	"tmsu/entities"
+	"tmsu/storage"
+	"tmsu/version"
+)
+
+// The formats to which tags can be exported for other tagging applications.
+var ExportFormats = []string{"tagspaces"}
+
+type ExportOptions struct {
+	ExplicitOnly bool                             // only include explicitly applied tags
+	Pretend      bool                             // report the changes without making them
+	Report       func(path string, tags []string) // called for each sidecar file written
+}
+
+// Writes the tags of each file to the sidecar file TagSpaces reads in the '.ts'
+// directory alongside it: '.ts/NAME.json' for a file and '.ts/tsm.json' within
+// a directory for the directory itself. The other properties of an existing
+// sidecar, such as the description, are kept and only sidecars whose tags
+// differ are rewritten and reported. Files that no longer exist are skipped
+// with a warning.
+func ExportTagSpaces(store *storage.Storage, tx *storage.Tx, files entities.Files, options ExportOptions) error {
+	for _, file := range files {
+		path := file.Path()
+
+		stat, err := os.Stat(path)
+		if err != nil {
+			switch {
+			case os.IsNotExist(err):
+				log.Warnf("%v: no such file", path)
+			case os.IsPermission(err):
+				log.Warnf("%v: permission denied", path)
+			default:
+				log.Warnf("%v: could not stat: %v", path, err)
+			}
+
+			continue
+		}
+
+		tagValues, err := FileTagValues(store, tx, file.Id, options.ExplicitOnly)
+		if err != nil {
+			return err
+		}
+
+		tags := make([]string, len(tagValues))
+		for index, tagValue := range tagValues {
+			tags[index] = tagValue.String()
+		}
+		sort.Strings(tags)
+
+		sidecarPath := tagSpacesSidecarPath(path, stat.IsDir())
+
+		changed, err := writeTagSpacesSidecar(sidecarPath, tags, options.Pretend)
+		if err != nil {
+			return fmt.Errorf("%v: could not write TagSpaces sidecar: %v", path, err)
+		}
+
+		if changed && options.Report != nil {
+			options.Report(path, tags)
+		}
+	}
+
+	return nil
+}
+
+// Writes a manifest of the files' SHA-256 checksums, in the format of
+// 'sha256sum', from their stored fingerprints: these are SHA-256 hashes of the
+// files' whole content where the fileFingerprintAlgorithm setting is 'SHA256'
+// or, but for large files, 'dynamic:SHA256'. SHA-256 fingerprints recorded
+// under a previous setting are also used. Files without one, as well as
+// directories and files tracked by path only, are skipped with a warning: the
+// result reports whether there were any.
+func ExportChecksums(store *storage.Storage, tx *storage.Tx, files entities.Files, writer io.Writer) (bool, error) {
+	settings, err := store.Settings(tx)
+	if err != nil {
+		return false, err
+	}
+
+	algorithm := settings.FileFingerprintAlgorithm()
+	wereSkipped := false
+
+	for _, file := range files {
+		if file.IsDir {
+			continue
+		}
+
+		checksum := fingerprint.Empty
+		if fingerprint.IsWholeFileHash(algorithm, "SHA256", file.Size) {
+			checksum = file.Fingerprint
+		} else {
+			checksum, err = store.RecordedFileFingerprint(tx, file.Id, "SHA256")
+			if err != nil {
+				return wereSkipped, fmt.Errorf("%v: could not retrieve fingerprint: %v", file.Path(), err)
+			}
+		}
+
+		if checksum == fingerprint.Empty {
+			log.Warnf("%v: skipping as it has no SHA-256 fingerprint", file.Path())
+			wereSkipped = true
+			continue
+		}
+
+		if _, err := fmt.Fprintln(writer, checksumLine(string(checksum), file.Path())); err != nil {
+			return wereSkipped, err
+		}
+	}
+
+	return wereSkipped, nil
+}
+
+// unexported
+
+// A line of a 'sha256sum' manifest: names containing a backslash or newline
+// are escaped, which is marked by a leading backslash.
+func checksumLine(checksum, path string) string {
+	if !strings.ContainsAny(path, "\\\n") {
+		return checksum + "  " + path
+	}
+
+	path = strings.Replace(path, "\\", "\\\\", -1)
+	path = strings.Replace(path, "\n", "\\n", -1)
+
+	return "\\" + checksum + "  " + path
+}
+
+func tagSpacesSidecarPath(path string, isDir bool) string {
+	if isDir {
+		return filepath.Join(path, tagSpacesDir, "tsm.json")
+	}
+
+	return filepath.Join(filepath.Dir(path), tagSpacesDir, filepath.Base(path)+".json")
+}
+
+// Sets the tags of the sidecar, creating it if necessary, and reports whether
+// they differed.
+func writeTagSpacesSidecar(path string, tags []string, pretend bool) (bool, error) {
+	sidecar := make(map[string]interface{})
+
+	content, err := ioutil.ReadFile(path)
+	switch {
+	case err == nil:
+		if err := json.Unmarshal(content, &sidecar); err != nil {
+			return false, fmt.Errorf("could not parse '%v': %v", path, err)
+		}
+
+		current, err := tagSpacesSidecarTags(content)
+		if err != nil {
+			return false, fmt.Errorf("could not parse '%v': %v", path, err)
+		}
+		sort.Strings(current)
+
+		if reflect.DeepEqual(current, tags) {
+			return false, nil
+		}
+	case os.IsNotExist(err):
+		if len(tags) == 0 {
+			return false, nil
+		}
+
+		sidecar["appName"] = "TMSU"
+	default:
+		return false, err
+	}
+
+	if pretend {
+		return true, nil
+	}
+
+	sidecarTags := make([]map[string]string, len(tags))
+	for index, tag := range tags {
+		sidecarTags[index] = map[string]string{"title": tag, "type": "sidecar"}
+	}
+
+	sidecar["tags"] = sidecarTags
+	sidecar["appVersion"] = version.Version.String()
+	sidecar["lastUpdated"] = time.Now().UTC().Format("2006-01-02T15:04:05.000Z")
+
+	content, err = json.MarshalIndent(sidecar, "", "  ")
+	if err != nil {
+		return false, err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return false, err
+	}
+
+	return true, ioutil.WriteFile(path, append(content, '\n'), 0644)
+}
@@ -0,0 +1,157 @@
+// Copyright 2011-2015 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package api
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+	"tmsu/entities"
+	"tmsu/storage"
+)
+
+// A set of files sharing a tag, value, directory or extension. The files that
+// do not have one, such as those without the tag whose values they are
+// grouped by, are in an ungrouped set.
+type FileGroup struct {
+	Name      string
+	Files     entities.Files
+	Ungrouped bool
+}
+
+// Identifies whether the text is a valid grouping: tag, value:KEY, directory
+// or extension.
+func IsFileGrouping(groupBy string) bool {
+	switch groupBy {
+	case "tag", "directory", "extension":
+		return true
+	}
+
+	return strings.HasPrefix(groupBy, "value:") && len(groupBy) > len("value:")
+}
+
+// Groups the files by the tags applied to them, by the values of the KEY tag
+// (value:KEY), by their directory or by their extension. The groups of tags and
+// values are retrieved from the database in a single query. The files retain
+// their order within each group.
+func GroupFiles(store *storage.Storage, tx *storage.Tx, files entities.Files, groupBy string) ([]FileGroup, error) {
+	switch {
+	case groupBy == "tag":
+		fileGroups, err := store.FileGroupsByTag(tx, fileIds(files))
+		if err != nil {
+			return nil, fmt.Errorf("could not group files by tag: %v", err)
+		}
+
+		return resolveFileGroups(files, fileGroups), nil
+	case strings.HasPrefix(groupBy, "value:"):
+		tagName := groupBy[len("value:"):]
+
+		tag, err := store.TagByName(tx, tagName)
+		if err != nil {
+			return nil, fmt.Errorf("could not retrieve tag '%v': %v", tagName, err)
+		}
+		if tag == nil {
+			return nil, NoSuchTagsError{[]string{tagName}}
+		}
+
+		fileGroups, err := store.FileGroupsByValue(tx, fileIds(files), tagName)
+		if err != nil {
+			return nil, fmt.Errorf("could not group files by value of '%v': %v", tagName, err)
+		}
+
+		return resolveFileGroups(files, fileGroups), nil
+	case groupBy == "directory":
+		return groupFilesBy(files, func(file *entities.File) string {
+			return file.Directory
+		}), nil
+	case groupBy == "extension":
+		return groupFilesBy(files, func(file *entities.File) string {
+			if file.IsDir {
+				return ""
+			}
+
+			return strings.ToLower(filepath.Ext(file.Name))
+		}), nil
+	}
+
+	return nil, fmt.Errorf("invalid grouping '%v': must be one of tag, value:KEY, directory, extension", groupBy)
+}
+
+// unexported
+
+func fileIds(files entities.Files) entities.FileIds {
+	fileIds := make(entities.FileIds, len(files))
+	for index, file := range files {
+		fileIds[index] = file.Id
+	}
+
+	return fileIds
+}
+
+func resolveFileGroups(files entities.Files, fileGroups entities.FileGroups) []FileGroup {
+	filesById := make(map[entities.FileId]*entities.File, len(files))
+	for _, file := range files {
+		filesById[file.Id] = file
+	}
+
+	grouped := make(map[entities.FileId]bool, len(files))
+	groups := make([]FileGroup, 0, len(fileGroups)+1)
+	for _, fileGroup := range fileGroups {
+		group := FileGroup{Name: fileGroup.Name, Files: make(entities.Files, 0, len(fileGroup.FileIds))}
+		for _, fileId := range fileGroup.FileIds {
+			group.Files = append(group.Files, filesById[fileId])
+			grouped[fileId] = true
+		}
+
+		groups = append(groups, group)
+	}
+
+	ungrouped := files.Where(func(file *entities.File) bool { return !grouped[file.Id] })
+	if len(ungrouped) > 0 {
+		groups = append(groups, FileGroup{Files: ungrouped, Ungrouped: true})
+	}
+
+	return groups
+}
+
+// Groups the files by the name the function gives each, in name order, with
+// those given an empty name ungrouped.
+func groupFilesBy(files entities.Files, name func(*entities.File) string) []FileGroup {
+	filesByName := make(map[string]entities.Files)
+	for _, file := range files {
+		filesByName[name(file)] = append(filesByName[name(file)], file)
+	}
+
+	names := make([]string, 0, len(filesByName))
+	for name := range filesByName {
+		if name != "" {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	groups := make([]FileGroup, 0, len(names)+1)
+	for _, name := range names {
+		groups = append(groups, FileGroup{Name: name, Files: filesByName[name]})
+	}
+
+	if ungrouped, ok := filesByName[""]; ok {
+		groups = append(groups, FileGroup{Files: ungrouped, Ungrouped: true})
+	}
+
+	return groups
+}
@@ -0,0 +1,469 @@
+// Copyright 2011-2015 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package api
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"tmsu/common/log"
+	_path "tmsu/common/path"
+	"tmsu/common/plist"
+	"tmsu/common/progress"
+	"tmsu/common/xattr"
+	"tmsu/storage"
+)
+
+// The formats of the tags of other tagging applications that can be imported.
+var ImportFormats = []string{"tagspaces", "finder", "tabbles"}
+
+// The extended attribute in which macOS records a file's Finder tags. On Linux
+// it is read from the user namespace, where tools such as 'rsync -X' copy it.
+const FinderTagsAttribute = "com.apple.metadata:_kMDItemUserTags"
+
+// A file and the tags, as TAG or TAG=VALUE, another application has applied to
+// it.
+type ImportedFile struct {
+	Path   string
+	Tags   []string
+	Source string // where the file was listed, e.g. FILE:LINE, if not at the path itself
+}
+
+type ImportOptions struct {
+	Pretend       bool                             // report the tags that would be applied without applying them
+	CreateMissing bool                             // track files that do not exist as virtual files
+	Report        func(path string, tags []string) // called for each file tagged
+}
+
+// Reads the tags applied by another application: for 'tagspaces' and 'finder'
+// from the files within the directory at the path and for 'tabbles' from the
+// XML export at the path.
+func ReadImport(format, path string) ([]ImportedFile, error) {
+	switch format {
+	case "tagspaces":
+		return readTagSpaces(path)
+	case "finder":
+		return readFinderTags(path)
+	case "tabbles":
+		return readTabbles(path)
+	default:
+		return nil, fmt.Errorf("unsupported import format '%v': must be one of %v", format, strings.Join(ImportFormats, ", "))
+	}
+}
+
+// Applies the imported tags to the files, adding them to the database as
+// necessary. Spaces within the tag names are replaced by underscores unless
+// the allowSpacesInNames setting is enabled. Tags that remain invalid, and
+// files that do not exist, are skipped with a warning: the result reports
+// whether there were any.
+func ImportTags(store *storage.Storage, tx *storage.Tx, files []ImportedFile, options ImportOptions) (bool, error) {
+	settings, err := store.Settings(tx)
+	if err != nil {
+		return false, err
+	}
+
+	reporter := progress.New("importing tags", len(files))
+	defer reporter.Done()
+
+	wereErrors := false
+	for _, file := range files {
+		reporter.Increment()
+
+		source := file.Source
+		if source == "" {
+			source = file.Path
+		}
+
+		names := importTagNames(file.Tags, settings.AllowSpacesInNames())
+		if len(names) == 0 {
+			continue
+		}
+
+		if options.Pretend {
+			if options.Report != nil {
+				reporter.Clear()
+				options.Report(file.Path, names)
+			}
+
+			continue
+		}
+
+		pairs := make([]TagValuePair, 0, len(names))
+		applied := make([]string, 0, len(names))
+		for _, name := range names {
+			resolved, err := ResolveTagValues(store, tx, []TagValue{ParseTagValue(name)}, true, true)
+			if err != nil {
+				reporter.Clear()
+				log.Warnf("%v: skipping tag '%v': %v", source, name, err)
+				wereErrors = true
+				continue
+			}
+
+			pairs = append(pairs, resolved...)
+			applied = append(applied, name)
+		}
+		if len(pairs) == 0 {
+			continue
+		}
+
+		if err := TagPath(store, tx, file.Path, pairs, settings, TagOptions{Force: options.CreateMissing, Warning: reporter.Clear}); err != nil {
+			reporter.Clear()
+
+			switch {
+			case os.IsNotExist(err):
+				log.Warnf("%v: no such file '%v'", source, file.Path)
+			case os.IsPermission(err):
+				log.Warnf("%v: permission denied for '%v'", source, file.Path)
+			default:
+				return wereErrors, err
+			}
+
+			wereErrors = true
+			continue
+		}
+
+		if options.Report != nil {
+			reporter.Clear()
+			options.Report(file.Path, applied)
+		}
+	}
+
+	return wereErrors, nil
+}
+
+// unexported
+
+// The TagSpaces metadata directory within each directory.
+const tagSpacesDir = ".ts"
+
+// Reads the tags TagSpaces embeds in file names, as in 'beach[holiday
+// 2015].jpg', and records in the sidecar files of its metadata directories:
+// '.ts/NAME.json' for a file and '.ts/tsm.json' for the directory itself.
+func readTagSpaces(root string) ([]ImportedFile, error) {
+	files := make([]ImportedFile, 0, 100)
+
+	addDir := func(dir string) {
+		tags, err := readTagSpacesSidecar(filepath.Join(dir, tagSpacesDir, "tsm.json"))
+		if err != nil {
+			log.Warnf("%v: %v", dir, err)
+		}
+		if len(tags) > 0 {
+			files = append(files, ImportedFile{Path: dir, Tags: tags})
+		}
+	}
+
+	addDir(root)
+
+	err := _path.Walk(root, func(dir string, entries []_path.Entry, err error) error {
+		if err != nil {
+			log.Warnf("%v: could not read directory entries: %v", dir, err)
+			return nil
+		}
+		if isTagSpacesMetadata(dir) {
+			return nil
+		}
+
+		for _, entry := range entries {
+			if entry.Info == nil || filepath.Base(entry.Path) == tagSpacesDir {
+				continue
+			}
+
+			if entry.Info.IsDir() {
+				addDir(entry.Path)
+				continue
+			}
+
+			tags := fileNameTags(filepath.Base(entry.Path))
+
+			sidecarTags, err := readTagSpacesSidecar(filepath.Join(dir, tagSpacesDir, filepath.Base(entry.Path)+".json"))
+			if err != nil {
+				log.Warnf("%v: %v", entry.Path, err)
+			}
+			tags = append(tags, sidecarTags...)
+
+			if len(tags) > 0 {
+				files = append(files, ImportedFile{Path: entry.Path, Tags: tags})
+			}
+		}
+
+		return nil
+	})
+
+	return files, err
+}
+
+func isTagSpacesMetadata(dir string) bool {
+	for _, element := range strings.Split(filepath.ToSlash(dir), "/") {
+		if element == tagSpacesDir {
+			return true
+		}
+	}
+
+	return false
+}
+
+// The tags within the square brackets at the end of the file's name, before
+// its extension, separated by spaces.
+func fileNameTags(name string) []string {
+	stem := strings.TrimSuffix(name, filepath.Ext(name))
+	if !strings.HasSuffix(stem, "]") {
+		return nil
+	}
+
+	start := strings.LastIndex(stem, "[")
+	if start == -1 {
+		return nil
+	}
+
+	return strings.Fields(stem[start+1 : len(stem)-1])
+}
+
+// The tags recorded in a TagSpaces sidecar file, or none if there is none.
+func readTagSpacesSidecar(path string) ([]string, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+
+		return nil, fmt.Errorf("could not read TagSpaces sidecar '%v': %v", path, err)
+	}
+
+	tags, err := tagSpacesSidecarTags(content)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse TagSpaces sidecar '%v': %v", path, err)
+	}
+
+	return tags, nil
+}
+
+// The titles of the tags in the content of a TagSpaces sidecar file.
+func tagSpacesSidecarTags(content []byte) ([]string, error) {
+	var sidecar struct {
+		Tags []struct {
+			Title string `json:"title"`
+		} `json:"tags"`
+	}
+	if err := json.Unmarshal(content, &sidecar); err != nil {
+		return nil, err
+	}
+
+	tags := make([]string, 0, len(sidecar.Tags))
+	for _, tag := range sidecar.Tags {
+		if strings.TrimSpace(tag.Title) != "" {
+			tags = append(tags, tag.Title)
+		}
+	}
+
+	return tags, nil
+}
+
+// Reads the Finder tags of the files within the directory from their extended
+// attributes. Each tag is recorded with its colour, which is discarded.
+func readFinderTags(root string) ([]ImportedFile, error) {
+	files := make([]ImportedFile, 0, 100)
+
+	add := func(path string) error {
+		tags, err := finderTags(path)
+		if err != nil {
+			if err == xattr.NotSupportedError {
+				return err
+			}
+
+			log.Warnf("%v: could not read Finder tags: %v", path, err)
+			return nil
+		}
+		if len(tags) > 0 {
+			files = append(files, ImportedFile{Path: path, Tags: tags})
+		}
+
+		return nil
+	}
+
+	if err := add(root); err != nil {
+		return nil, err
+	}
+
+	err := _path.Walk(root, func(dir string, entries []_path.Entry, err error) error {
+		if err != nil {
+			log.Warnf("%v: could not read directory entries: %v", dir, err)
+			return nil
+		}
+
+		for _, entry := range entries {
+			if err := add(entry.Path); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+
+	return files, err
+}
+
+func finderTags(path string) ([]string, error) {
+	value, err := xattr.Get(path, "user."+FinderTagsAttribute)
+	if err != nil || value == nil {
+		return nil, err
+	}
+
+	tags, err := plist.ReadStrings(value)
+	if err != nil {
+		return nil, err
+	}
+
+	for index, tag := range tags {
+		// the colour follows the name on a separate line
+		if newline := strings.IndexByte(tag, '\n'); newline != -1 {
+			tags[index] = tag[:newline]
+		}
+	}
+
+	return tags, nil
+}
+
+// Reads the files and tags from a Tabbles XML export. As the layout of the
+// export has varied between versions, any element with a 'path' (or
+// 'filepath') attribute is taken to be a file and any 'tag' or 'tabble'
+// element to be a tag, named by its 'name' (or 'title') attribute or its
+// text: a tag applies to the file it is within or, for an export listing the
+// files of each tag, the files within it.
+func readTabbles(path string) ([]ImportedFile, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("could not open Tabbles export '%v': %v", path, err)
+	}
+	defer file.Close()
+
+	type frame struct {
+		file  int    // the index of the file element, or -1
+		isTag bool   // whether the element is a tag
+		tag   string // the name of the tag
+		named bool   // whether the tag is named by an attribute rather than its text
+	}
+
+	files := make([]ImportedFile, 0, 100)
+	indices := make(map[string]int)
+	stack := make([]frame, 0, 10)
+
+	addTag := func(index int, tag string) {
+		tag = strings.TrimSpace(tag)
+		if tag != "" {
+			files[index].Tags = append(files[index].Tags, tag)
+		}
+	}
+
+	decoder := xml.NewDecoder(file)
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("could not parse Tabbles export '%v': %v", path, err)
+		}
+
+		switch element := token.(type) {
+		case xml.StartElement:
+			current := frame{file: -1}
+			if len(stack) > 0 {
+				current.file = stack[len(stack)-1].file
+			}
+
+			name := strings.ToLower(element.Name.Local)
+			if filePath := xmlAttribute(element, "path", "filepath"); filePath != "" {
+				index, ok := indices[filePath]
+				if !ok {
+					index = len(files)
+					indices[filePath] = index
+					files = append(files, ImportedFile{Path: filePath})
+				}
+
+				// an export that lists the files of each tag
+				for _, enclosing := range stack {
+					if enclosing.isTag {
+						addTag(index, enclosing.tag)
+					}
+				}
+
+				current.file = index
+			} else if name == "tag" || name == "tabble" {
+				current.isTag = true
+				current.tag = xmlAttribute(element, "name", "title")
+				current.named = current.tag != ""
+			}
+
+			stack = append(stack, current)
+		case xml.CharData:
+			if len(stack) > 0 && stack[len(stack)-1].isTag && !stack[len(stack)-1].named {
+				stack[len(stack)-1].tag += string(element)
+			}
+		case xml.EndElement:
+			if len(stack) == 0 {
+				break
+			}
+
+			current := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+
+			if current.isTag && current.file != -1 {
+				addTag(current.file, current.tag)
+			}
+		}
+	}
+
+	return files, nil
+}
+
+func xmlAttribute(element xml.StartElement, names ...string) string {
+	for _, name := range names {
+		for _, attribute := range element.Attr {
+			if strings.EqualFold(attribute.Name.Local, name) {
+				return attribute.Value
+			}
+		}
+	}
+
+	return ""
+}
+
+// Converts the imported tag names into TMSU tag names, without duplicates.
+func importTagNames(tags []string, allowSpaces bool) []string {
+	names := make([]string, 0, len(tags))
+	seen := make(map[string]bool, len(tags))
+
+	for _, tag := range tags {
+		name := strings.TrimSpace(tag)
+		if !allowSpaces {
+			name = strings.Join(strings.Fields(name), "_")
+		}
+
+		if name == "" || seen[name] {
+			continue
+		}
+		seen[name] = true
+
+		names = append(names, name)
+	}
+
+	return names
+}
@@ -0,0 +1,188 @@
+// Copyright 2011-2015 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package api
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"tmsu/common/log"
+)
+
+// The column of a CSV import holding the file's path.
+const PathColumn = "path"
+
+// The column of a CSV import holding the file's tags, separated by spaces.
+const TagsColumn = "tags"
+
+// The name of a CSV import column to ignore.
+const IgnoredColumn = "-"
+
+// Parses a comma-separated list of CSV import columns, which must include the
+// path column once.
+func ParseColumns(text string) ([]string, error) {
+	columns := strings.Split(text, ",")
+	paths := 0
+
+	for index, column := range columns {
+		column = strings.TrimSpace(column)
+		if column == "" {
+			column = IgnoredColumn
+		}
+		if column == PathColumn {
+			paths++
+		}
+
+		columns[index] = column
+	}
+
+	if paths != 1 {
+		return nil, fmt.Errorf("the columns must include '%v' once", PathColumn)
+	}
+
+	return columns, nil
+}
+
+// Reads the files and tags listed in a spreadsheet saved as CSV or, if its
+// name ends '.tsv' or '.tab', with tab-separated fields. The columns name the
+// field of each row: 'path' holds the file's path, relative to the directory
+// of the CSV file unless absolute, 'tags' its tags separated by spaces and
+// '-' is ignored. Any other column is a tag, applied with the field as its
+// value where the field is not empty. If no columns are specified the first
+// row names them, otherwise a first row with 'path' in the path column is
+// taken to be a header and skipped.
+//
+// Rows that cannot be read are skipped with a warning: the result reports
+// whether there were any.
+func ReadCSV(path string, columns []string) ([]ImportedFile, bool, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, false, fmt.Errorf("could not open '%v': %v", path, err)
+	}
+	defer file.Close()
+
+	reader := csv.NewReader(file)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".tsv", ".tab":
+		reader.Comma = '\t'
+		reader.LazyQuotes = true
+	}
+
+	baseDir := filepath.Dir(path)
+	files := make([]ImportedFile, 0, 100)
+	wereErrors := false
+
+	for row := 1; ; row++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+
+		source := fmt.Sprintf("%v:%v", path, row)
+		if err != nil {
+			if _, ok := err.(*csv.ParseError); !ok {
+				return nil, wereErrors, fmt.Errorf("could not read '%v': %v", path, err)
+			}
+
+			log.Warnf("%v: skipping row: %v", source, err)
+			wereErrors = true
+			continue
+		}
+
+		if columns == nil {
+			if columns, err = ParseColumns(strings.Join(record, ",")); err != nil {
+				return nil, wereErrors, fmt.Errorf("%v: invalid header: %v", source, err)
+			}
+
+			continue
+		}
+
+		if row == 1 && isCSVHeader(record, columns) {
+			continue
+		}
+
+		importedFile, err := csvRecordFile(record, columns, baseDir)
+		if err != nil {
+			log.Warnf("%v: skipping row: %v", source, err)
+			wereErrors = true
+			continue
+		}
+
+		importedFile.Source = source
+		files = append(files, importedFile)
+	}
+
+	return files, wereErrors, nil
+}
+
+// unexported
+
+func isCSVHeader(record, columns []string) bool {
+	for index, column := range columns {
+		if column == PathColumn && index < len(record) {
+			return strings.EqualFold(strings.TrimSpace(record[index]), PathColumn)
+		}
+	}
+
+	return false
+}
+
+func csvRecordFile(record, columns []string, baseDir string) (ImportedFile, error) {
+	if len(record) != len(columns) {
+		return ImportedFile{}, fmt.Errorf("expected %v fields but found %v", len(columns), len(record))
+	}
+
+	var importedFile ImportedFile
+	for index, column := range columns {
+		field := strings.TrimSpace(record[index])
+
+		switch column {
+		case IgnoredColumn:
+		case PathColumn:
+			if field == "" {
+				return ImportedFile{}, fmt.Errorf("the path is empty")
+			}
+
+			if !filepath.IsAbs(field) {
+				field = filepath.Join(baseDir, field)
+			}
+
+			importedFile.Path = field
+		case TagsColumn:
+			importedFile.Tags = append(importedFile.Tags, strings.Fields(field)...)
+		default:
+			if field == "" {
+				continue
+			}
+
+			if column == RatingTag {
+				if _, err := ParseRating(field); err != nil {
+					return ImportedFile{}, err
+				}
+			}
+
+			importedFile.Tags = append(importedFile.Tags, column+"="+field)
+		}
+	}
+
+	return importedFile, nil
+}
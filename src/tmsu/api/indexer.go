@@ -0,0 +1,122 @@
+// Copyright 2011-2015 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"tmsu/common/log"
+	"tmsu/common/text"
+	"tmsu/entities"
+	"tmsu/storage"
+)
+
+// Extracts searchable text from files, e.g. from PDFs and other documents.
+type ContentIndexer interface {
+	// Extracts the file's text: an empty string for a file the indexer does
+	// not handle.
+	Index(path string) (string, error)
+}
+
+// The request an indexer command reads, as JSON, from its standard input.
+type IndexRequest struct {
+	Path      string `json:"path"`      // the absolute path of the file
+	Extension string `json:"extension"` // the file's extension, e.g. '.pdf'
+}
+
+// The response an indexer command writes, as JSON, to its standard output.
+type IndexResponse struct {
+	Text  string `json:"text"`            // the extracted text, if any
+	Error string `json:"error,omitempty"` // why the text could not be extracted
+}
+
+// An indexer plugin run as a subprocess for each file, with an IndexRequest
+// written to its standard input and an IndexResponse read from its standard
+// output.
+type CommandIndexer struct {
+	Command string // the command line, with arguments quoted as for a shell
+}
+
+func (indexer CommandIndexer) Index(path string) (string, error) {
+	words := text.Tokenize(indexer.Command)
+	if len(words) == 0 {
+		return "", fmt.Errorf("no indexer command")
+	}
+
+	request, err := json.Marshal(IndexRequest{path, filepath.Ext(path)})
+	if err != nil {
+		return "", err
+	}
+
+	var stdout, stderr bytes.Buffer
+	command := exec.Command(words[0], words[1:]...)
+	command.Stdin = bytes.NewReader(request)
+	command.Stdout = &stdout
+	command.Stderr = &stderr
+
+	if err := command.Run(); err != nil {
+		if stderr.Len() > 0 {
+			return "", fmt.Errorf("indexer '%v' failed: %v: %v", words[0], err, string(bytes.TrimSpace(stderr.Bytes())))
+		}
+
+		return "", fmt.Errorf("indexer '%v' failed: %v", words[0], err)
+	}
+
+	var response IndexResponse
+	if err := json.Unmarshal(stdout.Bytes(), &response); err != nil {
+		return "", fmt.Errorf("indexer '%v' gave an invalid response: %v", words[0], err)
+	}
+	if response.Error != "" {
+		return "", fmt.Errorf("indexer '%v': %v", words[0], response.Error)
+	}
+
+	return response.Text, nil
+}
+
+// The content indexer configured by the 'contentIndexer' setting, or nil if
+// there is none.
+func NewContentIndexer(settings entities.Settings) ContentIndexer {
+	command := settings.ContentIndexer()
+	if command == "" {
+		return nil
+	}
+
+	return CommandIndexer{command}
+}
+
+// Indexes the file's content, replacing any text previously indexed for it.
+// Directories are not indexed.
+func IndexFileContent(store *storage.Storage, tx *storage.Tx, indexer ContentIndexer, file *entities.File) error {
+	if file.IsDir {
+		return nil
+	}
+
+	log.Infof(2, "%v: indexing content", file.Path())
+
+	content, err := indexer.Index(file.Path())
+	if err != nil {
+		return fmt.Errorf("%v: could not index content: %v", file.Path(), err)
+	}
+
+	if err := store.UpdateFileContent(tx, file.Id, content); err != nil {
+		return fmt.Errorf("%v: could not update content index: %v", file.Path(), err)
+	}
+
+	return nil
+}
@@ -0,0 +1,228 @@
+// Copyright 2011-2015 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package api
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"syscall"
+	"tmsu/common/filesystem"
+	"tmsu/common/log"
+	"tmsu/entities"
+)
+
+type LinkKind int
+
+const (
+	SymbolicLink LinkKind = iota
+	HardLink
+	RefLink // a copy-on-write clone
+)
+
+type LinkAction int
+
+const (
+	LinkCreated LinkAction = iota // a link to a file was created
+	LinkRemoved                   // a link to a file no longer matching was removed
+)
+
+// A change made to a directory of links.
+type LinkReport struct {
+	Action LinkAction
+	Path   string // the link
+	Target string // the file linked to, for links created
+}
+
+type LinkOptions struct {
+	Kind   LinkKind         // the kind of link to create
+	Update bool             // maintain an existing directory of links
+	Report func(LinkReport) // called for each link created or removed
+}
+
+// Materialises the files as a directory of links.
+//
+// Each link is named after the file it links to, with the file's identifier
+// added to keep the names unique. Unless options.Update is set the directory
+// must be empty or not yet exist. When updating, links to files that are not
+// in the set are removed and those that are missing are added: entries that
+// are not of the kind of link being created are left alone.
+func LinkFiles(files entities.Files, destPath string, options LinkOptions) error {
+	report := options.Report
+	if report == nil {
+		report = func(LinkReport) {}
+	}
+
+	absDestPath, err := filepath.Abs(destPath)
+	if err != nil {
+		return fmt.Errorf("%v: could not get absolute path: %v", destPath, err)
+	}
+
+	if err := os.MkdirAll(absDestPath, 0777); err != nil {
+		return fmt.Errorf("%v: could not create directory: %v", destPath, err)
+	}
+
+	targets := make(map[string]string, len(files))
+	for _, file := range files {
+		targets[LinkName(file)] = file.Path()
+	}
+
+	dir, err := os.Open(absDestPath)
+	if err != nil {
+		return fmt.Errorf("%v: could not open directory: %v", destPath, err)
+	}
+
+	names, err := dir.Readdirnames(0)
+	dir.Close()
+	if err != nil {
+		return fmt.Errorf("%v: could not read directory entries: %v", destPath, err)
+	}
+
+	if len(names) > 0 && !options.Update {
+		return fmt.Errorf("%v: directory is not empty", destPath)
+	}
+
+	existing := make(map[string]bool, len(names))
+	for _, name := range names {
+		linkPath := filepath.Join(absDestPath, name)
+
+		stat, err := os.Lstat(linkPath)
+		if err != nil {
+			return fmt.Errorf("%v: could not stat: %v", linkPath, err)
+		}
+
+		current, isLink, err := isCurrentLink(linkPath, stat, targets[name], options.Kind)
+		if err != nil {
+			return err
+		}
+		if !isLink {
+			log.Infof(2, "%v: not a link: skipping", linkPath)
+			continue
+		}
+		if current {
+			existing[name] = true
+			continue
+		}
+
+		if err := os.Remove(linkPath); err != nil {
+			return fmt.Errorf("%v: could not remove link: %v", linkPath, err)
+		}
+
+		report(LinkReport{LinkRemoved, linkPath, ""})
+	}
+
+	for _, file := range files {
+		name := LinkName(file)
+		if existing[name] {
+			continue
+		}
+
+		linkPath := filepath.Join(absDestPath, name)
+
+		if err := createLink(file.Path(), linkPath, options.Kind); err != nil {
+			return err
+		}
+
+		existing[name] = true
+		report(LinkReport{LinkCreated, linkPath, file.Path()})
+	}
+
+	return nil
+}
+
+// The name of the link to the file: the file's name with its identifier
+// inserted before the extension, as in the virtual filesystem.
+func LinkName(file *entities.File) string {
+	extension := filepath.Ext(file.Name)
+	linkName := file.Name[0 : len(file.Name)-len(extension)]
+	suffix := "." + strconv.FormatUint(uint64(file.Id), 10) + extension
+
+	if len(linkName)+len(suffix) > 255 {
+		linkName = linkName[0 : 255-len(suffix)]
+	}
+
+	return linkName + suffix
+}
+
+// unexported
+
+// Determines whether the directory entry is a link of the specified kind and,
+// if so, whether it is a link to the target. As hard links and clones cannot
+// be distinguished from other files, any regular file is taken to be one.
+func isCurrentLink(linkPath string, stat os.FileInfo, target string, kind LinkKind) (current, isLink bool, err error) {
+	switch kind {
+	case SymbolicLink:
+		if stat.Mode()&os.ModeSymlink == 0 {
+			return false, false, nil
+		}
+
+		linkTarget, err := os.Readlink(linkPath)
+		if err != nil {
+			return false, true, fmt.Errorf("%v: could not read link: %v", linkPath, err)
+		}
+
+		return target != "" && linkTarget == target, true, nil
+	default:
+		if !stat.Mode().IsRegular() {
+			return false, false, nil
+		}
+		if target == "" {
+			return false, true, nil
+		}
+
+		targetStat, err := os.Stat(target)
+		if err != nil {
+			return false, true, nil
+		}
+
+		if kind == HardLink {
+			return os.SameFile(stat, targetStat), true, nil
+		}
+
+		return stat.Size() == targetStat.Size() && stat.ModTime().Equal(targetStat.ModTime()), true, nil
+	}
+}
+
+func createLink(target, linkPath string, kind LinkKind) error {
+	switch kind {
+	case HardLink:
+		if err := os.Link(target, linkPath); err != nil {
+			if linkErr, ok := err.(*os.LinkError); ok && linkErr.Err == syscall.EXDEV {
+				return fmt.Errorf("%v: cannot hard link to '%v' as it is on a different filesystem: use symbolic links or a destination on the same filesystem", linkPath, target)
+			}
+
+			return fmt.Errorf("%v: could not create hard link: %v", linkPath, err)
+		}
+	case RefLink:
+		if err := filesystem.Reflink(target, linkPath); err != nil {
+			switch err {
+			case syscall.EXDEV:
+				return fmt.Errorf("%v: cannot clone '%v' as it is on a different filesystem: use symbolic links or a destination on the same filesystem", linkPath, target)
+			case syscall.EOPNOTSUPP, syscall.EINVAL:
+				return fmt.Errorf("%v: cannot clone '%v' as the filesystem does not support reflinks", linkPath, target)
+			}
+
+			return fmt.Errorf("%v: could not clone: %v", linkPath, err)
+		}
+	default:
+		if err := os.Symlink(target, linkPath); err != nil {
+			return fmt.Errorf("%v: could not create link: %v", linkPath, err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,196 @@
+// Copyright 2011-2015 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package api
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+	"tmsu/common/fingerprint"
+	"tmsu/common/log"
+	"tmsu/entities"
+	"tmsu/storage"
+)
+
+// The scheduled maintenance jobs, in the order in which they are run.
+var MaintenanceJobNames = []string{"verify", "prune", "vacuum"}
+
+// Whether there is a maintenance job of the specified name.
+func IsMaintenanceJob(name string) bool {
+	for _, jobName := range MaintenanceJobNames {
+		if jobName == name {
+			return true
+		}
+	}
+
+	return false
+}
+
+// The schedule of the named maintenance job: never, daily, weekly or monthly.
+func MaintenanceSchedule(settings entities.Settings, name string) string {
+	switch name {
+	case "verify":
+		return settings.VerifySchedule()
+	case "prune":
+		return settings.PruneSchedule()
+	case "vacuum":
+		return settings.VacuumSchedule()
+	}
+
+	return "never"
+}
+
+// When a job on the specified schedule that last ran as recorded, or never if
+// lastRun is nil, is next due. The job is not scheduled if ok is false. An
+// hour's grace is allowed so that a job run daily by cron at the same time
+// each day does not slip to every other day.
+func NextMaintenance(schedule string, lastRun *entities.MaintenanceJob) (next time.Time, ok bool) {
+	if schedule == "never" || schedule == "" {
+		return time.Time{}, false
+	}
+	if lastRun == nil {
+		return time.Time{}, true
+	}
+
+	switch schedule {
+	case "daily":
+		next = lastRun.LastRun.AddDate(0, 0, 1)
+	case "weekly":
+		next = lastRun.LastRun.AddDate(0, 0, 7)
+	case "monthly":
+		next = lastRun.LastRun.AddDate(0, 1, 0)
+	default:
+		return time.Time{}, false
+	}
+
+	return next.Add(-time.Hour), true
+}
+
+// Verifies the next count files, continuing from where the previous run left
+// off and starting over once every file has been verified, so that the whole
+// database is verified a slice at a time. The fingerprints of unmodified files
+// are recalculated: files whose contents no longer match their fingerprints
+// although their modification times and sizes are unchanged are reported as
+// corrupt. Modified and missing files are reported too but are left for
+// 'repair'. Returns a summary of the files verified.
+func VerifyFiles(store *storage.Storage, tx *storage.Tx, count uint, report func(path, problem string)) (string, error) {
+	settings, err := store.Settings(tx)
+	if err != nil {
+		return "", err
+	}
+
+	position, err := store.Checkpoint(tx, verifyCheckpointName)
+	if err != nil {
+		return "", fmt.Errorf("could not retrieve verify position: %v", err)
+	}
+	lastId, _ := strconv.ParseUint(position, 10, 32)
+
+	files, err := store.Files(tx, "id")
+	if err != nil {
+		return "", fmt.Errorf("could not retrieve files: %v", err)
+	}
+
+	slice := nextFiles(files, entities.FileId(lastId), count)
+
+	unmodified, modified, missing, _, err := determineStatuses(store, tx, slice, false)
+	if err != nil {
+		return "", err
+	}
+
+	for _, file := range modified {
+		report(file.Path(), "modified")
+	}
+	for _, file := range missing {
+		report(file.Path(), "missing")
+	}
+
+	corrupt := 0
+	for _, file := range unmodified {
+		if file.IsDir || file.Fingerprint == fingerprint.Empty {
+			continue
+		}
+
+		fingerprint, err := store.RecalculateFingerprint(tx, file.Path(), settings.FileFingerprintAlgorithm(), settings.DirectoryFingerprintAlgorithm())
+		if err != nil {
+			log.Warnf("%v: could not create fingerprint: %v", file.Path(), err)
+			continue
+		}
+
+		if fingerprint != file.Fingerprint {
+			report(file.Path(), "corrupt")
+			corrupt++
+		}
+	}
+
+	if len(slice) > 0 {
+		position := strconv.FormatUint(uint64(slice[len(slice)-1].Id), 10)
+		if err := store.UpdateCheckpoint(tx, verifyCheckpointName, position); err != nil {
+			return "", fmt.Errorf("could not record verify position: %v", err)
+		}
+	}
+
+	return fmt.Sprintf("verified %v files: %v modified, %v missing, %v corrupt", len(slice), len(modified), len(missing), corrupt), nil
+}
+
+// Removes the files that are missing from the database, other than virtual
+// files and those on volumes that are not mounted. Returns a summary of the
+// files removed.
+func PruneMissingFiles(store *storage.Storage, tx *storage.Tx, report func(path string)) (string, error) {
+	files, err := store.Files(tx, "none")
+	if err != nil {
+		return "", fmt.Errorf("could not retrieve files: %v", err)
+	}
+
+	_, _, missing, _, err := determineStatuses(store, tx, files, false)
+	if err != nil {
+		return "", err
+	}
+
+	if err := repairMissing(store, tx, missing, false, true, func(repair RepairReport) { report(repair.Path) }); err != nil {
+		return "", err
+	}
+
+	if err := deleteUntaggedFiles(store, tx, missing); err != nil {
+		return "", err
+	}
+
+	if err := deleteUnusedValues(store, tx); err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("removed %v missing files", len(missing)), nil
+}
+
+// unexported
+
+const verifyCheckpointName = "maintenance:verify"
+
+// The count files following that with the specified identifier, wrapping
+// around to the first file if necessary. The files must be in identifier
+// order.
+func nextFiles(files entities.Files, lastId entities.FileId, count uint) entities.Files {
+	start := 0
+	for start < len(files) && files[start].Id <= lastId {
+		start++
+	}
+
+	next := make(entities.Files, 0, count)
+	for index := 0; index < len(files) && uint(len(next)) < count; index++ {
+		next = append(next, files[(start+index)%len(files)])
+	}
+
+	return next
+}
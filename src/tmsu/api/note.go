@@ -0,0 +1,109 @@
+// Copyright 2011-2015 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package api
+
+import (
+	"fmt"
+	"os"
+	_path "tmsu/common/path"
+	"tmsu/entities"
+	"tmsu/storage"
+)
+
+// Retrieves the note attached to the file at the specified path.
+func (db *Database) Note(path string) (string, error) {
+	var text string
+
+	err := db.view(func(tx *storage.Tx) error {
+		var err error
+		text, err = FileNote(db.store, tx, path)
+		return err
+	})
+
+	return text, err
+}
+
+// Attaches a note to the file at the specified path.
+func (db *Database) SetNote(path, text string) error {
+	return db.update("note", []string{path, text}, func(tx *storage.Tx) error {
+		return SetFileNote(db.store, tx, path, text)
+	})
+}
+
+// Retrieves the note attached to the file at the specified path, or an empty
+// string if the file is not in the database or has no note.
+func FileNote(store *storage.Storage, tx *storage.Tx, path string) (string, error) {
+	absPath, err := _path.Abs(path)
+	if err != nil {
+		return "", fmt.Errorf("%v: could not get absolute path: %v", path, err)
+	}
+
+	file, err := store.FileByPath(tx, absPath)
+	if err != nil {
+		return "", fmt.Errorf("%v: could not retrieve file: %v", path, err)
+	}
+	if file == nil {
+		return "", nil
+	}
+
+	return store.FileNote(tx, file.Id)
+}
+
+// Attaches a note to the file at the specified path, adding the file to the
+// database if necessary. An empty note removes the file's note, and then the
+// file itself if it is untagged.
+func SetFileNote(store *storage.Storage, tx *storage.Tx, path, text string) error {
+	absPath, err := _path.Abs(path)
+	if err != nil {
+		return fmt.Errorf("%v: could not get absolute path: %v", path, err)
+	}
+
+	file, err := store.FileByPath(tx, absPath)
+	if err != nil {
+		return fmt.Errorf("%v: could not retrieve file: %v", path, err)
+	}
+
+	if file == nil {
+		if text == "" {
+			return nil
+		}
+
+		stat, err := os.Stat(path)
+		if err != nil {
+			return err
+		}
+
+		settings, err := store.Settings(tx)
+		if err != nil {
+			return err
+		}
+
+		file, err = addFile(store, tx, absPath, stat.ModTime(), uint(stat.Size()), stat.IsDir(), storage.MatchesPathOnlyFiles(settings, absPath), false, settings.FileFingerprintAlgorithm(), settings.DirectoryFingerprintAlgorithm())
+		if err != nil {
+			return fmt.Errorf("%v: could not add file: %v", path, err)
+		}
+	}
+
+	if err := store.UpdateFileNote(tx, file.Id, text); err != nil {
+		return fmt.Errorf("%v: could not update note: %v", path, err)
+	}
+
+	if text == "" {
+		return store.DeleteUntaggedFiles(tx, entities.FileIds{file.Id})
+	}
+
+	return nil
+}
@@ -0,0 +1,147 @@
+// Copyright 2011-2015 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package api
+
+import (
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"tmsu/common/log"
+	_path "tmsu/common/path"
+	"tmsu/common/text"
+	"tmsu/entities"
+	"tmsu/storage"
+)
+
+// Opens the files with the command specified or, if none is, the command the
+// 'openers' setting configures for each file's MIME type. Each command is run
+// once with its files as its final arguments and is waited for. Files without
+// a command are opened with the desktop's default application.
+func OpenFiles(files entities.Files, command string, settings entities.Settings) error {
+	commands := make([]string, 0, 1)
+	pathsByCommand := make(map[string][]string)
+
+	for _, file := range files {
+		fileCommand := command
+		if fileCommand == "" {
+			mimeType := MimeType(file.Path(), file.IsDir)
+			fileCommand = storage.OpenerFor(settings, mimeType)
+
+			log.Infof(2, "%v: MIME type is '%v'", file.Path(), mimeType)
+		}
+
+		if fileCommand == "" {
+			if err := openWithDesktop(file.Path()); err != nil {
+				return err
+			}
+
+			continue
+		}
+
+		if _, ok := pathsByCommand[fileCommand]; !ok {
+			commands = append(commands, fileCommand)
+		}
+		pathsByCommand[fileCommand] = append(pathsByCommand[fileCommand], file.Path())
+	}
+
+	for _, command := range commands {
+		if err := runOpener(command, pathsByCommand[command]); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// The MIME type of the file, determined by its extension or else its content.
+// URLs are given freedesktop.org's 'x-scheme-handler' type for their scheme.
+func MimeType(path string, isDir bool) string {
+	switch {
+	case _path.IsURL(path):
+		return "x-scheme-handler/" + _path.Scheme(path)
+	case isDir:
+		return "inode/directory"
+	}
+
+	mimeType := mime.TypeByExtension(filepath.Ext(path))
+	if mimeType == "" {
+		mimeType = sniffMimeType(path)
+	}
+
+	if mediaType, _, err := mime.ParseMediaType(mimeType); err == nil {
+		return mediaType
+	}
+
+	return mimeType
+}
+
+// unexported
+
+func sniffMimeType(path string) string {
+	file, err := os.Open(path)
+	if err != nil {
+		return "application/octet-stream"
+	}
+	defer file.Close()
+
+	// no more is considered by the detection
+	buffer := make([]byte, 512)
+	count, err := io.ReadFull(file, buffer)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return "application/octet-stream"
+	}
+
+	return http.DetectContentType(buffer[:count])
+}
+
+func openWithDesktop(path string) error {
+	if _path.IsURL(path) {
+		handler, err := ResourceHandlerFor(path)
+		if err != nil {
+			return err
+		}
+
+		return handler.Open(path)
+	}
+
+	log.Infof(2, "%v: opening with the desktop's default application", path)
+
+	command := desktopOpenCommand(path)
+	command.Stderr = os.Stderr
+
+	return command.Run()
+}
+
+func runOpener(commandLine string, paths []string) error {
+	words := text.Tokenize(commandLine)
+	if len(words) == 0 {
+		return fmt.Errorf("no command to open the files with")
+	}
+
+	log.Infof(2, "running '%v' with %v files", strings.Join(words, " "), len(paths))
+
+	command := exec.Command(words[0], append(words[1:], paths...)...)
+	command.Stdin = os.Stdin
+	command.Stdout = os.Stdout
+	command.Stderr = os.Stderr
+
+	return command.Run()
+}
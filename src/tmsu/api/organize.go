@@ -0,0 +1,224 @@
+// Copyright 2011-2015 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package api
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"syscall"
+	"tmsu/common/log"
+	"tmsu/entities"
+	"tmsu/storage"
+)
+
+type OrganizeOptions struct {
+	Link    bool                       // link the files rather than moving them
+	Kind    LinkKind                   // the kind of link to create
+	Pretend bool                       // report the changes without making them
+	Report  func(path, newPath string) // called for each file moved or linked
+}
+
+// Checks that the template's placeholders are well formed.
+func ValidateTemplate(template string) error {
+	placeholders := 0
+
+	for remaining := template; ; {
+		start := strings.IndexAny(remaining, "{}")
+		if start == -1 {
+			break
+		}
+		if remaining[start] == '}' {
+			return fmt.Errorf("template '%v' has an unmatched '}'", template)
+		}
+
+		end := strings.IndexAny(remaining[start+1:], "{}")
+		if end == -1 || remaining[start+1+end] == '{' {
+			return fmt.Errorf("template '%v' has an unmatched '{'", template)
+		}
+
+		if end == 0 {
+			return fmt.Errorf("template '%v' has an empty placeholder", template)
+		}
+
+		placeholders++
+		remaining = remaining[start+1+end+1:]
+	}
+
+	if placeholders == 0 {
+		return fmt.Errorf("template '%v' has no placeholders", template)
+	}
+
+	return nil
+}
+
+// Moves or links each of the files to a path under destPath derived from the
+// template, in which each {TAG} is replaced by the file's value for that tag
+// and {name} by the file's name without its extension. The file's extension
+// is appended if the expanded template does not already end with it.
+//
+// Files lacking a value for any of the tags in the template, or whose new
+// path is already taken, are skipped with a warning. It is an error for the
+// template to place a file outside of destPath. The stored paths of
+// moved files, and of any files under moved directories, are updated.
+func Organize(store *storage.Storage, tx *storage.Tx, files entities.Files, template, destPath string, options OrganizeOptions) error {
+	if err := ValidateTemplate(template); err != nil {
+		return err
+	}
+
+	report := options.Report
+	if report == nil {
+		report = func(string, string) {}
+	}
+
+	absDestPath, err := filepath.Abs(destPath)
+	if err != nil {
+		return fmt.Errorf("%v: could not get absolute path: %v", destPath, err)
+	}
+
+	for _, file := range files {
+		tagValues, err := FileTagValues(store, tx, file.Id, false)
+		if err != nil {
+			return err
+		}
+
+		relPath, missing := expandTemplate(template, file, tagValues)
+		if len(missing) > 0 {
+			log.Warnf("%v: skipping as it has no value for tag '%v'", file.Path(), strings.Join(missing, "', '"))
+			continue
+		}
+
+		newPath := filepath.Join(absDestPath, relPath)
+		if !isWithin(newPath, absDestPath) {
+			return fmt.Errorf("template '%v' places '%v' outside of '%v'", template, file.Path(), destPath)
+		}
+		if newPath == file.Path() {
+			continue
+		}
+
+		if _, err := os.Lstat(file.Path()); err != nil {
+			log.Warnf("%v: skipping as it could not be read: %v", file.Path(), err)
+			continue
+		}
+		if _, err := os.Lstat(newPath); err == nil {
+			log.Warnf("%v: skipping as '%v' already exists", file.Path(), newPath)
+			continue
+		}
+
+		if !options.Pretend {
+			if err := os.MkdirAll(filepath.Dir(newPath), 0777); err != nil {
+				return fmt.Errorf("%v: could not create directory: %v", filepath.Dir(newPath), err)
+			}
+
+			if options.Link {
+				if err := createLink(file.Path(), newPath, options.Kind); err != nil {
+					return err
+				}
+			} else {
+				if err := moveFile(store, tx, file.Path(), newPath); err != nil {
+					return err
+				}
+			}
+		}
+
+		report(file.Path(), newPath)
+	}
+
+	return nil
+}
+
+// unexported
+
+// Expands the template for the file, returning the names of any tags for
+// which the file has no value.
+func expandTemplate(template string, file *entities.File, tagValues []TagValue) (string, []string) {
+	values := make(map[string][]string, len(tagValues))
+	for _, tagValue := range tagValues {
+		if tagValue.Value != "" {
+			values[tagValue.Tag] = append(values[tagValue.Tag], tagValue.Value)
+		}
+	}
+
+	extension := ""
+	if !file.IsDir {
+		extension = filepath.Ext(file.Name)
+	}
+
+	var missing []string
+	var expanded string
+
+	for remaining := template; ; {
+		start := strings.IndexRune(remaining, '{')
+		if start == -1 {
+			expanded += remaining
+			break
+		}
+
+		end := start + strings.IndexRune(remaining[start:], '}')
+		name := remaining[start+1 : end]
+
+		var value string
+		if name == "name" {
+			value = file.Name[0 : len(file.Name)-len(extension)]
+		} else if tagValues := values[name]; len(tagValues) > 0 {
+			// where the tag has several values use the first
+			sort.Strings(tagValues)
+			value = tagValues[0]
+		} else {
+			missing = append(missing, name)
+		}
+
+		expanded += remaining[:start] + sanitisePathComponent(value)
+		remaining = remaining[end+1:]
+	}
+
+	if !strings.HasSuffix(expanded, extension) {
+		expanded += extension
+	}
+
+	return expanded, missing
+}
+
+// Replaces the characters that cannot appear in a file name.
+func sanitisePathComponent(value string) string {
+	value = strings.Replace(value, "/", "_", -1)
+	value = strings.Replace(value, string(filepath.Separator), "_", -1)
+
+	switch value {
+	case ".", "..":
+		return strings.Replace(value, ".", "_", -1)
+	}
+
+	return value
+}
+
+func moveFile(store *storage.Storage, tx *storage.Tx, path, newPath string) error {
+	if err := os.Rename(path, newPath); err != nil {
+		if linkErr, ok := err.(*os.LinkError); ok && linkErr.Err == syscall.EXDEV {
+			return fmt.Errorf("%v: cannot move to '%v' as it is on a different filesystem: link the files instead", path, newPath)
+		}
+
+		return fmt.Errorf("%v: could not move to '%v': %v", path, newPath, err)
+	}
+
+	if _, err := store.RewriteFilePaths(tx, path, newPath); err != nil {
+		return fmt.Errorf("%v: could not update path in database: %v", path, err)
+	}
+
+	return nil
+}
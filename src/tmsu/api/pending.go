@@ -0,0 +1,160 @@
+// Copyright 2011-2015 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package api
+
+import (
+	"fmt"
+	"os"
+	"tmsu/common/log"
+	"tmsu/entities"
+	"tmsu/storage"
+)
+
+// The tags queued for a file that have been applied.
+type FlushReport struct {
+	Path string
+	Tags []TagValue
+}
+
+// Applies the tags queued for each file that is now available, such as one on
+// a volume that has since been mounted, and removes them from the queue. The
+// files are fingerprinted as they are tagged. Returns the number of files that
+// are still awaited.
+func FlushPendingTags(store *storage.Storage, tx *storage.Tx, report func(FlushReport)) (uint, error) {
+	pendingTags, err := store.PendingTags(tx)
+	if err != nil {
+		return 0, fmt.Errorf("could not retrieve queued tags: %v", err)
+	}
+	if len(pendingTags) == 0 {
+		return 0, nil
+	}
+
+	settings, err := store.Settings(tx)
+	if err != nil {
+		return 0, err
+	}
+
+	awaited := uint(0)
+	for _, group := range groupPendingTags(pendingTags) {
+		path := group[0].Path
+
+		if _, err := os.Stat(path); err != nil {
+			log.Infof(2, "%v: not yet available", path)
+			awaited++
+			continue
+		}
+
+		tagValues := make([]TagValue, len(group))
+		for index, pendingTag := range group {
+			tagValues[index] = TagValue{pendingTag.Tag, pendingTag.Value}
+		}
+
+		pairs, err := ResolveTagValues(store, tx, tagValues, settings.AutoCreateTags(), settings.AutoCreateValues())
+		if err != nil {
+			log.Warnf("%v: could not apply queued tags: %v", path, err)
+			awaited++
+			continue
+		}
+
+		if err := TagPath(store, tx, path, pairs, settings, TagOptions{}); err != nil {
+			return 0, err
+		}
+
+		if err := store.DeletePendingTags(tx, path); err != nil {
+			return 0, fmt.Errorf("%v: could not remove queued tags: %v", path, err)
+		}
+
+		if report != nil {
+			report(FlushReport{path, tagValues})
+		}
+	}
+
+	return awaited, nil
+}
+
+// Determines whether any of the files for which tags are queued are now
+// available.
+func PendingTagsAvailable(store *storage.Storage, tx *storage.Tx) (bool, error) {
+	count, err := store.PendingTagCount(tx)
+	if err != nil || count == 0 {
+		return false, err
+	}
+
+	pendingTags, err := store.PendingTags(tx)
+	if err != nil {
+		return false, err
+	}
+
+	for _, group := range groupPendingTags(pendingTags) {
+		if _, err := os.Stat(group[0].Path); err == nil {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// unexported
+
+// Queues the tags for the file at the specified path, which could not be
+// accessed, so that they are applied once it can be.
+func queueTags(store *storage.Storage, tx *storage.Tx, path string, pairs []TagValuePair) error {
+	for _, pair := range pairs {
+		tag, err := store.Tag(tx, pair.TagId)
+		if err != nil {
+			return fmt.Errorf("could not retrieve tag: %v", err)
+		}
+		if tag == nil {
+			return fmt.Errorf("tag '%v' does not exist", pair.TagId)
+		}
+
+		valueName := ""
+		if pair.ValueId != 0 {
+			value, err := store.Value(tx, pair.ValueId)
+			if err != nil {
+				return fmt.Errorf("could not retrieve value: %v", err)
+			}
+			if value == nil {
+				return fmt.Errorf("value '%v' does not exist", pair.ValueId)
+			}
+
+			valueName = value.Name
+		}
+
+		if err := store.AddPendingTag(tx, path, tag.Name, valueName); err != nil {
+			return fmt.Errorf("%v: could not queue tags: %v", path, err)
+		}
+	}
+
+	log.Warnf("%v: not available: tags queued until it is", path)
+
+	return nil
+}
+
+// Groups the queued tags, which must be ordered by path, by file.
+func groupPendingTags(pendingTags entities.PendingTags) []entities.PendingTags {
+	groups := make([]entities.PendingTags, 0, len(pendingTags))
+	for _, pendingTag := range pendingTags {
+		last := len(groups) - 1
+		if last >= 0 && groups[last][0].Path == pendingTag.Path {
+			groups[last] = append(groups[last], pendingTag)
+		} else {
+			groups = append(groups, entities.PendingTags{pendingTag})
+		}
+	}
+
+	return groups
+}
@@ -0,0 +1,219 @@
+// Copyright 2011-2015 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package api
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+	"tmsu/common/log"
+	"tmsu/entities"
+	"tmsu/query"
+	"tmsu/storage"
+)
+
+type QueryOptions struct {
+	Path         string    // only match files under this path
+	ExplicitOnly bool      // only match explicitly applied tags
+	Sort         string    // id, none, name, size or time
+	PathList     []string  // list of paths to combine with the results
+	Operation    string    // intersect, union or difference with the path list
+	TaggedBy     string    // only match files with tags applied by this user
+	TaggedAfter  time.Time // only match files with tags applied after this time
+	Like         string    // only match files sharing tags with this file, most shared first
+	Any          bool      // match files matching any rather than all of the query's terms
+	Type         string    // only match regular files ('file') or directories ('directory')
+	Limit        uint      // match at most this many files, or all if zero
+}
+
+// Retrieves the files matching the query.
+func (db *Database) Query(queryText string, options QueryOptions) (entities.Files, error) {
+	var files entities.Files
+
+	err := db.view(func(tx *storage.Tx) error {
+		var err error
+		files, err = QueryFiles(db.store, tx, queryText, options)
+		return err
+	})
+
+	return files, err
+}
+
+// Retrieves the files matching the query.
+func QueryFiles(store *storage.Storage, tx *storage.Tx, queryText string, options QueryOptions) (entities.Files, error) {
+	log.Info(2, "parsing query")
+
+	expression, err := query.Parse(queryText)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse query: %v", err)
+	}
+	if options.Any {
+		expression = query.AnyOf(expression)
+	}
+
+	log.Info(2, "checking tag names")
+
+	tagNames := query.TagNames(expression)
+	tags, err := store.TagsByNames(tx, tagNames)
+	if err != nil {
+		return nil, fmt.Errorf("could not retrieve tags: %v", err)
+	}
+
+	missing := make([]string, 0)
+	for _, tagName := range tagNames {
+		if !tags.ContainsName(tagName) {
+			missing = append(missing, tagName)
+		}
+	}
+	if len(missing) > 0 {
+		return nil, NoSuchTagsError{missing}
+	}
+
+	switch options.Type {
+	case "":
+	case "file", "directory":
+		expression = query.OfType(expression, options.Type == "directory")
+	default:
+		return nil, fmt.Errorf("unsupported file type '%v'", options.Type)
+	}
+
+	// the limit can only be applied by the database if no files are filtered out afterwards
+	postFiltered := options.TaggedBy != "" || !options.TaggedAfter.IsZero() || options.Like != ""
+	limit := options.Limit
+	if postFiltered {
+		limit = 0
+	}
+
+	log.Info(2, "querying database")
+
+	var files entities.Files
+	if options.Operation == "" {
+		files, err = store.QueryFiles(tx, expression, options.Path, options.ExplicitOnly, options.Sort, limit)
+	} else {
+		files, err = store.QueryFilesWithPaths(tx, expression, options.Path, options.ExplicitOnly, options.PathList, options.Operation, options.Sort, limit)
+	}
+	if err != nil {
+		if strings.Index(err.Error(), "parser stack overflow") > -1 {
+			return nil, QueryTooComplexError{}
+		}
+
+		return nil, fmt.Errorf("could not query files: %v", err)
+	}
+
+	if options.TaggedBy != "" || !options.TaggedAfter.IsZero() {
+		files, err = filesByAttribution(store, tx, files, options.TaggedBy, options.TaggedAfter)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if options.Like != "" {
+		files, err = filesLike(store, tx, files, options.Like, options.ExplicitOnly)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if postFiltered && options.Limit > 0 && uint(len(files)) > options.Limit {
+		files = files[:options.Limit]
+	}
+
+	return files, nil
+}
+
+// unexported
+
+// Filters the files to those with a tag applied by the user and after the
+// time specified.
+func filesByAttribution(store *storage.Storage, tx *storage.Tx, files entities.Files, username string, after time.Time) (entities.Files, error) {
+	fileTags, err := store.FileTagsByAttribution(tx, username, after)
+	if err != nil {
+		return nil, fmt.Errorf("could not retrieve file-tags: %v", err)
+	}
+
+	fileIds := make(map[entities.FileId]bool, len(fileTags))
+	for _, fileTag := range fileTags {
+		fileIds[fileTag.FileId] = true
+	}
+
+	return files.Where(func(file *entities.File) bool { return fileIds[file.Id] }), nil
+}
+
+// Filters the files to those sharing tags with the file at the path specified,
+// ranking them by the number of tags shared. The file itself is excluded.
+func filesLike(store *storage.Storage, tx *storage.Tx, files entities.Files, path string, explicitOnly bool) (entities.Files, error) {
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return nil, fmt.Errorf("%v: could not get absolute path: %v", path, err)
+	}
+
+	file, err := store.FileByPath(tx, absPath)
+	if err != nil {
+		return nil, fmt.Errorf("%v: could not retrieve file: %v", path, err)
+	}
+	if file == nil {
+		return nil, fmt.Errorf("%v: file is not tagged", path)
+	}
+
+	fileTags, err := store.FileTagsByFileId(tx, file.Id, explicitOnly)
+	if err != nil {
+		return nil, fmt.Errorf("%v: could not retrieve file-tags: %v", path, err)
+	}
+
+	log.Info(2, "counting shared tags")
+
+	shared := make(map[entities.FileId]uint, len(files))
+	for _, tagId := range fileTags.TagIds().Uniq() {
+		tagFileTags, err := store.FileTagsByTagId(tx, tagId, explicitOnly)
+		if err != nil {
+			return nil, fmt.Errorf("could not retrieve file-tags for tag '%v': %v", tagId, err)
+		}
+
+		counted := make(map[entities.FileId]bool, len(tagFileTags))
+		for _, fileTag := range tagFileTags {
+			if fileTag.FileId == file.Id || counted[fileTag.FileId] {
+				continue
+			}
+
+			counted[fileTag.FileId] = true
+			shared[fileTag.FileId]++
+		}
+	}
+
+	ranked := sharedTagFiles{files.Where(func(candidate *entities.File) bool { return shared[candidate.Id] > 0 }), shared}
+	sort.Stable(ranked)
+
+	return ranked.files, nil
+}
+
+type sharedTagFiles struct {
+	files  entities.Files
+	shared map[entities.FileId]uint
+}
+
+func (ranked sharedTagFiles) Len() int {
+	return len(ranked.files)
+}
+
+func (ranked sharedTagFiles) Less(i, j int) bool {
+	return ranked.shared[ranked.files[i].Id] > ranked.shared[ranked.files[j].Id]
+}
+
+func (ranked sharedTagFiles) Swap(i, j int) {
+	ranked.files[i], ranked.files[j] = ranked.files[j], ranked.files[i]
+}
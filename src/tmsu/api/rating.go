@@ -0,0 +1,184 @@
+// Copyright 2011-2015 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package api
+
+import (
+	"fmt"
+	"strconv"
+	_path "tmsu/common/path"
+	"tmsu/entities"
+	"tmsu/storage"
+)
+
+// The tag holding a file's rating, queried as e.g. 'rating >= 4'.
+const RatingTag = "rating"
+
+// The highest rating: ratings range from zero to this.
+const MaxRating = 5
+
+// The tag marking a file as flagged, e.g. as a favourite.
+const FlagTag = "flagged"
+
+// Parses a rating, checking it is within range.
+func ParseRating(text string) (int, error) {
+	rating, err := strconv.Atoi(text)
+	if err != nil || rating < 0 || rating > MaxRating {
+		return 0, fmt.Errorf("invalid rating '%v': must be a whole number from 0 to %v", text, MaxRating)
+	}
+
+	return rating, nil
+}
+
+// Retrieves the rating of the file at the specified path and whether it is
+// rated at all.
+func FileRating(store *storage.Storage, tx *storage.Tx, path string) (int, bool, error) {
+	file, err := fileByPath(store, tx, path)
+	if err != nil || file == nil {
+		return 0, false, err
+	}
+
+	tag, err := store.TagByName(tx, RatingTag)
+	if err != nil || tag == nil {
+		return 0, false, err
+	}
+
+	fileTags, err := store.FileTagsByFileId(tx, file.Id, true)
+	if err != nil {
+		return 0, false, fmt.Errorf("%v: could not retrieve file tags: %v", path, err)
+	}
+
+	for _, fileTag := range fileTags {
+		if fileTag.TagId != tag.Id {
+			continue
+		}
+
+		value, err := store.Value(tx, fileTag.ValueId)
+		if err != nil {
+			return 0, false, fmt.Errorf("%v: could not retrieve value: %v", path, err)
+		}
+		if value == nil {
+			continue
+		}
+
+		if rating, err := ParseRating(value.Name); err == nil {
+			return rating, true, nil
+		}
+	}
+
+	return 0, false, nil
+}
+
+// Rates the file at the specified path, replacing any rating it already has
+// and adding the file to the database if necessary.
+func RateFile(store *storage.Storage, tx *storage.Tx, path string, rating int, settings entities.Settings) error {
+	if rating < 0 || rating > MaxRating {
+		return fmt.Errorf("invalid rating '%v': must be a whole number from 0 to %v", rating, MaxRating)
+	}
+
+	pairs, err := ResolveTagValues(store, tx, []TagValue{{RatingTag, strconv.Itoa(rating)}}, true, true)
+	if err != nil {
+		return err
+	}
+
+	// applied before the old rating is removed so that the file, if it has no
+	// other tags, is not removed from the database in between
+	if err := TagPath(store, tx, path, pairs, settings, TagOptions{}); err != nil {
+		return err
+	}
+
+	return removeFileTags(store, tx, path, RatingTag, &pairs[0].ValueId)
+}
+
+// Removes the rating from the file at the specified path.
+func UnrateFile(store *storage.Storage, tx *storage.Tx, path string) error {
+	return removeFileTags(store, tx, path, RatingTag, nil)
+}
+
+// Determines whether the file at the specified path is flagged.
+func FileFlagged(store *storage.Storage, tx *storage.Tx, path string) (bool, error) {
+	file, err := fileByPath(store, tx, path)
+	if err != nil || file == nil {
+		return false, err
+	}
+
+	tag, err := store.TagByName(tx, FlagTag)
+	if err != nil || tag == nil {
+		return false, err
+	}
+
+	return store.FileTagExists(tx, file.Id, tag.Id, 0, true)
+}
+
+// Flags or unflags the file at the specified path.
+func FlagFile(store *storage.Storage, tx *storage.Tx, path string, flagged bool, settings entities.Settings) error {
+	if !flagged {
+		return removeFileTags(store, tx, path, FlagTag, nil)
+	}
+
+	pairs, err := ResolveTagValues(store, tx, []TagValue{{FlagTag, ""}}, true, true)
+	if err != nil {
+		return err
+	}
+
+	return TagPath(store, tx, path, pairs, settings, TagOptions{})
+}
+
+// unexported
+
+func fileByPath(store *storage.Storage, tx *storage.Tx, path string) (*entities.File, error) {
+	absPath, err := _path.Abs(path)
+	if err != nil {
+		return nil, fmt.Errorf("%v: could not get absolute path: %v", path, err)
+	}
+
+	file, err := store.FileByPath(tx, absPath)
+	if err != nil {
+		return nil, fmt.Errorf("%v: could not retrieve file: %v", path, err)
+	}
+
+	return file, nil
+}
+
+// Removes the explicit applications of the named tag from the file, other than
+// that with the value to keep, if specified.
+func removeFileTags(store *storage.Storage, tx *storage.Tx, path, tagName string, keepValueId *entities.ValueId) error {
+	file, err := fileByPath(store, tx, path)
+	if err != nil || file == nil {
+		return err
+	}
+
+	tag, err := store.TagByName(tx, tagName)
+	if err != nil || tag == nil {
+		return err
+	}
+
+	fileTags, err := store.FileTagsByFileId(tx, file.Id, true)
+	if err != nil {
+		return fmt.Errorf("%v: could not retrieve file tags: %v", path, err)
+	}
+
+	for _, fileTag := range fileTags {
+		if fileTag.TagId != tag.Id || (keepValueId != nil && fileTag.ValueId == *keepValueId) {
+			continue
+		}
+
+		if err := store.DeleteFileTag(tx, file.Id, tag.Id, fileTag.ValueId); err != nil {
+			return fmt.Errorf("%v: could not remove tag '%v': %v", path, tagName, err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,128 @@
+// Copyright 2011-2015 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package api
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"time"
+	_path "tmsu/common/path"
+	"tmsu/entities"
+	"tmsu/storage"
+)
+
+// A file with the time of its most recent tagging or modification.
+type RecentFile struct {
+	File *entities.File
+	Time time.Time
+}
+
+// Retrieves the files tagged since the time specified, most recently tagged
+// first, or, if modified is set, those whose content has been modified since
+// then, most recently modified first.
+func RecentFiles(store *storage.Storage, tx *storage.Tx, since time.Time, modified bool) ([]RecentFile, error) {
+	var recent []RecentFile
+	var err error
+
+	if modified {
+		recent, err = recentlyModifiedFiles(store, tx, since)
+	} else {
+		recent, err = recentlyTaggedFiles(store, tx, since)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Sort(recentFiles(recent))
+
+	return recent, nil
+}
+
+// unexported
+
+// Sorts the most recent first and otherwise by path.
+type recentFiles []RecentFile
+
+func (files recentFiles) Len() int {
+	return len(files)
+}
+
+func (files recentFiles) Less(i, j int) bool {
+	if files[i].Time.Equal(files[j].Time) {
+		return files[i].File.Path() < files[j].File.Path()
+	}
+
+	return files[i].Time.After(files[j].Time)
+}
+
+func (files recentFiles) Swap(i, j int) {
+	files[i], files[j] = files[j], files[i]
+}
+
+func recentlyTaggedFiles(store *storage.Storage, tx *storage.Tx, since time.Time) ([]RecentFile, error) {
+	fileTags, err := store.FileTagsByAttribution(tx, "", since)
+	if err != nil {
+		return nil, fmt.Errorf("could not retrieve file-tags: %v", err)
+	}
+
+	tagged := make(map[entities.FileId]time.Time, len(fileTags))
+	for _, fileTag := range fileTags {
+		if fileTag.Time.After(tagged[fileTag.FileId]) {
+			tagged[fileTag.FileId] = fileTag.Time
+		}
+	}
+
+	recent := make([]RecentFile, 0, len(tagged))
+	for fileId, taggedTime := range tagged {
+		file, err := store.File(tx, fileId)
+		if err != nil {
+			return nil, fmt.Errorf("could not retrieve file #%v: %v", fileId, err)
+		}
+		if file == nil {
+			continue
+		}
+
+		recent = append(recent, RecentFile{file, taggedTime})
+	}
+
+	return recent, nil
+}
+
+// The modification times are those of the files on disk, where they can be
+// examined, so that files changed since they were tagged are included.
+func recentlyModifiedFiles(store *storage.Storage, tx *storage.Tx, since time.Time) ([]RecentFile, error) {
+	files, err := store.Files(tx, "none")
+	if err != nil {
+		return nil, fmt.Errorf("could not retrieve files: %v", err)
+	}
+
+	recent := make([]RecentFile, 0, 10)
+	for _, file := range files {
+		modTime := file.ModTime
+		if !_path.IsURL(file.Path()) {
+			if stat, err := os.Stat(file.Path()); err == nil {
+				modTime = stat.ModTime()
+			}
+		}
+
+		if modTime.After(since) {
+			recent = append(recent, RecentFile{file, modTime})
+		}
+	}
+
+	return recent, nil
+}
@@ -0,0 +1,220 @@
+// Copyright 2011-2015 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package api
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"tmsu/common/xattr"
+	"tmsu/entities"
+	"tmsu/storage"
+)
+
+// The policies by which the tags in the 'user.xdg.tags' extended attribute and
+// in the database are reconciled.
+const (
+	PreferXattr = "xattr" // the attribute's tags replace the file's explicit tags
+	PreferDb    = "db"    // the database's tags replace the attribute's
+	PreferUnion = "union" // the file is tagged with the tags of both
+)
+
+type ReconcileOptions struct {
+	Prefer  string                       // the policy: PreferXattr, PreferDb or PreferUnion
+	Pretend bool                         // report the changes without making them
+	Report  func(report ReconcileReport) // called for each file changed
+}
+
+// The changes made to reconcile a file's tags.
+type ReconcileReport struct {
+	Path             string
+	Tagged           []TagValue // applied to the file in the database
+	Untagged         []TagValue // removed from the file in the database
+	AttributeUpdated bool       // whether the extended attribute was rewritten
+}
+
+// Whether the text names a reconciliation policy.
+func IsReconcilePolicy(text string) bool {
+	switch text {
+	case PreferXattr, PreferDb, PreferUnion:
+		return true
+	}
+
+	return false
+}
+
+// Reconciles the tags of the file at the specified path in the database with
+// those in its 'user.xdg.tags' extended attribute, as written by
+// 'emblem-sync', under the policy specified. The attribute is then rewritten
+// to match the database. Files without the attribute are skipped when the
+// attribute's tags are preferred, as it cannot be told whether their tags were
+// ever mirrored.
+func ReconcileFile(store *storage.Storage, tx *storage.Tx, path string, settings entities.Settings, options ReconcileOptions) error {
+	if _, err := os.Stat(path); err != nil {
+		return err
+	}
+
+	current, err := xattr.Get(path, XdgTagsAttribute)
+	if err != nil {
+		return err
+	}
+	if current == nil && options.Prefer == PreferXattr {
+		return nil
+	}
+
+	attributeTags := parseXdgTags(current)
+
+	file, err := store.FileByPath(tx, path)
+	if err != nil {
+		return fmt.Errorf("%v: could not retrieve file: %v", path, err)
+	}
+
+	var allTags, explicitTags []TagValue
+	if file != nil {
+		if allTags, err = FileTagValues(store, tx, file.Id, false); err != nil {
+			return err
+		}
+		if explicitTags, err = FileTagValues(store, tx, file.Id, true); err != nil {
+			return err
+		}
+	}
+
+	report := ReconcileReport{Path: path, Tagged: []TagValue{}, Untagged: []TagValue{}}
+
+	if options.Prefer != PreferDb {
+		report.Tagged = missingTagValues(attributeTags, allTags)
+	}
+	if options.Prefer == PreferXattr {
+		report.Untagged = missingTagValues(explicitTags, attributeTags)
+	}
+
+	if !options.Pretend {
+		if err := applyReconciliation(store, tx, path, settings, report); err != nil {
+			return err
+		}
+
+		if file == nil {
+			if file, err = store.FileByPath(tx, path); err != nil {
+				return fmt.Errorf("%v: could not retrieve file: %v", path, err)
+			}
+		}
+		if file != nil {
+			if allTags, err = FileTagValues(store, tx, file.Id, false); err != nil {
+				return err
+			}
+		}
+	} else {
+		allTags = append(missingTagValues(allTags, report.Untagged), report.Tagged...)
+	}
+
+	tags := make([]string, len(allTags))
+	for index, tagValue := range allTags {
+		tags[index] = tagValue.String()
+	}
+	sort.Strings(tags)
+
+	report.AttributeUpdated, err = syncXdgTags(path, tags, options.Pretend)
+	if err != nil {
+		return fmt.Errorf("%v: could not update extended attribute: %v", path, err)
+	}
+
+	if (len(report.Tagged) > 0 || len(report.Untagged) > 0 || report.AttributeUpdated) && options.Report != nil {
+		options.Report(report)
+	}
+
+	return nil
+}
+
+// unexported
+
+// Parses the comma-separated tags of the 'user.xdg.tags' extended attribute.
+func parseXdgTags(value []byte) []TagValue {
+	tagValues := make([]TagValue, 0, 10)
+	for _, text := range strings.Split(string(value), ",") {
+		text = strings.TrimSpace(text)
+		if text != "" {
+			tagValues = append(tagValues, ParseTagValue(text))
+		}
+	}
+
+	return tagValues
+}
+
+// The tag values of the first set that are not in the second.
+func missingTagValues(tagValues, of []TagValue) []TagValue {
+	missing := make([]TagValue, 0, len(tagValues))
+	for _, tagValue := range tagValues {
+		found := false
+		for _, other := range of {
+			if other == tagValue {
+				found = true
+				break
+			}
+		}
+
+		if !found {
+			missing = append(missing, tagValue)
+		}
+	}
+
+	return missing
+}
+
+func applyReconciliation(store *storage.Storage, tx *storage.Tx, path string, settings entities.Settings, report ReconcileReport) error {
+	// tagged before untagging lest the file be left untagged
+	if len(report.Tagged) > 0 {
+		pairs, err := ResolveTagValues(store, tx, report.Tagged, settings.AutoCreateTags(), settings.AutoCreateValues())
+		if err != nil {
+			return fmt.Errorf("%v: %v", path, err)
+		}
+
+		if err := TagPath(store, tx, path, pairs, settings, TagOptions{}); err != nil {
+			return err
+		}
+	}
+
+	if len(report.Untagged) == 0 {
+		return nil
+	}
+
+	file, err := store.FileByPath(tx, path)
+	if err != nil {
+		return fmt.Errorf("%v: could not retrieve file: %v", path, err)
+	}
+
+	for _, tagValue := range report.Untagged {
+		tag, err := store.TagByName(tx, tagValue.Tag)
+		if err != nil {
+			return err
+		}
+
+		value, err := store.ValueByName(tx, tagValue.Value)
+		if err != nil {
+			return err
+		}
+
+		if tag == nil || value == nil {
+			continue
+		}
+
+		if err := UntagFile(store, tx, file, tag, value); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,728 @@
+// Copyright 2011-2015 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package api
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"tmsu/common/log"
+	_path "tmsu/common/path"
+	"tmsu/common/progress"
+	"tmsu/entities"
+	"tmsu/storage"
+)
+
+type RepairAction int
+
+const (
+	RecalculatedFingerprint RepairAction = iota // an unmodified file's fingerprint was recalculated
+	UpdatedFingerprint                          // a modified file's details were updated
+	UpdatedPath                                 // a moved file was relocated
+	Missing                                     // a file could not be found
+	Removed                                     // a missing file was removed from the database
+	Rebound                                     // a file replaced at its path, e.g. by an editor, was re-bound
+)
+
+// A change made, or that would be made, by a repair.
+type RepairReport struct {
+	Action  RepairAction
+	Path    string
+	NewPath string
+}
+
+type RepairOptions struct {
+	SearchPaths      []string           // paths to search for moved files
+	LimitPath        string             // only repair files under this path
+	RemoveMissing    bool               // remove missing files from the database
+	RecalcUnmodified bool               // recalculate fingerprints for unmodified files
+	Rationalize      bool               // remove explicit taggings where an implicit tagging exists
+	IncludeVirtual   bool               // treat virtual files that do not exist as missing
+	Resume           bool               // continue an interrupted repair from its checkpoint
+	Pretend          bool               // report the repairs without making them
+	Report           func(RepairReport) // called for each repair
+
+	// called with the number of missing files before they are removed: an
+	// error prevents the removal
+	ConfirmRemove func(count uint) error
+}
+
+// Repairs the database within a transaction.
+func (db *Database) Repair(options RepairOptions) error {
+	return db.update("repair", options.SearchPaths, func(tx *storage.Tx) error {
+		return Repair(db.store, tx, options)
+	})
+}
+
+// Repairs the database, updating the details of modified files, relocating
+// moved files and identifying those that are missing.
+func Repair(store *storage.Storage, tx *storage.Tx, options RepairOptions) error {
+	report := options.Report
+	if report == nil {
+		report = func(RepairReport) {}
+	}
+
+	absLimitPath := ""
+	if options.LimitPath != "" {
+		var err error
+		absLimitPath, err = filepath.Abs(options.LimitPath)
+		if err != nil {
+			return fmt.Errorf("%v: could not determine absolute path", err)
+		}
+	}
+
+	settings, err := store.Settings(tx)
+	if err != nil {
+		return err
+	}
+
+	log.Infof(2, "retrieving files under '%v' from the database", absLimitPath)
+
+	dbFiles, err := store.FilesByDirectory(tx, absLimitPath)
+	if err != nil {
+		return fmt.Errorf("could not retrieve files from storage: %v", err)
+	}
+
+	dbFile, err := store.FileByPath(tx, absLimitPath)
+	if err != nil {
+		return fmt.Errorf("could not retrieve file from storage: %v", err)
+	}
+
+	if dbFile != nil {
+		dbFiles = append(dbFiles, dbFile)
+	}
+
+	log.Infof(2, "retrieved %v files from the database for path '%v'", len(dbFiles), absLimitPath)
+
+	sort.Sort(filesByPath(dbFiles))
+
+	unmodfied, modified, missing, replaced, err := determineStatuses(store, tx, dbFiles, options.IncludeVirtual)
+	if err != nil {
+		return err
+	}
+
+	checkpoint := newRepairCheckpoint(store, tx, absLimitPath, options.Pretend)
+	if options.Resume {
+		if err := checkpoint.load(); err != nil {
+			return err
+		}
+	}
+
+	if options.RecalcUnmodified {
+		if err = repairUnmodified(store, tx, checkpoint.remaining(unmodifiedPhase, unmodfied), options.Pretend, settings, report, checkpoint.reached(unmodifiedPhase)); err != nil {
+			return err
+		}
+	}
+
+	if err = repairModified(store, tx, checkpoint.remaining(modifiedPhase, modified), replaced, options.Pretend, settings, report, checkpoint.reached(modifiedPhase)); err != nil {
+		return err
+	}
+
+	if err = repairMoved(store, tx, missing, options.SearchPaths, options.Pretend, settings, report); err != nil {
+		return err
+	}
+
+	if options.RemoveMissing && !options.Pretend && options.ConfirmRemove != nil {
+		if err := options.ConfirmRemove(countMissing(missing)); err != nil {
+			return err
+		}
+	}
+
+	if err = repairMissing(store, tx, missing, options.Pretend, options.RemoveMissing, report); err != nil {
+		return err
+	}
+
+	if err = deleteUntaggedFiles(store, tx, dbFiles); err != nil {
+		return err
+	}
+
+	if err = deleteUnusedValues(store, tx); err != nil {
+		return err
+	}
+
+	if options.Rationalize {
+		if err = rationalizeFileTags(store, tx, dbFiles); err != nil {
+			return err
+		}
+	}
+
+	return checkpoint.clear()
+}
+
+// Updates the paths of files under fromPath to be under toPath instead.
+//
+// No fingerprint search is performed: each file keeps its stored fingerprint
+// unless its modification time or size differ at the new location, in which
+// case the fingerprint is recalculated. If acceptModified is set then such
+// modifications are accepted as they are and nothing is re-hashed.
+func ManualRepair(store *storage.Storage, tx *storage.Tx, fromPath, toPath string, acceptModified, pretend bool, report func(RepairReport)) error {
+	if report == nil {
+		report = func(RepairReport) {}
+	}
+
+	absFromPath, err := filepath.Abs(fromPath)
+	if err != nil {
+		return fmt.Errorf("%v: could not determine absolute path", err)
+	}
+
+	absToPath, err := filepath.Abs(toPath)
+	if err != nil {
+		return fmt.Errorf("%v: could not determine absolute path", err)
+	}
+
+	settings, err := store.Settings(tx)
+	if err != nil {
+		return err
+	}
+
+	log.Infof(2, "retrieving files under '%v' from the database", fromPath)
+
+	dbFiles, err := store.FilesByDirectory(tx, absFromPath)
+	if err != nil {
+		return fmt.Errorf("could not retrieve files from storage: %v", err)
+	}
+
+	dbFile, err := store.FileByPath(tx, absFromPath)
+	if err != nil {
+		return fmt.Errorf("%v: could not retrieve file: %v", fromPath, err)
+	}
+
+	if dbFile != nil {
+		dbFiles = append(entities.Files{dbFile}, dbFiles...)
+	}
+
+	reporter := progress.New("relocating files", len(dbFiles))
+	defer reporter.Done()
+
+	for _, dbFile := range dbFiles {
+		reporter.Increment()
+
+		fileFromPath := dbFile.Path()
+		fileToPath := absToPath + fileFromPath[len(absFromPath):]
+
+		log.Infof(2, "%v: updating to %v", _path.Rel(fileFromPath), _path.Rel(fileToPath))
+
+		if err := manualRepairFile(store, tx, dbFile, fileToPath, acceptModified, pretend, settings); err != nil {
+			return err
+		}
+
+		reporter.Clear()
+		report(RepairReport{UpdatedPath, fileFromPath, fileToPath})
+	}
+
+	return nil
+}
+
+// Rewrites the paths of all files under fromPath to be under toPath instead,
+// as is needed when a drive is mounted elsewhere. Unlike ManualRepair the
+// files are neither examined nor updated individually: the stored paths are
+// rewritten in one statement.
+func PrefixRepair(store *storage.Storage, tx *storage.Tx, fromPath, toPath string, pretend bool, report func(RepairReport)) error {
+	if report == nil {
+		report = func(RepairReport) {}
+	}
+
+	absFromPath, err := filepath.Abs(fromPath)
+	if err != nil {
+		return fmt.Errorf("%v: could not determine absolute path", err)
+	}
+
+	absToPath, err := filepath.Abs(toPath)
+	if err != nil {
+		return fmt.Errorf("%v: could not determine absolute path", err)
+	}
+
+	if _, err := os.Stat(absToPath); err != nil {
+		switch {
+		case os.IsPermission(err):
+			return fmt.Errorf("%v: permission denied", toPath)
+		case os.IsNotExist(err):
+			return fmt.Errorf("%v: no such file or directory", toPath)
+		default:
+			return err
+		}
+	}
+
+	if !pretend {
+		log.Infof(2, "rewriting paths under '%v' to be under '%v'", absFromPath, absToPath)
+
+		count, err := store.RewriteFilePaths(tx, absFromPath, absToPath)
+		if err != nil {
+			return fmt.Errorf("could not rewrite paths: %v", err)
+		}
+
+		log.Infof(2, "rewrote %v paths", count)
+	}
+
+	report(RepairReport{UpdatedPath, absFromPath, absToPath})
+
+	return nil
+}
+
+// unexported
+
+func manualRepairFile(store *storage.Storage, tx *storage.Tx, file *entities.File, toPath string, acceptModified, pretend bool, settings entities.Settings) error {
+	stat, err := os.Stat(toPath)
+	if err != nil {
+		switch {
+		case os.IsPermission(err):
+			return fmt.Errorf("%v: permission denied", toPath)
+		case os.IsNotExist(err):
+			return fmt.Errorf("%v: file not found", toPath)
+		default:
+			return err
+		}
+	}
+
+	pathOnly, err := store.FilePathOnly(tx, file.Id)
+	if err != nil {
+		return fmt.Errorf("%v: could not determine file tracking: %v", file.Path(), err)
+	}
+
+	fileFingerprint := file.Fingerprint
+	if !acceptModified && !pathOnly && (!file.ModTime.Equal(stat.ModTime().UTC()) || file.Size != stat.Size()) {
+		log.Infof(2, "%v: modified: recalculating fingerprint", toPath)
+
+		fileFingerprint, err = store.Fingerprint(tx, toPath, settings.FileFingerprintAlgorithm(), settings.DirectoryFingerprintAlgorithm())
+		if err != nil {
+			return fmt.Errorf("%v: could not create fingerprint: %v", toPath, err)
+		}
+	}
+
+	if pretend {
+		return nil
+	}
+
+	if _, err := store.UpdateFile(tx, file.Id, toPath, fileFingerprint, stat.ModTime(), stat.Size(), stat.IsDir()); err != nil {
+		return fmt.Errorf("%v: could not update file in database: %v", toPath, err)
+	}
+
+	return nil
+}
+
+func deleteUntaggedFiles(store *storage.Storage, tx *storage.Tx, files entities.Files) error {
+	log.Infof(2, "purging untagged files")
+
+	fileIds := make([]entities.FileId, len(files))
+	for index, file := range files {
+		fileIds[index] = file.Id
+	}
+
+	return store.DeleteUntaggedFiles(tx, fileIds)
+}
+
+func deleteUnusedValues(store *storage.Storage, tx *storage.Tx) error {
+	log.Infof(2, "purging unused values")
+
+	values, err := store.Values(tx)
+	if err != nil {
+		return fmt.Errorf("could not retrieve set of values")
+	}
+
+	valueIds := make([]entities.ValueId, len(values))
+	for index, value := range values {
+		valueIds[index] = value.Id
+	}
+
+	return store.DeleteUnusedValues(tx, valueIds)
+}
+
+func rationalizeFileTags(store *storage.Storage, tx *storage.Tx, files entities.Files) error {
+	log.Infof(2, "rationalizing file tags")
+
+	for _, file := range files {
+		fileTags, err := store.FileTagsByFileId(tx, file.Id, false)
+		if err != nil {
+			return fmt.Errorf("could not determine tags for file '%v': %v", file.Path(), err)
+		}
+
+		for _, fileTag := range fileTags {
+			if fileTag.Implicit && fileTag.Explicit {
+				log.Infof(2, "%v: removing explicit tagging %v as implicit tagging exists", file.Path(), fileTag.TagId)
+
+				if err := store.DeleteFileTag(tx, fileTag.FileId, fileTag.TagId, fileTag.ValueId); err != nil {
+					return fmt.Errorf("could not delete file tag for file %v, tag %v and value %v", fileTag.FileId, fileTag.TagId, fileTag.ValueId)
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+// Sorts the files into those that are unmodified, modified and missing. Files
+// that have been replaced at their paths, as editors do when saving, are
+// modified whether or not their size and modification time have changed, and
+// are also identified in replaced.
+func determineStatuses(store *storage.Storage, tx *storage.Tx, dbFiles entities.Files, includeVirtual bool) (unmodified, modified, missing entities.Files, replaced map[entities.FileId]bool, err error) {
+	log.Infof(2, "determining file statuses")
+
+	unmodified = make(entities.Files, 0, 10)
+	modified = make(entities.Files, 0, 10)
+	missing = make(entities.Files, 0, 10)
+	replaced = make(map[entities.FileId]bool)
+
+	reporter := progress.New("checking files", len(dbFiles))
+	defer reporter.Done()
+
+	for _, dbFile := range dbFiles {
+		reporter.Increment()
+
+		if _path.IsURL(dbFile.Path()) {
+			log.Infof(2, "%v: not a file: skipping", dbFile.Path())
+			continue
+		}
+
+		stat, err := os.Stat(dbFile.Path())
+		if err != nil {
+			switch {
+			case os.IsPermission(err):
+				reporter.Clear()
+				log.Warnf("%v: permission denied", dbFile.Path())
+				continue
+			case os.IsNotExist(err):
+				offline, err := store.FileOffline(tx, dbFile.Id)
+				if err != nil {
+					return nil, nil, nil, nil, fmt.Errorf("%v: could not determine volume status: %v", dbFile.Path(), err)
+				}
+				if offline {
+					log.Infof(2, "%v: volume is offline: skipping", dbFile.Path())
+					continue
+				}
+
+				if !includeVirtual {
+					virtual, err := store.FileVirtual(tx, dbFile.Id)
+					if err != nil {
+						return nil, nil, nil, nil, fmt.Errorf("%v: could not determine file tracking: %v", dbFile.Path(), err)
+					}
+					if virtual {
+						log.Infof(2, "%v: virtual: skipping", dbFile.Path())
+						continue
+					}
+				}
+
+				log.Infof(2, "%v: missing", dbFile.Path())
+				missing = append(missing, dbFile)
+				continue
+			}
+		}
+
+		pathOnly, err := store.FilePathOnly(tx, dbFile.Id)
+		if err != nil {
+			return nil, nil, nil, nil, fmt.Errorf("%v: could not determine file tracking: %v", dbFile.Path(), err)
+		}
+		if pathOnly {
+			log.Infof(2, "%v: tracked by path only: skipping", dbFile.Path())
+			continue
+		}
+
+		isReplaced, err := store.FileReplaced(tx, dbFile.Id, stat)
+		if err != nil {
+			return nil, nil, nil, nil, fmt.Errorf("%v: could not determine file identity: %v", dbFile.Path(), err)
+		}
+
+		switch {
+		case isReplaced:
+			log.Infof(2, "%v: replaced", dbFile.Path())
+			modified = append(modified, dbFile)
+			replaced[dbFile.Id] = true
+		case dbFile.ModTime.Equal(stat.ModTime().UTC()) && dbFile.Size == stat.Size():
+			log.Infof(2, "%v: unmodified", dbFile.Path())
+			unmodified = append(unmodified, dbFile)
+		default:
+			log.Infof(2, "%v: modified", dbFile.Path())
+			modified = append(modified, dbFile)
+		}
+	}
+
+	return
+}
+
+func repairUnmodified(store *storage.Storage, tx *storage.Tx, unmodified entities.Files, pretend bool, settings entities.Settings, report func(RepairReport), reached func(string) error) error {
+	log.Infof(2, "recalculating fingerprints for unmodified files")
+
+	reporter := progress.New("recalculating fingerprints", len(unmodified))
+	defer reporter.Done()
+
+	for _, dbFile := range unmodified {
+		reporter.Increment()
+
+		stat, err := os.Stat(dbFile.Path())
+		if err != nil {
+			return err
+		}
+
+		fingerprint, err := store.RecalculateFingerprint(tx, dbFile.Path(), settings.FileFingerprintAlgorithm(), settings.DirectoryFingerprintAlgorithm())
+		if err != nil {
+			reporter.Clear()
+			log.Warnf("%v: could not create fingerprint: %v", dbFile.Path(), err)
+			continue
+		}
+
+		if !pretend {
+			_, err := store.UpdateFile(tx, dbFile.Id, dbFile.Path(), fingerprint, stat.ModTime(), stat.Size(), stat.IsDir())
+			if err != nil {
+				return fmt.Errorf("%v: could not update file in database: %v", dbFile.Path(), err)
+			}
+
+			// a virtual file that has since arrived is now tracked as any other
+			virtual, err := store.FileVirtual(tx, dbFile.Id)
+			if err != nil {
+				return fmt.Errorf("%v: could not determine file tracking: %v", dbFile.Path(), err)
+			}
+			if virtual {
+				if err := store.UpdateFileVirtual(tx, dbFile.Id, false); err != nil {
+					return fmt.Errorf("%v: could not update file tracking: %v", dbFile.Path(), err)
+				}
+			}
+		}
+
+		reporter.Clear()
+		report(RepairReport{RecalculatedFingerprint, dbFile.Path(), ""})
+
+		if err := reached(dbFile.Path()); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func repairModified(store *storage.Storage, tx *storage.Tx, modified entities.Files, replaced map[entities.FileId]bool, pretend bool, settings entities.Settings, report func(RepairReport), reached func(string) error) error {
+	log.Infof(2, "repairing modified files")
+
+	reporter := progress.New("updating fingerprints", len(modified))
+	defer reporter.Done()
+
+	for _, dbFile := range modified {
+		reporter.Increment()
+
+		stat, err := os.Stat(dbFile.Path())
+		if err != nil {
+			return err
+		}
+
+		fingerprint, err := store.Fingerprint(tx, dbFile.Path(), settings.FileFingerprintAlgorithm(), settings.DirectoryFingerprintAlgorithm())
+		if err != nil {
+			reporter.Clear()
+			log.Warnf("%v: could not create fingerprint: %v", dbFile.Path(), err)
+			continue
+		}
+
+		if !pretend {
+			_, err := store.UpdateFile(tx, dbFile.Id, dbFile.Path(), fingerprint, stat.ModTime(), stat.Size(), stat.IsDir())
+			if err != nil {
+				return fmt.Errorf("%v: could not update file in database: %v", dbFile.Path(), err)
+			}
+		}
+
+		action := UpdatedFingerprint
+		if replaced[dbFile.Id] {
+			action = Rebound
+		}
+
+		reporter.Clear()
+		report(RepairReport{action, dbFile.Path(), ""})
+
+		if err := reached(dbFile.Path()); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func repairMoved(store *storage.Storage, tx *storage.Tx, missing entities.Files, searchPaths []string, pretend bool, settings entities.Settings, report func(RepairReport)) error {
+	log.Infof(2, "repairing moved files")
+
+	if len(missing) == 0 || len(searchPaths) == 0 {
+		// don't bother enumerating filesystem if nothing to do
+		return nil
+	}
+
+	pathsBySize, err := buildPathBySizeMap(searchPaths)
+	if err != nil {
+		return err
+	}
+
+	// determine which of the candidates are already tagged in one go
+	candidatePaths := make([]string, 0, 10)
+	sizes := make(map[int64]bool, len(missing))
+	for _, dbFile := range missing {
+		if !sizes[dbFile.Size] {
+			sizes[dbFile.Size] = true
+			candidatePaths = append(candidatePaths, pathsBySize[dbFile.Size]...)
+		}
+	}
+
+	candidateFiles, err := store.FilesByPaths(tx, candidatePaths)
+	if err != nil {
+		return fmt.Errorf("could not retrieve files: %v", err)
+	}
+
+	tagged := make(map[string]bool, len(candidateFiles))
+	for _, candidateFile := range candidateFiles {
+		tagged[candidateFile.Path()] = true
+	}
+
+	reporter := progress.New("searching for moved files", len(missing))
+	defer reporter.Done()
+
+	for index, dbFile := range missing {
+		reporter.Increment()
+
+		log.Infof(2, "%v: searching for new location", dbFile.Path())
+
+		pathsOfSize := pathsBySize[dbFile.Size]
+		log.Infof(2, "%v: file is of size %v, identified %v files of this size", dbFile.Path(), dbFile.Size, len(pathsOfSize))
+
+		for _, candidatePath := range pathsOfSize {
+			if tagged[candidatePath] {
+				continue
+			}
+
+			stat, err := os.Stat(candidatePath)
+			if err != nil {
+				return fmt.Errorf("%v: could not stat file: %v", candidatePath, err)
+			}
+
+			fingerprint, err := store.Fingerprint(tx, candidatePath, settings.FileFingerprintAlgorithm(), settings.DirectoryFingerprintAlgorithm())
+			if err != nil {
+				return fmt.Errorf("%v: could not create fingerprint: %v", candidatePath, err)
+			}
+
+			if fingerprint == dbFile.Fingerprint {
+				if !pretend {
+					_, err := store.UpdateFile(tx, dbFile.Id, candidatePath, dbFile.Fingerprint, stat.ModTime(), dbFile.Size, dbFile.IsDir)
+					if err != nil {
+						return fmt.Errorf("%v: could not update file in database: %v", dbFile.Path(), err)
+					}
+				}
+
+				reporter.Clear()
+				report(RepairReport{UpdatedPath, dbFile.Path(), candidatePath})
+
+				missing[index] = nil
+				tagged[candidatePath] = true
+
+				break
+			}
+		}
+	}
+
+	return nil
+}
+
+func repairMissing(store *storage.Storage, tx *storage.Tx, missing entities.Files, pretend, force bool, report func(RepairReport)) error {
+	for _, dbFile := range missing {
+		if dbFile == nil {
+			continue
+		}
+
+		if force {
+			if !pretend {
+				if err := store.DeleteFileTagsByFileId(tx, dbFile.Id); err != nil {
+					return fmt.Errorf("%v: could not delete file-tags: %v", dbFile.Path(), err)
+				}
+			}
+
+			report(RepairReport{Removed, dbFile.Path(), ""})
+		} else {
+			report(RepairReport{Missing, dbFile.Path(), ""})
+		}
+	}
+
+	return nil
+}
+
+// Counts the missing files that were not found to have moved.
+func countMissing(missing entities.Files) uint {
+	count := uint(0)
+	for _, dbFile := range missing {
+		if dbFile != nil {
+			count++
+		}
+	}
+
+	return count
+}
+
+func buildPathBySizeMap(paths []string) (map[int64][]string, error) {
+	log.Infof(2, "building map of paths by size")
+
+	pathsBySize := make(map[int64][]string, 10)
+
+	for _, path := range paths {
+		if err := buildPathBySizeMapRecursive(path, pathsBySize); err != nil {
+			return nil, err
+		}
+	}
+
+	log.Infof(2, "path by size map has %v sizes", len(pathsBySize))
+
+	return pathsBySize, nil
+}
+
+func buildPathBySizeMapRecursive(path string, pathBySizeMap map[int64][]string) error {
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return fmt.Errorf("%v: could not get absolute path", path)
+	}
+
+	stat, err := os.Stat(absPath)
+	if err != nil {
+		switch {
+		case os.IsPermission(err):
+			log.Warnf("%v: permission denied", path)
+		default:
+			return err
+		}
+	}
+
+	if stat.IsDir() {
+		log.Infof(3, "%v: examining directory contents", absPath)
+
+		dir, err := os.Open(absPath)
+		if err != nil {
+			return fmt.Errorf("%v: could not open directory: %v", path, err)
+		}
+
+		names, err := dir.Readdirnames(0)
+		dir.Close()
+		if err != nil {
+			return fmt.Errorf("%v: could not read directory entries: %v", path, err)
+		}
+
+		for _, name := range names {
+			childPath := filepath.Join(path, name)
+			if err := buildPathBySizeMapRecursive(childPath, pathBySizeMap); err != nil {
+				return err
+			}
+		}
+	} else {
+		log.Infof(3, "%v: file is of size %v", absPath, stat.Size())
+
+		filesOfSize, ok := pathBySizeMap[stat.Size()]
+		if ok {
+			pathBySizeMap[stat.Size()] = append(filesOfSize, absPath)
+		} else {
+			pathBySizeMap[stat.Size()] = []string{absPath}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,149 @@
+// Copyright 2011-2015 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package api
+
+import (
+	"fmt"
+	"strings"
+	"tmsu/common/log"
+	"tmsu/entities"
+	"tmsu/storage"
+)
+
+// unexported
+
+// The phases of a repair that fingerprint files, which are checkpointed.
+const (
+	unmodifiedPhase = "unmodified"
+	modifiedPhase   = "modified"
+)
+
+// The number of files repaired between checkpoints.
+const repairCheckpointInterval = 100
+
+// Records the progress of a repair in the database, committing the repairs made
+// so far, so that an interrupted repair can resume where it left off rather
+// than fingerprinting every file again. Files are repaired in path order and
+// the checkpoint is the phase and path of the last file repaired.
+type repairCheckpoint struct {
+	store   *storage.Storage
+	tx      *storage.Tx
+	name    string
+	pretend bool
+	phase   string // the phase of the loaded checkpoint
+	path    string // the last path repaired in that phase
+	count   int    // files repaired since the last checkpoint
+}
+
+func newRepairCheckpoint(store *storage.Storage, tx *storage.Tx, limitPath string, pretend bool) *repairCheckpoint {
+	return &repairCheckpoint{store: store, tx: tx, name: "repair:" + limitPath, pretend: pretend}
+}
+
+// Loads the checkpoint left by an interrupted repair of the same path.
+func (checkpoint *repairCheckpoint) load() error {
+	position, err := checkpoint.store.Checkpoint(checkpoint.tx, checkpoint.name)
+	if err != nil {
+		return fmt.Errorf("could not retrieve repair checkpoint: %v", err)
+	}
+	if position == "" {
+		log.Warn("no interrupted repair to resume: repairing all files")
+		return nil
+	}
+
+	parts := strings.SplitN(position, ":", 2)
+	if len(parts) != 2 {
+		return fmt.Errorf("invalid repair checkpoint '%v'", position)
+	}
+
+	checkpoint.phase, checkpoint.path = parts[0], parts[1]
+	log.Infof(1, "resuming repair of %v files after '%v'", checkpoint.phase, checkpoint.path)
+
+	return nil
+}
+
+// The files, sorted by path, that remain to be repaired in the phase.
+func (checkpoint *repairCheckpoint) remaining(phase string, files entities.Files) entities.Files {
+	switch {
+	case checkpoint.phase == "":
+		return files
+	case checkpoint.phase == modifiedPhase && phase == unmodifiedPhase:
+		// the earlier phase was completed
+		return entities.Files{}
+	case checkpoint.phase != phase:
+		return files
+	}
+
+	for index, file := range files {
+		if file.Path() > checkpoint.path {
+			return files[index:]
+		}
+	}
+
+	return entities.Files{}
+}
+
+// Returns the function to call once each file in the phase is repaired, which
+// periodically records the checkpoint and commits.
+func (checkpoint *repairCheckpoint) reached(phase string) func(string) error {
+	return func(path string) error {
+		if checkpoint.pretend {
+			return nil
+		}
+
+		checkpoint.count++
+		if checkpoint.count < repairCheckpointInterval {
+			return nil
+		}
+		checkpoint.count = 0
+
+		if err := checkpoint.store.UpdateCheckpoint(checkpoint.tx, checkpoint.name, phase+":"+path); err != nil {
+			return fmt.Errorf("could not record repair checkpoint: %v", err)
+		}
+
+		if err := checkpoint.tx.Checkpoint(); err != nil {
+			return fmt.Errorf("could not commit repairs: %v", err)
+		}
+
+		return nil
+	}
+}
+
+// Removes the checkpoint once the repair is complete.
+func (checkpoint *repairCheckpoint) clear() error {
+	if checkpoint.pretend {
+		return nil
+	}
+
+	if err := checkpoint.store.DeleteCheckpoint(checkpoint.tx, checkpoint.name); err != nil {
+		return fmt.Errorf("could not remove repair checkpoint: %v", err)
+	}
+
+	return nil
+}
+
+type filesByPath entities.Files
+
+func (files filesByPath) Len() int {
+	return len(files)
+}
+
+func (files filesByPath) Less(i, j int) bool {
+	return files[i].Path() < files[j].Path()
+}
+
+func (files filesByPath) Swap(i, j int) {
+	files[i], files[j] = files[j], files[i]
+}
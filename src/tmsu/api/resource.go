@@ -0,0 +1,120 @@
+// Copyright 2011-2015 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package api
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+	"tmsu/common/fingerprint"
+	"tmsu/common/log"
+	_path "tmsu/common/path"
+)
+
+// Handles the resources of a URL scheme, such as the web pages that are
+// tagged as bookmarks alongside files.
+type ResourceHandler interface {
+	// Fingerprints the resource so that changes to it, and duplicates of it,
+	// can be identified.
+	Fingerprint(url string) (fingerprint.Fingerprint, error)
+
+	// Opens the resource with the desktop's default application.
+	Open(url string) error
+}
+
+// Retrieves the handler for the URL's scheme.
+func ResourceHandlerFor(url string) (ResourceHandler, error) {
+	scheme := _path.Scheme(url)
+
+	handler, ok := resourceHandlers[scheme]
+	if !ok {
+		return nil, fmt.Errorf("%v: unsupported scheme '%v'", url, scheme)
+	}
+
+	return handler, nil
+}
+
+// A handler for web resources. These are fingerprinted by their entity tag
+// where the server provides one and otherwise by a SHA-256 hash of their
+// content, so that a page saved as a file is identified as its duplicate.
+type HttpResourceHandler struct {
+	Client *http.Client
+}
+
+func (handler HttpResourceHandler) Fingerprint(url string) (fingerprint.Fingerprint, error) {
+	response, err := handler.Client.Head(url)
+	if err != nil {
+		return fingerprint.Empty, err
+	}
+	response.Body.Close()
+
+	if etag := response.Header.Get("ETag"); etag != "" && response.StatusCode == http.StatusOK {
+		return fingerprint.Fingerprint(httpEntityTagPrefix + strings.Trim(etag, `"`)), nil
+	}
+
+	response, err = handler.Client.Get(url)
+	if err != nil {
+		return fingerprint.Empty, err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return fingerprint.Empty, fmt.Errorf("%v: %v", url, response.Status)
+	}
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, response.Body); err != nil {
+		return fingerprint.Empty, err
+	}
+
+	return fingerprint.Fingerprint(hex.EncodeToString(hash.Sum(nil))), nil
+}
+
+func (handler HttpResourceHandler) Open(url string) error {
+	return desktopOpenCommand(url).Start()
+}
+
+// unexported
+
+// Fingerprints the resource at the URL. As a resource may be tagged whilst
+// it cannot be reached, failure is reported but leaves it without a
+// fingerprint.
+func resourceFingerprint(url string) fingerprint.Fingerprint {
+	handler, err := ResourceHandlerFor(url)
+	if err == nil {
+		var fp fingerprint.Fingerprint
+		if fp, err = handler.Fingerprint(url); err == nil {
+			return fp
+		}
+	}
+
+	log.Warnf("%v: could not create fingerprint: %v", url, err)
+	return fingerprint.Empty
+}
+
+// Distinguishes fingerprints that are entity tags from content hashes.
+const httpEntityTagPrefix = "etag:"
+
+var httpResourceHandler = HttpResourceHandler{&http.Client{Timeout: 30 * time.Second}}
+
+var resourceHandlers = map[string]ResourceHandler{
+	"http":  httpResourceHandler,
+	"https": httpResourceHandler,
+}
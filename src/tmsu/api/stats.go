@@ -0,0 +1,393 @@
+// Copyright 2011-2015 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package api
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"tmsu/common/log"
+	"tmsu/entities"
+	"tmsu/storage"
+)
+
+// Statistics describing how the tags in a database are used.
+type Statistics struct {
+	Files       uint                `json:"files"`
+	Tags        uint                `json:"tags"`
+	Taggings    uint                `json:"taggings"`
+	TopTags     []TagStatistic      `json:"topTags"`     // most used tags first
+	TopPairs    []TagPairStatistic  `json:"topPairs"`    // most frequently co-occurring tags first
+	Histogram   []HistogramBucket   `json:"histogram"`   // number of tags by number of files tagged
+	Directories []DirectoryCoverage `json:"directories"` // least tagged directories first
+	Growth      []GrowthPeriod      `json:"growth"`      // taggings by month, earliest first
+}
+
+// The number of files a tag is applied to.
+type TagStatistic struct {
+	Name  string `json:"name"`
+	Files uint   `json:"files"`
+}
+
+// The number of files two tags are both applied to.
+type TagPairStatistic struct {
+	Tags  [2]string `json:"tags"`
+	Files uint      `json:"files"`
+}
+
+// The number of tags applied to between Min and Max files.
+type HistogramBucket struct {
+	Min  uint `json:"min"`
+	Max  uint `json:"max"`
+	Tags uint `json:"tags"`
+}
+
+// The proportion of the entries of a directory holding tagged files that are
+// themselves untagged.
+type DirectoryCoverage struct {
+	Path     string  `json:"path"`
+	Entries  uint    `json:"entries"`
+	Untagged uint    `json:"untagged"`
+	Ratio    float64 `json:"ratio"`
+}
+
+// The number of taggings made during a month and the total to the end of it.
+type GrowthPeriod struct {
+	Month    string `json:"month"`
+	Taggings uint   `json:"taggings"`
+	Total    uint   `json:"total"`
+}
+
+// Gathers the tag statistics, listing at most top tags, tag pairs and
+// directories.
+func (db *Database) Stats(top int) (*Statistics, error) {
+	var stats *Statistics
+
+	err := db.view(func(tx *storage.Tx) error {
+		var err error
+		stats, err = Stats(db.store, tx, top)
+		return err
+	})
+
+	return stats, err
+}
+
+// Gathers the tag statistics, listing at most top tags, tag pairs and
+// directories.
+func Stats(store *storage.Storage, tx *storage.Tx, top int) (*Statistics, error) {
+	log.Info(2, "retrieving files, tags and taggings")
+
+	files, err := store.Files(tx, "name")
+	if err != nil {
+		return nil, fmt.Errorf("could not retrieve files: %v", err)
+	}
+
+	tags, err := store.Tags(tx)
+	if err != nil {
+		return nil, fmt.Errorf("could not retrieve tags: %v", err)
+	}
+
+	fileTags, err := store.FileTags(tx)
+	if err != nil {
+		return nil, fmt.Errorf("could not retrieve taggings: %v", err)
+	}
+
+	tagNames := make(map[entities.TagId]string, len(tags))
+	for _, tag := range tags {
+		tagNames[tag.Id] = tag.Name
+	}
+
+	tagIdsByFileId := make(map[entities.FileId]entities.TagIds, len(files))
+	for _, fileTag := range fileTags {
+		tagIdsByFileId[fileTag.FileId] = append(tagIdsByFileId[fileTag.FileId], fileTag.TagId)
+	}
+
+	// a tag applied with several values counts once
+	for fileId, tagIds := range tagIdsByFileId {
+		tagIdsByFileId[fileId] = tagIds.Uniq()
+	}
+
+	stats := Statistics{Files: uint(len(files)), Tags: uint(len(tags)), Taggings: uint(len(fileTags))}
+
+	log.Info(2, "calculating tag usage")
+
+	fileCounts := tagFileCounts(tagIdsByFileId, tags)
+	stats.TopTags = topTags(fileCounts, tagNames, top)
+	stats.Histogram = filesPerTagHistogram(fileCounts)
+
+	log.Info(2, "calculating tag co-occurrence")
+
+	stats.TopPairs = topTagPairs(tagIdsByFileId, tagNames, top)
+
+	log.Info(2, "calculating directory coverage")
+
+	stats.Directories = directoryCoverage(files, tagIdsByFileId, top)
+
+	log.Info(2, "calculating growth")
+
+	stats.Growth = growth(fileTags)
+
+	return &stats, nil
+}
+
+// unexported
+
+func tagFileCounts(tagIdsByFileId map[entities.FileId]entities.TagIds, tags entities.Tags) map[entities.TagId]uint {
+	counts := make(map[entities.TagId]uint, len(tags))
+	for _, tag := range tags {
+		counts[tag.Id] = 0
+	}
+
+	for _, tagIds := range tagIdsByFileId {
+		for _, tagId := range tagIds {
+			counts[tagId]++
+		}
+	}
+
+	return counts
+}
+
+func topTags(counts map[entities.TagId]uint, tagNames map[entities.TagId]string, top int) []TagStatistic {
+	tagStats := make(tagStatistics, 0, len(counts))
+	for tagId, count := range counts {
+		tagStats = append(tagStats, TagStatistic{tagNames[tagId], count})
+	}
+
+	sort.Sort(tagStats)
+
+	if top >= 0 && len(tagStats) > top {
+		tagStats = tagStats[:top]
+	}
+
+	return tagStats
+}
+
+func topTagPairs(tagIdsByFileId map[entities.FileId]entities.TagIds, tagNames map[entities.TagId]string, top int) []TagPairStatistic {
+	counts := make(map[[2]string]uint)
+	for _, tagIds := range tagIdsByFileId {
+		for i := 0; i < len(tagIds); i++ {
+			for j := i + 1; j < len(tagIds); j++ {
+				pair := [2]string{tagNames[tagIds[i]], tagNames[tagIds[j]]}
+				if pair[0] > pair[1] {
+					pair[0], pair[1] = pair[1], pair[0]
+				}
+
+				counts[pair]++
+			}
+		}
+	}
+
+	pairStats := make(tagPairStatistics, 0, len(counts))
+	for pair, count := range counts {
+		pairStats = append(pairStats, TagPairStatistic{pair, count})
+	}
+
+	sort.Sort(pairStats)
+
+	if top >= 0 && len(pairStats) > top {
+		pairStats = pairStats[:top]
+	}
+
+	return pairStats
+}
+
+// Buckets the tags by the number of files they are applied to: 0, 1, 2-3,
+// 4-7 &c.
+func filesPerTagHistogram(counts map[entities.TagId]uint) []HistogramBucket {
+	tagCounts := make(map[uint]uint)
+	for _, count := range counts {
+		min := uint(0)
+		if count > 0 {
+			min = 1
+			for min*2 <= count {
+				min *= 2
+			}
+		}
+
+		tagCounts[min]++
+	}
+
+	buckets := make(histogramBuckets, 0, len(tagCounts))
+	for min, tagCount := range tagCounts {
+		max := uint(0)
+		if min > 0 {
+			max = min*2 - 1
+		}
+
+		buckets = append(buckets, HistogramBucket{min, max, tagCount})
+	}
+
+	sort.Sort(buckets)
+
+	return buckets
+}
+
+func directoryCoverage(files entities.Files, tagIdsByFileId map[entities.FileId]entities.TagIds, top int) []DirectoryCoverage {
+	tagged := make(map[string]bool, len(files))
+	seen := make(map[string]bool)
+	directories := make([]string, 0, 10)
+	for _, file := range files {
+		if len(tagIdsByFileId[file.Id]) == 0 {
+			continue
+		}
+
+		if !seen[file.Directory] {
+			seen[file.Directory] = true
+			directories = append(directories, file.Directory)
+		}
+
+		tagged[file.Path()] = true
+	}
+
+	coverages := make(directoryCoverages, 0, len(directories))
+	for _, directory := range directories {
+		dir, err := os.Open(directory)
+		if err != nil {
+			log.Infof(2, "%v: could not open directory: %v", directory, err)
+			continue
+		}
+
+		names, err := dir.Readdirnames(0)
+		dir.Close()
+		if err != nil {
+			log.Infof(2, "%v: could not read directory entries: %v", directory, err)
+			continue
+		}
+		if len(names) == 0 {
+			continue
+		}
+
+		coverage := DirectoryCoverage{Path: directory, Entries: uint(len(names))}
+		for _, name := range names {
+			if !tagged[filepath.Join(directory, name)] {
+				coverage.Untagged++
+			}
+		}
+		coverage.Ratio = float64(coverage.Untagged) / float64(coverage.Entries)
+
+		coverages = append(coverages, coverage)
+	}
+
+	sort.Sort(coverages)
+
+	if top >= 0 && len(coverages) > top {
+		coverages = coverages[:top]
+	}
+
+	return coverages
+}
+
+// Counts the taggings made each month. Taggings made before the time of
+// tagging was recorded are not included.
+func growth(fileTags entities.FileTags) []GrowthPeriod {
+	counts := make(map[string]uint)
+	for _, fileTag := range fileTags {
+		if fileTag.Time.IsZero() {
+			continue
+		}
+
+		counts[fileTag.Time.Local().Format("2006-01")]++
+	}
+
+	months := make([]string, 0, len(counts))
+	for month := range counts {
+		months = append(months, month)
+	}
+
+	sort.Strings(months)
+
+	periods := make([]GrowthPeriod, len(months))
+
+	var total uint
+	for index, month := range months {
+		total += counts[month]
+		periods[index] = GrowthPeriod{month, counts[month], total}
+	}
+
+	return periods
+}
+
+type tagStatistics []TagStatistic
+
+func (tagStats tagStatistics) Len() int {
+	return len(tagStats)
+}
+
+func (tagStats tagStatistics) Less(i, j int) bool {
+	if tagStats[i].Files != tagStats[j].Files {
+		return tagStats[i].Files > tagStats[j].Files
+	}
+
+	return tagStats[i].Name < tagStats[j].Name
+}
+
+func (tagStats tagStatistics) Swap(i, j int) {
+	tagStats[i], tagStats[j] = tagStats[j], tagStats[i]
+}
+
+type tagPairStatistics []TagPairStatistic
+
+func (pairStats tagPairStatistics) Len() int {
+	return len(pairStats)
+}
+
+func (pairStats tagPairStatistics) Less(i, j int) bool {
+	if pairStats[i].Files != pairStats[j].Files {
+		return pairStats[i].Files > pairStats[j].Files
+	}
+	if pairStats[i].Tags[0] != pairStats[j].Tags[0] {
+		return pairStats[i].Tags[0] < pairStats[j].Tags[0]
+	}
+
+	return pairStats[i].Tags[1] < pairStats[j].Tags[1]
+}
+
+func (pairStats tagPairStatistics) Swap(i, j int) {
+	pairStats[i], pairStats[j] = pairStats[j], pairStats[i]
+}
+
+type histogramBuckets []HistogramBucket
+
+func (buckets histogramBuckets) Len() int {
+	return len(buckets)
+}
+
+func (buckets histogramBuckets) Less(i, j int) bool {
+	return buckets[i].Min < buckets[j].Min
+}
+
+func (buckets histogramBuckets) Swap(i, j int) {
+	buckets[i], buckets[j] = buckets[j], buckets[i]
+}
+
+type directoryCoverages []DirectoryCoverage
+
+func (coverages directoryCoverages) Len() int {
+	return len(coverages)
+}
+
+func (coverages directoryCoverages) Less(i, j int) bool {
+	if coverages[i].Ratio != coverages[j].Ratio {
+		return coverages[i].Ratio > coverages[j].Ratio
+	}
+
+	return coverages[i].Path < coverages[j].Path
+}
+
+func (coverages directoryCoverages) Swap(i, j int) {
+	coverages[i], coverages[j] = coverages[j], coverages[i]
+}
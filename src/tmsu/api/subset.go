@@ -0,0 +1,296 @@
+// Copyright 2011-2015 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package api
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"tmsu/entities"
+	"tmsu/storage"
+)
+
+type SubsetOptions struct {
+	PruneUnusedTags bool // copy only the tags and values the files are tagged with
+}
+
+// Writes a new database at the specified path containing only the specified
+// files, their explicit tags and notes, along with the tags, values,
+// implications and settings of the database. If the path ends '.txt' a text
+// dump of the new database is written instead, as read by 'tmsu rebuild'.
+func Subset(store *storage.Storage, tx *storage.Tx, files entities.Files, outputPath string, options SubsetOptions) error {
+	if _, err := os.Stat(outputPath); err == nil {
+		return fmt.Errorf("%v: already exists", outputPath)
+	}
+
+	if !strings.HasSuffix(outputPath, ".txt") {
+		return writeSubset(store, tx, files, outputPath, options)
+	}
+
+	tempDir, err := ioutil.TempDir("", "tmsu-subset")
+	if err != nil {
+		return fmt.Errorf("could not create temporary directory: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	dbPath := filepath.Join(tempDir, "db")
+	if err := writeSubset(store, tx, files, dbPath, options); err != nil {
+		return err
+	}
+
+	subset, err := storage.OpenAt(dbPath)
+	if err != nil {
+		return err
+	}
+	defer subset.Close()
+
+	subsetTx, err := subset.Begin()
+	if err != nil {
+		return err
+	}
+	defer subsetTx.Commit()
+
+	if err := subset.WriteText(subsetTx, outputPath); err != nil {
+		return fmt.Errorf("%v: could not write text database: %v", outputPath, err)
+	}
+
+	return nil
+}
+
+// unexported
+
+func writeSubset(store *storage.Storage, tx *storage.Tx, files entities.Files, dbPath string, options SubsetOptions) error {
+	subset, err := storage.OpenAt(dbPath)
+	if err != nil {
+		return err
+	}
+	defer subset.Close()
+
+	subsetTx, err := subset.Begin()
+	if err != nil {
+		return err
+	}
+
+	if err := copySubset(store, tx, files, subset, subsetTx, options); err != nil {
+		subsetTx.Rollback()
+		os.Remove(dbPath)
+		return err
+	}
+
+	return subsetTx.Commit()
+}
+
+func copySubset(store *storage.Storage, tx *storage.Tx, files entities.Files, subset *storage.Storage, subsetTx *storage.Tx, options SubsetOptions) error {
+	readOnly, err := copySettings(store, tx, subset, subsetTx)
+	if err != nil {
+		return err
+	}
+
+	fileTagsByFileId := make(map[entities.FileId]entities.FileTags, len(files))
+	for _, file := range files {
+		fileTags, err := store.FileTagsByFileId(tx, file.Id, true)
+		if err != nil {
+			return fmt.Errorf("%v: could not retrieve file-tags: %v", file.Path(), err)
+		}
+
+		fileTagsByFileId[file.Id] = fileTags
+	}
+
+	tags, values, implications, err := subsetTags(store, tx, fileTagsByFileId, options)
+	if err != nil {
+		return err
+	}
+
+	tagIds := make(map[entities.TagId]entities.TagId, len(tags))
+	for _, tag := range tags {
+		subsetTag, err := subset.AddTag(subsetTx, tag.Name)
+		if err != nil {
+			return fmt.Errorf("could not create tag '%v': %v", tag.Name, err)
+		}
+
+		tagIds[tag.Id] = subsetTag.Id
+	}
+
+	valueIds := map[entities.ValueId]entities.ValueId{0: 0}
+	for _, value := range values {
+		subsetValue, err := subset.AddValue(subsetTx, value.Name)
+		if err != nil {
+			return fmt.Errorf("could not create value '%v': %v", value.Name, err)
+		}
+
+		valueIds[value.Id] = subsetValue.Id
+	}
+
+	for _, implication := range implications {
+		if err := subset.AddImplication(subsetTx, tagIds[implication.ImplyingTag.Id], tagIds[implication.ImpliedTag.Id]); err != nil {
+			return fmt.Errorf("could not add implication '%v' -> '%v': %v", implication.ImplyingTag.Name, implication.ImpliedTag.Name, err)
+		}
+	}
+
+	for _, file := range files {
+		if err := copySubsetFile(store, tx, file, fileTagsByFileId[file.Id], subset, subsetTx, tagIds, valueIds); err != nil {
+			return err
+		}
+	}
+
+	if readOnly {
+		if _, err := subset.UpdateSetting(subsetTx, "readOnly", "yes"); err != nil {
+			return fmt.Errorf("could not copy setting 'readOnly': %v", err)
+		}
+	}
+
+	return nil
+}
+
+// Copies the settings that differ from the new database's defaults, but not
+// internal ones such as the database's identifier, nor readOnly which is
+// reported so that it can be applied once the subset is complete.
+func copySettings(store *storage.Storage, tx *storage.Tx, subset *storage.Storage, subsetTx *storage.Tx) (bool, error) {
+	settings, err := store.Settings(tx)
+	if err != nil {
+		return false, fmt.Errorf("could not retrieve settings: %v", err)
+	}
+
+	subsetSettings, err := subset.Settings(subsetTx)
+	if err != nil {
+		return false, fmt.Errorf("could not retrieve settings: %v", err)
+	}
+
+	readOnly := false
+	for _, setting := range settings {
+		if setting.Name == "readOnly" {
+			readOnly = settings.ReadOnly()
+			continue
+		}
+		if !subsetSettings.ContainsName(setting.Name) || subsetSettings.Value(setting.Name) == setting.Value {
+			continue
+		}
+
+		if _, err := subset.UpdateSetting(subsetTx, setting.Name, setting.Value); err != nil {
+			return false, fmt.Errorf("could not copy setting '%v': %v", setting.Name, err)
+		}
+	}
+
+	return readOnly, nil
+}
+
+// The tags, values and implications to copy: all of them or, if pruning, only
+// those the files are tagged with along with the tags these imply.
+func subsetTags(store *storage.Storage, tx *storage.Tx, fileTagsByFileId map[entities.FileId]entities.FileTags, options SubsetOptions) (entities.Tags, entities.Values, entities.Implications, error) {
+	tags, err := store.Tags(tx)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("could not retrieve tags: %v", err)
+	}
+
+	values, err := store.Values(tx)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("could not retrieve values: %v", err)
+	}
+
+	if !options.PruneUnusedTags {
+		implications, err := store.Implications(tx)
+		if err != nil {
+			return nil, nil, nil, fmt.Errorf("could not retrieve implications: %v", err)
+		}
+
+		return tags, values, implications, nil
+	}
+
+	usedTagIds := make(map[entities.TagId]bool)
+	usedValueIds := make(map[entities.ValueId]bool)
+	tagIds := make(entities.TagIds, 0)
+	for _, fileTags := range fileTagsByFileId {
+		for _, fileTag := range fileTags {
+			if !usedTagIds[fileTag.TagId] {
+				usedTagIds[fileTag.TagId] = true
+				tagIds = append(tagIds, fileTag.TagId)
+			}
+			usedValueIds[fileTag.ValueId] = true
+		}
+	}
+
+	implications, err := store.ImplicationsForTags(tx, tagIds...)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("could not retrieve implications: %v", err)
+	}
+
+	for _, implication := range implications {
+		usedTagIds[implication.ImpliedTag.Id] = true
+	}
+
+	usedTags := make(entities.Tags, 0, len(usedTagIds))
+	for _, tag := range tags {
+		if usedTagIds[tag.Id] {
+			usedTags = append(usedTags, tag)
+		}
+	}
+
+	usedValues := make(entities.Values, 0, len(usedValueIds))
+	for _, value := range values {
+		if usedValueIds[value.Id] {
+			usedValues = append(usedValues, value)
+		}
+	}
+
+	return usedTags, usedValues, implications, nil
+}
+
+func copySubsetFile(store *storage.Storage, tx *storage.Tx, file *entities.File, fileTags entities.FileTags, subset *storage.Storage, subsetTx *storage.Tx, tagIds map[entities.TagId]entities.TagId, valueIds map[entities.ValueId]entities.ValueId) error {
+	subsetFile, err := subset.AddFile(subsetTx, file.Path(), file.Fingerprint, file.ModTime, file.Size, file.IsDir)
+	if err != nil {
+		return fmt.Errorf("%v: could not add file: %v", file.Path(), err)
+	}
+
+	for _, fileTag := range fileTags {
+		if _, err := subset.AddFileTag(subsetTx, subsetFile.Id, tagIds[fileTag.TagId], valueIds[fileTag.ValueId]); err != nil {
+			return fmt.Errorf("%v: could not add tag: %v", file.Path(), err)
+		}
+	}
+
+	pathOnly, err := store.FilePathOnly(tx, file.Id)
+	if err != nil {
+		return fmt.Errorf("%v: could not retrieve file: %v", file.Path(), err)
+	}
+	if pathOnly {
+		if err := subset.UpdateFilePathOnly(subsetTx, subsetFile.Id, true); err != nil {
+			return fmt.Errorf("%v: could not update file: %v", file.Path(), err)
+		}
+	}
+
+	virtual, err := store.FileVirtual(tx, file.Id)
+	if err != nil {
+		return fmt.Errorf("%v: could not retrieve file: %v", file.Path(), err)
+	}
+	if virtual {
+		if err := subset.UpdateFileVirtual(subsetTx, subsetFile.Id, true); err != nil {
+			return fmt.Errorf("%v: could not update file: %v", file.Path(), err)
+		}
+	}
+
+	note, err := store.FileNote(tx, file.Id)
+	if err != nil {
+		return fmt.Errorf("%v: could not retrieve note: %v", file.Path(), err)
+	}
+	if note != "" {
+		if err := subset.UpdateFileNote(subsetTx, subsetFile.Id, note); err != nil {
+			return fmt.Errorf("%v: could not copy note: %v", file.Path(), err)
+		}
+	}
+
+	return nil
+}
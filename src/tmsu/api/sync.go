@@ -0,0 +1,369 @@
+// Copyright 2011-2015 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package api
+
+import (
+	"fmt"
+	"time"
+	"tmsu/common/fingerprint"
+	"tmsu/entities"
+	"tmsu/storage"
+)
+
+// A tag applied to or removed from a file, as exchanged when synchronising.
+type Change struct {
+	Path        string
+	Fingerprint string
+	Tag         string
+	Value       string
+	Tagged      bool // whether the tag was applied rather than removed
+	Username    string
+	Time        time.Time
+}
+
+func (change Change) String() string {
+	sign := "-"
+	if change.Tagged {
+		sign = "+"
+	}
+
+	return fmt.Sprintf("%v: %v%v", change.Path, sign, TagValue{change.Tag, change.Value})
+}
+
+// The changes made to a database since a point in time.
+type ChangeSet struct {
+	Changes []Change
+	Until   time.Time // time of the latest change, by the database's clock
+}
+
+// The outcome of applying changes to a database.
+type ApplyResult struct {
+	Unmatched []Change  // changes for files the database does not have
+	Until     time.Time // time after the changes were applied, by the database's clock
+}
+
+// A database that can be synchronised with.
+type Replica interface {
+	DatabaseId() (string, error)
+	Changes(since time.Time) (ChangeSet, error)
+	Apply(changes []Change) (ApplyResult, error)
+}
+
+// Conflicting changes made to the same tagging in both databases.
+type SyncConflict struct {
+	Local  Change
+	Remote Change
+	Kept   Change // the later change, which is applied to both databases
+}
+
+type SyncResult struct {
+	Sent            []Change       // local changes applied to the remote database
+	Received        []Change       // remote changes applied to the local database
+	Conflicts       []SyncConflict // changes made in both databases
+	UnmatchedLocal  []Change       // remote changes for files not in the local database
+	UnmatchedRemote []Change       // local changes for files not in the remote database
+}
+
+// The unique identifier of the database.
+func (db *Database) DatabaseId() (string, error) {
+	var id string
+
+	err := db.update("sync", nil, func(tx *storage.Tx) error {
+		var err error
+		id, err = db.store.DatabaseId(tx)
+		return err
+	})
+
+	return id, err
+}
+
+// Retrieves the tags applied to and removed from files since the specified
+// time.
+func (db *Database) Changes(since time.Time) (ChangeSet, error) {
+	changeSet := ChangeSet{[]Change{}, since}
+
+	err := db.view(func(tx *storage.Tx) error {
+		events, err := db.store.FileTagEventsSince(tx, since)
+		if err != nil {
+			return fmt.Errorf("could not retrieve tag history: %v", err)
+		}
+
+		for _, event := range events {
+			change := Change{event.Path(), string(event.Fingerprint), event.TagName, event.ValueName, event.Tagged, event.Username, event.Time}
+			changeSet.Changes = append(changeSet.Changes, change)
+
+			if event.Time.After(changeSet.Until) {
+				changeSet.Until = event.Time
+			}
+		}
+
+		return nil
+	})
+
+	return changeSet, err
+}
+
+// Applies changes made to another database. Files are matched by fingerprint
+// or, for those without a fingerprint, by path.
+func (db *Database) Apply(changes []Change) (ApplyResult, error) {
+	result := ApplyResult{Unmatched: []Change{}}
+
+	err := db.update("sync", nil, func(tx *storage.Tx) error {
+		username := db.store.Username
+		defer func() { db.store.Username = username }()
+
+		for _, change := range changes {
+			files, err := matchingFiles(db.store, tx, change)
+			if err != nil {
+				return err
+			}
+			if len(files) == 0 {
+				result.Unmatched = append(result.Unmatched, change)
+				continue
+			}
+
+			db.store.Username = change.Username
+
+			if err := applyChange(db.store, tx, change, files); err != nil {
+				return fmt.Errorf("%v: %v", change, err)
+			}
+		}
+
+		result.Until = time.Now()
+		return nil
+	})
+
+	return result, err
+}
+
+// Exchanges the changes made since the last synchronisation between the local
+// and remote databases. Where the same tagging was changed differently in
+// both, the later change wins. If pretend is set then the changes are
+// determined but not applied.
+func Sync(local *Database, remote Replica, pretend bool) (*SyncResult, error) {
+	localId, err := local.DatabaseId()
+	if err != nil {
+		return nil, fmt.Errorf("could not identify local database: %v", err)
+	}
+
+	remoteId, err := remote.DatabaseId()
+	if err != nil {
+		return nil, fmt.Errorf("could not identify remote database: %v", err)
+	}
+
+	if localId == remoteId {
+		return nil, fmt.Errorf("cannot synchronise a database with itself")
+	}
+
+	var peer *entities.SyncPeer
+	err = local.view(func(tx *storage.Tx) error {
+		var err error
+		peer, err = local.store.SyncPeer(tx, remoteId)
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("could not retrieve synchronisation state: %v", err)
+	}
+
+	localChanges, err := local.Changes(peer.SentUntil)
+	if err != nil {
+		return nil, err
+	}
+
+	remoteChanges, err := remote.Changes(peer.ReceivedUntil)
+	if err != nil {
+		return nil, fmt.Errorf("could not retrieve remote changes: %v", err)
+	}
+
+	result := reconcile(localChanges.Changes, remoteChanges.Changes)
+	if pretend {
+		return result, nil
+	}
+
+	remoteApplied, err := remote.Apply(result.Sent)
+	if err != nil {
+		return nil, fmt.Errorf("could not apply changes to remote database: %v", err)
+	}
+	result.UnmatchedRemote = remoteApplied.Unmatched
+
+	localApplied, err := local.Apply(result.Received)
+	if err != nil {
+		return nil, fmt.Errorf("could not apply remote changes: %v", err)
+	}
+	result.UnmatchedLocal = localApplied.Unmatched
+
+	// skip the changes just applied so they are not sent back next time
+	peer.SentUntil = later(localChanges.Until, localApplied.Until)
+	peer.ReceivedUntil = later(remoteChanges.Until, remoteApplied.Until)
+
+	err = local.update("sync", nil, func(tx *storage.Tx) error {
+		return local.store.UpdateSyncPeer(tx, *peer)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("could not record synchronisation state: %v", err)
+	}
+
+	return result, nil
+}
+
+// unexported
+
+// Determines which changes must be sent and received, collapsing multiple
+// changes to the same tagging to the latest and resolving conflicts.
+func reconcile(localChanges, remoteChanges []Change) *SyncResult {
+	result := &SyncResult{Sent: []Change{}, Received: []Change{}, Conflicts: []SyncConflict{}}
+
+	localLatest := latestChanges(localChanges)
+	remoteLatest := latestChanges(remoteChanges)
+
+	for _, localChange := range localChanges {
+		key := changeKey(localChange)
+		if localLatest[key] != localChange {
+			continue
+		}
+
+		remoteChange, changedRemotely := remoteLatest[key]
+		switch {
+		case !changedRemotely:
+			result.Sent = append(result.Sent, localChange)
+		case remoteChange.Tagged == localChange.Tagged:
+			// same change in both
+		default:
+			conflict := SyncConflict{localChange, remoteChange, localChange}
+			if remoteChange.Time.After(localChange.Time) {
+				conflict.Kept = remoteChange
+				result.Received = append(result.Received, remoteChange)
+			} else {
+				result.Sent = append(result.Sent, localChange)
+			}
+
+			result.Conflicts = append(result.Conflicts, conflict)
+		}
+	}
+
+	for _, remoteChange := range remoteChanges {
+		key := changeKey(remoteChange)
+		if remoteLatest[key] != remoteChange {
+			continue
+		}
+
+		if _, changedLocally := localLatest[key]; !changedLocally {
+			result.Received = append(result.Received, remoteChange)
+		}
+	}
+
+	return result
+}
+
+func latestChanges(changes []Change) map[string]Change {
+	latest := make(map[string]Change, len(changes))
+	for _, change := range changes {
+		latest[changeKey(change)] = change
+	}
+
+	return latest
+}
+
+// Identifies the tagging a change applies to.
+func changeKey(change Change) string {
+	file := change.Fingerprint
+	if file == "" {
+		file = "path:" + change.Path
+	}
+
+	return file + "\x00" + change.Tag + "\x00" + change.Value
+}
+
+func matchingFiles(store *storage.Storage, tx *storage.Tx, change Change) (entities.Files, error) {
+	if change.Fingerprint == "" {
+		file, err := store.FileByPath(tx, change.Path)
+		if err != nil {
+			return nil, fmt.Errorf("%v: could not retrieve file: %v", change.Path, err)
+		}
+		if file == nil {
+			return entities.Files{}, nil
+		}
+
+		return entities.Files{file}, nil
+	}
+
+	files, err := store.FilesByFingerprint(tx, fingerprint.Fingerprint(change.Fingerprint))
+	if err != nil {
+		return nil, fmt.Errorf("%v: could not retrieve files by fingerprint: %v", change.Path, err)
+	}
+
+	return files, nil
+}
+
+func applyChange(store *storage.Storage, tx *storage.Tx, change Change, files entities.Files) error {
+	tag, err := store.TagByName(tx, change.Tag)
+	if err != nil {
+		return err
+	}
+	if tag == nil {
+		if !change.Tagged {
+			return nil
+		}
+
+		if tag, err = store.AddTag(tx, change.Tag); err != nil {
+			return err
+		}
+	}
+
+	value, err := store.ValueByName(tx, change.Value)
+	if err != nil {
+		return err
+	}
+	if value == nil {
+		if !change.Tagged {
+			return nil
+		}
+
+		if value, err = store.AddValue(tx, change.Value); err != nil {
+			return err
+		}
+	}
+
+	for _, file := range files {
+		if change.Tagged {
+			if _, err := store.AddFileTag(tx, file.Id, tag.Id, value.Id); err != nil {
+				return err
+			}
+
+			continue
+		}
+
+		exists, err := store.FileTagExists(tx, file.Id, tag.Id, value.Id, true)
+		if err != nil {
+			return err
+		}
+		if exists {
+			if err := store.DeleteFileTag(tx, file.Id, tag.Id, value.Id); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func later(a, b time.Time) time.Time {
+	if b.After(a) {
+		return b
+	}
+
+	return a
+}
@@ -0,0 +1,572 @@
+// Copyright 2011-2015 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package api
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+	"tmsu/common/fingerprint"
+	"tmsu/common/log"
+	_path "tmsu/common/path"
+	"tmsu/entities"
+	"tmsu/storage"
+)
+
+// A tag name with an optional value name.
+type TagValue struct {
+	Tag   string
+	Value string
+}
+
+// Parses the TAG[=VALUE] syntax.
+func ParseTagValue(text string) TagValue {
+	index := strings.Index(text, "=")
+
+	switch index {
+	case -1, 0:
+		return TagValue{text, ""}
+	default:
+		return TagValue{text[0:index], text[index+1 : len(text)]}
+	}
+}
+
+func (tagValue TagValue) String() string {
+	if tagValue.Value == "" {
+		return tagValue.Tag
+	}
+
+	return tagValue.Tag + "=" + tagValue.Value
+}
+
+type TagValuePair = entities.TagValuePair
+
+type TagOptions struct {
+	Explicit  bool              // apply tags even if they are already implied
+	Recursive bool              // also tag the contents of directories
+	Force     bool              // tag paths that do not exist or cannot be accessed, tracking them as virtual
+	Inherit   bool              // copy tags to new files from their tagged duplicates
+	PathOnly  bool              // track the files by path only, without fingerprinting them
+	Until     time.Time         // remove the tags once this time has passed, unless zero
+	Queue     bool              // queue the tags of paths that cannot be accessed until they can be
+	Visited   func(path string) // called for each path as it is tagged
+	Warning   func()            // called before a warning is logged
+}
+
+// Tags the files at the specified paths, creating tags and values where the
+// settings allow.
+func (db *Database) Tag(paths []string, tagValues []TagValue, options TagOptions) error {
+	return db.update("tag", auditArgs(paths, tagValues), func(tx *storage.Tx) error {
+		settings, err := db.store.Settings(tx)
+		if err != nil {
+			return err
+		}
+
+		pairs, err := ResolveTagValues(db.store, tx, tagValues, settings.AutoCreateTags(), settings.AutoCreateValues())
+		if err != nil {
+			return err
+		}
+
+		for _, path := range paths {
+			if err := TagPath(db.store, tx, path, pairs, settings, options); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+// Looks up the identifiers of the specified tags and values, optionally
+// creating those that do not exist.
+func ResolveTagValues(store *storage.Storage, tx *storage.Tx, tagValues []TagValue, createTags, createValues bool) ([]TagValuePair, error) {
+	pairs := make([]TagValuePair, 0, len(tagValues))
+
+	for _, tagValue := range tagValues {
+		tag, err := store.TagByName(tx, tagValue.Tag)
+		if err != nil {
+			return nil, err
+		}
+		if tag == nil {
+			if !createTags {
+				return nil, NoSuchTagError{tagValue.Tag}
+			}
+
+			tag, err = store.AddTag(tx, tagValue.Tag)
+			if err != nil {
+				return nil, fmt.Errorf("could not create tag '%v': %v", tagValue.Tag, err)
+			}
+		}
+
+		value, err := store.ValueByName(tx, tagValue.Value)
+		if err != nil {
+			return nil, err
+		}
+		if value == nil {
+			if !createValues {
+				return nil, NoSuchValueError{tagValue.Value}
+			}
+
+			value, err = store.AddValue(tx, tagValue.Value)
+			if err != nil {
+				return nil, fmt.Errorf("could not create value '%v': %v", tagValue.Value, err)
+			}
+		}
+
+		pairs = append(pairs, TagValuePair{TagId: tag.Id, ValueId: value.Id})
+	}
+
+	return pairs, nil
+}
+
+// Applies the tag value pairs to the file at the specified path, adding the
+// file to the database if necessary. Tags that are mutually exclusive with
+// those applied are removed from the file.
+func TagPath(store *storage.Storage, tx *storage.Tx, path string, pairs []TagValuePair, settings entities.Settings, options TagOptions) error {
+	absPath, err := _path.Abs(path)
+	if err != nil {
+		return fmt.Errorf("%v: could not get absolute path: %v", path, err)
+	}
+
+	exclusions, err := store.Exclusions(tx)
+	if err != nil {
+		return fmt.Errorf("could not retrieve exclusions: %v", err)
+	}
+
+	if err := checkExclusiveTags(store, tx, exclusions, pairs); err != nil {
+		return err
+	}
+
+	missing, isURL := false, _path.IsURL(absPath)
+
+	var stat os.FileInfo = emptyStat{}
+	if !isURL {
+		stat, err = os.Stat(absPath)
+	}
+	if err != nil {
+		switch {
+		case os.IsNotExist(err), os.IsPermission(err):
+			if options.Queue {
+				return queueTags(store, tx, absPath, pairs)
+			}
+
+			if !options.Force {
+				return err
+			} else {
+				stat, missing = emptyStat{}, os.IsNotExist(err)
+			}
+		default:
+			return err
+		}
+	}
+
+	if options.Visited != nil {
+		options.Visited(path)
+	}
+
+	log.Infof(2, "%v: checking if file exists", path)
+
+	file, err := store.FileByPath(tx, absPath)
+	if err != nil {
+		return fmt.Errorf("%v: could not retrieve file: %v", path, err)
+	}
+	if file == nil {
+		pathOnly := options.PathOnly || storage.MatchesPathOnlyFiles(settings, absPath)
+
+		file, err = addFile(store, tx, absPath, stat.ModTime(), uint(stat.Size()), stat.IsDir(), pathOnly, missing, settings.FileFingerprintAlgorithm(), settings.DirectoryFingerprintAlgorithm())
+		if err != nil {
+			return fmt.Errorf("%v: could not add file: %v", path, err)
+		}
+
+		if options.Inherit || settings.InheritDupeTags() {
+			if err := inheritDupeTags(store, tx, file); err != nil {
+				return err
+			}
+		}
+
+		if indexer := NewContentIndexer(settings); indexer != nil && !missing && !isURL {
+			// the file is tagged regardless: it can be indexed again with 'tmsu index'
+			if err := IndexFileContent(store, tx, indexer, file); err != nil {
+				if options.Warning != nil {
+					options.Warning()
+				}
+				log.Warnf("%v", err)
+			}
+		}
+	} else if !missing {
+		if options.PathOnly {
+			if err := trackByPathOnly(store, tx, file, stat); err != nil {
+				return fmt.Errorf("%v: could not track file by path only: %v", path, err)
+			}
+		}
+
+		if err := trackArrival(store, tx, file, stat, settings); err != nil {
+			return fmt.Errorf("%v: could not track file: %v", path, err)
+		}
+	}
+
+	requestedPairs := pairs
+
+	if !options.Explicit {
+		pairs, err = removeAlreadyAppliedTagValuePairs(store, tx, pairs, file)
+		if err != nil {
+			return fmt.Errorf("%v: could not remove applied tags: %v", path, err)
+		}
+	}
+
+	log.Infof(2, "%v: applying tags.", path)
+
+	if _, err = store.ApplyFileTags(tx, file.Id, pairs); err != nil {
+		return fmt.Errorf("%v: could not apply tags: %v", file.Path(), err)
+	}
+
+	// only once the new tags are applied, lest the file be left untagged and removed
+	if err := removeExcludedTags(store, tx, exclusions, file, requestedPairs); err != nil {
+		return err
+	}
+
+	if !options.Until.IsZero() {
+		if err := setExpiries(store, tx, file, requestedPairs, options.Until); err != nil {
+			return err
+		}
+	}
+
+	if options.Recursive && stat.IsDir() {
+		if err = tagRecursively(store, tx, path, pairs, settings, options); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// unexported
+
+func setExpiries(store *storage.Storage, tx *storage.Tx, file *entities.File, pairs []TagValuePair, until time.Time) error {
+	for _, pair := range pairs {
+		// tags that are only implied have nothing to expire
+		exists, err := store.FileTagExists(tx, file.Id, pair.TagId, pair.ValueId, true)
+		if err != nil {
+			return fmt.Errorf("%v: could not check tag: %v", file.Path(), err)
+		}
+		if !exists {
+			continue
+		}
+
+		if err := store.SetFileTagExpiry(tx, file.Id, pair.TagId, pair.ValueId, until); err != nil {
+			return fmt.Errorf("%v: could not set expiry: %v", file.Path(), err)
+		}
+	}
+
+	return nil
+}
+
+func tagRecursively(store *storage.Storage, tx *storage.Tx, path string, pairs []TagValuePair, settings entities.Settings, options TagOptions) error {
+	osFile, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("%v: could not open path: %v", path, err)
+	}
+
+	childNames, err := osFile.Readdirnames(0)
+	osFile.Close()
+	if err != nil {
+		return fmt.Errorf("%v: could not retrieve directory contents: %v", path, err)
+	}
+
+	for _, childName := range childNames {
+		childPath := filepath.Join(path, childName)
+
+		if err = TagPath(store, tx, childPath, pairs, settings, options); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Applies the explicit tags of the files sharing a newly added file's
+// fingerprint to it.
+func inheritDupeTags(store *storage.Storage, tx *storage.Tx, file *entities.File) error {
+	if file.Fingerprint == fingerprint.Fingerprint("") {
+		return nil
+	}
+
+	log.Infof(2, "%v: identifying duplicate files", file.Path())
+
+	dupes, err := store.FilesByFingerprint(tx, file.Fingerprint)
+	if err != nil {
+		return fmt.Errorf("%v: could not identify duplicate files: %v", file.Path(), err)
+	}
+
+	for _, dupe := range dupes {
+		if dupe.Id == file.Id {
+			continue
+		}
+
+		fileTags, err := store.FileTagsByFileId(tx, dupe.Id, true)
+		if err != nil {
+			return fmt.Errorf("%v: could not retrieve file tags: %v", dupe.Path(), err)
+		}
+
+		pairs := make([]TagValuePair, len(fileTags))
+		for index, fileTag := range fileTags {
+			log.Infof(2, "%v: inheriting tag #%v from duplicate '%v'", file.Path(), fileTag.TagId, dupe.Path())
+
+			pairs[index] = TagValuePair{TagId: fileTag.TagId, ValueId: fileTag.ValueId}
+		}
+
+		if _, err := store.ApplyFileTags(tx, file.Id, pairs); err != nil {
+			return fmt.Errorf("%v: could not apply tags: %v", file.Path(), err)
+		}
+	}
+
+	return nil
+}
+
+func addFile(store *storage.Storage, tx *storage.Tx, path string, modTime time.Time, size uint, isDir, pathOnly, virtual bool, fileFingerprintAlg, dirFingerprintAlg string) (*entities.File, error) {
+	fp := fingerprint.Empty
+	if !pathOnly && !virtual {
+		log.Infof(2, "%v: creating fingerprint", path)
+
+		if _path.IsURL(path) {
+			fp = resourceFingerprint(path)
+		} else {
+			var err error
+			fp, err = store.Fingerprint(tx, path, fileFingerprintAlg, dirFingerprintAlg)
+			if err != nil {
+				return nil, fmt.Errorf("%v: could not create fingerprint: %v", path, err)
+			}
+		}
+	}
+
+	log.Infof(2, "%v: adding file.", path)
+
+	file, err := store.AddFile(tx, path, fp, modTime, int64(size), isDir)
+	if err != nil {
+		return nil, fmt.Errorf("%v: could not add file to database: %v", path, err)
+	}
+
+	if pathOnly {
+		log.Infof(2, "%v: tracking by path only", path)
+
+		if err := store.UpdateFilePathOnly(tx, file.Id, true); err != nil {
+			return nil, fmt.Errorf("%v: could not track file by path only: %v", path, err)
+		}
+	}
+
+	if virtual {
+		log.Infof(2, "%v: tracking as virtual", path)
+
+		if err := store.UpdateFileVirtual(tx, file.Id, true); err != nil {
+			return nil, fmt.Errorf("%v: could not mark file as virtual: %v", path, err)
+		}
+	}
+
+	return file, nil
+}
+
+// Starts tracking a virtual file as a real one once it exists, fingerprinting
+// it unless it is tracked by path only.
+func trackArrival(store *storage.Storage, tx *storage.Tx, file *entities.File, stat os.FileInfo, settings entities.Settings) error {
+	virtual, err := store.FileVirtual(tx, file.Id)
+	if err != nil || !virtual {
+		return err
+	}
+
+	pathOnly, err := store.FilePathOnly(tx, file.Id)
+	if err != nil {
+		return err
+	}
+
+	fp := fingerprint.Empty
+	if !pathOnly {
+		log.Infof(2, "%v: creating fingerprint", file.Path())
+
+		fp, err = store.Fingerprint(tx, file.Path(), settings.FileFingerprintAlgorithm(), settings.DirectoryFingerprintAlgorithm())
+		if err != nil {
+			return fmt.Errorf("could not create fingerprint: %v", err)
+		}
+	}
+
+	log.Infof(2, "%v: tracking as existing", file.Path())
+
+	if _, err := store.UpdateFile(tx, file.Id, file.Path(), fp, stat.ModTime(), stat.Size(), stat.IsDir()); err != nil {
+		return err
+	}
+
+	return store.UpdateFileVirtual(tx, file.Id, false)
+}
+
+// Marks an existing file as tracked by path only, discarding its fingerprint
+// as it will no longer be kept up to date.
+func trackByPathOnly(store *storage.Storage, tx *storage.Tx, file *entities.File, stat os.FileInfo) error {
+	pathOnly, err := store.FilePathOnly(tx, file.Id)
+	if err != nil || pathOnly {
+		return err
+	}
+
+	log.Infof(2, "%v: tracking by path only", file.Path())
+
+	if _, err := store.UpdateFile(tx, file.Id, file.Path(), fingerprint.Empty, stat.ModTime(), stat.Size(), stat.IsDir()); err != nil {
+		return err
+	}
+
+	return store.UpdateFilePathOnly(tx, file.Id, true)
+}
+
+// Fails if any two of the tags to apply are mutually exclusive.
+func checkExclusiveTags(store *storage.Storage, tx *storage.Tx, exclusions entities.Exclusions, pairs []TagValuePair) error {
+	if len(exclusions) == 0 {
+		return nil
+	}
+
+	for index, pair := range pairs {
+		excluded := exclusions.ExcludedBy(pair.TagId)
+
+		for _, otherPair := range pairs[index+1:] {
+			if !containsTagId(excluded, otherPair.TagId) {
+				continue
+			}
+
+			tag, err := store.Tag(tx, pair.TagId)
+			if err != nil {
+				return err
+			}
+
+			otherTag, err := store.Tag(tx, otherPair.TagId)
+			if err != nil {
+				return err
+			}
+
+			return ExclusiveTagsError{tag.Name, otherTag.Name}
+		}
+	}
+
+	return nil
+}
+
+// Removes from the file any tags that are mutually exclusive with those
+// applied.
+func removeExcludedTags(store *storage.Storage, tx *storage.Tx, exclusions entities.Exclusions, file *entities.File, pairs []TagValuePair) error {
+	if len(exclusions) == 0 {
+		return nil
+	}
+
+	excluded := make(entities.TagIds, 0, 10)
+	for _, pair := range pairs {
+		excluded = append(excluded, exclusions.ExcludedBy(pair.TagId)...)
+	}
+	if len(excluded) == 0 {
+		return nil
+	}
+
+	fileTags, err := store.FileTagsByFileId(tx, file.Id, true)
+	if err != nil {
+		return fmt.Errorf("%v: could not retrieve file tags: %v", file.Path(), err)
+	}
+
+	for _, fileTag := range fileTags {
+		if !containsTagId(excluded, fileTag.TagId) {
+			continue
+		}
+
+		log.Infof(2, "%v: removing mutually exclusive tag #%v", file.Path(), fileTag.TagId)
+
+		if err := store.DeleteFileTag(tx, file.Id, fileTag.TagId, fileTag.ValueId); err != nil {
+			return fmt.Errorf("%v: could not remove mutually exclusive tag: %v", file.Path(), err)
+		}
+	}
+
+	return nil
+}
+
+func containsTagId(tagIds entities.TagIds, tagId entities.TagId) bool {
+	for _, candidate := range tagIds {
+		if candidate == tagId {
+			return true
+		}
+	}
+
+	return false
+}
+
+func removeAlreadyAppliedTagValuePairs(store *storage.Storage, tx *storage.Tx, pairs []TagValuePair, file *entities.File) ([]TagValuePair, error) {
+	log.Infof(2, "%v: determining existing file-tags", file.Path())
+
+	existingFileTags, err := store.FileTagsByFileId(tx, file.Id, false)
+	if err != nil {
+		return nil, fmt.Errorf("%v: could not determine file's tags: %v", file.Path(), err)
+	}
+
+	log.Infof(2, "%v: determining implied tags", file.Path())
+
+	tagIds := make(entities.TagIds, len(pairs))
+	for index, pair := range pairs {
+		tagIds[index] = pair.TagId
+	}
+
+	newlyImpliedTags, err := store.ImplicationsForTags(tx, tagIds...)
+	if err != nil {
+		return nil, fmt.Errorf("%v: could not determine implied tags: %v", file.Path(), err)
+	}
+
+	log.Infof(2, "%v: revising set of tags to apply", file.Path())
+
+	revisedPairs := make([]TagValuePair, 0, len(pairs))
+	for _, pair := range pairs {
+		if existingFileTags.Contains(pair.TagId, pair.ValueId) {
+			continue
+		}
+
+		if pair.ValueId == 0 && newlyImpliedTags.Implies(pair.TagId) {
+			continue
+		}
+
+		revisedPairs = append(revisedPairs, pair)
+	}
+
+	return revisedPairs, nil
+}
+
+type emptyStat struct {
+	name string
+}
+
+func (es emptyStat) Name() string {
+	return es.name
+}
+
+func (emptyStat) Size() int64 {
+	return 0
+}
+
+func (emptyStat) Mode() os.FileMode {
+	return 0
+}
+
+func (emptyStat) ModTime() time.Time {
+	return time.Time{}
+}
+
+func (emptyStat) IsDir() bool {
+	return false
+}
+
+func (emptyStat) Sys() interface{} {
+	return nil
+}
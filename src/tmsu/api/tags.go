@@ -0,0 +1,158 @@
+// Copyright 2011-2015 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package api
+
+import (
+	"fmt"
+	"sort"
+	_path "tmsu/common/path"
+	"tmsu/entities"
+	"tmsu/storage"
+)
+
+// Retrieves the names of all of the tags.
+func (db *Database) Tags() ([]string, error) {
+	var names []string
+
+	err := db.view(func(tx *storage.Tx) error {
+		tags, err := db.store.Tags(tx)
+		if err != nil {
+			return err
+		}
+
+		names = make([]string, len(tags))
+		for index, tag := range tags {
+			names[index] = tag.Name
+		}
+
+		return nil
+	})
+
+	return names, err
+}
+
+// Retrieves the tags applied to the file at the specified path.
+func (db *Database) FileTags(path string, explicitOnly bool) ([]TagValue, error) {
+	var tagValues []TagValue
+
+	err := db.view(func(tx *storage.Tx) error {
+		absPath, err := _path.Abs(path)
+		if err != nil {
+			return fmt.Errorf("%v: could not get absolute path: %v", path, err)
+		}
+
+		file, err := db.store.FileByPath(tx, absPath)
+		if err != nil {
+			return fmt.Errorf("%v: could not retrieve file: %v", path, err)
+		}
+		if file == nil {
+			tagValues = []TagValue{}
+			return nil
+		}
+
+		tagValues, err = FileTagValues(db.store, tx, file.Id, explicitOnly)
+		return err
+	})
+
+	return tagValues, err
+}
+
+// Retrieves the names of the tags and values applied to the file.
+func FileTagValues(store *storage.Storage, tx *storage.Tx, fileId entities.FileId, explicitOnly bool) ([]TagValue, error) {
+	fileTags, err := store.FileTagsByFileId(tx, fileId, explicitOnly)
+	if err != nil {
+		return nil, fmt.Errorf("could not retrieve file-tags for file '%v': %v", fileId, err)
+	}
+
+	tagValues := make([]TagValue, len(fileTags))
+	for index, fileTag := range fileTags {
+		tag, err := store.Tag(tx, fileTag.TagId)
+		if err != nil {
+			return nil, fmt.Errorf("could not lookup tag: %v", err)
+		}
+		if tag == nil {
+			return nil, fmt.Errorf("tag '%v' does not exist", fileTag.TagId)
+		}
+
+		tagValues[index].Tag = tag.Name
+
+		if fileTag.ValueId != 0 {
+			value, err := store.Value(tx, fileTag.ValueId)
+			if err != nil {
+				return nil, fmt.Errorf("could not lookup value: %v", err)
+			}
+			if value == nil {
+				return nil, fmt.Errorf("value '%v' does not exist", fileTag.ValueId)
+			}
+
+			tagValues[index].Value = value.Name
+		}
+	}
+
+	return tagValues, nil
+}
+
+// Counts the files each tag is applied to amongst those specified. Only tags
+// applied to at least one of the files are included, ordered by name.
+func TagUsage(store *storage.Storage, tx *storage.Tx, files entities.Files, explicitOnly bool) ([]TagStatistic, error) {
+	counts := make(map[entities.TagId]uint)
+	for _, file := range files {
+		fileTags, err := store.FileTagsByFileId(tx, file.Id, explicitOnly)
+		if err != nil {
+			return nil, fmt.Errorf("could not retrieve file-tags for file '%v': %v", file.Id, err)
+		}
+
+		// a tag applied with several values counts once
+		for _, tagId := range fileTags.TagIds().Uniq() {
+			counts[tagId]++
+		}
+	}
+
+	tagIds := make(entities.TagIds, 0, len(counts))
+	for tagId := range counts {
+		tagIds = append(tagIds, tagId)
+	}
+
+	tags, err := store.TagsByIds(tx, tagIds)
+	if err != nil {
+		return nil, fmt.Errorf("could not retrieve tags: %v", err)
+	}
+
+	usage := make([]TagStatistic, len(tags))
+	for index, tag := range tags {
+		usage[index] = TagStatistic{tag.Name, counts[tag.Id]}
+	}
+
+	sort.Sort(tagStatisticsByName(usage))
+
+	return usage, nil
+}
+
+// unexported
+
+type tagStatisticsByName []TagStatistic
+
+func (tagStats tagStatisticsByName) Len() int {
+	return len(tagStats)
+}
+
+func (tagStats tagStatisticsByName) Less(i, j int) bool {
+	return tagStats[i].Name < tagStats[j].Name
+}
+
+func (tagStats tagStatisticsByName) Swap(i, j int) {
+	tagStats[i], tagStats[j] = tagStats[j], tagStats[i]
+}
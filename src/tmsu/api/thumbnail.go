@@ -0,0 +1,95 @@
+// Copyright 2011-2015 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package api
+
+import (
+	"crypto/sha1"
+	"fmt"
+	"os"
+	"path/filepath"
+	"tmsu/common/fingerprint"
+	"tmsu/common/thumbnail"
+	"tmsu/entities"
+	"tmsu/storage"
+)
+
+// The maximum width and height, in pixels, of thumbnails.
+const ThumbnailSize = 256
+
+// Retrieves the path of the cached thumbnail for the file at the specified
+// path, creating it if necessary.
+func (db *Database) Thumbnail(path string) (string, error) {
+	var file *entities.File
+
+	err := db.view(func(tx *storage.Tx) error {
+		absPath, err := filepath.Abs(path)
+		if err != nil {
+			return fmt.Errorf("%v: could not get absolute path: %v", path, err)
+		}
+
+		file, err = db.store.FileByPath(tx, absPath)
+		if err != nil {
+			return fmt.Errorf("%v: could not retrieve file: %v", path, err)
+		}
+		if file == nil {
+			return FileNotTaggedError{path}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return Thumbnail(db.store, file)
+}
+
+// The directory thumbnails are cached in: 'thumbs' alongside the database.
+func ThumbnailDir(store *storage.Storage) string {
+	return filepath.Join(filepath.Dir(store.DbPath), "thumbs")
+}
+
+// Retrieves the path of the file's cached thumbnail, creating the thumbnail if
+// it is not yet cached. Thumbnails are keyed by fingerprint so are shared by
+// duplicate files and superseded when a file's contents change.
+func Thumbnail(store *storage.Storage, file *entities.File) (string, error) {
+	if file.IsDir || !thumbnail.Supported(file.Path()) {
+		return "", NoThumbnailError{file.Path()}
+	}
+	if file.Fingerprint == fingerprint.Empty {
+		return "", fmt.Errorf("%v: cannot cache thumbnail: file has no fingerprint", file.Path())
+	}
+
+	// hashed as some fingerprints, e.g. symlink targets, are not valid names
+	dir := ThumbnailDir(store)
+	path := filepath.Join(dir, fmt.Sprintf("%x.png", sha1.Sum([]byte(file.Fingerprint))))
+
+	if _, err := os.Stat(path); err == nil {
+		return path, nil
+	} else if !os.IsNotExist(err) {
+		return "", fmt.Errorf("%v: could not stat cached thumbnail: %v", file.Path(), err)
+	}
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", fmt.Errorf("could not create thumbnail directory: %v", err)
+	}
+
+	if err := thumbnail.Create(file.Path(), path, ThumbnailSize); err != nil {
+		return "", fmt.Errorf("%v: could not create thumbnail: %v", file.Path(), err)
+	}
+
+	return path, nil
+}
@@ -0,0 +1,121 @@
+// Copyright 2011-2015 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package api
+
+import (
+	"fmt"
+	_path "tmsu/common/path"
+	"tmsu/entities"
+	"tmsu/storage"
+)
+
+// Removes tags from the files at the specified paths and, if recursive, from
+// the files beneath them.
+func (db *Database) Untag(paths []string, tagValues []TagValue, recursive bool) error {
+	return db.update("untag", auditArgs(paths, tagValues), func(tx *storage.Tx) error {
+		files, err := FilesByPaths(db.store, tx, paths, recursive)
+		if err != nil {
+			return err
+		}
+
+		for _, tagValue := range tagValues {
+			tag, err := db.store.TagByName(tx, tagValue.Tag)
+			if err != nil {
+				return err
+			}
+			if tag == nil {
+				return NoSuchTagError{tagValue.Tag}
+			}
+
+			value, err := db.store.ValueByName(tx, tagValue.Value)
+			if err != nil {
+				return err
+			}
+			if value == nil {
+				return NoSuchValueError{tagValue.Value}
+			}
+
+			for _, file := range files {
+				if err := UntagFile(db.store, tx, file, tag, value); err != nil {
+					return err
+				}
+			}
+		}
+
+		return nil
+	})
+}
+
+// Retrieves the files at the specified paths and, if recursive, the files
+// beneath them.
+func FilesByPaths(store *storage.Storage, tx *storage.Tx, paths []string, recursive bool) (entities.Files, error) {
+	files := make(entities.Files, 0, len(paths))
+
+	for _, path := range paths {
+		absPath, err := _path.Abs(path)
+		if err != nil {
+			return nil, fmt.Errorf("%v: could not get absolute path: %v", path, err)
+		}
+
+		file, err := store.FileByPath(tx, absPath)
+		if err != nil {
+			return nil, fmt.Errorf("%v: could not retrieve file: %v", path, err)
+		}
+		if file == nil {
+			return nil, FileNotTaggedError{path}
+		}
+
+		files = append(files, file)
+
+		if recursive {
+			childFiles, err := store.FilesByDirectory(tx, file.Path())
+			if err != nil {
+				return nil, fmt.Errorf("%v: could not retrieve files for directory: %v", file.Path(), err)
+			}
+
+			files = append(files, childFiles...)
+		}
+	}
+
+	return files, nil
+}
+
+// Removes a tag from a file.
+func UntagFile(store *storage.Storage, tx *storage.Tx, file *entities.File, tag *entities.Tag, value *entities.Value) error {
+	err := store.DeleteFileTag(tx, file.Id, tag.Id, value.Id)
+	if err == nil {
+		return nil
+	}
+
+	if _, ok := err.(storage.FileTagDoesNotExist); !ok {
+		return fmt.Errorf("%v: could not remove tag '%v', value '%v': %v", file.Path(), tag.Name, value.Name, err)
+	}
+
+	tagValue := TagValue{tag.Name, value.Name}
+	if value.Id == 0 {
+		tagValue.Value = ""
+	}
+
+	exists, err := store.FileTagExists(tx, file.Id, tag.Id, value.Id, false)
+	if err != nil {
+		return fmt.Errorf("could not check if tag exists: %v", err)
+	}
+	if exists {
+		return TagImpliedError{file.Path(), tagValue}
+	}
+
+	return TagNotAppliedError{file.Path(), tagValue}
+}
@@ -0,0 +1,120 @@
+// Copyright 2011-2015 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package cli
+
+import (
+	"fmt"
+	"strings"
+	"tmsu/common/text"
+	"tmsu/storage"
+)
+
+// unexported
+
+// Expands a user-defined alias used in place of the command name into the
+// command, options and arguments it stands for. An alias may expand to another
+// alias but cannot override a built-in command.
+func expandAliases(args []string, aliases []storage.Alias, commands []*Command, options Options) ([]string, error) {
+	index := commandNameIndex(args, options)
+	if index == -1 {
+		return args, nil
+	}
+
+	expanded := make(map[string]bool)
+	for {
+		name := args[index]
+		if findCommand(commands, name) != nil {
+			return args, nil
+		}
+
+		alias := findAlias(aliases, name)
+		if alias == nil {
+			return args, nil
+		}
+		if expanded[name] {
+			return nil, fmt.Errorf("alias '%v' expands to itself", name)
+		}
+		expanded[name] = true
+
+		expansion := text.Tokenize(alias.Expansion)
+		if len(expansion) == 0 {
+			return nil, fmt.Errorf("alias '%v' is empty", name)
+		}
+
+		newArgs := make([]string, 0, len(args)+len(expansion)-1)
+		newArgs = append(newArgs, args[:index]...)
+		newArgs = append(newArgs, expansion...)
+		newArgs = append(newArgs, args[index+1:]...)
+		args = newArgs
+
+		// the expansion may itself start with options
+		offset := commandNameIndex(expansion, options)
+		if offset == -1 {
+			return args, nil
+		}
+		index += offset
+	}
+}
+
+func findAlias(aliases []storage.Alias, name string) *storage.Alias {
+	for index := range aliases {
+		if aliases[index].Name == name {
+			return &aliases[index]
+		}
+	}
+
+	return nil
+}
+
+// The index of the command name within the arguments, skipping any leading
+// options and their arguments, or -1 if there is none.
+func commandNameIndex(args []string, options Options) int {
+	for index := 0; index < len(args); index++ {
+		arg := args[index]
+
+		switch {
+		case arg == "--":
+			if index+1 < len(args) {
+				return index + 1
+			}
+
+			return -1
+		case strings.HasPrefix(arg, "--"):
+			if strings.Contains(arg, "=") {
+				continue
+			}
+
+			if option := lookupOption(options, arg); option != nil && option.HasArgument {
+				index++
+			}
+		case len(arg) > 1 && arg[0] == '-':
+			for position := 1; position < len(arg); position++ {
+				option := lookupOption(options, "-"+arg[position:position+1])
+				if option != nil && option.HasArgument {
+					if position == len(arg)-1 {
+						index++
+					}
+
+					break
+				}
+			}
+		default:
+			return index
+		}
+	}
+
+	return -1
+}
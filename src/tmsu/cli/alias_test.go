@@ -0,0 +1,86 @@
+// Copyright 2011-2015 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package cli
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"tmsu/storage"
+)
+
+func TestExpandAliases(test *testing.T) {
+	// set-up
+
+	configHome := filepath.Join(os.TempDir(), "tmsu_test_alias")
+	defer os.RemoveAll(configHome)
+
+	previous := os.Getenv("XDG_CONFIG_HOME")
+	os.Setenv("XDG_CONFIG_HOME", configHome)
+	defer os.Setenv("XDG_CONFIG_HOME", previous)
+
+	if err := os.MkdirAll(filepath.Join(configHome, "tmsu"), 0755); err != nil {
+		test.Fatal(err)
+	}
+
+	config := "color=never\nalias t = tag --tags\nalias tm = t \"music genre=rock\"\nalias loop = loop\nalias files = tags\n"
+	if err := ioutil.WriteFile(storage.GlobalConfigPath(), []byte(config), 0644); err != nil {
+		test.Fatal(err)
+	}
+
+	aliases, err := storage.GlobalAliases()
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	settings, err := storage.GlobalSettings()
+	if err != nil {
+		test.Fatal(err)
+	}
+	if len(settings) != 1 || settings[0].Name != "color" {
+		test.Fatalf("Expected only the 'color' setting but were %v.", len(settings))
+	}
+
+	commands := []*Command{&TagCommand, &TagsCommand, &FilesCommand}
+
+	// test
+
+	expanded, err := expandAliases([]string{"-v", "--database", "x.db", "tm", "a.mp3"}, aliases, commands, globalOptions)
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	// validate
+
+	expected := "-v --database x.db tag --tags music genre=rock a.mp3"
+	if strings.Join(expanded, " ") != expected {
+		test.Fatalf("Expected '%v' but was '%v'.", expected, strings.Join(expanded, " "))
+	}
+
+	expanded, err = expandAliases([]string{"files", "a"}, aliases, commands, globalOptions)
+	if err != nil {
+		test.Fatal(err)
+	}
+	if strings.Join(expanded, " ") != "files a" {
+		test.Fatalf("Expected built-in command not to be overridden but was '%v'.", strings.Join(expanded, " "))
+	}
+
+	if _, err := expandAliases([]string{"loop"}, aliases, commands, globalOptions); err == nil {
+		test.Fatal("Recursive alias not identified.")
+	}
+}
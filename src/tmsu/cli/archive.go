@@ -0,0 +1,129 @@
+// Copyright 2011-2015 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package cli
+
+import (
+	"fmt"
+	"strings"
+	"tmsu/api"
+	"tmsu/common/log"
+	"tmsu/storage"
+)
+
+var ArchiveCommand = Command{
+	Name:     "archive",
+	Synopsis: "Pack files and their tags into an archive",
+	Usages:   []string{"tmsu archive [OPTION]... QUERY OUTPUT"},
+	Description: `Packs the files matching QUERY into the tar archive OUTPUT along with a manifest of their tags, so that both can be restored elsewhere with 'tmsu unarchive'.
+
+OUTPUT is compressed with zstd if its name ends '.zst', which requires the 'zstd' command, or with gzip if it ends '.gz' or '.tgz'. The files are stored at their paths relative to the directory that contains them all. Files with the same content are stored once, the duplicates as hard links. Directories are archived without their contents.
+
+See 'tmsu help files' for the query syntax.`,
+	Examples: []string{"$ tmsu archive 'holiday and year = 2015' holiday-2015.tar.zst",
+		"$ tmsu archive --explicit music music.tar.gz"},
+	Options: Options{Option{"--explicit", "-e", "do not record implied tags", false, ""}},
+	Exec:    archiveExec,
+}
+
+var UnarchiveCommand = Command{
+	Name:     "unarchive",
+	Synopsis: "Restore files and their tags from an archive",
+	Usages:   []string{"tmsu unarchive [OPTION]... ARCHIVE [DIR]"},
+	Description: `Restores the files packed into ARCHIVE by 'tmsu archive' to DIR, or to the working directory, and applies the tags recorded in its manifest, creating tags and values where the settings allow.
+
+Files that already exist are skipped unless --force is specified. Under --dry-run the files that would be restored, and the tags they would be given, are reported without anything being written.`,
+	Examples: []string{"$ tmsu unarchive holiday-2015.tar.zst ~/photos"},
+	Options:  Options{Option{"--force", "-f", "overwrite files that already exist", false, ""}},
+	Exec:     unarchiveExec,
+	Modifies: true,
+}
+
+// unexported
+
+func archiveExec(store *storage.Storage, options Options, args []string) error {
+	if len(args) < 2 {
+		return fmt.Errorf("too few arguments")
+	}
+
+	queryText := strings.Join(args[:len(args)-1], " ")
+	outputPath := args[len(args)-1]
+
+	tx, err := store.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Commit()
+
+	files, err := api.QueryFiles(store, tx, queryText, api.QueryOptions{Sort: "name"})
+	if err != nil {
+		if noSuchTags, ok := err.(api.NoSuchTagsError); ok {
+			for _, tagName := range noSuchTags.Names {
+				log.Warnf("no such tag '%v'.", tagName)
+			}
+
+			return errNoSuchTag
+		}
+
+		return err
+	}
+	if len(files) == 0 {
+		return errNothingMatched
+	}
+
+	archiveOptions := api.ArchiveOptions{ExplicitOnly: options.HasOption("--explicit"),
+		Report: func(path, name string) {
+			log.Infof(1, "%v: archived as %v", path, name)
+		}}
+
+	return api.Archive(store, tx, files, outputPath, archiveOptions)
+}
+
+func unarchiveExec(store *storage.Storage, options Options, args []string) error {
+	switch {
+	case len(args) < 1:
+		return fmt.Errorf("too few arguments")
+	case len(args) > 2:
+		return fmt.Errorf("too many arguments")
+	}
+
+	destPath := "."
+	if len(args) == 2 {
+		destPath = args[1]
+	}
+
+	tx, err := store.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Commit()
+
+	archiveOptions := api.ArchiveOptions{Force: options.HasOption("--force"),
+		Pretend: store.DryRun,
+		Report: func(path, name string) {
+			if store.DryRun {
+				log.Infof(0, "dry run: would restore '%v'", path)
+			} else {
+				log.Infof(1, "%v: restored", path)
+			}
+		},
+		Tagged: func(path string, tags []string) {
+			if store.DryRun {
+				log.Infof(0, "dry run: would tag '%v' %v", path, strings.Join(escapeNames(tags), " "))
+			}
+		}}
+
+	return api.Unarchive(store, tx, args[0], destPath, archiveOptions)
+}
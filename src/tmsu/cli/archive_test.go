@@ -0,0 +1,239 @@
+// Copyright 2011-2015 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package cli
+
+import (
+	"archive/tar"
+	"io/ioutil"
+	"os"
+	"testing"
+	"tmsu/storage"
+)
+
+func TestArchiveAndUnarchive(test *testing.T) {
+	// set-up
+
+	databasePath := testDatabase()
+	defer os.Remove(databasePath)
+
+	store, err := storage.OpenAt(databasePath)
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer store.Close()
+
+	defer os.RemoveAll("/tmp/tmsu/archive")
+	defer os.RemoveAll("/tmp/tmsu/restored")
+
+	if err := createFile("/tmp/tmsu/archive/a", "hello"); err != nil {
+		test.Fatal(err)
+	}
+	if err := createFile("/tmp/tmsu/archive/sub/b", "hello"); err != nil {
+		test.Fatal(err)
+	}
+	if err := createFile("/tmp/tmsu/archive/c", "other"); err != nil {
+		test.Fatal(err)
+	}
+
+	if err := TagCommand.Exec(store, Options{}, []string{"/tmp/tmsu/archive/a", "holiday", "year=2015"}); err != nil {
+		test.Fatal(err)
+	}
+	if err := TagCommand.Exec(store, Options{}, []string{"/tmp/tmsu/archive/sub/b", "holiday"}); err != nil {
+		test.Fatal(err)
+	}
+	if err := TagCommand.Exec(store, Options{}, []string{"/tmp/tmsu/archive/c", "work"}); err != nil {
+		test.Fatal(err)
+	}
+
+	// test
+
+	archivePath := "/tmp/tmsu/archive/holiday.tar.gz"
+	if err := ArchiveCommand.Exec(store, Options{}, []string{"holiday", archivePath}); err != nil {
+		test.Fatal(err)
+	}
+
+	if err := UnarchiveCommand.Exec(store, Options{}, []string{archivePath, "/tmp/tmsu/restored"}); err != nil {
+		test.Fatal(err)
+	}
+
+	// validate
+
+	for _, path := range []string{"/tmp/tmsu/restored/a", "/tmp/tmsu/restored/sub/b"} {
+		content, err := ioutil.ReadFile(path)
+		if err != nil {
+			test.Fatal(err)
+		}
+		if string(content) != "hello" {
+			test.Fatalf("Expected '%v' to contain 'hello' but was '%v'.", path, string(content))
+		}
+	}
+
+	if _, err := os.Stat("/tmp/tmsu/restored/c"); !os.IsNotExist(err) {
+		test.Fatalf("Expected unmatched file not to be archived.")
+	}
+
+	// the duplicate is stored as a hard link
+	statA, err := os.Stat("/tmp/tmsu/restored/a")
+	if err != nil {
+		test.Fatal(err)
+	}
+	statB, err := os.Stat("/tmp/tmsu/restored/sub/b")
+	if err != nil {
+		test.Fatal(err)
+	}
+	if !os.SameFile(statA, statB) {
+		test.Fatalf("Expected duplicate to be restored as a hard link.")
+	}
+
+	expectImportedTags(test, store, "/tmp/tmsu/restored/a", "holiday", "year")
+	expectImportedTags(test, store, "/tmp/tmsu/restored/sub/b", "holiday")
+}
+
+func TestUnarchiveDryRun(test *testing.T) {
+	// set-up
+
+	databasePath := testDatabase()
+	defer os.Remove(databasePath)
+
+	store, err := storage.OpenAt(databasePath)
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer store.Close()
+
+	defer os.RemoveAll("/tmp/tmsu/archive")
+	defer os.RemoveAll("/tmp/tmsu/restored")
+
+	if err := createFile("/tmp/tmsu/archive/a", "hello"); err != nil {
+		test.Fatal(err)
+	}
+
+	if err := TagCommand.Exec(store, Options{}, []string{"/tmp/tmsu/archive/a", "holiday"}); err != nil {
+		test.Fatal(err)
+	}
+
+	archivePath := "/tmp/tmsu/archive/holiday.tar"
+	if err := ArchiveCommand.Exec(store, Options{}, []string{"holiday", archivePath}); err != nil {
+		test.Fatal(err)
+	}
+
+	// test
+
+	store.DryRun = true
+	err = UnarchiveCommand.Exec(store, Options{}, []string{archivePath, "/tmp/tmsu/restored/sub"})
+	store.DryRun = false
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	// validate
+
+	if _, err := os.Lstat("/tmp/tmsu/restored"); !os.IsNotExist(err) {
+		test.Fatal("Expected nothing to be restored under --dry-run.")
+	}
+
+	tx, err := store.Begin()
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer tx.Commit()
+
+	file, err := store.FileByPath(tx, "/tmp/tmsu/restored/sub/a")
+	if err != nil {
+		test.Fatal(err)
+	}
+	if file != nil {
+		test.Fatal("Expected the file not to be tagged under --dry-run.")
+	}
+}
+
+func TestUnarchiveRejectsEntriesOutsideDestination(test *testing.T) {
+	// set-up
+
+	databasePath := testDatabase()
+	defer os.Remove(databasePath)
+
+	store, err := storage.OpenAt(databasePath)
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer store.Close()
+
+	defer os.RemoveAll("/tmp/tmsu/outside")
+	defer os.RemoveAll("/tmp/tmsu/restored")
+
+	if err := os.MkdirAll("/tmp/tmsu/outside", 0755); err != nil {
+		test.Fatal(err)
+	}
+	if err := os.MkdirAll("/tmp/tmsu/restored", 0755); err != nil {
+		test.Fatal(err)
+	}
+	if err := os.Symlink("/tmp/tmsu/outside", "/tmp/tmsu/restored/existing"); err != nil {
+		test.Fatal(err)
+	}
+
+	linkArchivePath := "/tmp/tmsu/outside-link.tar"
+	defer os.Remove(linkArchivePath)
+	writeTestArchive(test, linkArchivePath,
+		&tar.Header{Name: "x", Typeflag: tar.TypeSymlink, Linkname: "/tmp/tmsu/outside", Mode: 0777},
+		&tar.Header{Name: "x/passwd", Typeflag: tar.TypeReg, Mode: 0644, Size: 5})
+
+	existingArchivePath := "/tmp/tmsu/outside-existing.tar"
+	defer os.Remove(existingArchivePath)
+	writeTestArchive(test, existingArchivePath,
+		&tar.Header{Name: "existing/passwd", Typeflag: tar.TypeReg, Mode: 0644, Size: 5})
+
+	// test
+
+	for _, archivePath := range []string{linkArchivePath, existingArchivePath} {
+		if err := UnarchiveCommand.Exec(store, Options{}, []string{archivePath, "/tmp/tmsu/restored"}); err == nil {
+			test.Fatalf("%v: expected malicious archive to be rejected", archivePath)
+		}
+	}
+
+	// validate
+
+	if _, err := os.Lstat("/tmp/tmsu/restored/x"); !os.IsNotExist(err) {
+		test.Fatal("Expected symbolic link to outside of the destination not to be restored.")
+	}
+	if _, err := os.Stat("/tmp/tmsu/outside/passwd"); !os.IsNotExist(err) {
+		test.Fatal("Expected no file to be written outside of the destination.")
+	}
+}
+
+func writeTestArchive(test *testing.T, path string, headers ...*tar.Header) {
+	file, err := os.Create(path)
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer file.Close()
+
+	writer := tar.NewWriter(file)
+	for _, header := range headers {
+		if err := writer.WriteHeader(header); err != nil {
+			test.Fatal(err)
+		}
+		if header.Size > 0 {
+			if _, err := writer.Write(make([]byte, header.Size)); err != nil {
+				test.Fatal(err)
+			}
+		}
+	}
+
+	if err := writer.Close(); err != nil {
+		test.Fatal(err)
+	}
+}
@@ -0,0 +1,51 @@
+// Copyright 2011-2015 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package cli
+
+import (
+	"tmsu/storage"
+)
+
+// unexported
+
+// Starts auditing a command that modifies the database, returning the function
+// to call with the command's outcome once it has finished, which records it in
+// the audit log if the auditLog setting is enabled. The operations the command
+// performs through the api are not recorded separately.
+func startAudit(store *storage.Storage, commandName string, options Options, arguments []string) func(error) {
+	store.Audited = true
+	finish := store.StartAudit(commandName, auditArgs(options, arguments))
+
+	return func(err error) {
+		finish(err)
+		store.Audited = false
+	}
+}
+
+// The options, as --name or --name=argument, followed by the arguments.
+func auditArgs(options Options, arguments []string) []string {
+	args := make([]string, 0, len(options)+len(arguments))
+
+	for _, option := range options {
+		if option.HasArgument {
+			args = append(args, option.LongName+"="+option.Argument)
+		} else {
+			args = append(args, option.LongName)
+		}
+	}
+
+	return append(args, arguments...)
+}
@@ -0,0 +1,155 @@
+// Copyright 2011-2015 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package cli
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+	"tmsu/storage"
+)
+
+func TestAuditLogRecordsModifyingCommand(test *testing.T) {
+	// set-up
+
+	databasePath := testDatabase()
+	defer os.Remove(databasePath)
+
+	store, err := storage.OpenAt(databasePath)
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer store.Close()
+
+	auditPath := store.AuditLogPath()
+	os.Remove(auditPath)
+	defer os.Remove(auditPath)
+
+	if err := createFile("/tmp/tmsu/a", "hello"); err != nil {
+		test.Fatal(err)
+	}
+	defer os.Remove("/tmp/tmsu/a")
+
+	if err := ConfigCommand.Exec(store, Options{}, []string{"auditLog=yes"}); err != nil {
+		test.Fatal(err)
+	}
+
+	// test
+
+	if err := processCommand(store, &TagCommand, Options{}, []string{"/tmp/tmsu/a", "apple"}); err != nil {
+		test.Fatal(err)
+	}
+	if err := processCommand(store, &TagsCommand, Options{}, []string{"/tmp/tmsu/a"}); err != nil {
+		test.Fatal(err)
+	}
+	if err := processCommand(store, &NoteCommand, Options{}, []string{"/tmp/tmsu/a", "greeting"}); err != nil {
+		test.Fatal(err)
+	}
+
+	// validate
+
+	content, err := ioutil.ReadFile(auditPath)
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(string(content)), "\n")
+	if len(lines) != 2 {
+		test.Fatalf("Expected two audit records but got %v: %v", len(lines), lines)
+	}
+
+	var record storage.AuditRecord
+	if err := json.Unmarshal([]byte(lines[0]), &record); err != nil {
+		test.Fatal(err)
+	}
+
+	if record.Command != "tag" {
+		test.Fatalf("Expected command 'tag' but was '%v'.", record.Command)
+	}
+	if strings.Join(record.Args, " ") != "/tmp/tmsu/a apple" {
+		test.Fatalf("Expected arguments '/tmp/tmsu/a apple' but were '%v'.", record.Args)
+	}
+	if record.Rows != 3 {
+		test.Fatalf("Expected the file, tag and tagging to be counted but rows were %v.", record.Rows)
+	}
+	if record.Pid != os.Getpid() {
+		test.Fatalf("Expected process ID %v but was %v.", os.Getpid(), record.Pid)
+	}
+	if record.User != store.Username {
+		test.Fatalf("Expected user '%v' but was '%v'.", store.Username, record.User)
+	}
+
+	if err := json.Unmarshal([]byte(lines[1]), &record); err != nil {
+		test.Fatal(err)
+	}
+	if record.Command != "note" {
+		test.Fatalf("Expected command 'note' but was '%v'.", record.Command)
+	}
+}
+
+func TestAuditLogRotates(test *testing.T) {
+	// set-up
+
+	databasePath := testDatabase()
+	defer os.Remove(databasePath)
+
+	store, err := storage.OpenAt(databasePath)
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer store.Close()
+
+	auditPath := store.AuditLogPath()
+	os.Remove(auditPath)
+	defer os.Remove(auditPath)
+	defer os.Remove(auditPath + ".1")
+
+	if err := ConfigCommand.Exec(store, Options{}, []string{"auditLog=yes"}); err != nil {
+		test.Fatal(err)
+	}
+	if err := ConfigCommand.Exec(store, Options{}, []string{"auditLogMaxSize=1"}); err != nil {
+		test.Fatal(err)
+	}
+
+	// test
+
+	if err := processCommand(store, &TagCommand, Options{Option{"--create", "-c", "", false, ""}}, []string{"apple"}); err != nil {
+		test.Fatal(err)
+	}
+	if err := processCommand(store, &TagCommand, Options{Option{"--create", "-c", "", false, ""}}, []string{"banana"}); err != nil {
+		test.Fatal(err)
+	}
+
+	// validate
+
+	previous, err := ioutil.ReadFile(auditPath + ".1")
+	if err != nil {
+		test.Fatal(err)
+	}
+	if !strings.Contains(string(previous), "apple") {
+		test.Fatalf("Expected rotated log to hold the first record but was '%v'.", previous)
+	}
+
+	current, err := ioutil.ReadFile(auditPath)
+	if err != nil {
+		test.Fatal(err)
+	}
+	if !strings.Contains(string(current), "banana") || strings.Contains(string(current), "apple") {
+		test.Fatalf("Expected log to hold only the second record but was '%v'.", current)
+	}
+}
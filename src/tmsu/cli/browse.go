@@ -0,0 +1,474 @@
+// Copyright 2011-2015 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package cli
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"tmsu/api"
+	"tmsu/common/terminal"
+	"tmsu/common/terminal/ansi"
+	"tmsu/common/text"
+	"tmsu/entities"
+	"tmsu/storage"
+	"unicode/utf8"
+)
+
+var BrowseCommand = Command{
+	Name:     "browse",
+	Synopsis: "Browse and tag files interactively",
+	Usages:   []string{"tmsu browse [OPTION]... [QUERY]"},
+	Description: `Shows an interactive terminal browser listing the files matching QUERY, or all tagged files if no QUERY is specified, alongside the tags of the selected file.
+
+The following keys are recognised:
+
+  j, DOWN     select the next file
+  k, UP       select the previous file
+  PGDN, PGUP  move a page down or up
+  g, G        select the first or last file
+  /           edit the query
+  a, +        add tags to the selected file
+  d, -        remove tags from the selected file
+  r           reload the files matching the query
+  q           quit
+
+When editing the query or tags, ENTER applies the change and ESC abandons it. Tags are specified as when using the 'tag' subcommand, as TAG or TAG=VALUE separated by spaces.`,
+	Examples: []string{"$ tmsu browse",
+		"$ tmsu browse music and not rating"},
+	Options: Options{Option{"--explicit", "-e", "show only the explicitly applied tags", false, ""}},
+	Exec:    browseExec,
+}
+
+// unexported
+
+const (
+	browseList = iota
+	browseQuery
+	browseAdd
+	browseRemove
+)
+
+const (
+	enterAlternateScreen = "\x1b[?1049h\x1b[?25l"
+	leaveAlternateScreen = "\x1b[?25h\x1b[?1049l"
+)
+
+func browseExec(store *storage.Storage, options Options, args []string) error {
+	colour, err := useColour(options)
+	if err != nil {
+		return err
+	}
+
+	if !terminal.IsTerminal(os.Stdin) {
+		return fmt.Errorf("standard input is not a terminal")
+	}
+
+	browser := newBrowser(store, strings.Join(args, " "), options.HasOption("--explicit"), colour)
+	browser.refresh()
+
+	state, err := terminal.MakeRaw(os.Stdin)
+	if err != nil {
+		return fmt.Errorf("could not configure terminal: %v", err)
+	}
+	defer terminal.Restore(os.Stdin, state)
+
+	fmt.Print(enterAlternateScreen)
+	defer fmt.Print(leaveAlternateScreen)
+
+	reader := bufio.NewReader(os.Stdin)
+	for {
+		browser.render(os.Stdout, terminal.Height(), terminal.Width())
+
+		key, err := readKey(reader)
+		if err != nil {
+			if err == io.EOF {
+				return nil
+			}
+
+			return fmt.Errorf("could not read key: %v", err)
+		}
+
+		if browser.handleKey(key) {
+			return nil
+		}
+	}
+}
+
+type browser struct {
+	store        *storage.Storage
+	db           *api.Database
+	query        string
+	explicitOnly bool
+	colour       bool
+	files        entities.Files
+	tags         []api.TagValue
+	selected     int
+	offset       int
+	pageSize     int
+	mode         int
+	input        string
+	message      string
+}
+
+func newBrowser(store *storage.Storage, query string, explicitOnly, colour bool) *browser {
+	return &browser{store: store, db: api.New(store), query: query, explicitOnly: explicitOnly, colour: colour, pageSize: 1}
+}
+
+// Handles the key press, returning whether to quit.
+func (browser *browser) handleKey(key string) bool {
+	if browser.mode != browseList {
+		browser.handleInputKey(key)
+		return false
+	}
+
+	browser.message = ""
+
+	switch key {
+	case "q", "ctrl-c", "ctrl-d":
+		return true
+	case "j", "down":
+		browser.selectFile(browser.selected + 1)
+	case "k", "up":
+		browser.selectFile(browser.selected - 1)
+	case "pgdn", " ":
+		browser.selectFile(browser.selected + browser.pageSize)
+	case "pgup":
+		browser.selectFile(browser.selected - browser.pageSize)
+	case "g", "home":
+		browser.selectFile(0)
+	case "G", "end":
+		browser.selectFile(len(browser.files) - 1)
+	case "/":
+		browser.mode, browser.input = browseQuery, browser.query
+	case "a", "+", "d", "-":
+		if browser.selectedFile() == nil {
+			browser.message = "no file selected"
+			break
+		}
+
+		if err := checkWritable(browser.store, "tag"); err != nil {
+			browser.message = err.Error()
+			break
+		}
+
+		if key == "a" || key == "+" {
+			browser.mode = browseAdd
+		} else {
+			browser.mode = browseRemove
+		}
+		browser.input = ""
+	case "r":
+		browser.refresh()
+	}
+
+	return false
+}
+
+func (browser *browser) handleInputKey(key string) {
+	switch key {
+	case "enter":
+		mode, input := browser.mode, strings.TrimSpace(browser.input)
+		browser.mode, browser.input = browseList, ""
+
+		switch mode {
+		case browseQuery:
+			browser.query = input
+			browser.selected, browser.offset = 0, 0
+			browser.refresh()
+		case browseAdd:
+			browser.applyTags(input, true)
+		case browseRemove:
+			browser.applyTags(input, false)
+		}
+	case "esc", "ctrl-c":
+		browser.mode, browser.input = browseList, ""
+	case "backspace":
+		if browser.input != "" {
+			_, size := utf8.DecodeLastRuneInString(browser.input)
+			browser.input = browser.input[:len(browser.input)-size]
+		}
+	case "ctrl-u":
+		browser.input = ""
+	default:
+		if utf8.RuneCountInString(key) == 1 {
+			browser.input += key
+		}
+	}
+}
+
+// Adds or removes the tags specified as TAG[=VALUE] words to or from the
+// selected file.
+func (browser *browser) applyTags(input string, add bool) {
+	file := browser.selectedFile()
+	if file == nil || input == "" {
+		return
+	}
+
+	words := text.Tokenize(input)
+	tagValues := make([]api.TagValue, len(words))
+	for index, word := range words {
+		tagValues[index] = api.ParseTagValue(word)
+	}
+
+	var err error
+	if add {
+		err = browser.db.Tag([]string{file.Path()}, tagValues, api.TagOptions{})
+	} else {
+		err = browser.db.Untag([]string{file.Path()}, tagValues, false)
+	}
+	if err != nil {
+		browser.message = err.Error()
+	}
+
+	browser.loadTags()
+}
+
+// Reloads the files matching the query and the tags of the selected file.
+func (browser *browser) refresh() {
+	files, err := browser.db.Query(browser.query, api.QueryOptions{Sort: "name"})
+	if err != nil {
+		browser.files = entities.Files{}
+		browser.message = err.Error()
+	} else {
+		browser.files = files
+	}
+
+	browser.selectFile(browser.selected)
+}
+
+func (browser *browser) selectFile(index int) {
+	if index >= len(browser.files) {
+		index = len(browser.files) - 1
+	}
+	if index < 0 {
+		index = 0
+	}
+
+	browser.selected = index
+	browser.loadTags()
+}
+
+func (browser *browser) selectedFile() *entities.File {
+	if browser.selected >= len(browser.files) {
+		return nil
+	}
+
+	return browser.files[browser.selected]
+}
+
+func (browser *browser) loadTags() {
+	browser.tags = nil
+
+	file := browser.selectedFile()
+	if file == nil {
+		return
+	}
+
+	tags, err := browser.db.FileTags(file.Path(), browser.explicitOnly)
+	if err != nil {
+		browser.message = err.Error()
+		return
+	}
+
+	browser.tags = tags
+}
+
+// Draws the browser: the query, the files with the selected file's tags
+// alongside and finally a status or prompt line.
+func (browser *browser) render(writer io.Writer, height, width int) {
+	if height <= 0 {
+		height = 24
+	}
+	if width <= 0 {
+		width = 80
+	}
+
+	listHeight := height - 2
+	if listHeight < 1 {
+		listHeight = 1
+	}
+	browser.pageSize = listHeight
+
+	if browser.selected < browser.offset {
+		browser.offset = browser.selected
+	}
+	if browser.selected >= browser.offset+listHeight {
+		browser.offset = browser.selected - listHeight + 1
+	}
+
+	fileWidth := width * 2 / 3
+	tagWidth := width - fileWidth - 3
+
+	var buffer bytes.Buffer
+	buffer.WriteString("\x1b[H")
+
+	header := fitWidth("Query: "+browser.query, width)
+	if browser.mode == browseQuery {
+		header = fitWidth("Query: "+browser.input+"_", width)
+	}
+	browser.writeLine(&buffer, header, ansi.Bold)
+
+	for row := 0; row < listHeight; row++ {
+		fileText := ""
+		if index := browser.offset + row; index < len(browser.files) {
+			fileText = "  " + relativePath(browser.files[index].Path(), "")
+			if index == browser.selected {
+				fileText = "> " + fileText[2:]
+			}
+		}
+		fileText = fitWidth(fileText, fileWidth)
+		if browser.colour && browser.offset+row == browser.selected && browser.selected < len(browser.files) {
+			fileText = ansi.Invert(fileText)
+		}
+
+		tagText := ""
+		switch {
+		case row == 0:
+			tagText = "Tags:"
+			if browser.colour {
+				tagText = ansi.Bold(tagText)
+			}
+		case row-1 < len(browser.tags):
+			tagText = fitWidth(browser.tags[row-1].String(), tagWidth)
+		}
+
+		browser.writeLine(&buffer, fileText+" | "+tagText, nil)
+	}
+
+	var status string
+	switch browser.mode {
+	case browseAdd:
+		status = "Add tags: " + browser.input + "_"
+	case browseRemove:
+		status = "Remove tags: " + browser.input + "_"
+	case browseQuery:
+		status = "ENTER apply  ESC cancel"
+	default:
+		if browser.message != "" {
+			status = browser.message
+		} else {
+			status = fmt.Sprintf("%v file(s)  j/k move  / query  a add  d remove  r reload  q quit", len(browser.files))
+		}
+	}
+	buffer.WriteString(fitWidth(status, width) + "\x1b[K\x1b[J")
+
+	writer.Write(buffer.Bytes())
+}
+
+func (browser *browser) writeLine(buffer *bytes.Buffer, line string, colour func(string) string) {
+	if browser.colour && colour != nil {
+		line = colour(line)
+	}
+
+	buffer.WriteString(line + "\x1b[K\r\n")
+}
+
+// Truncates or pads the text to exactly the specified width.
+func fitWidth(text string, width int) string {
+	if width <= 0 {
+		return ""
+	}
+
+	runes := []rune(text)
+	if len(runes) > width {
+		return string(runes[:width-1]) + "~"
+	}
+
+	return text + strings.Repeat(" ", width-len(runes))
+}
+
+// Reads a key press, returning the character typed or the name of the key
+// for special keys such as 'up' or 'enter'.
+func readKey(reader *bufio.Reader) (string, error) {
+	r, _, err := reader.ReadRune()
+	if err != nil {
+		return "", err
+	}
+
+	switch r {
+	case '\r', '\n':
+		return "enter", nil
+	case 127, 8:
+		return "backspace", nil
+	case 3:
+		return "ctrl-c", nil
+	case 4:
+		return "ctrl-d", nil
+	case 21:
+		return "ctrl-u", nil
+	case 27:
+		if reader.Buffered() == 0 {
+			return "esc", nil
+		}
+
+		return readEscapeSequence(reader)
+	}
+
+	if r < 32 {
+		return "", nil
+	}
+
+	return string(r), nil
+}
+
+func readEscapeSequence(reader *bufio.Reader) (string, error) {
+	introducer, err := reader.ReadByte()
+	if err != nil {
+		return "", err
+	}
+	if introducer != '[' && introducer != 'O' {
+		return "esc", nil
+	}
+
+	var parameter []byte
+	for {
+		b, err := reader.ReadByte()
+		if err != nil {
+			return "", err
+		}
+
+		switch {
+		case b >= '0' && b <= '9' || b == ';':
+			parameter = append(parameter, b)
+			continue
+		case b == 'A':
+			return "up", nil
+		case b == 'B':
+			return "down", nil
+		case b == 'H':
+			return "home", nil
+		case b == 'F':
+			return "end", nil
+		case b == '~':
+			switch string(parameter) {
+			case "1", "7":
+				return "home", nil
+			case "4", "8":
+				return "end", nil
+			case "5":
+				return "pgup", nil
+			case "6":
+				return "pgdn", nil
+			}
+		}
+
+		return "", nil
+	}
+}
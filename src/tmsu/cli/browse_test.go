@@ -0,0 +1,121 @@
+// Copyright 2011-2015 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package cli
+
+import (
+	"bufio"
+	"bytes"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+	"tmsu/storage"
+)
+
+func TestBrowseTagging(test *testing.T) {
+	// set-up
+
+	databasePath := testDatabase()
+	defer os.Remove(databasePath)
+
+	err := redirectStreams()
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer restoreStreams()
+
+	store, err := storage.OpenAt(databasePath)
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer store.Close()
+
+	if err := createFile("/tmp/tmsu/a", "a"); err != nil {
+		test.Fatal(err)
+	}
+	defer os.Remove("/tmp/tmsu/a")
+
+	if err := createFile("/tmp/tmsu/b", "b"); err != nil {
+		test.Fatal(err)
+	}
+	defer os.Remove("/tmp/tmsu/b")
+
+	if err := TagCommand.Exec(store, Options{}, []string{"/tmp/tmsu/a", "music"}); err != nil {
+		test.Fatal(err)
+	}
+	if err := TagCommand.Exec(store, Options{}, []string{"/tmp/tmsu/b", "music", "draft"}); err != nil {
+		test.Fatal(err)
+	}
+
+	browser := newBrowser(store, "", false, false)
+	browser.refresh()
+
+	// test
+
+	for _, key := range []string{"/", "ctrl-u", "m", "u", "s", "i", "c", "enter", "j", "a", "g", "e", "n", "r", "e", "=", "r", "o", "c", "k", "enter", "k", "j", "d", "d", "r", "a", "f", "t", "enter"} {
+		if browser.handleKey(key) {
+			test.Fatalf("Unexpected quit on key '%v'.", key)
+		}
+	}
+
+	var output bytes.Buffer
+	browser.render(&output, 10, 60)
+
+	// validate
+
+	if browser.message != "" {
+		test.Fatalf("Unexpected message '%v'.", browser.message)
+	}
+	if browser.query != "music" {
+		test.Fatalf("Expected query 'music' but was '%v'.", browser.query)
+	}
+	if !strings.Contains(output.String(), "Query: music") {
+		test.Fatalf("Expected query to be shown but was: %v", output.String())
+	}
+
+	if err := TagsCommand.Exec(store, Options{}, []string{"/tmp/tmsu/a"}); err != nil {
+		test.Fatal(err)
+	}
+	if err := TagsCommand.Exec(store, Options{}, []string{"/tmp/tmsu/b"}); err != nil {
+		test.Fatal(err)
+	}
+
+	outFile.Seek(0, 0)
+
+	content, err := ioutil.ReadAll(outFile)
+	if err != nil {
+		test.Fatal(err)
+	}
+	compareOutput(test, "/tmp/tmsu/a: music\n/tmp/tmsu/b: genre=rock music\n", string(content))
+
+	if !browser.handleKey("q") {
+		test.Fatal("Expected 'q' to quit.")
+	}
+}
+
+func TestReadKey(test *testing.T) {
+	reader := bufio.NewReader(strings.NewReader("j\x1b[A\x1b[6~\r\x7f"))
+
+	for _, expected := range []string{"j", "up", "pgdn", "enter", "backspace"} {
+		key, err := readKey(reader)
+		if err != nil {
+			test.Fatal(err)
+		}
+		if key != expected {
+			test.Fatalf("Expected key '%v' but was '%v'.", expected, key)
+		}
+	}
+}
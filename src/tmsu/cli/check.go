@@ -0,0 +1,100 @@
+// Copyright 2011-2015 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package cli
+
+import (
+	"fmt"
+	"strings"
+	"tmsu/api"
+	"tmsu/storage"
+)
+
+var CheckCommand = Command{
+	Name:     "check",
+	Synopsis: "Check the database for inconsistencies",
+	Usages:   []string{"tmsu check [OPTION]... [CHECK]..."},
+	Description: `Runs each CHECK, or all of the checks if none is specified, reporting the problems found. The exit code indicates whether there were any problems left unrepaired.
+
+The checks are:
+
+` + describeChecks() + `
+
+With --fix, the problems found by the 'orphans' and 'untagged' checks are repaired by deleting the orphaned rows and the untagged files from the database. The other problems need a decision, so are only reported: see the 'delete', 'untag' and 'repair' subcommands.`,
+	Examples: []string{"$ tmsu check\n/home/bob/report.txt: has mutually exclusive tags 'done' and 'todo' of set 'status'\ntag 'misc' is not applied to any file",
+		"$ tmsu check untagged",
+		"$ tmsu check --fix orphans"},
+	Options:    Options{Option{"--fix", "-f", "repair the problems that can be repaired safely", false, ""}},
+	Exec:       checkExec,
+	ModifiesIf: checkModifies,
+}
+
+// unexported
+
+// Fixing the problems found modifies the database.
+func checkModifies(options Options, args []string) bool {
+	return options.HasOption("--fix")
+}
+
+func checkExec(store *storage.Storage, options Options, args []string) error {
+	fix := options.HasOption("--fix")
+
+	tx, err := store.Begin()
+	if err != nil {
+		return err
+	}
+
+	problems, err := api.RunChecks(store, tx, args, fix)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	unfixed := 0
+	for _, problem := range problems {
+		if problem.Fixed {
+			fmt.Printf("%v (fixed)\n", problem.Description)
+		} else {
+			fmt.Println(problem.Description)
+			unfixed++
+		}
+	}
+
+	if unfixed > 0 {
+		return errBlank
+	}
+
+	return nil
+}
+
+func describeChecks() string {
+	width := 0
+	for _, check := range api.Checks {
+		if len(check.Name) > width {
+			width = len(check.Name)
+		}
+	}
+
+	lines := make([]string, len(api.Checks))
+	for index, check := range api.Checks {
+		lines[index] = fmt.Sprintf("  %-*v  %v", width, check.Name, check.Description)
+	}
+
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,107 @@
+// Copyright 2011-2015 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package cli
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+	"tmsu/common/fingerprint"
+	"tmsu/storage"
+)
+
+func TestCheckAndFix(test *testing.T) {
+	// set-up
+
+	databasePath := testDatabase()
+	defer os.Remove(databasePath)
+
+	err := redirectStreams()
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer restoreStreams()
+
+	store, err := storage.OpenAt(databasePath)
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer store.Close()
+
+	tx, err := store.Begin()
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	dir, err := store.AddFile(tx, "/tmp/a", fingerprint.Fingerprint("abc"), time.Now(), 123, true)
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	file, err := store.AddFile(tx, "/tmp/a/b", fingerprint.Fingerprint("abc"), time.Now(), 123, false)
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	if _, err := store.AddFile(tx, "/tmp/c", fingerprint.Fingerprint("def"), time.Now(), 123, false); err != nil {
+		test.Fatal(err)
+	}
+
+	photoTag, err := store.AddTag(tx, "photo")
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	if _, err := store.AddTag(tx, "misc"); err != nil {
+		test.Fatal(err)
+	}
+
+	if _, err := store.AddFileTag(tx, dir.Id, photoTag.Id, 0); err != nil {
+		test.Fatal(err)
+	}
+
+	if _, err := store.AddFileTag(tx, file.Id, photoTag.Id, 0); err != nil {
+		test.Fatal(err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		test.Fatal(err)
+	}
+
+	// test
+
+	if err := CheckCommand.Exec(store, Options{Option{"--fix", "-f", "", false, ""}}, []string{}); err != errBlank {
+		test.Fatalf("Expected check to report problems but error was %v.", err)
+	}
+	if err := CheckCommand.Exec(store, Options{}, []string{"untagged", "unused"}); err != errBlank {
+		test.Fatalf("Expected check to report problems but error was %v.", err)
+	}
+	if err := CheckCommand.Exec(store, Options{}, []string{"nonsense"}); err == nil {
+		test.Fatal("Expected unknown check to be rejected.")
+	}
+
+	// validate
+
+	outFile.Seek(0, 0)
+
+	bytes, err := ioutil.ReadAll(outFile)
+	compareOutput(test, `/tmp/c: file has no tags (fixed)
+tag 'misc' is not applied to any file
+/tmp/a/b: tag 'photo' is also applied to the containing directory '/tmp/a'
+tag 'misc' is not applied to any file
+`, string(bytes))
+}
@@ -20,18 +20,33 @@ import (
 	"os"
 	"os/user"
 	"path/filepath"
+	"strings"
 	"tmsu/common/log"
 	_path "tmsu/common/path"
+	"tmsu/common/terminal"
+	"tmsu/common/text"
 	"tmsu/storage"
 )
 
 func Run() {
 	helpCommands = commands
+	scriptCommands = commands
+
+	aliases, err := storage.GlobalAliases()
+	if err != nil {
+		log.Warnf("%v", err)
+	}
+	helpAliases = aliases
+
+	args, err := expandAliases(os.Args[1:], aliases, commands, globalOptions)
+	if err != nil {
+		exit(err)
+	}
 
 	parser := NewOptionParser(globalOptions, commands)
-	command, options, arguments, err := parser.Parse(os.Args[1:]...)
+	command, options, arguments, err := parser.Parse(args...)
 	if err != nil {
-		log.Fatal(err)
+		exit(err)
 	}
 
 	switch {
@@ -41,7 +56,37 @@ func Run() {
 		// find help command
 	}
 
-	log.Verbosity = options.Count("--verbose") + 1
+	if options.HasOption("--quiet") {
+		if options.HasOption("--verbose") {
+			exit(fmt.Errorf("--quiet and --verbose cannot be combined"))
+		}
+
+		log.Verbosity = 0
+	} else {
+		log.Verbosity = options.Count("--verbose") + 1
+	}
+
+	if options.HasOption("--color") {
+		when := options.Get("--color").Argument
+		if err := terminal.SetColourWhen(when); err != nil {
+			exit(fmt.Errorf("invalid argument '%v' for '--color'", when))
+		}
+	}
+
+	if err := startTiming(options); err != nil {
+		exit(err)
+	}
+
+	storage.PassphraseFunc = passphraseReader(options)
+
+	if options.HasOption("--all-databases") {
+		if err := processCommandFederated(command, options, arguments); err != nil {
+			exit(err)
+		}
+
+		stopTiming()
+		return
+	}
 
 	var databasePath string
 	switch {
@@ -52,34 +97,123 @@ func Run() {
 	default:
 		databasePath, err = findDatabase()
 		if err != nil {
-			log.Fatalf("could not find database: %v", err)
+			exit(noDatabaseError("could not find database: %v", err))
 		}
 	}
 
 	store, err := storage.OpenAt(databasePath)
 	if err != nil {
-		log.Fatalf("could not open storage: %v", err)
+		exit(noDatabaseError("could not open storage: %v", err))
 	}
 
-	if err = processCommand(store, command, options, arguments); err != nil {
-		if err != errBlank {
-			log.Warn(err.Error())
+	store.DryRun = options.HasOption("--dry-run")
+	store.ReadOnly = options.HasOption("--read-only")
+	store.Command = strings.Join(os.Args[1:], " ")
+
+	if !options.HasOption("--color") {
+		if err := applyColourSetting(store); err != nil {
+			store.Close()
+			exit(err)
 		}
+	}
+
+	if err := applySortSettings(store, options.HasOption("--numeric-sort")); err != nil {
+		store.Close()
+		exit(err)
+	}
 
+	if err = processCommand(store, command, options, arguments); err != nil {
 		store.Close()
-		os.Exit(1)
+		exit(err)
 	}
 
 	store.Close()
+	stopTiming()
 }
 
 // unexported
 
-var globalOptions = Options{Option{"--verbose", "-v", "show verbose messages", false, ""},
+var globalOptions = Options{Option{"--verbose", "-v", "show verbose messages (repeat for more detail)", false, ""},
+	Option{"--quiet", "-q", "do not show warnings", false, ""},
 	Option{"--help", "-h", "show help and exit", false, ""},
 	Option{"--version", "-V", "show version information and exit", false, ""},
 	Option{"--database", "-D", "use the specified database", true, ""},
-	Option{"--color", "", "colorize the output (auto/always/never)", true, ""},
+	Option{"--key-file", "", "read the passphrase of an encrypted database from the specified file", true, ""},
+	Option{"--all-databases", "-A", "use all of the configured databases that are mounted, showing paths in full", false, ""},
+	Option{"--color", "", "colorize the output (auto/always/never), overriding the color setting", true, ""},
+	Option{"--numeric-sort", "", "order numbers in names by value, e.g. file2 before file10, overriding the numericSort setting", false, ""},
+	Option{"--dry-run", "", "show the changes that would be made without making them", false, ""},
+	Option{"--read-only", "", "fail rather than make any changes to the database", false, ""},
+	Option{"--no-wait", "", "fail rather than wait whilst another tmsu process modifies the database", false, ""},
+	Option{"--timing", "", "report the time spent walking, stat-ing, fingerprinting and querying the database", false, ""},
+	Option{"--profile", "", "write a CPU profile (for go tool pprof) to the specified file", true, ""},
+}
+
+// Whether the invocation of the command modifies the database, in which case
+// it takes the writer lock and is audited.
+func modifies(command *Command, options Options, arguments []string) bool {
+	return command.Modifies || command.ModifiesIf != nil && command.ModifiesIf(options, arguments)
+}
+
+// Fails if the database is read-only, so that commands that would modify it
+// fail before doing any work.
+func checkWritable(store *storage.Storage, commandName string) error {
+	readOnly, err := store.IsReadOnly()
+	if err != nil {
+		return err
+	}
+	if readOnly {
+		return fmt.Errorf("cannot %v: the database is read-only", commandName)
+	}
+
+	return nil
+}
+
+// Acquires the database's writer lock so that only one process modifies it at
+// once, reporting the process being waited for or, with --no-wait, failing.
+func lockForWriting(store *storage.Storage, commandName string, options Options) (*storage.WriterLock, error) {
+	if store.DryRun {
+		return nil, nil
+	}
+
+	return store.LockForWriting("tmsu "+commandName, !options.HasOption("--no-wait"), func(owner storage.LockOwner) {
+		log.Warnf("waiting for %v...", owner)
+	})
+}
+
+// Colours output as the database's 'color' setting specifies.
+func applyColourSetting(store *storage.Storage) error {
+	tx, err := store.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Commit()
+
+	settings, err := store.Settings(tx)
+	if err != nil {
+		return fmt.Errorf("could not retrieve settings: %v", err)
+	}
+
+	return terminal.SetColourWhen(settings.Colour())
+}
+
+// Orders listings as the database's 'collation' and 'numericSort' settings
+// specify, the latter overridden by --numeric-sort.
+func applySortSettings(store *storage.Storage, numericSort bool) error {
+	tx, err := store.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Commit()
+
+	settings, err := store.Settings(tx)
+	if err != nil {
+		return fmt.Errorf("could not retrieve settings: %v", err)
+	}
+
+	text.SetCollation(text.Collation{Locale: settings.Collation() == "locale", Numeric: numericSort || settings.NumericSort()})
+
+	return nil
 }
 
 func findDatabase() (string, error) {
@@ -130,6 +264,38 @@ func findDatabaseInPath() (string, error) {
 }
 
 func processCommand(store *storage.Storage, command *Command, options Options, arguments []string) error {
+	if modifies(command, options, arguments) {
+		if err := checkWritable(store, command.Name); err != nil {
+			return err
+		}
+
+		lock, err := lockForWriting(store, command.Name, options)
+		if err != nil {
+			return err
+		}
+		defer lock.Release()
+
+		if err := expireTags(store); err != nil {
+			log.Warnf("could not remove expired tags: %v", err)
+		}
+
+		if command.Name != FlushCommand.Name {
+			if err := flushPendingTags(store); err != nil {
+				log.Warnf("could not apply queued tags: %v", err)
+			}
+		}
+
+		finishAudit := startAudit(store, command.Name, options, arguments)
+		err = command.Exec(store, options, arguments)
+		finishAudit(err)
+
+		return err
+	}
+
+	if err := sweepOpportunistically(store, command.Name); err != nil {
+		log.Warnf("could not remove expired tags or apply queued tags: %v", err)
+	}
+
 	if err := command.Exec(store, options, arguments); err != nil {
 		return err
 	}
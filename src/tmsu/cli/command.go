@@ -29,4 +29,8 @@ type Command struct {
 	Options     Options
 	Exec        func(*storage.Storage, Options, []string) error
 	Hidden      bool
+	Federated   bool
+	Modifies    bool                         // fails fast if the database is read-only
+	ModifiesIf  func(Options, []string) bool // as Modifies, for the invocations that modify
+	Separated   bool                         // receives a '--' that follows its first argument
 }
@@ -0,0 +1,101 @@
+// Copyright 2011-2015 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package cli
+
+import (
+	"os"
+	"testing"
+	"tmsu/storage"
+)
+
+func TestModifyingInvocationsLocked(test *testing.T) {
+	// set-up
+
+	databasePath := testDatabase()
+	defer os.Remove(databasePath)
+	defer os.Remove(databasePath + ".lock")
+
+	err := redirectStreams()
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer restoreStreams()
+
+	store, err := storage.OpenAt(databasePath)
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer store.Close()
+
+	if err := createFile("/tmp/tmsu/a", "hello"); err != nil {
+		test.Fatal(err)
+	}
+	defer os.Remove("/tmp/tmsu/a")
+
+	// another process's
+	other, err := storage.OpenAt(databasePath)
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer other.Close()
+
+	lock, err := other.LockForWriting("tmsu tag", true, nil)
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer lock.Release()
+
+	noWait := Option{"--no-wait", "", "", false, ""}
+
+	cases := []struct {
+		command  *Command
+		options  Options
+		args     []string
+		modifies bool
+	}{
+		{&RateCommand, Options{}, []string{"/tmp/tmsu/a", "4"}, true},
+		{&RateCommand, Options{}, []string{"/tmp/tmsu/a"}, false},
+		{&NoteCommand, Options{}, []string{"/tmp/tmsu/a", "text"}, true},
+		{&NoteCommand, Options{}, []string{"/tmp/tmsu/a"}, false},
+		{&ImplyCommand, Options{}, []string{"mp3", "music"}, true},
+		{&ImplyCommand, Options{}, []string{}, false},
+		{&ExclusiveCommand, Options{}, []string{"status", "done", "todo"}, true},
+		{&ExclusiveCommand, Options{}, []string{}, false},
+		{&UndoCommand, Options{}, []string{}, true},
+		{&UndoCommand, Options{Option{"--list", "-l", "", false, ""}}, []string{}, false},
+		{&ConfigCommand, Options{}, []string{"autoCreateTags=no"}, true},
+		{&ConfigCommand, Options{}, []string{"autoCreateTags"}, false},
+		{&CheckCommand, Options{Option{"--fix", "-f", "", false, ""}}, []string{}, true},
+		{&CheckCommand, Options{}, []string{}, false},
+		{&DupesCommand, Options{Option{"--merge-tags", "-m", "", false, ""}}, []string{}, true},
+		{&RepairCommand, Options{}, []string{}, true},
+		{&RepairCommand, Options{Option{"--pretend", "-P", "", false, ""}}, []string{}, false},
+		{&SyncCommand, Options{}, []string{"/tmp/tmsu/remote.db"}, true},
+	}
+
+	for _, testCase := range cases {
+		// test
+
+		err := processCommand(store, testCase.command, append(testCase.options, noWait), testCase.args)
+
+		// validate
+
+		_, locked := err.(storage.LockedError)
+		if locked != testCase.modifies {
+			test.Fatalf("%v %v: expected to wait for the lock to be %v but error was %v.", testCase.command.Name, testCase.args, testCase.modifies, err)
+		}
+	}
+}
@@ -18,25 +18,56 @@
 package cli
 
 var commands = []*Command{
+	&ArchiveCommand,
+	&BrowseCommand,
+	&CheckCommand,
 	&ConfigCommand,
 	&CopyCommand,
 	&DeleteCommand,
+	&DiagnoseCommand,
 	&DupesCommand,
+	&EmbedCommand,
+	&EmblemSyncCommand,
+	&EncryptCommand,
+	&ExclusiveCommand,
+	&ExportCommand,
 	&FilesCommand,
+	&FlagCommand,
+	&FlushCommand,
 	&HelpCommand,
+	&HistoryCommand,
 	&ImplyCommand,
+	&ImportCommand,
+	&IndexCommand,
 	&InitCommand,
+	&LinkCommand,
+	&MaintainCommand,
 	&MergeCommand,
 	&MountCommand,
+	&NoteCommand,
+	&OpenCommand,
+	&OrganizeCommand,
+	&RateCommand,
+	&RecentCommand,
+	&RebuildCommand,
+	&ReconcileCommand,
 	&RenameCommand,
 	&RepairCommand,
+	&RetagCommand,
+	&ScriptCommand,
+	&ServeCommand,
 	&InfoCommand,
+	&StatsCommand,
 	&StatusCommand,
+	&SyncCommand,
 	&TagCommand,
 	&TagsCommand,
+	&UnarchiveCommand,
+	&UndoCommand,
 	&UnmountCommand,
 	&UntagCommand,
 	&UntaggedCommand,
 	&ValuesCommand,
 	&VersionCommand,
-	&VfsCommand}
+	&VfsCommand,
+	&WebCommand}
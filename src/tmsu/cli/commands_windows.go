@@ -18,22 +18,52 @@
 package cli
 
 var commands = *Command{
+	&ArchiveCommand,
+	&BrowseCommand,
+	&CheckCommand,
 	&ConfigCommand,
 	&CopyCommand,
 	&DeleteCommand,
+	&DiagnoseCommand,
 	&DupesCommand,
+	&EmbedCommand,
+	&EmblemSyncCommand,
+	&EncryptCommand,
+	&ExclusiveCommand,
+	&ExportCommand,
 	&FilesCommand,
+	&FlagCommand,
+	&FlushCommand,
 	&HelpCommand,
+	&HistoryCommand,
 	&ImplyCommand,
+	&ImportCommand,
+	&IndexCommand,
 	&InitCommand,
+	&LinkCommand,
+	&MaintainCommand,
 	&MergeCommand,
+	&NoteCommand,
+	&OpenCommand,
+	&OrganizeCommand,
+	&RateCommand,
+	&RecentCommand,
+	&RebuildCommand,
+	&ReconcileCommand,
 	&RenameCommand,
 	&RepairCommand,
+	&RetagCommand,
+	&ScriptCommand,
 	&InfoCommand,
+	&StatsCommand,
 	&StatusCommand,
+	&SyncCommand,
 	&TagCommand,
 	&TagsCommand,
+	&UnarchiveCommand,
+	&UndoCommand,
 	&UntagCommand,
 	&UntaggedCommand,
 	&ValuesCommand,
-	&VersionCommand}
+	&VersionCommand,
+	&WebCommand}
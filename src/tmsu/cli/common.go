@@ -16,25 +16,19 @@
 package cli
 
 import (
-	"errors"
 	"fmt"
 	"os"
+	"strings"
 	"time"
 	"tmsu/common/log"
 	"tmsu/common/terminal"
+	"tmsu/common/terminal/ansi"
 	"tmsu/entities"
 	"tmsu/storage"
 )
 
 // unexported
 
-var errBlank = errors.New("")
-
-type tagValuePair struct {
-	TagId   entities.TagId
-	ValueId entities.ValueId
-}
-
 func stdoutIsCharDevice() bool {
 	stat, err := os.Stdout.Stat()
 	if err != nil {
@@ -47,51 +41,16 @@ func stdoutIsCharDevice() bool {
 	return false
 }
 
+// Determines whether standard output is to be coloured.
 func useColour(options Options) (bool, error) {
-	when := "auto"
 	if options.HasOption("--color") {
-		when = options.Get("--color").Argument
-	}
-
-	switch when {
-	case "":
-	case "auto":
-		return terminal.Colour() && terminal.Width() > 0, nil
-	case "always":
-		return true, nil
-	case "never":
-		return false, nil
+		when := options.Get("--color").Argument
+		if err := terminal.SetColourWhen(when); err != nil {
+			return false, fmt.Errorf("invalid argument '%v' for '--color'", when)
+		}
 	}
 
-	return false, fmt.Errorf("invalid argument '%v' for '--color'", when)
-}
-
-type emptyStat struct {
-	name string
-}
-
-func (es emptyStat) Name() string {
-	return es.name
-}
-
-func (emptyStat) Size() int64 {
-	return 0
-}
-
-func (emptyStat) Mode() os.FileMode {
-	return 0
-}
-
-func (emptyStat) ModTime() time.Time {
-	return time.Time{}
-}
-
-func (emptyStat) IsDir() bool {
-	return false
-}
-
-func (emptyStat) Sys() interface{} {
-	return nil
+	return terminal.ColourFor(os.Stdout), nil
 }
 
 func createTag(store *storage.Storage, tx *storage.Tx, tagName string) (*entities.Tag, error) {
@@ -100,7 +59,7 @@ func createTag(store *storage.Storage, tx *storage.Tx, tagName string) (*entitie
 		return nil, fmt.Errorf("could not create tag '%v': %v", tagName, err)
 	}
 
-	log.Warnf("New tag '%v'.", tagName)
+	log.Warnf("New tag '%v'.", terminal.Colourise(os.Stderr, ansi.Yellow, tagName))
 
 	return tag, nil
 }
@@ -111,7 +70,47 @@ func createValue(store *storage.Storage, tx *storage.Tx, valueName string) (*ent
 		return nil, err
 	}
 
-	log.Warnf("New value '%v'.", valueName)
+	log.Warnf("New value '%v'.", terminal.Colourise(os.Stderr, ansi.Yellow, valueName))
 
 	return value, nil
 }
+
+// Parses a date, optionally with a time, in local time.
+func parseTime(text string) (time.Time, error) {
+	for _, layout := range []string{"2006-01-02", "2006-01-02 15:04", "2006-01-02 15:04:05", "2006-01-02T15:04:05", time.RFC3339} {
+		if t, err := time.ParseInLocation(layout, text, time.Local); err == nil {
+			return t, nil
+		}
+	}
+
+	return time.Time{}, fmt.Errorf("invalid date '%v': expected YYYY-MM-DD or YYYY-MM-DD HH:MM:SS", text)
+}
+
+// Asks for confirmation of an operation that would affect more files than the
+// 'confirmFileCount' setting allows, unless --yes is specified or for a dry
+// run. Where standard input is not a terminal the operation is refused.
+func confirmFileCount(store *storage.Storage, tx *storage.Tx, options Options, action string, count uint) error {
+	if options.HasOption("--yes") || store.DryRun {
+		return nil
+	}
+
+	settings, err := store.Settings(tx)
+	if err != nil {
+		return fmt.Errorf("could not retrieve settings: %v", err)
+	}
+
+	limit := settings.ConfirmFileCount()
+	if limit == 0 || count <= limit {
+		return nil
+	}
+
+	if !terminal.IsTerminal(os.Stdin) {
+		return fmt.Errorf("cannot %v %v files, more than the 'confirmFileCount' setting of %v, without --yes", action, count, limit)
+	}
+
+	if !confirm(fmt.Sprintf("%v %v files?", strings.Title(action), count)) {
+		return errNotConfirmed
+	}
+
+	return nil
+}
@@ -25,28 +25,84 @@ import (
 var ConfigCommand = Command{
 	Name:     "config",
 	Synopsis: "Views or amends database settings",
-	Usages: []string{"tmsu config",
-		"tmsu config NAME[=VALUE]..."},
+	Usages: []string{"tmsu config [OPTION]...",
+		"tmsu config [OPTION]... NAME[=VALUE]..."},
 	Description: `Lists or views the database settings for the current database.
 
 Without arguments the complete set of settings are shown, otherwise lists the settings for the specified setting NAMEs.
 
-If a VALUE is specified then the setting is updated.`,
-	Options: Options{},
-	Exec:    configExec,
+If a VALUE is specified then the setting is updated.
+
+With --global the defaults in the global configuration file, CONFIG, are viewed or updated instead. These apply to every database that does not set the setting itself. CONFIG is $XDG_CONFIG_HOME/tmsu/tmsu.conf or, if XDG_CONFIG_HOME is not set, ~/.config/tmsu/tmsu.conf and holds a NAME=VALUE line per setting.
+
+The canonicalPaths setting determines how paths are stored, so that a file reachable by several paths is recorded once: 'none' stores paths as specified; 'symlinks' resolves any symbolic links within the directories of paths; and 'mounts' additionally maps paths under bind mounts to those under the mount of the whole file system (Linux only). Paths already stored are not changed: use 'tmsu repair --manual' to move them.
+
+The pathOnlyFiles setting lists comma-separated patterns, such as '*.log,*.qcow2', of files to track by path only when they are first tagged: such files are not fingerprinted and are not reported as modified (see 'tmsu tag --no-fingerprint'). A pattern matches the file's name or, where it contains a slash, its whole path.
+
+The fingerprintCache setting, enabled by default, caches the fingerprints of files by their device, inode, size and modification time so that repair, dupes and tag need not hash unchanged files again. Disabling it discards the cache.
+
+The fileFingerprintAlgorithm setting determines how files are fingerprinted: 'dynamic:SHA256' (the default), 'dynamic:SHA1', 'dynamic:MD5' and 'dynamic:CRC64' hash only parts of large files whilst 'SHA256', 'SHA1', 'MD5' and 'CRC64' hash files in full. When it is changed the existing fingerprints are kept, recorded against the previous algorithm, for 'tmsu dupes --confirm' to use: run 'tmsu repair --unmodified' to fingerprint the files again with the new algorithm.
+
+The audioFingerprinter setting names the command that calculates the acoustic fingerprints used by 'tmsu dupes --similar-audio', by default Chromaprint's 'fpcalc -raw'. The file's path is passed as its final argument and it must print the fingerprint's integers, comma-separated, on a 'FINGERPRINT=' line.
+
+The openers setting lists the commands 'tmsu open' uses by MIME type as semicolon-separated TYPE=COMMAND entries, e.g. 'image/*=feh; video/*=mpv --fs; application/pdf=zathura'. The first entry matching a file's type is used and the matching files are passed to the command as its final arguments. Other files are opened with the desktop's default application.
+
+The collation setting determines how tag, value and file names are ordered in listings: 'binary' (the default) orders them by their bytes, so upper case precedes lower case, whilst 'locale' orders them as a dictionary would, ignoring case and accents except to break ties. With the numericSort setting enabled, or the --numeric-sort option, runs of digits are ordered by their value so that 'file2' precedes 'file10'.
+
+The vfsCacheTimeout setting is the time for which the virtual filesystem caches the attributes of the files it presents, e.g. '1s' (the default) or '500ms'. The file symlinks report the size, times, permissions and ownership of the files they point to; a longer timeout means listing large tag directories is quicker but changes to the files take longer to be reflected. '0' disables caching.
+
+With the auditLog setting enabled, each command that modifies the database, and each change made through 'serve', 'web', 'browse' or the virtual filesystem, is appended to the audit log as a line of JSON recording the time, user, process ID, command, arguments, number of rows of files, tags, values, taggings, implications, exclusions, notes, saved queries and settings changed, duration in seconds and any error. The audit log is audit.log in the .tmsu directory holding the database or, for a database elsewhere, the database's path with '.audit.log' appended, and has the same permissions as the database. Once it reaches the auditLogMaxSize setting, '10M' by default, it is renamed to audit.log.1, with up to three earlier logs kept; '0' disables rotation.
+
+The expiredTags setting determines what happens to tags applied with 'tmsu tag --until' once they expire: 'remove' (the default) removes them whilst 'archive' replaces each with an 'expired' tag having the expired tag's name as its value, e.g. 'expired=urgent'. Expired tags are swept before each command is run.
+
+The verifySchedule, pruneSchedule and vacuumSchedule settings determine how often 'tmsu maintain' runs each maintenance job: 'never', 'daily', 'weekly' or 'monthly'. By default files are verified daily, the database is vacuumed weekly and missing files are never pruned. The verifyFiles setting is the number of files each run of the verify job checks, 100 by default.
+
+The confirmFileCount setting is the number of files, 100 by default, that 'untag', 'delete' and 'repair --remove' may affect before confirmation is requested, unless their --yes option is given. '0' disables confirmation.
+
+CONFIG may also define command aliases, one per line, as 'alias NAME = EXPANSION'. Where NAME is used in place of a subcommand it is replaced by EXPANSION, a subcommand with, optionally, some of its options and arguments: any further arguments follow those of the expansion. An alias cannot replace a built-in subcommand. The defined aliases are listed by 'tmsu help'.
+
+A setting's value is taken from, in order of precedence: a command-line option that overrides it (e.g. --color), the database, the global configuration file and finally the built-in default.`,
+	Examples: []string{"$ tmsu config autoCreateTags",
+		"$ tmsu config autoCreateTags=no",
+		"$ tmsu config allowSpacesInNames=yes",
+		"$ tmsu config canonicalPaths=symlinks",
+		"$ tmsu config --global color=never"},
+	Options:    Options{Option{"--global", "-g", "view or amend the global configuration file", false, ""}},
+	Exec:       configExec,
+	ModifiesIf: configModifies,
+}
+
+// Updating the database's settings modifies it. Setting readOnly alone is
+// excepted, as it must remain possible whilst the database is read-only.
+func configModifies(options Options, args []string) bool {
+	if options.HasOption("--global") {
+		return false
+	}
+
+	for _, arg := range args {
+		if index := strings.Index(arg, "="); index != -1 && arg[:index] != "readOnly" {
+			return true
+		}
+	}
+
+	return false
 }
 
 func configExec(store *storage.Storage, options Options, args []string) error {
-	tx, err := store.Begin()
+	colour, err := useColour(options)
 	if err != nil {
 		return err
 	}
-	defer tx.Commit()
 
-	colour, err := useColour(options)
+	if options.HasOption("--global") {
+		return configGlobal(args, colour)
+	}
+
+	tx, err := store.Begin()
 	if err != nil {
 		return err
 	}
+	defer tx.Commit()
 
 	if len(args) == 0 {
 		if err := listAllSettings(store, tx, colour); err != nil {
@@ -60,7 +116,7 @@ func configExec(store *storage.Storage, options Options, args []string) error {
 	}
 
 	for _, arg := range args {
-		parts := strings.Split(arg, "=")
+		parts := strings.SplitN(arg, "=", 2)
 		switch len(parts) {
 		case 1:
 			name := parts[0]
@@ -84,6 +140,58 @@ func configExec(store *storage.Storage, options Options, args []string) error {
 
 // unexported
 
+func configGlobal(args []string, colour bool) error {
+	settings := storage.DefaultSettings()
+
+	if len(args) == 0 {
+		for _, setting := range settings {
+			printSettingNameValue(setting.Name, setting.Value, colour)
+		}
+
+		return nil
+	}
+
+	for _, arg := range args {
+		parts := strings.SplitN(arg, "=", 2)
+		switch len(parts) {
+		case 1:
+			name := parts[0]
+			if !settings.ContainsName(name) {
+				return fmt.Errorf("no such setting '%v'", name)
+			}
+
+			if len(args) == 1 {
+				fmt.Println(settings.Value(name))
+			} else {
+				printSettingNameValue(name, settings.Value(name), colour)
+			}
+		case 2:
+			name := parts[0]
+			value := parts[1]
+
+			if value == "" {
+				return fmt.Errorf("setting '%v' value must be specified", name)
+			}
+
+			if err := storage.UpdateGlobalSetting(name, value); err != nil {
+				return fmt.Errorf("could not amend setting '%v' to '%v': %v", name, value, err)
+			}
+		default:
+			return fmt.Errorf("invalid argument, '%v'", arg)
+		}
+	}
+
+	return nil
+}
+
+func printSettingNameValue(name, value string, colour bool) {
+	if colour {
+		value = ansi.Green(value)
+	}
+
+	fmt.Printf("%v=%v\n", name, value)
+}
+
 func listAllSettings(store *storage.Storage, tx *storage.Tx, colour bool) error {
 	settings, err := store.Settings(tx)
 	if err != nil {
@@ -0,0 +1,98 @@
+// Copyright 2011-2015 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package cli
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"tmsu/storage"
+)
+
+func TestConfigGlobalPrecedence(test *testing.T) {
+	// set-up
+
+	configHome := filepath.Join(os.TempDir(), "tmsu_test_config")
+	defer os.RemoveAll(configHome)
+
+	previous := os.Getenv("XDG_CONFIG_HOME")
+	os.Setenv("XDG_CONFIG_HOME", configHome)
+	defer os.Setenv("XDG_CONFIG_HOME", previous)
+
+	databasePath := testDatabase()
+	defer os.Remove(databasePath)
+
+	err := redirectStreams()
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer restoreStreams()
+
+	globalOption := Options{Option{"--global", "-g", "", false, ""}}
+
+	if err := ConfigCommand.Exec(nil, globalOption, []string{"autoCreateTags=no", "autoCreateValues=no"}); err != nil {
+		test.Fatal(err)
+	}
+
+	store, err := storage.OpenAt(databasePath)
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer store.Close()
+
+	// test
+
+	if err := ConfigCommand.Exec(store, Options{}, []string{"autoCreateValues=yes"}); err != nil {
+		test.Fatal(err)
+	}
+	if err := ConfigCommand.Exec(store, Options{}, []string{"autoCreateTags", "autoCreateValues"}); err != nil {
+		test.Fatal(err)
+	}
+
+	// validate
+
+	outFile.Seek(0, 0)
+
+	bytes, err := ioutil.ReadAll(outFile)
+	compareOutput(test, "autoCreateTags=no\nautoCreateValues=yes\n", string(bytes))
+}
+
+func TestConfigInvalidVfsCacheTimeout(test *testing.T) {
+	// set-up
+
+	databasePath := testDatabase()
+	defer os.Remove(databasePath)
+
+	store, err := storage.OpenAt(databasePath)
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer store.Close()
+
+	// test
+
+	err = ConfigCommand.Exec(store, Options{}, []string{"vfsCacheTimeout=soon"})
+
+	// validate
+
+	if err == nil {
+		test.Fatal("Expected an error for an invalid duration.")
+	}
+	if err := ConfigCommand.Exec(store, Options{}, []string{"vfsCacheTimeout=250ms"}); err != nil {
+		test.Fatal(err)
+	}
+}
@@ -29,8 +29,9 @@ var CopyCommand = Command{
 	Description: `Creates a new tag NEW applied to the same set of files as TAG.`,
 	Examples: []string{"$ tmsu copy cheese wine",
 		"$ tmsu copy report document text"},
-	Options: Options{},
-	Exec:    copyExec,
+	Options:  Options{},
+	Exec:     copyExec,
+	Modifies: true,
 }
 
 func copyExec(store *storage.Storage, options Options, args []string) error {
@@ -52,7 +53,7 @@ func copyExec(store *storage.Storage, options Options, args []string) error {
 		return fmt.Errorf("could not retrieve tag '%v': %v", sourceTagName, err)
 	}
 	if sourceTag == nil {
-		return fmt.Errorf("no such tag '%v'", sourceTagName)
+		return noSuchTagError(sourceTagName)
 	}
 
 	wereErrors := false
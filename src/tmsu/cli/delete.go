@@ -18,19 +18,23 @@ package cli
 import (
 	"fmt"
 	"tmsu/common/log"
+	"tmsu/entities"
 	"tmsu/storage"
 )
 
 var DeleteCommand = Command{
-	Name:        "delete",
-	Aliases:     []string{"del", "rm"},
-	Synopsis:    "Delete one or more tags",
-	Usages:      []string{"tmsu delete TAG..."},
-	Description: `Permanently deletes the TAGs specified.`,
+	Name:     "delete",
+	Aliases:  []string{"del", "rm"},
+	Synopsis: "Delete one or more tags",
+	Usages:   []string{"tmsu delete TAG..."},
+	Description: `Permanently deletes the TAGs specified.
+
+Confirmation is requested before deleting tags applied to more files than the 'confirmFileCount' setting allows (100 by default) unless --yes is specified. Where standard input is not a terminal the tags are not deleted.`,
 	Examples: []string{"$ tmsu delete pineapple",
 		"$ tmsu delete red green blue"},
-	Options: Options{},
-	Exec:    deleteExec,
+	Options:  Options{Option{"--yes", "-y", "delete the tags without asking for confirmation", false, ""}},
+	Exec:     deleteExec,
+	Modifies: true,
 }
 
 func deleteExec(store *storage.Storage, options Options, args []string) error {
@@ -44,6 +48,14 @@ func deleteExec(store *storage.Storage, options Options, args []string) error {
 	}
 	defer tx.Commit()
 
+	count, err := countTaggedFiles(store, tx, args)
+	if err != nil {
+		return err
+	}
+	if err := confirmFileCount(store, tx, options, "delete tags from", count); err != nil {
+		return err
+	}
+
 	wereErrors := false
 	for _, tagName := range args {
 		tag, err := store.TagByName(tx, tagName)
@@ -63,8 +75,33 @@ func deleteExec(store *storage.Storage, options Options, args []string) error {
 	}
 
 	if wereErrors {
-		return errBlank
+		return errNoSuchTag
 	}
 
 	return nil
 }
+
+// Counts the files to which any of the named tags is applied.
+func countTaggedFiles(store *storage.Storage, tx *storage.Tx, tagNames []string) (uint, error) {
+	fileIds := make(map[entities.FileId]bool)
+	for _, tagName := range tagNames {
+		tag, err := store.TagByName(tx, tagName)
+		if err != nil {
+			return 0, fmt.Errorf("could not retrieve tag '%v': %v", tagName, err)
+		}
+		if tag == nil {
+			continue
+		}
+
+		fileTags, err := store.FileTagsByTagId(tx, tag.Id, false)
+		if err != nil {
+			return 0, fmt.Errorf("could not retrieve files for tag '%v': %v", tagName, err)
+		}
+
+		for _, fileTag := range fileTags {
+			fileIds[fileTag.FileId] = true
+		}
+	}
+
+	return uint(len(fileIds)), nil
+}
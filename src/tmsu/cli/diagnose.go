@@ -0,0 +1,144 @@
+// Copyright 2011-2015 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"tmsu/api"
+	"tmsu/entities"
+	"tmsu/storage"
+)
+
+var DiagnoseCommand = Command{
+	Name:     "diagnose",
+	Synopsis: "Show a report for attaching to bug reports",
+	Usages:   []string{"tmsu diagnose [OPTION]..."},
+	Description: `Shows a report on the database and the platform for attaching to bug reports about performance or corruption: the TMSU, Go and SQLite versions, the schema version, the number of rows in each table, the indexes and their statistics, the problems found by an integrity check, the settings and the time taken by a representative set of queries, slowest first.
+
+The report does not include file, tag or value names. Paths, including those in settings, are replaced by hashes that differ between reports.
+
+The index statistics are only shown once gathered by running 'ANALYZE' against the database.`,
+	Examples: []string{"$ tmsu diagnose >diagnostics.txt",
+		"$ tmsu diagnose --format=json"},
+	Options: Options{Option{"--format", "-f", "output format: text, json", true, ""}},
+	Exec:    diagnoseExec,
+}
+
+// unexported
+
+func diagnoseExec(store *storage.Storage, options Options, args []string) error {
+	if len(args) > 0 {
+		return fmt.Errorf("too many arguments")
+	}
+
+	format := "text"
+	if options.HasOption("--format") {
+		format = options.Get("--format").Argument
+	}
+	if format != "text" && format != "json" {
+		return fmt.Errorf("invalid format '%v': must be one of text, json", format)
+	}
+
+	colour, err := useColour(options)
+	if err != nil {
+		return err
+	}
+
+	tx, err := store.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Commit()
+
+	diagnostics, err := api.Diagnose(store, tx)
+	if err != nil {
+		return err
+	}
+
+	if format == "json" {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(diagnostics); err != nil {
+			return fmt.Errorf("could not encode diagnostics: %v", err)
+		}
+
+		return nil
+	}
+
+	printDiagnostics(diagnostics, colour)
+
+	return nil
+}
+
+func printDiagnostics(diagnostics *api.Diagnostics, colour bool) {
+	stats := diagnostics.Statistics
+
+	printInfo("TMSU", diagnostics.Version, colour)
+	printInfo("Platform", diagnostics.Platform, colour)
+	printInfo("Go", diagnostics.GoVersion, colour)
+	printInfo("Engine", stats.Engine, colour)
+	printInfo("Database", diagnostics.Database, colour)
+	printInfo("Root path", diagnostics.RootPath, colour)
+	printInfo("Size", diagnostics.Size, colour)
+	printInfo("Schema version", stats.SchemaVersion, colour)
+	printInfo("Pages", fmt.Sprintf("%v of %v bytes (%v free)", stats.PageCount, stats.PageSize, stats.FreePages), colour)
+
+	printStatsHeading("Rows", colour)
+	for _, table := range stats.Tables {
+		fmt.Printf("  %v %v\n", formatStatsCount(maxTableRows(stats), table.Rows, colour), table.Name)
+	}
+
+	printStatsHeading("Indexes", colour)
+	for _, index := range stats.Indexes {
+		if index.Stat == "" {
+			fmt.Printf("  %v on %v\n", index.Name, index.Table)
+		} else {
+			fmt.Printf("  %v on %v: %v\n", index.Name, index.Table, index.Stat)
+		}
+	}
+
+	printStatsHeading("Integrity", colour)
+	if len(stats.Integrity) == 0 {
+		fmt.Println("  ok")
+	}
+	for _, problem := range stats.Integrity {
+		fmt.Printf("  %v\n", problem)
+	}
+	fmt.Printf("  %v orphaned taggings, %v implications, %v exclusions\n", diagnostics.Orphans.FileTags, diagnostics.Orphans.Implications, diagnostics.Orphans.Exclusions)
+
+	printStatsHeading("Settings", colour)
+	for _, setting := range diagnostics.Settings {
+		fmt.Printf("  %v=%v\n", setting.Name, setting.Value)
+	}
+
+	printStatsHeading("Queries, slowest first", colour)
+	for _, timing := range diagnostics.QueryTimings {
+		fmt.Printf("  %10v %v (%v results)\n", timing.Duration, timing.Description, timing.Results)
+	}
+}
+
+func maxTableRows(stats *entities.DatabaseStatistics) uint {
+	var max uint
+	for _, table := range stats.Tables {
+		if table.Rows > max {
+			max = table.Rows
+		}
+	}
+
+	return max
+}
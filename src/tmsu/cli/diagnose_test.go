@@ -0,0 +1,99 @@
+// Copyright 2011-2015 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package cli
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+	"tmsu/api"
+	"tmsu/storage"
+)
+
+func TestDiagnoseHashesPaths(test *testing.T) {
+	// set-up
+
+	databasePath := testDatabase()
+	defer os.Remove(databasePath)
+
+	err := redirectStreams()
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer restoreStreams()
+
+	store, err := storage.OpenAt(databasePath)
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer store.Close()
+
+	defer os.RemoveAll("/tmp/tmsu/diagnose")
+
+	if err := createFile("/tmp/tmsu/diagnose/secret-report", "a"); err != nil {
+		test.Fatal(err)
+	}
+	if err := TagCommand.Exec(store, Options{}, []string{"/tmp/tmsu/diagnose/secret-report", "confidential"}); err != nil {
+		test.Fatal(err)
+	}
+	if err := ConfigCommand.Exec(store, Options{}, []string{"pathOnlyFiles=/tmp/tmsu/diagnose/*"}); err != nil {
+		test.Fatal(err)
+	}
+
+	// test
+
+	if err := DiagnoseCommand.Exec(store, Options{Option{"--format", "-f", "", true, "json"}}, []string{}); err != nil {
+		test.Fatal(err)
+	}
+
+	// validate
+
+	outFile.Seek(0, 0)
+
+	bytes, err := ioutil.ReadAll(outFile)
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	for _, text := range []string{"/tmp", "secret-report", "confidential"} {
+		if strings.Contains(string(bytes), text) {
+			test.Fatalf("report contains '%v':\n%v", text, string(bytes))
+		}
+	}
+
+	var diagnostics api.Diagnostics
+	if err := json.Unmarshal(bytes, &diagnostics); err != nil {
+		test.Fatal(err)
+	}
+
+	if !strings.HasPrefix(diagnostics.Database, "path:") {
+		test.Fatalf("expected the database path to be hashed but was '%v'", diagnostics.Database)
+	}
+
+	rows := make(map[string]uint)
+	for _, table := range diagnostics.Statistics.Tables {
+		rows[table.Name] = table.Rows
+	}
+	if rows["file"] != 1 || rows["tag"] != 1 || rows["file_tag"] != 1 {
+		test.Fatalf("unexpected row counts %v", rows)
+	}
+
+	if len(diagnostics.QueryTimings) == 0 {
+		test.Fatal("expected query timings")
+	}
+}
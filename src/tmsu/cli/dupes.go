@@ -19,27 +19,98 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"strconv"
+	"strings"
+	"tmsu/api"
 	"tmsu/common/filesystem"
 	"tmsu/common/fingerprint"
 	"tmsu/common/log"
 	_path "tmsu/common/path"
+	"tmsu/common/progress"
+	"tmsu/common/terminal"
+	"tmsu/common/terminal/ansi"
 	"tmsu/entities"
 	"tmsu/storage"
 )
 
 var DupesCommand = Command{
-	Name:        "dupes",
-	Synopsis:    "Identify duplicate files",
-	Usages:      []string{"tmsu dupes [FILE]..."},
-	Description: `Identifies all files in the database that are exact duplicates of FILE. If no FILE is specified then identifies duplicates between files in the database.`,
+	Name:     "dupes",
+	Synopsis: "Identify duplicate files",
+	Usages:   []string{"tmsu dupes [OPTION]... [FILE]..."},
+	Description: `Identifies all files in the database that are exact duplicates of FILE. If no FILE is specified then identifies duplicates between files in the database.
+
+When run with the --merge-tags option, every file in each set of duplicates within the database is given the union of the set's tags, so that tags applied to one copy of a file are not lost when another copy is used. The tags added to each file are shown alongside it.
+
+Duplicates are identified by the fingerprints calculated with the 'fileFingerprintAlgorithm' setting. The --confirm option additionally compares the duplicates found by the fingerprints of a further ALGORITHM, calculating these only for those files and recording them for later use. This allows a quick algorithm, such as 'dynamic:CRC64', to be used for fingerprinting whilst a strong one, such as 'SHA256', confirms its matches.
+
+The --similar-images option instead identifies images (GIF, JPEG or PNG files) that look alike, such as resized or re-encoded copies, by their perceptual hashes. Images are similar where their hashes differ by no more than --distance bits (out of 64, default 10). The hashes are recorded in the database as they are calculated.
+
+The --similar-audio option identifies audio files holding the same recording in different encodings or at different bit-rates, by their acoustic fingerprints. These are calculated by the command named by the 'audioFingerprinter' setting, by default Chromaprint's 'fpcalc -raw', and recorded in the database. Sets whose files are all exact duplicates are not reported: these are listed by 'tmsu dupes' alone.`,
 	Examples: []string{"$ tmsu dupes\nSet of 2 duplicates:\n  /tmp/song.mp3\n  /tmp/copy of song.mp3a",
-		"$ tmsu dupes /tmp/song.mp3\n/tmp/copy of song.mp3"},
-	Options: Options{Option{"--recursive", "-r", "recursively check directory contents", false, ""}},
-	Exec:    dupesExec,
+		"$ tmsu dupes /tmp/song.mp3\n/tmp/copy of song.mp3",
+		"$ tmsu dupes --merge-tags\nSet of 2 duplicates:\n  /tmp/song.mp3 (+music)\n  /tmp/copy of song.mp3 (+year=2015)",
+		"$ tmsu dupes --confirm=SHA256",
+		"$ tmsu dupes --similar-images --distance=5 ~/photos/beach.jpg",
+		"$ tmsu dupes --similar-audio\nSet of 2 similar recordings:\n  /tmp/song.flac\n  /tmp/song.mp3"},
+	Options: Options{Option{"--recursive", "-r", "recursively check directory contents", false, ""},
+		Option{"--merge-tags", "-m", "apply the union of each duplicate set's tags to all of its files", false, ""},
+		Option{"--confirm", "-c", "confirm duplicates using the fingerprints of a further ALGORITHM", true, ""},
+		Option{"--similar-images", "-s", "identify images that look alike", false, ""},
+		Option{"--similar-audio", "-a", "identify audio files holding the same recording", false, ""},
+		Option{"--distance", "-d", "the maximum number of differing bits for images to be similar", true, ""}},
+	Exec:       dupesExec,
+	ModifiesIf: dupesModifies,
+}
+
+// Merging the duplicates' tags modifies the database.
+func dupesModifies(options Options, args []string) bool {
+	return options.HasOption("--merge-tags")
 }
 
 func dupesExec(store *storage.Storage, options Options, args []string) error {
 	recursive := options.HasOption("--recursive")
+	mergeTags := options.HasOption("--merge-tags")
+
+	confirm := ""
+	if options.HasOption("--confirm") {
+		confirm = options.Get("--confirm").Argument
+		if !fingerprint.IsContentAlgorithm(confirm) {
+			return fmt.Errorf("unsupported fingerprint algorithm '%v'", confirm)
+		}
+	}
+
+	if options.HasOption("--similar-images") && options.HasOption("--similar-audio") {
+		return fmt.Errorf("--similar-images cannot be used with --similar-audio")
+	}
+
+	if confirm != "" && (options.HasOption("--similar-images") || options.HasOption("--similar-audio")) {
+		return fmt.Errorf("--confirm cannot be used with --similar-images or --similar-audio")
+	}
+
+	var similar *similarFiles
+	if options.HasOption("--similar-images") {
+		distance := defaultImageDistance
+		if options.HasOption("--distance") {
+			value, err := strconv.ParseUint(options.Get("--distance").Argument, 10, 0)
+			if err != nil || value > 64 {
+				return fmt.Errorf("invalid distance '%v': must be a number of bits from 0 to 64", options.Get("--distance").Argument)
+			}
+
+			distance = int(value)
+		}
+
+		similar = newSimilarImages(distance)
+	}
+
+	if mergeTags {
+		if len(args) > 0 {
+			return fmt.Errorf("--merge-tags cannot be used with files")
+		}
+
+		if err := checkWritable(store, "merge tags"); err != nil {
+			return err
+		}
+	}
 
 	tx, err := store.Begin()
 	if err != nil {
@@ -47,24 +118,51 @@ func dupesExec(store *storage.Storage, options Options, args []string) error {
 	}
 	defer tx.Commit()
 
+	if options.HasOption("--similar-audio") {
+		settings, err := store.Settings(tx)
+		if err != nil {
+			return err
+		}
+
+		fingerprinter := api.NewAudioFingerprinter(settings)
+		if fingerprinter == nil {
+			return fmt.Errorf("no audio fingerprinter: set the 'audioFingerprinter' setting")
+		}
+
+		similar = newSimilarAudio(fingerprinter)
+	}
+
 	switch len(args) {
 	case 0:
-		return findDuplicatesInDb(store, tx)
+		return findDuplicatesInDb(store, tx, mergeTags, confirm, similar)
 	default:
-		return findDuplicatesOf(store, tx, args, recursive)
+		return findDuplicatesOf(store, tx, args, recursive, confirm, similar)
 	}
 
 	return nil
 }
 
-func findDuplicatesInDb(store *storage.Storage, tx *storage.Tx) error {
+func findDuplicatesInDb(store *storage.Storage, tx *storage.Tx, mergeTags bool, confirm string, similar *similarFiles) error {
 	log.Info(2, "identifying duplicate files.")
 
-	fileSets, err := store.DuplicateFiles(tx)
+	var fileSets []entities.Files
+	var err error
+	if similar != nil {
+		fileSets, err = similar.sets(store, tx)
+	} else {
+		fileSets, err = store.DuplicateFiles(tx)
+	}
 	if err != nil {
 		return fmt.Errorf("could not identify duplicate files: %v", err)
 	}
 
+	if confirm != "" {
+		fileSets, err = confirmDuplicates(store, tx, fileSets, confirm)
+		if err != nil {
+			return err
+		}
+	}
+
 	log.Infof(2, "found %v sets of duplicate files.", len(fileSets))
 
 	for index, fileSet := range fileSets {
@@ -72,18 +170,118 @@ func findDuplicatesInDb(store *storage.Storage, tx *storage.Tx) error {
 			fmt.Println()
 		}
 
-		fmt.Printf("Set of %v duplicates:\n", len(fileSet))
+		var addedTagNames map[entities.FileId][]string
+		if mergeTags {
+			addedTagNames, err = mergeDuplicateTags(store, tx, fileSet)
+			if err != nil {
+				return err
+			}
+		}
+
+		description := "duplicates"
+		if similar != nil {
+			description = similar.description
+		}
+
+		fmt.Println(terminal.Colourise(os.Stdout, ansi.Bold, fmt.Sprintf("Set of %v %v:", len(fileSet), description)))
 
 		for _, file := range fileSet {
 			relPath := _path.Rel(file.Path())
-			fmt.Printf("  %v\n", relPath)
+
+			if tagNames := addedTagNames[file.Id]; len(tagNames) > 0 {
+				fmt.Printf("  %v (+%v)\n", relPath, strings.Join(escapeNames(tagNames), " +"))
+			} else {
+				fmt.Printf("  %v\n", relPath)
+			}
 		}
 	}
 
 	return nil
 }
 
-func findDuplicatesOf(store *storage.Storage, tx *storage.Tx, paths []string, recursive bool) error {
+// Divides the sets of duplicates by the files' fingerprints using the specified
+// algorithm, omitting files that are then without duplicates.
+func confirmDuplicates(store *storage.Storage, tx *storage.Tx, fileSets []entities.Files, algorithm string) ([]entities.Files, error) {
+	log.Infof(2, "confirming duplicates using '%v' fingerprints.", algorithm)
+
+	confirmed := make([]entities.Files, 0, len(fileSets))
+	for _, fileSet := range fileSets {
+		fingerprints := make([]fingerprint.Fingerprint, 0, len(fileSet))
+		filesByFingerprint := make(map[fingerprint.Fingerprint]entities.Files, len(fileSet))
+
+		for _, file := range fileSet {
+			fp, err := store.FileFingerprint(tx, file, algorithm)
+			if err != nil {
+				return nil, fmt.Errorf("%v: could not create fingerprint: %v", file.Path(), err)
+			}
+			if fp == fingerprint.Empty {
+				continue
+			}
+
+			if _, ok := filesByFingerprint[fp]; !ok {
+				fingerprints = append(fingerprints, fp)
+			}
+			filesByFingerprint[fp] = append(filesByFingerprint[fp], file)
+		}
+
+		for _, fp := range fingerprints {
+			if files := filesByFingerprint[fp]; len(files) > 1 {
+				confirmed = append(confirmed, files)
+			}
+		}
+	}
+
+	return confirmed, nil
+}
+
+// Applies the union of the explicit tags of a set of duplicates to each of
+// them, returning the names of the tags added to each file.
+func mergeDuplicateTags(store *storage.Storage, tx *storage.Tx, fileSet entities.Files) (map[entities.FileId][]string, error) {
+	fileTagsByFileId := make(map[entities.FileId]entities.FileTags, len(fileSet))
+	union := make(entities.FileTags, 0, 10)
+
+	for _, file := range fileSet {
+		fileTags, err := store.FileTagsByFileId(tx, file.Id, true)
+		if err != nil {
+			return nil, fmt.Errorf("%v: could not retrieve file tags: %v", file.Path(), err)
+		}
+
+		fileTagsByFileId[file.Id] = fileTags
+
+		for _, fileTag := range fileTags {
+			if !union.Contains(fileTag.TagId, fileTag.ValueId) {
+				union = append(union, fileTag)
+			}
+		}
+	}
+
+	addedTagNames := make(map[entities.FileId][]string, len(fileSet))
+
+	for _, file := range fileSet {
+		for _, fileTag := range union {
+			if fileTagsByFileId[file.Id].Contains(fileTag.TagId, fileTag.ValueId) {
+				continue
+			}
+
+			log.Infof(2, "%v: applying tag #%v", file.Path(), fileTag.TagId)
+
+			if _, err := store.AddFileTag(tx, file.Id, fileTag.TagId, fileTag.ValueId); err != nil {
+				return nil, fmt.Errorf("%v: could not apply tags: %v", file.Path(), err)
+			}
+
+			tagName, err := fileTagName(store, tx, fileTag, false)
+			if err != nil {
+				return nil, err
+			}
+
+			addedTagNames[file.Id] = append(addedTagNames[file.Id], tagName)
+		}
+	}
+
+	return addedTagNames, nil
+}
+
+func findDuplicatesOf(store *storage.Storage, tx *storage.Tx, paths []string, recursive bool, confirm string, similar *similarFiles) error {
 	settings, err := store.Settings(tx)
 	if err != nil {
 		return err
@@ -124,32 +322,30 @@ func findDuplicatesOf(store *storage.Storage, tx *storage.Tx, paths []string, re
 		}
 	}
 
+	reporter := progress.New("identifying duplicates", len(paths))
+	defer reporter.Done()
+
 	first := true
 	for _, path := range paths {
-		log.Infof(2, "%v: identifying duplicate files.", path)
+		reporter.Increment()
 
-		fp, err := fingerprint.Create(path, settings.FileFingerprintAlgorithm(), settings.DirectoryFingerprintAlgorithm())
-		if err != nil {
-			return fmt.Errorf("%v: could not create fingerprint: %v", path, err)
-		}
+		log.Infof(2, "%v: identifying duplicate files.", path)
 
-		if fp == fingerprint.Fingerprint("") {
-			continue
+		var dupes entities.Files
+		var err error
+		if similar != nil {
+			dupes, err = similar.of(store, tx, path)
+		} else {
+			dupes, err = duplicatesOf(store, tx, path, confirm, settings)
 		}
-
-		files, err := store.FilesByFingerprint(tx, fp)
 		if err != nil {
-			return fmt.Errorf("%v: could not retrieve files matching fingerprint '%v': %v", path, fp, err)
+			return err
 		}
 
-		absPath, err := filepath.Abs(path)
-		if err != nil {
-			return fmt.Errorf("%v: could not determine absolute path: %v", path, err)
+		if len(dupes) > 0 {
+			reporter.Clear()
 		}
 
-		// filter out the file we're searching on
-		dupes := files.Where(func(file *entities.File) bool { return file.Path() != absPath })
-
 		if len(paths) > 1 && len(dupes) > 0 {
 			if first {
 				first = false
@@ -157,7 +353,7 @@ func findDuplicatesOf(store *storage.Storage, tx *storage.Tx, paths []string, re
 				fmt.Println()
 			}
 
-			fmt.Printf("%v:\n", path)
+			fmt.Println(terminal.Colourise(os.Stdout, ansi.Bold, path+":"))
 
 			for _, dupe := range dupes {
 				relPath := _path.Rel(dupe.Path())
@@ -173,3 +369,58 @@ func findDuplicatesOf(store *storage.Storage, tx *storage.Tx, paths []string, re
 
 	return nil
 }
+
+// Identifies the files in the database that are duplicates of the file at the
+// path.
+func duplicatesOf(store *storage.Storage, tx *storage.Tx, path, confirm string, settings entities.Settings) (entities.Files, error) {
+	fp, err := store.Fingerprint(tx, path, settings.FileFingerprintAlgorithm(), settings.DirectoryFingerprintAlgorithm())
+	if err != nil {
+		return nil, fmt.Errorf("%v: could not create fingerprint: %v", path, err)
+	}
+
+	if fp == fingerprint.Fingerprint("") {
+		return entities.Files{}, nil
+	}
+
+	files, err := store.FilesByFingerprint(tx, fp)
+	if err != nil {
+		return nil, fmt.Errorf("%v: could not retrieve files matching fingerprint '%v': %v", path, fp, err)
+	}
+
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return nil, fmt.Errorf("%v: could not determine absolute path: %v", path, err)
+	}
+
+	// filter out the file we're searching on
+	dupes := files.Where(func(file *entities.File) bool { return file.Path() != absPath })
+
+	if confirm != "" && len(dupes) > 0 {
+		return confirmDuplicatesOf(store, tx, path, dupes, confirm, settings)
+	}
+
+	return dupes, nil
+}
+
+// Retains only those duplicates whose fingerprints using the specified
+// algorithm match that of the file at the path.
+func confirmDuplicatesOf(store *storage.Storage, tx *storage.Tx, path string, dupes entities.Files, algorithm string, settings entities.Settings) (entities.Files, error) {
+	fp, err := store.Fingerprint(tx, path, algorithm, settings.DirectoryFingerprintAlgorithm())
+	if err != nil {
+		return nil, fmt.Errorf("%v: could not create fingerprint: %v", path, err)
+	}
+
+	confirmed := make(entities.Files, 0, len(dupes))
+	for _, dupe := range dupes {
+		dupeFingerprint, err := store.FileFingerprint(tx, dupe, algorithm)
+		if err != nil {
+			return nil, fmt.Errorf("%v: could not create fingerprint: %v", dupe.Path(), err)
+		}
+
+		if dupeFingerprint != fingerprint.Empty && dupeFingerprint == fp {
+			confirmed = append(confirmed, dupe)
+		}
+	}
+
+	return confirmed, nil
+}
@@ -16,9 +16,14 @@
 package cli
 
 import (
+	"image"
+	"image/color"
+	"image/png"
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"strconv"
+	"strings"
 	"testing"
 	"time"
 	"tmsu/common/fingerprint"
@@ -402,3 +407,314 @@ func TestDupesNoneUntaggedFile(test *testing.T) {
 	bytes, err := ioutil.ReadAll(outFile)
 	compareOutput(test, "", string(bytes))
 }
+
+func TestDupesMergeTags(test *testing.T) {
+	// set-up
+
+	databasePath := testDatabase()
+	defer os.Remove(databasePath)
+
+	err := redirectStreams()
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer restoreStreams()
+
+	store, err := storage.OpenAt(databasePath)
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer store.Close()
+
+	if err := createFile("/tmp/tmsu/a", "hello"); err != nil {
+		test.Fatal(err)
+	}
+	defer os.Remove("/tmp/tmsu/a")
+
+	if err := createFile("/tmp/tmsu/b", "hello"); err != nil {
+		test.Fatal(err)
+	}
+	defer os.Remove("/tmp/tmsu/b")
+
+	if err := TagCommand.Exec(store, Options{}, []string{"/tmp/tmsu/a", "music", "shared"}); err != nil {
+		test.Fatal(err)
+	}
+
+	if err := TagCommand.Exec(store, Options{}, []string{"/tmp/tmsu/b", "year=2015", "shared"}); err != nil {
+		test.Fatal(err)
+	}
+
+	// test
+
+	if err := DupesCommand.Exec(store, Options{Option{"--merge-tags", "-m", "", false, ""}}, []string{}); err != nil {
+		test.Fatal(err)
+	}
+
+	// validate
+
+	outFile.Seek(0, 0)
+
+	bytes, err := ioutil.ReadAll(outFile)
+	compareOutput(test, "Set of 2 duplicates:\n  /tmp/tmsu/a (+year=2015)\n  /tmp/tmsu/b (+music)\n", string(bytes))
+
+	tx, err := store.Begin()
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer tx.Commit()
+
+	for _, path := range []string{"/tmp/tmsu/a", "/tmp/tmsu/b"} {
+		file, err := store.FileByPath(tx, path)
+		if err != nil {
+			test.Fatal(err)
+		}
+
+		count, err := store.FileTagCountByFileId(tx, file.Id, true)
+		if err != nil {
+			test.Fatal(err)
+		}
+
+		if count != 3 {
+			test.Fatalf("%v: expected three tags but were %v.", path, count)
+		}
+	}
+}
+
+func TestDupesConfirm(test *testing.T) {
+	// set-up
+
+	databasePath := testDatabase()
+	defer os.Remove(databasePath)
+
+	err := redirectStreams()
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer restoreStreams()
+
+	store, err := storage.OpenAt(databasePath)
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer store.Close()
+
+	tx, err := store.Begin()
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	// the same (colliding) fingerprint but not all the same contents
+	for path, contents := range map[string]string{"/tmp/tmsu/a": "hello", "/tmp/tmsu/b": "hello", "/tmp/tmsu/c": "world"} {
+		if err := createFile(path, contents); err != nil {
+			test.Fatal(err)
+		}
+		defer os.Remove(path)
+
+		stat, err := os.Stat(path)
+		if err != nil {
+			test.Fatal(err)
+		}
+
+		if _, err := store.AddFile(tx, path, fingerprint.Fingerprint("abc"), stat.ModTime(), stat.Size(), false); err != nil {
+			test.Fatal(err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		test.Fatal(err)
+	}
+
+	// test
+
+	if err := DupesCommand.Exec(store, Options{Option{"--confirm", "-c", "", true, "SHA256"}}, []string{}); err != nil {
+		test.Fatal(err)
+	}
+
+	// validate
+
+	outFile.Seek(0, 0)
+
+	bytes, err := ioutil.ReadAll(outFile)
+	compareOutput(test, "Set of 2 duplicates:\n  /tmp/tmsu/a\n  /tmp/tmsu/b\n", string(bytes))
+
+	if err := ConfigCommand.Exec(store, Options{}, []string{"fileFingerprintAlgorithm=SHA1"}); err != nil {
+		test.Fatal(err)
+	}
+
+	tx, err = store.Begin()
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer tx.Commit()
+
+	file, err := store.FileByPath(tx, "/tmp/tmsu/c")
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	fp, err := store.FileFingerprint(tx, file, "dynamic:SHA256")
+	if err != nil {
+		test.Fatal(err)
+	}
+	if fp != fingerprint.Fingerprint("abc") {
+		test.Fatalf("Expected previous fingerprint to be kept but was '%v'.", fp)
+	}
+}
+
+func TestDupesSimilarImages(test *testing.T) {
+	// set-up
+
+	databasePath := testDatabase()
+	defer os.Remove(databasePath)
+
+	err := redirectStreams()
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer restoreStreams()
+
+	store, err := storage.OpenAt(databasePath)
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer store.Close()
+
+	// a resized copy of a gradient and the same gradient reversed
+	images := []struct {
+		path     string
+		size     int
+		reversed bool
+	}{{"/tmp/tmsu/a.png", 64, false}, {"/tmp/tmsu/b.png", 32, false}, {"/tmp/tmsu/c.png", 64, true}}
+
+	for _, image := range images {
+		if err := createGradientImage(image.path, image.size, image.reversed); err != nil {
+			test.Fatal(err)
+		}
+		defer os.Remove(image.path)
+
+		if err := TagCommand.Exec(store, Options{}, []string{image.path, "photo"}); err != nil {
+			test.Fatal(err)
+		}
+	}
+
+	outFile.Seek(0, 0)
+	outFile.Truncate(0)
+
+	// test
+
+	if err := DupesCommand.Exec(store, Options{Option{"--similar-images", "-s", "", false, ""}}, []string{}); err != nil {
+		test.Fatal(err)
+	}
+
+	// validate
+
+	outFile.Seek(0, 0)
+
+	bytes, err := ioutil.ReadAll(outFile)
+	compareOutput(test, "Set of 2 duplicates:\n  /tmp/tmsu/a.png\n  /tmp/tmsu/b.png\n", string(bytes))
+}
+
+// unexported
+
+func createGradientImage(path string, size int, reversed bool) error {
+	img := image.NewGray(image.Rect(0, 0, size, size))
+	for y := 0; y < size; y++ {
+		for x := 0; x < size; x++ {
+			level := (x*x + y) * 255 / (size*size + size)
+			if reversed {
+				level = 255 - level
+			}
+
+			img.SetGray(x, y, color.Gray{uint8(level)})
+		}
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	return png.Encode(file, img)
+}
+
+func TestDupesSimilarAudio(test *testing.T) {
+	// set-up
+
+	databasePath := testDatabase()
+	defer os.Remove(databasePath)
+
+	err := redirectStreams()
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer restoreStreams()
+
+	store, err := storage.OpenAt(databasePath)
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer store.Close()
+
+	// a stand-in for fpcalc: the files hold their own fingerprints
+	if err := createFile("/tmp/tmsu/fpcalc", "#!/bin/sh\necho DURATION=30\necho \"FINGERPRINT=$(cat \"$1\")\"\n"); err != nil {
+		test.Fatal(err)
+	}
+	defer os.Remove("/tmp/tmsu/fpcalc")
+	if err := os.Chmod("/tmp/tmsu/fpcalc", 0755); err != nil {
+		test.Fatal(err)
+	}
+
+	recording := make([]string, 30)
+	reencoded := make([]string, 30)
+	other := make([]string, 30)
+	for index := range recording {
+		recording[index] = strconv.Itoa(index + 1)
+		reencoded[index] = strconv.Itoa(index + 1)
+		other[index] = strconv.FormatUint(uint64(4294967295-index), 10)
+	}
+	reencoded[4] = "7"
+
+	files := []struct {
+		path        string
+		fingerprint []string
+	}{{"/tmp/tmsu/a.mp3", recording},
+		{"/tmp/tmsu/b.flac", reencoded},
+		{"/tmp/tmsu/c.mp3", other},
+		{"/tmp/tmsu/d.mp3", other}}
+
+	for _, file := range files {
+		if err := createFile(file.path, strings.Join(file.fingerprint, ",")); err != nil {
+			test.Fatal(err)
+		}
+		defer os.Remove(file.path)
+
+		if err := TagCommand.Exec(store, Options{}, []string{file.path, "music"}); err != nil {
+			test.Fatal(err)
+		}
+	}
+
+	if err := ConfigCommand.Exec(store, Options{}, []string{"audioFingerprinter=/tmp/tmsu/fpcalc"}); err != nil {
+		test.Fatal(err)
+	}
+
+	outFile.Seek(0, 0)
+	outFile.Truncate(0)
+
+	// test
+
+	if err := DupesCommand.Exec(store, Options{Option{"--similar-audio", "-a", "", false, ""}}, []string{}); err != nil {
+		test.Fatal(err)
+	}
+
+	// validate
+
+	outFile.Seek(0, 0)
+
+	bytes, err := ioutil.ReadAll(outFile)
+	compareOutput(test, "Set of 2 similar recordings:\n  /tmp/tmsu/a.mp3\n  /tmp/tmsu/b.flac\n", string(bytes))
+}
@@ -0,0 +1,78 @@
+// Copyright 2011-2015 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package cli
+
+import (
+	"fmt"
+	"tmsu/api"
+	"tmsu/storage"
+)
+
+var EmbedCommand = Command{
+	Name:     "embed",
+	Synopsis: "Embed tags in file names",
+	Usages:   []string{"tmsu embed [OPTION]... FILE...", "tmsu embed [OPTION]... --extract FILE..."},
+	Description: `Renames each FILE to include its tags in its name, updating its path in the database, so that the tags go with the file when it is shared with people who do not use TMSU.
+
+With --extract the reverse is done: the tags embedded in the name of each FILE are applied to it, creating the tags where the settings allow, and it is renamed to remove them.
+
+PATTERN determines the form of the names, with {name} replaced by the file's name without its extension, {tags} by its explicitly applied tags, separated by spaces, and {ext} by its extension. The extension is appended if PATTERN does not include {ext}. The default PATTERN is '{name} [{tags}]{ext}', e.g. 'beach [holiday year=2015].jpg'. Tags already embedded in a name are replaced and a file without tags is given its plain name. Files whose new name is already taken are skipped.
+
+As tags are separated by spaces in names, tags whose names contain spaces do not survive the round trip.`,
+	Examples: []string{"$ tmsu embed beach.jpg",
+		"$ tmsu embed --extract 'beach [holiday year=2015].jpg'",
+		"$ tmsu embed --pattern='{name}__{tags}{ext}' *.pdf"},
+	Options: Options{Option{"--pattern", "-p", "the form of the names with embedded tags", true, ""},
+		Option{"--extract", "-x", "apply the tags embedded in the names and remove them", false, ""},
+		Option{"--pretend", "-P", "list the files that would be renamed without renaming them", false, ""}},
+	Exec:     embedExec,
+	Modifies: true,
+}
+
+// unexported
+
+func embedExec(store *storage.Storage, options Options, args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("too few arguments")
+	}
+
+	patternText := api.DefaultEmbedPattern
+	if options.HasOption("--pattern") {
+		patternText = options.Get("--pattern").Argument
+	}
+
+	pattern, err := api.ParseEmbedPattern(patternText)
+	if err != nil {
+		return err
+	}
+
+	embedOptions := api.EmbedOptions{Pretend: options.HasOption("--pretend") || store.DryRun,
+		Report: func(path, newPath string) {
+			fmt.Printf("%v: renamed to %v\n", path, newPath)
+		}}
+
+	tx, err := store.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Commit()
+
+	if options.HasOption("--extract") {
+		return api.Extract(store, tx, args, pattern, embedOptions)
+	}
+
+	return api.Embed(store, tx, args, pattern, embedOptions)
+}
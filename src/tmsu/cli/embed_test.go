@@ -0,0 +1,92 @@
+// Copyright 2011-2015 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package cli
+
+import (
+	"os"
+	"testing"
+	"tmsu/storage"
+)
+
+func TestEmbedAndExtract(test *testing.T) {
+	// set-up
+
+	databasePath := testDatabase()
+	defer os.Remove(databasePath)
+
+	store, err := storage.OpenAt(databasePath)
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer store.Close()
+
+	defer os.RemoveAll("/tmp/tmsu/embed")
+
+	if err := createFile("/tmp/tmsu/embed/beach.jpg", "beach"); err != nil {
+		test.Fatal(err)
+	}
+
+	if err := TagCommand.Exec(store, Options{}, []string{"/tmp/tmsu/embed/beach.jpg", "holiday", "year=2015"}); err != nil {
+		test.Fatal(err)
+	}
+
+	// test
+
+	if err := EmbedCommand.Exec(store, Options{}, []string{"/tmp/tmsu/embed/beach.jpg"}); err != nil {
+		test.Fatal(err)
+	}
+
+	// validate
+
+	embeddedPath := "/tmp/tmsu/embed/beach [holiday year=2015].jpg"
+	if _, err := os.Stat(embeddedPath); err != nil {
+		test.Fatalf("Expected file to be renamed to '%v': %v", embeddedPath, err)
+	}
+	expectImportedTags(test, store, embeddedPath, "holiday", "year")
+
+	// test
+
+	if err := UntagCommand.Exec(store, Options{Option{"--all", "-a", "", false, ""}}, []string{embeddedPath}); err != nil {
+		test.Fatal(err)
+	}
+
+	if err := EmbedCommand.Exec(store, Options{Option{"--extract", "-x", "", false, ""}}, []string{embeddedPath}); err != nil {
+		test.Fatal(err)
+	}
+
+	// validate
+
+	if _, err := os.Stat("/tmp/tmsu/embed/beach.jpg"); err != nil {
+		test.Fatalf("Expected file to be renamed back: %v", err)
+	}
+	expectImportedTags(test, store, "/tmp/tmsu/embed/beach.jpg", "holiday", "year")
+}
+
+func TestEmbedInvalidPattern(test *testing.T) {
+	databasePath := testDatabase()
+	defer os.Remove(databasePath)
+
+	store, err := storage.OpenAt(databasePath)
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer store.Close()
+
+	options := Options{Option{"--pattern", "-p", "", true, "{name}{ext}"}}
+	if err := EmbedCommand.Exec(store, options, []string{"/tmp/tmsu/a"}); err == nil {
+		test.Fatalf("Expected a pattern without {tags} to be rejected.")
+	}
+}
@@ -0,0 +1,97 @@
+// Copyright 2011-2015 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package cli
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"tmsu/api"
+	"tmsu/entities"
+	"tmsu/storage"
+)
+
+var EmblemSyncCommand = Command{
+	Name:     "emblem-sync",
+	Synopsis: "Show tags in desktop file managers",
+	Usages:   []string{"tmsu emblem-sync [OPTION]... [FILE]..."},
+	Description: `Writes the tags of each FILE, or of every tagged file if no FILE is specified, to the file metadata that desktop file managers display, so that they show the same tags as the database.
+
+The tags are written, comma-separated, to the 'user.xdg.tags' extended attribute, which KDE Dolphin shows as the file's tags. With --gnome they are also set as the file's emblems in the GNOME (GIO) metadata store using 'gio': GNOME Files shows an emblem for each tag named after an emblem icon, such as 'emblem-favorite'.
+
+Run the command again after changing tags to bring the file managers up to date: only files whose tags have changed are updated and listed. With --clear the tags are removed from the file metadata instead.
+
+Extended attributes are only supported on Linux and by some file systems.`,
+	Examples: []string{"$ tmsu emblem-sync",
+		"$ tmsu emblem-sync --gnome ~/photos/*.jpg",
+		"$ tmsu emblem-sync --clear"},
+	Options: Options{Option{"--explicit", "-e", "do not include implied tags", false, ""},
+		Option{"--gnome", "-g", "also set the GNOME Files emblems", false, ""},
+		Option{"--clear", "-c", "remove the tags from the file metadata", false, ""},
+		Option{"--pretend", "-P", "list the files that would be updated without updating them", false, ""}},
+	Exec: emblemSyncExec,
+}
+
+// unexported
+
+func emblemSyncExec(store *storage.Storage, options Options, args []string) error {
+	emblemOptions := api.EmblemOptions{ExplicitOnly: options.HasOption("--explicit"),
+		Gnome:   options.HasOption("--gnome"),
+		Clear:   options.HasOption("--clear"),
+		Pretend: options.HasOption("--pretend") || store.DryRun,
+		Report: func(path string, tags []string) {
+			if len(tags) == 0 {
+				fmt.Printf("%v: cleared\n", path)
+			} else {
+				fmt.Printf("%v: %v\n", path, strings.Join(escapeNames(tags), " "))
+			}
+		}}
+
+	tx, err := store.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Commit()
+
+	var files entities.Files
+	if len(args) == 0 {
+		files, err = store.Files(tx, "name")
+		if err != nil {
+			return fmt.Errorf("could not retrieve files: %v", err)
+		}
+	} else {
+		files = make(entities.Files, 0, len(args))
+		for _, path := range args {
+			absPath, err := filepath.Abs(path)
+			if err != nil {
+				return fmt.Errorf("%v: could not get absolute path: %v", path, err)
+			}
+
+			file, err := store.FileByPath(tx, absPath)
+			if err != nil {
+				return fmt.Errorf("%v: could not retrieve file: %v", path, err)
+			}
+			if file == nil {
+				// an untagged file: its tags are cleared
+				file = &entities.File{Directory: filepath.Dir(absPath), Name: filepath.Base(absPath)}
+			}
+
+			files = append(files, file)
+		}
+	}
+
+	return api.SyncEmblems(store, tx, files, emblemOptions)
+}
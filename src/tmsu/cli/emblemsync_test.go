@@ -0,0 +1,93 @@
+// Copyright 2011-2015 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package cli
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+	"tmsu/api"
+	"tmsu/common/xattr"
+	"tmsu/storage"
+)
+
+func TestEmblemSync(test *testing.T) {
+	// set-up
+
+	databasePath := testDatabase()
+	defer os.Remove(databasePath)
+
+	err := redirectStreams()
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer restoreStreams()
+
+	store, err := storage.OpenAt(databasePath)
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer store.Close()
+
+	if err := createFile("/tmp/tmsu/a", "a"); err != nil {
+		test.Fatal(err)
+	}
+	defer os.Remove("/tmp/tmsu/a")
+
+	if err := xattr.Set("/tmp/tmsu/a", api.XdgTagsAttribute, []byte("stale")); err != nil {
+		test.Skipf("extended attributes are not available: %v", err)
+	}
+
+	if err := TagCommand.Exec(store, Options{}, []string{"/tmp/tmsu/a", "music", "year=2015"}); err != nil {
+		test.Fatal(err)
+	}
+
+	// test
+
+	if err := EmblemSyncCommand.Exec(store, Options{}, []string{}); err != nil {
+		test.Fatal(err)
+	}
+	if err := EmblemSyncCommand.Exec(store, Options{}, []string{}); err != nil {
+		test.Fatal(err)
+	}
+
+	// validate
+
+	value, err := xattr.Get("/tmp/tmsu/a", api.XdgTagsAttribute)
+	if err != nil {
+		test.Fatal(err)
+	}
+	if string(value) != "music,year=2015" {
+		test.Fatalf("Expected attribute 'music,year=2015' but was '%v'.", string(value))
+	}
+
+	if err := EmblemSyncCommand.Exec(store, Options{Option{"--clear", "-c", "", false, ""}}, []string{"/tmp/tmsu/a"}); err != nil {
+		test.Fatal(err)
+	}
+
+	value, err = xattr.Get("/tmp/tmsu/a", api.XdgTagsAttribute)
+	if err != nil {
+		test.Fatal(err)
+	}
+	if value != nil {
+		test.Fatalf("Expected attribute to be removed but was '%v'.", string(value))
+	}
+
+	outFile.Seek(0, 0)
+
+	bytes, err := ioutil.ReadAll(outFile)
+	compareOutput(test, "/tmp/tmsu/a: music year=2015\n/tmp/tmsu/a: cleared\n", string(bytes))
+}
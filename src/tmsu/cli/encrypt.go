@@ -0,0 +1,146 @@
+// Copyright 2011-2015 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package cli
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"tmsu/common/terminal"
+	"tmsu/storage"
+)
+
+var EncryptCommand = Command{
+	Name:     "encrypt",
+	Synopsis: "Encrypt the database with a passphrase",
+	Usages: []string{"tmsu encrypt [OPTION]...",
+		"tmsu encrypt --decrypt"},
+	Description: `Encrypts the database with a passphrase, so that the tags of sensitive files are not stored in cleartext. The passphrase is read from the file specified by --new-key-file or else prompted for twice. Encrypting a database that is already encrypted changes its passphrase.
+
+The passphrase of an encrypted database is read from the file specified by the global --key-file option or the TMSU_KEY_FILE environment variable or else, where standard input is a terminal, prompted for whenever the database is opened. A trailing newline in a key file is ignored.
+
+Whilst in use an encrypted database is decrypted to a private working copy, in memory where the system has /dev/shm, which is encrypted back over the database afterwards if it was changed. Should tmsu be interrupted or terminated the working copy is removed and the changes discarded, and working copies left by processes that were killed are removed when an encrypted database is next opened. The database is encrypted with AES-256 in GCM mode using a key derived from the passphrase with PBKDF2.`,
+	Examples: []string{"$ tmsu encrypt",
+		"$ tmsu encrypt --new-key-file ~/.tmsu-key",
+		"$ tmsu --key-file ~/.tmsu-key tags ~/private/report.pdf",
+		"$ tmsu encrypt --decrypt"},
+	Options: Options{Option{"--decrypt", "-d", "store the database decrypted", false, ""},
+		Option{"--new-key-file", "", "read the new passphrase from the specified file", true, ""}},
+	Exec:     encryptExec,
+	Modifies: true,
+}
+
+// unexported
+
+func encryptExec(store *storage.Storage, options Options, args []string) error {
+	if len(args) > 0 {
+		return fmt.Errorf("too many arguments")
+	}
+
+	if options.HasOption("--decrypt") {
+		if options.HasOption("--new-key-file") {
+			return fmt.Errorf("--decrypt and --new-key-file are mutually exclusive")
+		}
+
+		return store.SetPassphrase(nil)
+	}
+
+	var passphrase []byte
+	var err error
+	if options.HasOption("--new-key-file") {
+		passphrase, err = readKeyFile(options.Get("--new-key-file").Argument)
+	} else {
+		passphrase, err = promptNewPassphrase()
+	}
+	if err != nil {
+		return err
+	}
+
+	return store.SetPassphrase(passphrase)
+}
+
+// Supplies the passphrase of an encrypted database from the key file specified
+// by --key-file or TMSU_KEY_FILE or else by prompting for it.
+func passphraseReader(options Options) func(path string) ([]byte, error) {
+	keyFilePath := os.Getenv("TMSU_KEY_FILE")
+	if options.HasOption("--key-file") {
+		keyFilePath = options.Get("--key-file").Argument
+	}
+
+	return func(path string) ([]byte, error) {
+		if keyFilePath != "" {
+			return readKeyFile(keyFilePath)
+		}
+
+		if !terminal.IsTerminal(os.Stdin) {
+			return nil, fmt.Errorf("the database is encrypted: specify a key file with --key-file or TMSU_KEY_FILE")
+		}
+
+		return promptPassphrase(fmt.Sprintf("passphrase for '%v': ", path))
+	}
+}
+
+func readKeyFile(path string) ([]byte, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("could not read key file: %v", err)
+	}
+
+	passphrase := strings.TrimRight(string(data), "\r\n")
+	if passphrase == "" {
+		return nil, fmt.Errorf("%v: key file is empty", path)
+	}
+
+	return []byte(passphrase), nil
+}
+
+func promptNewPassphrase() ([]byte, error) {
+	if !terminal.IsTerminal(os.Stdin) {
+		return nil, fmt.Errorf("standard input is not a terminal: specify the passphrase with --new-key-file")
+	}
+
+	passphrase, err := promptPassphrase("new passphrase: ")
+	if err != nil {
+		return nil, err
+	}
+
+	confirmation, err := promptPassphrase("repeat passphrase: ")
+	if err != nil {
+		return nil, err
+	}
+
+	if string(confirmation) != string(passphrase) {
+		return nil, fmt.Errorf("the passphrases do not match")
+	}
+
+	return passphrase, nil
+}
+
+func promptPassphrase(prompt string) ([]byte, error) {
+	fmt.Fprint(os.Stderr, prompt)
+	passphrase, err := terminal.ReadPassword(os.Stdin)
+	fmt.Fprintln(os.Stderr)
+
+	if err != nil {
+		return nil, fmt.Errorf("could not read passphrase: %v", err)
+	}
+	if passphrase == "" {
+		return nil, fmt.Errorf("the passphrase is empty")
+	}
+
+	return []byte(passphrase), nil
+}
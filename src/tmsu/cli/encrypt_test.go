@@ -0,0 +1,250 @@
+// Copyright 2011-2015 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package cli
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"testing"
+	"tmsu/common/encryption"
+	"tmsu/storage"
+)
+
+func TestEncryptAndDecrypt(test *testing.T) {
+	// set-up
+
+	databasePath := testDatabase()
+	defer os.Remove(databasePath)
+
+	defer os.RemoveAll("/tmp/tmsu/encrypt")
+
+	if err := createFile("/tmp/tmsu/encrypt/a", "a"); err != nil {
+		test.Fatal(err)
+	}
+	if err := createFile("/tmp/tmsu/encrypt/key", "secret\n"); err != nil {
+		test.Fatal(err)
+	}
+
+	store, err := storage.OpenAt(databasePath)
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	if err := TagCommand.Exec(store, Options{}, []string{"/tmp/tmsu/encrypt/a", "confidential"}); err != nil {
+		test.Fatal(err)
+	}
+
+	// test
+
+	options := Options{Option{"--new-key-file", "", "", true, "/tmp/tmsu/encrypt/key"}}
+	if err := EncryptCommand.Exec(store, options, []string{}); err != nil {
+		test.Fatal(err)
+	}
+	if err := store.Close(); err != nil {
+		test.Fatal(err)
+	}
+
+	// validate
+
+	expectEncrypted(test, databasePath, true)
+
+	defer func() { storage.PassphraseFunc = nil }()
+
+	storage.PassphraseFunc = passphraseReader(Options{Option{"--key-file", "", "", true, "/tmp/tmsu/encrypt/wrong"}})
+	if err := createFile("/tmp/tmsu/encrypt/wrong", "guess"); err != nil {
+		test.Fatal(err)
+	}
+	if _, err := storage.OpenAt(databasePath); err == nil {
+		test.Fatal("expected the database not to open with the wrong passphrase")
+	}
+
+	storage.PassphraseFunc = passphraseReader(Options{Option{"--key-file", "", "", true, "/tmp/tmsu/encrypt/key"}})
+	store, err = storage.OpenAt(databasePath)
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	if err := TagCommand.Exec(store, Options{}, []string{"/tmp/tmsu/encrypt/a", "secret"}); err != nil {
+		test.Fatal(err)
+	}
+
+	if err := store.Close(); err != nil {
+		test.Fatal(err)
+	}
+
+	expectEncrypted(test, databasePath, true)
+
+	store, err = storage.OpenAt(databasePath)
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	tx, err := store.Begin()
+	if err != nil {
+		test.Fatal(err)
+	}
+	file, err := store.FileByPath(tx, "/tmp/tmsu/encrypt/a")
+	if err != nil {
+		test.Fatal(err)
+	}
+	if file == nil {
+		test.Fatal("file not found in the encrypted database")
+	}
+	confidential, err := store.TagByName(tx, "confidential")
+	if err != nil {
+		test.Fatal(err)
+	}
+	secret, err := store.TagByName(tx, "secret")
+	if err != nil {
+		test.Fatal(err)
+	}
+	expectTags(test, store, tx, file, confidential, secret)
+	tx.Commit()
+
+	// decrypt
+
+	options = Options{Option{"--decrypt", "-d", "", false, ""}}
+	if err := EncryptCommand.Exec(store, options, []string{}); err != nil {
+		test.Fatal(err)
+	}
+	if err := store.Close(); err != nil {
+		test.Fatal(err)
+	}
+
+	expectEncrypted(test, databasePath, false)
+}
+
+func TestEncryptedConcurrentModifications(test *testing.T) {
+	// set-up
+
+	databasePath := testDatabase()
+	defer os.Remove(databasePath)
+	defer os.Remove(databasePath + ".lock")
+
+	defer os.RemoveAll("/tmp/tmsu/encrypt")
+
+	if err := createFile("/tmp/tmsu/encrypt/key", "secret\n"); err != nil {
+		test.Fatal(err)
+	}
+
+	store, err := storage.OpenAt(databasePath)
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	options := Options{Option{"--new-key-file", "", "", true, "/tmp/tmsu/encrypt/key"}}
+	if err := EncryptCommand.Exec(store, options, []string{}); err != nil {
+		test.Fatal(err)
+	}
+	if err := store.Close(); err != nil {
+		test.Fatal(err)
+	}
+
+	defer func() { storage.PassphraseFunc = nil }()
+	storage.PassphraseFunc = passphraseReader(Options{Option{"--key-file", "", "", true, "/tmp/tmsu/encrypt/key"}})
+
+	const count = 10
+
+	paths := make([]string, count)
+	for index := range paths {
+		paths[index] = fmt.Sprintf("/tmp/tmsu/encrypt/f%v", index)
+		if err := createFile(paths[index], paths[index]); err != nil {
+			test.Fatal(err)
+		}
+	}
+
+	// test
+
+	errors := make(chan error, count)
+	for index, path := range paths {
+		go func(path, tagName string) {
+			store, err := storage.OpenAt(databasePath)
+			if err != nil {
+				errors <- err
+				return
+			}
+
+			if err := TagCommand.Exec(store, Options{}, []string{path, tagName}); err != nil {
+				store.Close()
+				errors <- err
+				return
+			}
+
+			errors <- store.Close()
+		}(path, fmt.Sprintf("t%v", index))
+	}
+
+	for range paths {
+		if err := <-errors; err != nil {
+			test.Fatal(err)
+		}
+	}
+
+	// validate
+
+	store, err = storage.OpenAt(databasePath)
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer store.Close()
+
+	tx, err := store.Begin()
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer tx.Commit()
+
+	for index, path := range paths {
+		file, err := store.FileByPath(tx, path)
+		if err != nil {
+			test.Fatal(err)
+		}
+		if file == nil {
+			test.Fatalf("%v: changes were lost", path)
+		}
+
+		tag, err := store.TagByName(tx, fmt.Sprintf("t%v", index))
+		if err != nil {
+			test.Fatal(err)
+		}
+		if tag == nil {
+			test.Fatalf("t%v: changes were lost", index)
+		}
+
+		expectTags(test, store, tx, file, tag)
+	}
+}
+
+func expectEncrypted(test *testing.T, path string, expected bool) {
+	encrypted, err := encryption.IsEncrypted(path)
+	if err != nil {
+		test.Fatal(err)
+	}
+	if encrypted != expected {
+		test.Fatalf("expected database encrypted to be %v", expected)
+	}
+
+	if !expected {
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			test.Fatal(err)
+		}
+		if string(data[:15]) != "SQLite format 3" {
+			test.Fatal("database is not an SQLite database")
+		}
+	}
+}
@@ -0,0 +1,76 @@
+// Copyright 2011-2015 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package cli
+
+import (
+	"fmt"
+	"os"
+	"tmsu/common/log"
+)
+
+// exit statuses
+const (
+	exitSuccess        = 0 // the command succeeded
+	exitFailure        = 1 // the command failed
+	exitPartialFailure = 2 // the command failed for some of its arguments
+	exitNoSuchTag      = 3 // a tag specified does not exist
+	exitNoDatabase     = 4 // the database could not be found or opened
+	exitNothingMatched = 5 // the command completed but nothing matched
+)
+
+// An error with an associated exit status.
+type exitError struct {
+	status  int
+	message string
+}
+
+func (err exitError) Error() string {
+	return err.message
+}
+
+// errors for which the details have already been reported
+var errBlank = exitError{exitPartialFailure, ""}
+var errNoSuchTag = exitError{exitNoSuchTag, ""}
+var errNothingMatched = exitError{exitNothingMatched, ""}
+var errNotConfirmed = exitError{exitFailure, ""}
+
+func noSuchTagError(tagName string) error {
+	return exitError{exitNoSuchTag, fmt.Sprintf("no such tag '%v'", tagName)}
+}
+
+func noDatabaseError(format string, values ...interface{}) error {
+	return exitError{exitNoDatabase, fmt.Sprintf(format, values...)}
+}
+
+func exitStatus(err error) int {
+	switch typedErr := err.(type) {
+	case nil:
+		return exitSuccess
+	case exitError:
+		return typedErr.status
+	default:
+		return exitFailure
+	}
+}
+
+func exit(err error) {
+	if err != nil && err.Error() != "" {
+		log.Error(err.Error())
+	}
+
+	stopTiming()
+	os.Exit(exitStatus(err))
+}
@@ -0,0 +1,173 @@
+// Copyright 2011-2015 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package cli
+
+import (
+	"fmt"
+	"strings"
+	"tmsu/common/log"
+	"tmsu/storage"
+)
+
+var ExclusiveCommand = Command{
+	Name:     "exclusive",
+	Synopsis: "Creates a set of mutually exclusive tags",
+	Usages: []string{"tmsu exclusive SET TAG...",
+		"tmsu exclusive --delete SET [TAG]...",
+		"tmsu exclusive"},
+	Description: `Adds TAGs to the set of mutually exclusive tags named SET, creating the set if necessary. No more than one tag of a set may be applied to a file: applying one of the tags removes the others from the file.
+
+When run without arguments lists the sets of mutually exclusive tags.
+
+With --delete, removes TAGs from the set or, if no TAG is specified, deletes the set.
+
+Files tagged in violation of a set, e.g. before it was created, are reported by the 'check' subcommand.`,
+	Examples: []string{`$ tmsu exclusive status todo in-progress done`,
+		`$ tmsu exclusive\nstatus: done in-progress todo`,
+		`$ tmsu tag report.txt done`,
+		`$ tmsu exclusive --delete status`},
+	Options:    Options{Option{"--delete", "-d", "deletes the set or removes tags from it", false, ""}},
+	Exec:       exclusiveExec,
+	ModifiesIf: exclusiveModifies,
+}
+
+// unexported
+
+// Adding to or deleting sets modifies the database: listing them does not.
+func exclusiveModifies(options Options, args []string) bool {
+	return options.HasOption("--delete") || len(args) > 1
+}
+
+func exclusiveExec(store *storage.Storage, options Options, args []string) error {
+	tx, err := store.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Commit()
+
+	if options.HasOption("--delete") {
+		if len(args) < 1 {
+			return fmt.Errorf("too few arguments")
+		}
+
+		return deleteExclusions(store, tx, args[0], args[1:])
+	}
+
+	switch len(args) {
+	case 0:
+		return listExclusions(store, tx)
+	case 1:
+		return fmt.Errorf("tag(s) to add to the set must be specified")
+	default:
+		return addExclusions(store, tx, args[0], args[1:])
+	}
+}
+
+func listExclusions(store *storage.Storage, tx *storage.Tx) error {
+	log.Infof(2, "retrieving tag exclusions.")
+
+	exclusions, err := store.Exclusions(tx)
+	if err != nil {
+		return fmt.Errorf("could not retrieve exclusions: %v", err)
+	}
+
+	width := 0
+	for _, exclusion := range exclusions {
+		if len(exclusion.Set) > width {
+			width = len(exclusion.Set)
+		}
+	}
+
+	tagNames := make([]string, 0, 10)
+	for index, exclusion := range exclusions {
+		tagNames = append(tagNames, exclusion.Tag.Name)
+
+		if index == len(exclusions)-1 || exclusions[index+1].Set != exclusion.Set {
+			fmt.Printf("%*v: %v\n", width, exclusion.Set, strings.Join(escapeNames(tagNames), " "))
+			tagNames = tagNames[:0]
+		}
+	}
+
+	return nil
+}
+
+func addExclusions(store *storage.Storage, tx *storage.Tx, set string, tagNames []string) error {
+	log.Infof(2, "loading settings")
+
+	settings, err := store.Settings(tx)
+	if err != nil {
+		return err
+	}
+
+	for _, tagName := range tagNames {
+		log.Infof(2, "looking up tag '%v'", tagName)
+
+		tag, err := store.TagByName(tx, tagName)
+		if err != nil {
+			return fmt.Errorf("could not retrieve tag '%v': %v", tagName, err)
+		}
+		if tag == nil {
+			if settings.AutoCreateTags() {
+				tag, err = createTag(store, tx, tagName)
+				if err != nil {
+					return err
+				}
+			} else {
+				return noSuchTagError(tagName)
+			}
+		}
+
+		log.Infof(2, "adding tag '%v' to exclusive set '%v'", tagName, set)
+
+		if err = store.AddExclusion(tx, set, tag.Id); err != nil {
+			return fmt.Errorf("could not add tag '%v' to exclusive set '%v': %v", tagName, set, err)
+		}
+	}
+
+	return nil
+}
+
+func deleteExclusions(store *storage.Storage, tx *storage.Tx, set string, tagNames []string) error {
+	if len(tagNames) == 0 {
+		log.Infof(2, "deleting exclusive set '%v'.", set)
+
+		if err := store.RemoveExclusionSet(tx, set); err != nil {
+			return fmt.Errorf("could not delete exclusive set '%v': %v", set, err)
+		}
+
+		return nil
+	}
+
+	for _, tagName := range tagNames {
+		log.Infof(2, "looking up tag '%v'.", tagName)
+
+		tag, err := store.TagByName(tx, tagName)
+		if err != nil {
+			return fmt.Errorf("could not retrieve tag '%v': %v", tagName, err)
+		}
+		if tag == nil {
+			return noSuchTagError(tagName)
+		}
+
+		log.Infof(2, "removing tag '%v' from exclusive set '%v'.", tagName, set)
+
+		if err = store.RemoveExclusion(tx, set, tag.Id); err != nil {
+			return fmt.Errorf("could not remove tag '%v' from exclusive set '%v': %v", tagName, set, err)
+		}
+	}
+
+	return nil
+}
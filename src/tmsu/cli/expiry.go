@@ -0,0 +1,106 @@
+// Copyright 2011-2015 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package cli
+
+import (
+	"fmt"
+	"time"
+	"tmsu/api"
+	"tmsu/common/log"
+	"tmsu/storage"
+)
+
+// Removes, or archives, the tags applied with 'tmsu tag --until' that have
+// expired. The caller must hold the writer lock.
+func expireTags(store *storage.Storage) error {
+	if store.DryRun {
+		return nil
+	}
+
+	tx, err := store.Begin()
+	if err != nil {
+		return err
+	}
+
+	expired, err := api.ExpireTags(store, tx, time.Now())
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	if len(expired) > 0 {
+		log.Infof(2, "removed %v expired tags", len(expired))
+	}
+
+	return nil
+}
+
+// Sweeps the expired tags, and applies the queued tags of files now available,
+// before a command that does not otherwise modify the database, provided there
+// are any and the database may be written to without waiting for another
+// process.
+func sweepOpportunistically(store *storage.Storage, commandName string) error {
+	if store.DryRun {
+		return nil
+	}
+
+	tx, err := store.Begin()
+	if err != nil {
+		return err
+	}
+	expired, err := store.ExpiredFileTags(tx, time.Now())
+	if err != nil {
+		tx.Commit()
+		return fmt.Errorf("could not retrieve expired tags: %v", err)
+	}
+	available, err := api.PendingTagsAvailable(store, tx)
+	tx.Commit()
+	if err != nil {
+		return fmt.Errorf("could not retrieve queued tags: %v", err)
+	}
+	if len(expired) == 0 && !available {
+		return nil
+	}
+
+	readOnly, err := store.IsReadOnly()
+	if err != nil {
+		return err
+	}
+	if readOnly {
+		return nil
+	}
+
+	lock, err := store.LockForWriting("tmsu "+commandName, false, nil)
+	if err != nil {
+		if _, ok := err.(storage.LockedError); ok {
+			// left for the next command
+			return nil
+		}
+
+		return err
+	}
+	defer lock.Release()
+
+	if err := expireTags(store); err != nil {
+		return err
+	}
+
+	return flushPendingTags(store)
+}
@@ -0,0 +1,191 @@
+// Copyright 2011-2015 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package cli
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"tmsu/api"
+	"tmsu/common/log"
+	"tmsu/entities"
+	"tmsu/storage"
+)
+
+var ExportCommand = Command{
+	Name:     "export",
+	Synopsis: "Export tags for other tagging applications",
+	Usages: []string{"tmsu export [OPTION]... --format=FORMAT [FILE]...",
+		"tmsu export --checksums [FILE]...",
+		"tmsu export [OPTION]... --query=QUERY OUTPUT"},
+	Description: `Exports the tags of each FILE, or of every tagged file if no FILE is specified, in the format read by another tagging application so that it shows the same tags as the database.
+
+FORMAT is one of:
+
+  tagspaces  the sidecar files TagSpaces reads from the '.ts' directory alongside each file: '.ts/NAME.json' for a file and '.ts/tsm.json', within the directory, for a directory
+
+The other properties of existing sidecar files, such as descriptions and tag colors, are kept. Only files whose tags differ are updated and listed, so the command can be run again after changing tags. Tags with values are exported as TAG=VALUE. A FILE that is not tagged has its tags removed from its sidecar file.
+
+With --checksums a manifest of the files' SHA-256 checksums is written to standard output instead, in the format of 'sha256sum', so that the files can be verified with 'sha256sum --check' without reading the database. The checksums are the stored fingerprints so the files are not read: files are skipped with a warning unless the fileFingerprintAlgorithm setting is 'SHA256' or, for files up to 5MB, the default 'dynamic:SHA256'. To export checksums for every file, change the setting and then run 'tmsu repair --unmodified' to recalculate the fingerprints.
+
+With --query a new database is written to OUTPUT containing only the files matching QUERY, with their tags and notes, for handing a subset of the files to someone else. The tags, values, implications and settings are copied too: with --prune-unused-tags only the tags and values the files are tagged with, and the tags these imply, are. If OUTPUT ends '.txt' a text dump of the database is written instead, from which 'tmsu rebuild' recreates it. OUTPUT must not already exist.
+
+See 'tmsu import' to import tags from other tagging applications.`,
+	Examples: []string{"$ tmsu export --format=tagspaces",
+		"$ tmsu export --format=tagspaces --pretend ~/photos/*.jpg",
+		"$ tmsu export --checksums >SHA256SUMS",
+		"$ tmsu export --query project-x --prune-unused-tags project-x.db"},
+	Options: Options{Option{"--format", "-f", "the format to export: tagspaces", true, ""},
+		Option{"--explicit", "-e", "do not include implied tags", false, ""},
+		Option{"--pretend", "-P", "list the files that would be updated without updating them", false, ""},
+		Option{"--checksums", "", "write a sha256sum manifest of the files' checksums", false, ""},
+		Option{"--query", "-q", "write a database of the files matching the query", true, ""},
+		Option{"--prune-unused-tags", "", "with --query, copy only the tags and values in use", false, ""}},
+	Exec: exportExec,
+}
+
+// unexported
+
+func exportExec(store *storage.Storage, options Options, args []string) error {
+	checksums := options.HasOption("--checksums")
+
+	if options.HasOption("--query") {
+		if checksums || options.HasOption("--format") {
+			return fmt.Errorf("--query cannot be combined with --checksums or --format")
+		}
+
+		return exportSubset(store, options, args)
+	}
+
+	switch {
+	case checksums && options.HasOption("--format"):
+		return fmt.Errorf("--checksums and --format are mutually exclusive")
+	case checksums:
+		break
+	case !options.HasOption("--format"):
+		return fmt.Errorf("the format to export must be specified with --format")
+	default:
+		format := options.Get("--format").Argument
+		if format != "tagspaces" {
+			return fmt.Errorf("invalid format '%v': must be one of %v", format, strings.Join(api.ExportFormats, ", "))
+		}
+	}
+
+	exportOptions := api.ExportOptions{ExplicitOnly: options.HasOption("--explicit"),
+		Pretend: options.HasOption("--pretend") || store.DryRun,
+		Report: func(path string, tags []string) {
+			if len(tags) == 0 {
+				fmt.Printf("%v: cleared\n", path)
+			} else {
+				fmt.Printf("%v: %v\n", path, strings.Join(escapeNames(tags), " "))
+			}
+		}}
+
+	tx, err := store.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Commit()
+
+	wereErrors := false
+	var files entities.Files
+	if len(args) == 0 {
+		files, err = store.Files(tx, "name")
+		if err != nil {
+			return fmt.Errorf("could not retrieve files: %v", err)
+		}
+	} else {
+		files = make(entities.Files, 0, len(args))
+		for _, path := range args {
+			absPath, err := filepath.Abs(path)
+			if err != nil {
+				return fmt.Errorf("%v: could not get absolute path: %v", path, err)
+			}
+
+			file, err := store.FileByPath(tx, absPath)
+			if err != nil {
+				return fmt.Errorf("%v: could not retrieve file: %v", path, err)
+			}
+			if file == nil {
+				if checksums {
+					log.Warnf("%v: skipping as it is not tagged", path)
+					wereErrors = true
+					continue
+				}
+
+				// an untagged file: its tags are cleared
+				file = &entities.File{Directory: filepath.Dir(absPath), Name: filepath.Base(absPath)}
+			}
+
+			files = append(files, file)
+		}
+	}
+
+	if !checksums {
+		return api.ExportTagSpaces(store, tx, files, exportOptions)
+	}
+
+	wereSkipped, err := api.ExportChecksums(store, tx, files, os.Stdout)
+	if err != nil {
+		return err
+	}
+	if wereErrors || wereSkipped {
+		return errBlank
+	}
+
+	return nil
+}
+
+func exportSubset(store *storage.Storage, options Options, args []string) error {
+	switch {
+	case len(args) < 1:
+		return fmt.Errorf("the database to write must be specified")
+	case len(args) > 1:
+		return fmt.Errorf("too many arguments")
+	}
+
+	tx, err := store.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Commit()
+
+	files, err := api.QueryFiles(store, tx, options.Get("--query").Argument, api.QueryOptions{Sort: "name"})
+	if err != nil {
+		if noSuchTags, ok := err.(api.NoSuchTagsError); ok {
+			for _, tagName := range noSuchTags.Names {
+				log.Warnf("no such tag '%v'.", tagName)
+			}
+
+			return errNoSuchTag
+		}
+
+		return err
+	}
+	if len(files) == 0 {
+		return errNothingMatched
+	}
+
+	subsetOptions := api.SubsetOptions{PruneUnusedTags: options.HasOption("--prune-unused-tags")}
+	if err := api.Subset(store, tx, files, args[0], subsetOptions); err != nil {
+		return err
+	}
+
+	log.Infof(1, "%v: exported %v files", args[0], len(files))
+
+	return nil
+}
@@ -0,0 +1,261 @@
+// Copyright 2011-2015 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package cli
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+	"tmsu/storage"
+)
+
+func TestExportTagSpaces(test *testing.T) {
+	// set-up
+
+	databasePath := testDatabase()
+	defer os.Remove(databasePath)
+
+	store, err := storage.OpenAt(databasePath)
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer store.Close()
+
+	defer os.RemoveAll("/tmp/tmsu/export")
+
+	if err := createFile("/tmp/tmsu/export/a", "a"); err != nil {
+		test.Fatal(err)
+	}
+	if err := createFile("/tmp/tmsu/export/b", "b"); err != nil {
+		test.Fatal(err)
+	}
+	if err := createFile("/tmp/tmsu/export/.ts/b.json", `{"description": "keep me", "tags": [{"title": "stale", "type": "sidecar"}]}`); err != nil {
+		test.Fatal(err)
+	}
+
+	if err := TagCommand.Exec(store, Options{}, []string{"/tmp/tmsu/export/a", "apple", "year=2015"}); err != nil {
+		test.Fatal(err)
+	}
+	if err := TagCommand.Exec(store, Options{}, []string{"/tmp/tmsu/export/b", "banana"}); err != nil {
+		test.Fatal(err)
+	}
+
+	// test
+
+	options := Options{Option{"--format", "-f", "", true, "tagspaces"}}
+	if err := ExportCommand.Exec(store, options, []string{}); err != nil {
+		test.Fatal(err)
+	}
+
+	// validate
+
+	expectSidecar(test, "/tmp/tmsu/export/.ts/a.json", "", "apple", "year=2015")
+	expectSidecar(test, "/tmp/tmsu/export/.ts/b.json", "keep me", "banana")
+}
+
+// unexported
+
+func expectSidecar(test *testing.T, path, description string, tags ...string) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	var sidecar struct {
+		Description string `json:"description"`
+		Tags        []struct {
+			Title string `json:"title"`
+			Type  string `json:"type"`
+		} `json:"tags"`
+	}
+	if err := json.Unmarshal(content, &sidecar); err != nil {
+		test.Fatal(err)
+	}
+
+	if sidecar.Description != description {
+		test.Fatalf("%v: expected description '%v' but was '%v'.", path, description, sidecar.Description)
+	}
+	if len(sidecar.Tags) != len(tags) {
+		test.Fatalf("%v: expected %v tags but got %v.", path, len(tags), len(sidecar.Tags))
+	}
+	for index, tag := range tags {
+		if sidecar.Tags[index].Title != tag || sidecar.Tags[index].Type != "sidecar" {
+			test.Fatalf("%v: expected tag '%v' but was '%v'.", path, tag, sidecar.Tags[index].Title)
+		}
+	}
+}
+
+func TestExportChecksums(test *testing.T) {
+	// set-up
+
+	databasePath := testDatabase()
+	defer os.Remove(databasePath)
+
+	err := redirectStreams()
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer restoreStreams()
+
+	store, err := storage.OpenAt(databasePath)
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer store.Close()
+
+	defer os.RemoveAll("/tmp/tmsu/checksums")
+
+	if err := createFile("/tmp/tmsu/checksums/a", "a"); err != nil {
+		test.Fatal(err)
+	}
+	if err := createFile("/tmp/tmsu/checksums/b\\c", "b"); err != nil {
+		test.Fatal(err)
+	}
+
+	if err := TagCommand.Exec(store, Options{}, []string{"/tmp/tmsu/checksums/a", "apple"}); err != nil {
+		test.Fatal(err)
+	}
+	if err := TagCommand.Exec(store, Options{}, []string{"/tmp/tmsu/checksums/b\\c", "banana"}); err != nil {
+		test.Fatal(err)
+	}
+
+	// test
+
+	options := Options{Option{"--checksums", "", "", false, ""}}
+	if err := ExportCommand.Exec(store, options, []string{}); err != nil {
+		test.Fatal(err)
+	}
+
+	// validate
+
+	outFile.Seek(0, 0)
+
+	bytes, err := ioutil.ReadAll(outFile)
+	compareOutput(test, "ca978112ca1bbdcafac231b39a23dc4da786eff8147c4e72b9807785afee48bb  /tmp/tmsu/checksums/a\n"+
+		"\\3e23e8160039594a33894f6564e1b1348bbd7a0088d42c4acb73eeaed59c009d  /tmp/tmsu/checksums/b\\\\c\n", string(bytes))
+}
+
+func TestExportQuerySubset(test *testing.T) {
+	// set-up
+
+	databasePath := testDatabase()
+	defer os.Remove(databasePath)
+
+	store, err := storage.OpenAt(databasePath)
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer store.Close()
+
+	defer os.RemoveAll("/tmp/tmsu/subset")
+
+	if err := createFile("/tmp/tmsu/subset/a", "a"); err != nil {
+		test.Fatal(err)
+	}
+	if err := createFile("/tmp/tmsu/subset/b", "b"); err != nil {
+		test.Fatal(err)
+	}
+
+	if err := TagCommand.Exec(store, Options{}, []string{"/tmp/tmsu/subset/a", "project-x", "apple", "year=2015"}); err != nil {
+		test.Fatal(err)
+	}
+	if err := TagCommand.Exec(store, Options{}, []string{"/tmp/tmsu/subset/b", "banana", "year=2016"}); err != nil {
+		test.Fatal(err)
+	}
+	if err := ImplyCommand.Exec(store, Options{}, []string{"apple", "fruit"}); err != nil {
+		test.Fatal(err)
+	}
+
+	// test
+
+	options := Options{Option{"--query", "-q", "", true, "project-x"},
+		Option{"--prune-unused-tags", "", "", false, ""}}
+	if err := ExportCommand.Exec(store, options, []string{"/tmp/tmsu/subset/subset.db"}); err != nil {
+		test.Fatal(err)
+	}
+
+	// validate
+
+	subset, err := storage.OpenAt("/tmp/tmsu/subset/subset.db")
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer subset.Close()
+
+	tx, err := subset.Begin()
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer tx.Commit()
+
+	files, err := subset.Files(tx, "name")
+	if err != nil {
+		test.Fatal(err)
+	}
+	if len(files) != 1 || files[0].Path() != "/tmp/tmsu/subset/a" {
+		test.Fatalf("expected only '/tmp/tmsu/subset/a' but were %v", files)
+	}
+
+	tags, err := subset.Tags(tx)
+	if err != nil {
+		test.Fatal(err)
+	}
+	tagNames := make([]string, len(tags))
+	for index, tag := range tags {
+		tagNames[index] = tag.Name
+	}
+	compareOutput(test, "apple fruit project-x year", strings.Join(tagNames, " "))
+
+	values, err := subset.Values(tx)
+	if err != nil {
+		test.Fatal(err)
+	}
+	if len(values) != 1 || values[0].Name != "2015" {
+		test.Fatalf("expected only value '2015' but were %v", values)
+	}
+
+	implications, err := subset.Implications(tx)
+	if err != nil {
+		test.Fatal(err)
+	}
+	if len(implications) != 1 || implications[0].ImplyingTag.Name != "apple" || implications[0].ImpliedTag.Name != "fruit" {
+		test.Fatalf("expected implication 'apple' -> 'fruit' but were %v", implications)
+	}
+
+	fileTags, err := subset.FileTagsByFileId(tx, files[0].Id, true)
+	if err != nil {
+		test.Fatal(err)
+	}
+	if len(fileTags) != 3 {
+		test.Fatalf("expected 3 file-tags but were %v", len(fileTags))
+	}
+
+	// a text dump is written for a '.txt' output
+
+	if err := ExportCommand.Exec(store, options, []string{"/tmp/tmsu/subset/subset.txt"}); err != nil {
+		test.Fatal(err)
+	}
+
+	bytes, err := ioutil.ReadFile("/tmp/tmsu/subset/subset.txt")
+	if err != nil {
+		test.Fatal(err)
+	}
+	if !strings.Contains(string(bytes), "project-x") || strings.Contains(string(bytes), "banana") {
+		test.Fatalf("unexpected text dump:\n%v", string(bytes))
+	}
+}
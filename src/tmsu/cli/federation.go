@@ -0,0 +1,168 @@
+// Copyright 2011-2015 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package cli
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strings"
+	"tmsu/common/log"
+	"tmsu/storage"
+)
+
+// unexported
+
+// Whether paths in results are shown in full, rather than relative to the
+// working directory, so that each shows the root of the database it is from.
+var absolutePaths bool
+
+// The path as it is shown in results: in full when listing from all of the
+// configured databases, otherwise as given.
+func displayPath(path string) string {
+	if !absolutePaths {
+		return path
+	}
+
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return path
+	}
+
+	return absPath
+}
+
+func databasesConfigPath() (string, error) {
+	if configHome := os.Getenv("XDG_CONFIG_HOME"); configHome != "" {
+		return filepath.Join(configHome, "tmsu", "databases"), nil
+	}
+
+	u, err := user.Current()
+	if err != nil {
+		return "", fmt.Errorf("could not identify current user: %v", err)
+	}
+
+	return filepath.Join(u.HomeDir, ".config", "tmsu", "databases"), nil
+}
+
+func configuredDatabases() ([]string, error) {
+	configPath, err := databasesConfigPath()
+	if err != nil {
+		return nil, err
+	}
+
+	file, err := os.Open(configPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, fmt.Errorf("no databases are configured: list the database paths in '%v'", configPath)
+		}
+
+		return nil, fmt.Errorf("could not open database list '%v': %v", configPath, err)
+	}
+	defer file.Close()
+
+	databasePaths := make([]string, 0, 10)
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || line[0] == '#' {
+			continue
+		}
+
+		databasePaths = append(databasePaths, os.ExpandEnv(line))
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("could not read database list '%v': %v", configPath, err)
+	}
+
+	return databasePaths, nil
+}
+
+func processCommandFederated(command *Command, options Options, arguments []string) error {
+	if command == nil {
+		return fmt.Errorf("a subcommand must be specified with --all-databases")
+	}
+	if options.HasOption("--database") {
+		return fmt.Errorf("--database and --all-databases cannot be combined")
+	}
+	if !command.Federated {
+		return fmt.Errorf("the '%v' subcommand does not support --all-databases", command.Name)
+	}
+
+	databasePaths, err := configuredDatabases()
+	if err != nil {
+		return err
+	}
+
+	absolutePaths = true
+	defer func() { absolutePaths = false }()
+
+	wereErrors := false
+	queried, unmatched := 0, 0
+	for _, databasePath := range databasePaths {
+		if backendName, path := storage.ParseLocation(databasePath); backendName == storage.DefaultBackend {
+			if _, err := os.Stat(path); err != nil {
+				if os.IsNotExist(err) {
+					log.Infof(2, "%v: database is not mounted: skipping", databasePath)
+					continue
+				}
+
+				log.Warnf("%v: could not stat database: %v", databasePath, err)
+				wereErrors = true
+				continue
+			}
+		}
+
+		store, err := storage.OpenAt(databasePath)
+		if err != nil {
+			log.Warnf("%v: could not open storage: %v", databasePath, err)
+			wereErrors = true
+			continue
+		}
+
+		store.DryRun = options.HasOption("--dry-run")
+		store.ReadOnly = options.HasOption("--read-only")
+		store.Command = strings.Join(os.Args[1:], " ")
+
+		queried++
+
+		if err := processCommand(store, command, options, arguments); err != nil {
+			switch {
+			case err == errNothingMatched:
+				unmatched++
+			case err.Error() != "":
+				log.Warnf("%v: %v", databasePath, err)
+				wereErrors = true
+			default:
+				wereErrors = true
+			}
+		}
+
+		store.Close()
+	}
+
+	if wereErrors {
+		return errBlank
+	}
+	if queried > 0 && unmatched == queried {
+		return errNothingMatched
+	}
+
+	return nil
+}
@@ -0,0 +1,95 @@
+// Copyright 2011-2015 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package cli
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"tmsu/storage"
+)
+
+func TestFilesAllDatabasesShowsFullPaths(test *testing.T) {
+	// set-up
+
+	defer os.RemoveAll("/tmp/tmsu/federated")
+
+	configHome := "/tmp/tmsu/federated/config"
+	if err := os.MkdirAll(filepath.Join(configHome, "tmsu"), 0755); err != nil {
+		test.Fatal(err)
+	}
+
+	xdgConfigHome := os.Getenv("XDG_CONFIG_HOME")
+	os.Setenv("XDG_CONFIG_HOME", configHome)
+	defer os.Setenv("XDG_CONFIG_HOME", xdgConfigHome)
+
+	databases := ""
+	for _, name := range []string{"one", "two"} {
+		root := filepath.Join("/tmp/tmsu/federated", name)
+		databasePath := filepath.Join(root, ".tmsu", "db")
+		databases += databasePath + "\n"
+
+		if err := os.MkdirAll(filepath.Dir(databasePath), 0755); err != nil {
+			test.Fatal(err)
+		}
+		if err := createFile(filepath.Join(root, "a"), name); err != nil {
+			test.Fatal(err)
+		}
+
+		store, err := storage.OpenAt(databasePath)
+		if err != nil {
+			test.Fatal(err)
+		}
+		if err := TagCommand.Exec(store, Options{}, []string{filepath.Join(root, "a"), "apple"}); err != nil {
+			test.Fatal(err)
+		}
+		store.Close()
+	}
+
+	if err := ioutil.WriteFile(filepath.Join(configHome, "tmsu", "databases"), []byte(databases), 0644); err != nil {
+		test.Fatal(err)
+	}
+
+	// paths would otherwise be shown relative to the working directory
+	workingDirectory, err := os.Getwd()
+	if err != nil {
+		test.Fatal(err)
+	}
+	if err := os.Chdir("/tmp/tmsu/federated/one"); err != nil {
+		test.Fatal(err)
+	}
+	defer os.Chdir(workingDirectory)
+
+	err = redirectStreams()
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer restoreStreams()
+
+	// test
+
+	if err := processCommandFederated(&FilesCommand, Options{}, []string{"apple"}); err != nil {
+		test.Fatal(err)
+	}
+
+	// validate
+
+	outFile.Seek(0, 0)
+
+	bytes, err := ioutil.ReadAll(outFile)
+	compareOutput(test, "/tmp/tmsu/federated/one/a\n/tmp/tmsu/federated/two/a\n", string(bytes))
+}
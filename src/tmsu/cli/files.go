@@ -16,9 +16,15 @@
 package cli
 
 import (
+	"encoding/csv"
 	"fmt"
+	"io/ioutil"
+	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
+	"time"
+	"tmsu/api"
 	"tmsu/common/log"
 	"tmsu/common/path"
 	"tmsu/entities"
@@ -33,10 +39,42 @@ var FilesCommand = Command{
 	Usages:   []string{"tmsu files [OPTION]... [QUERY]"},
 	Description: `Lists the files in the database that match the QUERY specified. If no query is specified, all files in the database are listed.
 
-QUERY may contain tag names to match, operators and parentheses. Operators are: and or not == != < > <= >=.
+QUERY may contain tag names to match, operators and parentheses. Operators are: and or not == != < > <= >=. Exclusions are written with 'not' or its synonym '!', e.g. '!live': a leading '-' is part of a tag name rather than an exclusion.
+
+Values that are numbers are compared numerically. Values that are ISO 8601 dates, optionally with a time (YYYY-MM-DD, YYYY-MM-DDTHH:MM or YYYY-MM-DDTHH:MM:SS), are compared chronologically by < > <= and >=, with values that are not dates not matching. A date may also be given relative to now as a count of hours (h), days (d), weeks (w), months (m) or years (y), e.g. -30d for thirty days ago.
+
+Sizes (e.g. 1.2GB or 700MiB) and durations (e.g. 3m20s or 1h30m) are compared by < > <= and >= in bytes and seconds respectively, regardless of their units, with values that are plain numbers taken to be bytes or seconds.
+
+A value compared by == or != may contain the wildcards * (any text), ? (any single character) or a [...] character class, in which case the value names are matched against the pattern: year=19* matches the files tagged 'year' with any value beginning '19'. A tag name on its own matches the files with that tag whatever its value, so 'year' and 'not year' together with year=* can be used to find files missing a value.
+
+The term note:TEXT matches the files whose note (see 'tmsu help note') contains the words of TEXT, using SQLite's full-text query syntax.
+
+Similarly, the term content:TEXT matches the files whose content, as extracted by the content indexer (see 'tmsu help index'), contains the words of TEXT.
+
+A term beginning tag: is always taken as a tag name, which allows tags whose names begin with '-' or with one of the prefixes above to be queried, e.g. tag:-funny or tag:note:draft. As such a term would otherwise be taken for an option, the query should follow '--' on the command line.
+
+A tag or value name containing spaces (see the 'allowSpacesInNames' setting) or one that would otherwise be taken as an operator must be enclosed in quotation marks or have the characters escaped with a backslash within the query.
+
+With --or (or --any) the files matching at least one of the terms of the query are listed rather than those matching all of them, for those who would rather not use the query language. Terms preceded by 'not' remain exclusions, so '--or jazz blues not live' lists the files tagged 'jazz' or 'blues' but not 'live'.
 
 Queries are run against the database so the results may not reflect the current state of the filesystem. Only tagged files are matched: to identify untagged files use the 'untagged' subcommand.
 
+The results may be combined with a list of paths, one per line, read from FILE (or standard input if FILE is -) using --intersect, --union or --difference. Only tagged files in the list are considered. The paths may instead be separated by NUL characters, as output by 'find -print0'.
+
+--filter-stdin is shorthand for --intersect=-, filtering the paths piped to the command by the query. --file0-from is as --intersect but the paths in FILE must be separated by NUL characters, so that paths containing newlines are handled.
+
+--directory and --file list only the tagged directories or only the tagged regular files and --top lists only the first N files in the sort order. These are applied by the database so are quicker than filtering the output.
+
+With --like the files sharing tags with FILE are listed, those sharing the most tags first, which is useful for finding items similar to one already found. Any query further restricts the files listed.
+
+The results may be listed one per line (the default), as an M3U playlist or as CSV with their sizes and modification times using --format. Paths are shown relative to the working directory or, with --base, to the directory DIR, which suits playlists that are kept alongside the files.
+
+With --tree the results are listed as a directory tree, indented beneath the deepest directory containing them all, with the number of matches beneath each directory. Directories containing a single directory and no matches of their own are shown together on one line.
+
+With --group-by the results are listed in groups, each headed by what its files share and their number: the tags applied to them (tag), the values of a particular tag (value:KEY), their directory (directory) or their extension (extension). A file with several tags, or several values of the tag, is listed in each of their groups and the files without any are listed last. With --count only the groups' headings and numbers of files are listed.
+
+The exit status is 5 if no files matched the query, so that scripts can distinguish an empty result from a failure (see 'tmsu help').
+
 Note: Your shell may use some punctuation (e.g. < and >) for its own purposes. Either enclose the query in quotation marks, escape the problematic characters or use the equivalent text operators: == eq, != ne, < lt, > gt, <= le, >= ge.`,
 	Examples: []string{"$ tmsu files music mp3  # files with both 'music' and 'mp3'",
 		"$ tmsu files music and mp3  # same query but with explicit 'and'",
@@ -45,31 +83,153 @@ Note: Your shell may use some punctuation (e.g. < and >) for its own purposes. E
 		`$ tmsu files "year == 2015"  # tagged 'year' with a value '2015'`,
 		`$ tmsu files "year < 2015" # tagged 'year' with values under '2015'`,
 		`$ tmsu files year lt 2015  # same query but using textual operator`,
+		`$ tmsu files "taken >= 2020-01-01" "taken < 2021-01-01"  # taken during 2020`,
+		`$ tmsu files "taken > -30d"  # taken in the last thirty days`,
+		`$ tmsu files "size > 700MB" and "length < 1h"`,
+		`$ tmsu files 'note:"invoice 2023"'  # with a note containing 'invoice' and '2023'`,
 		`$ tmsu files year  # tagged 'year' (any or no value)`,
-		`$ tmsu files --path=/home/bob music  # tagged 'music' under /home/bob`},
+		`$ tmsu files "year = 19*"  # tagged 'year' with a value beginning '19'`,
+		`$ tmsu files "not year"  # not tagged 'year'`,
+		`$ tmsu files music '!live'  # tagged 'music' but not 'live'`,
+		`$ tmsu files -- tag:-funny  # tagged '-funny'`,
+		`$ tmsu files --or jazz blues not live  # tagged 'jazz' or 'blues' but not 'live'`,
+		`$ tmsu files year and not year=*  # tagged 'year' without a value`,
+		`$ tmsu files '"new york" and not "big apple"'  # tag names containing spaces`,
+		`$ tmsu files --path=/home/bob music  # tagged 'music' under /home/bob`,
+		`$ find . -mtime -7 | tmsu files --intersect=- music  # tagged 'music' and in list`,
+		`$ fd -0 -e mp3 | tmsu files --filter-stdin genre=jazz`,
+		`$ find . -print0 >list; tmsu files --file0-from=list music`,
+		`$ tmsu files --tagged-by=bob music  # tagged 'music' with any tag applied by bob`,
+		`$ tmsu files --tagged-after=2015-01-01  # with any tag applied since 2015`,
+		`$ tmsu files --format=m3u --base=/music genre=jazz >/music/jazz.m3u`,
+		"$ tmsu files --tree music\n/home/bob/music/ (3)\n  jazz/ (2)\n    a.mp3\n    b.mp3\n  rock/live/ (1)\n    c.mp3",
+		"$ tmsu files --group-by=value:genre music\ngenre=jazz (2)\n  a.mp3\n  b.mp3\ngenre=rock (1)\n  c.mp3\n(without genre) (1)\n  d.mp3",
+		`$ tmsu files --like=song.mp3 music  # music with the most tags in common with song.mp3`,
+		`$ tmsu files --directory --sort=time --top=5 project  # five oldest 'project' directories`},
 	Options: Options{{"--directory", "-d", "list only items that are directories", false, ""},
 		{"--file", "-f", "list only items that are files", false, ""},
+		{"--top", "-n", "list only the first N items", true, ""},
 		{"--print0", "-0", "delimit files with a NUL character rather than newline.", false, ""},
 		{"--count", "-c", "lists the number of files rather than their names", false, ""},
 		{"--path", "-p", "list only items under PATH", true, ""},
 		{"--explicit", "-e", "list only explicitly tagged files", false, ""},
-		{"--sort", "-s", "sort output: id, none, name, size, time", true, ""}},
-	Exec: filesExec,
+		{"--or", "", "list items matching any rather than all of the query's terms", false, ""},
+		{"--any", "-a", "same as --or", false, ""},
+		{"--sort", "-s", "sort output: id, none, name, size, time", true, ""},
+		{"--intersect", "", "list only items that are also in the FILE list", true, ""},
+		{"--union", "", "also list items that are in the FILE list", true, ""},
+		{"--difference", "", "list only items that are not in the FILE list", true, ""},
+		{"--filter-stdin", "", "list only items that are also in the list read from standard input", false, ""},
+		{"--file0-from", "", "list only items that are also in the NUL-separated FILE list", true, ""},
+		{"--tagged-by", "", "list only items with tags applied by USER", true, ""},
+		{"--tagged-after", "", "list only items with tags applied after DATE", true, ""},
+		{"--like", "", "list items sharing tags with FILE, most shared first", true, ""},
+		{"--explain", "", "show how the query is run, and the number of matching files, rather than the files", false, ""},
+		{"--format", "", "output format: lines, m3u, csv", true, ""},
+		{"--base", "", "show paths relative to the directory DIR", true, ""},
+		{"--tree", "-t", "list the files as a directory tree with the number of matches in each directory", false, ""},
+		{"--group-by", "-g", "list the files in groups: tag, value:KEY, directory, extension", true, ""}},
+	Exec:      filesExec,
+	Federated: true,
 }
 
 func filesExec(store *storage.Storage, options Options, args []string) error {
-	dirOnly := options.HasOption("--directory")
-	fileOnly := options.HasOption("--file")
 	print0 := options.HasOption("--print0")
 	showCount := options.HasOption("--count")
 	hasPath := options.HasOption("--path")
 	explicitOnly := options.HasOption("--explicit")
 
+	format := "lines"
+	if options.HasOption("--format") {
+		format = options.Get("--format").Argument
+
+		switch format {
+		case "lines", "m3u", "csv":
+		default:
+			return fmt.Errorf("invalid format '%v': must be one of lines, m3u, csv", format)
+		}
+	}
+
+	if options.HasOption("--tree") {
+		switch {
+		case options.HasOption("--format"):
+			return fmt.Errorf("--tree cannot be specified with --format")
+		case print0, showCount:
+			return fmt.Errorf("--tree cannot be specified with --print0 or --count")
+		}
+
+		format = "tree"
+	}
+
+	groupBy := ""
+	if options.HasOption("--group-by") {
+		groupBy = options.Get("--group-by").Argument
+
+		switch {
+		case !api.IsFileGrouping(groupBy):
+			return fmt.Errorf("invalid grouping '%v': must be one of tag, value:KEY, directory, extension", groupBy)
+		case options.HasOption("--format"), options.HasOption("--tree"):
+			return fmt.Errorf("--group-by cannot be specified with --format or --tree")
+		case print0:
+			return fmt.Errorf("--group-by cannot be specified with --print0")
+		}
+	}
+
+	basePath := ""
+	if options.HasOption("--base") {
+		var err error
+		basePath, err = filepath.Abs(options.Get("--base").Argument)
+		if err != nil {
+			return fmt.Errorf("%v: could not get absolute path: %v", options.Get("--base").Argument, err)
+		}
+	}
+
+	taggedBy := ""
+	if options.HasOption("--tagged-by") {
+		taggedBy = options.Get("--tagged-by").Argument
+	}
+
+	var taggedAfter time.Time
+	if options.HasOption("--tagged-after") {
+		var err error
+		taggedAfter, err = parseTime(options.Get("--tagged-after").Argument)
+		if err != nil {
+			return err
+		}
+	}
+
+	fileType := ""
+	switch {
+	case options.HasOption("--directory") && options.HasOption("--file"):
+		return fmt.Errorf("only one of --directory and --file may be specified")
+	case options.HasOption("--directory"):
+		fileType = "directory"
+	case options.HasOption("--file"):
+		fileType = "file"
+	}
+
+	var limit uint
+	if options.HasOption("--top") {
+		argument := options.Get("--top").Argument
+
+		top, err := strconv.ParseUint(argument, 10, 0)
+		if err != nil || top == 0 {
+			return fmt.Errorf("invalid number of items '%v': must be a positive integer", argument)
+		}
+
+		limit = uint(top)
+	}
+
 	sort := "name"
 	if options.HasOption("--sort") {
 		sort = options.Get("--sort").Argument
 	}
 
+	like := ""
+	if options.HasOption("--like") {
+		like = options.Get("--like").Argument
+	}
+
 	absPath := ""
 	if hasPath {
 		relPath := options.Get("--path").Argument
@@ -81,6 +241,37 @@ func filesExec(store *storage.Storage, options Options, args []string) error {
 		}
 	}
 
+	operation, pathListFile, separator := "", "", ""
+	for _, name := range []string{"--intersect", "--union", "--difference", "--filter-stdin", "--file0-from"} {
+		if options.HasOption(name) {
+			if operation != "" {
+				return fmt.Errorf("only one of --intersect, --union, --difference, --filter-stdin and --file0-from may be specified")
+			}
+
+			switch name {
+			case "--filter-stdin":
+				operation, pathListFile = "intersect", "-"
+			case "--file0-from":
+				operation, pathListFile, separator = "intersect", options.Get(name).Argument, "\000"
+			default:
+				operation, pathListFile = name[2:], options.Get(name).Argument
+			}
+		}
+	}
+
+	if operation != "" && options.HasOption("--explain") {
+		return fmt.Errorf("--explain cannot be specified with --intersect, --union, --difference, --filter-stdin or --file0-from")
+	}
+
+	var pathList []string
+	if operation != "" {
+		var err error
+		pathList, err = readPathList(pathListFile, separator)
+		if err != nil {
+			return err
+		}
+	}
+
 	tx, err := store.Begin()
 	if err != nil {
 		return err
@@ -88,75 +279,279 @@ func filesExec(store *storage.Storage, options Options, args []string) error {
 	defer tx.Commit()
 
 	queryText := strings.Join(args, " ")
-	return listFilesForQuery(store, tx, queryText, absPath, dirOnly, fileOnly, print0, showCount, explicitOnly, sort)
+	matchAny := options.HasOption("--any") || options.HasOption("--or")
+
+	if options.HasOption("--explain") {
+		return explainQuery(store, tx, queryText, matchAny, fileType, absPath, explicitOnly, sort)
+	}
+
+	queryOptions := api.QueryOptions{
+		Path:         absPath,
+		ExplicitOnly: explicitOnly,
+		Sort:         sort,
+		PathList:     pathList,
+		Operation:    operation,
+		TaggedBy:     taggedBy,
+		TaggedAfter:  taggedAfter,
+		Like:         like,
+		Any:          matchAny,
+		Type:         fileType,
+		Limit:        limit,
+	}
+	return listFilesForQuery(store, tx, queryText, queryOptions, print0, showCount, format, basePath, groupBy)
 }
 
 // unexported
 
-func listFilesForQuery(store *storage.Storage, tx *storage.Tx, queryText, path string, dirOnly, fileOnly, print0, showCount, explicitOnly bool, sort string) error {
-	log.Info(2, "parsing query")
+func listFilesForQuery(store *storage.Storage, tx *storage.Tx, queryText string, queryOptions api.QueryOptions, print0, showCount bool, format, basePath, groupBy string) error {
+	files, err := api.QueryFiles(store, tx, queryText, queryOptions)
+	if err != nil {
+		if noSuchTags, ok := err.(api.NoSuchTagsError); ok {
+			for _, tagName := range noSuchTags.Names {
+				log.Warnf("no such tag '%v'.", tagName)
+			}
+
+			return errNoSuchTag
+		}
+
+		return err
+	}
+
+	if groupBy != "" {
+		return listFileGroups(store, tx, files, groupBy, showCount, basePath)
+	}
+
+	if err = listFiles(tx, files, print0, showCount, format, basePath); err != nil {
+		return err
+	}
 
+	return nil
+}
+
+func listFileGroups(store *storage.Storage, tx *storage.Tx, files entities.Files, groupBy string, showCount bool, basePath string) error {
+	groups, err := api.GroupFiles(store, tx, files, groupBy)
+	if err != nil {
+		if noSuchTags, ok := err.(api.NoSuchTagsError); ok {
+			for _, tagName := range noSuchTags.Names {
+				log.Warnf("no such tag '%v'.", tagName)
+			}
+
+			return errNoSuchTag
+		}
+
+		return err
+	}
+
+	for _, group := range groups {
+		heading := fileGroupHeading(group, groupBy, basePath)
+
+		if showCount {
+			fmt.Printf("%v: %v\n", heading, len(group.Files))
+			continue
+		}
+
+		fmt.Printf("%v (%v)\n", heading, len(group.Files))
+		for _, file := range group.Files {
+			fmt.Println("  " + relativePath(file.Path(), basePath))
+		}
+	}
+
+	if len(files) == 0 {
+		return errNothingMatched
+	}
+
+	return nil
+}
+
+func fileGroupHeading(group api.FileGroup, groupBy, basePath string) string {
+	switch {
+	case groupBy == "tag":
+		if group.Ungrouped {
+			return "(untagged)"
+		}
+
+		return group.Name
+	case groupBy == "directory":
+		return relativePath(group.Name, basePath)
+	case groupBy == "extension":
+		if group.Ungrouped {
+			return "(no extension)"
+		}
+
+		return group.Name
+	default:
+		tagName := groupBy[len("value:"):]
+		if group.Ungrouped {
+			return "(without " + tagName + ")"
+		}
+
+		return api.TagValue{Tag: tagName, Value: group.Name}.String()
+	}
+}
+
+func explainQuery(store *storage.Storage, tx *storage.Tx, queryText string, matchAny bool, fileType, path string, explicitOnly bool, sort string) error {
 	expression, err := query.Parse(queryText)
 	if err != nil {
 		return fmt.Errorf("could not parse query: %v", err)
 	}
+	if matchAny {
+		expression = query.AnyOf(expression)
+	}
+	if fileType != "" {
+		expression = query.OfType(expression, fileType == "directory")
+	}
 
-	log.Info(2, "checking tag names")
+	fmt.Println("Query:")
+	fmt.Print(indent(query.Tree(expression), "  "))
 
-	wereErrors := false
+	tags, err := store.TagsByNames(tx, query.TagNames(expression))
+	if err != nil {
+		return fmt.Errorf("could not retrieve tags: %v", err)
+	}
 
-	tagNames := query.TagNames(expression)
-	tags, err := store.TagsByNames(tx, tagNames)
-	for _, tagName := range tagNames {
-		if !tags.ContainsName(tagName) {
-			log.Warnf("no such tag '%v'.", tagName)
-			wereErrors = true
-			continue
+	fmt.Println()
+	fmt.Println("Tags:")
+	for _, tagName := range uniqueNames(query.TagNames(expression)) {
+		tagId := "no such tag"
+		for _, tag := range tags {
+			if tag.Name == tagName {
+				tagId = fmt.Sprintf("#%v", tag.Id)
+			}
 		}
-	}
 
-	if wereErrors {
-		return errBlank
+		fmt.Printf("  %v: %v\n", tagName, tagId)
 	}
 
-	log.Info(2, "querying database")
+	valueNames := uniqueNames(query.ValueNames(expression))
+	if len(valueNames) > 0 {
+		values, err := store.ValuesByNames(tx, valueNames)
+		if err != nil {
+			return fmt.Errorf("could not retrieve values: %v", err)
+		}
+
+		fmt.Println()
+		fmt.Println("Values:")
+		for _, valueName := range valueNames {
+			valueId := "no such value"
+			for _, value := range values {
+				if value.Name == valueName {
+					valueId = fmt.Sprintf("#%v", value.Id)
+				}
+			}
 
-	files, err := store.QueryFiles(tx, expression, path, explicitOnly, sort)
+			fmt.Printf("  %v: %v\n", valueName, valueId)
+		}
+	}
+
+	explanation, err := store.ExplainQuery(tx, expression, path, explicitOnly, sort)
 	if err != nil {
-		if strings.Index(err.Error(), "parser stack overflow") > -1 {
-			return fmt.Errorf("the query is too complex (see the troubleshooting wiki for how to increase the stack size)")
-		} else {
-			return fmt.Errorf("could not query files: %v", err)
+		return fmt.Errorf("could not explain query: %v", err)
+	}
+
+	if !explicitOnly {
+		fmt.Println()
+		fmt.Println("Query with implied tags:")
+		fmt.Print(indent(query.Tree(explanation.Expression), "  "))
+	}
+
+	fmt.Println()
+	fmt.Println("SQL:")
+	for _, line := range strings.Split(explanation.Sql, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			fmt.Println("  " + line)
 		}
 	}
 
-	if err = listFiles(tx, files, dirOnly, fileOnly, print0, showCount); err != nil {
-		return err
+	if len(explanation.Params) > 0 {
+		fmt.Println()
+		fmt.Println("Parameters:")
+		for index, param := range explanation.Params {
+			fmt.Printf("  ?%v = '%v'\n", index+1, param)
+		}
 	}
 
+	fmt.Println()
+	fmt.Println("Plan:")
+	for _, step := range explanation.Plan {
+		fmt.Println("  " + step)
+	}
+
+	fmt.Println()
+	fmt.Printf("Rows (actual count): %v\n", explanation.FileCount)
+
 	return nil
 }
 
-func listFiles(tx *storage.Tx, files entities.Files, dirOnly, fileOnly, print0, showCount bool) error {
-	relPaths := make([]string, 0, len(files))
-	for _, file := range files {
-		if fileOnly && file.IsDir {
-			continue
-		}
-		if dirOnly && !file.IsDir {
-			continue
+func indent(text, prefix string) string {
+	lines := strings.SplitAfter(text, "\n")
+	for index, line := range lines {
+		if line != "" {
+			lines[index] = prefix + line
 		}
+	}
 
-		absPath := file.Path()
-		relPath := path.Rel(absPath)
+	return strings.Join(lines, "")
+}
 
-		relPaths = append(relPaths, relPath)
+func uniqueNames(names []string) []string {
+	unique := make([]string, 0, len(names))
+	for _, name := range names {
+		if !containsTag(unique, name) {
+			unique = append(unique, name)
+		}
 	}
 
+	return unique
+}
+
+func listFiles(tx *storage.Tx, files entities.Files, print0, showCount bool, format, basePath string) error {
 	if showCount {
-		fmt.Println(len(relPaths))
+		fmt.Println(len(files))
 	} else {
-		for _, relPath := range relPaths {
+		if err := printFiles(files, print0, format, basePath); err != nil {
+			return err
+		}
+	}
+
+	if len(files) == 0 {
+		return errNothingMatched
+	}
+
+	return nil
+}
+
+func printFiles(files entities.Files, print0 bool, format, basePath string) error {
+	switch format {
+	case "m3u":
+		fmt.Println("#EXTM3U")
+
+		for _, file := range files {
+			title := strings.TrimSuffix(file.Name, filepath.Ext(file.Name))
+
+			fmt.Printf("#EXTINF:-1,%v\n", title)
+			fmt.Println(relativePath(file.Path(), basePath))
+		}
+	case "csv":
+		writer := csv.NewWriter(os.Stdout)
+		writer.Write([]string{"path", "size", "modified"})
+
+		for _, file := range files {
+			size := strconv.FormatInt(file.Size, 10)
+			modTime := file.ModTime.Local().Format(time.RFC3339)
+
+			writer.Write([]string{relativePath(file.Path(), basePath), size, modTime})
+		}
+
+		writer.Flush()
+		if err := writer.Error(); err != nil {
+			return fmt.Errorf("could not write CSV: %v", err)
+		}
+	case "tree":
+		printFileTree(files, basePath)
+	default:
+		for _, file := range files {
+			relPath := relativePath(file.Path(), basePath)
+
 			if print0 {
 				fmt.Printf("%v\000", relPath)
 			} else {
@@ -168,6 +563,157 @@ func listFiles(tx *storage.Tx, files entities.Files, dirOnly, fileOnly, print0,
 	return nil
 }
 
+type fileTreeNode struct {
+	name     string
+	isDir    bool
+	matched  bool
+	count    uint
+	children []*fileTreeNode
+}
+
+func (node *fileTreeNode) add(names []string, isDir bool) {
+	var child *fileTreeNode
+	for _, existing := range node.children {
+		if existing.name == names[0] {
+			child = existing
+			break
+		}
+	}
+	if child == nil {
+		child = &fileTreeNode{name: names[0], isDir: true}
+		node.children = append(node.children, child)
+	}
+
+	if len(names) == 1 {
+		child.isDir = isDir
+		child.matched = true
+	} else {
+		child.add(names[1:], isDir)
+	}
+
+	node.count++
+}
+
+func (node *fileTreeNode) print(indent string) {
+	for _, child := range node.children {
+		name := child.name
+		for !child.matched && len(child.children) == 1 && child.children[0].isDir && len(child.children[0].children) > 0 {
+			child = child.children[0]
+			name = filepath.Join(name, child.name)
+		}
+
+		switch {
+		case len(child.children) > 0:
+			fmt.Printf("%v%v%c (%v)\n", indent, name, filepath.Separator, child.count)
+			child.print(indent + "  ")
+		case child.isDir:
+			fmt.Printf("%v%v%c\n", indent, name, filepath.Separator)
+		default:
+			fmt.Println(indent + name)
+		}
+	}
+}
+
+// Prints the files as a tree beneath the deepest directory containing them
+// all, with the number of files beneath each directory.
+func printFileTree(files entities.Files, basePath string) {
+	if len(files) == 0 {
+		return
+	}
+
+	rootPath := files[0].Directory
+	for _, file := range files[1:] {
+		rootPath = commonDirectory(rootPath, file.Directory)
+	}
+
+	root := fileTreeNode{isDir: true}
+	for _, file := range files {
+		relPath, err := filepath.Rel(rootPath, file.Path())
+		if err != nil {
+			relPath = file.Path()
+		}
+
+		root.add(strings.Split(relPath, string(filepath.Separator)), file.IsDir)
+	}
+
+	rootName := relativePath(rootPath, basePath)
+	if !strings.HasSuffix(rootName, string(filepath.Separator)) {
+		rootName += string(filepath.Separator)
+	}
+
+	fmt.Printf("%v (%v)\n", rootName, root.count)
+	root.print("  ")
+}
+
+// Finds the deepest directory containing both of the directories.
+func commonDirectory(path, otherPath string) string {
+	for path != otherPath && !strings.HasPrefix(otherPath, path+string(filepath.Separator)) {
+		parentPath := filepath.Dir(path)
+		if parentPath == path {
+			break
+		}
+
+		path = parentPath
+	}
+
+	return path
+}
+
+// Makes the path relative to the base path or, if there is none, to the
+// working directory.
+func relativePath(absPath, basePath string) string {
+	if basePath == "" {
+		return displayPath(path.Rel(absPath))
+	}
+
+	relPath, err := filepath.Rel(basePath, absPath)
+	if err != nil {
+		return absPath
+	}
+
+	return relPath
+}
+
+// Reads the list of paths from the file, or standard input if path is '-'.
+// The paths are separated by the separator or, if it is empty, by NUL
+// characters if the list contains any and newlines otherwise.
+func readPathList(path, separator string) ([]string, error) {
+	var content []byte
+	var err error
+
+	if path == "-" {
+		content, err = ioutil.ReadAll(os.Stdin)
+	} else {
+		content, err = ioutil.ReadFile(path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%v: could not read path list: %v", path, err)
+	}
+
+	if separator == "" {
+		separator = "\n"
+		if strings.Contains(string(content), "\000") {
+			separator = "\000"
+		}
+	}
+
+	paths := make([]string, 0, 10)
+	for _, line := range strings.Split(string(content), separator) {
+		if line == "" {
+			continue
+		}
+
+		absPath, err := filepath.Abs(line)
+		if err != nil {
+			return nil, fmt.Errorf("%v: could not get absolute path: %v", line, err)
+		}
+
+		paths = append(paths, absPath)
+	}
+
+	return paths, nil
+}
+
 func containsTag(tags []string, tag string) bool {
 	for _, iteratedTag := range tags {
 		if iteratedTag == tag {
@@ -18,9 +18,11 @@ package cli
 import (
 	"io/ioutil"
 	"os"
+	"path/filepath"
 	"testing"
 	"time"
 	"tmsu/common/fingerprint"
+	"tmsu/entities"
 	"tmsu/storage"
 )
 
@@ -614,13 +616,19 @@ func TestFilesOr(test *testing.T) {
 	if err := FilesCommand.Exec(store, Options{}, []string{"b", "or", "c"}); err != nil {
 		test.Fatal(err)
 	}
+	if err := FilesCommand.Exec(store, Options{Option{"--any", "-a", "", false, ""}}, []string{"b", "c"}); err != nil {
+		test.Fatal(err)
+	}
+	if err := FilesCommand.Exec(store, Options{Option{"--or", "", "", false, ""}}, []string{"b", "c", "not", "d"}); err != nil {
+		test.Fatal(err)
+	}
 
 	// validate
 
 	outFile.Seek(0, 0)
 
 	bytes, err := ioutil.ReadAll(outFile)
-	compareOutput(test, "/tmp/b\n/tmp/b/a\n", string(bytes))
+	compareOutput(test, "/tmp/b\n/tmp/b/a\n/tmp/b\n/tmp/b/a\n/tmp/b\n/tmp/b/a\n", string(bytes))
 }
 
 func TestFilesTagEqualsValue(test *testing.T) {
@@ -774,6 +782,96 @@ func TestFilesTagNotEqualsValue(test *testing.T) {
 	compareOutput(test, "/tmp/a\n/tmp/a\n/tmp/a\n", string(bytes))
 }
 
+func TestFilesTagValuePattern(test *testing.T) {
+	// set-up
+
+	databasePath := testDatabase()
+	defer os.Remove(databasePath)
+
+	err := redirectStreams()
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer restoreStreams()
+
+	store, err := storage.OpenAt(databasePath)
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer store.Close()
+
+	tx, err := store.Begin()
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	fileA, err := store.AddFile(tx, "/tmp/a", fingerprint.Fingerprint("abc"), time.Now(), 123, false)
+	if err != nil {
+		test.Fatal(err)
+	}
+	fileB, err := store.AddFile(tx, "/tmp/b", fingerprint.Fingerprint("abc"), time.Now(), 123, false)
+	if err != nil {
+		test.Fatal(err)
+	}
+	fileC, err := store.AddFile(tx, "/tmp/c", fingerprint.Fingerprint("abc"), time.Now(), 123, false)
+	if err != nil {
+		test.Fatal(err)
+	}
+	if _, err := store.AddFile(tx, "/tmp/d", fingerprint.Fingerprint("abc"), time.Now(), 123, false); err != nil {
+		test.Fatal(err)
+	}
+
+	tagYear, err := store.AddTag(tx, "year")
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	value1999, err := store.AddValue(tx, "1999")
+	if err != nil {
+		test.Fatal(err)
+	}
+	value2001, err := store.AddValue(tx, "2001")
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	if _, err := store.AddFileTag(tx, fileA.Id, tagYear.Id, value1999.Id); err != nil {
+		test.Fatal(err)
+	}
+	if _, err := store.AddFileTag(tx, fileB.Id, tagYear.Id, value2001.Id); err != nil {
+		test.Fatal(err)
+	}
+	if _, err := store.AddFileTag(tx, fileC.Id, tagYear.Id, 0); err != nil {
+		test.Fatal(err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		test.Fatal(err)
+	}
+
+	// test
+
+	if err := FilesCommand.Exec(store, Options{}, []string{"year=19*"}); err != nil {
+		test.Fatal(err)
+	}
+	if err := FilesCommand.Exec(store, Options{}, []string{"year != 19??"}); err != nil {
+		test.Fatal(err)
+	}
+	if err := FilesCommand.Exec(store, Options{}, []string{"year", "and", "not", "year=*"}); err != nil {
+		test.Fatal(err)
+	}
+	if err := FilesCommand.Exec(store, Options{}, []string{"not", "year"}); err != nil {
+		test.Fatal(err)
+	}
+
+	// validate
+
+	outFile.Seek(0, 0)
+
+	bytes, err := ioutil.ReadAll(outFile)
+	compareOutput(test, "/tmp/a\n/tmp/b\n/tmp/c\n/tmp/d\n", string(bytes))
+}
+
 func TestFilesTagLessThanValue(test *testing.T) {
 	// set-up
 
@@ -1082,4 +1180,827 @@ func TestFilesTagGreaterThanOrEqualToValue(test *testing.T) {
 	compareOutput(test, "/tmp/a\n/tmp/b\n/tmp/a\n/tmp/b\n/tmp/a\n/tmp/b\n", string(bytes))
 }
 
+func TestFilesPathListOperations(test *testing.T) {
+	// set-up
+
+	databasePath := testDatabase()
+	defer os.Remove(databasePath)
+
+	pathListPath := filepath.Join(os.TempDir(), "tmsu_test.list")
+	if err := ioutil.WriteFile(pathListPath, []byte("/tmp/b\n/tmp/c\n"), 0600); err != nil {
+		test.Fatal(err)
+	}
+	defer os.Remove(pathListPath)
+
+	err := redirectStreams()
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer restoreStreams()
+
+	store, err := storage.OpenAt(databasePath)
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer store.Close()
+
+	tx, err := store.Begin()
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	fileA, err := store.AddFile(tx, "/tmp/a", fingerprint.Fingerprint("abc"), time.Now(), 123, false)
+	if err != nil {
+		test.Fatal(err)
+	}
+	fileB, err := store.AddFile(tx, "/tmp/b", fingerprint.Fingerprint("abc"), time.Now(), 123, false)
+	if err != nil {
+		test.Fatal(err)
+	}
+	fileC, err := store.AddFile(tx, "/tmp/c", fingerprint.Fingerprint("abc"), time.Now(), 123, false)
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	tagX, err := store.AddTag(tx, "x")
+	if err != nil {
+		test.Fatal(err)
+	}
+	tagY, err := store.AddTag(tx, "y")
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	if _, err := store.AddFileTag(tx, fileA.Id, tagX.Id, 0); err != nil {
+		test.Fatal(err)
+	}
+	if _, err := store.AddFileTag(tx, fileB.Id, tagX.Id, 0); err != nil {
+		test.Fatal(err)
+	}
+	if _, err := store.AddFileTag(tx, fileC.Id, tagY.Id, 0); err != nil {
+		test.Fatal(err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		test.Fatal(err)
+	}
+
+	// test
+
+	if err := FilesCommand.Exec(store, Options{Option{"--intersect", "", "", true, pathListPath}}, []string{"x"}); err != nil {
+		test.Fatal(err)
+	}
+	if err := FilesCommand.Exec(store, Options{Option{"--union", "", "", true, pathListPath}}, []string{"x"}); err != nil {
+		test.Fatal(err)
+	}
+	if err := FilesCommand.Exec(store, Options{Option{"--difference", "", "", true, pathListPath}}, []string{"x"}); err != nil {
+		test.Fatal(err)
+	}
+	if err := FilesCommand.Exec(store, Options{Option{"--union", "", "", true, pathListPath}, Option{"--explain", "", "", false, ""}}, []string{"x"}); err == nil {
+		test.Fatal("Expected --explain to be rejected with a path list operation.")
+	}
+
+	// validate
+
+	outFile.Seek(0, 0)
+
+	bytes, err := ioutil.ReadAll(outFile)
+	compareOutput(test, "/tmp/b\n/tmp/a\n/tmp/b\n/tmp/c\n/tmp/a\n", string(bytes))
+}
+
+func TestFilesNothingMatched(test *testing.T) {
+	// set-up
+
+	databasePath := testDatabase()
+	defer os.Remove(databasePath)
+
+	err := redirectStreams()
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer restoreStreams()
+
+	store, err := storage.OpenAt(databasePath)
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer store.Close()
+
+	tx, err := store.Begin()
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	if _, err := store.AddTag(tx, "a"); err != nil {
+		test.Fatal(err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		test.Fatal(err)
+	}
+
+	// test
+
+	err = FilesCommand.Exec(store, Options{}, []string{"a"})
+
+	// validate
+
+	if exitStatus(err) != exitNothingMatched {
+		test.Fatalf("Expected exit status %v but was %v.", exitNothingMatched, exitStatus(err))
+	}
+
+	err = FilesCommand.Exec(store, Options{}, []string{"b"})
+	if exitStatus(err) != exitNoSuchTag {
+		test.Fatalf("Expected exit status %v but was %v.", exitNoSuchTag, exitStatus(err))
+	}
+}
+
+func TestFilesTaggedBy(test *testing.T) {
+	// set-up
+
+	databasePath := testDatabase()
+	defer os.Remove(databasePath)
+
+	err := redirectStreams()
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer restoreStreams()
+
+	store, err := storage.OpenAt(databasePath)
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer store.Close()
+
+	tx, err := store.Begin()
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	fileA, err := store.AddFile(tx, "/tmp/a", fingerprint.Fingerprint("abc"), time.Now(), 123, false)
+	if err != nil {
+		test.Fatal(err)
+	}
+	fileB, err := store.AddFile(tx, "/tmp/b", fingerprint.Fingerprint("abc"), time.Now(), 123, false)
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	tag, err := store.AddTag(tx, "music")
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	store.Username = "bob"
+	if _, err := store.AddFileTag(tx, fileA.Id, tag.Id, 0); err != nil {
+		test.Fatal(err)
+	}
+
+	store.Username = "sue"
+	if _, err := store.AddFileTag(tx, fileB.Id, tag.Id, 0); err != nil {
+		test.Fatal(err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		test.Fatal(err)
+	}
+
+	// test
+
+	if err := FilesCommand.Exec(store, Options{Option{"--tagged-by", "", "", true, "bob"}}, []string{"music"}); err != nil {
+		test.Fatal(err)
+	}
+
+	// validate
+
+	outFile.Seek(0, 0)
+
+	bytes, err := ioutil.ReadAll(outFile)
+	compareOutput(test, "/tmp/a\n", string(bytes))
+}
+
 //TODO tests for 'file' and 'directory' options.
+
+func TestFilesFormats(test *testing.T) {
+	// set-up
+
+	databasePath := testDatabase()
+	defer os.Remove(databasePath)
+
+	err := redirectStreams()
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer restoreStreams()
+
+	store, err := storage.OpenAt(databasePath)
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer store.Close()
+
+	tx, err := store.Begin()
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	modTime := time.Date(2015, 6, 1, 12, 0, 0, 0, time.Local)
+
+	fileA, err := store.AddFile(tx, "/tmp/music/a.mp3", fingerprint.Fingerprint("abc"), modTime, 123, false)
+	if err != nil {
+		test.Fatal(err)
+	}
+	fileB, err := store.AddFile(tx, "/tmp/music/jazz/b.flac", fingerprint.Fingerprint("def"), modTime, 456, false)
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	tagX, err := store.AddTag(tx, "x")
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	if _, err := store.AddFileTag(tx, fileA.Id, tagX.Id, 0); err != nil {
+		test.Fatal(err)
+	}
+	if _, err := store.AddFileTag(tx, fileB.Id, tagX.Id, 0); err != nil {
+		test.Fatal(err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		test.Fatal(err)
+	}
+
+	// test
+
+	options := Options{Option{"--format", "", "", true, "m3u"}, Option{"--base", "", "", true, "/tmp/music"}}
+	if err := FilesCommand.Exec(store, options, []string{"x"}); err != nil {
+		test.Fatal(err)
+	}
+
+	options = Options{Option{"--format", "", "", true, "csv"}, Option{"--base", "", "", true, "/tmp/music/jazz"}}
+	if err := FilesCommand.Exec(store, options, []string{"x"}); err != nil {
+		test.Fatal(err)
+	}
+
+	// validate
+
+	outFile.Seek(0, 0)
+
+	timestamp := modTime.Format(time.RFC3339)
+
+	bytes, err := ioutil.ReadAll(outFile)
+	compareOutput(test, "#EXTM3U\n#EXTINF:-1,a\na.mp3\n#EXTINF:-1,b\njazz/b.flac\n"+
+		"path,size,modified\n../a.mp3,123,"+timestamp+"\nb.flac,456,"+timestamp+"\n", string(bytes))
+}
+
+func TestFilesLike(test *testing.T) {
+	// set-up
+
+	databasePath := testDatabase()
+	defer os.Remove(databasePath)
+
+	err := redirectStreams()
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer restoreStreams()
+
+	store, err := storage.OpenAt(databasePath)
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer store.Close()
+
+	tx, err := store.Begin()
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	paths := []string{"/tmp/a", "/tmp/b", "/tmp/c", "/tmp/d"}
+	tagNames := [][]string{{"jazz", "live", "vinyl"}, {"jazz"}, {"jazz", "live"}, {"rock"}}
+
+	for index, path := range paths {
+		file, err := store.AddFile(tx, path, fingerprint.Fingerprint(path), time.Now(), 123, false)
+		if err != nil {
+			test.Fatal(err)
+		}
+
+		for _, tagName := range tagNames[index] {
+			tag, err := store.TagByName(tx, tagName)
+			if err != nil {
+				test.Fatal(err)
+			}
+			if tag == nil {
+				if tag, err = store.AddTag(tx, tagName); err != nil {
+					test.Fatal(err)
+				}
+			}
+
+			if _, err := store.AddFileTag(tx, file.Id, tag.Id, 0); err != nil {
+				test.Fatal(err)
+			}
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		test.Fatal(err)
+	}
+
+	// test
+
+	if err := FilesCommand.Exec(store, Options{Option{"--like", "", "", true, "/tmp/a"}}, []string{}); err != nil {
+		test.Fatal(err)
+	}
+
+	// validate
+
+	outFile.Seek(0, 0)
+
+	bytes, err := ioutil.ReadAll(outFile)
+	compareOutput(test, "/tmp/c\n/tmp/b\n", string(bytes))
+}
+
+func TestFilesFile0From(test *testing.T) {
+	// set-up
+
+	databasePath := testDatabase()
+	defer os.Remove(databasePath)
+
+	pathListPath := filepath.Join(os.TempDir(), "tmsu_test.list")
+	if err := ioutil.WriteFile(pathListPath, []byte("/tmp/b\000/tmp/c\000"), 0600); err != nil {
+		test.Fatal(err)
+	}
+	defer os.Remove(pathListPath)
+
+	err := redirectStreams()
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer restoreStreams()
+
+	store, err := storage.OpenAt(databasePath)
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer store.Close()
+
+	tx, err := store.Begin()
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	tag, err := store.AddTag(tx, "x")
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	for _, path := range []string{"/tmp/a", "/tmp/b", "/tmp/c"} {
+		file, err := store.AddFile(tx, path, fingerprint.Fingerprint("abc"), time.Now(), 123, false)
+		if err != nil {
+			test.Fatal(err)
+		}
+
+		if _, err := store.AddFileTag(tx, file.Id, tag.Id, 0); err != nil {
+			test.Fatal(err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		test.Fatal(err)
+	}
+
+	// test
+
+	if err := FilesCommand.Exec(store, Options{Option{"--file0-from", "", "", true, pathListPath}}, []string{"x"}); err != nil {
+		test.Fatal(err)
+	}
+
+	// validate
+
+	outFile.Seek(0, 0)
+
+	bytes, err := ioutil.ReadAll(outFile)
+	compareOutput(test, "/tmp/b\n/tmp/c\n", string(bytes))
+}
+
+func TestFilesDateRange(test *testing.T) {
+	// set-up
+
+	databasePath := testDatabase()
+	defer os.Remove(databasePath)
+
+	err := redirectStreams()
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer restoreStreams()
+
+	store, err := storage.OpenAt(databasePath)
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer store.Close()
+
+	tx, err := store.Begin()
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	tag, err := store.AddTag(tx, "taken")
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	recently := time.Now().AddDate(0, 0, -2).Format("2006-01-02")
+	dates := map[string]string{"/tmp/a": "2019-12-31", "/tmp/b": "2020-06-01T12:00", "/tmp/c": "2020-12-31T23:59:59", "/tmp/d": recently, "/tmp/e": "unknown"}
+	for _, path := range []string{"/tmp/a", "/tmp/b", "/tmp/c", "/tmp/d", "/tmp/e"} {
+		file, err := store.AddFile(tx, path, fingerprint.Fingerprint("abc"), time.Now(), 123, false)
+		if err != nil {
+			test.Fatal(err)
+		}
+
+		value, err := store.AddValue(tx, dates[path])
+		if err != nil {
+			test.Fatal(err)
+		}
+
+		if _, err := store.AddFileTag(tx, file.Id, tag.Id, value.Id); err != nil {
+			test.Fatal(err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		test.Fatal(err)
+	}
+
+	// test
+
+	if err := FilesCommand.Exec(store, Options{}, []string{"taken >= 2020-01-01", "taken < 2021-01-01"}); err != nil {
+		test.Fatal(err)
+	}
+	if err := FilesCommand.Exec(store, Options{}, []string{"taken > -30d"}); err != nil {
+		test.Fatal(err)
+	}
+
+	// validate
+
+	outFile.Seek(0, 0)
+
+	bytes, err := ioutil.ReadAll(outFile)
+	compareOutput(test, "/tmp/b\n/tmp/c\n/tmp/d\n", string(bytes))
+}
+
+func TestFilesSizeAndDuration(test *testing.T) {
+	// set-up
+
+	databasePath := testDatabase()
+	defer os.Remove(databasePath)
+
+	err := redirectStreams()
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer restoreStreams()
+
+	store, err := storage.OpenAt(databasePath)
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer store.Close()
+
+	tx, err := store.Begin()
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	sizeTag, err := store.AddTag(tx, "size")
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	lengthTag, err := store.AddTag(tx, "length")
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	sizes := map[string]string{"/tmp/a": "1.2GB", "/tmp/b": "650MiB", "/tmp/c": "800000000", "/tmp/d": "big"}
+	lengths := map[string]string{"/tmp/a": "3m20s", "/tmp/b": "1h30m", "/tmp/c": "45s", "/tmp/d": "2m"}
+	for _, path := range []string{"/tmp/a", "/tmp/b", "/tmp/c", "/tmp/d"} {
+		file, err := store.AddFile(tx, path, fingerprint.Fingerprint("abc"), time.Now(), 123, false)
+		if err != nil {
+			test.Fatal(err)
+		}
+
+		for tag, values := range map[*entities.Tag]map[string]string{sizeTag: sizes, lengthTag: lengths} {
+			value, err := store.ValueByName(tx, values[path])
+			if err != nil {
+				test.Fatal(err)
+			}
+			if value == nil {
+				value, err = store.AddValue(tx, values[path])
+				if err != nil {
+					test.Fatal(err)
+				}
+			}
+
+			if _, err := store.AddFileTag(tx, file.Id, tag.Id, value.Id); err != nil {
+				test.Fatal(err)
+			}
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		test.Fatal(err)
+	}
+
+	// test
+
+	if err := FilesCommand.Exec(store, Options{}, []string{"size > 700MB"}); err != nil {
+		test.Fatal(err)
+	}
+	if err := FilesCommand.Exec(store, Options{}, []string{"length <= 3m20s"}); err != nil {
+		test.Fatal(err)
+	}
+
+	// validate
+
+	outFile.Seek(0, 0)
+
+	bytes, err := ioutil.ReadAll(outFile)
+	compareOutput(test, "/tmp/a\n/tmp/c\n/tmp/a\n/tmp/c\n/tmp/d\n", string(bytes))
+}
+
+func TestFilesTypeAndTop(test *testing.T) {
+	// set-up
+
+	databasePath := testDatabase()
+	defer os.Remove(databasePath)
+
+	err := redirectStreams()
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer restoreStreams()
+
+	store, err := storage.OpenAt(databasePath)
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer store.Close()
+
+	tx, err := store.Begin()
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	tag, err := store.AddTag(tx, "project")
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	for path, isDir := range map[string]bool{"/tmp/a": true, "/tmp/a/b": false, "/tmp/c": false, "/tmp/d": true} {
+		file, err := store.AddFile(tx, path, fingerprint.Fingerprint("abc"), time.Now(), 123, isDir)
+		if err != nil {
+			test.Fatal(err)
+		}
+
+		if _, err := store.AddFileTag(tx, file.Id, tag.Id, 0); err != nil {
+			test.Fatal(err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		test.Fatal(err)
+	}
+
+	// test
+
+	if err := FilesCommand.Exec(store, Options{Option{"--directory", "-d", "", false, ""}}, []string{"project"}); err != nil {
+		test.Fatal(err)
+	}
+	if err := FilesCommand.Exec(store, Options{Option{"--file", "-f", "", false, ""}}, []string{"project"}); err != nil {
+		test.Fatal(err)
+	}
+	if err := FilesCommand.Exec(store, Options{Option{"--top", "-n", "", true, "3"}}, []string{}); err != nil {
+		test.Fatal(err)
+	}
+	if err := FilesCommand.Exec(store, Options{Option{"--file", "-f", "", false, ""}, Option{"--top", "-n", "", true, "1"}}, []string{"project"}); err != nil {
+		test.Fatal(err)
+	}
+
+	// validate
+
+	outFile.Seek(0, 0)
+
+	bytes, err := ioutil.ReadAll(outFile)
+	compareOutput(test, "/tmp/a\n/tmp/d\n/tmp/a/b\n/tmp/c\n/tmp/a\n/tmp/a/b\n/tmp/c\n/tmp/a/b\n", string(bytes))
+}
+
+func TestFilesLeadingDashTag(test *testing.T) {
+	// set-up
+
+	databasePath := testDatabase()
+	defer os.Remove(databasePath)
+
+	err := redirectStreams()
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer restoreStreams()
+
+	store, err := storage.OpenAt(databasePath)
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer store.Close()
+
+	if err := createFile("/tmp/tmsu/a", "hello"); err != nil {
+		test.Fatal(err)
+	}
+	defer os.Remove("/tmp/tmsu/a")
+
+	if err := createFile("/tmp/tmsu/b", "world"); err != nil {
+		test.Fatal(err)
+	}
+	defer os.Remove("/tmp/tmsu/b")
+
+	if err := TagCommand.Exec(store, Options{}, []string{"/tmp/tmsu/a", "-funny", "joke"}); err != nil {
+		test.Fatal(err)
+	}
+	if err := TagCommand.Exec(store, Options{}, []string{"/tmp/tmsu/b", "joke"}); err != nil {
+		test.Fatal(err)
+	}
+
+	// test
+
+	if err := FilesCommand.Exec(store, Options{}, []string{"tag:-funny"}); err != nil {
+		test.Fatal(err)
+	}
+	if err := FilesCommand.Exec(store, Options{}, []string{"joke", "!tag:-funny"}); err != nil {
+		test.Fatal(err)
+	}
+
+	// validate
+
+	outFile.Seek(0, 0)
+
+	bytes, err := ioutil.ReadAll(outFile)
+	compareOutput(test, "/tmp/tmsu/a\n/tmp/tmsu/b\n", string(bytes))
+}
+
+func TestFilesTree(test *testing.T) {
+	// set-up
+
+	databasePath := testDatabase()
+	defer os.Remove(databasePath)
+
+	err := redirectStreams()
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer restoreStreams()
+
+	store, err := storage.OpenAt(databasePath)
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer store.Close()
+
+	tx, err := store.Begin()
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	tagX, err := store.AddTag(tx, "x")
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	for _, path := range []string{"/tmp/music/a.mp3", "/tmp/music/jazz/b.flac", "/tmp/music/jazz/c.flac", "/tmp/music/rock/live/d.mp3"} {
+		file, err := store.AddFile(tx, path, fingerprint.Fingerprint(path), time.Now(), 123, false)
+		if err != nil {
+			test.Fatal(err)
+		}
+
+		if _, err := store.AddFileTag(tx, file.Id, tagX.Id, 0); err != nil {
+			test.Fatal(err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		test.Fatal(err)
+	}
+
+	// test
+
+	if err := FilesCommand.Exec(store, Options{Option{"--tree", "-t", "", false, ""}}, []string{"x"}); err != nil {
+		test.Fatal(err)
+	}
+
+	options := Options{Option{"--tree", "-t", "", false, ""}, Option{"--count", "-c", "", false, ""}}
+	if err := FilesCommand.Exec(store, options, []string{"x"}); err == nil {
+		test.Fatal("Expected --tree with --count to be rejected.")
+	}
+
+	// validate
+
+	outFile.Seek(0, 0)
+
+	bytes, err := ioutil.ReadAll(outFile)
+	compareOutput(test, "/tmp/music/ (4)\n  a.mp3\n  jazz/ (2)\n    b.flac\n    c.flac\n  rock/live/ (1)\n    d.mp3\n", string(bytes))
+}
+
+func TestFilesGroupBy(test *testing.T) {
+	// set-up
+
+	databasePath := testDatabase()
+	defer os.Remove(databasePath)
+
+	err := redirectStreams()
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer restoreStreams()
+
+	store, err := storage.OpenAt(databasePath)
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer store.Close()
+
+	tx, err := store.Begin()
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	tagX, err := store.AddTag(tx, "x")
+	if err != nil {
+		test.Fatal(err)
+	}
+	tagGenre, err := store.AddTag(tx, "genre")
+	if err != nil {
+		test.Fatal(err)
+	}
+	valueJazz, err := store.AddValue(tx, "jazz")
+	if err != nil {
+		test.Fatal(err)
+	}
+	valueRock, err := store.AddValue(tx, "rock")
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	genres := map[string]entities.ValueId{"/tmp/music/a.mp3": valueJazz.Id,
+		"/tmp/music/b.flac":     valueJazz.Id,
+		"/tmp/music/rock/c.mp3": valueRock.Id}
+
+	for _, path := range []string{"/tmp/music/a.mp3", "/tmp/music/b.flac", "/tmp/music/d.ogg", "/tmp/music/rock/c.mp3"} {
+		file, err := store.AddFile(tx, path, fingerprint.Fingerprint(path), time.Now(), 123, false)
+		if err != nil {
+			test.Fatal(err)
+		}
+
+		if _, err := store.AddFileTag(tx, file.Id, tagX.Id, 0); err != nil {
+			test.Fatal(err)
+		}
+
+		if valueId, ok := genres[path]; ok {
+			if _, err := store.AddFileTag(tx, file.Id, tagGenre.Id, valueId); err != nil {
+				test.Fatal(err)
+			}
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		test.Fatal(err)
+	}
+
+	// test
+
+	if err := FilesCommand.Exec(store, Options{Option{"--group-by", "-g", "", true, "value:genre"}}, []string{"x"}); err != nil {
+		test.Fatal(err)
+	}
+
+	options := Options{Option{"--group-by", "-g", "", true, "extension"}, Option{"--count", "-c", "", false, ""}}
+	if err := FilesCommand.Exec(store, options, []string{"x"}); err != nil {
+		test.Fatal(err)
+	}
+
+	if err := FilesCommand.Exec(store, Options{Option{"--group-by", "-g", "", true, "value:"}}, []string{"x"}); err == nil {
+		test.Fatal("Expected a grouping without a tag name to be rejected.")
+	}
+
+	if err := FilesCommand.Exec(store, Options{Option{"--group-by", "-g", "", true, "value:nonexist"}}, []string{"x"}); err != errNoSuchTag {
+		test.Fatalf("Expected a grouping by a nonexistent tag to fail with no such tag but was %v.", err)
+	}
+
+	// validate
+
+	outFile.Seek(0, 0)
+
+	bytes, err := ioutil.ReadAll(outFile)
+	compareOutput(test, "genre=jazz (2)\n  /tmp/music/a.mp3\n  /tmp/music/b.flac\ngenre=rock (1)\n  /tmp/music/rock/c.mp3\n(without genre) (1)\n  /tmp/music/d.ogg\n"+
+		".flac: 1\n.mp3: 2\n.ogg: 1\n", string(bytes))
+}
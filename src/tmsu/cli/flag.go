@@ -0,0 +1,88 @@
+// Copyright 2011-2015 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package cli
+
+import (
+	"fmt"
+	"tmsu/api"
+	"tmsu/common/log"
+	"tmsu/storage"
+)
+
+var FlagCommand = Command{
+	Name:     "flag",
+	Synopsis: "Flag or unflag files",
+	Usages:   []string{"tmsu flag [OPTION]... FILE..."},
+	Description: `Toggles the flag on each FILE, flagging those that are not flagged and unflagging those that are. Flags mark files out, e.g. as favourites or for later attention.
+
+A flag is stored as the 'flagged' tag, so flagged files can be listed with 'tmsu files flagged'.`,
+	Examples: []string{"$ tmsu flag sunset.jpg",
+		"$ tmsu files flagged\nsunset.jpg",
+		"$ tmsu flag --clear sunset.jpg beach.jpg"},
+	Options: Options{{"--set", "-s", "flag each file, whether or not it is already flagged", false, ""},
+		{"--clear", "-c", "unflag each file, whether or not it is flagged", false, ""}},
+	Exec:     flagExec,
+	Modifies: true,
+}
+
+// unexported
+
+func flagExec(store *storage.Storage, options Options, args []string) error {
+	if len(args) < 1 {
+		return fmt.Errorf("too few arguments")
+	}
+
+	set := options.HasOption("--set")
+	clear := options.HasOption("--clear")
+	if set && clear {
+		return fmt.Errorf("--set and --clear cannot be specified together")
+	}
+
+	tx, err := store.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Commit()
+
+	settings, err := store.Settings(tx)
+	if err != nil {
+		return err
+	}
+
+	for _, path := range args {
+		flagged := set
+		if !set && !clear {
+			wasFlagged, err := api.FileFlagged(store, tx, path)
+			if err != nil {
+				return err
+			}
+
+			flagged = !wasFlagged
+		}
+
+		if flagged {
+			log.Infof(2, "%v: flagging", path)
+		} else {
+			log.Infof(2, "%v: unflagging", path)
+		}
+
+		if err := api.FlagFile(store, tx, path, flagged, settings); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
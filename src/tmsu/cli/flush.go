@@ -0,0 +1,126 @@
+// Copyright 2011-2015 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package cli
+
+import (
+	"fmt"
+	"strings"
+	"tmsu/api"
+	"tmsu/common/log"
+	"tmsu/common/text"
+	"tmsu/storage"
+)
+
+var FlushCommand = Command{
+	Name:     "flush",
+	Synopsis: "Apply the tags queued for files that were not available",
+	Usages:   []string{"tmsu flush [OPTION]..."},
+	Description: `Applies the tags queued by 'tmsu tag --queue' to the files that are now available, such as those on a volume that has since been mounted, fingerprinting the files as they are tagged. Each file tagged is listed with its tags. The tags of files that are still not available remain queued.
+
+Queued tags are also applied by the first command run once their files are available: this command need only be run to apply them sooner or to see which are still awaited.
+
+With --list the queued tags are listed without being applied.`,
+	Examples: []string{"$ tmsu tag --queue /media/usb/film.mkv film\ntmsu: /media/usb/film.mkv: not available: tags queued until it is",
+		"$ tmsu flush\n/media/usb/film.mkv: film",
+		"$ tmsu flush --list"},
+	Options:  Options{Option{"--list", "-l", "list the queued tags without applying them", false, ""}},
+	Exec:     flushExec,
+	Modifies: true,
+}
+
+// unexported
+
+func flushExec(store *storage.Storage, options Options, args []string) error {
+	if len(args) > 0 {
+		return fmt.Errorf("too many arguments")
+	}
+
+	tx, err := store.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Commit()
+
+	if options.HasOption("--list") {
+		return listPendingTags(store, tx)
+	}
+
+	awaited, err := api.FlushPendingTags(store, tx, func(report api.FlushReport) {
+		fmt.Printf("%v: %v\n", report.Path, formatTagValues(report.Tags))
+	})
+	if err != nil {
+		return err
+	}
+
+	if awaited > 0 {
+		log.Infof(1, "%v files are not yet available", awaited)
+	}
+
+	return nil
+}
+
+// Applies the tags queued for files that are now available, as the first
+// command run once they are. The caller must hold the writer lock.
+func flushPendingTags(store *storage.Storage) error {
+	if store.DryRun {
+		return nil
+	}
+
+	tx, err := store.Begin()
+	if err != nil {
+		return err
+	}
+
+	_, err = api.FlushPendingTags(store, tx, func(report api.FlushReport) {
+		log.Warnf("%v: applied queued tags %v", report.Path, formatTagValues(report.Tags))
+	})
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func listPendingTags(store *storage.Storage, tx *storage.Tx) error {
+	pendingTags, err := store.PendingTags(tx)
+	if err != nil {
+		return fmt.Errorf("could not retrieve queued tags: %v", err)
+	}
+
+	path := ""
+	tagValues := make([]api.TagValue, 0, 10)
+	for index, pendingTag := range pendingTags {
+		tagValues = append(tagValues, api.TagValue{Tag: pendingTag.Tag, Value: pendingTag.Value})
+		path = pendingTag.Path
+
+		if index == len(pendingTags)-1 || pendingTags[index+1].Path != path {
+			fmt.Printf("%v: %v\n", path, formatTagValues(tagValues))
+			tagValues = tagValues[:0]
+		}
+	}
+
+	return nil
+}
+
+func formatTagValues(tagValues []api.TagValue) string {
+	texts := make([]string, len(tagValues))
+	for index, tagValue := range tagValues {
+		texts[index] = text.Escape(tagValue.String())
+	}
+
+	return strings.Join(texts, " ")
+}
@@ -0,0 +1,124 @@
+// Copyright 2011-2015 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package cli
+
+import (
+	"os"
+	"testing"
+	"tmsu/storage"
+)
+
+func TestFlush(test *testing.T) {
+	// set-up
+
+	databasePath := testDatabase()
+	defer os.Remove(databasePath)
+
+	err := redirectStreams()
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer restoreStreams()
+
+	store, err := storage.OpenAt(databasePath)
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer store.Close()
+
+	os.Remove("/tmp/tmsu/a")
+
+	parser := NewOptionParser(Options{}, []*Command{&TagCommand})
+	command, options, arguments, err := parser.Parse("tag", "--queue", "/tmp/tmsu/a", "apple", "banana")
+	if err != nil {
+		test.Fatal(err)
+	}
+	if err := command.Exec(store, options, arguments); err != nil {
+		test.Fatal(err)
+	}
+
+	tx, err := store.Begin()
+	if err != nil {
+		test.Fatal(err)
+	}
+	file, err := store.FileByPath(tx, "/tmp/tmsu/a")
+	if err != nil {
+		test.Fatal(err)
+	}
+	if file != nil {
+		test.Fatal("File should not have been added.")
+	}
+	count, err := store.PendingTagCount(tx)
+	if err != nil {
+		test.Fatal(err)
+	}
+	tx.Commit()
+
+	if count != 2 {
+		test.Fatalf("Expected 2 queued tags but were %v.", count)
+	}
+
+	// files not yet available are left queued
+	if err := FlushCommand.Exec(store, Options{}, []string{}); err != nil {
+		test.Fatal(err)
+	}
+
+	if err := createFile("/tmp/tmsu/a", "hello"); err != nil {
+		test.Fatal(err)
+	}
+	defer os.Remove("/tmp/tmsu/a")
+
+	// test
+
+	if err := FlushCommand.Exec(store, Options{}, []string{}); err != nil {
+		test.Fatal(err)
+	}
+
+	// validate
+
+	tx, err = store.Begin()
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer tx.Commit()
+
+	file, err = store.FileByPath(tx, "/tmp/tmsu/a")
+	if err != nil {
+		test.Fatal(err)
+	}
+	if file == nil {
+		test.Fatal("File was not added.")
+	}
+
+	apple, err := store.TagByName(tx, "apple")
+	if err != nil {
+		test.Fatal(err)
+	}
+	banana, err := store.TagByName(tx, "banana")
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	expectTags(test, store, tx, file, apple, banana)
+
+	count, err = store.PendingTagCount(tx)
+	if err != nil {
+		test.Fatal(err)
+	}
+	if count != 0 {
+		test.Fatalf("Expected no queued tags but were %v.", count)
+	}
+}
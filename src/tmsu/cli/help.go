@@ -37,6 +37,7 @@ var HelpCommand = Command{
 }
 
 var helpCommands []*Command
+var helpAliases []storage.Alias
 var colorizeRegexp = regexp.MustCompile(`'\S+'`)
 
 func helpExec(store *storage.Storage, options Options, args []string) error {
@@ -107,6 +108,26 @@ func summary(colour bool) {
 
 	fmt.Println()
 
+	if len(helpAliases) > 0 {
+		text = "Aliases:"
+		if colour {
+			text = ansi.Bold(text)
+		}
+		fmt.Println(text)
+		fmt.Println()
+
+		maxWidth = 0
+		for _, alias := range helpAliases {
+			maxWidth = int(math.Max(float64(maxWidth), float64(len(alias.Name))))
+		}
+
+		for _, alias := range helpAliases {
+			terminal.PrintWrapped(fmt.Sprintf("  %-*v   %v", maxWidth, alias.Name, alias.Expansion))
+		}
+
+		fmt.Println()
+	}
+
 	text = "Global options:"
 	if colour {
 		text = ansi.Bold(text)
@@ -116,6 +137,22 @@ func summary(colour bool) {
 
 	printOptions(globalOptions)
 
+	fmt.Println()
+
+	text = "Exit status:"
+	if colour {
+		text = ansi.Bold(text)
+	}
+	fmt.Println(text)
+	fmt.Println()
+
+	fmt.Printf("  %v  success\n", exitSuccess)
+	fmt.Printf("  %v  failure\n", exitFailure)
+	fmt.Printf("  %v  failure for some of the arguments\n", exitPartialFailure)
+	fmt.Printf("  %v  no such tag\n", exitNoSuchTag)
+	fmt.Printf("  %v  database could not be found or opened\n", exitNoDatabase)
+	fmt.Printf("  %v  nothing matched\n", exitNothingMatched)
+
 	fmt.Println()
 	terminal.PrintWrapped("Specify subcommand name for detailed help on a particular subcommand, e.g. tmsu help files")
 }
@@ -158,6 +195,11 @@ func findCommand(commands []*Command, commandName string) *Command {
 func describeCommand(commandName string, colour bool) {
 	command := findCommand(helpCommands, commandName)
 	if command == nil {
+		if alias := findAlias(helpAliases, commandName); alias != nil {
+			fmt.Printf("'%v' is an alias for '%v'.\n", alias.Name, alias.Expansion)
+			return
+		}
+
 		fmt.Printf("No such command '%v'.\n", commandName)
 		return
 	}
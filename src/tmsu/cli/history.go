@@ -0,0 +1,107 @@
+// Copyright 2011-2015 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package cli
+
+import (
+	"fmt"
+	"strings"
+	_path "tmsu/common/path"
+	"tmsu/common/terminal/ansi"
+	"tmsu/storage"
+)
+
+var HistoryCommand = Command{
+	Name:     "history",
+	Synopsis: "Show when tags were applied and removed",
+	Usages:   []string{"tmsu history [OPTION]... FILE..."},
+	Description: `Shows when each tag was applied to or removed from FILE, and by whom, oldest first.
+
+History is retained for files that are no longer in the database.`,
+	Examples: []string{"$ tmsu history song.mp3\n2015-06-01 20:14:02  bob  +music\n2015-06-01 20:14:02  bob  +mp3\n2015-06-03 09:41:57  sue  -mp3\n2015-06-03 09:41:57  sue  +flac"},
+	Options:  Options{},
+	Exec:     historyExec,
+}
+
+func historyExec(store *storage.Storage, options Options, args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("at least one file must be specified")
+	}
+
+	colour, err := useColour(options)
+	if err != nil {
+		return err
+	}
+
+	tx, err := store.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Commit()
+
+	for index, path := range args {
+		absPath, err := _path.Abs(path)
+		if err != nil {
+			return fmt.Errorf("%v: could not get absolute path: %v", path, err)
+		}
+
+		events, err := store.FileTagEvents(tx, absPath)
+		if err != nil {
+			return fmt.Errorf("%v: could not retrieve history: %v", path, err)
+		}
+
+		if len(args) > 1 {
+			if index > 0 {
+				fmt.Println()
+			}
+
+			fmt.Println(path + ":")
+		}
+
+		width := 0
+		for _, event := range events {
+			if event.Username == "" {
+				event.Username = "-"
+			}
+			if len(event.Username) > width {
+				width = len(event.Username)
+			}
+		}
+
+		for _, event := range events {
+			tagName := event.TagName
+			if event.ValueName != "" {
+				tagName += "=" + event.ValueName
+			}
+
+			var change string
+			switch {
+			case event.Tagged && colour:
+				change = ansi.Green("+" + tagName)
+			case event.Tagged:
+				change = "+" + tagName
+			case colour:
+				change = ansi.Red("-" + tagName)
+			default:
+				change = "-" + tagName
+			}
+
+			username := event.Username + strings.Repeat(" ", width-len(event.Username))
+			fmt.Printf("%v  %v  %v\n", event.Time.Local().Format("2006-01-02 15:04:05"), username, change)
+		}
+	}
+
+	return nil
+}
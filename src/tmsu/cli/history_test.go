@@ -0,0 +1,82 @@
+// Copyright 2011-2015 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package cli
+
+import (
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+	"tmsu/storage"
+)
+
+func TestHistory(test *testing.T) {
+	// set-up
+
+	databasePath := testDatabase()
+	defer os.Remove(databasePath)
+
+	err := redirectStreams()
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer restoreStreams()
+
+	store, err := storage.OpenAt(databasePath)
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer store.Close()
+	store.Username = "bob"
+
+	if err := createFile("/tmp/tmsu/a", "hello"); err != nil {
+		test.Fatal(err)
+	}
+	defer os.Remove("/tmp/tmsu/a")
+
+	if err := TagCommand.Exec(store, Options{}, []string{"/tmp/tmsu/a", "apple", "year=2015"}); err != nil {
+		test.Fatal(err)
+	}
+	if err := UntagCommand.Exec(store, Options{}, []string{"/tmp/tmsu/a", "apple", "year=2015"}); err != nil {
+		test.Fatal(err)
+	}
+
+	// test
+
+	if err := HistoryCommand.Exec(store, Options{}, []string{"/tmp/tmsu/a"}); err != nil {
+		test.Fatal(err)
+	}
+
+	// validate
+
+	outFile.Seek(0, 0)
+
+	bytes, err := ioutil.ReadAll(outFile)
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(string(bytes)), "\n")
+	expected := []string{"bob  +apple", "bob  +year=2015", "bob  -apple", "bob  -year=2015"}
+	if len(lines) != len(expected) {
+		test.Fatalf("Expected %v lines of history but were %v: %v", len(expected), len(lines), lines)
+	}
+	for index, line := range lines {
+		if !strings.HasSuffix(line, expected[index]) {
+			test.Fatalf("Expected line %v to end with '%v' but was '%v'.", index+1, expected[index], line)
+		}
+	}
+}
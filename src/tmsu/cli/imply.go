@@ -18,6 +18,7 @@ package cli
 import (
 	"fmt"
 	"tmsu/common/log"
+	"tmsu/common/text"
 	"tmsu/storage"
 )
 
@@ -36,8 +37,15 @@ The 'tags' subcommand can be used to identify which tags applied to a file are i
 	Examples: []string{`$ tmsu imply mp3 music`,
 		`$ tmsu imply\nmp3 => music`,
 		`$ tmsu imply --delete mp3 music`},
-	Options: Options{Option{"--delete", "-d", "deletes the tag implication", false, ""}},
-	Exec:    implyExec,
+	Options:    Options{Option{"--delete", "-d", "deletes the tag implication", false, ""}},
+	Exec:       implyExec,
+	ModifiesIf: implyModifies,
+}
+
+// Adding or deleting implications modifies the database: listing them does
+// not.
+func implyModifies(options Options, args []string) bool {
+	return options.HasOption("--delete") || len(args) > 1
 }
 
 func implyExec(store *storage.Storage, options Options, args []string) error {
@@ -77,7 +85,7 @@ func listImplications(store *storage.Storage, tx *storage.Tx) error {
 
 	width := 0
 	for _, implication := range implications {
-		length := len(implication.ImplyingTag.Name)
+		length := len(text.Escape(implication.ImplyingTag.Name))
 		if length > width {
 			width = length
 		}
@@ -93,9 +101,9 @@ func listImplications(store *storage.Storage, tx *storage.Tx) error {
 
 				previousImplyingTagName = implication.ImplyingTag.Name
 
-				fmt.Printf("%*v => %v", width, implication.ImplyingTag.Name, implication.ImpliedTag.Name)
+				fmt.Printf("%*v => %v", width, text.Escape(implication.ImplyingTag.Name), text.Escape(implication.ImpliedTag.Name))
 			} else {
-				fmt.Printf(" %v", implication.ImpliedTag.Name)
+				fmt.Printf(" %v", text.Escape(implication.ImpliedTag.Name))
 			}
 		}
 
@@ -126,7 +134,7 @@ func addImplications(store *storage.Storage, tx *storage.Tx, tagName string, imp
 				return err
 			}
 		} else {
-			return fmt.Errorf("no such tag '%v'", tagName)
+			return noSuchTagError(tagName)
 		}
 	}
 
@@ -144,7 +152,7 @@ func addImplications(store *storage.Storage, tx *storage.Tx, tagName string, imp
 					return err
 				}
 			} else {
-				return fmt.Errorf("no such tag '%v'", impliedTagName)
+				return noSuchTagError(impliedTagName)
 			}
 		}
 
@@ -166,7 +174,7 @@ func deleteImplications(store *storage.Storage, tx *storage.Tx, tagName string,
 		return fmt.Errorf("could not retrieve tag '%v': %v", tagName, err)
 	}
 	if tag == nil {
-		return fmt.Errorf("no such tag '%v'", tagName)
+		return noSuchTagError(tagName)
 	}
 
 	for _, impliedTagName := range impliedTagNames {
@@ -177,7 +185,7 @@ func deleteImplications(store *storage.Storage, tx *storage.Tx, tagName string,
 			return fmt.Errorf("could not retrieve tag '%v': %v", impliedTagName, err)
 		}
 		if impliedTag == nil {
-			return fmt.Errorf("no such tag '%v'", impliedTagName)
+			return noSuchTagError(impliedTagName)
 		}
 
 		log.Infof(2, "removing tag implication of '%v' to '%v'.", tagName, impliedTagName)
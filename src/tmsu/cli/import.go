@@ -0,0 +1,157 @@
+// Copyright 2011-2015 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package cli
+
+import (
+	"fmt"
+	"strings"
+	"tmsu/api"
+	"tmsu/storage"
+)
+
+var ImportCommand = Command{
+	Name:     "import",
+	Synopsis: "Import tags from other tagging applications",
+	Usages: []string{"tmsu import [OPTION]... --format=FORMAT PATH...",
+		"tmsu import [OPTION]... --csv=FILE"},
+	Description: `Imports the tags applied by another tagging application, or listed in a spreadsheet, adding the tagged files to the database and creating tags as necessary.
+
+FORMAT is one of:
+
+  tagspaces  the tags TagSpaces embeds in file names, as in 'beach[holiday 2015].jpg', and records in the sidecar files of its '.ts' metadata directories, for the files within each directory PATH
+  finder     the macOS Finder tags of the files within each directory PATH, read from the 'com.apple.metadata:_kMDItemUserTags' extended attribute. This is read from the user namespace on Linux, where tools such as 'rsync -X' copy it, and is not supported on other platforms
+  tabbles    the files and tags in each Tabbles XML export PATH
+
+With --csv the files and tags are read from FILE, a spreadsheet saved as CSV or, if its name ends '.tsv' or '.tab', with tab-separated fields. COLUMNS lists the meaning of each field of a row, separated by commas: 'path' is the file's path, relative to the directory of FILE unless absolute; 'tags' its tags (TAG or TAG=VALUE) separated by spaces; and '-' a field to ignore. Any other column is a tag applied with the field as its value, e.g. a 'rating' column of ratings from 0 to 5, unless the field is empty. Without --columns the first row of FILE names the columns, otherwise a first row with 'path' in the path column is skipped as a header. Each row that cannot be imported is reported with its row number and skipped.
+
+Spaces within tag and value names are replaced with underscores unless the allowSpacesInNames setting is enabled. Tags that are not valid TMSU tag names, and files that do not exist, are skipped with a warning. With --create-missing files that do not exist are instead tracked as virtual files (see 'tmsu tag --force'). The tags already applied to a file are kept.`,
+	Examples: []string{"$ tmsu import --format=tagspaces ~/documents",
+		"$ tmsu import --format=finder --pretend /mnt/mac/photos",
+		"$ tmsu import --format=tabbles tabbles-export.xml",
+		"$ tmsu import --csv=catalogue.csv --columns=path,tags,rating",
+		"$ tmsu import --csv=albums.tsv --columns=path,artist,-,year --create-missing"},
+	Options: Options{Option{"--format", "-f", "the format to import: tagspaces, finder or tabbles", true, ""},
+		Option{"--csv", "", "import the files and tags listed in the CSV file", true, ""},
+		Option{"--columns", "", "the columns of the CSV file, e.g. path,tags,rating", true, ""},
+		Option{"--create-missing", "", "track files that do not exist as virtual files", false, ""},
+		Option{"--pretend", "-P", "list the tags that would be applied without applying them", false, ""}},
+	Exec:     importExec,
+	Modifies: true,
+}
+
+// unexported
+
+func importExec(store *storage.Storage, options Options, args []string) error {
+	importOptions := api.ImportOptions{Pretend: options.HasOption("--pretend") || store.DryRun,
+		CreateMissing: options.HasOption("--create-missing"),
+		Report: func(path string, tags []string) {
+			fmt.Printf("%v: %v\n", path, strings.Join(escapeNames(tags), " "))
+		}}
+
+	if options.HasOption("--csv") {
+		if options.HasOption("--format") {
+			return fmt.Errorf("--csv and --format cannot be specified together")
+		}
+		if len(args) > 0 {
+			return fmt.Errorf("too many arguments")
+		}
+
+		return importCSV(store, options.Get("--csv").Argument, options, importOptions)
+	}
+
+	if options.HasOption("--columns") {
+		return fmt.Errorf("--columns can only be specified with --csv")
+	}
+	if !options.HasOption("--format") {
+		return fmt.Errorf("the format to import must be specified with --format, or a CSV file with --csv")
+	}
+	if len(args) == 0 {
+		return fmt.Errorf("too few arguments")
+	}
+
+	format := options.Get("--format").Argument
+	if !isImportFormat(format) {
+		return fmt.Errorf("invalid format '%v': must be one of %v", format, strings.Join(api.ImportFormats, ", "))
+	}
+
+	tx, err := store.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Commit()
+
+	wereErrors := false
+	for _, path := range args {
+		files, err := api.ReadImport(format, path)
+		if err != nil {
+			return fmt.Errorf("%v: could not read tags: %v", path, err)
+		}
+
+		skipped, err := api.ImportTags(store, tx, files, importOptions)
+		if err != nil {
+			return err
+		}
+		wereErrors = wereErrors || skipped
+	}
+
+	if wereErrors {
+		return errBlank
+	}
+
+	return nil
+}
+
+func importCSV(store *storage.Storage, path string, options Options, importOptions api.ImportOptions) error {
+	var columns []string
+	if options.HasOption("--columns") {
+		var err error
+		if columns, err = api.ParseColumns(options.Get("--columns").Argument); err != nil {
+			return err
+		}
+	}
+
+	files, skippedRows, err := api.ReadCSV(path, columns)
+	if err != nil {
+		return err
+	}
+
+	tx, err := store.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Commit()
+
+	skipped, err := api.ImportTags(store, tx, files, importOptions)
+	if err != nil {
+		return err
+	}
+
+	if skippedRows || skipped {
+		return errBlank
+	}
+
+	return nil
+}
+
+func isImportFormat(format string) bool {
+	for _, importFormat := range api.ImportFormats {
+		if importFormat == format {
+			return true
+		}
+	}
+
+	return false
+}
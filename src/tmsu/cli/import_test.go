@@ -0,0 +1,233 @@
+// Copyright 2011-2015 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package cli
+
+import (
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+	"testing"
+	"tmsu/storage"
+)
+
+func TestImportTagSpaces(test *testing.T) {
+	// set-up
+
+	databasePath := testDatabase()
+	defer os.Remove(databasePath)
+
+	store, err := storage.OpenAt(databasePath)
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer store.Close()
+
+	defer os.RemoveAll("/tmp/tmsu/import")
+
+	if err := createFile("/tmp/tmsu/import/beach[holiday summer].jpg", "beach"); err != nil {
+		test.Fatal(err)
+	}
+	if err := createFile("/tmp/tmsu/import/notes.txt", "notes"); err != nil {
+		test.Fatal(err)
+	}
+	if err := createFile("/tmp/tmsu/import/.ts/notes.txt.json", `{"tags": [{"title": "work", "type": "sidecar"}, {"title": "to do", "type": "sidecar"}]}`); err != nil {
+		test.Fatal(err)
+	}
+	if err := createFile("/tmp/tmsu/import/.ts/beach[holiday summer].jpg.jpg", "thumbnail"); err != nil {
+		test.Fatal(err)
+	}
+	if err := createFile("/tmp/tmsu/import/archive/.ts/tsm.json", `{"tags": [{"title": "old"}]}`); err != nil {
+		test.Fatal(err)
+	}
+
+	// test
+
+	options := Options{Option{"--format", "-f", "", true, "tagspaces"}}
+	if err := ImportCommand.Exec(store, options, []string{"/tmp/tmsu/import"}); err != nil {
+		test.Fatal(err)
+	}
+
+	// validate
+
+	expectImportedTags(test, store, "/tmp/tmsu/import/beach[holiday summer].jpg", "holiday", "summer")
+	expectImportedTags(test, store, "/tmp/tmsu/import/notes.txt", "to_do", "work")
+	expectImportedTags(test, store, "/tmp/tmsu/import/archive", "old")
+	expectImportedTags(test, store, "/tmp/tmsu/import/.ts/beach[holiday summer].jpg.jpg")
+}
+
+func TestImportTabbles(test *testing.T) {
+	// set-up
+
+	databasePath := testDatabase()
+	defer os.Remove(databasePath)
+
+	store, err := storage.OpenAt(databasePath)
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer store.Close()
+
+	defer os.RemoveAll("/tmp/tmsu/tabbles")
+
+	if err := createFile("/tmp/tmsu/tabbles/a", "a"); err != nil {
+		test.Fatal(err)
+	}
+	if err := createFile("/tmp/tmsu/tabbles/b", "b"); err != nil {
+		test.Fatal(err)
+	}
+
+	export := `<?xml version="1.0" encoding="utf-8"?>
+<tabbles>
+  <tabble name="projects">
+    <file path="/tmp/tmsu/tabbles/a"/>
+  </tabble>
+  <file path="/tmp/tmsu/tabbles/b">
+    <tag>invoices</tag>
+    <tag name="2015"/>
+  </file>
+  <file path="/tmp/tmsu/tabbles/missing">
+    <tag name="gone"/>
+  </file>
+</tabbles>`
+	if err := ioutil.WriteFile("/tmp/tmsu/tabbles/export.xml", []byte(export), 0644); err != nil {
+		test.Fatal(err)
+	}
+
+	// test
+
+	// the missing file is reported
+	options := Options{Option{"--format", "-f", "", true, "tabbles"}}
+	if err := ImportCommand.Exec(store, options, []string{"/tmp/tmsu/tabbles/export.xml"}); err != errBlank {
+		test.Fatalf("Expected the missing file to be reported but got: %v", err)
+	}
+
+	// validate
+
+	expectImportedTags(test, store, "/tmp/tmsu/tabbles/a", "projects")
+	expectImportedTags(test, store, "/tmp/tmsu/tabbles/b", "2015", "invoices")
+	expectImportedTags(test, store, "/tmp/tmsu/tabbles/missing")
+}
+
+func TestImportCSV(test *testing.T) {
+	// set-up
+
+	databasePath := testDatabase()
+	defer os.Remove(databasePath)
+
+	store, err := storage.OpenAt(databasePath)
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer store.Close()
+
+	defer os.RemoveAll("/tmp/tmsu/csv")
+
+	if err := createFile("/tmp/tmsu/csv/a.mp3", "a"); err != nil {
+		test.Fatal(err)
+	}
+	if err := createFile("/tmp/tmsu/csv/b.mp3", "b"); err != nil {
+		test.Fatal(err)
+	}
+
+	catalogue := `path,tags,rating,comment
+a.mp3,rock live,4,great
+/tmp/tmsu/csv/b.mp3,jazz,,
+c.mp3,pop,3,
+d.mp3,pop,9,
+e.mp3,pop
+`
+	if err := ioutil.WriteFile("/tmp/tmsu/csv/catalogue.csv", []byte(catalogue), 0644); err != nil {
+		test.Fatal(err)
+	}
+
+	// test
+
+	options := Options{Option{"--csv", "", "", true, "/tmp/tmsu/csv/catalogue.csv"},
+		Option{"--columns", "", "", true, "path,tags,rating,-"},
+		Option{"--create-missing", "", "", false, ""}}
+
+	// the invalid rating and short row are reported
+	if err := ImportCommand.Exec(store, options, []string{}); err != errBlank {
+		test.Fatalf("Expected the invalid rows to be reported but got: %v", err)
+	}
+
+	// validate
+
+	expectImportedTags(test, store, "/tmp/tmsu/csv/a.mp3", "live", "rating", "rock")
+	expectImportedTags(test, store, "/tmp/tmsu/csv/b.mp3", "jazz")
+	expectImportedTags(test, store, "/tmp/tmsu/csv/c.mp3", "pop", "rating")
+	expectImportedTags(test, store, "/tmp/tmsu/csv/d.mp3")
+	expectImportedTags(test, store, "/tmp/tmsu/csv/e.mp3")
+}
+
+func TestImportInvalidFormat(test *testing.T) {
+	databasePath := testDatabase()
+	defer os.Remove(databasePath)
+
+	store, err := storage.OpenAt(databasePath)
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer store.Close()
+
+	options := Options{Option{"--format", "-f", "", true, "delicious"}}
+	if err := ImportCommand.Exec(store, options, []string{"/tmp/tmsu"}); err == nil {
+		test.Fatalf("Expected an invalid format to be rejected.")
+	}
+}
+
+// unexported
+
+func expectImportedTags(test *testing.T, store *storage.Storage, path string, expected ...string) {
+	tx, err := store.Begin()
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer tx.Commit()
+
+	file, err := store.FileByPath(tx, path)
+	if err != nil {
+		test.Fatal(err)
+	}
+	if file == nil {
+		if len(expected) > 0 {
+			test.Fatalf("Expected '%v' to be imported.", path)
+		}
+
+		return
+	}
+
+	fileTags, err := store.FileTagsByFileId(tx, file.Id, false)
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	names := make([]string, 0, len(fileTags))
+	for _, fileTag := range fileTags {
+		tag, err := store.Tag(tx, fileTag.TagId)
+		if err != nil {
+			test.Fatal(err)
+		}
+
+		names = append(names, tag.Name)
+	}
+	sort.Strings(names)
+
+	if strings.Join(names, " ") != strings.Join(expected, " ") {
+		test.Fatalf("Expected '%v' to be tagged '%v' but was tagged '%v'.", path, strings.Join(expected, " "), strings.Join(names, " "))
+	}
+}
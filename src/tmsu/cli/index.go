@@ -0,0 +1,99 @@
+// Copyright 2011-2015 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package cli
+
+import (
+	"fmt"
+	"path/filepath"
+	"tmsu/api"
+	"tmsu/common/log"
+	"tmsu/entities"
+	"tmsu/storage"
+)
+
+var IndexCommand = Command{
+	Name:     "index",
+	Synopsis: "Index the content of files",
+	Usages:   []string{"tmsu index [FILE]..."},
+	Description: `Extracts the text of each FILE, or of every file in the database if none is specified, for searching with the content:TEXT query term. See 'tmsu help files'.
+
+The text is extracted by the indexer command configured by the 'contentIndexer' setting, which is also run for files as they are first tagged. The command is run once per file: it reads a JSON request from its standard input, such as {"path": "/home/bob/report.pdf", "extension": ".pdf"}, and writes a JSON response to its standard output, such as {"text": "Quarterly report..."}. An indexer that does not handle the file responds with empty text, whilst one that fails responds with {"error": "REASON"}.`,
+	Examples: []string{"$ tmsu config contentIndexer='tmsu-index-pdf --layout'",
+		"$ tmsu index report.pdf",
+		`$ tmsu files 'content:"quarterly report"'`},
+	Exec:     indexExec,
+	Modifies: true,
+}
+
+// unexported
+
+func indexExec(store *storage.Storage, options Options, args []string) error {
+	tx, err := store.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Commit()
+
+	settings, err := store.Settings(tx)
+	if err != nil {
+		return err
+	}
+
+	indexer := api.NewContentIndexer(settings)
+	if indexer == nil {
+		return fmt.Errorf("no content indexer is configured: see the 'contentIndexer' setting")
+	}
+
+	var files entities.Files
+	if len(args) == 0 {
+		files, err = store.Files(tx, "name")
+		if err != nil {
+			return fmt.Errorf("could not retrieve files: %v", err)
+		}
+	} else {
+		files = make(entities.Files, 0, len(args))
+		for _, path := range args {
+			absPath, err := filepath.Abs(path)
+			if err != nil {
+				return fmt.Errorf("%v: could not get absolute path: %v", path, err)
+			}
+
+			file, err := store.FileByPath(tx, absPath)
+			if err != nil {
+				return fmt.Errorf("%v: could not retrieve file: %v", path, err)
+			}
+			if file == nil {
+				return fmt.Errorf("%v: file is not in the database", path)
+			}
+
+			files = append(files, file)
+		}
+	}
+
+	wereErrors := false
+	for _, file := range files {
+		if err := api.IndexFileContent(store, tx, indexer, file); err != nil {
+			log.Warnf("%v", err)
+			wereErrors = true
+		}
+	}
+
+	if wereErrors {
+		return errBlank
+	}
+
+	return nil
+}
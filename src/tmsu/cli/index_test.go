@@ -0,0 +1,91 @@
+// Copyright 2011-2015 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+// +build !windows
+
+package cli
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+	"tmsu/storage"
+)
+
+func TestIndexContentAtTagTime(test *testing.T) {
+	// set-up
+
+	databasePath := testDatabase()
+	defer os.Remove(databasePath)
+
+	err := redirectStreams()
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer restoreStreams()
+
+	store, err := storage.OpenAt(databasePath)
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer store.Close()
+
+	indexerPath := "/tmp/tmsu/indexer.sh"
+	indexer := `#!/bin/sh
+if grep -q '"extension":".pdf"'; then
+    echo '{"text": "Quarterly report for 2023"}'
+else
+    echo '{"text": ""}'
+fi
+`
+	if err := ioutil.WriteFile(indexerPath, []byte(indexer), 0755); err != nil {
+		test.Fatal(err)
+	}
+	defer os.Remove(indexerPath)
+
+	if err := createFile("/tmp/tmsu/a.pdf", "a"); err != nil {
+		test.Fatal(err)
+	}
+	defer os.Remove("/tmp/tmsu/a.pdf")
+
+	if err := createFile("/tmp/tmsu/b.txt", "b"); err != nil {
+		test.Fatal(err)
+	}
+	defer os.Remove("/tmp/tmsu/b.txt")
+
+	if err := ConfigCommand.Exec(store, Options{}, []string{"contentIndexer=" + indexerPath}); err != nil {
+		test.Fatal(err)
+	}
+
+	// test
+
+	if err := TagCommand.Exec(store, Options{}, []string{"/tmp/tmsu/a.pdf", "report"}); err != nil {
+		test.Fatal(err)
+	}
+	if err := TagCommand.Exec(store, Options{}, []string{"/tmp/tmsu/b.txt", "report"}); err != nil {
+		test.Fatal(err)
+	}
+
+	if err := FilesCommand.Exec(store, Options{}, []string{`content:"quarterly report"`}); err != nil {
+		test.Fatal(err)
+	}
+
+	// validate
+
+	outFile.Seek(0, 0)
+
+	bytes, err := ioutil.ReadAll(outFile)
+	compareOutput(test, "/tmp/tmsu/a.pdf\n", string(bytes))
+}
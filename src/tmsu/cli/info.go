@@ -20,6 +20,9 @@ import (
 	"math"
 	"os"
 	"strconv"
+	"strings"
+	"time"
+	"tmsu/api"
 	"tmsu/common/terminal/ansi"
 	"tmsu/storage"
 )
@@ -28,12 +31,11 @@ var InfoCommand = Command{
 	Name:        "info",
 	Synopsis:    "Show database information",
 	Usages:      []string{"tmsu info"},
-	Description: "Shows the database information.",
+	Description: "Shows the database information, including the schedules of the maintenance jobs and the times and results of their last runs (see 'tmsu help maintain').",
 	Options: Options{
 		Option{"--stats", "-s", "show statistics", false, ""},
 		Option{"--usage", "-u", "show tag usage breakdown", false, ""}},
-	Exec:    infoExec,
-	Aliases: []string{"stats"},
+	Exec: infoExec,
 }
 
 func infoExec(store *storage.Storage, options Options, args []string) error {
@@ -51,6 +53,7 @@ func infoExec(store *storage.Storage, options Options, args []string) error {
 	defer tx.Commit()
 
 	showBasic(store, tx, colour)
+	showMaintenance(store, tx, colour)
 
 	if stats {
 		showStatistics(store, tx, colour)
@@ -76,6 +79,38 @@ func showBasic(store *storage.Storage, tx *storage.Tx, colour bool) error {
 	return nil
 }
 
+func showMaintenance(store *storage.Storage, tx *storage.Tx, colour bool) error {
+	settings, err := store.Settings(tx)
+	if err != nil {
+		return err
+	}
+
+	jobs, err := store.MaintenanceJobs(tx)
+	if err != nil {
+		return fmt.Errorf("could not retrieve maintenance jobs: %v", err)
+	}
+
+	fmt.Println()
+	for _, name := range api.MaintenanceJobNames {
+		schedule := api.MaintenanceSchedule(settings, name)
+		job := jobs.Find(name)
+
+		status := schedule
+		if job == nil {
+			status += ", not yet run"
+		} else {
+			status += fmt.Sprintf(", last run %v: %v", job.LastRun.Local().Format("2006-01-02 15:04:05"), job.Result)
+		}
+		if next, scheduled := api.NextMaintenance(schedule, job); scheduled && !time.Now().Before(next) {
+			status += " (due)"
+		}
+
+		printInfo(strings.Title(name), status, colour)
+	}
+
+	return nil
+}
+
 func showStatistics(store *storage.Storage, tx *storage.Tx, colour bool) error {
 	tagCount, err := store.TagCount(tx)
 	if err != nil {
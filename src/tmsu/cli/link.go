@@ -0,0 +1,99 @@
+// Copyright 2011-2015 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package cli
+
+import (
+	"fmt"
+	"strings"
+	"tmsu/api"
+	"tmsu/common/log"
+	"tmsu/storage"
+)
+
+var LinkCommand = Command{
+	Name:     "link",
+	Synopsis: "Create a directory of links to the files matching a query",
+	Usages:   []string{"tmsu link [OPTION]... QUERY DESTDIR"},
+	Description: `Creates a symbolic link in DESTDIR to each file matching QUERY, for programs and devices that cannot use the virtual filesystem.
+
+The links are named as in the virtual filesystem, with the file's identifier added before the extension to keep the names unique. DESTDIR is created if it does not exist and must otherwise be empty unless --update is specified.
+
+With --update an existing directory of links is brought up to date: links to files no longer matching the query are removed and links to newly matching files are added. Entries in DESTDIR that are not links of the kind being created are left alone.
+
+Where symbolic links are a problem, such as on Samba shares or with some media players, --hardlink creates hard links instead. Hard links require DESTDIR to be on the same filesystem as the files. On filesystems supporting them, such as Btrfs and XFS, --reflink creates copy-on-write clones of the files, which do not change when the original files do.
+
+See 'tmsu help files' for the query syntax.`,
+	Examples: []string{"$ tmsu link music and not rock ~/player/playlist",
+		"$ tmsu link --update music and not rock ~/player/playlist",
+		"$ tmsu link --hardlink music /srv/share/music"},
+	Options: Options{Option{"--update", "-u", "update an existing directory of links", false, ""},
+		Option{"--hardlink", "-H", "create hard links rather than symbolic links", false, ""},
+		Option{"--reflink", "", "create copy-on-write clones rather than symbolic links", false, ""}},
+	Exec: linkExec,
+}
+
+// unexported
+
+func linkExec(store *storage.Storage, options Options, args []string) error {
+	if len(args) < 2 {
+		return fmt.Errorf("too few arguments")
+	}
+
+	update := options.HasOption("--update")
+
+	kind := api.SymbolicLink
+	switch {
+	case options.HasOption("--hardlink") && options.HasOption("--reflink"):
+		return fmt.Errorf("--hardlink and --reflink cannot be specified together")
+	case options.HasOption("--hardlink"):
+		kind = api.HardLink
+	case options.HasOption("--reflink"):
+		kind = api.RefLink
+	}
+
+	queryText := strings.Join(args[:len(args)-1], " ")
+	destPath := args[len(args)-1]
+
+	tx, err := store.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Commit()
+
+	files, err := api.QueryFiles(store, tx, queryText, api.QueryOptions{Sort: "name"})
+	if err != nil {
+		if noSuchTags, ok := err.(api.NoSuchTagsError); ok {
+			for _, tagName := range noSuchTags.Names {
+				log.Warnf("no such tag '%v'.", tagName)
+			}
+
+			return errNoSuchTag
+		}
+
+		return err
+	}
+
+	report := func(linkReport api.LinkReport) {
+		switch linkReport.Action {
+		case api.LinkCreated:
+			log.Infof(2, "%v: linked to '%v'", linkReport.Path, linkReport.Target)
+		case api.LinkRemoved:
+			log.Infof(2, "%v: removed stale link", linkReport.Path)
+		}
+	}
+
+	return api.LinkFiles(files, destPath, api.LinkOptions{Kind: kind, Update: update, Report: report})
+}
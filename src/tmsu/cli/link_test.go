@@ -0,0 +1,150 @@
+// Copyright 2011-2015 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package cli
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"tmsu/storage"
+)
+
+func TestLinkUpdate(test *testing.T) {
+	// set-up
+
+	databasePath := testDatabase()
+	defer os.Remove(databasePath)
+
+	err := redirectStreams()
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer restoreStreams()
+
+	store, err := storage.OpenAt(databasePath)
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer store.Close()
+
+	if err := createFile("/tmp/tmsu/a.mp3", "a"); err != nil {
+		test.Fatal(err)
+	}
+	defer os.Remove("/tmp/tmsu/a.mp3")
+
+	if err := createFile("/tmp/tmsu/b.mp3", "b"); err != nil {
+		test.Fatal(err)
+	}
+	defer os.Remove("/tmp/tmsu/b.mp3")
+
+	destPath := "/tmp/tmsu/links"
+	defer os.RemoveAll(destPath)
+
+	if err := TagCommand.Exec(store, Options{}, []string{"/tmp/tmsu/a.mp3", "music"}); err != nil {
+		test.Fatal(err)
+	}
+	if err := TagCommand.Exec(store, Options{}, []string{"/tmp/tmsu/b.mp3", "music", "rock"}); err != nil {
+		test.Fatal(err)
+	}
+
+	// test
+
+	if err := LinkCommand.Exec(store, Options{}, []string{"music", destPath}); err != nil {
+		test.Fatal(err)
+	}
+	if err := LinkCommand.Exec(store, Options{}, []string{"music", destPath}); err == nil {
+		test.Fatal("expected error linking into non-empty directory")
+	}
+
+	if err := UntagCommand.Exec(store, Options{}, []string{"/tmp/tmsu/b.mp3", "music"}); err != nil {
+		test.Fatal(err)
+	}
+	if err := LinkCommand.Exec(store, Options{Option{"--update", "-u", "", false, ""}}, []string{"music", destPath}); err != nil {
+		test.Fatal(err)
+	}
+
+	// validate
+
+	names, err := filepath.Glob(filepath.Join(destPath, "*"))
+	if err != nil {
+		test.Fatal(err)
+	}
+	if len(names) != 1 || names[0] != filepath.Join(destPath, "a.1.mp3") {
+		test.Fatalf("expected only link 'a.1.mp3' but found %v", names)
+	}
+
+	target, err := os.Readlink(names[0])
+	if err != nil {
+		test.Fatal(err)
+	}
+	if target != "/tmp/tmsu/a.mp3" {
+		test.Fatalf("expected link to '/tmp/tmsu/a.mp3' but was to '%v'", target)
+	}
+}
+
+func TestLinkHardlink(test *testing.T) {
+	// set-up
+
+	databasePath := testDatabase()
+	defer os.Remove(databasePath)
+
+	err := redirectStreams()
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer restoreStreams()
+
+	store, err := storage.OpenAt(databasePath)
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer store.Close()
+
+	if err := createFile("/tmp/tmsu/a.mp3", "a"); err != nil {
+		test.Fatal(err)
+	}
+	defer os.Remove("/tmp/tmsu/a.mp3")
+
+	destPath := "/tmp/tmsu/links"
+	defer os.RemoveAll(destPath)
+
+	if err := TagCommand.Exec(store, Options{}, []string{"/tmp/tmsu/a.mp3", "music"}); err != nil {
+		test.Fatal(err)
+	}
+
+	// test
+
+	if err := LinkCommand.Exec(store, Options{Option{"--hardlink", "-H", "", false, ""}}, []string{"music", destPath}); err != nil {
+		test.Fatal(err)
+	}
+	if err := LinkCommand.Exec(store, Options{Option{"--hardlink", "-H", "", false, ""}, Option{"--update", "-u", "", false, ""}}, []string{"music", destPath}); err != nil {
+		test.Fatal(err)
+	}
+
+	// validate
+
+	linkStat, err := os.Lstat(filepath.Join(destPath, "a.1.mp3"))
+	if err != nil {
+		test.Fatal(err)
+	}
+	fileStat, err := os.Stat("/tmp/tmsu/a.mp3")
+	if err != nil {
+		test.Fatal(err)
+	}
+	if !os.SameFile(linkStat, fileStat) {
+		test.Fatal("expected a hard link to '/tmp/tmsu/a.mp3'")
+	}
+}
@@ -0,0 +1,191 @@
+// Copyright 2011-2015 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package cli
+
+import (
+	"fmt"
+	"strings"
+	"time"
+	"tmsu/api"
+	"tmsu/common/log"
+	"tmsu/storage"
+)
+
+var MaintainCommand = Command{
+	Name:     "maintain",
+	Synopsis: "Run the scheduled maintenance jobs",
+	Usages:   []string{"tmsu maintain [JOB]..."},
+	Description: `Runs each maintenance job that is due according to its schedule or, if JOBs are specified, runs those jobs regardless of their schedules. This is intended to be run periodically, e.g. hourly by cron, so that the jobs run as scheduled.
+
+The jobs are:
+
+  verify  Recalculates the fingerprints of the next 'verifyFiles' files (100 by default), continuing from where the previous run left off, so that over successive runs every file is verified. Files whose contents no longer match their fingerprints, although their modification times and sizes are unchanged, are reported as corrupt. Modified and missing files are reported but are left for 'tmsu repair'. Scheduled by the 'verifySchedule' setting: daily by default.
+  prune   Removes missing files from the database, as 'tmsu repair --remove' does. Virtual files and files on volumes that are not mounted are kept. Scheduled by the 'pruneSchedule' setting: never by default.
+  vacuum  Rebuilds the database file to reclaim the space left by deleted data. Scheduled by the 'vacuumSchedule' setting: weekly by default.
+
+Each schedule is one of 'never', 'daily', 'weekly' or 'monthly'. The time and result of each job's last run are shown by 'tmsu info'.
+
+The exit code indicates whether verify found corrupt files.`,
+	Examples: []string{"$ tmsu maintain\nverify: verified 100 files: 2 modified, 0 missing, 0 corrupt",
+		"$ tmsu config pruneSchedule=monthly",
+		"$ tmsu maintain vacuum"},
+	Exec:     maintainExec,
+	Modifies: true,
+}
+
+// unexported
+
+func maintainExec(store *storage.Storage, options Options, args []string) error {
+	for _, arg := range args {
+		if !api.IsMaintenanceJob(arg) {
+			return fmt.Errorf("no such maintenance job '%v': must be one of %v", arg, strings.Join(api.MaintenanceJobNames, ", "))
+		}
+	}
+
+	now := time.Now()
+
+	due, err := dueMaintenanceJobs(store, args, now)
+	if err != nil {
+		return err
+	}
+
+	wereProblems := false
+	for _, name := range due {
+		result, problems, err := runMaintenanceJob(store, name)
+		if err != nil {
+			result = "failed: " + err.Error()
+		}
+
+		if err := recordMaintenanceJob(store, name, now, result); err != nil {
+			return fmt.Errorf("could not record maintenance job '%v': %v", name, err)
+		}
+
+		if err != nil {
+			return fmt.Errorf("%v: %v", name, err)
+		}
+
+		fmt.Printf("%v: %v\n", name, result)
+		wereProblems = wereProblems || problems
+	}
+
+	if wereProblems {
+		return errBlank
+	}
+
+	return nil
+}
+
+// The named jobs or, if none are named, those due by the time specified.
+func dueMaintenanceJobs(store *storage.Storage, names []string, now time.Time) ([]string, error) {
+	if len(names) > 0 {
+		return names, nil
+	}
+
+	tx, err := store.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Commit()
+
+	settings, err := store.Settings(tx)
+	if err != nil {
+		return nil, err
+	}
+
+	jobs, err := store.MaintenanceJobs(tx)
+	if err != nil {
+		return nil, fmt.Errorf("could not retrieve maintenance jobs: %v", err)
+	}
+
+	due := make([]string, 0, len(api.MaintenanceJobNames))
+	for _, name := range api.MaintenanceJobNames {
+		next, scheduled := api.NextMaintenance(api.MaintenanceSchedule(settings, name), jobs.Find(name))
+		switch {
+		case !scheduled:
+			log.Infof(2, "%v: not scheduled", name)
+		case now.Before(next):
+			log.Infof(2, "%v: not due until %v", name, next.Format("2006-01-02 15:04:05"))
+		default:
+			due = append(due, name)
+		}
+	}
+
+	return due, nil
+}
+
+// Runs the named job, returning its result and whether it found problems.
+func runMaintenanceJob(store *storage.Storage, name string) (string, bool, error) {
+	if name == "vacuum" {
+		if err := store.Vacuum(); err != nil {
+			return "", false, err
+		}
+
+		return "vacuumed the database", false, nil
+	}
+
+	tx, err := store.Begin()
+	if err != nil {
+		return "", false, err
+	}
+
+	var result string
+	problems := false
+
+	switch name {
+	case "verify":
+		settings, err := store.Settings(tx)
+		if err != nil {
+			tx.Rollback()
+			return "", false, err
+		}
+
+		result, err = api.VerifyFiles(store, tx, settings.VerifyFiles(), func(path, problem string) {
+			fmt.Printf("%v: %v\n", path, problem)
+			if problem == "corrupt" {
+				problems = true
+			}
+		})
+	case "prune":
+		result, err = api.PruneMissingFiles(store, tx, func(path string) {
+			fmt.Printf("%v: removed\n", path)
+		})
+	}
+
+	if err != nil {
+		tx.Rollback()
+		return "", false, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return "", false, err
+	}
+
+	return result, problems, nil
+}
+
+func recordMaintenanceJob(store *storage.Storage, name string, lastRun time.Time, result string) error {
+	tx, err := store.Begin()
+	if err != nil {
+		return err
+	}
+
+	if err := store.UpdateMaintenanceJob(tx, name, lastRun, result); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
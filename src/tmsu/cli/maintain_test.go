@@ -0,0 +1,132 @@
+// Copyright 2011-2015 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package cli
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+	"tmsu/storage"
+)
+
+func TestMaintain(test *testing.T) {
+	// set-up
+
+	databasePath := testDatabase()
+	defer os.Remove(databasePath)
+
+	err := redirectStreams()
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer restoreStreams()
+
+	store, err := storage.OpenAt(databasePath)
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer store.Close()
+
+	for _, path := range []string{"/tmp/tmsu/a", "/tmp/tmsu/b", "/tmp/tmsu/c"} {
+		if err := createFile(path, "hello"); err != nil {
+			test.Fatal(err)
+		}
+		defer os.Remove(path)
+
+		if err := TagCommand.Exec(store, Options{}, []string{path, "tag"}); err != nil {
+			test.Fatal(err)
+		}
+	}
+
+	if err := ConfigCommand.Exec(store, Options{}, []string{"verifyFiles=2"}); err != nil {
+		test.Fatal(err)
+	}
+
+	// corrupt the file's contents without changing its size or modification time
+	stat, err := os.Stat("/tmp/tmsu/b")
+	if err != nil {
+		test.Fatal(err)
+	}
+	if err := createFile("/tmp/tmsu/b", "world"); err != nil {
+		test.Fatal(err)
+	}
+	if err := os.Chtimes("/tmp/tmsu/b", stat.ModTime(), stat.ModTime()); err != nil {
+		test.Fatal(err)
+	}
+
+	// test
+
+	if err := MaintainCommand.Exec(store, Options{}, []string{}); err != errBlank {
+		test.Fatalf("Expected corrupt file to be reported but got: %v", err)
+	}
+
+	// nothing is due
+	if err := MaintainCommand.Exec(store, Options{}, []string{}); err != nil {
+		test.Fatal(err)
+	}
+
+	// continues with the remaining file, then the first
+	if err := MaintainCommand.Exec(store, Options{}, []string{"verify"}); err != nil {
+		test.Fatal(err)
+	}
+
+	if err := os.Remove("/tmp/tmsu/c"); err != nil {
+		test.Fatal(err)
+	}
+
+	if err := MaintainCommand.Exec(store, Options{}, []string{"prune"}); err != nil {
+		test.Fatal(err)
+	}
+
+	if err := MaintainCommand.Exec(store, Options{}, []string{"defrag"}); err == nil {
+		test.Fatal("Expected unknown job to be rejected.")
+	}
+
+	// validate
+
+	outFile.Seek(0, 0)
+
+	bytes, err := ioutil.ReadAll(outFile)
+	compareOutput(test, `/tmp/tmsu/b: corrupt
+verify: verified 2 files: 0 modified, 0 missing, 1 corrupt
+vacuum: vacuumed the database
+verify: verified 2 files: 0 modified, 0 missing, 0 corrupt
+/tmp/tmsu/c: removed
+prune: removed 1 missing files
+`, string(bytes))
+
+	tx, err := store.Begin()
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer tx.Commit()
+
+	file, err := store.FileByPath(tx, "/tmp/tmsu/c")
+	if err != nil {
+		test.Fatal(err)
+	}
+	if file != nil {
+		test.Fatal("Missing file was not pruned.")
+	}
+
+	jobs, err := store.MaintenanceJobs(tx)
+	if err != nil {
+		test.Fatal(err)
+	}
+	if len(jobs) != 3 {
+		test.Fatalf("Expected 3 maintenance jobs to be recorded but there are %v.", len(jobs))
+	}
+}
@@ -28,8 +28,9 @@ var MergeCommand = Command{
 	Description: `Merges TAGs into tag DEST resulting in a single tag of name DEST.`,
 	Examples: []string{`$ tmsu merge cehese cheese`,
 		`$ tmsu merge outdoors outdoor outside`},
-	Options: Options{},
-	Exec:    mergeExec,
+	Options:  Options{},
+	Exec:     mergeExec,
+	Modifies: true,
 }
 
 func mergeExec(store *storage.Storage, options Options, args []string) error {
@@ -49,10 +50,11 @@ func mergeExec(store *storage.Storage, options Options, args []string) error {
 		return fmt.Errorf("could not retrieve tag '%v': %v", destTagName, err)
 	}
 	if destTag == nil {
-		return fmt.Errorf("no such tag '%v'", destTagName)
+		return noSuchTagError(destTagName)
 	}
 
 	wereErrors := false
+	noSuchTags := false
 	for _, sourceTagName := range args[0 : len(args)-1] {
 		if sourceTagName == destTagName {
 			log.Warnf("cannot merge tag '%v' into itself.", sourceTagName)
@@ -66,7 +68,7 @@ func mergeExec(store *storage.Storage, options Options, args []string) error {
 		}
 		if sourceTag == nil {
 			log.Warnf("no such tag '%v'.", sourceTagName)
-			wereErrors = true
+			noSuchTags = true
 			continue
 		}
 
@@ -94,8 +96,11 @@ func mergeExec(store *storage.Storage, options Options, args []string) error {
 		}
 	}
 
-	if wereErrors {
+	switch {
+	case wereErrors:
 		return errBlank
+	case noSuchTags:
+		return errNoSuchTag
 	}
 
 	return nil
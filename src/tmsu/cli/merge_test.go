@@ -290,8 +290,12 @@ func TestMergeNonExistentSourceTag(test *testing.T) {
 
 	// test
 
-	if err := MergeCommand.Exec(store, Options{}, []string{"a", "b"}); err == nil {
-		test.Fatal("Expected non-existent source tag to be identified.")
+	err = MergeCommand.Exec(store, Options{}, []string{"a", "b"})
+
+	// validate
+
+	if exitStatus(err) != exitNoSuchTag {
+		test.Fatalf("Expected exit status %v but was %v.", exitNoSuchTag, exitStatus(err))
 	}
 }
 
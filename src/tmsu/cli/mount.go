@@ -22,6 +22,7 @@ import (
 	"os"
 	"os/exec"
 	"path/filepath"
+	"strings"
 	"syscall"
 	"time"
 	"tmsu/common/log"
@@ -42,11 +43,18 @@ If FILE is not specified but the TMSU_DB environment variable is defined then th
 
 Where neither FILE is specified nor TMSU_DB defined then the default database is mounted.
 
+The hidden '.thumbnails' directory holds a link to a thumbnail of each tagged image and video, named after the file's entry in the tag directories with '.png' appended. Thumbnails are created when first read and cached in the 'thumbs' directory alongside the database. (Video thumbnails require 'ffmpeg'.)
+
+With --foreground the virtual filesystem is hosted by this process rather than a background one, so that it can be run as a service. Combined with --idle-timeout it unmounts itself and exits once it has not been accessed for that long, and readiness is signalled via sd_notify, making it suitable for a systemd automount unit: the virtual filesystem is mounted only when accessed. For example, a service with Type=notify and 'ExecStart=/usr/bin/tmsu mount --foreground --idle-timeout 5m /home/bob/tags' can be started on demand by a socket or path unit.
+
 To allow other users access to the mounted filesystem, pass the 'allow_other' FUSE option, e.g. 'tmsu mount --option=allow_other mp'. (FUSE only allows the root user to use this option unless 'user_allow_other' is present in '/etc/fuse.conf'.)`,
 	Examples: []string{"$ tmsu mount mp",
 		"$ tmsu mount /tmp/db mp",
-		"$ tmsu mount --options=allow_other mp"},
-	Options: Options{Option{"--options", "-o", "mount options (passed to fusermount)", true, ""}},
+		"$ tmsu mount --options=allow_other mp",
+		"$ tmsu mount --foreground --idle-timeout 5m mp"},
+	Options: Options{Option{"--options", "-o", "mount options (passed to fusermount)", true, ""},
+		Option{"--foreground", "-f", "host the virtual filesystem in this process", false, ""},
+		Option{"--idle-timeout", "-i", "unmount after this long without access, e.g. 5m", true, ""}},
 	Exec:    mountExec,
 }
 
@@ -56,11 +64,10 @@ func mountExec(store *storage.Storage, options Options, args []string) error {
 		mountOptions = options.Get("--options").Argument
 	}
 
-	tx, err := store.Begin()
+	idleTimeout, err := idleTimeoutOption(options)
 	if err != nil {
 		return err
 	}
-	defer tx.Commit()
 
 	switch len(args) {
 	case 0:
@@ -71,7 +78,11 @@ func mountExec(store *storage.Storage, options Options, args []string) error {
 	case 1:
 		mountPath := args[0]
 
-		err := mountExplicit(store.DbPath, mountPath, mountOptions)
+		if options.HasOption("--foreground") {
+			return mountForeground(store, mountPath, mountOptions, idleTimeout)
+		}
+
+		err := mountExplicit(store.DbPath, mountPath, mountOptions, idleTimeout)
 		if err != nil {
 			return err
 		}
@@ -79,7 +90,17 @@ func mountExec(store *storage.Storage, options Options, args []string) error {
 		databasePath := args[0]
 		mountPath := args[1]
 
-		err := mountExplicit(databasePath, mountPath, mountOptions)
+		if options.HasOption("--foreground") {
+			databaseStore, err := storage.OpenAt(databasePath)
+			if err != nil {
+				return err
+			}
+			defer databaseStore.Close()
+
+			return mountForeground(databaseStore, mountPath, mountOptions, idleTimeout)
+		}
+
+		err := mountExplicit(databasePath, mountPath, mountOptions, idleTimeout)
 		if err != nil {
 			return err
 		}
@@ -110,13 +131,31 @@ func listMounts() error {
 	}
 
 	for _, mount := range mt {
-		fmt.Printf("%-*v\tat\t%v\n", dbPathWidth, mount.DatabasePath, mount.MountPath)
+		state := ""
+		if mount.Stale {
+			state = "\t(stale)"
+		}
+
+		fmt.Printf("%-*v\tat\t%v%v\n", dbPathWidth, mount.DatabasePath, mount.MountPath, state)
 	}
 
 	return nil
 }
 
-func mountExplicit(databasePath string, mountPath string, mountOptions string) error {
+func mountForeground(store *storage.Storage, mountPath string, mountOptions string, idleTimeout time.Duration) error {
+	if alreadyMounted(mountPath) {
+		return fmt.Errorf("%v: mount path already in use", mountPath)
+	}
+
+	options := []string{}
+	if mountOptions != "" {
+		options = strings.Split(mountOptions, ",")
+	}
+
+	return hostVfs(store, mountPath, options, idleTimeout)
+}
+
+func mountExplicit(databasePath string, mountPath string, mountOptions string, idleTimeout time.Duration) error {
 	if alreadyMounted(mountPath) {
 		return fmt.Errorf("%v: mount path already in use", mountPath)
 	}
@@ -143,6 +182,9 @@ func mountExplicit(databasePath string, mountPath string, mountOptions string) e
 	log.Infof(2, "spawning daemon to mount VFS for database '%v' at '%v'", databasePath, mountPath)
 
 	args := []string{"vfs", "--database=" + databasePath, mountPath, "--options=" + mountOptions}
+	if idleTimeout > 0 {
+		args = append(args, "--idle-timeout="+idleTimeout.String())
+	}
 	daemon := exec.Command(os.Args[0], args...)
 
 	errorPipe, err := daemon.StderrPipe()
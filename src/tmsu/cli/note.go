@@ -0,0 +1,82 @@
+// Copyright 2011-2015 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package cli
+
+import (
+	"fmt"
+	"strings"
+	"tmsu/api"
+	"tmsu/storage"
+)
+
+var NoteCommand = Command{
+	Name:     "note",
+	Synopsis: "View or attach a note to a file",
+	Usages: []string{"tmsu note FILE",
+		"tmsu note FILE TEXT...",
+		"tmsu note --delete FILE"},
+	Description: `Shows the note attached to FILE or, if TEXT is specified, attaches it to FILE replacing any note it already has. Files with notes are added to the database even if they have no tags.
+
+Notes are searched by the full-text query term note:TEXT, which must be quoted within the query if TEXT contains spaces. See 'tmsu help files'.`,
+	Examples: []string{`$ tmsu note invoice.pdf "Invoice 2023 for the roof repair"`,
+		"$ tmsu note invoice.pdf\nInvoice 2023 for the roof repair",
+		`$ tmsu files 'note:"invoice 2023"'`,
+		"$ tmsu note --delete invoice.pdf"},
+	Options:    Options{Option{"--delete", "-d", "remove the note from the file", false, ""}},
+	Exec:       noteExec,
+	ModifiesIf: noteModifies,
+}
+
+// unexported
+
+// Attaching or deleting a note modifies the database: showing it does not.
+func noteModifies(options Options, args []string) bool {
+	return options.HasOption("--delete") || len(args) > 1
+}
+
+func noteExec(store *storage.Storage, options Options, args []string) error {
+	if len(args) < 1 {
+		return fmt.Errorf("too few arguments")
+	}
+
+	path := args[0]
+	text := strings.Join(args[1:], " ")
+
+	if options.HasOption("--delete") && text != "" {
+		return fmt.Errorf("a note cannot be specified with --delete")
+	}
+
+	tx, err := store.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Commit()
+
+	if text == "" && !options.HasOption("--delete") {
+		note, err := api.FileNote(store, tx, path)
+		if err != nil {
+			return err
+		}
+
+		if note != "" {
+			fmt.Println(note)
+		}
+
+		return nil
+	}
+
+	return api.SetFileNote(store, tx, path, text)
+}
@@ -0,0 +1,118 @@
+// Copyright 2011-2015 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package cli
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+	"tmsu/api"
+	"tmsu/common/log"
+	"tmsu/storage"
+)
+
+var OpenCommand = Command{
+	Name:     "open",
+	Synopsis: "Open the files matching a query",
+	Usages:   []string{"tmsu open [OPTION]... QUERY"},
+	Description: `Opens the files matching QUERY, which are otherwise listed by 'tmsu files', with the desktop's default application (xdg-open).
+
+The 'openers' setting may instead configure the command used for files of particular MIME types, e.g. 'image/*=feh; video/*=mpv' (see 'tmsu help config'), and --with overrides the command for all of the files. Such a command is run once with the matching files as its final arguments and with the terminal attached, so that a player can be given a playlist and console programs can be used.
+
+As opening many files at once is seldom intended, confirmation is requested when more than ten files match unless --yes is specified.
+
+See 'tmsu help files' for the query syntax.`,
+	Examples: []string{"$ tmsu open holiday and 2015",
+		"$ tmsu open --with mpv genre=jazz",
+		"$ tmsu open --yes photo and good"},
+	Options: Options{Option{"--with", "-w", "open the files with the command CMD", true, ""},
+		Option{"--yes", "-y", "open the files without asking for confirmation", false, ""},
+		Option{"--explicit", "-e", "open only explicitly tagged files", false, ""}},
+	Exec: openExec,
+}
+
+// unexported
+
+// The number of files above which confirmation is requested.
+const openConfirmationThreshold = 10
+
+func openExec(store *storage.Storage, options Options, args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("query must be specified")
+	}
+
+	command := ""
+	if options.HasOption("--with") {
+		command = options.Get("--with").Argument
+	}
+
+	tx, err := store.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Commit()
+
+	queryText := strings.Join(args, " ")
+	files, err := api.QueryFiles(store, tx, queryText, api.QueryOptions{ExplicitOnly: options.HasOption("--explicit"), Sort: "name"})
+	if err != nil {
+		if noSuchTags, ok := err.(api.NoSuchTagsError); ok {
+			for _, tagName := range noSuchTags.Names {
+				log.Warnf("no such tag '%v'.", tagName)
+			}
+
+			return errNoSuchTag
+		}
+
+		return err
+	}
+
+	if len(files) == 0 {
+		return errNothingMatched
+	}
+
+	if len(files) > openConfirmationThreshold && !options.HasOption("--yes") {
+		if !confirm(fmt.Sprintf("Open %v files?", len(files))) {
+			return nil
+		}
+	}
+
+	settings, err := store.Settings(tx)
+	if err != nil {
+		return fmt.Errorf("could not retrieve settings: %v", err)
+	}
+
+	return api.OpenFiles(files, command, settings)
+}
+
+// Asks the question on standard error and reads the answer from standard
+// input, which must be 'y' or 'yes' for confirmation.
+func confirm(question string) bool {
+	fmt.Fprintf(os.Stderr, "%v [y/N] ", question)
+
+	answer, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && answer == "" {
+		fmt.Fprintln(os.Stderr)
+		return false
+	}
+
+	switch strings.ToLower(strings.TrimSpace(answer)) {
+	case "y", "yes":
+		return true
+	default:
+		return false
+	}
+}
@@ -0,0 +1,90 @@
+// Copyright 2011-2015 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package cli
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+	"tmsu/storage"
+)
+
+func TestOpen(test *testing.T) {
+	// set-up
+
+	databasePath := testDatabase()
+	defer os.Remove(databasePath)
+
+	err := redirectStreams()
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer restoreStreams()
+
+	store, err := storage.OpenAt(databasePath)
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer store.Close()
+
+	// a stand-in viewer that lists its arguments
+	if err := createFile("/tmp/tmsu/viewer", "#!/bin/sh\necho \"$@\"\n"); err != nil {
+		test.Fatal(err)
+	}
+	defer os.Remove("/tmp/tmsu/viewer")
+	if err := os.Chmod("/tmp/tmsu/viewer", 0755); err != nil {
+		test.Fatal(err)
+	}
+
+	for _, path := range []string{"/tmp/tmsu/a.txt", "/tmp/tmsu/b.txt"} {
+		if err := createFile(path, "hello"); err != nil {
+			test.Fatal(err)
+		}
+		defer os.Remove(path)
+
+		if err := TagCommand.Exec(store, Options{}, []string{path, "doc"}); err != nil {
+			test.Fatal(err)
+		}
+	}
+
+	if err := ConfigCommand.Exec(store, Options{}, []string{"openers=image/*=feh; text/*=/tmp/tmsu/viewer --text"}); err != nil {
+		test.Fatal(err)
+	}
+
+	outFile.Seek(0, 0)
+	outFile.Truncate(0)
+
+	// test
+
+	if err := OpenCommand.Exec(store, Options{}, []string{"doc"}); err != nil {
+		test.Fatal(err)
+	}
+	if err := OpenCommand.Exec(store, Options{Option{"--with", "-w", "", true, "/tmp/tmsu/viewer -w"}}, []string{"doc"}); err != nil {
+		test.Fatal(err)
+	}
+
+	err = OpenCommand.Exec(store, Options{}, []string{"not", "doc"})
+	if exitStatus(err) != exitNothingMatched {
+		test.Fatalf("Expected exit status %v but was %v.", exitNothingMatched, exitStatus(err))
+	}
+
+	// validate
+
+	outFile.Seek(0, 0)
+
+	bytes, err := ioutil.ReadAll(outFile)
+	compareOutput(test, "--text /tmp/tmsu/a.txt /tmp/tmsu/b.txt\n-w /tmp/tmsu/a.txt /tmp/tmsu/b.txt\n", string(bytes))
+}
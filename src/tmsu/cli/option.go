@@ -52,6 +52,19 @@ func (options Options) Count(name string) uint {
 	return count
 }
 
+// The arguments of each occurrence of the option, in order.
+func (options Options) Arguments(name string) []string {
+	arguments := make([]string, 0, 1)
+
+	for _, option := range options {
+		if option.LongName == name || option.ShortName == name {
+			arguments = append(arguments, option.Argument)
+		}
+	}
+
+	return arguments
+}
+
 func (options Options) Get(name string) *Option {
 	for _, option := range options {
 		if option.LongName == name || option.ShortName == name {
@@ -72,62 +85,79 @@ func NewOptionParser(globalOptions Options, commands []*Command) *OptionParser {
 	return &parser
 }
 
+// Parses the command-line arguments into the command, its options and its
+// arguments. Global options may appear before or after the command name; short
+// options may be combined, e.g. '-rf', and take their argument from the same
+// word, e.g. '-Dpath' or '--database=path', or the next; and arguments
+// following '--' are never treated as options. A Separated command also
+// receives a '--' that follows one of its arguments, so that it can tell apart
+// the arguments either side of it.
 func (parser *OptionParser) Parse(args ...string) (command *Command, options Options, arguments []string, err error) {
 	commandName := ""
 	options = make(Options, 0)
 	arguments = make([]string, 0)
 
-	possibleOptions := make(Options, len(globalOptions))
-	copy(possibleOptions, globalOptions)
+	possibleOptions := make(Options, len(parser.globalOptions))
+	copy(possibleOptions, parser.globalOptions)
 
 	parseOptions := true
 	for index := 0; index < len(args); index++ {
 		arg := args[index]
 
-		switch arg {
-		case "":
+		switch {
+		case arg == "":
 			err = fmt.Errorf("invalid empty argument")
 			return
-		case "--":
+		case arg == "--" && parseOptions:
 			parseOptions = false
-		default:
-			if parseOptions && len(arg) > 1 && arg[0] == '-' {
-				parts := strings.SplitN(arg, "=", 2)
-				optionName := parts[0]
 
-				option := lookupOption(possibleOptions, optionName)
-				if option == nil {
-					err = fmt.Errorf("invalid option '%v'", optionName)
+			if command != nil && command.Separated && len(arguments) > 0 {
+				arguments = append(arguments, arg)
+			}
+		case parseOptions && strings.HasPrefix(arg, "--"):
+			parts := strings.SplitN(arg, "=", 2)
+
+			var option *Option
+			option, index, err = parser.parseOption(possibleOptions, parts[0], parts[1:], args, index)
+			if err != nil {
+				return
+			}
+
+			options = append(options, *option)
+		case parseOptions && len(arg) > 1 && arg[0] == '-':
+			// combined short options: those following an option that takes an
+			// argument are instead its argument
+			for position := 1; position < len(arg); position++ {
+				optionName := "-" + arg[position:position+1]
+
+				var attached []string
+				if rest := strings.TrimPrefix(arg[position+1:], "="); rest != "" {
+					attached = []string{rest}
+				}
+
+				var option *Option
+				option, index, err = parser.parseOption(possibleOptions, optionName, attached, args, index)
+				if err != nil {
 					return
 				}
 
+				options = append(options, *option)
+
 				if option.HasArgument {
-					if len(parts) == 2 {
-						option.Argument = parts[1]
-					} else {
-						if len(args) < index+2 {
-							err = fmt.Errorf("missing argument for option '%v'", optionName)
-							return
-						}
-
-						option.Argument = args[index+1]
-						index++
-					}
+					break
 				}
+			}
+		default:
+			if commandName == "" {
+				commandName = arg
 
-				options = append(options, *option)
-			} else {
-				if commandName == "" {
-					commandName = arg
-
-					var ok bool
-					command, ok = parser.commandByName[commandName]
-					if ok {
-						possibleOptions = append(possibleOptions, command.Options...)
-					}
-				} else {
-					arguments = append(arguments, arg)
+				var ok bool
+				command, ok = parser.commandByName[commandName]
+				if ok {
+					possibleOptions = append(possibleOptions, command.Options...)
 				}
+			} else {
+				arguments = append(arguments, arg)
 			}
 		}
 	}
@@ -151,6 +181,35 @@ func buildCommandByNameMap(commands []*Command) map[string]*Command {
 	return commandByName
 }
 
+// Looks up the named option, taking its argument from those attached to the
+// option, if any, or else from the next command-line argument.
+func (parser *OptionParser) parseOption(possibleOptions Options, name string, attached []string, args []string, index int) (*Option, int, error) {
+	option := lookupOption(possibleOptions, name)
+	if option == nil {
+		return nil, index, fmt.Errorf("invalid option '%v'", name)
+	}
+
+	if !option.HasArgument {
+		if len(attached) > 0 && strings.HasPrefix(name, "--") {
+			return nil, index, fmt.Errorf("option '%v' does not take an argument", name)
+		}
+
+		return option, index, nil
+	}
+
+	switch {
+	case len(attached) > 0:
+		option.Argument = attached[0]
+	case index+1 < len(args):
+		index++
+		option.Argument = args[index]
+	default:
+		return nil, index, fmt.Errorf("missing argument for option '%v'", name)
+	}
+
+	return option, index, nil
+}
+
 func lookupOption(options Options, name string) *Option {
 	for _, option := range options {
 		if option.ShortName == name || option.LongName == name {
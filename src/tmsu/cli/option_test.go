@@ -76,3 +76,85 @@ func TestInvalidGlobalOption(test *testing.T) {
 		test.Fatal("Invalid option not identified.")
 	}
 }
+
+func TestParseCombinedShortOptions(test *testing.T) {
+	command := &Command{Name: "a", Options: Options{Option{"--recursive", "-r", "recursive", false, ""},
+		Option{"--force", "-f", "force", false, ""},
+		Option{"--where", "-w", "where", true, ""}}}
+	parser := NewOptionParser(Options{Option{"--database", "-D", "database", true, ""}}, []*Command{command})
+
+	_, options, arguments, err := parser.Parse("a", "-rf", "-rwx", "-D=path", "b")
+	if err != nil {
+		test.Fatal(err)
+	}
+	if len(options) != 5 {
+		test.Fatalf("Expected five options but were %v.", len(options))
+	}
+	if options[0].LongName != "--recursive" || options[1].LongName != "--force" || options[2].LongName != "--recursive" {
+		test.Fatalf("Expected options '--recursive', '--force' and '--recursive' but were '%v', '%v' and '%v'.", options[0].LongName, options[1].LongName, options[2].LongName)
+	}
+	if options[3].LongName != "--where" || options[3].Argument != "x" {
+		test.Fatalf("Expected option '--where' with argument 'x' but was '%v' with '%v'.", options[3].LongName, options[3].Argument)
+	}
+	if options[4].LongName != "--database" || options[4].Argument != "path" {
+		test.Fatalf("Expected option '--database' with argument 'path' but was '%v' with '%v'.", options[4].LongName, options[4].Argument)
+	}
+	if len(arguments) != 1 || arguments[0] != "b" {
+		test.Fatalf("Expected argument of 'b' but were %v.", arguments)
+	}
+}
+
+func TestParseSeparatedArguments(test *testing.T) {
+	command := &Command{Name: "a", Separated: true}
+	parser := NewOptionParser(Options{}, []*Command{command})
+
+	_, _, arguments, err := parser.Parse("a", "b", "--", "-c")
+	if err != nil {
+		test.Fatal(err)
+	}
+	if len(arguments) != 3 || arguments[0] != "b" || arguments[1] != "--" || arguments[2] != "-c" {
+		test.Fatalf("Expected arguments 'b', '--' and '-c' but were %v.", arguments)
+	}
+
+	_, _, arguments, err = parser.Parse("a", "--", "b", "-c")
+	if err != nil {
+		test.Fatal(err)
+	}
+	if len(arguments) != 2 || arguments[0] != "b" || arguments[1] != "-c" {
+		test.Fatalf("Expected arguments 'b' and '-c' but were %v.", arguments)
+	}
+}
+
+func TestParseLongOptionArgument(test *testing.T) {
+	command := &Command{Name: "a", Options: Options{Option{"--where", "-w", "where", true, ""}}}
+	parser := NewOptionParser(Options{Option{"--verbose", "-v", "verbose", false, ""}}, []*Command{command})
+
+	_, options, arguments, err := parser.Parse("a", "--where=x=y", "b", "--verbose", "--", "--where", "-")
+	if err != nil {
+		test.Fatal(err)
+	}
+	if len(options) != 2 {
+		test.Fatalf("Expected two options but were %v.", len(options))
+	}
+	if options[0].Argument != "x=y" {
+		test.Fatalf("Expected argument of 'x=y' but was '%v'.", options[0].Argument)
+	}
+	if options[1].LongName != "--verbose" {
+		test.Fatalf("Expected global option '--verbose' after command but was '%v'.", options[1].LongName)
+	}
+	if len(arguments) != 3 || arguments[0] != "b" || arguments[1] != "--where" || arguments[2] != "-" {
+		test.Fatalf("Expected arguments 'b', '--where' and '-' but were %v.", arguments)
+	}
+}
+
+func TestInvalidCombinedShortOption(test *testing.T) {
+	command := &Command{Name: "a", Options: Options{Option{"--recursive", "-r", "recursive", false, ""}}}
+	parser := NewOptionParser(Options{}, []*Command{command})
+
+	if _, _, _, err := parser.Parse("a", "-rz"); err == nil {
+		test.Fatal("Invalid combined option not identified.")
+	}
+	if _, _, _, err := parser.Parse("a", "--recursive=yes"); err == nil {
+		test.Fatal("Unexpected option argument not identified.")
+	}
+}
@@ -0,0 +1,108 @@
+// Copyright 2011-2015 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package cli
+
+import (
+	"fmt"
+	"strings"
+	"tmsu/api"
+	"tmsu/common/log"
+	"tmsu/storage"
+)
+
+var OrganizeCommand = Command{
+	Name:     "organize",
+	Aliases:  []string{"organise"},
+	Synopsis: "Arrange files into directories according to their tag values",
+	Usages:   []string{"tmsu organize [OPTION]... --template=TEMPLATE QUERY DESTDIR"},
+	Description: `Moves each file matching QUERY to a path under DESTDIR derived from TEMPLATE, updating the stored path of the file so that its tags are retained.
+
+Each {TAG} in TEMPLATE is replaced by the file's value for that tag and {name} by the file's name without its extension. If the file has several values for a tag the first, alphabetically, is used. The file's extension is appended unless the expanded template already ends with it. Files without a value for each of the tags in TEMPLATE are skipped, as are files whose new path is already taken. A TEMPLATE that would place files outside of DESTDIR is rejected.
+
+With --link the files are left in place and symbolic links are created at the new paths instead: --hardlink and --reflink create hard links and copy-on-write clones respectively. See 'tmsu help link'.
+
+See 'tmsu help files' for the query syntax.`,
+	Examples: []string{"$ tmsu organize --template={artist}/{album}/{title} music ~/music",
+		"$ tmsu organize --pretend --template={year}/{name} photo ~/photos",
+		"$ tmsu organize --link --template={genre}/{name} film /srv/share/films"},
+	Options: Options{Option{"--template", "-t", "the path to arrange each file at", true, ""},
+		Option{"--link", "-l", "create symbolic links rather than moving the files", false, ""},
+		Option{"--hardlink", "-H", "create hard links rather than moving the files", false, ""},
+		Option{"--reflink", "", "create copy-on-write clones rather than moving the files", false, ""},
+		Option{"--pretend", "-P", "do not make any changes", false, ""}},
+	Exec:     organizeExec,
+	Modifies: true,
+}
+
+// unexported
+
+func organizeExec(store *storage.Storage, options Options, args []string) error {
+	if !options.HasOption("--template") {
+		return fmt.Errorf("a template must be specified using --template")
+	}
+	if len(args) < 2 {
+		return fmt.Errorf("too few arguments")
+	}
+
+	template := options.Get("--template").Argument
+	if err := api.ValidateTemplate(template); err != nil {
+		return err
+	}
+
+	organizeOptions := api.OrganizeOptions{Pretend: options.HasOption("--pretend") || store.DryRun}
+	switch {
+	case options.HasOption("--hardlink") && options.HasOption("--reflink"):
+		return fmt.Errorf("--hardlink and --reflink cannot be specified together")
+	case options.HasOption("--hardlink"):
+		organizeOptions.Link, organizeOptions.Kind = true, api.HardLink
+	case options.HasOption("--reflink"):
+		organizeOptions.Link, organizeOptions.Kind = true, api.RefLink
+	case options.HasOption("--link"):
+		organizeOptions.Link, organizeOptions.Kind = true, api.SymbolicLink
+	}
+
+	queryText := strings.Join(args[:len(args)-1], " ")
+	destPath := args[len(args)-1]
+
+	tx, err := store.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Commit()
+
+	files, err := api.QueryFiles(store, tx, queryText, api.QueryOptions{Sort: "name"})
+	if err != nil {
+		if noSuchTags, ok := err.(api.NoSuchTagsError); ok {
+			for _, tagName := range noSuchTags.Names {
+				log.Warnf("no such tag '%v'.", tagName)
+			}
+
+			return errNoSuchTag
+		}
+
+		return err
+	}
+
+	organizeOptions.Report = func(path, newPath string) {
+		if organizeOptions.Link {
+			fmt.Printf("%v: linked at %v\n", path, newPath)
+		} else {
+			fmt.Printf("%v: moved to %v\n", path, newPath)
+		}
+	}
+
+	return api.Organize(store, tx, files, template, destPath, organizeOptions)
+}
@@ -0,0 +1,211 @@
+// Copyright 2011-2015 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package cli
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+	"tmsu/storage"
+)
+
+func TestOrganizeMove(test *testing.T) {
+	// set-up
+
+	databasePath := testDatabase()
+	defer os.Remove(databasePath)
+
+	err := redirectStreams()
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer restoreStreams()
+
+	store, err := storage.OpenAt(databasePath)
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer store.Close()
+
+	if err := createFile("/tmp/tmsu/a.mp3", "a"); err != nil {
+		test.Fatal(err)
+	}
+	defer os.Remove("/tmp/tmsu/a.mp3")
+
+	if err := createFile("/tmp/tmsu/b.mp3", "b"); err != nil {
+		test.Fatal(err)
+	}
+	defer os.Remove("/tmp/tmsu/b.mp3")
+
+	destPath := "/tmp/tmsu/music"
+	defer os.RemoveAll(destPath)
+
+	if err := TagCommand.Exec(store, Options{}, []string{"/tmp/tmsu/a.mp3", "music", "artist=Bach", "title=Toccata"}); err != nil {
+		test.Fatal(err)
+	}
+	if err := TagCommand.Exec(store, Options{}, []string{"/tmp/tmsu/b.mp3", "music", "artist=Bach"}); err != nil {
+		test.Fatal(err)
+	}
+
+	// test
+
+	options := Options{Option{"--template", "-t", "", true, "{artist}/{title}"}}
+	if err := OrganizeCommand.Exec(store, options, []string{"music", destPath}); err != nil {
+		test.Fatal(err)
+	}
+
+	// validate
+
+	outFile.Seek(0, 0)
+
+	bytes, err := ioutil.ReadAll(outFile)
+	compareOutput(test, "/tmp/tmsu/a.mp3: moved to /tmp/tmsu/music/Bach/Toccata.mp3\n", string(bytes))
+
+	if _, err := os.Stat("/tmp/tmsu/music/Bach/Toccata.mp3"); err != nil {
+		test.Fatal(err)
+	}
+	if _, err := os.Stat("/tmp/tmsu/b.mp3"); err != nil {
+		test.Fatal(err)
+	}
+
+	tx, err := store.Begin()
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer tx.Commit()
+
+	file, err := store.FileByPath(tx, "/tmp/tmsu/music/Bach/Toccata.mp3")
+	if err != nil {
+		test.Fatal(err)
+	}
+	if file == nil {
+		test.Fatal("moved file's path was not updated")
+	}
+}
+
+func TestOrganizeRejectsTemplateOutsideDestination(test *testing.T) {
+	// set-up
+
+	databasePath := testDatabase()
+	defer os.Remove(databasePath)
+
+	err := redirectStreams()
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer restoreStreams()
+
+	store, err := storage.OpenAt(databasePath)
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer store.Close()
+
+	if err := createFile("/tmp/tmsu/a.mp3", "a"); err != nil {
+		test.Fatal(err)
+	}
+	defer os.Remove("/tmp/tmsu/a.mp3")
+
+	destPath := "/tmp/tmsu/music"
+	defer os.RemoveAll(destPath)
+	defer os.RemoveAll("/tmp/tmsu/Bach")
+
+	if err := TagCommand.Exec(store, Options{}, []string{"/tmp/tmsu/a.mp3", "music", "artist=Bach"}); err != nil {
+		test.Fatal(err)
+	}
+
+	// test
+
+	options := Options{Option{"--template", "-t", "", true, "../{artist}/{name}"}}
+	err = OrganizeCommand.Exec(store, options, []string{"music", destPath})
+
+	// validate
+
+	if err == nil {
+		test.Fatal("expected template leading outside of the destination to be rejected")
+	}
+	if _, err := os.Stat("/tmp/tmsu/a.mp3"); err != nil {
+		test.Fatal(err)
+	}
+	if _, err := os.Stat("/tmp/tmsu/Bach"); !os.IsNotExist(err) {
+		test.Fatal("file was moved outside of the destination")
+	}
+}
+
+func TestOrganizeDryRun(test *testing.T) {
+	// set-up
+
+	databasePath := testDatabase()
+	defer os.Remove(databasePath)
+
+	err := redirectStreams()
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer restoreStreams()
+
+	store, err := storage.OpenAt(databasePath)
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer store.Close()
+
+	if err := createFile("/tmp/tmsu/a.mp3", "a"); err != nil {
+		test.Fatal(err)
+	}
+	defer os.Remove("/tmp/tmsu/a.mp3")
+
+	destPath := "/tmp/tmsu/music"
+	defer os.RemoveAll(destPath)
+
+	if err := TagCommand.Exec(store, Options{}, []string{"/tmp/tmsu/a.mp3", "music", "artist=Bach"}); err != nil {
+		test.Fatal(err)
+	}
+
+	// test
+
+	store.DryRun = true
+
+	options := Options{Option{"--template", "-t", "", true, "{artist}/{name}"}}
+	if err := OrganizeCommand.Exec(store, options, []string{"music", destPath}); err != nil {
+		test.Fatal(err)
+	}
+
+	store.DryRun = false
+
+	// validate
+
+	if _, err := os.Stat("/tmp/tmsu/a.mp3"); err != nil {
+		test.Fatal(err)
+	}
+	if _, err := os.Stat(destPath); !os.IsNotExist(err) {
+		test.Fatal("dry run created the destination")
+	}
+
+	tx, err := store.Begin()
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer tx.Commit()
+
+	file, err := store.FileByPath(tx, "/tmp/tmsu/a.mp3")
+	if err != nil {
+		test.Fatal(err)
+	}
+	if file == nil {
+		test.Fatal("dry run changed the file's path")
+	}
+}
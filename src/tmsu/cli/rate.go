@@ -0,0 +1,129 @@
+// Copyright 2011-2015 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package cli
+
+import (
+	"fmt"
+	"strconv"
+	"tmsu/api"
+	"tmsu/storage"
+)
+
+var RateCommand = Command{
+	Name:     "rate",
+	Synopsis: "View or set the rating of files",
+	Usages: []string{"tmsu rate FILE...",
+		"tmsu rate FILE... RATING",
+		"tmsu rate --delete FILE..."},
+	Description: `Shows the rating of each FILE or, if RATING is specified, rates each FILE replacing any rating it already has. Ratings are whole numbers from 0 to 5.
+
+A rating is stored as the value of the 'rating' tag, so files can be queried by rating, e.g. 'tmsu files "rating >= 4"'. See 'tmsu help files'.`,
+	Examples: []string{"$ tmsu rate sunset.jpg 4",
+		"$ tmsu rate sunset.jpg\n4",
+		`$ tmsu files "rating >= 4"`,
+		"$ tmsu rate --delete sunset.jpg"},
+	Options:    Options{Option{"--delete", "-d", "remove the rating from each file", false, ""}},
+	Exec:       rateExec,
+	ModifiesIf: rateModifies,
+}
+
+// unexported
+
+// Rating files, or removing their ratings, modifies the database: showing the
+// ratings does not.
+func rateModifies(options Options, args []string) bool {
+	if options.HasOption("--delete") {
+		return true
+	}
+
+	if len(args) > 1 {
+		_, err := strconv.Atoi(args[len(args)-1])
+		return err == nil
+	}
+
+	return false
+}
+
+func rateExec(store *storage.Storage, options Options, args []string) error {
+	if len(args) < 1 {
+		return fmt.Errorf("too few arguments")
+	}
+
+	tx, err := store.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Commit()
+
+	if options.HasOption("--delete") {
+		for _, path := range args {
+			if err := api.UnrateFile(store, tx, path); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}
+
+	// the final argument is a rating if it is numeric: file names rarely are
+	if len(args) > 1 {
+		if _, err := strconv.Atoi(args[len(args)-1]); err == nil {
+			return rateFiles(store, tx, args[:len(args)-1], args[len(args)-1])
+		}
+	}
+
+	return listRatings(store, tx, args)
+}
+
+func rateFiles(store *storage.Storage, tx *storage.Tx, paths []string, ratingText string) error {
+	rating, err := api.ParseRating(ratingText)
+	if err != nil {
+		return err
+	}
+
+	settings, err := store.Settings(tx)
+	if err != nil {
+		return err
+	}
+
+	for _, path := range paths {
+		if err := api.RateFile(store, tx, path, rating, settings); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func listRatings(store *storage.Storage, tx *storage.Tx, paths []string) error {
+	for _, path := range paths {
+		rating, rated, err := api.FileRating(store, tx, path)
+		if err != nil {
+			return err
+		}
+		if !rated {
+			continue
+		}
+
+		if len(paths) == 1 {
+			fmt.Println(rating)
+		} else {
+			fmt.Printf("%v: %v\n", path, rating)
+		}
+	}
+
+	return nil
+}
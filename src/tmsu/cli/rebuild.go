@@ -0,0 +1,64 @@
+// Copyright 2011-2015 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package cli
+
+import (
+	"fmt"
+	"tmsu/storage"
+)
+
+var RebuildCommand = Command{
+	Name:     "rebuild",
+	Synopsis: "Rebuild the database from its text database",
+	Usages:   []string{"tmsu rebuild [FILE]"},
+	Description: `Regenerates the database from the text database FILE, replacing its tags, values, files, implications, queries and settings. The undo history is discarded.
+
+When the 'textDatabase' setting is enabled, TMSU maintains a text database alongside the database: a sorted file with one line per tag, file and tagging that is suitable for committing to version control. If FILE is not specified then this text database is used.
+
+To maintain the text database:
+
+  $ tmsu config textDatabase=yes
+
+After checking out or merging changes to the text database, run this command to bring the database up to date.`,
+	Examples: []string{"$ tmsu rebuild",
+		"$ tmsu rebuild ~/tags/default.db.txt"},
+	Options:  Options{},
+	Exec:     rebuildExec,
+	Modifies: true,
+}
+
+func rebuildExec(store *storage.Storage, options Options, args []string) error {
+	if len(args) > 1 {
+		return fmt.Errorf("too many arguments")
+	}
+
+	path := store.TextPath()
+	if len(args) == 1 {
+		path = args[0]
+	}
+
+	tx, err := store.Begin()
+	if err != nil {
+		return err
+	}
+
+	if err := store.Rebuild(tx, path); err != nil {
+		tx.Rollback()
+		return fmt.Errorf("could not rebuild database: %v", err)
+	}
+
+	return tx.Commit()
+}
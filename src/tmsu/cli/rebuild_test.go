@@ -0,0 +1,88 @@
+// Copyright 2011-2015 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package cli
+
+import (
+	"os"
+	"testing"
+	"tmsu/api"
+	"tmsu/storage"
+)
+
+func TestRebuild(test *testing.T) {
+	// set-up
+
+	databasePath := testDatabase()
+	defer os.Remove(databasePath)
+	defer os.Remove(databasePath + ".txt")
+
+	err := redirectStreams()
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer restoreStreams()
+
+	if err := createFile("/tmp/tmsu/a", "hello"); err != nil {
+		test.Fatal(err)
+	}
+	defer os.Remove("/tmp/tmsu/a")
+
+	store, err := storage.OpenAt(databasePath)
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	if err := ConfigCommand.Exec(store, Options{}, []string{"textDatabase=yes"}); err != nil {
+		test.Fatal(err)
+	}
+	if err := TagCommand.Exec(store, Options{}, []string{"/tmp/tmsu/a", "apple", "year=2015"}); err != nil {
+		test.Fatal(err)
+	}
+	store.Close()
+
+	if err := os.Remove(databasePath); err != nil {
+		test.Fatal(err)
+	}
+
+	store, err = storage.OpenAt(databasePath)
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer store.Close()
+
+	// test
+
+	if err := RebuildCommand.Exec(store, Options{}, []string{}); err != nil {
+		test.Fatal(err)
+	}
+
+	// validate
+
+	tagValues, err := api.New(store).FileTags("/tmp/tmsu/a", true)
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	if len(tagValues) != 2 {
+		test.Fatalf("Expected two tags but were %v.", len(tagValues))
+	}
+	if tagValues[0] != (api.TagValue{"apple", ""}) {
+		test.Fatalf("Expected 'apple' but was %v.", tagValues[0])
+	}
+	if tagValues[1] != (api.TagValue{"year", "2015"}) {
+		test.Fatalf("Expected 'year=2015' but was %v.", tagValues[1])
+	}
+}
@@ -0,0 +1,85 @@
+// Copyright 2011-2015 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package cli
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+	"tmsu/api"
+	"tmsu/common/path"
+	"tmsu/storage"
+)
+
+var RecentCommand = Command{
+	Name:     "recent",
+	Synopsis: "List recently tagged or modified files",
+	Usages:   []string{"tmsu recent [OPTION]..."},
+	Description: `Lists the files tagged in the last N days (7 by default), most recently tagged first, with the time each was last tagged.
+
+With --modified the files whose content has been modified in that time are listed instead, most recently modified first. The modification times are those of the files on disk so files changed since they were tagged are included.
+
+The virtual filesystem presents the files tagged in the last seven days in its '.recent' directory.`,
+	Examples: []string{"$ tmsu recent",
+		"$ tmsu recent --days 1",
+		"$ tmsu recent --modified --days 30"},
+	Options: Options{Option{"--days", "-d", "list files tagged or modified in the last N days", true, ""},
+		Option{"--modified", "-m", "list recently modified rather than tagged files", false, ""}},
+	Exec: recentExec,
+}
+
+// The number of days considered recent unless specified.
+const defaultRecentDays = 7
+
+// unexported
+
+func recentExec(store *storage.Storage, options Options, args []string) error {
+	if len(args) > 0 {
+		return fmt.Errorf("too many arguments")
+	}
+
+	days := defaultRecentDays
+	if options.HasOption("--days") {
+		var err error
+		days, err = strconv.Atoi(options.Get("--days").Argument)
+		if err != nil || days < 1 {
+			return fmt.Errorf("invalid number of days '%v'", options.Get("--days").Argument)
+		}
+	}
+
+	since := time.Now().AddDate(0, 0, -days)
+
+	tx, err := store.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Commit()
+
+	recent, err := api.RecentFiles(store, tx, since, options.HasOption("--modified"))
+	if err != nil {
+		return err
+	}
+
+	for _, recentFile := range recent {
+		fmt.Printf("%v  %v\n", recentFile.Time.Local().Format("2006-01-02 15:04:05"), path.Rel(recentFile.File.Path()))
+	}
+
+	if len(recent) == 0 {
+		return errNothingMatched
+	}
+
+	return nil
+}
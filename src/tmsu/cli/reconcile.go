@@ -0,0 +1,191 @@
+// Copyright 2011-2015 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package cli
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"tmsu/api"
+	"tmsu/common/log"
+	_path "tmsu/common/path"
+	"tmsu/common/text"
+	"tmsu/common/xattr"
+	"tmsu/storage"
+)
+
+var ReconcileCommand = Command{
+	Name:     "reconcile",
+	Synopsis: "Reconcile the tags in extended attributes with the database",
+	Usages:   []string{"tmsu reconcile [OPTION]... --prefer=POLICY [FILE]..."},
+	Description: `Reconciles the tags of each FILE, or of every tagged file if no FILE is specified, in the database with those in the file's 'user.xdg.tags' extended attribute, as written by 'tmsu emblem-sync'. The two disagree where either has been changed without the other, e.g. when a file is copied from another machine along with its extended attributes.
+
+POLICY determines how they are reconciled:
+
+  xattr  The attribute's tags replace the file's explicit tags in the database. Files that do not have the attribute are skipped, as it cannot be told whether their tags were ever mirrored.
+  db     The database's tags replace the attribute's.
+  union  The file is tagged in the database with the tags of both.
+
+In each case the attribute is then rewritten with the file's tags in the database, including those implied, so that the two agree. Tags are created as the 'autoCreateTags' and 'autoCreateValues' settings allow. Each file changed is listed with the tags applied (+) and removed (-).
+
+With --recursive the files beneath each directory FILE that have the attribute are reconciled too, which suits a directory copied from another machine whose files are not yet in the database.
+
+Extended attributes are only supported on Linux and by some file systems.`,
+	Examples: []string{"$ tmsu reconcile --prefer=union\n/home/bob/song.mp3: +music",
+		"$ tmsu reconcile --prefer=xattr --recursive ~/copied-from-laptop",
+		"$ tmsu reconcile --prefer=db --pretend"},
+	Options: Options{Option{"--prefer", "", "the reconciliation policy: xattr, db or union", true, ""},
+		Option{"--recursive", "-r", "reconcile the files beneath directories", false, ""},
+		Option{"--pretend", "-P", "list the changes that would be made without making them", false, ""}},
+	Exec:     reconcileExec,
+	Modifies: true,
+}
+
+// unexported
+
+func reconcileExec(store *storage.Storage, options Options, args []string) error {
+	if !options.HasOption("--prefer") {
+		return fmt.Errorf("a policy must be specified with --prefer: one of xattr, db, union")
+	}
+
+	prefer := options.Get("--prefer").Argument
+	if !api.IsReconcilePolicy(prefer) {
+		return fmt.Errorf("invalid policy '%v': must be one of xattr, db, union", prefer)
+	}
+
+	reconcileOptions := api.ReconcileOptions{Prefer: prefer,
+		Pretend: options.HasOption("--pretend") || store.DryRun,
+		Report: func(report api.ReconcileReport) {
+			changes := make([]string, 0, len(report.Tagged)+len(report.Untagged))
+			for _, tagValue := range report.Tagged {
+				changes = append(changes, "+"+text.Escape(tagValue.String()))
+			}
+			for _, tagValue := range report.Untagged {
+				changes = append(changes, "-"+text.Escape(tagValue.String()))
+			}
+			if len(changes) == 0 {
+				changes = append(changes, "attribute updated")
+			}
+
+			fmt.Printf("%v: %v\n", report.Path, strings.Join(changes, " "))
+		}}
+
+	tx, err := store.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Commit()
+
+	settings, err := store.Settings(tx)
+	if err != nil {
+		return err
+	}
+
+	paths, err := reconcilePaths(store, tx, args, options.HasOption("--recursive"))
+	if err != nil {
+		return err
+	}
+
+	wereErrors := false
+	for _, path := range paths {
+		if err := api.ReconcileFile(store, tx, path, settings, reconcileOptions); err != nil {
+			switch {
+			case err == xattr.NotSupportedError:
+				return err
+			case os.IsNotExist(err):
+				log.Warnf("%v: no such file", path)
+			case os.IsPermission(err):
+				log.Warnf("%v: permission denied", path)
+			default:
+				return err
+			}
+
+			wereErrors = true
+		}
+	}
+
+	if wereErrors {
+		return errBlank
+	}
+
+	return nil
+}
+
+// The absolute paths of the files specified or, if none is specified, those
+// of every file in the database.
+func reconcilePaths(store *storage.Storage, tx *storage.Tx, args []string, recursive bool) ([]string, error) {
+	paths := make([]string, 0, len(args))
+
+	if len(args) == 0 {
+		files, err := store.Files(tx, "name")
+		if err != nil {
+			return nil, fmt.Errorf("could not retrieve files: %v", err)
+		}
+
+		for _, file := range files {
+			if !_path.IsURL(file.Path()) {
+				paths = append(paths, file.Path())
+			}
+		}
+
+		return paths, nil
+	}
+
+	for _, arg := range args {
+		absPath, err := filepath.Abs(arg)
+		if err != nil {
+			return nil, fmt.Errorf("%v: could not get absolute path: %v", arg, err)
+		}
+
+		paths = append(paths, absPath)
+
+		if !recursive {
+			continue
+		}
+
+		if stat, err := os.Stat(absPath); err != nil || !stat.IsDir() {
+			continue
+		}
+
+		err = _path.Walk(absPath, func(dir string, entries []_path.Entry, err error) error {
+			if err != nil {
+				log.Warnf("%v: could not read directory entries: %v", dir, err)
+				return nil
+			}
+
+			for _, entry := range entries {
+				if entry.Info == nil || entry.Info.IsDir() {
+					continue
+				}
+
+				value, err := xattr.Get(entry.Path, api.XdgTagsAttribute)
+				if err != nil || value == nil {
+					continue
+				}
+
+				paths = append(paths, entry.Path)
+			}
+
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return paths, nil
+}
@@ -0,0 +1,140 @@
+// Copyright 2011-2015 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package cli
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+	"tmsu/api"
+	"tmsu/common/xattr"
+	"tmsu/storage"
+)
+
+func TestReconcile(test *testing.T) {
+	// set-up
+
+	databasePath := testDatabase()
+	defer os.Remove(databasePath)
+
+	err := redirectStreams()
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer restoreStreams()
+
+	store, err := storage.OpenAt(databasePath)
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer store.Close()
+
+	for _, path := range []string{"/tmp/tmsu/a", "/tmp/tmsu/copied/b"} {
+		if err := createFile(path, path); err != nil {
+			test.Fatal(err)
+		}
+		defer os.Remove(path)
+	}
+	defer os.Remove("/tmp/tmsu/copied")
+
+	if err := xattr.Set("/tmp/tmsu/a", api.XdgTagsAttribute, []byte("apple,cherry")); err != nil {
+		test.Skipf("extended attributes are not available: %v", err)
+	}
+	if err := xattr.Set("/tmp/tmsu/copied/b", api.XdgTagsAttribute, []byte("elder")); err != nil {
+		test.Fatal(err)
+	}
+
+	if err := TagCommand.Exec(store, Options{}, []string{"/tmp/tmsu/a", "apple", "banana"}); err != nil {
+		test.Fatal(err)
+	}
+
+	prefer := func(policy string) Options {
+		return Options{Option{"--prefer", "", "", true, policy}}
+	}
+
+	// test
+
+	if err := ReconcileCommand.Exec(store, prefer("union"), []string{}); err != nil {
+		test.Fatal(err)
+	}
+	expectAttribute(test, "/tmp/tmsu/a", "apple,banana,cherry")
+
+	if err := xattr.Set("/tmp/tmsu/a", api.XdgTagsAttribute, []byte("apple")); err != nil {
+		test.Fatal(err)
+	}
+	if err := ReconcileCommand.Exec(store, prefer("xattr"), []string{"/tmp/tmsu/a"}); err != nil {
+		test.Fatal(err)
+	}
+
+	if err := xattr.Set("/tmp/tmsu/a", api.XdgTagsAttribute, []byte("date")); err != nil {
+		test.Fatal(err)
+	}
+	if err := ReconcileCommand.Exec(store, prefer("db"), []string{"/tmp/tmsu/a"}); err != nil {
+		test.Fatal(err)
+	}
+	expectAttribute(test, "/tmp/tmsu/a", "apple")
+
+	recursive := append(prefer("union"), Option{"--recursive", "-r", "", false, ""})
+	if err := ReconcileCommand.Exec(store, recursive, []string{"/tmp/tmsu/copied"}); err != nil {
+		test.Fatal(err)
+	}
+
+	if err := ReconcileCommand.Exec(store, prefer("both"), []string{}); err == nil {
+		test.Fatal("Expected invalid policy to be rejected.")
+	}
+
+	// validate
+
+	outFile.Seek(0, 0)
+
+	bytes, err := ioutil.ReadAll(outFile)
+	compareOutput(test, `/tmp/tmsu/a: +cherry
+/tmp/tmsu/a: -banana -cherry
+/tmp/tmsu/a: attribute updated
+/tmp/tmsu/copied/b: +elder
+`, string(bytes))
+
+	tx, err := store.Begin()
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer tx.Commit()
+
+	file, err := store.FileByPath(tx, "/tmp/tmsu/copied/b")
+	if err != nil {
+		test.Fatal(err)
+	}
+	if file == nil {
+		test.Fatal("Copied file was not tagged.")
+	}
+
+	elder, err := store.TagByName(tx, "elder")
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	expectTags(test, store, tx, file, elder)
+}
+
+func expectAttribute(test *testing.T, path, expected string) {
+	value, err := xattr.Get(path, api.XdgTagsAttribute)
+	if err != nil {
+		test.Fatal(err)
+	}
+	if string(value) != expected {
+		test.Fatalf("Expected attribute '%v' but was '%v'.", expected, string(value))
+	}
+}
@@ -32,6 +32,7 @@ Attempting to rename a tag with a new name for which a tag already exists will r
 	Examples: []string{"$ tmsu rename montain mountain"},
 	Options:  Options{},
 	Exec:     renameExec,
+	Modifies: true,
 }
 
 func renameExec(store *storage.Storage, options Options, args []string) error {
@@ -57,7 +58,7 @@ func renameExec(store *storage.Storage, options Options, args []string) error {
 		return fmt.Errorf("could not retrieve tag '%v': %v", sourceTagName, err)
 	}
 	if sourceTag == nil {
-		return fmt.Errorf("no such tag '%v'", sourceTagName)
+		return noSuchTagError(sourceTagName)
 	}
 
 	destTag, err := store.TagByName(tx, destTagName)
@@ -17,14 +17,7 @@ package cli
 
 import (
 	"fmt"
-	"os"
-	"path/filepath"
-	"strings"
-	"time"
-	"tmsu/common/fingerprint"
-	"tmsu/common/log"
-	_path "tmsu/common/path"
-	"tmsu/entities"
+	"tmsu/api"
 	"tmsu/storage"
 )
 
@@ -33,31 +26,59 @@ var RepairCommand = Command{
 	Aliases:  []string{"fix"},
 	Synopsis: "Repair the database",
 	Usages: []string{"tmsu repair [OPTION]... [PATH]...",
-		"tmsu repair [OPTION]... repair --manual OLD NEW"},
+		"tmsu repair [OPTION]... --manual OLD NEW",
+		"tmsu repair [OPTION]... --prefix OLD NEW"},
 	Description: `Fixes broken paths and stale fingerprints in the database caused by file modifications and moves.
 
 Modified files are identified by a change to the file's modification time or file size. These files are repaired by updating the details in the database.
 
+Many editors save a file by writing a new one and renaming it over the original. Such a file, identified by its device and inode numbers having changed at the same path, is re-bound to its entry in the database and its fingerprint refreshed, even where its modification time and size are unchanged.
+
 An attempt is made to find missing files under PATHs specified. If a file with the same fingerprint is found then the database is updated with the new file's details. If no PATHs are specified, or no match can be found, then the file is instead reported as missing.
 
 Files that have been both moved and modified cannot be repaired and must be manually relocated.
 
-When run with the --manual option, any paths that begin with OLD are updated to begin with NEW. Any affected files' fingerprints are updated providing the file exists at the new location. No further repairs are attempted in this mode.`,
+Fingerprints are cached by device, inode, size and modification time (see the 'fingerprintCache' setting) so that files which have not changed since they were last examined are not hashed again. The --unmodified option recalculates the fingerprints of unmodified files regardless of the cache.
+
+Virtual files, tagged with 'tmsu tag --force' although they do not exist, are neither reported as missing nor removed unless --include-virtual is specified. Once such a file exists it is repaired as a modified file and thereafter tracked as any other.
+
+Repairs are committed as they are made, with the progress of the repair checkpointed in the database, so that an interrupted repair of a large database does not lose its work. Run again with --resume, and the same --path if any, to continue from where it left off rather than fingerprinting every file again. Missing files are still looked for throughout.
+
+With --remove, confirmation is requested before removing more missing files than the 'confirmFileCount' setting allows (100 by default) unless --yes is specified. Where standard input is not a terminal the repair stops before removing any.
+
+Files on removable volumes that are not currently mounted are skipped: they are verified once the volume is mounted again.
+
+When run with the --manual option, any paths that begin with OLD are updated to begin with NEW. No search for moved files is performed so even very large files and whole directory trees are relocated immediately. The files must exist at the new location: any that have been modified have their fingerprints recalculated unless --unmodified is also specified, in which case the modifications are accepted without re-hashing. No further repairs are attempted in this mode.
+
+When run with the --prefix option, the stored paths of all files under OLD are rewritten to be under NEW without the files being examined at all. This is the quickest way to repair the database after a drive has been mounted elsewhere. No further repairs are attempted in this mode.`,
 	Examples: []string{"$ tmsu repair",
 		"$ tmsu repair /new/path  # look for missing files here",
 		"$ tmsu repair --path=/home/sally  # repair subset of database",
-		"$ tmsu repair --manual /home/bob /home/fred  # manually repair paths"},
+		"$ tmsu repair --unmodified --resume  # continue an interrupted repair",
+		"$ tmsu repair --manual /home/bob /home/fred  # manually repair paths",
+		"$ tmsu repair --manual --unmodified /mnt/old/films /mnt/new/films",
+		"$ tmsu repair --prefix /media/usb /mnt/usb  # drive remounted"},
 	Options: Options{{"--path", "-p", "limit repair to files in database under path", true, ""},
 		{"--pretend", "-P", "do not make any changes", false, ""},
 		{"--remove", "-R", "remove missing files from the database", false, ""},
 		{"--manual", "-m", "manually relocate files", false, ""},
-		{"--unmodified", "-u", "recalculate fingerprints for unmodified files", false, ""},
-		{"--rationalize", "", "remove explicit taggings where an implicit tagging exists", false, ""}},
-	Exec: repairExec,
+		{"--prefix", "", "rewrite the paths of files under a directory", false, ""},
+		{"--unmodified", "-u", "recalculate fingerprints for unmodified files (with --manual: accept modified files without recalculating)", false, ""},
+		{"--rationalize", "", "remove explicit taggings where an implicit tagging exists", false, ""},
+		{"--include-virtual", "", "treat virtual files that do not exist as missing", false, ""},
+		{"--resume", "", "continue an interrupted repair from where it left off", false, ""},
+		{"--yes", "-y", "remove missing files without asking for confirmation", false, ""}},
+	Exec:       repairExec,
+	ModifiesIf: repairModifies,
 }
 
 // unexported
 
+// Repairing modifies the database unless pretending.
+func repairModifies(options Options, args []string) bool {
+	return !options.HasOption("--pretend")
+}
+
 func repairExec(store *storage.Storage, options Options, args []string) error {
 	pretend := options.HasOption("--pretend")
 
@@ -67,465 +88,67 @@ func repairExec(store *storage.Storage, options Options, args []string) error {
 	}
 	defer tx.Commit()
 
-	if options.HasOption("--manual") {
-		fromPath := args[0]
-		toPath := args[1]
-
-		if err := manualRepair(store, tx, fromPath, toPath, pretend); err != nil {
-			return err
-		}
-	} else {
-		searchPaths := args
-		removeMissing := options.HasOption("--remove")
-		recalcUnmodified := options.HasOption("--unmodified")
-		rationalize := options.HasOption("--rationalize")
-
-		limitPath := ""
-		if options.HasOption("--path") {
-			limitPath = options.Get("--path").Argument
+	if options.HasOption("--manual") || options.HasOption("--prefix") {
+		if len(args) < 2 {
+			return fmt.Errorf("too few arguments")
 		}
 
-		if err := fullRepair(store, tx, searchPaths, limitPath, removeMissing, recalcUnmodified, rationalize, pretend); err != nil {
-			return err
+		if len(args) > 2 {
+			return fmt.Errorf("too many arguments")
 		}
-	}
-
-	return nil
-}
-
-func manualRepair(store *storage.Storage, tx *storage.Tx, fromPath, toPath string, pretend bool) error {
-	absFromPath, err := filepath.Abs(fromPath)
-	if err != nil {
-		return fmt.Errorf("%v: could not determine absolute path", err)
-	}
-
-	absToPath, err := filepath.Abs(toPath)
-	if err != nil {
-		return fmt.Errorf("%v: could not determine absolute path", err)
-	}
 
-	log.Infof(2, "retrieving files under '%v' from the database", fromPath)
-
-	dbFile, err := store.FileByPath(tx, absFromPath)
-	if err != nil {
-		return fmt.Errorf("%v: could not retrieve file: %v", fromPath, err)
-	}
-
-	if dbFile != nil {
-		log.Infof(2, "%v: updating to %v", fromPath, toPath)
+		fromPath := args[0]
+		toPath := args[1]
 
-		if !pretend {
-			if err := manualRepairFile(store, tx, dbFile, absToPath); err != nil {
+		if options.HasOption("--prefix") {
+			if err := api.PrefixRepair(store, tx, fromPath, toPath, pretend, printRepairReport); err != nil {
 				return err
 			}
-		}
-	}
-
-	dbFiles, err := store.FilesByDirectory(tx, absFromPath)
-	if err != nil {
-		return fmt.Errorf("could not retrieve files from storage: %v", err)
-	}
-
-	for _, dbFile = range dbFiles {
-		relFileFromPath := _path.Rel(dbFile.Path())
-		absFileToPath := strings.Replace(dbFile.Path(), absFromPath, absToPath, 1)
-		relFileToPath := _path.Rel(absFileToPath)
-
-		log.Infof(2, "%v: updating to %v", relFileFromPath, relFileToPath)
-
-		if !pretend {
-			if err := manualRepairFile(store, tx, dbFile, absFileToPath); err != nil {
+		} else {
+			if err := api.ManualRepair(store, tx, fromPath, toPath, options.HasOption("--unmodified"), pretend, printRepairReport); err != nil {
 				return err
 			}
 		}
-	}
-
-	return nil
-}
-
-func manualRepairFile(store *storage.Storage, tx *storage.Tx, file *entities.File, toPath string) error {
-	var fingerprint fingerprint.Fingerprint
-	var modTime time.Time
-	var size int64
-	var isDir bool
-
-	stat, err := os.Stat(toPath)
-	if err != nil {
-		switch {
-		case os.IsPermission(err):
-			return fmt.Errorf("%v: permission denied", toPath)
-		case os.IsNotExist(err):
-			return fmt.Errorf("%v: file not found", toPath)
-		default:
-			return err
-		}
-
-		modTime = file.ModTime
-		size = file.Size
-		isDir = file.IsDir
 	} else {
-		modTime = stat.ModTime()
-		size = stat.Size()
-		isDir = stat.IsDir()
-	}
-
-	_, err = store.UpdateFile(tx, file.Id, toPath, fingerprint, modTime, size, isDir)
-
-	return err
-}
-
-func fullRepair(store *storage.Storage, tx *storage.Tx, searchPaths []string, limitPath string, removeMissing, recalcUnmodified, rationalize, pretend bool) error {
-	absLimitPath := ""
-	if limitPath != "" {
-		var err error
-		absLimitPath, err = filepath.Abs(limitPath)
-		if err != nil {
-			return fmt.Errorf("%v: could not determine absolute path", err)
-		}
-	}
-
-	settings, err := store.Settings(tx)
-	if err != nil {
-		return err
-	}
-
-	log.Infof(2, "retrieving files under '%v' from the database", absLimitPath)
-
-	dbFiles, err := store.FilesByDirectory(tx, absLimitPath)
-	if err != nil {
-		return fmt.Errorf("could not retrieve files from storage: %v", err)
-	}
-
-	dbFile, err := store.FileByPath(tx, absLimitPath)
-	if err != nil {
-		return fmt.Errorf("could not retrieve file from storage: %v", err)
-	}
-
-	if dbFile != nil {
-		dbFiles = append(dbFiles, dbFile)
-	}
-
-	log.Infof(2, "retrieved %v files from the database for path '%v'", len(dbFiles), absLimitPath)
-
-	unmodfied, modified, missing := determineStatuses(dbFiles)
-
-	if recalcUnmodified {
-		if err = repairUnmodified(store, tx, unmodfied, pretend, settings); err != nil {
-			return err
-		}
-	}
-
-	if err = repairModified(store, tx, modified, pretend, settings); err != nil {
-		return err
-	}
-
-	if err = repairMoved(store, tx, missing, searchPaths, pretend, settings); err != nil {
-		return err
-	}
-
-	if err = repairMissing(store, tx, missing, pretend, removeMissing); err != nil {
-		return err
-	}
-
-	if err = deleteUntaggedFiles(store, tx, dbFiles); err != nil {
-		return err
-	}
-
-	if err = deleteUnusedValues(store, tx); err != nil {
-		return err
-	}
-
-	if rationalize {
-		if err = rationalizeFileTags(store, tx, dbFiles); err != nil {
-			return err
+		repairOptions := api.RepairOptions{
+			SearchPaths:      args,
+			RemoveMissing:    options.HasOption("--remove"),
+			RecalcUnmodified: options.HasOption("--unmodified"),
+			Rationalize:      options.HasOption("--rationalize"),
+			IncludeVirtual:   options.HasOption("--include-virtual"),
+			Resume:           options.HasOption("--resume"),
+			Pretend:          pretend,
+			Report:           printRepairReport,
+			ConfirmRemove: func(count uint) error {
+				return confirmFileCount(store, tx, options, "remove", count)
+			},
 		}
-	}
-
-	return nil
-}
-
-func deleteUntaggedFiles(store *storage.Storage, tx *storage.Tx, files entities.Files) error {
-	log.Infof(2, "purging untagged files")
-
-	fileIds := make([]entities.FileId, len(files))
-	for index, file := range files {
-		fileIds[index] = file.Id
-	}
-
-	return store.DeleteUntaggedFiles(tx, fileIds)
-}
 
-func deleteUnusedValues(store *storage.Storage, tx *storage.Tx) error {
-	log.Infof(2, "purging unused values")
-
-	values, err := store.Values(tx)
-	if err != nil {
-		return fmt.Errorf("could not retrieve set of values")
-	}
-
-	valueIds := make([]entities.ValueId, len(values))
-	for index, value := range values {
-		valueIds[index] = value.Id
-	}
-
-	return store.DeleteUnusedValues(tx, valueIds)
-}
-
-func rationalizeFileTags(store *storage.Storage, tx *storage.Tx, files entities.Files) error {
-	log.Infof(2, "rationalizing file tags")
-
-	for _, file := range files {
-		fileTags, err := store.FileTagsByFileId(tx, file.Id, false)
-		if err != nil {
-			return fmt.Errorf("could not determine tags for file '%v': %v", file.Path(), err)
-		}
-
-		for _, fileTag := range fileTags {
-			if fileTag.Implicit && fileTag.Explicit {
-				log.Infof(2, "%v: removing explicit tagging %v as implicit tagging exists", file.Path(), fileTag.TagId)
-
-				if err := store.DeleteFileTag(tx, fileTag.FileId, fileTag.TagId, fileTag.ValueId); err != nil {
-					return fmt.Errorf("could not delete file tag for file %v, tag %v and value %v", fileTag.FileId, fileTag.TagId, fileTag.ValueId)
-				}
-			}
-		}
-	}
-
-	return nil
-}
-
-func determineStatuses(dbFiles entities.Files) (unmodified, modified, missing entities.Files) {
-	log.Infof(2, "determining file statuses")
-
-	unmodified = make(entities.Files, 0, 10)
-	modified = make(entities.Files, 0, 10)
-	missing = make(entities.Files, 0, 10)
-
-	for _, dbFile := range dbFiles {
-		stat, err := os.Stat(dbFile.Path())
-		if err != nil {
-			switch {
-			case os.IsPermission(err):
-				log.Warnf("%v: permission denied", dbFile.Path())
-				continue
-			case os.IsNotExist(err):
-				log.Infof(2, "%v: missing", dbFile.Path())
-				missing = append(missing, dbFile)
-				continue
-			}
-		}
-
-		if dbFile.ModTime.Equal(stat.ModTime().UTC()) && dbFile.Size == stat.Size() {
-			log.Infof(2, "%v: unmodified", dbFile.Path())
-			unmodified = append(unmodified, dbFile)
-		} else {
-			log.Infof(2, "%v: modified", dbFile.Path())
-			modified = append(modified, dbFile)
-		}
-	}
-
-	return
-}
-
-func repairUnmodified(store *storage.Storage, tx *storage.Tx, unmodified entities.Files, pretend bool, settings entities.Settings) error {
-	log.Infof(2, "recalculating fingerprints for unmodified files")
-
-	for _, dbFile := range unmodified {
-		stat, err := os.Stat(dbFile.Path())
-		if err != nil {
-			return err
-		}
-
-		fingerprint, err := fingerprint.Create(dbFile.Path(), settings.FileFingerprintAlgorithm(), settings.DirectoryFingerprintAlgorithm())
-		if err != nil {
-			log.Warnf("%v: could not create fingerprint: %v", dbFile.Path(), err)
-			continue
-		}
-
-		if !pretend {
-			_, err := store.UpdateFile(tx, dbFile.Id, dbFile.Path(), fingerprint, stat.ModTime(), stat.Size(), stat.IsDir())
-			if err != nil {
-				return fmt.Errorf("%v: could not update file in database: %v", dbFile.Path(), err)
-			}
+		if options.HasOption("--path") {
+			repairOptions.LimitPath = options.Get("--path").Argument
 		}
 
-		fmt.Printf("%v: recalculated fingerprint\n", dbFile.Path())
-	}
-
-	return nil
-}
-
-func repairModified(store *storage.Storage, tx *storage.Tx, modified entities.Files, pretend bool, settings entities.Settings) error {
-	log.Infof(2, "repairing modified files")
-
-	for _, dbFile := range modified {
-		stat, err := os.Stat(dbFile.Path())
-		if err != nil {
+		if err := api.Repair(store, tx, repairOptions); err != nil {
 			return err
 		}
-
-		fingerprint, err := fingerprint.Create(dbFile.Path(), settings.FileFingerprintAlgorithm(), settings.DirectoryFingerprintAlgorithm())
-		if err != nil {
-			log.Warnf("%v: could not create fingerprint: %v", dbFile.Path(), err)
-			continue
-		}
-
-		if !pretend {
-			_, err := store.UpdateFile(tx, dbFile.Id, dbFile.Path(), fingerprint, stat.ModTime(), stat.Size(), stat.IsDir())
-			if err != nil {
-				return fmt.Errorf("%v: could not update file in database: %v", dbFile.Path(), err)
-			}
-		}
-
-		fmt.Printf("%v: updated fingerprint\n", dbFile.Path())
 	}
 
 	return nil
 }
 
-func repairMoved(store *storage.Storage, tx *storage.Tx, missing entities.Files, searchPaths []string, pretend bool, settings entities.Settings) error {
-	log.Infof(2, "repairing moved files")
-
-	if len(missing) == 0 || len(searchPaths) == 0 {
-		// don't bother enumerating filesystem if nothing to do
-		return nil
+func printRepairReport(report api.RepairReport) {
+	switch report.Action {
+	case api.RecalculatedFingerprint:
+		fmt.Printf("%v: recalculated fingerprint\n", report.Path)
+	case api.UpdatedFingerprint:
+		fmt.Printf("%v: updated fingerprint\n", report.Path)
+	case api.Rebound:
+		fmt.Printf("%v: replaced: updated fingerprint\n", report.Path)
+	case api.UpdatedPath:
+		fmt.Printf("%v: updated path to %v\n", report.Path, report.NewPath)
+	case api.Missing:
+		fmt.Printf("%v: missing\n", report.Path)
+	case api.Removed:
+		fmt.Printf("%v: removed\n", report.Path)
 	}
-
-	pathsBySize, err := buildPathBySizeMap(searchPaths)
-	if err != nil {
-		return err
-	}
-
-	for index, dbFile := range missing {
-		log.Infof(2, "%v: searching for new location", dbFile.Path())
-
-		pathsOfSize := pathsBySize[dbFile.Size]
-		log.Infof(2, "%v: file is of size %v, identified %v files of this size", dbFile.Path(), dbFile.Size, len(pathsOfSize))
-
-		for _, candidatePath := range pathsOfSize {
-			candidateFile, err := store.FileByPath(tx, candidatePath)
-			if err != nil {
-				return err
-			}
-			if candidateFile != nil {
-				// file is already tagged
-				continue
-			}
-
-			stat, err := os.Stat(candidatePath)
-			if err != nil {
-				return fmt.Errorf("%v: could not stat file: %v", candidatePath, err)
-			}
-
-			fingerprint, err := fingerprint.Create(candidatePath, settings.FileFingerprintAlgorithm(), settings.DirectoryFingerprintAlgorithm())
-			if err != nil {
-				return fmt.Errorf("%v: could not create fingerprint: %v", candidatePath, err)
-			}
-
-			if fingerprint == dbFile.Fingerprint {
-				if !pretend {
-					_, err := store.UpdateFile(tx, dbFile.Id, candidatePath, dbFile.Fingerprint, stat.ModTime(), dbFile.Size, dbFile.IsDir)
-					if err != nil {
-						return fmt.Errorf("%v: could not update file in database: %v", dbFile.Path(), err)
-					}
-				}
-
-				fmt.Printf("%v: updated path to %v\n", dbFile.Path(), candidatePath)
-
-				missing[index] = nil
-
-				break
-			}
-		}
-	}
-
-	return nil
-}
-
-func repairMissing(store *storage.Storage, tx *storage.Tx, missing entities.Files, pretend, force bool) error {
-	for _, dbFile := range missing {
-		if dbFile == nil {
-			continue
-		}
-
-		if force {
-			if !pretend {
-				if err := store.DeleteFileTagsByFileId(tx, dbFile.Id); err != nil {
-					return fmt.Errorf("%v: could not delete file-tags: %v", dbFile.Path(), err)
-				}
-			}
-
-			fmt.Printf("%v: removed\n", dbFile.Path())
-		} else {
-			fmt.Printf("%v: missing\n", dbFile.Path())
-		}
-	}
-
-	return nil
-}
-
-func buildPathBySizeMap(paths []string) (map[int64][]string, error) {
-	log.Infof(2, "building map of paths by size")
-
-	pathsBySize := make(map[int64][]string, 10)
-
-	for _, path := range paths {
-		if err := buildPathBySizeMapRecursive(path, pathsBySize); err != nil {
-			return nil, err
-		}
-	}
-
-	log.Infof(2, "path by size map has %v sizes", len(pathsBySize))
-
-	return pathsBySize, nil
-}
-
-func buildPathBySizeMapRecursive(path string, pathBySizeMap map[int64][]string) error {
-	absPath, err := filepath.Abs(path)
-	if err != nil {
-		return fmt.Errorf("%v: could not get absolute path", path)
-	}
-
-	stat, err := os.Stat(absPath)
-	if err != nil {
-		switch {
-		case os.IsPermission(err):
-			log.Warnf("%v: permission denied", path)
-		default:
-			return err
-		}
-	}
-
-	if stat.IsDir() {
-		log.Infof(3, "%v: examining directory contents", absPath)
-
-		dir, err := os.Open(absPath)
-		if err != nil {
-			return fmt.Errorf("%v: could not open directory: %v", path, err)
-		}
-
-		names, err := dir.Readdirnames(0)
-		dir.Close()
-		if err != nil {
-			return fmt.Errorf("%v: could not read directory entries: %v", path, err)
-		}
-
-		for _, name := range names {
-			childPath := filepath.Join(path, name)
-			if err := buildPathBySizeMapRecursive(childPath, pathBySizeMap); err != nil {
-				return err
-			}
-		}
-	} else {
-		log.Infof(3, "%v: file is of size %v", absPath, stat.Size())
-
-		filesOfSize, ok := pathBySizeMap[stat.Size()]
-		if ok {
-			pathBySizeMap[stat.Size()] = append(filesOfSize, absPath)
-		} else {
-			pathBySizeMap[stat.Size()] = []string{absPath}
-		}
-	}
-
-	return nil
 }
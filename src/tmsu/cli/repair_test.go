@@ -128,6 +128,85 @@ func TestRepairModifiedFile(test *testing.T) {
 	}
 }
 
+func TestRepairReplacedFile(test *testing.T) {
+	// set-up
+
+	databasePath := testDatabase()
+	defer os.Remove(databasePath)
+
+	err := redirectStreams()
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer restoreStreams()
+
+	store, err := storage.OpenAt(databasePath)
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer store.Close()
+
+	if err := createFile("/tmp/tmsu/a", "hello"); err != nil {
+		test.Fatal(err)
+	}
+	defer os.Remove("/tmp/tmsu/a")
+
+	if err := TagCommand.Exec(store, Options{}, []string{"/tmp/tmsu/a", "tag"}); err != nil {
+		test.Fatal(err)
+	}
+
+	stat, err := os.Stat("/tmp/tmsu/a")
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	// save as an editor would, with the same size and modification time
+	if err := createFile("/tmp/tmsu/a.tmp", "world"); err != nil {
+		test.Fatal(err)
+	}
+	if err := os.Chtimes("/tmp/tmsu/a.tmp", stat.ModTime(), stat.ModTime()); err != nil {
+		test.Fatal(err)
+	}
+	if err := os.Rename("/tmp/tmsu/a.tmp", "/tmp/tmsu/a"); err != nil {
+		test.Fatal(err)
+	}
+
+	// test
+
+	if err := RepairCommand.Exec(store, Options{}, []string{"/tmp/tmsu"}); err != nil {
+		test.Fatal(err)
+	}
+
+	// validate
+
+	outFile.Seek(0, 0)
+
+	bytes, err := ioutil.ReadAll(outFile)
+	compareOutput(test, "/tmp/tmsu/a: replaced: updated fingerprint\n", string(bytes))
+
+	tx, err := store.Begin()
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer tx.Commit()
+
+	file, err := store.FileByPath(tx, "/tmp/tmsu/a")
+	if err != nil {
+		test.Fatal(err)
+	}
+	if file == nil {
+		test.Fatal("Replaced file was not re-bound.")
+	}
+
+	replacement, err := store.Fingerprint(tx, "/tmp/tmsu/a", "SHA256", "none")
+	if err != nil {
+		test.Fatal(err)
+	}
+	if file.Fingerprint != replacement {
+		test.Fatalf("Expected fingerprint '%v' but was '%v'.", replacement, file.Fingerprint)
+	}
+}
+
 func TestReportsMissingFiles(test *testing.T) {
 	// set-up
 
@@ -171,3 +250,325 @@ func TestReportsMissingFiles(test *testing.T) {
 	bytes, err := ioutil.ReadAll(outFile)
 	compareOutput(test, "/tmp/tmsu/a: missing\n", string(bytes))
 }
+
+func TestManualRepairDirectory(test *testing.T) {
+	// set-up
+
+	databasePath := testDatabase()
+	defer os.Remove(databasePath)
+
+	err := redirectStreams()
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer restoreStreams()
+
+	store, err := storage.OpenAt(databasePath)
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer store.Close()
+
+	if err := createFile("/tmp/tmsu/old/a", "hello"); err != nil {
+		test.Fatal(err)
+	}
+	defer os.RemoveAll("/tmp/tmsu/old")
+
+	if err := TagCommand.Exec(store, Options{}, []string{"/tmp/tmsu/old/a", "tag"}); err != nil {
+		test.Fatal(err)
+	}
+
+	if err := os.Rename("/tmp/tmsu/old", "/tmp/tmsu/new"); err != nil {
+		test.Fatal(err)
+	}
+	defer os.RemoveAll("/tmp/tmsu/new")
+
+	if err := createFile("/tmp/tmsu/new/a", "banana"); err != nil {
+		test.Fatal(err)
+	}
+
+	// test
+
+	options := Options{Option{"--manual", "-m", "", false, ""}, Option{"--unmodified", "-u", "", false, ""}}
+	if err := RepairCommand.Exec(store, options, []string{"/tmp/tmsu/old", "/tmp/tmsu/new"}); err != nil {
+		test.Fatal(err)
+	}
+
+	// validate
+
+	outFile.Seek(0, 0)
+
+	bytes, err := ioutil.ReadAll(outFile)
+	compareOutput(test, "/tmp/tmsu/old/a: updated path to /tmp/tmsu/new/a\n", string(bytes))
+
+	tx, err := store.Begin()
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer tx.Commit()
+
+	files, err := store.Files(tx, "")
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	if len(files) != 1 {
+		test.Fatalf("Expected one file but are %v", len(files))
+	}
+
+	if files[0].Path() != "/tmp/tmsu/new/a" {
+		test.Fatalf("File was not relocated.")
+	}
+
+	if files[0].Size != 6 {
+		test.Fatalf("File details were not updated.")
+	}
+}
+
+func TestPrefixRepair(test *testing.T) {
+	// set-up
+
+	databasePath := testDatabase()
+	defer os.Remove(databasePath)
+
+	store, err := storage.OpenAt(databasePath)
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer store.Close()
+
+	if err := createFile("/tmp/tmsu/mount/a", "hello"); err != nil {
+		test.Fatal(err)
+	}
+	if err := createFile("/tmp/tmsu/mount/sub/b", "banana"); err != nil {
+		test.Fatal(err)
+	}
+	if err := createFile("/tmp/tmsu/mountain", "peak"); err != nil {
+		test.Fatal(err)
+	}
+	defer os.RemoveAll("/tmp/tmsu/mount")
+	defer os.Remove("/tmp/tmsu/mountain")
+
+	paths := []string{"/tmp/tmsu/mount/a", "/tmp/tmsu/mount/sub/b", "/tmp/tmsu/mountain"}
+	if err := TagCommand.Exec(store, Options{Option{"--tags", "-t", "", true, "tag"}}, paths); err != nil {
+		test.Fatal(err)
+	}
+
+	if err := os.Rename("/tmp/tmsu/mount", "/tmp/tmsu/remount"); err != nil {
+		test.Fatal(err)
+	}
+	defer os.RemoveAll("/tmp/tmsu/remount")
+
+	// test
+
+	options := Options{Option{"--prefix", "", "", false, ""}}
+	if err := RepairCommand.Exec(store, options, []string{"/tmp/tmsu/mount", "/tmp/tmsu/remount"}); err != nil {
+		test.Fatal(err)
+	}
+
+	// validate
+
+	tx, err := store.Begin()
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer tx.Commit()
+
+	files, err := store.Files(tx, "id")
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	if len(files) != 3 {
+		test.Fatalf("Expected three files but are %v", len(files))
+	}
+
+	expectedPaths := []string{"/tmp/tmsu/remount/a", "/tmp/tmsu/remount/sub/b", "/tmp/tmsu/mountain"}
+	for index, file := range files {
+		if file.Path() != expectedPaths[index] {
+			test.Fatalf("Expected path '%v' but was '%v'.", expectedPaths[index], file.Path())
+		}
+	}
+}
+
+func TestRepairUnmodifiedBypassesFingerprintCache(test *testing.T) {
+	// set-up
+
+	databasePath := testDatabase()
+	defer os.Remove(databasePath)
+
+	store, err := storage.OpenAt(databasePath)
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer store.Close()
+
+	if err := createFile("/tmp/tmsu/a", "hello"); err != nil {
+		test.Fatal(err)
+	}
+	defer os.Remove("/tmp/tmsu/a")
+
+	if err := TagCommand.Exec(store, Options{}, []string{"/tmp/tmsu/a", "apple"}); err != nil {
+		test.Fatal(err)
+	}
+
+	stat, err := os.Stat("/tmp/tmsu/a")
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	// same size and modification time so the cached fingerprint is stale
+	if err := createFile("/tmp/tmsu/a", "world"); err != nil {
+		test.Fatal(err)
+	}
+	if err := os.Chtimes("/tmp/tmsu/a", stat.ModTime(), stat.ModTime()); err != nil {
+		test.Fatal(err)
+	}
+
+	tx, err := store.Begin()
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	file, err := store.FileByPath(tx, "/tmp/tmsu/a")
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	cached, err := store.Fingerprint(tx, "/tmp/tmsu/a", "dynamic:SHA256", "none")
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	tx.Commit()
+
+	if cached != file.Fingerprint {
+		test.Fatalf("Expected cached fingerprint '%v' but was '%v'.", file.Fingerprint, cached)
+	}
+
+	// test
+
+	if err := RepairCommand.Exec(store, Options{Option{"--unmodified", "-u", "", false, ""}}, []string{}); err != nil {
+		test.Fatal(err)
+	}
+
+	// validate
+
+	tx, err = store.Begin()
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer tx.Commit()
+
+	file, err = store.FileByPath(tx, "/tmp/tmsu/a")
+	if err != nil {
+		test.Fatal(err)
+	}
+	if file.Fingerprint == cached {
+		test.Fatalf("Expected fingerprint to be recalculated.")
+	}
+
+	fp, err := store.Fingerprint(tx, "/tmp/tmsu/a", "dynamic:SHA256", "none")
+	if err != nil {
+		test.Fatal(err)
+	}
+	if fp != file.Fingerprint {
+		test.Fatalf("Expected cache to hold recalculated fingerprint '%v' but was '%v'.", file.Fingerprint, fp)
+	}
+}
+
+func TestRepairResumeSkipsCheckpointedFiles(test *testing.T) {
+	// set-up
+
+	databasePath := testDatabase()
+	defer os.Remove(databasePath)
+
+	store, err := storage.OpenAt(databasePath)
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer store.Close()
+
+	paths := []string{"/tmp/tmsu/a", "/tmp/tmsu/b"}
+	for _, path := range paths {
+		if err := createFile(path, "hello"); err != nil {
+			test.Fatal(err)
+		}
+		defer os.Remove(path)
+	}
+
+	for _, path := range paths {
+		if err := TagCommand.Exec(store, Options{}, []string{path, "apple"}); err != nil {
+			test.Fatal(err)
+		}
+	}
+
+	// same size and modification time so only --unmodified will fingerprint
+	for _, path := range paths {
+		stat, err := os.Stat(path)
+		if err != nil {
+			test.Fatal(err)
+		}
+		if err := createFile(path, "world"); err != nil {
+			test.Fatal(err)
+		}
+		if err := os.Chtimes(path, stat.ModTime(), stat.ModTime()); err != nil {
+			test.Fatal(err)
+		}
+	}
+
+	tx, err := store.Begin()
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	original, err := store.FileByPath(tx, "/tmp/tmsu/a")
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	if err := store.UpdateCheckpoint(tx, "repair:", "unmodified:/tmp/tmsu/a"); err != nil {
+		test.Fatal(err)
+	}
+
+	tx.Commit()
+
+	// test
+
+	options := Options{Option{"--unmodified", "-u", "", false, ""}, Option{"--resume", "", "", false, ""}}
+	if err := RepairCommand.Exec(store, options, []string{}); err != nil {
+		test.Fatal(err)
+	}
+
+	// validate
+
+	tx, err = store.Begin()
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer tx.Commit()
+
+	fileA, err := store.FileByPath(tx, "/tmp/tmsu/a")
+	if err != nil {
+		test.Fatal(err)
+	}
+	if fileA.Fingerprint != original.Fingerprint {
+		test.Fatalf("Expected checkpointed file not to be fingerprinted again.")
+	}
+
+	fileB, err := store.FileByPath(tx, "/tmp/tmsu/b")
+	if err != nil {
+		test.Fatal(err)
+	}
+	if fileB.Fingerprint == original.Fingerprint {
+		test.Fatalf("Expected file after the checkpoint to be fingerprinted.")
+	}
+
+	position, err := store.Checkpoint(tx, "repair:")
+	if err != nil {
+		test.Fatal(err)
+	}
+	if position != "" {
+		test.Fatalf("Expected checkpoint to be cleared but was '%v'.", position)
+	}
+}
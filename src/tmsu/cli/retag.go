@@ -0,0 +1,187 @@
+// Copyright 2011-2015 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package cli
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"tmsu/common/log"
+	"tmsu/entities"
+	"tmsu/storage"
+)
+
+var RetagCommand = Command{
+	Name:     "retag",
+	Synopsis: "Rename tags by pattern",
+	Usages:   []string{"tmsu retag [OPTION]... --match=PATTERN --replace=REPLACEMENT"},
+	Description: `Renames every tag whose name matches PATTERN, in a single operation, according to REPLACEMENT.
+
+Each '*' in PATTERN matches any run of characters, and each '*' in REPLACEMENT is substituted by the text matched by the corresponding '*' in PATTERN, in order.
+
+No tags are renamed if any new name is that of an existing tag or of another renamed tag. To merge tags use the 'merge' subcommand instead.
+
+With the global --dry-run option, a table of the old and new names, and of the number of files tagged with each, is shown instead.`,
+	Examples: []string{"$ tmsu retag --match 'proj-*' --replace 'project-*'",
+		"$ tmsu --dry-run retag --match '*-photo' --replace 'photo-*'\nOLD         NEW         FILES\ncat-photo   photo-cat   12\ndog-photo   photo-dog   3"},
+	Options: Options{{"--match", "-m", "the pattern of tag names to rename", true, ""},
+		{"--replace", "-r", "the replacement for the names", true, ""}},
+	Exec:     retagExec,
+	Modifies: true,
+}
+
+// unexported
+
+type tagRename struct {
+	tag       *entities.Tag
+	newName   string
+	fileCount uint
+}
+
+func retagExec(store *storage.Storage, options Options, args []string) error {
+	if len(args) > 0 {
+		return fmt.Errorf("too many arguments")
+	}
+	if !options.HasOption("--match") || !options.HasOption("--replace") {
+		return fmt.Errorf("--match and --replace must be specified")
+	}
+
+	match := options.Get("--match").Argument
+	replace := options.Get("--replace").Argument
+
+	tx, err := store.Begin()
+	if err != nil {
+		return err
+	}
+
+	renames, err := planRetag(store, tx, match, replace)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if store.DryRun {
+		tx.Rollback()
+		printRetagPlan(renames)
+		return nil
+	}
+
+	// all of the tags are renamed or, should any rename fail, none are
+	for _, rename := range renames {
+		log.Infof(2, "renaming tag '%v' to '%v'.", rename.tag.Name, rename.newName)
+
+		if _, err := store.RenameTag(tx, rename.tag.Id, rename.newName); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("could not rename tag '%v' to '%v': %v", rename.tag.Name, rename.newName, err)
+		}
+	}
+
+	return tx.Commit()
+}
+
+// Determines the new name of each tag matching the pattern, checking that no
+// two tags would share a name.
+func planRetag(store *storage.Storage, tx *storage.Tx, match, replace string) ([]tagRename, error) {
+	pattern, err := wildcardRegexp(match)
+	if err != nil {
+		return nil, err
+	}
+
+	replacementParts := strings.Split(replace, "*")
+	if len(replacementParts) > pattern.NumSubexp()+1 {
+		return nil, fmt.Errorf("the replacement has more wildcards than the pattern")
+	}
+
+	tags, err := store.Tags(tx)
+	if err != nil {
+		return nil, fmt.Errorf("could not retrieve tags: %v", err)
+	}
+
+	existing := make(map[string]bool, len(tags))
+	for _, tag := range tags {
+		existing[tag.Name] = true
+	}
+
+	renames := make([]tagRename, 0, 10)
+	renamedTo := make(map[string]string)
+	for _, tag := range tags {
+		captures := pattern.FindStringSubmatch(tag.Name)
+		if captures == nil {
+			continue
+		}
+
+		newName := replacementParts[0]
+		for index, part := range replacementParts[1:] {
+			newName += captures[index+1] + part
+		}
+
+		if newName == tag.Name {
+			continue
+		}
+		if existing[newName] {
+			return nil, fmt.Errorf("cannot rename tag '%v' to '%v': tag '%v' already exists", tag.Name, newName, newName)
+		}
+		if other, ok := renamedTo[newName]; ok {
+			return nil, fmt.Errorf("cannot rename both tag '%v' and tag '%v' to '%v'", other, tag.Name, newName)
+		}
+		renamedTo[newName] = tag.Name
+
+		fileCount, err := store.FileTagCountByTagId(tx, tag.Id, true)
+		if err != nil {
+			return nil, fmt.Errorf("could not retrieve file count for tag '%v': %v", tag.Name, err)
+		}
+
+		renames = append(renames, tagRename{tag, newName, fileCount})
+	}
+
+	if len(renames) == 0 {
+		log.Warnf("no tags match '%v'.", match)
+	}
+
+	return renames, nil
+}
+
+// Converts a pattern, in which '*' matches any run of characters, to a regular
+// expression that captures the text each '*' matches.
+func wildcardRegexp(pattern string) (*regexp.Regexp, error) {
+	if pattern == "" {
+		return nil, fmt.Errorf("the pattern must not be empty")
+	}
+
+	parts := strings.Split(pattern, "*")
+	for index, part := range parts {
+		parts[index] = regexp.QuoteMeta(part)
+	}
+
+	return regexp.Compile("^" + strings.Join(parts, "(.*?)") + "$")
+}
+
+func printRetagPlan(renames []tagRename) {
+	oldWidth, newWidth := len("OLD"), len("NEW")
+	for _, rename := range renames {
+		if len(rename.tag.Name) > oldWidth {
+			oldWidth = len(rename.tag.Name)
+		}
+		if len(rename.newName) > newWidth {
+			newWidth = len(rename.newName)
+		}
+	}
+
+	fmt.Printf("%-*v   %-*v   %v\n", oldWidth, "OLD", newWidth, "NEW", "FILES")
+	for _, rename := range renames {
+		fmt.Printf("%-*v   %-*v   %v\n", oldWidth, rename.tag.Name, newWidth, rename.newName, rename.fileCount)
+	}
+}
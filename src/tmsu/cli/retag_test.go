@@ -0,0 +1,129 @@
+// Copyright 2011-2015 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package cli
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+	"tmsu/storage"
+)
+
+func TestRetag(test *testing.T) {
+	// set-up
+
+	databasePath := testDatabase()
+	defer os.Remove(databasePath)
+
+	err := redirectStreams()
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer restoreStreams()
+
+	store, err := storage.OpenAt(databasePath)
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer store.Close()
+
+	if err := createFile("/tmp/tmsu/a", "a"); err != nil {
+		test.Fatal(err)
+	}
+	defer os.Remove("/tmp/tmsu/a")
+
+	if err := TagCommand.Exec(store, Options{}, []string{"/tmp/tmsu/a", "proj-apple", "proj-banana", "cherry"}); err != nil {
+		test.Fatal(err)
+	}
+
+	options := Options{Option{"--match", "-m", "", true, "proj-*"},
+		Option{"--replace", "-r", "", true, "project-*"}}
+
+	// test
+
+	store.DryRun = true
+	if err := RetagCommand.Exec(store, options, []string{}); err != nil {
+		test.Fatal(err)
+	}
+	store.DryRun = false
+
+	if err := RetagCommand.Exec(store, options, []string{}); err != nil {
+		test.Fatal(err)
+	}
+	if err := TagsCommand.Exec(store, Options{}, []string{}); err != nil {
+		test.Fatal(err)
+	}
+
+	// validate
+
+	outFile.Seek(0, 0)
+
+	bytes, err := ioutil.ReadAll(outFile)
+	compareOutput(test, `OLD           NEW              FILES
+proj-apple    project-apple    1
+proj-banana   project-banana   1
+cherry
+project-apple
+project-banana
+`, string(bytes))
+}
+
+func TestRetagConflict(test *testing.T) {
+	// set-up
+
+	databasePath := testDatabase()
+	defer os.Remove(databasePath)
+
+	err := redirectStreams()
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer restoreStreams()
+
+	store, err := storage.OpenAt(databasePath)
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer store.Close()
+
+	if err := createFile("/tmp/tmsu/a", "a"); err != nil {
+		test.Fatal(err)
+	}
+	defer os.Remove("/tmp/tmsu/a")
+
+	if err := TagCommand.Exec(store, Options{}, []string{"/tmp/tmsu/a", "old-apple", "old-banana", "new-banana"}); err != nil {
+		test.Fatal(err)
+	}
+
+	options := Options{Option{"--match", "-m", "", true, "old-*"},
+		Option{"--replace", "-r", "", true, "new-*"}}
+
+	// test
+
+	if err := RetagCommand.Exec(store, options, []string{}); err == nil {
+		test.Fatal("Expected conflicting rename to fail.")
+	}
+	if err := TagsCommand.Exec(store, Options{}, []string{}); err != nil {
+		test.Fatal(err)
+	}
+
+	// validate
+
+	outFile.Seek(0, 0)
+
+	bytes, err := ioutil.ReadAll(outFile)
+	compareOutput(test, "new-banana\nold-apple\nold-banana\n", string(bytes))
+}
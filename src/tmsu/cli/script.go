@@ -0,0 +1,160 @@
+// Copyright 2011-2015 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package cli
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"tmsu/common/log"
+	"tmsu/common/text"
+	"tmsu/storage"
+)
+
+var ScriptCommand = Command{
+	Name:     "script",
+	Aliases:  []string{"-"},
+	Synopsis: "Run a sequence of commands as one transaction",
+	Usages:   []string{"tmsu script [FILE]", "tmsu -"},
+	Description: `Runs the commands listed in FILE, one per line, within a single database transaction. The changes are only committed if every command succeeds: should any command fail then none of the changes are made.
+
+If FILE is not specified or is '-' then the commands are read from standard input.
+
+Each line is a command as it would be specified on the command line, without the leading 'tmsu'. Words containing spaces may be quoted. Blank lines and lines starting with '#' are ignored.
+
+The global options tmsu is run with, such as --no-wait, apply to each command unless the command specifies them itself. A query that matches nothing does not fail the script.`,
+	Examples: []string{"$ tmsu script retag.txt",
+		"$ cat retag.txt\ntag song.mp3 music genre=rock\nuntag song.mp3 unsorted\nrename rock rock-music",
+		`$ echo "tag a.txt text" | tmsu -`},
+	Options: Options{},
+	Exec:    scriptExec,
+}
+
+// unexported
+
+var scriptCommands []*Command
+
+func scriptExec(store *storage.Storage, options Options, args []string) error {
+	var reader io.Reader
+	switch {
+	case len(args) > 1:
+		return fmt.Errorf("too many arguments")
+	case len(args) == 0, args[0] == "-":
+		reader = os.Stdin
+	default:
+		file, err := os.Open(args[0])
+		if err != nil {
+			return fmt.Errorf("%v: could not open script: %v", args[0], err)
+		}
+		defer file.Close()
+
+		reader = file
+	}
+
+	tx, err := store.BeginBatch()
+	if err != nil {
+		return err
+	}
+
+	if err := runScript(store, reader, options); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func runScript(store *storage.Storage, reader io.Reader, scriptOptions Options) error {
+	parser := NewOptionParser(globalOptions, scriptCommands)
+	scanner := bufio.NewScanner(reader)
+
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || line[0] == '#' {
+			continue
+		}
+
+		command, options, arguments, err := parser.Parse(text.Tokenize(line)...)
+		if err != nil {
+			return fmt.Errorf("line %v: %v", lineNumber, err)
+		}
+		if command == nil {
+			return fmt.Errorf("line %v: no such command", lineNumber)
+		}
+		if command.Name == "script" {
+			return fmt.Errorf("line %v: scripts cannot be nested", lineNumber)
+		}
+		if options.HasOption("--database") || options.HasOption("--all-databases") {
+			return fmt.Errorf("line %v: the database cannot be changed within a script", lineNumber)
+		}
+
+		log.Infof(2, "line %v: %v", lineNumber, line)
+
+		options = withGlobalOptions(options, scriptOptions)
+
+		store.Command = line
+		err = processCommand(store, command, options, arguments)
+		if err == errNothingMatched && !modifies(command, options, arguments) {
+			// a query matching nothing is not a failure of the script
+			continue
+		}
+		if err != nil {
+			return scriptLineError(lineNumber, err)
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("could not read script: %v", err)
+	}
+
+	return nil
+}
+
+// Adds the global options the script was run with, such as --no-wait, to
+// those of a line of the script unless the line specifies them itself.
+func withGlobalOptions(options, scriptOptions Options) Options {
+	lineOptions := options
+
+	for _, option := range scriptOptions {
+		if globalOptions.HasOption(option.LongName) && !lineOptions.HasOption(option.LongName) {
+			options = append(options, option)
+		}
+	}
+
+	return options
+}
+
+// Qualifies the error from a script line with the line number, retaining its
+// exit status.
+func scriptLineError(lineNumber int, err error) error {
+	exitErr, ok := err.(exitError)
+	if !ok {
+		return fmt.Errorf("line %v: %v", lineNumber, err)
+	}
+
+	if exitErr.message == "" {
+		exitErr.message = fmt.Sprintf("line %v: command failed", lineNumber)
+	} else {
+		exitErr.message = fmt.Sprintf("line %v: %v", lineNumber, exitErr.message)
+	}
+
+	return exitErr
+}
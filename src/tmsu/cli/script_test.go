@@ -0,0 +1,256 @@
+// Copyright 2011-2015 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package cli
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"tmsu/storage"
+)
+
+func TestScriptCommitsAllCommands(test *testing.T) {
+	// set-up
+
+	databasePath := testDatabase()
+	defer os.Remove(databasePath)
+
+	store, err := storage.OpenAt(databasePath)
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer store.Close()
+
+	if err := createFile("/tmp/tmsu/a", "hello"); err != nil {
+		test.Fatal(err)
+	}
+	defer os.Remove("/tmp/tmsu/a")
+
+	scriptPath := filepath.Join(os.TempDir(), "tmsu_test_script")
+	if err := createFile(scriptPath, "tag /tmp/tmsu/a apple\n# comment\n\ntag /tmp/tmsu/a banana\n"); err != nil {
+		test.Fatal(err)
+	}
+	defer os.Remove(scriptPath)
+
+	scriptCommands = commands
+
+	// test
+
+	if err := ScriptCommand.Exec(store, Options{}, []string{scriptPath}); err != nil {
+		test.Fatal(err)
+	}
+
+	// validate
+
+	tx, err := store.Begin()
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer tx.Commit()
+
+	file, err := store.FileByPath(tx, "/tmp/tmsu/a")
+	if err != nil {
+		test.Fatal(err)
+	}
+	if file == nil {
+		test.Fatalf("File was not added.")
+	}
+
+	apple, err := store.TagByName(tx, "apple")
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	banana, err := store.TagByName(tx, "banana")
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	expectTags(test, store, tx, file, apple, banana)
+}
+
+func TestScriptRollsBackOnFailure(test *testing.T) {
+	// set-up
+
+	databasePath := testDatabase()
+	defer os.Remove(databasePath)
+
+	store, err := storage.OpenAt(databasePath)
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer store.Close()
+
+	if err := createFile("/tmp/tmsu/a", "hello"); err != nil {
+		test.Fatal(err)
+	}
+	defer os.Remove("/tmp/tmsu/a")
+
+	scriptPath := filepath.Join(os.TempDir(), "tmsu_test_script")
+	if err := createFile(scriptPath, "tag /tmp/tmsu/a apple\ndelete banana\n"); err != nil {
+		test.Fatal(err)
+	}
+	defer os.Remove(scriptPath)
+
+	scriptCommands = commands
+
+	// test
+
+	if err := ScriptCommand.Exec(store, Options{}, []string{scriptPath}); err == nil {
+		test.Fatalf("Expected script to fail.")
+	}
+
+	// validate
+
+	tx, err := store.Begin()
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer tx.Commit()
+
+	files, err := store.Files(tx, "")
+	if err != nil {
+		test.Fatal(err)
+	}
+	if len(files) != 0 {
+		test.Fatalf("Expected no files but are %v", len(files))
+	}
+
+	tags, err := store.Tags(tx)
+	if err != nil {
+		test.Fatal(err)
+	}
+	if len(tags) != 0 {
+		test.Fatalf("Expected no tags but are %v", len(tags))
+	}
+}
+
+func TestScriptAppliesGlobalOptions(test *testing.T) {
+	// set-up
+
+	databasePath := testDatabase()
+	defer os.Remove(databasePath)
+	defer os.Remove(databasePath + ".lock")
+
+	store, err := storage.OpenAt(databasePath)
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer store.Close()
+
+	if err := createFile("/tmp/tmsu/a", "hello"); err != nil {
+		test.Fatal(err)
+	}
+	defer os.Remove("/tmp/tmsu/a")
+
+	scriptPath := filepath.Join(os.TempDir(), "tmsu_test_script")
+	if err := createFile(scriptPath, "tag /tmp/tmsu/a apple\n"); err != nil {
+		test.Fatal(err)
+	}
+	defer os.Remove(scriptPath)
+
+	scriptCommands = commands
+
+	// another process's
+	other, err := storage.OpenAt(databasePath)
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer other.Close()
+
+	lock, err := other.LockForWriting("tmsu repair", true, nil)
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer lock.Release()
+
+	// test
+
+	err = processCommand(store, &ScriptCommand, Options{Option{"--no-wait", "", "", false, ""}}, []string{scriptPath})
+
+	// validate
+
+	if err == nil || !strings.Contains(err.Error(), "locked by tmsu repair") {
+		test.Fatalf("Expected the script to fail as the database is locked but was %v.", err)
+	}
+}
+
+func TestScriptQueryMatchingNothing(test *testing.T) {
+	// set-up
+
+	databasePath := testDatabase()
+	defer os.Remove(databasePath)
+
+	err := redirectStreams()
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer restoreStreams()
+
+	store, err := storage.OpenAt(databasePath)
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer store.Close()
+
+	if err := createFile("/tmp/tmsu/a", "hello"); err != nil {
+		test.Fatal(err)
+	}
+	defer os.Remove("/tmp/tmsu/a")
+
+	scriptPath := filepath.Join(os.TempDir(), "tmsu_test_script")
+	if err := createFile(scriptPath, "tag /tmp/tmsu/a apple\nfiles not apple\ntag /tmp/tmsu/a banana\n"); err != nil {
+		test.Fatal(err)
+	}
+	defer os.Remove(scriptPath)
+
+	scriptCommands = commands
+
+	// test
+
+	if err := ScriptCommand.Exec(store, Options{}, []string{scriptPath}); err != nil {
+		test.Fatal(err)
+	}
+
+	// validate
+
+	tx, err := store.Begin()
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer tx.Commit()
+
+	file, err := store.FileByPath(tx, "/tmp/tmsu/a")
+	if err != nil {
+		test.Fatal(err)
+	}
+	if file == nil {
+		test.Fatalf("File was not added.")
+	}
+
+	apple, err := store.TagByName(tx, "apple")
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	banana, err := store.TagByName(tx, "banana")
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	expectTags(test, store, tx, file, apple, banana)
+}
@@ -0,0 +1,118 @@
+// Copyright 2011-2015 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+// +build !windows
+
+package cli
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+	"tmsu/api"
+	"tmsu/server"
+	"tmsu/storage"
+)
+
+var ServeCommand = Command{
+	Name:     "serve",
+	Synopsis: "Serve requests over a Unix socket",
+	Usages: []string{"tmsu serve [OPTION]... --socket PATH",
+		"tmsu serve [OPTION]... --query-socket PATH",
+		"tmsu serve --stdio"},
+	Description: `Listens on the Unix socket at PATH for JSON-RPC requests to tag, untag and query files. This allows long-lived clients, such as file manager plugins and editors, to avoid starting a process and opening the database for every operation.
+
+The service is named 'Tmsu' and provides the methods 'Tag', 'Untag', 'Query', 'FileTags' and 'Tags', along with 'DatabaseId', 'Changes' and 'Apply' which are used by the 'sync' subcommand. Paths in requests must be absolute.
+
+The server shuts down once no request has been received for the idle timeout, which defaults to 10 minutes. A timeout of 0 disables this.
+
+With --stdio, requests are instead read from standard input and responses written to standard output until the input is closed. This is how 'sync' communicates with a database on another machine over ssh.
+
+With --query-socket, the socket at PATH instead accepts only queries, using a minimal protocol intended for desktop search integrations that may query hundreds of times a second. Each request is a line of query text and the response is the absolute path of each matching file followed by a NUL character, in no particular order, and then a further NUL. Should the query fail the response is instead 'error: ' and the message followed by two NULs. Any number of queries may be sent on a connection.`,
+	Examples: []string{"$ tmsu serve --socket /tmp/tmsu.sock",
+		"$ tmsu serve --socket /tmp/tmsu.sock --timeout 1h",
+		`$ echo '{"method": "Tmsu.Query", "params": [{"Query": "music"}], "id": 1}' | nc -U /tmp/tmsu.sock
+{"id":1,"result":["/home/bob/song.mp3"],"error":null}`,
+		"$ tmsu serve --query-socket /tmp/tmsu-query.sock",
+		`$ echo 'music and not mp3' | nc -U /tmp/tmsu-query.sock | tr '\0' '\n'
+/home/bob/song.flac`},
+	Options: Options{{"--socket", "-s", "the path of the socket to listen on", true, ""},
+		{"--timeout", "-t", "shut down after this long without a request, e.g. 30s or 1h (default 10m)", true, ""},
+		{"--query-socket", "", "the path of the socket to listen on for queries alone", true, ""},
+		{"--stdio", "", "serve requests on standard input and output", false, ""}},
+	Exec: serveExec,
+}
+
+func serveExec(store *storage.Storage, options Options, args []string) error {
+	if len(args) > 0 {
+		return fmt.Errorf("too many arguments")
+	}
+
+	if options.HasOption("--stdio") {
+		if options.HasOption("--socket") || options.HasOption("--query-socket") {
+			return fmt.Errorf("--stdio cannot be combined with a socket")
+		}
+
+		return server.ServeConn(api.New(store), stdioConn{})
+	}
+
+	socketOption := "--socket"
+	switch {
+	case options.HasOption("--socket") && options.HasOption("--query-socket"):
+		return fmt.Errorf("--socket and --query-socket cannot be combined")
+	case options.HasOption("--query-socket"):
+		socketOption = "--query-socket"
+	case !options.HasOption("--socket"):
+		return fmt.Errorf("socket path must be specified")
+	}
+
+	socketPath, err := filepath.Abs(options.Get(socketOption).Argument)
+	if err != nil {
+		return fmt.Errorf("could not get absolute path: %v", err)
+	}
+
+	timeout := 10 * time.Minute
+	if options.HasOption("--timeout") {
+		text := options.Get("--timeout").Argument
+		timeout, err = time.ParseDuration(text)
+		if err != nil || timeout < 0 {
+			return fmt.Errorf("invalid timeout '%v'", text)
+		}
+	}
+
+	if socketOption == "--query-socket" {
+		return server.ServeQueries(api.New(store), socketPath, timeout)
+	}
+
+	return server.Serve(api.New(store), socketPath, timeout)
+}
+
+// unexported
+
+// Standard input and output as a connection.
+type stdioConn struct{}
+
+func (stdioConn) Read(bytes []byte) (int, error) {
+	return os.Stdin.Read(bytes)
+}
+
+func (stdioConn) Write(bytes []byte) (int, error) {
+	return os.Stdout.Write(bytes)
+}
+
+func (stdioConn) Close() error {
+	return os.Stdout.Close()
+}
@@ -0,0 +1,278 @@
+// Copyright 2011-2015 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package cli
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"tmsu/api"
+	"tmsu/common/fingerprint"
+	"tmsu/common/log"
+	"tmsu/entities"
+	"tmsu/storage"
+)
+
+const defaultImageDistance = 10
+
+// A means of identifying files that are alike without being identical.
+type likeness interface {
+	// Whether files at the path may be compared, e.g. by its extension.
+	candidate(path string) bool
+
+	// The hash of a file in the database.
+	fileHash(store *storage.Storage, tx *storage.Tx, file *entities.File) (fingerprint.Fingerprint, error)
+
+	// The hash of a file that may not be in the database.
+	pathHash(store *storage.Storage, tx *storage.Tx, path string) (fingerprint.Fingerprint, error)
+
+	// Whether the files with the specified hashes are alike.
+	alike(hash, otherHash fingerprint.Fingerprint) (bool, error)
+}
+
+// The files in the database that may be compared and their hashes, loaded
+// when first required.
+type similarFiles struct {
+	likeness     likeness
+	description  string // the files in each set, e.g. 'duplicates'
+	excludeExact bool   // omit sets whose files are all exact duplicates
+	files        entities.Files
+	hashes       map[entities.FileId]fingerprint.Fingerprint
+}
+
+// Identifies the images in the database that look alike.
+func newSimilarImages(distance int) *similarFiles {
+	return &similarFiles{likeness: imageLikeness{distance}, description: "duplicates"}
+}
+
+// Identifies the recordings in the database that sound alike, other than those
+// that are exact duplicates.
+func newSimilarAudio(fingerprinter api.AudioFingerprinter) *similarFiles {
+	return &similarFiles{likeness: audioLikeness{fingerprinter}, description: "similar recordings", excludeExact: true}
+}
+
+// Identifies the sets of similar files in the database: each file in a set is
+// similar to at least one other.
+func (similar *similarFiles) sets(store *storage.Storage, tx *storage.Tx) ([]entities.Files, error) {
+	if err := similar.load(store, tx); err != nil {
+		return nil, err
+	}
+
+	// the index of the first file of the set each file belongs to
+	setIndices := make([]int, len(similar.files))
+	for index := range setIndices {
+		setIndices[index] = index
+	}
+
+	root := func(index int) int {
+		for setIndices[index] != index {
+			index = setIndices[index]
+		}
+
+		return index
+	}
+
+	for index, file := range similar.files {
+		for otherIndex := index + 1; otherIndex < len(similar.files); otherIndex++ {
+			alike, err := similar.likeness.alike(similar.hashes[file.Id], similar.hashes[similar.files[otherIndex].Id])
+			if err != nil {
+				return nil, err
+			}
+			if !alike {
+				continue
+			}
+
+			first, other := root(index), root(otherIndex)
+			if first > other {
+				first, other = other, first
+			}
+			setIndices[other] = first
+		}
+	}
+
+	membersByRoot := make(map[int]entities.Files)
+	roots := make([]int, 0, 10)
+	for index, file := range similar.files {
+		root := root(index)
+		if _, ok := membersByRoot[root]; !ok {
+			roots = append(roots, root)
+		}
+		membersByRoot[root] = append(membersByRoot[root], file)
+	}
+
+	fileSets := make([]entities.Files, 0, len(roots))
+	for _, root := range roots {
+		members := membersByRoot[root]
+		if len(members) < 2 || similar.excludeExact && exactDuplicates(members) {
+			continue
+		}
+
+		fileSets = append(fileSets, members)
+	}
+
+	return fileSets, nil
+}
+
+// Identifies the files in the database that are similar to the file at the
+// path.
+func (similar *similarFiles) of(store *storage.Storage, tx *storage.Tx, path string) (entities.Files, error) {
+	if err := similar.load(store, tx); err != nil {
+		return nil, err
+	}
+
+	if !similar.likeness.candidate(path) {
+		return entities.Files{}, nil
+	}
+
+	hash, err := similar.likeness.pathHash(store, tx, path)
+	if err != nil {
+		return nil, fmt.Errorf("%v: could not create fingerprint: %v", path, err)
+	}
+	if hash == fingerprint.Empty {
+		return entities.Files{}, nil
+	}
+
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return nil, fmt.Errorf("%v: could not determine absolute path: %v", path, err)
+	}
+
+	matches := make(entities.Files, 0, 10)
+	for _, file := range similar.files {
+		if file.Path() == absPath {
+			continue
+		}
+
+		alike, err := similar.likeness.alike(hash, similar.hashes[file.Id])
+		if err != nil {
+			return nil, err
+		}
+		if alike {
+			matches = append(matches, file)
+		}
+	}
+
+	return matches, nil
+}
+
+func (similar *similarFiles) load(store *storage.Storage, tx *storage.Tx) error {
+	if similar.hashes != nil {
+		return nil
+	}
+
+	log.Infof(2, "fingerprinting candidate %v.", similar.description)
+
+	files, err := store.Files(tx, "name")
+	if err != nil {
+		return fmt.Errorf("could not retrieve files: %v", err)
+	}
+
+	similar.files = make(entities.Files, 0, len(files))
+	similar.hashes = make(map[entities.FileId]fingerprint.Fingerprint, len(files))
+
+	for _, file := range files {
+		if file.IsDir || !similar.likeness.candidate(file.Path()) {
+			continue
+		}
+
+		hash, err := similar.likeness.fileHash(store, tx, file)
+		if err != nil {
+			return fmt.Errorf("%v: could not create fingerprint: %v", file.Path(), err)
+		}
+		if hash == fingerprint.Empty {
+			continue
+		}
+
+		similar.files = append(similar.files, file)
+		similar.hashes[file.Id] = hash
+	}
+
+	return nil
+}
+
+// Whether the files all have the same fingerprint.
+func exactDuplicates(files entities.Files) bool {
+	for _, file := range files[1:] {
+		if file.Fingerprint == fingerprint.Empty || file.Fingerprint != files[0].Fingerprint {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Images that look alike: their perceptual hashes differ by no more than the
+// distance.
+type imageLikeness struct {
+	distance int
+}
+
+func (likeness imageLikeness) candidate(path string) bool {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".gif", ".jpeg", ".jpg", ".png":
+		return true
+	}
+
+	return false
+}
+
+func (likeness imageLikeness) fileHash(store *storage.Storage, tx *storage.Tx, file *entities.File) (fingerprint.Fingerprint, error) {
+	return store.FileFingerprint(tx, file, fingerprint.DifferenceHash)
+}
+
+func (likeness imageLikeness) pathHash(store *storage.Storage, tx *storage.Tx, path string) (fingerprint.Fingerprint, error) {
+	return store.Fingerprint(tx, path, fingerprint.DifferenceHash, "none")
+}
+
+func (likeness imageLikeness) alike(hash, otherHash fingerprint.Fingerprint) (bool, error) {
+	distance, err := fingerprint.Distance(hash, otherHash)
+	if err != nil {
+		return false, err
+	}
+
+	return distance <= likeness.distance, nil
+}
+
+// Recordings that sound alike: their acoustic fingerprints largely match.
+type audioLikeness struct {
+	fingerprinter api.AudioFingerprinter
+}
+
+func (likeness audioLikeness) candidate(path string) bool {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".aac", ".aif", ".aiff", ".ape", ".flac", ".m4a", ".mp3", ".mpc", ".oga", ".ogg", ".opus", ".wav", ".wma", ".wv":
+		return true
+	}
+
+	return false
+}
+
+func (likeness audioLikeness) fileHash(store *storage.Storage, tx *storage.Tx, file *entities.File) (fingerprint.Fingerprint, error) {
+	return api.AudioFileFingerprint(store, tx, likeness.fingerprinter, file)
+}
+
+func (likeness audioLikeness) pathHash(store *storage.Storage, tx *storage.Tx, path string) (fingerprint.Fingerprint, error) {
+	return likeness.fingerprinter.Fingerprint(path)
+}
+
+func (likeness audioLikeness) alike(hash, otherHash fingerprint.Fingerprint) (bool, error) {
+	similarity, err := api.AudioSimilarity(hash, otherHash)
+	if err != nil {
+		return false, err
+	}
+
+	return similarity >= api.AcousticSimilarityThreshold, nil
+}
@@ -0,0 +1,168 @@
+// Copyright 2011-2015 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"tmsu/api"
+	_path "tmsu/common/path"
+	"tmsu/common/terminal/ansi"
+	"tmsu/storage"
+)
+
+var StatsCommand = Command{
+	Name:     "stats",
+	Synopsis: "Show tag statistics",
+	Usages:   []string{"tmsu stats [OPTION]..."},
+	Description: `Shows statistics on how tags are used: the most used tags, the pairs of tags most often applied together, a histogram of the number of files each tag is applied to, the proportion of untagged entries in each directory holding tagged files and the number of taggings made each month.
+
+The statistics can be emitted as JSON, for consumption by other programs, using --format=json.`,
+	Examples: []string{"$ tmsu stats",
+		"$ tmsu stats --top=5",
+		"$ tmsu stats --format=json >stats.json"},
+	Options: Options{Option{"--top", "-n", "the number of tags, pairs and directories to list (default 10)", true, ""},
+		Option{"--format", "-f", "output format: text, json", true, ""}},
+	Exec: statsExec,
+}
+
+// unexported
+
+func statsExec(store *storage.Storage, options Options, args []string) error {
+	top := 10
+	if options.HasOption("--top") {
+		value, err := strconv.ParseUint(options.Get("--top").Argument, 10, 0)
+		if err != nil {
+			return fmt.Errorf("invalid number '%v'", options.Get("--top").Argument)
+		}
+
+		top = int(value)
+	}
+
+	format := "text"
+	if options.HasOption("--format") {
+		format = options.Get("--format").Argument
+	}
+
+	colour, err := useColour(options)
+	if err != nil {
+		return err
+	}
+
+	tx, err := store.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Commit()
+
+	stats, err := api.Stats(store, tx, top)
+	if err != nil {
+		return err
+	}
+
+	switch format {
+	case "text":
+		printStats(stats, colour)
+	case "json":
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(stats); err != nil {
+			return fmt.Errorf("could not encode statistics: %v", err)
+		}
+	default:
+		return fmt.Errorf("invalid format '%v': must be one of text, json", format)
+	}
+
+	return nil
+}
+
+func printStats(stats *api.Statistics, colour bool) {
+	printInfo("Files", stats.Files, colour)
+	printInfo("Tags", stats.Tags, colour)
+	printInfo("Taggings", stats.Taggings, colour)
+
+	printStatsHeading("Most used tags", colour)
+	for _, tagStat := range stats.TopTags {
+		fmt.Printf("  %v %v\n", formatStatsCount(stats.Files, tagStat.Files, colour), tagStat.Name)
+	}
+
+	printStatsHeading("Tags most often applied together", colour)
+	for _, pairStat := range stats.TopPairs {
+		fmt.Printf("  %v %v %v\n", formatStatsCount(stats.Files, pairStat.Files, colour), pairStat.Tags[0], pairStat.Tags[1])
+	}
+
+	printStatsHeading("Tags by number of files", colour)
+	for _, bucket := range stats.Histogram {
+		var files string
+		if bucket.Min == bucket.Max {
+			files = strconv.FormatUint(uint64(bucket.Min), 10)
+		} else {
+			files = fmt.Sprintf("%v-%v", bucket.Min, bucket.Max)
+		}
+
+		fmt.Printf("  %*v files: %v\n", histogramLabelWidth(stats.Histogram), files, formatStatsCount(stats.Tags, bucket.Tags, colour))
+	}
+
+	printStatsHeading("Untagged entries by directory", colour)
+	for _, coverage := range stats.Directories {
+		ratio := fmt.Sprintf("%3.0f%%", coverage.Ratio*100)
+		if colour {
+			ratio = ansi.Yellow(ratio)
+		}
+
+		fmt.Printf("  %v %v (%v of %v)\n", ratio, _path.Rel(coverage.Path), coverage.Untagged, coverage.Entries)
+	}
+
+	printStatsHeading("Taggings by month", colour)
+	for _, period := range stats.Growth {
+		fmt.Printf("  %v %v (total %v)\n", period.Month, formatStatsCount(stats.Taggings, period.Taggings, colour), period.Total)
+	}
+}
+
+func printStatsHeading(heading string, colour bool) {
+	if colour {
+		heading = ansi.Bold(heading)
+	}
+
+	fmt.Println()
+	fmt.Println(heading + ":")
+}
+
+// Formats a count right-aligned to the width of the largest possible count.
+func formatStatsCount(max, count uint, colour bool) string {
+	width := len(strconv.FormatUint(uint64(max), 10))
+	text := fmt.Sprintf("%*v", width, count)
+
+	if colour {
+		text = ansi.Yellow(text)
+	}
+
+	return text
+}
+
+func histogramLabelWidth(buckets []api.HistogramBucket) int {
+	width := 0
+	for _, bucket := range buckets {
+		length := len(fmt.Sprintf("%v-%v", bucket.Min, bucket.Max))
+		if length > width {
+			width = length
+		}
+	}
+
+	return width
+}
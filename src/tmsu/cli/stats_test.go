@@ -0,0 +1,96 @@
+// Copyright 2011-2015 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package cli
+
+import (
+	"encoding/json"
+	"os"
+	"testing"
+	"tmsu/api"
+	"tmsu/storage"
+)
+
+func TestStatsJson(test *testing.T) {
+	// set-up
+
+	databasePath := testDatabase()
+	defer os.Remove(databasePath)
+
+	err := redirectStreams()
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer restoreStreams()
+
+	store, err := storage.OpenAt(databasePath)
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer store.Close()
+
+	if err := createFile("/tmp/tmsu/a", "apple"); err != nil {
+		test.Fatal(err)
+	}
+	defer os.Remove("/tmp/tmsu/a")
+
+	if err := createFile("/tmp/tmsu/b", "banana"); err != nil {
+		test.Fatal(err)
+	}
+	defer os.Remove("/tmp/tmsu/b")
+
+	if err := TagCommand.Exec(store, Options{}, []string{"/tmp/tmsu/a", "fruit", "red"}); err != nil {
+		test.Fatal(err)
+	}
+
+	if err := TagCommand.Exec(store, Options{}, []string{"/tmp/tmsu/b", "fruit", "yellow"}); err != nil {
+		test.Fatal(err)
+	}
+
+	// test
+
+	if err := StatsCommand.Exec(store, Options{Option{"--format", "-f", "", true, "json"}}, []string{}); err != nil {
+		test.Fatal(err)
+	}
+
+	// validate
+
+	outFile.Seek(0, 0)
+
+	var stats api.Statistics
+	if err := json.NewDecoder(outFile).Decode(&stats); err != nil {
+		test.Fatal(err)
+	}
+
+	if stats.Files != 2 || stats.Tags != 3 || stats.Taggings != 4 {
+		test.Fatalf("Expected 2 files, 3 tags and 4 taggings but were %v, %v and %v.", stats.Files, stats.Tags, stats.Taggings)
+	}
+
+	if len(stats.TopTags) != 3 || stats.TopTags[0].Name != "fruit" || stats.TopTags[0].Files != 2 {
+		test.Fatalf("Top tags are incorrect: %v", stats.TopTags)
+	}
+
+	if len(stats.TopPairs) != 2 || stats.TopPairs[0].Tags != [2]string{"fruit", "red"} {
+		test.Fatalf("Top tag pairs are incorrect: %v", stats.TopPairs)
+	}
+
+	if len(stats.Histogram) != 2 || stats.Histogram[0].Tags != 2 || stats.Histogram[1].Min != 2 {
+		test.Fatalf("Histogram is incorrect: %v", stats.Histogram)
+	}
+
+	if len(stats.Growth) != 1 || stats.Growth[0].Total != 4 {
+		test.Fatalf("Growth is incorrect: %v", stats.Growth)
+	}
+}
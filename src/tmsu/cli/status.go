@@ -19,9 +19,12 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
 	"tmsu/common/log"
 	"tmsu/common/path"
+	"tmsu/common/terminal"
+	"tmsu/common/terminal/ansi"
 	"tmsu/entities"
 	"tmsu/storage"
 )
@@ -37,16 +40,24 @@ Where PATHs are not specified the status of the database is shown.
   T - Tagged
   M - Modified
   ! - Missing
+  O - Offline
   U - Untagged
 
-Status codes of T, M and ! mean that the file has been tagged (and thus is in the TMSU database). Modified files are those with a different modification time or size to that in the database. Missing files are those in the database but that no longer exist in the file-system.
+Status codes of T, M, ! and O mean that the file has been tagged (and thus is in the TMSU database). Modified files are those with a different modification time or size to that in the database, other than files tracked by path only (see 'tmsu tag --no-fingerprint'). Missing files are those in the database but that no longer exist in the file-system. Virtual files, tagged with 'tmsu tag --force' although they do not exist, are not reported as missing unless --include-virtual is specified. Offline files are those that cannot be found because the removable volume they were tagged on is not currently mounted.
+
+Files are listed grouped by status, in the order above, and by path within each group. The --sort option can instead list them by path alone and the --filter option restricts the listing to the specified comma-separated status codes.
 
 Note: The 'repair' subcommand can be used to fix problems caused by files that have been modified or moved on disk.`,
 	Examples: []string{"$ tmsu status",
 		"$ tmsu status .",
-		"$ tmsu status --directory *"},
-	Options: Options{Option{"--directory", "-d", "do not examine directory contents (non-recursive)", false, ""}},
-	Exec:    statusExec,
+		"$ tmsu status --directory *",
+		"$ tmsu status --filter 'M,!' --sort path ~/photos"},
+	Options: Options{Option{"--directory", "-d", "do not examine directory contents (non-recursive)", false, ""},
+		Option{"--filter", "-f", "list only files with the specified statuses, e.g. M,!", true, ""},
+		Option{"--sort", "-s", "sort output: status, path", true, ""},
+		Option{"--include-virtual", "", "report virtual files that do not exist as missing", false, ""}},
+	Exec:      statusExec,
+	Federated: true,
 }
 
 type Status byte
@@ -56,24 +67,35 @@ const (
 	TAGGED   Status = 'T'
 	MODIFIED Status = 'M'
 	MISSING  Status = '!'
+	OFFLINE  Status = 'O'
 )
 
 type StatusReport struct {
-	Rows []Row
+	Rows  []Row
+	paths map[string]bool
 }
 
 func (report *StatusReport) AddRow(row Row) {
+	if report.paths == nil {
+		report.paths = make(map[string]bool)
+	}
+
 	report.Rows = append(report.Rows, row)
+	report.paths[row.Path] = true
 }
 
-func (report *StatusReport) ContainsRow(path string) bool {
-	for _, row := range report.Rows {
-		if row.Path == path {
-			return true
-		}
+// Records a path that is tracked but not reported, so that it is not
+// reported as untagged either.
+func (report *StatusReport) Exclude(path string) {
+	if report.paths == nil {
+		report.paths = make(map[string]bool)
 	}
 
-	return false
+	report.paths[path] = true
+}
+
+func (report *StatusReport) ContainsRow(path string) bool {
+	return report.paths[path]
 }
 
 type Row struct {
@@ -82,11 +104,32 @@ type Row struct {
 }
 
 func NewReport() *StatusReport {
-	return &StatusReport{make([]Row, 0, 10)}
+	return &StatusReport{make([]Row, 0, 10), make(map[string]bool)}
 }
 
 func statusExec(store *storage.Storage, options Options, args []string) error {
 	dirOnly := options.HasOption("--directory")
+	includeVirtual := options.HasOption("--include-virtual")
+
+	statuses := allStatuses
+	if options.HasOption("--filter") {
+		var err error
+		statuses, err = parseStatuses(options.Get("--filter").Argument)
+		if err != nil {
+			return err
+		}
+	}
+
+	sortBy := "status"
+	if options.HasOption("--sort") {
+		sortBy = options.Get("--sort").Argument
+
+		switch sortBy {
+		case "status", "path":
+		default:
+			return fmt.Errorf("invalid sort '%v': expected 'status' or 'path'", sortBy)
+		}
+	}
 
 	tx, err := store.Begin()
 	if err != nil {
@@ -97,23 +140,23 @@ func statusExec(store *storage.Storage, options Options, args []string) error {
 	var report *StatusReport
 
 	if len(args) == 0 {
-		report, err = statusDatabase(store, tx, dirOnly)
+		report, err = statusDatabase(store, tx, dirOnly, includeVirtual)
 		if err != nil {
 			return err
 		}
 	} else {
-		report, err = statusPaths(store, tx, args, dirOnly)
+		report, err = statusPaths(store, tx, args, dirOnly, includeVirtual)
 		if err != nil {
 			return err
 		}
 	}
 
-	printReport(report)
+	printReport(report, statuses, sortBy)
 
 	return nil
 }
 
-func statusDatabase(store *storage.Storage, tx *storage.Tx, dirOnly bool) (*StatusReport, error) {
+func statusDatabase(store *storage.Storage, tx *storage.Tx, dirOnly, includeVirtual bool) (*StatusReport, error) {
 	report := NewReport()
 
 	log.Info(2, "retrieving all files from database.")
@@ -123,14 +166,16 @@ func statusDatabase(store *storage.Storage, tx *storage.Tx, dirOnly bool) (*Stat
 		return nil, fmt.Errorf("could not retrieve files: %v", err)
 	}
 
-	err = statusCheckFiles(files, report)
+	err = statusCheckFiles(store, tx, files, report, includeVirtual)
 	if err != nil {
 		return nil, err
 	}
 
 	tree := path.NewTree()
 	for _, file := range files {
-		tree.Add(file.Path(), file.IsDir)
+		if !path.IsURL(file.Path()) {
+			tree.Add(file.Path(), file.IsDir)
+		}
 	}
 
 	topLevelPaths := tree.TopLevel().Paths()
@@ -139,7 +184,7 @@ func statusDatabase(store *storage.Storage, tx *storage.Tx, dirOnly bool) (*Stat
 	}
 
 	for _, path := range topLevelPaths {
-		if err = findNewFiles(path, report, dirOnly); err != nil {
+		if err = findNewFiles(store, path, report, dirOnly); err != nil {
 			return nil, err
 		}
 	}
@@ -147,21 +192,35 @@ func statusDatabase(store *storage.Storage, tx *storage.Tx, dirOnly bool) (*Stat
 	return report, nil
 }
 
-func statusPaths(store *storage.Storage, tx *storage.Tx, paths []string, dirOnly bool) (*StatusReport, error) {
+func statusPaths(store *storage.Storage, tx *storage.Tx, paths []string, dirOnly, includeVirtual bool) (*StatusReport, error) {
 	report := NewReport()
 
-	for _, path := range paths {
+	absPaths := make([]string, len(paths))
+	for index, path := range paths {
 		absPath, err := filepath.Abs(path)
 		if err != nil {
 			return nil, fmt.Errorf("%v: could not get absolute path: %v", path, err)
 		}
 
-		file, err := store.FileByPath(tx, absPath)
-		if err != nil {
-			return nil, fmt.Errorf("%v: could not retrieve file: %v", path, err)
-		}
-		if file != nil {
-			err = statusCheckFile(file, report)
+		// compare against the paths as stored
+		absPaths[index] = store.CanonicalPath(absPath)
+	}
+
+	files, err := store.FilesByPaths(tx, absPaths)
+	if err != nil {
+		return nil, fmt.Errorf("could not retrieve files: %v", err)
+	}
+
+	filesByPath := make(map[string]*entities.File, len(files))
+	for _, file := range files {
+		filesByPath[file.Path()] = file
+	}
+
+	for index, path := range paths {
+		absPath := absPaths[index]
+
+		if file := filesByPath[absPath]; file != nil {
+			err = statusCheckFile(store, tx, file, report, includeVirtual)
 			if err != nil {
 				return nil, err
 			}
@@ -170,18 +229,18 @@ func statusPaths(store *storage.Storage, tx *storage.Tx, paths []string, dirOnly
 		if !dirOnly {
 			log.Infof(2, "%v: retrieving files from database.", path)
 
-			files, err := store.FilesByDirectory(tx, absPath)
+			files, err := store.FilesByDirectory(tx, store.CanonicalDirectory(absPath))
 			if err != nil {
 				return nil, fmt.Errorf("%v: could not retrieve files for directory: %v", path, err)
 			}
 
-			err = statusCheckFiles(files, report)
+			err = statusCheckFiles(store, tx, files, report, includeVirtual)
 			if err != nil {
 				return nil, err
 			}
 		}
 
-		err = findNewFiles(absPath, report, dirOnly)
+		err = findNewFiles(store, absPath, report, dirOnly)
 		if err != nil {
 			return nil, err
 		}
@@ -190,9 +249,9 @@ func statusPaths(store *storage.Storage, tx *storage.Tx, paths []string, dirOnly
 	return report, nil
 }
 
-func statusCheckFiles(files entities.Files, report *StatusReport) error {
+func statusCheckFiles(store *storage.Storage, tx *storage.Tx, files entities.Files, report *StatusReport, includeVirtual bool) error {
 	for _, file := range files {
-		err := statusCheckFile(file, report)
+		err := statusCheckFile(store, tx, file, report, includeVirtual)
 		if err != nil {
 			return err
 		}
@@ -201,15 +260,46 @@ func statusCheckFiles(files entities.Files, report *StatusReport) error {
 	return nil
 }
 
-func statusCheckFile(file *entities.File, report *StatusReport) error {
+func statusCheckFile(store *storage.Storage, tx *storage.Tx, file *entities.File, report *StatusReport, includeVirtual bool) error {
 	relPath := path.Rel(file.Path())
 
+	if path.IsURL(file.Path()) {
+		log.Infof(2, "%v: not a file: skipping.", file.Path())
+
+		report.Exclude(relPath)
+		return nil
+	}
+
 	log.Infof(2, "%v: checking file status.", file.Path())
 
 	stat, err := os.Stat(file.Path())
 	if err != nil {
 		switch {
 		case os.IsNotExist(err):
+			offline, err := store.FileOffline(tx, file.Id)
+			if err != nil {
+				return fmt.Errorf("%v: could not determine volume status: %v", file.Path(), err)
+			}
+			if offline {
+				log.Infof(2, "%v: file is on an offline volume.", file.Path())
+
+				report.AddRow(Row{relPath, OFFLINE})
+				return nil
+			}
+
+			if !includeVirtual {
+				virtual, err := store.FileVirtual(tx, file.Id)
+				if err != nil {
+					return fmt.Errorf("%v: could not determine file tracking: %v", file.Path(), err)
+				}
+				if virtual {
+					log.Infof(2, "%v: file is virtual.", file.Path())
+
+					report.Exclude(relPath)
+					return nil
+				}
+			}
+
 			log.Infof(2, "%v: file is missing.", file.Path())
 
 			report.AddRow(Row{relPath, MISSING})
@@ -223,7 +313,17 @@ func statusCheckFile(file *entities.File, report *StatusReport) error {
 			return fmt.Errorf("%v: could not stat: %v", file.Path(), err)
 		}
 	} else {
-		if stat.Size() != file.Size || !stat.ModTime().UTC().Equal(file.ModTime) {
+		modified := stat.Size() != file.Size || !stat.ModTime().UTC().Equal(file.ModTime)
+		if modified {
+			pathOnly, err := store.FilePathOnly(tx, file.Id)
+			if err != nil {
+				return fmt.Errorf("%v: could not determine file tracking: %v", file.Path(), err)
+			}
+
+			modified = !pathOnly
+		}
+
+		if modified {
 			log.Infof(2, "%v: file is modified.", file.Path())
 
 			report.AddRow(Row{relPath, MODIFIED})
@@ -237,7 +337,7 @@ func statusCheckFile(file *entities.File, report *StatusReport) error {
 	return nil
 }
 
-func findNewFiles(searchPath string, report *StatusReport, dirOnly bool) error {
+func findNewFiles(store *storage.Storage, searchPath string, report *StatusReport, dirOnly bool) error {
 	log.Infof(2, "%v: finding new files.", searchPath)
 
 	relPath := path.Rel(searchPath)
@@ -264,34 +364,79 @@ func findNewFiles(searchPath string, report *StatusReport, dirOnly bool) error {
 		}
 	}
 
-	if !dirOnly && stat.IsDir() {
-		dir, err := os.Open(absPath)
+	if dirOnly || !stat.IsDir() {
+		return nil
+	}
+
+	return path.Walk(absPath, func(dir string, entries []path.Entry, err error) error {
 		if err != nil {
-			return fmt.Errorf("%v: could not open file: %v", searchPath, err)
+			return fmt.Errorf("%v: could not read directory listing: %v", dir, err)
 		}
 
-		dirNames, err := dir.Readdirnames(0)
-		if err != nil {
-			return fmt.Errorf("%v: could not read directory listing: %v", searchPath, err)
+		for _, entry := range entries {
+			relPath := path.Rel(store.CanonicalPath(entry.Path))
+			if !report.ContainsRow(relPath) {
+				report.AddRow(Row{relPath, UNTAGGED})
+			}
+
+			switch {
+			case entry.Err == nil, os.IsNotExist(entry.Err):
+			case os.IsPermission(entry.Err):
+				log.Warnf("%v: permission denied.", entry.Path)
+			default:
+				return fmt.Errorf("%v: could not stat: %v", entry.Path, entry.Err)
+			}
 		}
 
-		for _, dirName := range dirNames {
-			dirPath := filepath.Join(searchPath, dirName)
-			err = findNewFiles(dirPath, report, dirOnly)
-			if err != nil {
-				return err
+		return nil
+	})
+}
+
+// The statuses in the order they are reported.
+var allStatuses = []Status{TAGGED, MODIFIED, MISSING, OFFLINE, UNTAGGED}
+
+func parseStatuses(text string) ([]Status, error) {
+	statuses := make([]Status, 0, len(allStatuses))
+
+	for _, code := range strings.Split(text, ",") {
+		code = strings.TrimSpace(code)
+
+		found := false
+		for _, status := range allStatuses {
+			if code == string(status) {
+				statuses = append(statuses, status)
+				found = true
 			}
 		}
+		if !found {
+			return nil, fmt.Errorf("invalid status '%v': expected T, M, !, O or U", code)
+		}
 	}
 
-	return nil
+	return statuses, nil
 }
 
-func printReport(report *StatusReport) {
-	printRows(report.Rows, TAGGED)
-	printRows(report.Rows, MODIFIED)
-	printRows(report.Rows, MISSING)
-	printRows(report.Rows, UNTAGGED)
+func printReport(report *StatusReport, statuses []Status, sortBy string) {
+	rows := make(rowsByPath, 0, len(report.Rows))
+	for _, row := range report.Rows {
+		if containsStatus(statuses, row.Status) {
+			rows = append(rows, row)
+		}
+	}
+
+	sort.Sort(rows)
+
+	if sortBy == "path" {
+		for _, row := range rows {
+			printRow(row)
+		}
+
+		return
+	}
+
+	for _, status := range allStatuses {
+		printRows(rows, status)
+	}
 }
 
 func printRows(rows []Row, status Status) {
@@ -302,6 +447,42 @@ func printRows(rows []Row, status Status) {
 	}
 }
 
+func containsStatus(statuses []Status, status Status) bool {
+	for _, candidate := range statuses {
+		if candidate == status {
+			return true
+		}
+	}
+
+	return false
+}
+
+type rowsByPath []Row
+
+func (rows rowsByPath) Len() int {
+	return len(rows)
+}
+
+func (rows rowsByPath) Less(i, j int) bool {
+	return rows[i].Path < rows[j].Path
+}
+
+func (rows rowsByPath) Swap(i, j int) {
+	rows[i], rows[j] = rows[j], rows[i]
+}
+
+var statusColours = map[Status]func(string) string{
+	TAGGED:   ansi.Green,
+	MODIFIED: ansi.Yellow,
+	MISSING:  ansi.Red,
+	OFFLINE:  ansi.Blue,
+}
+
 func printRow(row Row) {
-	fmt.Printf("%v %v\n", string(row.Status), row.Path)
+	status := string(row.Status)
+	if colour, ok := statusColours[row.Status]; ok {
+		status = terminal.Colourise(os.Stdout, colour, status)
+	}
+
+	fmt.Printf("%v %v\n", status, displayPath(row.Path))
 }
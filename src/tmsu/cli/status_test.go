@@ -16,9 +16,12 @@
 package cli
 
 import (
+	"fmt"
 	"io/ioutil"
 	"os"
+	"strings"
 	"testing"
+	"tmsu/common/terminal"
 	"tmsu/storage"
 )
 
@@ -96,3 +99,232 @@ func TestStatusReport(test *testing.T) {
 	bytes, err := ioutil.ReadAll(outFile)
 	compareOutput(test, "T /tmp/tmsu/a\nM /tmp/tmsu/b\n! /tmp/tmsu/d\nU /tmp/tmsu/c\n", string(bytes))
 }
+
+func TestStatusManyPaths(test *testing.T) {
+	// set-up
+
+	databasePath := testDatabase()
+	defer os.Remove(databasePath)
+
+	store, err := storage.OpenAt(databasePath)
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer store.Close()
+
+	err = redirectStreams()
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer restoreStreams()
+
+	// more paths than are retrieved per query
+	paths := make([]string, 450)
+	for index := range paths {
+		paths[index] = fmt.Sprintf("/tmp/tmsu/many/%v", index)
+		if err := createFile(paths[index], "x"); err != nil {
+			test.Fatalf("Could not create file: %v", err)
+		}
+	}
+	defer os.RemoveAll("/tmp/tmsu/many")
+
+	if err := TagCommand.Exec(store, Options{Option{"--tags", "-t", "", true, "a"}}, paths[400:]); err != nil {
+		test.Fatal(err)
+	}
+
+	// test
+
+	if err := StatusCommand.Exec(store, Options{}, paths); err != nil {
+		test.Fatal(err)
+	}
+
+	// validate
+
+	outFile.Seek(0, 0)
+
+	bytes, err := ioutil.ReadAll(outFile)
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	tagged := strings.Count(string(bytes), "T /tmp/tmsu/many/")
+	untagged := strings.Count(string(bytes), "U /tmp/tmsu/many/")
+	if tagged != 50 || untagged != 400 {
+		test.Fatalf("Expected 50 tagged and 400 untagged files but were %v and %v.", tagged, untagged)
+	}
+}
+
+func TestStatusFilterAndSort(test *testing.T) {
+	// set-up
+
+	databasePath := testDatabase()
+	defer os.Remove(databasePath)
+
+	store, err := storage.OpenAt(databasePath)
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer store.Close()
+
+	err = redirectStreams()
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer restoreStreams()
+
+	for _, name := range []string{"a", "b", "c"} {
+		path := "/tmp/tmsu/" + name
+		if err := createFile(path, name); err != nil {
+			test.Fatalf("Could not create file: %v", err)
+		}
+		defer os.Remove(path)
+
+		if err := TagCommand.Exec(store, Options{}, []string{path, "x"}); err != nil {
+			test.Fatal(err)
+		}
+	}
+
+	if err := os.Remove("/tmp/tmsu/a"); err != nil {
+		test.Fatal(err)
+	}
+	if err := createFile("/tmp/tmsu/c", "c2"); err != nil {
+		test.Fatalf("Could not create file: %v", err)
+	}
+
+	// test
+
+	options := Options{Option{"--filter", "-f", "", true, "!,M"}, Option{"--sort", "-s", "", true, "path"}}
+	if err := StatusCommand.Exec(store, options, []string{"/tmp/tmsu/a", "/tmp/tmsu/b", "/tmp/tmsu/c"}); err != nil {
+		test.Fatal(err)
+	}
+
+	// validate
+
+	outFile.Seek(0, 0)
+
+	bytes, err := ioutil.ReadAll(outFile)
+	compareOutput(test, "! /tmp/tmsu/a\nM /tmp/tmsu/c\n", string(bytes))
+}
+
+func TestStatusColour(test *testing.T) {
+	// set-up
+
+	databasePath := testDatabase()
+	defer os.Remove(databasePath)
+
+	store, err := storage.OpenAt(databasePath)
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer store.Close()
+
+	err = redirectStreams()
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer restoreStreams()
+
+	if err := createFile("/tmp/tmsu/a", "a"); err != nil {
+		test.Fatalf("Could not create file: %v", err)
+	}
+	defer os.Remove("/tmp/tmsu/a")
+
+	if err := createFile("/tmp/tmsu/b", "b"); err != nil {
+		test.Fatalf("Could not create file: %v", err)
+	}
+	defer os.Remove("/tmp/tmsu/b")
+
+	if err := TagCommand.Exec(store, Options{}, []string{"/tmp/tmsu/a", "a"}); err != nil {
+		test.Fatal(err)
+	}
+
+	if err := terminal.SetColourWhen("always"); err != nil {
+		test.Fatal(err)
+	}
+	defer terminal.SetColourWhen("auto")
+
+	// test
+
+	if err := StatusCommand.Exec(store, Options{}, []string{"/tmp/tmsu/a", "/tmp/tmsu/b"}); err != nil {
+		test.Fatal(err)
+	}
+
+	// validate
+
+	outFile.Seek(0, 0)
+
+	bytes, err := ioutil.ReadAll(outFile)
+	compareOutput(test, "\x1b[32mT\x1b[0m /tmp/tmsu/a\nU /tmp/tmsu/b\n", string(bytes))
+}
+
+func TestStatusCanonicalPaths(test *testing.T) {
+	// set-up
+
+	databasePath := testDatabase()
+	defer os.Remove(databasePath)
+
+	store, err := storage.OpenAt(databasePath)
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer store.Close()
+
+	err = redirectStreams()
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer restoreStreams()
+
+	if err := createFile("/tmp/tmsu/real/a", "a"); err != nil {
+		test.Fatal(err)
+	}
+	defer os.RemoveAll("/tmp/tmsu/real")
+
+	if err := os.Symlink("/tmp/tmsu/real", "/tmp/tmsu/link"); err != nil {
+		test.Fatal(err)
+	}
+	defer os.Remove("/tmp/tmsu/link")
+
+	if err := ConfigCommand.Exec(store, Options{}, []string{"canonicalPaths=symlinks"}); err != nil {
+		test.Fatal(err)
+	}
+
+	// test
+
+	if err := TagCommand.Exec(store, Options{}, []string{"/tmp/tmsu/link/a", "apple"}); err != nil {
+		test.Fatal(err)
+	}
+	if err := TagCommand.Exec(store, Options{}, []string{"/tmp/tmsu/real/a", "banana"}); err != nil {
+		test.Fatal(err)
+	}
+	if err := StatusCommand.Exec(store, Options{}, []string{"/tmp/tmsu/link"}); err != nil {
+		test.Fatal(err)
+	}
+
+	// validate
+
+	tx, err := store.Begin()
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer tx.Commit()
+
+	count, err := store.FileCount(tx)
+	if err != nil {
+		test.Fatal(err)
+	}
+	if count != 1 {
+		test.Fatalf("Expected one file but were %v.", count)
+	}
+
+	outFile.Seek(0, 0)
+
+	bytes, err := ioutil.ReadAll(outFile)
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	if !strings.Contains(string(bytes), "T /tmp/tmsu/real/a") || strings.Contains(string(bytes), "M ") {
+		test.Fatalf("Expected the file to be tagged and none missing but was: %v", string(bytes))
+	}
+}
@@ -0,0 +1,190 @@
+// Copyright 2011-2015 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package cli
+
+import (
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"os/exec"
+	"strings"
+	"tmsu/api"
+	"tmsu/common/log"
+	"tmsu/server"
+	"tmsu/storage"
+)
+
+var SyncCommand = Command{
+	Name:     "sync",
+	Synopsis: "Synchronise tags with another database",
+	Usages:   []string{"tmsu sync [OPTION]... REMOTE"},
+	Description: `Exchanges the tags applied and removed since the last synchronisation with the REMOTE database, so that two machines can share one set of tags.
+
+REMOTE may be:
+
+  PATH                     a database file on this machine
+  ssh://[USER@]HOST/PATH   a database on another machine, which must have 'tmsu' installed
+  unix:SOCKET              the socket of a running 'tmsu serve'
+
+Files are matched by fingerprint so they may be at different paths in each database. Changes for files that are not in the other database are reported and skipped.
+
+If the same tag was applied to a file in one database and removed in the other then this conflict is reported and the later change wins.`,
+	Examples: []string{"$ tmsu sync /media/usb/.tmsu/db",
+		"$ tmsu sync ssh://bob@desktop/home/bob/.tmsu/default.db",
+		"$ tmsu --dry-run sync ssh://desktop/home/bob/.tmsu/default.db"},
+	Options:  Options{},
+	Exec:     syncExec,
+	Modifies: true,
+}
+
+func syncExec(store *storage.Storage, options Options, args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("remote database must be specified")
+	}
+	if len(args) > 1 {
+		return fmt.Errorf("too many arguments")
+	}
+
+	remote, err := openRemote(args[0])
+	if err != nil {
+		return err
+	}
+	defer remote.Close()
+
+	result, err := api.Sync(api.New(store), remote, store.DryRun)
+	if err != nil {
+		return err
+	}
+
+	for _, conflict := range result.Conflicts {
+		log.Warnf("conflict: %v here but %v remotely: keeping %v", conflict.Local, conflict.Remote, conflict.Kept)
+	}
+	for _, change := range result.UnmatchedRemote {
+		log.Warnf("%v: not in remote database: skipped", change)
+	}
+	for _, change := range result.UnmatchedLocal {
+		log.Warnf("%v: not in local database: skipped", change)
+	}
+
+	for _, change := range result.Sent {
+		log.Infof(2, "sent %v", change)
+	}
+	for _, change := range result.Received {
+		log.Infof(2, "received %v", change)
+	}
+
+	verb := ""
+	if store.DryRun {
+		verb = "would have "
+	}
+
+	fmt.Printf("%vsent %v change(s), %vreceived %v change(s)\n", verb, len(result.Sent)-len(result.UnmatchedRemote), verb, len(result.Received)-len(result.UnmatchedLocal))
+
+	return nil
+}
+
+// unexported
+
+type remoteDatabase interface {
+	api.Replica
+	Close() error
+}
+
+func openRemote(remote string) (remoteDatabase, error) {
+	switch {
+	case strings.HasPrefix(remote, "ssh://"):
+		return openSshRemote(remote)
+	case strings.HasPrefix(remote, "unix:"):
+		client, err := server.Dial(remote[len("unix:"):])
+		if err != nil {
+			return nil, fmt.Errorf("could not connect to '%v': %v", remote, err)
+		}
+
+		return client, nil
+	}
+
+	if backendName, path := storage.ParseLocation(remote); backendName == storage.DefaultBackend {
+		if _, err := os.Stat(path); err != nil {
+			return nil, fmt.Errorf("%v: could not open remote database: %v", remote, err)
+		}
+	}
+
+	return api.Open(remote)
+}
+
+// Runs 'tmsu serve --stdio' on the remote host.
+func openSshRemote(remote string) (remoteDatabase, error) {
+	remoteUrl, err := url.Parse(remote)
+	if err != nil || remoteUrl.Host == "" || remoteUrl.Path == "" {
+		return nil, fmt.Errorf("invalid remote '%v': expected ssh://[USER@]HOST/PATH", remote)
+	}
+
+	command := exec.Command("ssh", sshArguments(remoteUrl)...)
+	command.Stderr = os.Stderr
+
+	stdin, err := command.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	stdout, err := command.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := command.Start(); err != nil {
+		return nil, fmt.Errorf("could not run ssh: %v", err)
+	}
+
+	return sshRemote{server.NewClient(pipeConn{stdout, stdin}), command}, nil
+}
+
+// sshArguments builds the ssh command line for the remote. The remote command
+// is interpreted by the remote user's shell so the database path is quoted,
+// and the destination follows '--' so that it cannot be taken for an option.
+func sshArguments(remoteUrl *url.URL) []string {
+	sshArgs := make([]string, 0, 10)
+	if remoteUrl.Port() != "" {
+		sshArgs = append(sshArgs, "-p", remoteUrl.Port())
+	}
+
+	destination := remoteUrl.Hostname()
+	if remoteUrl.User != nil {
+		destination = remoteUrl.User.Username() + "@" + destination
+	}
+
+	return append(sshArgs, "--", destination, "tmsu", "--database", shellQuote(remoteUrl.Path), "serve", "--stdio")
+}
+
+// shellQuote quotes the text for a POSIX shell.
+func shellQuote(text string) string {
+	return "'" + strings.Replace(text, "'", `'\''`, -1) + "'"
+}
+
+type sshRemote struct {
+	*server.Client
+	command *exec.Cmd
+}
+
+func (remote sshRemote) Close() error {
+	remote.Client.Close()
+	return remote.command.Wait()
+}
+
+type pipeConn struct {
+	io.Reader
+	io.WriteCloser
+}
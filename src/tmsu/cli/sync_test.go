@@ -0,0 +1,113 @@
+// Copyright 2011-2015 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package cli
+
+import (
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"tmsu/api"
+	"tmsu/storage"
+)
+
+func TestSync(test *testing.T) {
+	// set-up
+
+	localPath := testDatabase()
+	defer os.Remove(localPath)
+
+	remotePath := filepath.Join(os.TempDir(), "tmsu_test_remote.db")
+	defer os.Remove(remotePath)
+
+	err := redirectStreams()
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer restoreStreams()
+
+	if err := createFile("/tmp/tmsu/a", "hello"); err != nil {
+		test.Fatal(err)
+	}
+	defer os.Remove("/tmp/tmsu/a")
+
+	store, err := storage.OpenAt(localPath)
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer store.Close()
+
+	remoteStore, err := storage.OpenAt(remotePath)
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	if err := TagCommand.Exec(store, Options{}, []string{"/tmp/tmsu/a", "apple"}); err != nil {
+		test.Fatal(err)
+	}
+	if err := TagCommand.Exec(remoteStore, Options{}, []string{"/tmp/tmsu/a", "banana"}); err != nil {
+		test.Fatal(err)
+	}
+	remoteStore.Close()
+
+	// test
+
+	if err := SyncCommand.Exec(store, Options{}, []string{remotePath}); err != nil {
+		test.Fatal(err)
+	}
+
+	// validate
+
+	for _, databasePath := range []string{localPath, remotePath} {
+		db, err := api.Open(databasePath)
+		if err != nil {
+			test.Fatal(err)
+		}
+
+		tagValues, err := db.FileTags("/tmp/tmsu/a", true)
+		db.Close()
+		if err != nil {
+			test.Fatal(err)
+		}
+
+		tagNames := make(map[string]bool, len(tagValues))
+		for _, tagValue := range tagValues {
+			tagNames[tagValue.Tag] = true
+		}
+
+		if len(tagNames) != 2 || !tagNames["apple"] || !tagNames["banana"] {
+			test.Fatalf("%v: expected 'apple' and 'banana' but were %v.", databasePath, tagValues)
+		}
+	}
+}
+
+func TestSyncSshArgumentsQuoted(test *testing.T) {
+	// set-up
+
+	remoteUrl, err := url.Parse("ssh://-oProxyCommand=x:2222/home/bob/it's my;touch pwned")
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	// test
+
+	args := sshArguments(remoteUrl)
+
+	// validate
+
+	compareOutput(test, `-p|2222|--|-oProxyCommand=x|tmsu|--database|'/home/bob/it'\''s my;touch pwned'|serve|--stdio`, strings.Join(args, "|"))
+}
@@ -21,12 +21,12 @@ import (
 	"io"
 	"os"
 	"path/filepath"
-	"strings"
 	"time"
-	"tmsu/common/fingerprint"
+	"tmsu/api"
 	"tmsu/common/log"
+	"tmsu/common/progress"
 	"tmsu/common/text"
-	"tmsu/entities"
+	"tmsu/query"
 	"tmsu/storage"
 )
 
@@ -34,7 +34,9 @@ var TagCommand = Command{
 	Name:     "tag",
 	Synopsis: "Apply tags to files",
 	Usages: []string{"tmsu tag [OPTION]... FILE TAG[=VALUE]...",
+		"tmsu tag [OPTION]... FILE... -- TAG[=VALUE]...",
 		`tmsu tag [OPTION]... --tags="TAG[=VALUE]..." FILE...`,
+		"tmsu tag [OPTION]... -t TAG[=VALUE] [-t TAG[=VALUE]]... FILE...",
 		"tmsu tag [OPTION]... --from=SOURCE FILE...",
 		"tmsu tag [OPTION]... --create TAG[=VALUE]...",
 		"tmsu tag [OPTION[... -"},
@@ -42,26 +44,82 @@ var TagCommand = Command{
 
 Tag names may consist of one or more letter, number, punctuation and symbol characters (from the corresponding Unicode categories). Tag names may not contain whitespace characters, the comparison operator symbols ('=', '<' and '>"), parentheses ('(' and ')'), commas (',') or the slash symbol ('/'). In addition, the tag names '.' and '..' are not valid.
 
+Tag names may begin with '-' but must then follow '--' so that they are not taken for options, e.g. 'tmsu tag FILE -- -funny'. Such tags are queried with the tag: prefix (see 'tmsu help files').
+
+Spaces may be permitted in tag and value names, other than at the start or end, by enabling the 'allowSpacesInNames' setting, whilst the 'reservedNameChars' setting lists further characters that names may not contain. Tag names containing spaces must be quoted within --tags, lines read from standard input and queries.
+
 Optionally tags applied to files may be attributed with a VALUE using the TAG=VALUE syntax.
 
-If a single argument of - is passed, TMSU will read lines from standard input in the format 'FILE TAG[=VALUE]...'.`,
+To tag several files at once either list the FILEs followed by '--' and then the TAGs or give the tags with --tags, which may be repeated, e.g. '-t music -t genre=jazz': neither requires the tags to be quoted together. Tags following '--' are applied in addition to those of --tags.
+
+If a single argument of - is passed, TMSU will read lines from standard input in the format 'FILE TAG[=VALUE]...'.
+
+When a file being tagged for the first time has the same contents as files that are already tagged, the --inherit-dupe-tags option copies their tags to it as well. This happens regardless of the option when the 'inheritDupeTags' setting is enabled.
+
+The --no-fingerprint option tracks files by path only: they are not fingerprinted and 'tmsu status' does not report them as modified, which suits files that are large or frequently rewritten, such as logs or virtual machine images. Files that are already tagged stop being fingerprinted. The 'pathOnlyFiles' setting tracks newly tagged files by path only when their names match one of its comma-separated patterns, e.g. '*.log,*.qcow2'. Such files are not identified as duplicates.
+
+The --force option tags paths that do not exist, such as files that are expected to arrive, tracking them as virtual files: these are not fingerprinted and neither 'tmsu status' nor 'tmsu repair' reports them as missing unless their --include-virtual option is given. Tagging a virtual file again once it exists tracks it as any other file.
+
+The --until option applies tags temporarily: once DATE has passed they are removed, or archived as 'expired=TAG' if the 'expiredTags' setting is 'archive', by the sweep made before each subsequent command. DATE is either a date, optionally with a time, e.g. '2024-06-01' or '2024-06-01 17:30', or relative to now, e.g. '+7d' (see 'tmsu help files'). Tagging a file again with --until changes the expiry of its tags.
+
+The --queue option tags files on volumes that are not currently mounted, or that otherwise cannot yet be accessed, once they can be fingerprinted: their tags are queued and applied, with the files fingerprinted, by the first command run once they are available or by 'tmsu flush'.
+
+FILE may instead be a URL, such as https://example.com/page, so that bookmarks can be tagged and queried alongside files. Web pages are fingerprinted by their entity tag (ETag) or else a hash of their content: a page that cannot be reached is tagged without a fingerprint. 'file://' URLs are taken as the paths they refer to. Resources other than files are not examined by 'tmsu status' or 'tmsu repair'.`,
 	Examples: []string{"$ tmsu tag mountain1.jpg photo landscape holiday good country=france",
 		"$ tmsu tag --from=mountain1.jpg mountain2.jpg",
 		`$ tmsu tag --tags="landscape" field1.jpg field2.jpg`,
-		"$ tmsu tag --create bad rubbish awful"},
+		`$ tmsu tag --tags="'new york' city" skyline.jpg`,
+		"$ tmsu tag *.jpg -- photo country=france",
+		"$ tmsu tag -t photo -t 'country=united kingdom' *.jpg",
+		"$ tmsu tag --create bad rubbish awful",
+		"$ tmsu tag joke.txt -- -funny",
+		"$ tmsu tag --inherit-dupe-tags copy-of-mountain1.jpg copy",
+		"$ tmsu tag --no-fingerprint disk.qcow2 vm",
+		"$ tmsu tag --force expected-report.pdf todo",
+		"$ tmsu tag --queue /media/usb/film.mkv film",
+		"$ tmsu tag --until 2024-06-01 report.pdf urgent",
+		"$ tmsu tag --until +7d *.jpg -- to-review",
+		"$ tmsu tag https://golang.org/doc/ bookmark go"},
 	Options: Options{{"--tags", "-t", "the set of tags to apply", true, ""},
 		{"--recursive", "-r", "recursively apply tags to directory contents", false, ""},
 		{"--from", "-f", "copy tags from the SOURCE file", true, ""},
 		{"--create", "-c", "create tags without tagging any files", false, ""},
 		{"--explicit", "-e", "explicitly apply tags even if they are already implied", false, ""},
-		{"--force", "-F", "apply tags to non-existant or non-permissioned paths", false, ""}},
-	Exec: tagExec,
+		{"--force", "-F", "apply tags to non-existent (virtual) or non-permissioned paths", false, ""},
+		{"--inherit-dupe-tags", "-i", "also apply the tags of duplicates of newly tagged files", false, ""},
+		{"--no-fingerprint", "", "track the files by path only, without fingerprinting them", false, ""},
+		{"--until", "-u", "remove the tags once DATE has passed", true, ""},
+		{"--queue", "-Q", "queue the tags of files that cannot be accessed until they can be", false, ""}},
+	Exec:      tagExec,
+	Modifies:  true,
+	Separated: true,
 }
 
 func tagExec(store *storage.Storage, options Options, args []string) error {
 	recursive := options.HasOption("--recursive")
 	explicit := options.HasOption("--explicit")
 	force := options.HasOption("--force")
+	inherit := options.HasOption("--inherit-dupe-tags")
+	pathOnly := options.HasOption("--no-fingerprint")
+	queue := options.HasOption("--queue")
+
+	if force && queue {
+		return fmt.Errorf("--force and --queue cannot be combined")
+	}
+
+	var until time.Time
+	if options.HasOption("--until") {
+		text := options.Get("--until").Argument
+
+		var ok bool
+		until, _, ok = query.ParseDate(text, time.Now())
+		if !ok {
+			return fmt.Errorf("invalid date '%v': must be a date such as '2024-06-01' or relative such as '+7d'", text)
+		}
+		if !until.After(time.Now()) {
+			return fmt.Errorf("date '%v' has already passed", text)
+		}
+	}
 
 	tx, err := store.Begin()
 	if err != nil {
@@ -69,7 +127,14 @@ func tagExec(store *storage.Storage, options Options, args []string) error {
 	}
 	defer tx.Commit()
 
+	// FILE... -- TAG...
+	paths, separatedTagArgs, separated := splitArguments(args)
+
 	switch {
+	case separated && (options.HasOption("--create") || options.HasOption("--from")):
+		return fmt.Errorf("'--' cannot separate tags when --create or --from is specified")
+	case options.HasOption("--create") && options.HasOption("--until"):
+		return fmt.Errorf("--until cannot be specified with --create")
 	case options.HasOption("--create"):
 		if len(args) == 0 {
 			return fmt.Errorf("too few arguments")
@@ -78,41 +143,39 @@ func tagExec(store *storage.Storage, options Options, args []string) error {
 		if err := createTags(store, tx, args); err != nil {
 			return err
 		}
-	case options.HasOption("--tags"):
+	case options.HasOption("--from"):
 		if len(args) < 1 {
 			return fmt.Errorf("too few arguments")
 		}
 
-		tagArgs := strings.Fields(options.Get("--tags").Argument)
-		if len(tagArgs) == 0 {
-			return fmt.Errorf("too few arguments")
+		fromPath, err := filepath.Abs(options.Get("--from").Argument)
+		if err != nil {
+			return fmt.Errorf("%v: could not get absolute path: %v", fromPath, err)
 		}
 
 		paths := args
-		if len(paths) < 1 {
-			return fmt.Errorf("too few arguments")
-		}
 
-		if err := tagPaths(store, tx, tagArgs, paths, explicit, recursive, force); err != nil {
+		if err := tagFrom(store, tx, fromPath, paths, explicit, recursive, force, inherit, pathOnly, queue, until); err != nil {
 			return err
 		}
-	case options.HasOption("--from"):
-		if len(args) < 1 {
+	case separated || options.HasOption("--tags"):
+		tagArgs := separatedTagArgs
+		for _, argument := range options.Arguments("--tags") {
+			tagArgs = append(tagArgs, text.Tokenize(argument)...)
+		}
+		if len(tagArgs) == 0 {
 			return fmt.Errorf("too few arguments")
 		}
 
-		fromPath, err := filepath.Abs(options.Get("--from").Argument)
-		if err != nil {
-			return fmt.Errorf("%v: could not get absolute path: %v", fromPath, err)
+		if len(paths) < 1 {
+			return fmt.Errorf("too few arguments")
 		}
 
-		paths := args
-
-		if err := tagFrom(store, tx, fromPath, paths, explicit, recursive, force); err != nil {
+		if err := tagPaths(store, tx, tagArgs, paths, explicit, recursive, force, inherit, pathOnly, queue, until); err != nil {
 			return err
 		}
 	case len(args) == 1 && args[0] == "-":
-		if err := readStandardInput(store, tx, recursive, explicit, force); err != nil {
+		if err := readStandardInput(store, tx, recursive, explicit, force, inherit, pathOnly, queue, until); err != nil {
 			return err
 		}
 	default:
@@ -123,7 +186,7 @@ func tagExec(store *storage.Storage, options Options, args []string) error {
 		paths := args[0:1]
 		tagArgs := args[1:]
 
-		if err := tagPaths(store, tx, tagArgs, paths, explicit, recursive, force); err != nil {
+		if err := tagPaths(store, tx, tagArgs, paths, explicit, recursive, force, inherit, pathOnly, queue, until); err != nil {
 			return err
 		}
 	}
@@ -131,6 +194,19 @@ func tagExec(store *storage.Storage, options Options, args []string) error {
 	return nil
 }
 
+// Splits the arguments either side of the first '--', which the option parser
+// passes on when it follows an argument. Without one all of the arguments are
+// returned as the first part.
+func splitArguments(args []string) (before, after []string, separated bool) {
+	for index, arg := range args {
+		if arg == "--" {
+			return args[:index], args[index+1:], true
+		}
+	}
+
+	return args, nil, false
+}
+
 func createTags(store *storage.Storage, tx *storage.Tx, tagNames []string) error {
 	wereErrors := false
 	for _, tagName := range tagNames {
@@ -159,7 +235,7 @@ func createTags(store *storage.Storage, tx *storage.Tx, tagNames []string) error
 	return nil
 }
 
-func tagPaths(store *storage.Storage, tx *storage.Tx, tagArgs, paths []string, explicit, recursive, force bool) error {
+func tagPaths(store *storage.Storage, tx *storage.Tx, tagArgs, paths []string, explicit, recursive, force, inherit, pathOnly, queue bool, until time.Time) error {
 	log.Infof(2, "loading settings")
 
 	settings, err := store.Settings(tx)
@@ -168,18 +244,10 @@ func tagPaths(store *storage.Storage, tx *storage.Tx, tagArgs, paths []string, e
 	}
 
 	wereErrors := false
-	tagValuePairs := make([]tagValuePair, 0, 10)
+	tagValuePairs := make([]api.TagValuePair, 0, 10)
 	for _, tagArg := range tagArgs {
-		var tagName, valueName string
-		index := strings.Index(tagArg, "=")
-
-		switch index {
-		case -1, 0:
-			tagName = tagArg
-		default:
-			tagName = tagArg[0:index]
-			valueName = tagArg[index+1 : len(tagArg)]
-		}
+		tagValue := api.ParseTagValue(tagArg)
+		tagName, valueName := tagValue.Tag, tagValue.Value
 
 		tag, err := store.TagByName(tx, tagName)
 		if err != nil {
@@ -215,11 +283,17 @@ func tagPaths(store *storage.Storage, tx *storage.Tx, tagArgs, paths []string, e
 			}
 		}
 
-		tagValuePairs = append(tagValuePairs, tagValuePair{tag.Id, value.Id})
+		tagValuePairs = append(tagValuePairs, api.TagValuePair{TagId: tag.Id, ValueId: value.Id})
 	}
 
+	reporter := newTagReporter(recursive)
+	defer reporter.Done()
+
+	tagOptions := api.TagOptions{Explicit: explicit, Recursive: recursive, Force: force, Inherit: inherit, PathOnly: pathOnly, Queue: queue, Until: until, Visited: func(string) { reporter.Increment() }, Warning: reporter.Clear}
+
 	for _, path := range paths {
-		if err := tagPath(store, tx, path, tagValuePairs, explicit, recursive, force, settings.FileFingerprintAlgorithm(), settings.DirectoryFingerprintAlgorithm()); err != nil {
+		if err := api.TagPath(store, tx, path, tagValuePairs, settings, tagOptions); err != nil {
+			reporter.Clear()
 			switch {
 			case os.IsPermission(err):
 				log.Warnf("%v: permisison denied", path)
@@ -240,7 +314,7 @@ func tagPaths(store *storage.Storage, tx *storage.Tx, tagArgs, paths []string, e
 	return nil
 }
 
-func tagFrom(store *storage.Storage, tx *storage.Tx, fromPath string, paths []string, explicit, recursive, force bool) error {
+func tagFrom(store *storage.Storage, tx *storage.Tx, fromPath string, paths []string, explicit, recursive, force, inherit, pathOnly, queue bool, until time.Time) error {
 	log.Infof(2, "loading settings")
 
 	settings, err := store.Settings(tx)
@@ -261,14 +335,20 @@ func tagFrom(store *storage.Storage, tx *storage.Tx, fromPath string, paths []st
 		return fmt.Errorf("%v: could not retrieve filetags: %v", fromPath, err)
 	}
 
-	tagValuePairs := make([]tagValuePair, len(fileTags))
+	tagValuePairs := make([]api.TagValuePair, len(fileTags))
 	for index, fileTag := range fileTags {
-		tagValuePairs[index] = tagValuePair{fileTag.TagId, fileTag.ValueId}
+		tagValuePairs[index] = api.TagValuePair{TagId: fileTag.TagId, ValueId: fileTag.ValueId}
 	}
 
 	wereErrors := false
+	reporter := newTagReporter(recursive)
+	defer reporter.Done()
+
+	tagOptions := api.TagOptions{Explicit: explicit, Recursive: recursive, Force: force, Inherit: inherit, PathOnly: pathOnly, Queue: queue, Until: until, Visited: func(string) { reporter.Increment() }, Warning: reporter.Clear}
+
 	for _, path := range paths {
-		if err := tagPath(store, tx, path, tagValuePairs, explicit, recursive, force, settings.FileFingerprintAlgorithm(), settings.DirectoryFingerprintAlgorithm()); err != nil {
+		if err := api.TagPath(store, tx, path, tagValuePairs, settings, tagOptions); err != nil {
+			reporter.Clear()
 			switch {
 			case os.IsPermission(err):
 				log.Warnf("%v: permisison denied", path)
@@ -289,64 +369,7 @@ func tagFrom(store *storage.Storage, tx *storage.Tx, fromPath string, paths []st
 	return nil
 }
 
-func tagPath(store *storage.Storage, tx *storage.Tx, path string, tagValuePairs []tagValuePair, explicit, recursive, force bool, fileFingerprintAlg, dirFingerprintAlg string) error {
-	absPath, err := filepath.Abs(path)
-	if err != nil {
-		return fmt.Errorf("%v: could not get absolute path: %v", path, err)
-	}
-
-	stat, err := os.Stat(path)
-	if err != nil {
-		switch {
-		case os.IsNotExist(err), os.IsPermission(err):
-			if !force {
-				return err
-			} else {
-				stat = emptyStat{}
-			}
-		default:
-			return err
-		}
-	}
-
-	log.Infof(2, "%v: checking if file exists", path)
-
-	file, err := store.FileByPath(tx, absPath)
-	if err != nil {
-		return fmt.Errorf("%v: could not retrieve file: %v", path, err)
-	}
-	if file == nil {
-		file, err = addFile(store, tx, absPath, stat.ModTime(), uint(stat.Size()), stat.IsDir(), fileFingerprintAlg, dirFingerprintAlg)
-		if err != nil {
-			return fmt.Errorf("%v: could not add file: %v", path, err)
-		}
-	}
-
-	if !explicit {
-		tagValuePairs, err = removeAlreadyAppliedTagValuePairs(store, tx, tagValuePairs, file)
-		if err != nil {
-			return fmt.Errorf("%v: could not remove applied tags: %v", path, err)
-		}
-	}
-
-	log.Infof(2, "%v: applying tags.", path)
-
-	for _, tagValuePair := range tagValuePairs {
-		if _, err = store.AddFileTag(tx, file.Id, tagValuePair.TagId, tagValuePair.ValueId); err != nil {
-			return fmt.Errorf("%v: could not apply tags: %v", file.Path(), err)
-		}
-	}
-
-	if recursive && stat.IsDir() {
-		if err = tagRecursively(store, tx, path, tagValuePairs, explicit, force, fileFingerprintAlg, dirFingerprintAlg); err != nil {
-			return err
-		}
-	}
-
-	return nil
-}
-
-func readStandardInput(store *storage.Storage, tx *storage.Tx, recursive, explicit, force bool) error {
+func readStandardInput(store *storage.Storage, tx *storage.Tx, recursive, explicit, force, inherit, pathOnly, queue bool, until time.Time) error {
 	reader := bufio.NewReader(os.Stdin)
 
 	wereErrors := false
@@ -372,7 +395,7 @@ func readStandardInput(store *storage.Storage, tx *storage.Tx, recursive, explic
 		path := words[0]
 		tagArgs := words[1:]
 
-		if err := tagPaths(store, tx, tagArgs, []string{path}, explicit, recursive, force); err != nil {
+		if err := tagPaths(store, tx, tagArgs, []string{path}, explicit, recursive, force, inherit, pathOnly, queue, until); err != nil {
 			log.Warnf("%v: %v", path, err)
 			wereErrors = true
 		}
@@ -385,81 +408,13 @@ func readStandardInput(store *storage.Storage, tx *storage.Tx, recursive, explic
 	return nil
 }
 
-func tagRecursively(store *storage.Storage, tx *storage.Tx, path string, tagValuePairs []tagValuePair, explicit, force bool, fileFingerprintAlg, dirFingerprintAlg string) error {
-	osFile, err := os.Open(path)
-	if err != nil {
-		return fmt.Errorf("%v: could not open path: %v", path, err)
-	}
-
-	childNames, err := osFile.Readdirnames(0)
-	osFile.Close()
-	if err != nil {
-		return fmt.Errorf("%v: could not retrieve directory contents: %v", path, err)
-	}
-
-	for _, childName := range childNames {
-		childPath := filepath.Join(path, childName)
-
-		if err = tagPath(store, tx, childPath, tagValuePairs, explicit, true, force, fileFingerprintAlg, dirFingerprintAlg); err != nil {
-			return err
-		}
-	}
-
-	return nil
-}
-
-func addFile(store *storage.Storage, tx *storage.Tx, path string, modTime time.Time, size uint, isDir bool, fileFingerprintAlg, dirFingerprintAlg string) (*entities.File, error) {
-	log.Infof(2, "%v: creating fingerprint", path)
-
-	fingerprint, err := fingerprint.Create(path, fileFingerprintAlg, dirFingerprintAlg)
-	if err != nil {
-		return nil, fmt.Errorf("%v: could not create fingerprint: %v", path, err)
-	}
-
-	log.Infof(2, "%v: adding file.", path)
-
-	file, err := store.AddFile(tx, path, fingerprint, modTime, int64(size), isDir)
-	if err != nil {
-		return nil, fmt.Errorf("%v: could not add file to database: %v", path, err)
-	}
-
-	return file, nil
-}
-
-func removeAlreadyAppliedTagValuePairs(store *storage.Storage, tx *storage.Tx, tagValuePairs []tagValuePair, file *entities.File) ([]tagValuePair, error) {
-	log.Infof(2, "%v: determining existing file-tags", file.Path())
-
-	existingFileTags, err := store.FileTagsByFileId(tx, file.Id, false)
-	if err != nil {
-		return nil, fmt.Errorf("%v: could not determine file's tags: %v", file.Path(), err)
-	}
-
-	log.Infof(2, "%v: determining implied tags", file.Path())
-
-	tagIds := make(entities.TagIds, len(tagValuePairs))
-	for index, tagValuePair := range tagValuePairs {
-		tagIds[index] = tagValuePair.TagId
-	}
-
-	newlyImpliedTags, err := store.ImplicationsForTags(tx, tagIds...)
-	if err != nil {
-		return nil, fmt.Errorf("%v: could not determine implied tags: %v", file.Path(), err)
-	}
-
-	log.Infof(2, "%v: revising set of tags to apply", file.Path())
-
-	revisedTagValuePairs := make([]tagValuePair, 0, len(tagValuePairs))
-	for _, tagValuePair := range tagValuePairs {
-		if existingFileTags.Contains(tagValuePair.TagId, tagValuePair.ValueId) {
-			continue
-		}
-
-		if tagValuePair.ValueId == 0 && newlyImpliedTags.Implies(tagValuePair.TagId) {
-			continue
-		}
-
-		revisedTagValuePairs = append(revisedTagValuePairs, tagValuePair)
+// Creates a reporter for tagging progress. As the number of files beneath a
+// directory is not known up front, progress is reported as a running count and
+// only when tagging recursively.
+func newTagReporter(recursive bool) *progress.Reporter {
+	if !recursive {
+		return progress.None()
 	}
 
-	return revisedTagValuePairs, nil
+	return progress.New("tagging", 0)
 }
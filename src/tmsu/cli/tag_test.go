@@ -16,8 +16,14 @@
 package cli
 
 import (
+	"io/ioutil"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"testing"
+	"time"
+	"tmsu/api"
 	"tmsu/storage"
 )
 
@@ -273,4 +279,814 @@ func TestTagMultipleFiles(test *testing.T) {
 	}
 }
 
+func TestTagSeparatedAndRepeatedTags(test *testing.T) {
+	// set-up
+
+	databasePath := testDatabase()
+	defer os.Remove(databasePath)
+
+	store, err := storage.OpenAt(databasePath)
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer store.Close()
+
+	for _, path := range []string{"/tmp/tmsu/a", "/tmp/tmsu/b", "/tmp/tmsu/c"} {
+		if err := createFile(path, path); err != nil {
+			test.Fatal(err)
+		}
+		defer os.Remove(path)
+	}
+
+	parser := NewOptionParser(Options{}, []*Command{&TagCommand})
+
+	// test
+
+	for _, args := range [][]string{{"tag", "/tmp/tmsu/a", "/tmp/tmsu/b", "--", "-funny", "apple=red"},
+		{"tag", "-t", "banana", "--tags", "cherry elder", "/tmp/tmsu/c"},
+		{"tag", "-t", "banana", "/tmp/tmsu/a", "--", "date"}} {
+		command, options, arguments, err := parser.Parse(args...)
+		if err != nil {
+			test.Fatal(err)
+		}
+
+		if err := command.Exec(store, options, arguments); err != nil {
+			test.Fatal(err)
+		}
+	}
+
+	// validate
+
+	tx, err := store.Begin()
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer tx.Commit()
+
+	expected := map[string][]string{"/tmp/tmsu/a": {"-funny", "apple", "banana", "date"},
+		"/tmp/tmsu/b": {"-funny", "apple"},
+		"/tmp/tmsu/c": {"banana", "cherry", "elder"}}
+
+	for path, tagNames := range expected {
+		file, err := store.FileByPath(tx, path)
+		if err != nil {
+			test.Fatal(err)
+		}
+		if file == nil {
+			test.Fatalf("File '%v' was not added.", path)
+		}
+
+		fileTags, err := store.FileTagsByFileId(tx, file.Id, true)
+		if err != nil {
+			test.Fatal(err)
+		}
+		if len(fileTags) != len(tagNames) {
+			test.Fatalf("File '%v' has %v tags but expected %v.", path, len(fileTags), len(tagNames))
+		}
+
+		tags, err := store.TagsByIds(tx, fileTags.TagIds())
+		if err != nil {
+			test.Fatal(err)
+		}
+
+		for _, tagName := range tagNames {
+			if !tags.ContainsName(tagName) {
+				test.Fatalf("File '%v' is not tagged '%v'.", path, tagName)
+			}
+		}
+	}
+}
+
 //TODO recursive
+
+func TestTagDryRun(test *testing.T) {
+	// set-up
+
+	databasePath := testDatabase()
+	defer os.Remove(databasePath)
+
+	store, err := storage.OpenAt(databasePath)
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer store.Close()
+
+	if err := createFile("/tmp/tmsu/a", "hello"); err != nil {
+		test.Fatal(err)
+	}
+	defer os.Remove("/tmp/tmsu/a")
+
+	// test
+
+	store.DryRun = true
+
+	if err := TagCommand.Exec(store, Options{}, []string{"/tmp/tmsu/a", "apple"}); err != nil {
+		test.Fatal(err)
+	}
+
+	store.DryRun = false
+
+	// validate
+
+	tx, err := store.Begin()
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer tx.Commit()
+
+	files, err := store.Files(tx, "")
+	if err != nil {
+		test.Fatal(err)
+	}
+	if len(files) != 0 {
+		test.Fatalf("Expected no files but are %v", len(files))
+	}
+
+	tags, err := store.Tags(tx)
+	if err != nil {
+		test.Fatal(err)
+	}
+	if len(tags) != 0 {
+		test.Fatalf("Expected no tags but are %v", len(tags))
+	}
+}
+
+func TestTagReadOnly(test *testing.T) {
+	// set-up
+
+	databasePath := testDatabase()
+	defer os.Remove(databasePath)
+
+	store, err := storage.OpenAt(databasePath)
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer store.Close()
+
+	if err := createFile("/tmp/tmsu/a", "hello"); err != nil {
+		test.Fatal(err)
+	}
+	defer os.Remove("/tmp/tmsu/a")
+
+	tx, err := store.Begin()
+	if err != nil {
+		test.Fatal(err)
+	}
+	if _, err := store.UpdateSetting(tx, "readOnly", "yes"); err != nil {
+		test.Fatal(err)
+	}
+	if err := tx.Commit(); err != nil {
+		test.Fatal(err)
+	}
+
+	// test
+
+	commandErr := processCommand(store, &TagCommand, Options{}, []string{"/tmp/tmsu/a", "apple"})
+	execErr := TagCommand.Exec(store, Options{}, []string{"/tmp/tmsu/a", "apple"})
+
+	// validate
+
+	if commandErr == nil {
+		test.Fatalf("Expected tag command to fail for a read-only database.")
+	}
+	if execErr == nil {
+		test.Fatalf("Expected tagging to fail for a read-only database.")
+	}
+
+	tx, err = store.Begin()
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer tx.Commit()
+
+	tags, err := store.Tags(tx)
+	if err != nil {
+		test.Fatal(err)
+	}
+	if len(tags) != 0 {
+		test.Fatalf("Expected no tags but are %v", len(tags))
+	}
+
+	if _, err := store.UpdateSetting(tx, "readOnly", "no"); err != nil {
+		test.Fatalf("Expected readOnly setting to be changeable: %v", err)
+	}
+}
+
+func TestTagLocked(test *testing.T) {
+	// set-up
+
+	databasePath := testDatabase()
+	defer os.Remove(databasePath)
+	defer os.Remove(databasePath + ".lock")
+
+	store, err := storage.OpenAt(databasePath)
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer store.Close()
+
+	if err := createFile("/tmp/tmsu/a", "hello"); err != nil {
+		test.Fatal(err)
+	}
+	defer os.Remove("/tmp/tmsu/a")
+
+	// another process's
+	other, err := storage.OpenAt(databasePath)
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer other.Close()
+
+	lock, err := other.LockForWriting("tmsu repair", true, nil)
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	// test
+
+	noWait := Options{Option{"--no-wait", "", "", false, ""}}
+	lockedErr := processCommand(store, &TagCommand, noWait, []string{"/tmp/tmsu/a", "apple"})
+
+	if err := lock.Release(); err != nil {
+		test.Fatal(err)
+	}
+
+	unlockedErr := processCommand(store, &TagCommand, noWait, []string{"/tmp/tmsu/a", "apple"})
+
+	// validate
+
+	lockedError, ok := lockedErr.(storage.LockedError)
+	if !ok {
+		test.Fatalf("Expected a locked error but was %v.", lockedErr)
+	}
+	if lockedError.Owner.Pid != os.Getpid() || lockedError.Owner.Command != "tmsu repair" {
+		test.Fatalf("Unexpected lock owner %v.", lockedError.Owner)
+	}
+	if unlockedErr != nil {
+		test.Fatal(unlockedErr)
+	}
+}
+
+func TestTagInheritDupeTags(test *testing.T) {
+	// set-up
+
+	databasePath := testDatabase()
+	defer os.Remove(databasePath)
+
+	store, err := storage.OpenAt(databasePath)
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer store.Close()
+
+	if err := createFile("/tmp/tmsu/a", "hello"); err != nil {
+		test.Fatal(err)
+	}
+	defer os.Remove("/tmp/tmsu/a")
+
+	if err := createFile("/tmp/tmsu/b", "hello"); err != nil {
+		test.Fatal(err)
+	}
+	defer os.Remove("/tmp/tmsu/b")
+
+	if err := TagCommand.Exec(store, Options{}, []string{"/tmp/tmsu/a", "apple", "banana"}); err != nil {
+		test.Fatal(err)
+	}
+
+	// test
+
+	if err := TagCommand.Exec(store, Options{Option{"--inherit-dupe-tags", "-i", "", false, ""}}, []string{"/tmp/tmsu/b", "cherry"}); err != nil {
+		test.Fatal(err)
+	}
+
+	// validate
+
+	tx, err := store.Begin()
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer tx.Commit()
+
+	file, err := store.FileByPath(tx, "/tmp/tmsu/b")
+	if err != nil {
+		test.Fatal(err)
+	}
+	if file == nil {
+		test.Fatalf("File was not added.")
+	}
+
+	tags, err := store.Tags(tx)
+	if err != nil {
+		test.Fatal(err)
+	}
+	if len(tags) != 3 {
+		test.Fatalf("Expected three tags but are %v", len(tags))
+	}
+
+	expectTags(test, store, tx, file, tags[0], tags[1], tags[2])
+}
+
+func TestTagSpacesInNames(test *testing.T) {
+	// set-up
+
+	databasePath := testDatabase()
+	defer os.Remove(databasePath)
+
+	err := redirectStreams()
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer restoreStreams()
+
+	store, err := storage.OpenAt(databasePath)
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer store.Close()
+
+	if err := createFile("/tmp/tmsu/a", "hello"); err != nil {
+		test.Fatal(err)
+	}
+	defer os.Remove("/tmp/tmsu/a")
+
+	if err := TagCommand.Exec(store, Options{}, []string{"/tmp/tmsu/a", "new york"}); err == nil {
+		test.Fatal("Expected tagging to fail for a tag name containing a space.")
+	}
+
+	if err := ConfigCommand.Exec(store, Options{}, []string{"allowSpacesInNames=yes"}); err != nil {
+		test.Fatal(err)
+	}
+
+	// test
+
+	if err := TagCommand.Exec(store, Options{Option{"--tags", "-t", "", true, "'new york' city"}}, []string{"/tmp/tmsu/a"}); err != nil {
+		test.Fatal(err)
+	}
+
+	if err := FilesCommand.Exec(store, Options{}, []string{`"new`, `york"`, "and", "city"}); err != nil {
+		test.Fatal(err)
+	}
+
+	// validate
+
+	outFile.Seek(0, 0)
+
+	bytes, err := ioutil.ReadAll(outFile)
+	compareOutput(test, "/tmp/tmsu/a\n", string(bytes))
+}
+
+func TestTagNoFingerprint(test *testing.T) {
+	// set-up
+
+	databasePath := testDatabase()
+	defer os.Remove(databasePath)
+
+	store, err := storage.OpenAt(databasePath)
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer store.Close()
+
+	if err := createFile("/tmp/tmsu/a", "hello"); err != nil {
+		test.Fatal(err)
+	}
+	defer os.Remove("/tmp/tmsu/a")
+
+	if err := createFile("/tmp/tmsu/b.log", "hello"); err != nil {
+		test.Fatal(err)
+	}
+	defer os.Remove("/tmp/tmsu/b.log")
+
+	if err := ConfigCommand.Exec(store, Options{}, []string{"pathOnlyFiles=*.log"}); err != nil {
+		test.Fatal(err)
+	}
+
+	// test
+
+	if err := TagCommand.Exec(store, Options{Option{"--no-fingerprint", "", "", false, ""}}, []string{"/tmp/tmsu/a", "apple"}); err != nil {
+		test.Fatal(err)
+	}
+
+	if err := TagCommand.Exec(store, Options{}, []string{"/tmp/tmsu/b.log", "banana"}); err != nil {
+		test.Fatal(err)
+	}
+
+	if err := createFile("/tmp/tmsu/a", "hello, world"); err != nil {
+		test.Fatal(err)
+	}
+
+	// validate
+
+	tx, err := store.Begin()
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer tx.Commit()
+
+	for _, path := range []string{"/tmp/tmsu/a", "/tmp/tmsu/b.log"} {
+		file, err := store.FileByPath(tx, path)
+		if err != nil {
+			test.Fatal(err)
+		}
+		if file == nil {
+			test.Fatalf("%v: file was not added.", path)
+		}
+		if file.Fingerprint != "" {
+			test.Fatalf("%v: expected no fingerprint but was '%v'.", path, file.Fingerprint)
+		}
+
+		pathOnly, err := store.FilePathOnly(tx, file.Id)
+		if err != nil {
+			test.Fatal(err)
+		}
+		if !pathOnly {
+			test.Fatalf("%v: expected file to be tracked by path only.", path)
+		}
+	}
+
+	report, err := statusPaths(store, tx, []string{"/tmp/tmsu/a"}, true, false)
+	if err != nil {
+		test.Fatal(err)
+	}
+	if len(report.Rows) != 1 || report.Rows[0].Status != TAGGED {
+		test.Fatalf("Expected modified path-only file to be reported as tagged but was %v.", report.Rows)
+	}
+}
+
+func TestTagForceVirtual(test *testing.T) {
+	// set-up
+
+	databasePath := testDatabase()
+	defer os.Remove(databasePath)
+
+	store, err := storage.OpenAt(databasePath)
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer store.Close()
+
+	os.Remove("/tmp/tmsu/v")
+	defer os.Remove("/tmp/tmsu/v")
+
+	// test
+
+	if err := TagCommand.Exec(store, Options{Option{"--force", "-F", "", false, ""}}, []string{"/tmp/tmsu/v", "todo"}); err != nil {
+		test.Fatal(err)
+	}
+
+	// validate
+
+	tx, err := store.Begin()
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	file, err := store.FileByPath(tx, "/tmp/tmsu/v")
+	if err != nil {
+		test.Fatal(err)
+	}
+	if file == nil {
+		test.Fatal("Virtual file was not added.")
+	}
+
+	virtual, err := store.FileVirtual(tx, file.Id)
+	if err != nil {
+		test.Fatal(err)
+	}
+	if !virtual {
+		test.Fatal("Expected file to be virtual.")
+	}
+
+	report, err := statusPaths(store, tx, []string{"/tmp/tmsu/v"}, true, false)
+	if err != nil {
+		test.Fatal(err)
+	}
+	if len(report.Rows) != 0 {
+		test.Fatalf("Expected virtual file not to be reported but was %v.", report.Rows)
+	}
+
+	report, err = statusPaths(store, tx, []string{"/tmp/tmsu/v"}, true, true)
+	if err != nil {
+		test.Fatal(err)
+	}
+	if len(report.Rows) != 1 || report.Rows[0].Status != MISSING {
+		test.Fatalf("Expected virtual file to be reported as missing but was %v.", report.Rows)
+	}
+
+	if err := tx.Commit(); err != nil {
+		test.Fatal(err)
+	}
+
+	// the file arrives
+
+	if err := createFile("/tmp/tmsu/v", "hello"); err != nil {
+		test.Fatal(err)
+	}
+
+	if err := TagCommand.Exec(store, Options{}, []string{"/tmp/tmsu/v", "done"}); err != nil {
+		test.Fatal(err)
+	}
+
+	tx, err = store.Begin()
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer tx.Commit()
+
+	file, err = store.FileByPath(tx, "/tmp/tmsu/v")
+	if err != nil {
+		test.Fatal(err)
+	}
+	if file.Fingerprint == "" {
+		test.Fatal("Expected arrived file to be fingerprinted.")
+	}
+
+	virtual, err = store.FileVirtual(tx, file.Id)
+	if err != nil {
+		test.Fatal(err)
+	}
+	if virtual {
+		test.Fatal("Expected arrived file not to be virtual.")
+	}
+}
+
+func TestTagURL(test *testing.T) {
+	// set-up
+
+	databasePath := testDatabase()
+	defer os.Remove(databasePath)
+
+	err := redirectStreams()
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer restoreStreams()
+
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		if request.URL.Path == "/tagged" {
+			writer.Header().Set("ETag", `"abc123"`)
+		}
+		writer.Write([]byte("hello"))
+	}))
+	defer server.Close()
+
+	store, err := storage.OpenAt(databasePath)
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer store.Close()
+
+	// test
+
+	if err := TagCommand.Exec(store, Options{}, []string{server.URL + "/tagged", "bookmark"}); err != nil {
+		test.Fatal(err)
+	}
+	if err := TagCommand.Exec(store, Options{}, []string{server.URL + "/docs/page", "bookmark"}); err != nil {
+		test.Fatal(err)
+	}
+	if err := FilesCommand.Exec(store, Options{}, []string{"bookmark"}); err != nil {
+		test.Fatal(err)
+	}
+
+	// validate
+
+	tx, err := store.Begin()
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer tx.Commit()
+
+	fingerprints := map[string]string{
+		server.URL + "/tagged":    "etag:abc123",
+		server.URL + "/docs/page": "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824"}
+
+	for url, expected := range fingerprints {
+		file, err := store.FileByPath(tx, url)
+		if err != nil {
+			test.Fatal(err)
+		}
+		if file == nil {
+			test.Fatalf("%v: resource was not added.", url)
+		}
+		if file.Path() != url {
+			test.Fatalf("Expected path '%v' but was '%v'.", url, file.Path())
+		}
+		if string(file.Fingerprint) != expected {
+			test.Fatalf("%v: expected fingerprint '%v' but was '%v'.", url, expected, file.Fingerprint)
+		}
+	}
+
+	outFile.Seek(0, 0)
+
+	bytes, err := ioutil.ReadAll(outFile)
+	compareOutput(test, server.URL+"/docs/page\n"+server.URL+"/tagged\n", string(bytes))
+}
+
+func TestTagManyTags(test *testing.T) {
+	// set-up
+
+	databasePath := testDatabase()
+	defer os.Remove(databasePath)
+
+	store, err := storage.OpenAt(databasePath)
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer store.Close()
+
+	if err := createFile("/tmp/tmsu/a", "hello"); err != nil {
+		test.Fatal(err)
+	}
+	defer os.Remove("/tmp/tmsu/a")
+
+	if err := TagCommand.Exec(store, Options{}, []string{"/tmp/tmsu/a", "tag7"}); err != nil {
+		test.Fatal(err)
+	}
+
+	// test
+
+	args := []string{"/tmp/tmsu/a"}
+	for index := 0; index < 250; index++ {
+		args = append(args, fmt.Sprintf("tag%v=%v", index, index%3))
+	}
+	args = append(args, "tag7")
+
+	if err := TagCommand.Exec(store, Options{}, args); err != nil {
+		test.Fatal(err)
+	}
+
+	// validate
+
+	tx, err := store.Begin()
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer tx.Commit()
+
+	fileTags, err := store.FileTags(tx)
+	if err != nil {
+		test.Fatal(err)
+	}
+	if len(fileTags) != 251 {
+		test.Fatalf("Expected 251 file-tags but are %v", len(fileTags))
+	}
+
+	events, err := store.FileTagEvents(tx, "/tmp/tmsu/a")
+	if err != nil {
+		test.Fatal(err)
+	}
+	if len(events) != 251 {
+		test.Fatalf("Expected 251 history events but are %v", len(events))
+	}
+}
+
+func TestTagUntil(test *testing.T) {
+	// set-up
+
+	databasePath := testDatabase()
+	defer os.Remove(databasePath)
+
+	store, err := storage.OpenAt(databasePath)
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer store.Close()
+
+	for _, path := range []string{"/tmp/tmsu/a", "/tmp/tmsu/b"} {
+		if err := createFile(path, path); err != nil {
+			test.Fatal(err)
+		}
+		defer os.Remove(path)
+	}
+
+	parser := NewOptionParser(Options{}, []*Command{&TagCommand})
+
+	for _, args := range [][]string{{"tag", "--until", "+7d", "/tmp/tmsu/a", "apple"},
+		{"tag", "/tmp/tmsu/a", "banana"},
+		{"tag", "-u", "+1d", "/tmp/tmsu/b", "apple"}} {
+		command, options, arguments, err := parser.Parse(args...)
+		if err != nil {
+			test.Fatal(err)
+		}
+
+		if err := command.Exec(store, options, arguments); err != nil {
+			test.Fatal(err)
+		}
+	}
+
+	command, options, arguments, err := parser.Parse("tag", "--until", "-1d", "/tmp/tmsu/b", "banana")
+	if err != nil {
+		test.Fatal(err)
+	}
+	if err := command.Exec(store, options, arguments); err == nil {
+		test.Fatal("Expected a date in the past to be rejected.")
+	}
+
+	tx, err := store.Begin()
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	fileA, err := store.FileByPath(tx, "/tmp/tmsu/a")
+	if err != nil {
+		test.Fatal(err)
+	}
+	fileB, err := store.FileByPath(tx, "/tmp/tmsu/b")
+	if err != nil {
+		test.Fatal(err)
+	}
+	apple, err := store.TagByName(tx, "apple")
+	if err != nil {
+		test.Fatal(err)
+	}
+	banana, err := store.TagByName(tx, "banana")
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	expiries, err := store.FileTagExpiriesByFileId(tx, fileA.Id)
+	if err != nil {
+		test.Fatal(err)
+	}
+	if len(expiries) != 1 || expiries[0].TagId != apple.Id {
+		test.Fatalf("Expected only 'apple' to expire but got %v expiries.", len(expiries))
+	}
+	if !expiries[0].Expires.After(time.Now().AddDate(0, 0, 6)) {
+		test.Fatalf("Expiry %v is not a week hence.", expiries[0].Expires)
+	}
+
+	// test
+
+	if err := store.SetFileTagExpiry(tx, fileA.Id, apple.Id, 0, time.Now().Add(-time.Minute)); err != nil {
+		test.Fatal(err)
+	}
+	tx.Commit()
+
+	if err := expireTags(store); err != nil {
+		test.Fatal(err)
+	}
+
+	// validate
+
+	tx, err = store.Begin()
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	expectTags(test, store, tx, fileA, banana)
+	expectTags(test, store, tx, fileB, apple)
+
+	// test archive
+
+	if _, err := store.UpdateSetting(tx, "expiredTags", "archive"); err != nil {
+		test.Fatal(err)
+	}
+	if err := store.SetFileTagExpiry(tx, fileB.Id, apple.Id, 0, time.Now().Add(-time.Minute)); err != nil {
+		test.Fatal(err)
+	}
+	tx.Commit()
+
+	if err := expireTags(store); err != nil {
+		test.Fatal(err)
+	}
+
+	// validate archive
+
+	tx, err = store.Begin()
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer tx.Commit()
+
+	expired, err := store.TagByName(tx, api.ExpiredTag)
+	if err != nil {
+		test.Fatal(err)
+	}
+	if expired == nil {
+		test.Fatal("Tag 'expired' was not created.")
+	}
+
+	fileTags, err := store.FileTagsByFileId(tx, fileB.Id, true)
+	if err != nil {
+		test.Fatal(err)
+	}
+	if len(fileTags) != 1 || fileTags[0].TagId != expired.Id {
+		test.Fatalf("Expected '/tmp/tmsu/b' to be tagged only 'expired' but it has %v tags.", len(fileTags))
+	}
+
+	value, err := store.Value(tx, fileTags[0].ValueId)
+	if err != nil {
+		test.Fatal(err)
+	}
+	if value == nil || value.Name != "apple" {
+		test.Fatal("Expected the archived tag to have the value 'apple'.")
+	}
+
+	remaining, err := store.ExpiredFileTags(tx, time.Now())
+	if err != nil {
+		test.Fatal(err)
+	}
+	if len(remaining) != 0 {
+		test.Fatalf("Expected no expired tags to remain but %v do.", len(remaining))
+	}
+}
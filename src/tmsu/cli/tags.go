@@ -16,13 +16,17 @@
 package cli
 
 import (
+	"bufio"
 	"fmt"
 	"os"
-	"path/filepath"
 	"strconv"
+	"strings"
+	"tmsu/api"
 	"tmsu/common/log"
+	_path "tmsu/common/path"
 	"tmsu/common/terminal"
 	"tmsu/common/terminal/ansi"
+	"tmsu/common/text"
 	"tmsu/entities"
 	"tmsu/storage"
 )
@@ -39,16 +43,38 @@ When color is turned on, tags are shown in the following colors:
   'Cyan'    Tag implied by other tags
   'Yellow'  Tag is both explicitly applied and implied by other tags
 
+Wherever tags are listed separated by spaces, any spaces, quotation marks or backslashes within tag and value names are escaped by a backslash, so that the list can be given back to 'tmsu tag --tags' or a query.
+
+With --under only the tags applied to files matching QUERY are listed, which allows a search to be narrowed step by step. With --usage the number of files each tag is applied to is shown alongside it.
+
+With --aggregate the tags applied to anything beneath DIR are listed, each with the number of files and directories beneath DIR it is applied to, so that how a directory tree has been categorised can be seen at a glance.
+
+With --one-line the tags of each FILE are printed on a single line, separated by spaces and without color or the file name. Files that are not tagged or do not exist result in a blank line rather than a warning. This stable format is intended for file manager preview panes, such as those of ranger, nnn or lf, which call TMSU on every cursor move.
+
+With --for-each-stdin the paths of files are read from standard input, one per line, and for each a line holding the path, a tab and the tags in the --one-line format is printed as soon as the path is read. A single process can thereby serve the tags of many files to a file manager.
+
 See the 'imply' subcommand for more information on implied tags.`,
 	Examples: []string{"$ tmsu tags\nmp3  music  opera",
 		"$ tmsu tags tralala.mp3\nmp3  music  opera",
 		"$ tmsu tags tralala.mp3 boom.mp3\n./tralala.mp3: mp3 music opera\n./boom.mp3: mp3 music drum-n-bass",
-		"$ tmsu tags --count tralala.mp3"},
+		"$ tmsu tags --count tralala.mp3",
+		"$ tmsu tags --long tralala.mp3\nmp3    bob  2015-06-01 20:14:02\nmusic  bob  2015-06-01 20:14:02\nopera  sue  2015-06-03 09:41:57",
+		"$ tmsu tags --usage --under 'music and not mp3'\n 2 flac\n12 music\n 9 opera",
+		"$ tmsu tags --aggregate ~/music\n 3 flac\n14 mp3\n17 music\n 9 opera",
+		"$ tmsu tags --one-line tralala.mp3\nmp3 music opera",
+		"$ printf 'tralala.mp3\\nboom.mp3\\n' | tmsu tags --for-each-stdin\ntralala.mp3\tmp3 music opera\nboom.mp3\tmp3 music drum-n-bass"},
 	Options: Options{{"--count", "-c", "lists the number of tags rather than their names", false, ""},
 		{"", "-1", "list one tag per line", false, ""},
 		{"--explicit", "-e", "do not show implied tags", false, ""},
-		{"--name", "-n", "always print the file name", false, ""}},
-	Exec: tagsExec,
+		{"--name", "-n", "always print the file name", false, ""},
+		{"--long", "-l", "show who applied each tag and when, one tag per line", false, ""},
+		{"--under", "-u", "list only tags applied to files matching QUERY", true, ""},
+		{"--usage", "", "show the number of files each tag is applied to", false, ""},
+		{"--aggregate", "-a", "list the tags applied beneath DIR with the number of files", true, ""},
+		{"--one-line", "", "print the tags of each file on a single line, silently", false, ""},
+		{"--for-each-stdin", "", "print the tags of each file read from standard input", false, ""}},
+	Exec:      tagsExec,
+	Federated: true,
 }
 
 func tagsExec(store *storage.Storage, options Options, args []string) error {
@@ -56,22 +82,57 @@ func tagsExec(store *storage.Storage, options Options, args []string) error {
 	onePerLine := options.HasOption("-1")
 	explicitOnly := options.HasOption("--explicit")
 	printPath := options.HasOption("--name")
+	long := options.HasOption("--long")
+	usage := options.HasOption("--usage")
 	colour, err := useColour(options)
 	if err != nil {
 		return err
 	}
 
+	if options.HasOption("--for-each-stdin") {
+		if len(args) > 0 {
+			return fmt.Errorf("files cannot be specified with --for-each-stdin")
+		}
+
+		return listTagsForStandardInput(store, explicitOnly)
+	}
+
 	tx, err := store.Begin()
 	if err != nil {
 		return err
 	}
 	defer tx.Commit()
 
+	if options.HasOption("--one-line") {
+		return listTagsOneLine(store, tx, args, explicitOnly)
+	}
+
+	if options.HasOption("--aggregate") {
+		if len(args) > 0 || options.HasOption("--under") {
+			return fmt.Errorf("files and --under cannot be specified with --aggregate")
+		}
+
+		return listAggregateTags(store, tx, options.Get("--aggregate").Argument, showCount, explicitOnly, colour)
+	}
+
+	if options.HasOption("--under") || usage {
+		if len(args) > 0 {
+			return fmt.Errorf("files cannot be specified with --under or --usage")
+		}
+
+		queryText := ""
+		if options.HasOption("--under") {
+			queryText = options.Get("--under").Argument
+		}
+
+		return listTagUsage(store, tx, queryText, showCount, onePerLine, explicitOnly, usage, colour)
+	}
+
 	if len(args) == 0 {
 		return listAllTags(store, tx, showCount, onePerLine, colour)
 	}
 
-	return listTagsForPaths(store, tx, args, showCount, onePerLine, explicitOnly, printPath, colour)
+	return listTagsForPaths(store, tx, args, showCount, onePerLine, explicitOnly, printPath, long, colour)
 }
 
 func listAllTags(store *storage.Storage, tx *storage.Tx, showCount, onePerLine, colour bool) error {
@@ -100,22 +161,109 @@ func listAllTags(store *storage.Storage, tx *storage.Tx, showCount, onePerLine,
 				fmt.Println(tagName)
 			}
 		} else {
-			terminal.PrintColumns(tagNames)
+			terminal.PrintColumns(escapeNames(tagNames))
 		}
 	}
 
 	return nil
 }
 
-func listTagsForPaths(store *storage.Storage, tx *storage.Tx, paths []string, showCount, onePerLine, explicitOnly, printPath, colour bool) error {
+// Lists the tags applied to the files matching the query, optionally with the
+// number of those files each is applied to.
+func listTagUsage(store *storage.Storage, tx *storage.Tx, queryText string, showCount, onePerLine, explicitOnly, usage, colour bool) error {
+	log.Info(2, "retrieving tag usage.")
+
+	files, err := api.QueryFiles(store, tx, queryText, api.QueryOptions{ExplicitOnly: explicitOnly, Sort: "none"})
+	if err != nil {
+		if noSuchTags, ok := err.(api.NoSuchTagsError); ok {
+			for _, tagName := range noSuchTags.Names {
+				log.Warnf("no such tag '%v'.", tagName)
+			}
+
+			return errNoSuchTag
+		}
+
+		return err
+	}
+
+	tagStats, err := api.TagUsage(store, tx, files, explicitOnly)
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case showCount:
+		fmt.Println(len(tagStats))
+	case usage:
+		printTagUsage(tagStats, colour)
+	default:
+		tagNames := make([]string, len(tagStats))
+		for index, tagStat := range tagStats {
+			tagNames[index] = tagStat.Name
+		}
+
+		if onePerLine {
+			for _, tagName := range tagNames {
+				fmt.Println(tagName)
+			}
+		} else {
+			terminal.PrintColumns(escapeNames(tagNames))
+		}
+	}
+
+	return nil
+}
+
+func listAggregateTags(store *storage.Storage, tx *storage.Tx, path string, showCount, explicitOnly, colour bool) error {
+	log.Infof(2, "%v: retrieving tags applied beneath directory.", path)
+
+	absPath, err := _path.Abs(path)
+	if err != nil {
+		return err
+	}
+
+	files, err := store.FilesByDirectory(tx, absPath)
+	if err != nil {
+		return fmt.Errorf("%v: could not retrieve files: %v", path, err)
+	}
+
+	tagStats, err := api.TagUsage(store, tx, files, explicitOnly)
+	if err != nil {
+		return err
+	}
+
+	if showCount {
+		fmt.Println(len(tagStats))
+	} else {
+		printTagUsage(tagStats, colour)
+	}
+
+	return nil
+}
+
+func printTagUsage(tagStats []api.TagStatistic, colour bool) {
+	var max uint
+	for _, tagStat := range tagStats {
+		if tagStat.Files > max {
+			max = tagStat.Files
+		}
+	}
+
+	for _, tagStat := range tagStats {
+		fmt.Printf("%v %v\n", formatStatsCount(max, tagStat.Files, colour), tagStat.Name)
+	}
+}
+
+func listTagsForPaths(store *storage.Storage, tx *storage.Tx, paths []string, showCount, onePerLine, explicitOnly, printPath, long, colour bool) error {
 	wereErrors := false
-	printPath = printPath || len(paths) > 1 || !stdoutIsCharDevice()
+	printPath = printPath || len(paths) > 1 || !stdoutIsCharDevice() || absolutePaths
 
 	for index, path := range paths {
-		absPath, err := filepath.Abs(path)
+		absPath, err := _path.Abs(path)
 		if err != nil {
 			return err
 		}
+		path = displayPath(path)
 
 		log.Infof(2, "%v: retrieving tags.", path)
 
@@ -127,7 +275,11 @@ func listTagsForPaths(store *storage.Storage, tx *storage.Tx, paths []string, sh
 
 		var tagNames []string
 		if file != nil {
-			tagNames, err = tagNamesForFile(store, tx, file.Id, explicitOnly, colour)
+			if long && !showCount {
+				tagNames, err = tagDetailsForFile(store, tx, file.Id, explicitOnly, colour)
+			} else {
+				tagNames, err = tagNamesForFile(store, tx, file.Id, explicitOnly, colour)
+			}
 			if err != nil {
 				return err
 			}
@@ -156,7 +308,7 @@ func listTagsForPaths(store *storage.Storage, tx *storage.Tx, paths []string, sh
 			}
 
 			fmt.Println(strconv.Itoa(len(tagNames)))
-		case onePerLine:
+		case onePerLine, long:
 			if index > 0 {
 				fmt.Println()
 			}
@@ -172,13 +324,13 @@ func listTagsForPaths(store *storage.Storage, tx *storage.Tx, paths []string, sh
 			if printPath {
 				fmt.Print(path + ":")
 
-				for _, tagName := range tagNames {
+				for _, tagName := range escapeNames(tagNames) {
 					fmt.Print(" " + tagName)
 				}
 
 				fmt.Println()
 			} else {
-				terminal.PrintColumns(tagNames)
+				terminal.PrintColumns(escapeNames(tagNames))
 			}
 		}
 	}
@@ -190,6 +342,91 @@ func listTagsForPaths(store *storage.Storage, tx *storage.Tx, paths []string, sh
 	return nil
 }
 
+// Prints the tags of each file on a line of its own. Problems with the files
+// are only reported verbosely so that the output is predictable.
+func listTagsOneLine(store *storage.Storage, tx *storage.Tx, paths []string, explicitOnly bool) error {
+	for _, path := range paths {
+		line, err := oneLineTags(store, tx, path, explicitOnly)
+		if err != nil {
+			return err
+		}
+
+		fmt.Println(line)
+	}
+
+	return nil
+}
+
+// Prints a line with the tags of each file named on standard input as it is
+// read. Each path is looked up in its own transaction so that the database is
+// not held open between requests.
+func listTagsForStandardInput(store *storage.Storage, explicitOnly bool) error {
+	scanner := bufio.NewScanner(os.Stdin)
+	for scanner.Scan() {
+		path := scanner.Text()
+		if path == "" {
+			continue
+		}
+
+		tx, err := store.Begin()
+		if err != nil {
+			return err
+		}
+
+		line, err := oneLineTags(store, tx, path, explicitOnly)
+		tx.Commit()
+		if err != nil {
+			return err
+		}
+
+		fmt.Println(path + "\t" + line)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("could not read standard input: %v", err)
+	}
+
+	return nil
+}
+
+// The tags of the file as a single line, which is empty if the file is not
+// tagged or cannot be found.
+func oneLineTags(store *storage.Storage, tx *storage.Tx, path string, explicitOnly bool) (string, error) {
+	absPath, err := _path.Abs(path)
+	if err != nil {
+		log.Infof(2, "%v: could not get absolute path: %v", path, err)
+		return "", nil
+	}
+
+	file, err := store.FileByPath(tx, absPath)
+	if err != nil {
+		return "", fmt.Errorf("%v: could not retrieve file: %v", path, err)
+	}
+	if file == nil {
+		log.Infof(2, "%v: not tagged", path)
+		return "", nil
+	}
+
+	tagNames, err := tagNamesForFile(store, tx, file.Id, explicitOnly, false)
+	if err != nil {
+		return "", err
+	}
+
+	return strings.Join(escapeNames(tagNames), " "), nil
+}
+
+// The names with their spaces, quotation marks and backslashes escaped so that,
+// joined with spaces, they read back as the same names from --tags, standard
+// input and queries.
+func escapeNames(names []string) []string {
+	escaped := make([]string, len(names))
+	for index, name := range names {
+		escaped[index] = text.Escape(name)
+	}
+
+	return escaped
+}
+
 func tagNamesForFile(store *storage.Storage, tx *storage.Tx, fileId entities.FileId, explicitOnly, colour bool) ([]string, error) {
 	fileTags, err := store.FileTagsByFileId(tx, fileId, explicitOnly)
 	if err != nil {
@@ -199,43 +436,119 @@ func tagNamesForFile(store *storage.Storage, tx *storage.Tx, fileId entities.Fil
 	tagNames := make([]string, len(fileTags))
 
 	for index, fileTag := range fileTags {
-		tag, err := store.Tag(tx, fileTag.TagId)
+		tagName, err := fileTagName(store, tx, fileTag, colour)
 		if err != nil {
-			return nil, fmt.Errorf("could not lookup tag: %v", err)
+			return nil, err
 		}
-		if tag == nil {
-			return nil, fmt.Errorf("tag '%v' does not exist", fileTag.TagId)
+
+		tagNames[index] = tagName
+	}
+
+	ansi.Sort(tagNames)
+
+	return tagNames, nil
+}
+
+// Describes each tag applied to the file along with who applied it and when.
+func tagDetailsForFile(store *storage.Storage, tx *storage.Tx, fileId entities.FileId, explicitOnly, colour bool) ([]string, error) {
+	fileTags, err := store.FileTagsByFileId(tx, fileId, explicitOnly)
+	if err != nil {
+		return nil, fmt.Errorf("could not retrieve file-tags for file '%v': %v", fileId, err)
+	}
+
+	tagNames := make([]string, len(fileTags))
+	width := 0
+	for index, fileTag := range fileTags {
+		tagName, err := fileTagName(store, tx, fileTag, false)
+		if err != nil {
+			return nil, err
 		}
 
-		var tagName string
-		if fileTag.ValueId == 0 {
-			tagName = tag.Name
-		} else {
-			value, err := store.Value(tx, fileTag.ValueId)
-			if err != nil {
-				return nil, fmt.Errorf("could not lookup value: %v", err)
-			}
-			if value == nil {
-				return nil, fmt.Errorf("value '%v' does not exist", fileTag.ValueId)
+		tagNames[index] = tagName
+		if len(tagName) > width {
+			width = len(tagName)
+		}
+	}
+
+	usernames := make([]string, len(fileTags))
+	usernameWidth := 0
+	for index, fileTag := range fileTags {
+		usernames[index] = fileTag.Username
+		if usernames[index] == "" {
+			usernames[index] = "-"
+		}
+		if len(usernames[index]) > usernameWidth {
+			usernameWidth = len(usernames[index])
+		}
+	}
+
+	details := make([]string, len(fileTags))
+	for index, fileTag := range fileTags {
+		var attribution string
+		if fileTag.Explicit {
+			when := "-"
+			if !fileTag.Time.IsZero() {
+				when = fileTag.Time.Local().Format("2006-01-02 15:04:05")
 			}
 
-			tagName = tag.Name + "=" + value.Name
+			attribution = usernames[index] + strings.Repeat(" ", usernameWidth-len(usernames[index])) + "  " + when
+		} else {
+			attribution = "(implied)"
 		}
 
+		tagName := tagNames[index]
+		padding := strings.Repeat(" ", width-len(tagName))
 		if colour {
-			if fileTag.Implicit {
-				if fileTag.Explicit {
-					tagName = ansi.Yellow(tagName)
-				} else {
-					tagName = ansi.Cyan(tagName)
-				}
-			}
+			tagName = colourTagName(tagName, fileTag)
 		}
 
-		tagNames[index] = tagName
+		details[index] = tagName + padding + "  " + attribution
 	}
 
-	ansi.Sort(tagNames)
+	ansi.Sort(details)
 
-	return tagNames, nil
+	return details, nil
+}
+
+func fileTagName(store *storage.Storage, tx *storage.Tx, fileTag *entities.FileTag, colour bool) (string, error) {
+	tag, err := store.Tag(tx, fileTag.TagId)
+	if err != nil {
+		return "", fmt.Errorf("could not lookup tag: %v", err)
+	}
+	if tag == nil {
+		return "", fmt.Errorf("tag '%v' does not exist", fileTag.TagId)
+	}
+
+	var tagName string
+	if fileTag.ValueId == 0 {
+		tagName = tag.Name
+	} else {
+		value, err := store.Value(tx, fileTag.ValueId)
+		if err != nil {
+			return "", fmt.Errorf("could not lookup value: %v", err)
+		}
+		if value == nil {
+			return "", fmt.Errorf("value '%v' does not exist", fileTag.ValueId)
+		}
+
+		tagName = tag.Name + "=" + value.Name
+	}
+
+	if colour {
+		tagName = colourTagName(tagName, fileTag)
+	}
+
+	return tagName, nil
+}
+
+func colourTagName(tagName string, fileTag *entities.FileTag) string {
+	if fileTag.Implicit {
+		if fileTag.Explicit {
+			return ansi.Yellow(tagName)
+		}
+
+		return ansi.Cyan(tagName)
+	}
+
+	return tagName
 }
@@ -18,9 +18,12 @@ package cli
 import (
 	"io/ioutil"
 	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 	"tmsu/common/fingerprint"
+	"tmsu/common/text"
 	"tmsu/storage"
 )
 
@@ -217,6 +220,62 @@ func TestAllTags(test *testing.T) {
 	compareOutput(test, "apple\nbanana\n", string(bytes))
 }
 
+func TestAllTagsCollated(test *testing.T) {
+	// set-up
+
+	databasePath := testDatabase()
+	defer os.Remove(databasePath)
+
+	err := redirectStreams()
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer restoreStreams()
+
+	store, err := storage.OpenAt(databasePath)
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer store.Close()
+
+	tx, err := store.Begin()
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	for _, tagName := range []string{"disc10", "Disc2", "disc1"} {
+		if _, err := store.AddTag(tx, tagName); err != nil {
+			test.Fatal(err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		test.Fatal(err)
+	}
+
+	if err := ConfigCommand.Exec(store, Options{}, []string{"collation=locale"}); err != nil {
+		test.Fatal(err)
+	}
+
+	defer text.SetCollation(text.Collation{})
+	if err := applySortSettings(store, true); err != nil {
+		test.Fatal(err)
+	}
+
+	// test
+
+	if err := TagsCommand.Exec(store, Options{Option{"", "-1", "", false, ""}}, []string{}); err != nil {
+		test.Fatal(err)
+	}
+
+	// verify
+
+	outFile.Seek(0, 0)
+
+	bytes, err := ioutil.ReadAll(outFile)
+	compareOutput(test, "disc1\nDisc2\ndisc10\n", string(bytes))
+}
+
 func TestImpliedTags(test *testing.T) {
 	// set-up
 
@@ -290,3 +349,286 @@ func TestImpliedTags(test *testing.T) {
 	bytes, err := ioutil.ReadAll(outFile)
 	compareOutput(test, "/tmp/tmsu/a: apple food fruit\n", string(bytes))
 }
+
+func TestTagUsageUnderQuery(test *testing.T) {
+	// set-up
+
+	databasePath := testDatabase()
+	defer os.Remove(databasePath)
+
+	err := redirectStreams()
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer restoreStreams()
+
+	store, err := storage.OpenAt(databasePath)
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer store.Close()
+
+	tx, err := store.Begin()
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	paths := []string{"/tmp/a", "/tmp/b", "/tmp/c"}
+	tagNames := [][]string{{"music", "flac"}, {"music", "opera"}, {"film"}}
+
+	for index, path := range paths {
+		file, err := store.AddFile(tx, path, fingerprint.Fingerprint(path), time.Now(), 123, false)
+		if err != nil {
+			test.Fatal(err)
+		}
+
+		for _, tagName := range tagNames[index] {
+			tag, err := store.TagByName(tx, tagName)
+			if err != nil {
+				test.Fatal(err)
+			}
+			if tag == nil {
+				if tag, err = store.AddTag(tx, tagName); err != nil {
+					test.Fatal(err)
+				}
+			}
+
+			if _, err := store.AddFileTag(tx, file.Id, tag.Id, 0); err != nil {
+				test.Fatal(err)
+			}
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		test.Fatal(err)
+	}
+
+	// test
+
+	options := Options{Option{"--under", "-u", "", true, "music"}, Option{"--usage", "", "", false, ""}}
+	if err := TagsCommand.Exec(store, options, []string{}); err != nil {
+		test.Fatal(err)
+	}
+
+	// validate
+
+	outFile.Seek(0, 0)
+
+	bytes, err := ioutil.ReadAll(outFile)
+	compareOutput(test, "1 flac\n2 music\n1 opera\n", string(bytes))
+}
+
+func TestTagsOneLineAndForEachStdin(test *testing.T) {
+	// set-up
+
+	databasePath := testDatabase()
+	defer os.Remove(databasePath)
+
+	err := redirectStreams()
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer restoreStreams()
+
+	store, err := storage.OpenAt(databasePath)
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer store.Close()
+
+	tx, err := store.Begin()
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	file, err := store.AddFile(tx, "/tmp/a", fingerprint.Fingerprint("/tmp/a"), time.Now(), 123, false)
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	for _, tagName := range []string{"music", "flac"} {
+		tag, err := store.AddTag(tx, tagName)
+		if err != nil {
+			test.Fatal(err)
+		}
+
+		if _, err := store.AddFileTag(tx, file.Id, tag.Id, 0); err != nil {
+			test.Fatal(err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		test.Fatal(err)
+	}
+
+	inPath := filepath.Join(os.TempDir(), "tmsu_test.in")
+	if err := ioutil.WriteFile(inPath, []byte("/tmp/a\n/tmp/tmsu/missing\n"), 0644); err != nil {
+		test.Fatal(err)
+	}
+	defer os.Remove(inPath)
+
+	inFile, err := os.Open(inPath)
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer inFile.Close()
+
+	stdin := os.Stdin
+	os.Stdin = inFile
+	defer func() { os.Stdin = stdin }()
+
+	// test
+
+	if err := TagsCommand.Exec(store, Options{Option{"--one-line", "", "", false, ""}}, []string{"/tmp/a", "/tmp/tmsu/missing"}); err != nil {
+		test.Fatal(err)
+	}
+	if err := TagsCommand.Exec(store, Options{Option{"--for-each-stdin", "", "", false, ""}}, []string{}); err != nil {
+		test.Fatal(err)
+	}
+
+	// validate
+
+	outFile.Seek(0, 0)
+
+	bytes, err := ioutil.ReadAll(outFile)
+	compareOutput(test, "flac music\n\n/tmp/a\tflac music\n/tmp/tmsu/missing\t\n", string(bytes))
+
+	errFile.Seek(0, 0)
+
+	bytes, err = ioutil.ReadAll(errFile)
+	if strings.Contains(string(bytes), "missing") {
+		test.Fatalf("Expected no warning for the untracked file but was: %v", string(bytes))
+	}
+}
+
+func TestTagsRoundTripsNamesContainingSpaces(test *testing.T) {
+	// set-up
+
+	databasePath := testDatabase()
+	defer os.Remove(databasePath)
+
+	err := redirectStreams()
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer restoreStreams()
+
+	store, err := storage.OpenAt(databasePath)
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer store.Close()
+
+	for _, path := range []string{"/tmp/tmsu/a", "/tmp/tmsu/b"} {
+		if err := createFile(path, "hello"); err != nil {
+			test.Fatal(err)
+		}
+		defer os.Remove(path)
+	}
+
+	if err := ConfigCommand.Exec(store, Options{}, []string{"allowSpacesInNames=yes"}); err != nil {
+		test.Fatal(err)
+	}
+
+	if err := TagCommand.Exec(store, Options{Option{"--tags", "-t", "", true, `'new york' city "o'hare"`}}, []string{"/tmp/tmsu/a"}); err != nil {
+		test.Fatal(err)
+	}
+
+	// test
+
+	if err := TagsCommand.Exec(store, Options{}, []string{"/tmp/tmsu/a"}); err != nil {
+		test.Fatal(err)
+	}
+
+	outFile.Seek(0, 0)
+
+	bytes, err := ioutil.ReadAll(outFile)
+	compareOutput(test, `/tmp/tmsu/a: city new\ york o\'hare`+"\n", string(bytes))
+
+	tagNames := strings.TrimPrefix(strings.TrimSuffix(string(bytes), "\n"), "/tmp/tmsu/a: ")
+	if err := TagCommand.Exec(store, Options{Option{"--tags", "-t", "", true, tagNames}}, []string{"/tmp/tmsu/b"}); err != nil {
+		test.Fatal(err)
+	}
+
+	// validate
+
+	outFile.Truncate(0)
+	outFile.Seek(0, 0)
+
+	if err := TagsCommand.Exec(store, Options{}, []string{"/tmp/tmsu/b"}); err != nil {
+		test.Fatal(err)
+	}
+
+	outFile.Seek(0, 0)
+
+	bytes, err = ioutil.ReadAll(outFile)
+	compareOutput(test, `/tmp/tmsu/b: city new\ york o\'hare`+"\n", string(bytes))
+}
+
+func TestTagsAggregate(test *testing.T) {
+	// set-up
+
+	databasePath := testDatabase()
+	defer os.Remove(databasePath)
+
+	err := redirectStreams()
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer restoreStreams()
+
+	store, err := storage.OpenAt(databasePath)
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer store.Close()
+
+	tx, err := store.Begin()
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	paths := []string{"/tmp/music", "/tmp/music/a", "/tmp/music/opera/b", "/tmp/musical/c", "/tmp/d"}
+	tagNames := [][]string{{"collection"}, {"music", "flac"}, {"music", "opera"}, {"film"}, {"music"}}
+
+	for index, path := range paths {
+		file, err := store.AddFile(tx, path, fingerprint.Fingerprint(path), time.Now(), 123, false)
+		if err != nil {
+			test.Fatal(err)
+		}
+
+		for _, tagName := range tagNames[index] {
+			tag, err := store.TagByName(tx, tagName)
+			if err != nil {
+				test.Fatal(err)
+			}
+			if tag == nil {
+				if tag, err = store.AddTag(tx, tagName); err != nil {
+					test.Fatal(err)
+				}
+			}
+
+			if _, err := store.AddFileTag(tx, file.Id, tag.Id, 0); err != nil {
+				test.Fatal(err)
+			}
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		test.Fatal(err)
+	}
+
+	// test
+
+	options := Options{Option{"--aggregate", "-a", "", true, "/tmp/music"}}
+	if err := TagsCommand.Exec(store, options, []string{}); err != nil {
+		test.Fatal(err)
+	}
+
+	// validate
+
+	outFile.Seek(0, 0)
+
+	bytes, err := ioutil.ReadAll(outFile)
+	compareOutput(test, "1 flac\n2 music\n1 opera\n", string(bytes))
+}
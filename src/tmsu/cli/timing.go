@@ -0,0 +1,74 @@
+// Copyright 2011-2015 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package cli
+
+import (
+	"fmt"
+	"os"
+	"runtime/pprof"
+	"time"
+	"tmsu/common/log"
+	"tmsu/common/timing"
+)
+
+// unexported
+
+var timingStarted time.Time
+var profileFile *os.File
+
+// Starts recording the time spent in each phase of the command, if --timing
+// is specified, and writing a CPU profile to the file specified by --profile.
+func startTiming(options Options) error {
+	if options.HasOption("--timing") {
+		timing.Enabled = true
+		timingStarted = time.Now()
+	}
+
+	if options.HasOption("--profile") {
+		path := options.Get("--profile").Argument
+
+		file, err := os.Create(path)
+		if err != nil {
+			return fmt.Errorf("could not create profile '%v': %v", path, err)
+		}
+
+		if err := pprof.StartCPUProfile(file); err != nil {
+			file.Close()
+			return fmt.Errorf("could not start profiling: %v", err)
+		}
+
+		profileFile = file
+	}
+
+	return nil
+}
+
+// Reports the time spent in each phase and finishes the CPU profile.
+func stopTiming() {
+	if profileFile != nil {
+		pprof.StopCPUProfile()
+
+		if err := profileFile.Close(); err != nil {
+			log.Warnf("could not write profile: %v", err)
+		}
+		profileFile = nil
+	}
+
+	if timing.Enabled {
+		timing.Report(os.Stderr, time.Since(timingStarted))
+		timing.Enabled = false
+	}
+}
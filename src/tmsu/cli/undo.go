@@ -0,0 +1,104 @@
+// Copyright 2011-2015 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package cli
+
+import (
+	"fmt"
+	"strconv"
+	"tmsu/storage"
+)
+
+var UndoCommand = Command{
+	Name:     "undo",
+	Synopsis: "Undo recent changes",
+	Usages:   []string{"tmsu undo [OPTION]... [COUNT]"},
+	Description: `Reverts the COUNT most recent changes to the database, most recent first. If COUNT is not specified then only the last change is reverted.
+
+Each invocation of a command that modifies the database (tagging, untagging, repairing &c.) is recorded as a single change. The last 100 changes are retained.`,
+	Examples: []string{"$ tmsu undo",
+		"$ tmsu undo 3",
+		"$ tmsu undo --list"},
+	Options:    Options{{"--list", "-l", "list the changes that can be undone", false, ""}},
+	Exec:       undoExec,
+	ModifiesIf: undoModifies,
+}
+
+// Undoing changes modifies the database: listing them does not.
+func undoModifies(options Options, args []string) bool {
+	return !options.HasOption("--list")
+}
+
+func undoExec(store *storage.Storage, options Options, args []string) error {
+	var count uint = 1
+	switch len(args) {
+	case 0:
+	case 1:
+		value, err := strconv.ParseUint(args[0], 10, 0)
+		if err != nil || value == 0 {
+			return fmt.Errorf("invalid count '%v'", args[0])
+		}
+		count = uint(value)
+	default:
+		return fmt.Errorf("too many arguments")
+	}
+
+	tx, err := store.Begin()
+	if err != nil {
+		return err
+	}
+
+	if options.HasOption("--list") {
+		defer tx.Commit()
+
+		if len(args) == 0 {
+			count = 100
+		}
+
+		return listOperations(store, tx, count)
+	}
+
+	operations, err := store.Undo(tx, count)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if len(operations) == 0 {
+		tx.Rollback()
+		return fmt.Errorf("nothing to undo")
+	}
+
+	for _, operation := range operations {
+		fmt.Printf("undid: %v\n", operation.Description)
+	}
+
+	return tx.Commit()
+}
+
+// unexported
+
+func listOperations(store *storage.Storage, tx *storage.Tx, count uint) error {
+	operations, err := store.Operations(tx, count)
+	if err != nil {
+		return fmt.Errorf("could not retrieve changes: %v", err)
+	}
+
+	for index, operation := range operations {
+		fmt.Printf("%v\t%v\t%v\n", index+1, operation.Time.Local().Format("2006-01-02 15:04:05"), operation.Description)
+	}
+
+	return nil
+}
@@ -21,6 +21,8 @@ import (
 	"fmt"
 	"os"
 	"os/exec"
+	"path/filepath"
+	"strings"
 	"tmsu/common/log"
 	"tmsu/storage"
 	"tmsu/vfs"
@@ -30,26 +32,34 @@ var UnmountCommand = Command{
 	Name:     "unmount",
 	Aliases:  []string{"umount"},
 	Synopsis: "Unmount the virtual filesystem",
-	Usages: []string{"tmsu unmount MOUNTPOINT",
-		"tmsu unmount --all"},
-	Description: "Unmounts the virtual file-system at MOUNTPOINT.",
-	Options:     Options{{"--all", "-a", "unmounts all mounted TMSU file-systems", false, ""}},
-	Exec:        unmountExec,
+	Usages: []string{"tmsu unmount [OPTION]... MOUNTPOINT",
+		"tmsu unmount [OPTION]... --all"},
+	Description: `Unmounts the virtual file-system at MOUNTPOINT.
+
+A virtual file-system whose 'tmsu vfs' process has crashed is left stale: its mount point is disconnected and cannot be unmounted normally whilst in use. Use --lazy to detach it immediately and clean it up once no longer busy. 'tmsu mount' and 'tmsu vfs' mark such mounts as stale.`,
+	Examples: []string{"$ tmsu unmount mp",
+		"$ tmsu unmount --all",
+		"$ tmsu unmount --lazy mp"},
+	Options: Options{{"--all", "-a", "unmounts all mounted TMSU file-systems", false, ""},
+		{"--lazy", "-l", "detach the file-system now and clean up once it is no longer busy", false, ""}},
+	Exec: unmountExec,
 }
 
 func unmountExec(store *storage.Storage, options Options, args []string) error {
+	lazy := options.HasOption("--lazy")
+
 	if options.HasOption("--all") {
-		return unmountAll()
+		return unmountAll(lazy)
 	}
 
 	if len(args) < 1 {
 		return fmt.Errorf("too few arguments")
 	}
 
-	return unmount(args[0])
+	return unmount(args[0], lazy)
 }
 
-func unmount(path string) error {
+func unmount(path string, lazy bool) error {
 	log.Info(2, "searching path for fusermount.")
 
 	fusermountPath, err := exec.LookPath("fusermount")
@@ -57,9 +67,15 @@ func unmount(path string) error {
 		return fmt.Errorf("could not find 'fusermount': ensure fuse is installed: %v", err)
 	}
 
-	log.Infof(2, "running: %v -u %v.", fusermountPath, path)
+	fusermountArgs := []string{fusermountPath, "-u"}
+	if lazy {
+		fusermountArgs = append(fusermountArgs, "-z")
+	}
+	fusermountArgs = append(fusermountArgs, path)
+
+	log.Infof(2, "running: %v.", strings.Join(fusermountArgs, " "))
 
-	process, err := os.StartProcess(fusermountPath, []string{fusermountPath, "-u", path}, &os.ProcAttr{})
+	process, err := os.StartProcess(fusermountPath, fusermountArgs, &os.ProcAttr{})
 	if err != nil {
 		return fmt.Errorf("could not start 'fusermount': %v", err)
 	}
@@ -71,13 +87,24 @@ func unmount(path string) error {
 		return fmt.Errorf("error waiting for process to exit: %v", err)
 	}
 	if !processState.Success() {
+		if !lazy {
+			return fmt.Errorf("could not unmount virtual filesystem: if it is stale use --lazy")
+		}
+
 		return fmt.Errorf("could not unmount virtual filesystem")
 	}
 
+	// a crashed process will not have removed its mount from the state file
+	if absPath, err := filepath.Abs(path); err == nil {
+		if err := vfs.ForgetMount(absPath); err != nil {
+			log.Warnf("could not update mount state: %v", err)
+		}
+	}
+
 	return nil
 }
 
-func unmountAll() error {
+func unmountAll(lazy bool) error {
 	log.Info(2, "retrieving mount table.")
 
 	mt, err := vfs.GetMountTable()
@@ -90,7 +117,11 @@ func unmountAll() error {
 	}
 
 	for _, mount := range mt {
-		err = unmount(mount.MountPath)
+		if mount.Stale && !lazy {
+			return fmt.Errorf("%v: mount is stale: use --lazy to unmount it", mount.MountPath)
+		}
+
+		err = unmount(mount.MountPath, lazy)
 		if err != nil {
 			return err
 		}
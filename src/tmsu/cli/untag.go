@@ -17,9 +17,10 @@ package cli
 
 import (
 	"fmt"
-	"path/filepath"
-	"strings"
+	"tmsu/api"
 	"tmsu/common/log"
+	_path "tmsu/common/path"
+	"tmsu/common/text"
 	"tmsu/entities"
 	"tmsu/storage"
 )
@@ -30,14 +31,18 @@ var UntagCommand = Command{
 	Usages: []string{"tmsu untag [OPTION]... FILE TAG[=VALUE]...",
 		"tmsu untag [OPTION]... --all FILE...",
 		`tmsu untag [OPTION]... --tags="TAG[=VALUE]..." FILE...`},
-	Description: "Disassociates FILE with the TAGs specified.",
+	Description: `Disassociates FILE with the TAGs specified.
+
+Confirmation is requested before untagging more files, including those beneath directories with --recursive, than the 'confirmFileCount' setting allows (100 by default) unless --yes is specified. Where standard input is not a terminal the files are not untagged.`,
 	Examples: []string{"$ tmsu untag mountain.jpg hill county=germany",
 		"$ tmsu untag --all mountain-copy.jpg",
 		`$ tmsu untag --tags="river underwater year=2015" forest.jpg desert.jpg`},
 	Options: Options{{"--all", "-a", "strip each file of all tags", false, ""},
 		{"--tags", "-t", "the set of tags to remove", true, ""},
-		{"--recursive", "-r", "recursively remove tags from directory contents", false, ""}},
-	Exec: untagExec,
+		{"--recursive", "-r", "recursively remove tags from directory contents", false, ""},
+		{"--yes", "-y", "untag the files without asking for confirmation", false, ""}},
+	Exec:     untagExec,
+	Modifies: true,
 }
 
 func untagExec(store *storage.Storage, options Options, args []string) error {
@@ -53,6 +58,19 @@ func untagExec(store *storage.Storage, options Options, args []string) error {
 	}
 	defer tx.Commit()
 
+	paths := args
+	if !options.HasOption("--all") && !options.HasOption("--tags") {
+		paths = args[0:1]
+	}
+
+	count, err := countFiles(store, tx, paths, recursive)
+	if err != nil {
+		return err
+	}
+	if err := confirmFileCount(store, tx, options, "untag", count); err != nil {
+		return err
+	}
+
 	if options.HasOption("--all") {
 		if len(args) < 1 {
 			return fmt.Errorf("files to untag must be specified")
@@ -64,7 +82,7 @@ func untagExec(store *storage.Storage, options Options, args []string) error {
 			return err
 		}
 	} else if options.HasOption("--tags") {
-		tagArgs := strings.Fields(options.Get("--tags").Argument)
+		tagArgs := text.Tokenize(options.Get("--tags").Argument)
 		if len(tagArgs) == 0 {
 			return fmt.Errorf("set of tags to apply must be specified")
 		}
@@ -96,7 +114,7 @@ func untagExec(store *storage.Storage, options Options, args []string) error {
 func untagPathsAll(store *storage.Storage, tx *storage.Tx, paths []string, recursive bool) error {
 	wereErrors := false
 	for _, path := range paths {
-		absPath, err := filepath.Abs(path)
+		absPath, err := _path.Abs(path)
 		if err != nil {
 			return fmt.Errorf("%v: could not get absolute path: %v", path, err)
 		}
@@ -140,10 +158,11 @@ func untagPathsAll(store *storage.Storage, tx *storage.Tx, paths []string, recur
 
 func untagPaths(store *storage.Storage, tx *storage.Tx, paths, tagArgs []string, recursive bool) error {
 	wereErrors := false
+	noSuchTags := false
 
 	files := make(entities.Files, 0, len(paths))
 	for _, path := range paths {
-		absPath, err := filepath.Abs(path)
+		absPath, err := _path.Abs(path)
 		if err != nil {
 			return fmt.Errorf("%v: could not get absolute path: %v", path, err)
 		}
@@ -171,16 +190,8 @@ func untagPaths(store *storage.Storage, tx *storage.Tx, paths, tagArgs []string,
 	}
 
 	for _, tagArg := range tagArgs {
-		var tagName, valueName string
-		index := strings.Index(tagArg, "=")
-
-		switch index {
-		case -1, 0:
-			tagName = tagArg
-		default:
-			tagName = tagArg[0:index]
-			valueName = tagArg[index+1 : len(tagArg)]
-		}
+		tagValue := api.ParseTagValue(tagArg)
+		tagName, valueName := tagValue.Tag, tagValue.Value
 
 		tag, err := store.TagByName(tx, tagName)
 		if err != nil {
@@ -188,7 +199,7 @@ func untagPaths(store *storage.Storage, tx *storage.Tx, paths, tagArgs []string,
 		}
 		if tag == nil {
 			log.Warnf("no such tag '%v'", tagName)
-			wereErrors = true
+			noSuchTags = true
 			continue
 		}
 
@@ -203,39 +214,57 @@ func untagPaths(store *storage.Storage, tx *storage.Tx, paths, tagArgs []string,
 		}
 
 		for _, file := range files {
-			if err := store.DeleteFileTag(tx, file.Id, tag.Id, value.Id); err != nil {
+			if err := api.UntagFile(store, tx, file, tag, value); err != nil {
 				switch err.(type) {
-				case storage.FileTagDoesNotExist:
-					exists, err := store.FileTagExists(tx, file.Id, tag.Id, value.Id, false)
-					if err != nil {
-						return fmt.Errorf("could not check if tag exists: %v", err)
-					}
-
-					if exists {
-						if value.Id != 0 {
-							log.Warnf("%v: cannot remove '%v=%v': delete implication  to remove this tag.", file.Path(), tag.Name, value.Name)
-						} else {
-							log.Warnf("%v: cannot remove '%v': delete implication to remove this tag.", file.Path(), tag.Name)
-						}
-					} else {
-						if value.Id != 0 {
-							log.Warnf("%v: file is not tagged '%v=%v'.", file.Path(), tag.Name, value.Name)
-						} else {
-							log.Warnf("%v: file is not tagged '%v'.", file.Path(), tag.Name)
-						}
-					}
-
+				case api.TagImpliedError, api.TagNotAppliedError:
+					log.Warnf("%v.", err)
 					wereErrors = true
 				default:
-					return fmt.Errorf("%v: could not remove tag '%v', value '%v': %v", file.Path(), tag.Name, value.Name, err)
+					return err
 				}
 			}
 		}
 	}
 
-	if wereErrors {
+	switch {
+	case wereErrors:
 		return errBlank
+	case noSuchTags:
+		return errNoSuchTag
 	}
 
 	return nil
 }
+
+// Counts the tagged files at the specified paths and, if recursive, beneath
+// them.
+func countFiles(store *storage.Storage, tx *storage.Tx, paths []string, recursive bool) (uint, error) {
+	count := uint(0)
+	for _, path := range paths {
+		absPath, err := _path.Abs(path)
+		if err != nil {
+			return 0, fmt.Errorf("%v: could not get absolute path: %v", path, err)
+		}
+
+		file, err := store.FileByPath(tx, absPath)
+		if err != nil {
+			return 0, fmt.Errorf("%v: could not retrieve file: %v", path, err)
+		}
+		if file == nil {
+			continue
+		}
+
+		count++
+
+		if recursive {
+			childFiles, err := store.FilesByDirectory(tx, file.Path())
+			if err != nil {
+				return 0, fmt.Errorf("%v: could not retrieve files for directory: %v", file.Path(), err)
+			}
+
+			count += uint(len(childFiles))
+		}
+	}
+
+	return count, nil
+}
@@ -325,3 +325,149 @@ func TestUntagAll(test *testing.T) {
 		test.Fatalf("Expected no files but are %v", len(files))
 	}
 }
+
+func TestUntagConfirmFileCount(test *testing.T) {
+	// set-up
+
+	databasePath := testDatabase()
+	defer os.Remove(databasePath)
+
+	store, err := storage.OpenAt(databasePath)
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer store.Close()
+
+	paths := []string{"/tmp/tmsu/a", "/tmp/tmsu/b", "/tmp/tmsu/c"}
+	for _, path := range paths {
+		if err := createFile(path, path); err != nil {
+			test.Fatal(err)
+		}
+		defer os.Remove(path)
+
+		if err := TagCommand.Exec(store, Options{}, []string{path, "apple"}); err != nil {
+			test.Fatal(err)
+		}
+	}
+
+	if err := ConfigCommand.Exec(store, Options{}, []string{"confirmFileCount=2"}); err != nil {
+		test.Fatal(err)
+	}
+
+	all := Options{Option{"--all", "-a", "", false, ""}}
+	yes := Option{"--yes", "-y", "", false, ""}
+
+	// test
+
+	if err := UntagCommand.Exec(store, all, paths); err == nil {
+		test.Fatal("Expected untagging more files than allowed to be refused.")
+	}
+
+	if err := UntagCommand.Exec(store, all, paths[1:]); err != nil {
+		test.Fatal(err)
+	}
+
+	// validate
+
+	tx, err := store.Begin()
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	file, err := store.FileByPath(tx, "/tmp/tmsu/a")
+	if err != nil {
+		test.Fatal(err)
+	}
+	if file == nil {
+		test.Fatal("File was untagged despite the refusal.")
+	}
+
+	tx.Commit()
+
+	if err := DeleteCommand.Exec(store, Options{}, []string{"apple"}); err != nil {
+		test.Fatal(err)
+	}
+
+	tx, err = store.Begin()
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	tag, err := store.TagByName(tx, "apple")
+	if err != nil {
+		test.Fatal(err)
+	}
+	if tag != nil {
+		test.Fatal("Tag applied to a single file was not deleted.")
+	}
+
+	tx.Commit()
+
+	for _, path := range paths {
+		if err := TagCommand.Exec(store, Options{}, []string{path, "banana"}); err != nil {
+			test.Fatal(err)
+		}
+	}
+
+	if err := DeleteCommand.Exec(store, Options{}, []string{"banana"}); err == nil {
+		test.Fatal("Expected deleting a tag applied to more files than allowed to be refused.")
+	}
+
+	if err := DeleteCommand.Exec(store, Options{yes}, []string{"banana"}); err != nil {
+		test.Fatal(err)
+	}
+}
+
+func TestUntagNonExistentTag(test *testing.T) {
+	// set-up
+
+	databasePath := testDatabase()
+	defer os.Remove(databasePath)
+
+	store, err := storage.OpenAt(databasePath)
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer store.Close()
+
+	tx, err := store.Begin()
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	file, err := store.AddFile(tx, "/tmp/tmsu/a", fingerprint.Fingerprint("abc123"), time.Now(), 0, false)
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	appleTag, err := store.AddTag(tx, "apple")
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	if _, err := store.AddTag(tx, "banana"); err != nil {
+		test.Fatal(err)
+	}
+
+	if _, err = store.AddFileTag(tx, file.Id, appleTag.Id, 0); err != nil {
+		test.Fatal(err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		test.Fatal(err)
+	}
+
+	// test
+
+	noSuchTagErr := UntagCommand.Exec(store, Options{}, []string{"/tmp/tmsu/a", "nosuch"})
+	mixedErr := UntagCommand.Exec(store, Options{}, []string{"/tmp/tmsu/a", "nosuch", "banana"})
+
+	// validate
+
+	if exitStatus(noSuchTagErr) != exitNoSuchTag {
+		test.Fatalf("Expected exit status %v but was %v.", exitNoSuchTag, exitStatus(noSuchTagErr))
+	}
+	if exitStatus(mixedErr) != exitPartialFailure {
+		test.Fatalf("Expected exit status %v but was %v.", exitPartialFailure, exitStatus(mixedErr))
+	}
+}
@@ -17,6 +17,7 @@ package cli
 
 import (
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
 	"tmsu/common/log"
@@ -40,22 +41,19 @@ Where PATHs are not specified, untagged items under the current working director
 func untaggedExec(store *storage.Storage, options Options, args []string) error {
 	recursive := !options.HasOption("--directory")
 
-	paths := args
-	if len(paths) == 0 {
-		var err error
-		paths, err = directoryEntries(".")
-		if err != nil {
-			return err
-		}
-	}
-
 	tx, err := store.Begin()
 	if err != nil {
 		return err
 	}
 	defer tx.Commit()
 
-	if err := findUntagged(store, tx, paths, recursive); err != nil {
+	if len(args) == 0 {
+		return eachDirectoryEntries(".", func(paths []string) error {
+			return findUntagged(store, tx, paths, recursive)
+		})
+	}
+
+	if err := findUntagged(store, tx, args, recursive); err != nil {
 		return err
 	}
 
@@ -69,7 +67,6 @@ func findUntagged(store *storage.Storage, tx *storage.Tx, paths []string, recurs
 			return fmt.Errorf("%v: could not get absolute path: %v", path, err)
 		}
 
-		//TODO PERF no need to retrieve file: we merely need to know it exists
 		file, err := store.FileByPath(tx, absPath)
 		if err != nil {
 			return fmt.Errorf("%v: could not retrieve file: %v", path, err)
@@ -80,52 +77,97 @@ func findUntagged(store *storage.Storage, tx *storage.Tx, paths []string, recurs
 		}
 
 		if recursive {
-			entries, err := directoryEntries(path)
-			if err != nil {
+			if err := findUntaggedWithin(store, tx, absPath); err != nil {
 				return err
 			}
-
-			findUntagged(store, tx, entries, true)
 		}
 	}
 
 	return nil
 }
 
-func directoryEntries(path string) ([]string, error) {
+func findUntaggedWithin(store *storage.Storage, tx *storage.Tx, dirPath string) error {
+	stat, err := os.Stat(dirPath)
+	if err != nil || !stat.IsDir() {
+		return nil
+	}
+
+	// one query for the whole tree rather than one per entry
+	files, err := store.FilesByDirectory(tx, dirPath)
+	if err != nil {
+		return fmt.Errorf("%v: could not retrieve files for directory: %v", dirPath, err)
+	}
+
+	tagged := make(map[string]bool, len(files))
+	for _, file := range files {
+		tagged[file.Path()] = true
+	}
+
+	return _path.Walk(dirPath, func(dir string, entries []_path.Entry, err error) error {
+		if err != nil {
+			log.Warnf("%v: could not read directory entries: %v", dir, err)
+			return nil
+		}
+
+		for _, entry := range entries {
+			if !tagged[entry.Path] {
+				fmt.Println(_path.Rel(entry.Path))
+			}
+
+			if os.IsPermission(entry.Err) {
+				log.Warnf("%v: permission denied", entry.Path)
+			}
+		}
+
+		return nil
+	})
+}
+
+// Calls visit with the entries of the directory a chunk at a time, so that
+// very large directories are not read into memory at once.
+func eachDirectoryEntries(path string, visit func(paths []string) error) error {
 	stat, err := os.Stat(path)
 	if err != nil {
 		switch {
 		case os.IsNotExist(err):
 			log.Warnf("%v: does not exist", path)
-			return []string{}, nil
+			return nil
 		case os.IsPermission(err):
 			log.Warnf("%v: permission denied", path)
-			return []string{}, nil
+			return nil
 		default:
-			return nil, fmt.Errorf("%v: could not stat", path, err)
+			return fmt.Errorf("%v: could not stat: %v", path, err)
 		}
 	}
 
 	if !stat.IsDir() {
-		return []string{}, nil
+		return nil
 	}
 
 	dir, err := os.Open(path)
 	if err != nil {
-		return nil, fmt.Errorf("%v could not open directory", path, err)
+		return fmt.Errorf("%v: could not open directory: %v", path, err)
 	}
+	defer dir.Close()
+
+	for {
+		names, err := dir.Readdirnames(_path.WalkChunkSize)
+		if len(names) > 0 {
+			entries := make([]string, len(names))
+			for index, name := range names {
+				entries[index] = filepath.Join(path, name)
+			}
 
-	names, err := dir.Readdirnames(0)
-	dir.Close()
-	if err != nil {
-		return nil, fmt.Errorf("%v: could not read directory entries", path, err)
-	}
+			if err := visit(entries); err != nil {
+				return err
+			}
+		}
 
-	entries := make([]string, len(names))
-	for index, name := range names {
-		entries[index] = filepath.Join(path, name)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("%v: could not read directory entries: %v", path, err)
+		}
 	}
-
-	return entries, nil
 }
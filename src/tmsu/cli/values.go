@@ -20,25 +20,38 @@ import (
 	"strings"
 	"tmsu/common/log"
 	"tmsu/common/terminal"
+	"tmsu/entities"
 	"tmsu/storage"
 )
 
 var ValuesCommand = Command{
-	Name:        "values",
-	Synopsis:    "List values",
-	Usages:      []string{"tmsu values [OPTION]... [TAG]..."},
-	Description: "Lists the values for TAGs. If no TAG is specified then all tags are listed.",
+	Name:     "values",
+	Synopsis: "List values",
+	Usages:   []string{"tmsu values [OPTION]... [TAG]..."},
+	Description: `Lists the values for TAGs. If no TAG is specified then all tags are listed.
+
+A tag may be applied to a file more than once with different values, e.g. 'tmsu tag book.pdf author=alice author=bob', in which case each of the values is listed.
+
+With --usage each value is listed with the number of files tagged with it. If no TAG is specified then the values of every tag that has values are listed.`,
 	Examples: []string{"$ tmsu values year\n2000\n2001\n2015",
 		"$ tmsu values\n2000\n2001\n2015\ncheese\nopera",
-		"$ tmsu values --count year\n3"},
+		"$ tmsu values --count year\n3",
+		"$ tmsu values --usage author\n3 alice\n1 bob"},
 	Options: Options{{"--count", "-c", "lists the number of values rather than their names", false, ""},
-		{"", "-1", "list one value per line", false, ""}},
+		{"", "-1", "list one value per line", false, ""},
+		{"--usage", "-u", "list the number of files tagged with each value", false, ""}},
 	Exec: valuesExec,
 }
 
 func valuesExec(store *storage.Storage, options Options, args []string) error {
 	showCount := options.HasOption("--count")
 	onePerLine := options.HasOption("-1")
+	usage := options.HasOption("--usage")
+
+	colour, err := useColour(options)
+	if err != nil {
+		return err
+	}
 
 	tx, err := store.Begin()
 	if err != nil {
@@ -46,6 +59,10 @@ func valuesExec(store *storage.Storage, options Options, args []string) error {
 	}
 	defer tx.Commit()
 
+	if usage {
+		return listValueUsage(store, tx, args, colour)
+	}
+
 	if len(args) == 0 {
 		return listAllValues(store, tx, showCount, onePerLine)
 	}
@@ -79,7 +96,7 @@ func listAllValues(store *storage.Storage, tx *storage.Tx, showCount, onePerLine
 				valueNames[index] = value.Name
 			}
 
-			terminal.PrintColumns(valueNames)
+			terminal.PrintColumns(escapeNames(valueNames))
 		}
 	}
 
@@ -105,7 +122,7 @@ func listValuesForTag(store *storage.Storage, tx *storage.Tx, tagName string, sh
 		return fmt.Errorf("could not retrieve tag '%v': %v", tagName, err)
 	}
 	if tag == nil {
-		return fmt.Errorf("no such tag, '%v'", tagName)
+		return noSuchTagError(tagName)
 	}
 
 	log.Infof(2, "retrieving values for tag '%v'.", tagName)
@@ -128,7 +145,7 @@ func listValuesForTag(store *storage.Storage, tx *storage.Tx, tagName string, sh
 				valueNames[index] = value.Name
 			}
 
-			terminal.PrintColumns(valueNames)
+			terminal.PrintColumns(escapeNames(valueNames))
 		}
 	}
 
@@ -170,13 +187,83 @@ func listValuesForTags(store *storage.Storage, tx *storage.Tx, tagNames []string
 					valueNames[index] = value.Name
 				}
 
-				fmt.Printf("%v: %v\n", tagName, strings.Join(valueNames, " "))
+				fmt.Printf("%v: %v\n", tagName, strings.Join(escapeNames(valueNames), " "))
 			}
 		}
 	}
 
 	if wereErrors {
-		return errBlank
+		return errNoSuchTag
+	}
+
+	return nil
+}
+
+func listValueUsage(store *storage.Storage, tx *storage.Tx, tagNames []string, colour bool) error {
+	var tags entities.Tags
+	if len(tagNames) == 0 {
+		log.Info(2, "retrieving all tags.")
+
+		var err error
+		tags, err = store.Tags(tx)
+		if err != nil {
+			return fmt.Errorf("could not retrieve tags: %v", err)
+		}
+	} else {
+		tags = make(entities.Tags, 0, len(tagNames))
+		for _, tagName := range tagNames {
+			tag, err := store.TagByName(tx, tagName)
+			if err != nil {
+				return fmt.Errorf("could not retrieve tag '%v': %v", tagName, err)
+			}
+			if tag == nil {
+				if len(tagNames) == 1 {
+					return noSuchTagError(tagName)
+				}
+
+				log.Warnf("no such tag, '%v'.", tagName)
+				continue
+			}
+
+			tags = append(tags, tag)
+		}
+	}
+
+	printed := false
+	for _, tag := range tags {
+		log.Infof(2, "retrieving value usage for tag '%v'.", tag.Name)
+
+		valueUsage, err := store.ValueUsage(tx, tag.Id)
+		if err != nil {
+			return fmt.Errorf("could not retrieve value usage for tag '%v': %v", tag.Name, err)
+		}
+		if len(valueUsage) == 0 && len(tagNames) != 1 {
+			continue
+		}
+
+		if len(tagNames) != 1 {
+			if printed {
+				fmt.Println()
+			}
+			fmt.Println(tag.Name + ":")
+		}
+
+		var max uint
+		for _, value := range valueUsage {
+			if value.FileCount > max {
+				max = value.FileCount
+			}
+		}
+
+		for _, value := range valueUsage {
+			fmt.Printf("%v %v\n", formatStatsCount(max, value.FileCount, colour), value.Name)
+		}
+
+		printed = true
+	}
+
+	if len(tags) < len(tagNames) {
+		return errNoSuchTag
 	}
 
 	return nil
@@ -19,7 +19,11 @@ package cli
 
 import (
 	"fmt"
+	"path/filepath"
 	"strings"
+	"time"
+	"tmsu/common/log"
+	"tmsu/common/systemd"
 	"tmsu/storage"
 	"tmsu/vfs"
 )
@@ -27,18 +31,25 @@ import (
 var VfsCommand = Command{
 	Name:     "vfs",
 	Synopsis: "Hosts the virtual filesystem",
-	Usages:   []string{"tmsu vfs [OPTION]... MOUNTPOINT"},
-	Description: `This subcommand is the foreground process which hosts the virtual filesystem. It is run automatically when a virtual filesystem is mounted using the 'mount' subcommand and terminated when the virtual filesystem is unmounted.
+	Usages: []string{"tmsu vfs",
+		"tmsu vfs [OPTION]... MOUNTPOINT"},
+	Description: `Without arguments, lists the virtual filesystems hosted by this user's 'tmsu vfs' processes, with the process ID, database and mount point of each. Mounts whose process is no longer running, e.g. because it crashed, are marked as stale: unmount these with 'tmsu unmount --lazy'.
 
-It is not normally necessary to issue this subcommand manually unless debugging the virtual filesystem. For debug output use the --verbose option.`,
-	Options: Options{{"--options", "-o", "mount options", true, ""}},
-	Exec:    vfsExec,
-	Hidden:  true,
+Otherwise this subcommand is the foreground process which hosts the virtual filesystem at MOUNTPOINT. It is run automatically when a virtual filesystem is mounted using the 'mount' subcommand and terminated when the virtual filesystem is unmounted.
+
+It is not normally necessary to host a virtual filesystem manually unless debugging it. For debug output use the --verbose option.
+
+With --idle-timeout the virtual filesystem is unmounted, and the process exits, once it has not been accessed for that long. Where started by systemd, readiness is signalled via sd_notify once the virtual filesystem is mounted.
+
+The hosted mounts are tracked in the runtime state file $XDG_RUNTIME_DIR/tmsu/mounts or, if XDG_RUNTIME_DIR is not set, tmsu-UID/mounts in the temporary directory.`,
+	Options: Options{{"--options", "-o", "mount options", true, ""},
+		{"--idle-timeout", "-i", "unmount after this long without access, e.g. 5m", true, ""}},
+	Exec: vfsExec,
 }
 
 func vfsExec(store *storage.Storage, options Options, args []string) error {
 	if len(args) == 0 {
-		fmt.Errorf("mountpoint not specified")
+		return listTrackedMounts()
 	}
 
 	mountOptions := []string{}
@@ -46,15 +57,78 @@ func vfsExec(store *storage.Storage, options Options, args []string) error {
 		mountOptions = strings.Split(options.Get("--options").Argument, ",")
 	}
 
-	mountPath := args[0]
+	idleTimeout, err := idleTimeoutOption(options)
+	if err != nil {
+		return err
+	}
+
+	return hostVfs(store, args[0], mountOptions, idleTimeout)
+}
+
+// Mounts the virtual filesystem and serves it in this process until it is
+// unmounted or, if idleTimeout is non-zero, goes unused for that long.
+func hostVfs(store *storage.Storage, mountPath string, mountOptions []string, idleTimeout time.Duration) error {
+	absMountPath, err := filepath.Abs(mountPath)
+	if err != nil {
+		return fmt.Errorf("%v: could not get absolute path: %v", mountPath, err)
+	}
+	mountPath = absMountPath
 
-	vfs, err := vfs.MountVfs(store, mountPath, mountOptions)
+	fuseVfs, err := vfs.MountVfs(store, mountPath, mountOptions)
 	if err != nil {
 		return fmt.Errorf("could not mount virtual filesystem at '%v': %v", mountPath, err)
 	}
-	defer vfs.Unmount()
+	defer fuseVfs.Unmount()
+
+	if err := vfs.RecordMount(store.DbPath, mountPath); err != nil {
+		log.Warnf("could not record mount: %v", err)
+	}
+	defer vfs.ForgetMount(mountPath)
 
-	vfs.Serve()
+	if err := systemd.Notify("READY=1"); err != nil {
+		log.Warnf("%v", err)
+	}
+
+	fuseVfs.ServeUntilIdle(idleTimeout)
+
+	return nil
+}
+
+func idleTimeoutOption(options Options) (time.Duration, error) {
+	if !options.HasOption("--idle-timeout") {
+		return 0, nil
+	}
+
+	text := options.Get("--idle-timeout").Argument
+	idleTimeout, err := time.ParseDuration(text)
+	if err != nil || idleTimeout < 0 {
+		return 0, fmt.Errorf("invalid idle timeout '%v'", text)
+	}
+
+	return idleTimeout, nil
+}
+
+func listTrackedMounts() error {
+	mounts, err := vfs.TrackedMounts()
+	if err != nil {
+		return err
+	}
+
+	dbPathWidth := 0
+	for _, mount := range mounts {
+		if len(mount.DatabasePath) > dbPathWidth {
+			dbPathWidth = len(mount.DatabasePath)
+		}
+	}
+
+	for _, mount := range mounts {
+		state := ""
+		if mount.Stale() {
+			state = "\t(stale)"
+		}
+
+		fmt.Printf("%v\t%-*v\tat\t%v%v\n", mount.Pid, dbPathWidth, mount.DatabasePath, mount.MountPath, state)
+	}
 
 	return nil
 }
@@ -0,0 +1,66 @@
+// Copyright 2011-2015 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package cli
+
+import (
+	"fmt"
+	"tmsu/api"
+	"tmsu/common/log"
+	"tmsu/storage"
+	"tmsu/web"
+)
+
+var WebCommand = Command{
+	Name:     "web",
+	Synopsis: "Serve a web interface",
+	Usages:   []string{"tmsu web [OPTION]..."},
+	Description: `Serves a REST API and a minimal web interface for browsing and editing tags from a browser.
+
+The API provides:
+
+  GET  /api/tags                   names of all tags
+  GET  /api/files?query=QUERY      paths of the files matching QUERY
+  GET  /api/file?path=PATH         tags applied to the file at PATH
+  GET  /api/note?path=PATH         note attached to the file at PATH
+  POST /api/note                   attach a note, e.g. {"path": "/a", "note": "text"}
+  GET  /api/thumbnail?path=PATH    PNG thumbnail of the image or video at PATH
+  POST /api/tag                    apply tags, e.g. {"paths": ["/a"], "tags": ["b"]}
+  POST /api/untag                  remove tags, e.g. {"paths": ["/a"], "tags": ["b"]}
+
+Paths must be absolute. Requests naming a host other than localhost, an IP address or the host listened on are refused, so that other sites cannot read the database by rebinding their names to the server's address. Requests that modify the database must also be sent as application/json and are refused if they come from a web page served from elsewhere, so that other sites cannot use the browser to make them. There is no authentication: anyone able to connect to the address can modify the database.`,
+	Examples: []string{"$ tmsu web",
+		"$ tmsu web --listen :8080",
+		"$ curl 'http://localhost:8080/api/files?query=music'"},
+	Options: Options{{"--listen", "-l", "the address to listen on (default localhost:8080)", true, ""}},
+	Exec:    webExec,
+}
+
+func webExec(store *storage.Storage, options Options, args []string) error {
+	if len(args) > 0 {
+		return fmt.Errorf("too many arguments")
+	}
+
+	address := "localhost:8080"
+	if options.HasOption("--listen") {
+		address = options.Get("--listen").Argument
+	}
+
+	if address == "" || address[0] == ':' {
+		log.Warn("listening on all interfaces without authentication")
+	}
+
+	return web.Serve(api.New(store), address)
+}
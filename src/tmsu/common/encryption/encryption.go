@@ -0,0 +1,168 @@
+// Copyright 2011-2015 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+// Package encryption encrypts files with a key derived from a passphrase,
+// using AES-256 in GCM mode so that tampering is detected on decryption.
+package encryption
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"io"
+	"os"
+)
+
+// The header that marks encrypted data, followed by the salt, the nonce and
+// the ciphertext.
+const Magic = "TMSU-ENCRYPTED-1\n"
+
+var WrongPassphraseError = errors.New("wrong passphrase or corrupt data")
+var NotEncryptedError = errors.New("not encrypted")
+
+// The number of PBKDF2 iterations used to derive the key from the passphrase.
+const Iterations = 200000
+
+const saltSize = 16
+const keySize = 32
+
+// Whether the file at the specified path holds encrypted data.
+func IsEncrypted(path string) (bool, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return false, nil
+		}
+
+		return false, err
+	}
+	defer file.Close()
+
+	header := make([]byte, len(Magic))
+	if _, err := io.ReadFull(file, header); err != nil {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return false, nil
+		}
+
+		return false, err
+	}
+
+	return string(header) == Magic, nil
+}
+
+// Encrypts the data with a key derived from the passphrase and a random salt.
+func Encrypt(data, passphrase []byte) ([]byte, error) {
+	salt := make([]byte, saltSize)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+
+	gcm, err := newCipher(passphrase, salt)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+
+	header := make([]byte, 0, len(Magic)+saltSize+len(nonce))
+	header = append(header, Magic...)
+	header = append(header, salt...)
+	header = append(header, nonce...)
+
+	return gcm.Seal(header, nonce, data, []byte(Magic)), nil
+}
+
+// Decrypts data encrypted by Encrypt.
+func Decrypt(data, passphrase []byte) ([]byte, error) {
+	if !bytes.HasPrefix(data, []byte(Magic)) {
+		return nil, NotEncryptedError
+	}
+	data = data[len(Magic):]
+
+	if len(data) < saltSize {
+		return nil, WrongPassphraseError
+	}
+	salt := data[:saltSize]
+	data = data[saltSize:]
+
+	gcm, err := newCipher(passphrase, salt)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(data) < gcm.NonceSize() {
+		return nil, WrongPassphraseError
+	}
+	nonce := data[:gcm.NonceSize()]
+	data = data[gcm.NonceSize():]
+
+	plaintext, err := gcm.Open(nil, nonce, data, []byte(Magic))
+	if err != nil {
+		return nil, WrongPassphraseError
+	}
+
+	return plaintext, nil
+}
+
+// unexported
+
+func newCipher(passphrase, salt []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(deriveKey(passphrase, salt))
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
+
+// Derives the key from the passphrase with PBKDF2 (RFC 2898) using
+// HMAC-SHA256: as the key is one hash long only the first block is needed.
+func deriveKey(passphrase, salt []byte) []byte {
+	return deriveKeyIterations(passphrase, salt, Iterations)
+}
+
+func deriveKeyIterations(passphrase, salt []byte, iterations int) []byte {
+	mac := hmac.New(sha256.New, passphrase)
+
+	blockIndex := make([]byte, 4)
+	binary.BigEndian.PutUint32(blockIndex, 1)
+
+	mac.Write(salt)
+	mac.Write(blockIndex)
+	u := mac.Sum(nil)
+
+	key := make([]byte, len(u))
+	copy(key, u)
+
+	for iteration := 1; iteration < iterations; iteration++ {
+		mac.Reset()
+		mac.Write(u)
+		u = mac.Sum(u[:0])
+
+		for index := range key {
+			key[index] ^= u[index]
+		}
+	}
+
+	return key[:keySize]
+}
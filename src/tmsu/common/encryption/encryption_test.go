@@ -0,0 +1,100 @@
+// Copyright 2011-2015 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package encryption
+
+import (
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestEncryptDecrypt(test *testing.T) {
+	data := []byte("SQLite format 3\x00tags")
+
+	encrypted, err := Encrypt(data, []byte("secret"))
+	if err != nil {
+		test.Fatal(err)
+	}
+	if string(encrypted[:len(Magic)]) != Magic {
+		test.Fatalf("encrypted data does not start with the header")
+	}
+
+	decrypted, err := Decrypt(encrypted, []byte("secret"))
+	if err != nil {
+		test.Fatal(err)
+	}
+	if string(decrypted) != string(data) {
+		test.Fatalf("expected '%v' but was '%v'", string(data), string(decrypted))
+	}
+}
+
+func TestDecryptWrongPassphrase(test *testing.T) {
+	encrypted, err := Encrypt([]byte("tags"), []byte("secret"))
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	if _, err := Decrypt(encrypted, []byte("guess")); err != WrongPassphraseError {
+		test.Fatalf("expected wrong passphrase error but was %v", err)
+	}
+
+	encrypted[len(encrypted)-1] ^= 1
+	if _, err := Decrypt(encrypted, []byte("secret")); err != WrongPassphraseError {
+		test.Fatalf("expected wrong passphrase error for tampered data but was %v", err)
+	}
+}
+
+func TestDeriveKey(test *testing.T) {
+	// RFC 7914 PBKDF2-HMAC-SHA256 test vector truncated to the first block
+	key := hex.EncodeToString(deriveKeyIterations([]byte("passwd"), []byte("salt"), 1))
+	if key != "55ac046e56e3089fec1691c22544b605f94185216dde0465e68b9d57c20dacbc" {
+		test.Fatalf("unexpected key %v", key)
+	}
+}
+
+func TestIsEncrypted(test *testing.T) {
+	dir, err := ioutil.TempDir("", "tmsu-encryption")
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	plainPath := filepath.Join(dir, "plain")
+	if err := ioutil.WriteFile(plainPath, []byte("SQLite format 3\x00"), 0600); err != nil {
+		test.Fatal(err)
+	}
+
+	encrypted, err := Encrypt([]byte("tags"), []byte("secret"))
+	if err != nil {
+		test.Fatal(err)
+	}
+	encryptedPath := filepath.Join(dir, "encrypted")
+	if err := ioutil.WriteFile(encryptedPath, encrypted, 0600); err != nil {
+		test.Fatal(err)
+	}
+
+	for path, expected := range map[string]bool{plainPath: false, encryptedPath: true, filepath.Join(dir, "missing"): false} {
+		isEncrypted, err := IsEncrypted(path)
+		if err != nil {
+			test.Fatal(err)
+		}
+		if isEncrypted != expected {
+			test.Fatalf("%v: expected %v but was %v", path, expected, isEncrypted)
+		}
+	}
+}
@@ -0,0 +1,58 @@
+// Copyright 2011-2015 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package filesystem
+
+import (
+	"strings"
+)
+
+// A mount of a directory of a file system, which is also reachable under
+// Target through another mount of the same file system.
+type BindMount struct {
+	MountPoint string
+	Target     string
+}
+
+// Maps the path, if it is under one of the bind mounts' mount points, to the
+// path under the mount's target. The mounts are tried in order.
+func ResolveBindMounts(path string, bindMounts []BindMount) string {
+	for _, bindMount := range bindMounts {
+		if path == bindMount.MountPoint {
+			return bindMount.Target
+		}
+		if strings.HasPrefix(path, strings.TrimSuffix(bindMount.MountPoint, "/")+"/") {
+			return bindMount.Target + path[len(strings.TrimSuffix(bindMount.MountPoint, "/")):]
+		}
+	}
+
+	return path
+}
+
+// unexported
+
+type bindMountsByMountPoint []BindMount
+
+func (bindMounts bindMountsByMountPoint) Len() int {
+	return len(bindMounts)
+}
+
+func (bindMounts bindMountsByMountPoint) Less(i, j int) bool {
+	return len(bindMounts[i].MountPoint) > len(bindMounts[j].MountPoint)
+}
+
+func (bindMounts bindMountsByMountPoint) Swap(i, j int) {
+	bindMounts[i], bindMounts[j] = bindMounts[j], bindMounts[i]
+}
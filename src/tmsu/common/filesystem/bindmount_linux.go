@@ -0,0 +1,97 @@
+// Copyright 2011-2015 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package filesystem
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"tmsu/common/path"
+)
+
+// Identifies the bind mounts: mounts of a directory within a file system that
+// is also reachable through another mount of the same file system. Each maps
+// the paths under its mount point to those under the other mount. The mounts
+// are ordered longest mount point first so that the first that applies to a
+// path is the most specific.
+func BindMounts() ([]BindMount, error) {
+	file, err := os.Open("/proc/self/mountinfo")
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	type mount struct {
+		root       string
+		mountPoint string
+	}
+
+	mountsByDevice := make(map[string][]mount, 10)
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 5 {
+			continue
+		}
+
+		device := fields[2]
+		mountsByDevice[device] = append(mountsByDevice[device], mount{path.UnescapeOctal(fields[3]), path.UnescapeOctal(fields[4])})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	bindMounts := make([]BindMount, 0)
+	for _, mounts := range mountsByDevice {
+		for _, bind := range mounts {
+			if bind.root == "/" {
+				continue
+			}
+
+			// the mount of the file system that exposes most of it
+			var primary *mount
+			for index, other := range mounts {
+				if other.root == bind.root || !isWithin(bind.root, other.root) {
+					continue
+				}
+				if primary == nil || len(other.root) < len(primary.root) {
+					primary = &mounts[index]
+				}
+			}
+			if primary == nil {
+				continue
+			}
+
+			target := filepath.Join(primary.mountPoint, strings.TrimPrefix(bind.root, primary.root))
+			if target != bind.mountPoint {
+				bindMounts = append(bindMounts, BindMount{bind.mountPoint, target})
+			}
+		}
+	}
+
+	sort.Sort(bindMountsByMountPoint(bindMounts))
+
+	return bindMounts, nil
+}
+
+// unexported
+
+func isWithin(path, dir string) bool {
+	return dir == "/" || path == dir || strings.HasPrefix(path, dir+"/")
+}
@@ -0,0 +1,34 @@
+// Copyright 2011-2015 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+// +build linux darwin dragonfly freebsd netbsd openbsd
+
+package filesystem
+
+import (
+	"os"
+	"syscall"
+)
+
+// Retrieves the device and inode numbers that identify the file described by
+// the stat information, reporting whether these are available.
+func FileIdentity(stat os.FileInfo) (device, inode uint64, ok bool) {
+	sys, ok := stat.Sys().(*syscall.Stat_t)
+	if !ok || sys == nil {
+		return 0, 0, false
+	}
+
+	return uint64(sys.Dev), uint64(sys.Ino), true
+}
@@ -0,0 +1,55 @@
+// Copyright 2011-2015 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package filesystem
+
+import (
+	"os"
+	"syscall"
+)
+
+// the FICLONE ioctl request (_IOW(0x94, 9, int))
+const ficlone = 0x40049409
+
+// Creates a copy-on-write clone of the file at srcPath at destPath, sharing
+// the underlying data blocks. The error is syscall.EXDEV if the paths are on
+// different filesystems and syscall.EOPNOTSUPP or syscall.EINVAL if the
+// filesystem does not support cloning.
+func Reflink(srcPath, destPath string) error {
+	src, err := os.Open(srcPath)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	stat, err := src.Stat()
+	if err != nil {
+		return err
+	}
+
+	dest, err := os.OpenFile(destPath, os.O_WRONLY|os.O_CREATE|os.O_EXCL, stat.Mode().Perm())
+	if err != nil {
+		return err
+	}
+
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, dest.Fd(), ficlone, src.Fd())
+	dest.Close()
+	if errno != 0 {
+		os.Remove(destPath)
+		return errno
+	}
+
+	return os.Chtimes(destPath, stat.ModTime(), stat.ModTime())
+}
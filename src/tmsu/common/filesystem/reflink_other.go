@@ -0,0 +1,28 @@
+// Copyright 2011-2015 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+// +build !linux
+
+package filesystem
+
+import (
+	"syscall"
+)
+
+// Creates a copy-on-write clone of the file at srcPath at destPath. Cloning
+// is not supported on this platform so syscall.EOPNOTSUPP is returned.
+func Reflink(srcPath, destPath string) error {
+	return syscall.EOPNOTSUPP
+}
@@ -0,0 +1,139 @@
+// Copyright 2011-2015 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package filesystem
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+)
+
+const uuidDirectory = "/dev/disk/by-uuid"
+
+// the volume identifiers of the devices seen by this process, including those
+// without an identifier, so that the directory is read once per device
+var volumeIds = struct {
+	sync.Mutex
+	byDevice map[uint64]string
+}{byDevice: make(map[uint64]string)}
+
+// Retrieves the identifier (UUID) of the volume holding the specified path.
+// An empty string is returned if the volume cannot be identified.
+func VolumeId(path string) string {
+	var stat syscall.Stat_t
+	if err := syscall.Stat(path, &stat); err != nil {
+		return ""
+	}
+
+	device := uint64(stat.Dev)
+
+	volumeIds.Lock()
+	defer volumeIds.Unlock()
+
+	if volumeId, ok := volumeIds.byDevice[device]; ok {
+		return volumeId
+	}
+
+	byDevice, err := volumeIdsByDevice()
+	if err != nil {
+		volumeIds.byDevice[device] = ""
+		return ""
+	}
+
+	for otherDevice, volumeId := range byDevice {
+		volumeIds.byDevice[otherDevice] = volumeId
+	}
+	volumeIds.byDevice[device] = byDevice[device]
+
+	return byDevice[device]
+}
+
+// Determines whether the volume with the specified identifier is currently mounted.
+func VolumeMounted(volumeId string) bool {
+	var stat syscall.Stat_t
+	if err := syscall.Stat(filepath.Join(uuidDirectory, volumeId), &stat); err != nil {
+		return false
+	}
+
+	devices, err := mountedDevices()
+	if err != nil {
+		return false
+	}
+
+	return devices[uint64(stat.Rdev)]
+}
+
+// unexported
+
+func volumeIdsByDevice() (map[uint64]string, error) {
+	dir, err := os.Open(uuidDirectory)
+	if err != nil {
+		return nil, err
+	}
+
+	names, err := dir.Readdirnames(0)
+	dir.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	volumeIds := make(map[uint64]string, len(names))
+	for _, name := range names {
+		var stat syscall.Stat_t
+		if err := syscall.Stat(filepath.Join(uuidDirectory, name), &stat); err != nil {
+			continue
+		}
+
+		volumeIds[uint64(stat.Rdev)] = name
+	}
+
+	return volumeIds, nil
+}
+
+func mountedDevices() (map[uint64]bool, error) {
+	file, err := os.Open("/proc/self/mountinfo")
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	devices := make(map[uint64]bool, 10)
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 3 {
+			continue
+		}
+
+		var major, minor uint64
+		if _, err := fmt.Sscanf(fields[2], "%d:%d", &major, &minor); err != nil {
+			continue
+		}
+
+		devices[makeDevice(major, minor)] = true
+	}
+
+	return devices, scanner.Err()
+}
+
+func makeDevice(major, minor uint64) uint64 {
+	return (minor & 0xff) | ((major & 0xfff) << 8) | ((minor &^ 0xff) << 12) | ((major &^ 0xfff) << 32)
+}
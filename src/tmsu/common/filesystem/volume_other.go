@@ -0,0 +1,29 @@
+// Copyright 2011-2015 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+// +build !linux
+
+package filesystem
+
+// Retrieves the identifier (UUID) of the volume holding the specified path.
+// Volumes cannot be identified on this platform so an empty string is returned.
+func VolumeId(path string) string {
+	return ""
+}
+
+// Determines whether the volume with the specified identifier is currently mounted.
+func VolumeMounted(volumeId string) bool {
+	return false
+}
@@ -22,16 +22,24 @@ import (
 	"encoding/hex"
 	"fmt"
 	"hash"
+	"hash/crc64"
 	"os"
 	"path/filepath"
 	"strconv"
 	"strings"
+	"tmsu/common/timing"
 )
 
 const sparseFingerprintThreshold = 5 * 1024 * 1024
 const sparseFingerprintSize = 512 * 1024
 
+// CRC-64 is much quicker than the cryptographic hashes but is more prone to
+// collisions: suitable for identifying candidate duplicates.
+var crc64Table = crc64.MakeTable(crc64.ECMA)
+
 func Create(path, fileAlgorithm, directoryAlgorithm string) (Fingerprint, error) {
+	defer timing.Start(timing.Hash)()
+
 	stat, err := os.Stat(path)
 	if err != nil {
 		if os.IsNotExist(err) {
@@ -65,12 +73,18 @@ func Create(path, fileAlgorithm, directoryAlgorithm string) (Fingerprint, error)
 		return dynamicFingerprint(path, sha1.New(), stat.Size())
 	case "dynamic:MD5":
 		return dynamicFingerprint(path, md5.New(), stat.Size())
+	case "dynamic:CRC64":
+		return dynamicFingerprint(path, crc64.New(crc64Table), stat.Size())
 	case "SHA256":
 		return regularFingerprint(path, sha256.New())
 	case "SHA1":
 		return regularFingerprint(path, sha1.New())
 	case "MD5":
 		return regularFingerprint(path, md5.New())
+	case "CRC64":
+		return regularFingerprint(path, crc64.New(crc64Table))
+	case DifferenceHash:
+		return dHashFingerprint(path)
 	case "none":
 		return Empty, nil
 	default:
@@ -78,6 +92,34 @@ func Create(path, fileAlgorithm, directoryAlgorithm string) (Fingerprint, error)
 	}
 }
 
+// Whether the file fingerprint algorithm is derived from the file's contents
+// alone, such that the fingerprint of an unchanged file may be reused.
+func IsContentAlgorithm(fileAlgorithm string) bool {
+	switch fileAlgorithm {
+	case "dynamic:SHA256", "", "dynamic:SHA1", "dynamic:MD5", "dynamic:CRC64", "SHA256", "SHA1", "MD5", "CRC64", DifferenceHash:
+		return true
+	}
+
+	return false
+}
+
+// Whether the fingerprint the algorithm calculates for a file of the specified
+// size is the hex-encoded hash of the file's whole content by the hash
+// function named, e.g. 'SHA256', as the dynamic algorithms' are for all but
+// large files.
+func IsWholeFileHash(fileAlgorithm, hashName string, fileSize int64) bool {
+	switch fileAlgorithm {
+	case hashName:
+		return true
+	case "dynamic:" + hashName:
+		return fileSize <= sparseFingerprintThreshold
+	case "":
+		return hashName == "SHA256" && fileSize <= sparseFingerprintThreshold
+	}
+
+	return false
+}
+
 // unexported
 
 func regularFingerprint(path string, h hash.Hash) (Fingerprint, error) {
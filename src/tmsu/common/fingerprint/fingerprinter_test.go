@@ -41,6 +41,11 @@ func TestSHA256Generation(test *testing.T) {
 	testCreateForLargeFile(test, "SHA256", "a4bd6407e40326c126f10412e245e4491c511636dbeddc3d2b16b41700017bc9")
 }
 
+func TestCRC64Generation(test *testing.T) {
+	testCreateForSmallFile(test, "CRC64", "55e79f48c79bc04b")
+	testCreateForLargeFile(test, "CRC64", "a0bf130a26866823")
+}
+
 func TestDynamicMD5Generation(test *testing.T) {
 	testCreateForSmallFile(test, "dynamic:MD5", "a758071b3c2fe43c9a9b91db5077cd12")
 	testCreateForLargeFile(test, "dynamic:MD5", "668a4b622482b9fd30b1ad0eac4ab8f1")
@@ -56,11 +61,30 @@ func TestDynamicSHA256Generation(test *testing.T) {
 	testCreateForLargeFile(test, "dynamic:SHA256", "0a9f9c7cd5939b04ad4bb7d14f801fe671c1b622d0e3b7769798b14dbdbf07f1")
 }
 
+func TestDynamicCRC64Generation(test *testing.T) {
+	testCreateForSmallFile(test, "dynamic:CRC64", "55e79f48c79bc04b")
+	testCreateForLargeFile(test, "dynamic:CRC64", "9b853bd8ca967c84")
+}
+
 func TestNoneGeneration(test *testing.T) {
 	testCreateForSmallFile(test, "none", "")
 	testCreateForLargeFile(test, "none", "")
 }
 
+func TestDistance(test *testing.T) {
+	distance, err := Distance("00000000000000ff", "000000000000000f")
+	if err != nil {
+		test.Fatal(err)
+	}
+	if distance != 4 {
+		test.Fatalf("Expected distance of 4 but was %v", distance)
+	}
+
+	if _, err := Distance("00000000000000ff", "not a hash"); err == nil {
+		test.Fatalf("Expected error for invalid hash")
+	}
+}
+
 // unexported
 
 func testCreateForSmallFile(test *testing.T, algorithm string, expectedFingerprint Fingerprint) {
@@ -0,0 +1,116 @@
+// Copyright 2011-2015 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package fingerprint
+
+import (
+	"fmt"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"math/bits"
+	"os"
+	"strconv"
+)
+
+// The perceptual hash algorithm: a difference hash of the image reduced to
+// 9x8 grey pixels, which is little affected by resizing or re-encoding.
+const DifferenceHash = "dHash"
+
+const dHashWidth = 9
+const dHashHeight = 8
+
+// The number of bits that differ between two perceptual hashes: the smaller
+// the distance, the more similar the images.
+func Distance(fingerprint, other Fingerprint) (int, error) {
+	value, err := strconv.ParseUint(string(fingerprint), 16, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid perceptual hash '%v'", fingerprint)
+	}
+
+	otherValue, err := strconv.ParseUint(string(other), 16, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid perceptual hash '%v'", other)
+	}
+
+	return bits.OnesCount64(value ^ otherValue), nil
+}
+
+// unexported
+
+// Calculates the difference hash of the image at the path. Files that are not
+// images in a supported format (GIF, JPEG or PNG) have an empty fingerprint.
+func dHashFingerprint(path string) (Fingerprint, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return Empty, err
+	}
+	defer file.Close()
+
+	img, _, err := image.Decode(file)
+	if err != nil {
+		return Empty, nil
+	}
+
+	grey := reduceImage(img, dHashWidth, dHashHeight)
+
+	var hash uint64
+	for y := 0; y < dHashHeight; y++ {
+		for x := 0; x < dHashWidth-1; x++ {
+			hash <<= 1
+			if grey[y][x] < grey[y][x+1] {
+				hash |= 1
+			}
+		}
+	}
+
+	return Fingerprint(fmt.Sprintf("%016x", hash)), nil
+}
+
+// Reduces the image to the specified size in grey, each pixel being the mean
+// brightness of the area of the image it covers.
+func reduceImage(img image.Image, width, height int) [][]float64 {
+	bounds := img.Bounds()
+
+	sums := make([][]float64, height)
+	counts := make([][]int, height)
+	for y := range sums {
+		sums[y] = make([]float64, width)
+		counts[y] = make([]int, width)
+	}
+
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		cellY := (y - bounds.Min.Y) * height / bounds.Dy()
+
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			cellX := (x - bounds.Min.X) * width / bounds.Dx()
+
+			r, g, b, _ := img.At(x, y).RGBA()
+			sums[cellY][cellX] += 0.299*float64(r) + 0.587*float64(g) + 0.114*float64(b)
+			counts[cellY][cellX]++
+		}
+	}
+
+	for y := range sums {
+		for x := range sums[y] {
+			if counts[y][x] > 0 {
+				sums[y][x] /= float64(counts[y][x])
+			}
+		}
+	}
+
+	return sums
+}
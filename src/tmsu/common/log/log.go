@@ -22,6 +22,8 @@ import (
 	"time"
 )
 
+// The verbosity of the log: 0 shows only errors, 1 also shows warnings and
+// higher values show increasingly detailed information.
 var Verbosity uint = 1
 
 func Fatal(values ...interface{}) {
@@ -34,11 +36,27 @@ func Fatalf(format string, values ...interface{}) {
 	os.Exit(1)
 }
 
+func Error(values ...interface{}) {
+	log(os.Stderr, values...)
+}
+
+func Errorf(format string, values ...interface{}) {
+	logf(os.Stderr, format, values...)
+}
+
 func Warn(values ...interface{}) {
+	if Verbosity < 1 {
+		return
+	}
+
 	log(os.Stderr, values...)
 }
 
 func Warnf(format string, values ...interface{}) {
+	if Verbosity < 1 {
+		return
+	}
+
 	logf(os.Stderr, format, values...)
 }
 
@@ -62,16 +80,16 @@ func Infof(verbosity uint, format string, values ...interface{}) {
 
 func log(dest io.Writer, values ...interface{}) {
 	if Verbosity > 1 {
-		fmt.Printf("%v: ", time.Now())
+		fmt.Fprintf(dest, "%v: ", time.Now())
 	}
 
-	fmt.Printf("tmsu: ")
-	fmt.Println(values...)
+	fmt.Fprint(dest, "tmsu: ")
+	fmt.Fprintln(dest, values...)
 }
 
 func logf(dest io.Writer, format string, values ...interface{}) {
 	if Verbosity > 1 {
-		fmt.Printf("%v: ", time.Now())
+		fmt.Fprintf(dest, "%v: ", time.Now())
 	}
 
 	format = "tmsu: " + format + "\n"
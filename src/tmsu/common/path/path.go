@@ -42,7 +42,24 @@ func Rel(path string) string {
 	return RelTo(path, workingDirectory)
 }
 
+// Normalises the path so that equivalent paths compare equal: the path is
+// cleaned and, on Windows, '/' separators are converted to '\' and any drive
+// letter is upper-cased.
+func Normalise(path string) string {
+	return filepath.Clean(normalise(path, filepath.Separator))
+}
+
+// Determines whether the paths refer to the same file, ignoring differences
+// of case where the platform's paths are not case-sensitive.
+func Equal(path, other string) bool {
+	return equal(path, other, caseSensitive)
+}
+
 func RelTo(path, to string) string {
+	if IsURL(path) {
+		return path
+	}
+
 	var err error
 
 	path, err = filepath.Abs(path)
@@ -55,19 +72,19 @@ func RelTo(path, to string) string {
 		panic("could not get absolute path")
 	}
 
-	if path == to {
+	if Equal(path, to) {
 		return "."
 	}
 
 	prefix := trailingSeparator(to)
-	if strings.HasPrefix(path, prefix) {
+	if hasPrefix(path, prefix, caseSensitive) {
 		// can't use filepath.Join as it strips the leading './'
 		return "." + string(filepath.Separator) + path[len(prefix):]
 	}
 
 	to = filepath.Dir(to)
 	prefix = trailingSeparator(to)
-	if strings.HasPrefix(path, prefix) {
+	if hasPrefix(path, prefix, caseSensitive) {
 		// can't use filepath.Join as it strips the leading './'
 		return ".." + string(filepath.Separator) + path[len(prefix):]
 	}
@@ -92,6 +109,48 @@ func UnescapeOctal(path string) string {
 
 var octalEscapePattern = regexp.MustCompile(`\\[0-7]{3}`)
 
+// Where the separator is '\' (Windows), converts any '/' to '\', collapses
+// repeated separators and upper-cases any drive letter. The leading pair of
+// separators of a UNC path (\\server\share) is preserved. Otherwise '\' is
+// an ordinary character and the path is returned unchanged.
+func normalise(path string, separator byte) string {
+	if separator != '\\' {
+		return path
+	}
+
+	normalised := make([]byte, 0, len(path))
+	for index := 0; index < len(path); index++ {
+		char := path[index]
+		if char == '/' {
+			char = '\\'
+		}
+
+		if char == '\\' && len(normalised) > 1 && normalised[len(normalised)-1] == '\\' {
+			continue
+		}
+
+		normalised = append(normalised, char)
+	}
+
+	if len(normalised) >= 2 && normalised[1] == ':' && normalised[0] >= 'a' && normalised[0] <= 'z' {
+		normalised[0] -= 'a' - 'A'
+	}
+
+	return string(normalised)
+}
+
+func equal(path, other string, caseSensitive bool) bool {
+	if caseSensitive {
+		return path == other
+	}
+
+	return strings.EqualFold(path, other)
+}
+
+func hasPrefix(path, prefix string, caseSensitive bool) bool {
+	return len(path) >= len(prefix) && equal(path[:len(prefix)], prefix, caseSensitive)
+}
+
 func trailingSeparator(path string) string {
 	if path[len(path)-1] == filepath.Separator {
 		return path
@@ -43,3 +43,44 @@ func TestRelTo(test *testing.T) {
 		}
 	}
 }
+
+func TestNormaliseWindowsPaths(test *testing.T) {
+	paths := map[string]string{
+		`C:\Music\jazz.mp3`:          `C:\Music\jazz.mp3`,
+		`c:\Music\jazz.mp3`:          `C:\Music\jazz.mp3`,
+		`c:/Music/jazz.mp3`:          `C:\Music\jazz.mp3`,
+		`C:\Music/Blues\\jazz.mp3`:   `C:\Music\Blues\jazz.mp3`,
+		`C:/Music//Blues/jazz.mp3`:   `C:\Music\Blues\jazz.mp3`,
+		`\\server\share/Music\a.mp3`: `\\server\share\Music\a.mp3`,
+		`//server/share/Music/a.mp3`: `\\server\share\Music\a.mp3`}
+
+	for path, expected := range paths {
+		actual := normalise(path, '\\')
+		if actual != expected {
+			test.Fatalf("Normalised '%v' to '%v' but expected '%v'", path, actual, expected)
+		}
+	}
+}
+
+func TestNormaliseUnixPaths(test *testing.T) {
+	paths := []string{`/some/path`, `/some\path`, `c:/some/path`}
+
+	for _, path := range paths {
+		actual := normalise(path, '/')
+		if actual != path {
+			test.Fatalf("Normalised '%v' to '%v' but expected it to be unchanged", path, actual)
+		}
+	}
+}
+
+func TestHasPrefixIgnoringCase(test *testing.T) {
+	if !hasPrefix(`C:\Music\jazz.mp3`, `c:\music\`, false) {
+		test.Fatal("Expected case-insensitive prefix to match")
+	}
+	if hasPrefix(`C:\Music\jazz.mp3`, `c:\music\`, true) {
+		test.Fatal("Expected case-sensitive prefix not to match")
+	}
+	if hasPrefix(`C:\Music`, `C:\Music\`, false) {
+		test.Fatal("Expected longer prefix not to match")
+	}
+}
@@ -112,12 +112,14 @@ func newNode(name string, isReal bool, isDir bool) *node {
 }
 
 func (node *node) paths(paths []string, prefix string) []string {
+	path := joinNodeName(prefix, node.name)
+
 	if node.isReal {
-		paths = append(paths, filepath.Join(prefix, node.name))
+		paths = append(paths, path)
 	}
 
 	for _, childNode := range node.nodes {
-		paths = childNode.paths(paths, filepath.Join(prefix, node.name))
+		paths = childNode.paths(paths, path)
 	}
 
 	return paths
@@ -169,3 +171,13 @@ func (node *node) findDirectories(resultNode *node) {
 		childNode.findDirectories(resultChildNode)
 	}
 }
+
+// Joins the node's name to the path of its parent. A drive (on Windows) is
+// the root of its own tree rather than a child of the root directory.
+func joinNodeName(prefix, name string) string {
+	if name != "" && filepath.VolumeName(name) == name {
+		return name + string(filepath.Separator)
+	}
+
+	return filepath.Join(prefix, name)
+}
@@ -0,0 +1,117 @@
+// Copyright 2011-2015 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package path
+
+import (
+	"net/url"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// Determines whether the path is a URL, such as 'https://example.com/page',
+// rather than a file-system path. Single letter schemes are not recognised so
+// as not to mistake Windows drive letters for them.
+func IsURL(path string) bool {
+	return urlPattern.MatchString(path)
+}
+
+// The scheme of the URL, e.g. 'https', in lower case.
+func Scheme(path string) string {
+	if !IsURL(path) {
+		return ""
+	}
+
+	return strings.ToLower(path[:strings.Index(path, ":")])
+}
+
+// Converts a 'file://' URL to the path it refers to. Other paths and URLs
+// are returned unchanged.
+func FromFileURL(path string) string {
+	if Scheme(path) != "file" {
+		return path
+	}
+
+	parsed, err := url.Parse(path)
+	if err != nil || parsed.Path == "" {
+		return path
+	}
+
+	path = parsed.Path
+	if len(path) > 2 && path[0] == '/' && path[2] == ':' {
+		path = path[1:] // drive letter, e.g. file:///C:/Music
+	}
+
+	return filepath.FromSlash(path)
+}
+
+// As filepath.Abs but URLs, which are already absolute, are returned unchanged
+// and 'file://' URLs are converted to the absolute path they refer to.
+func Abs(path string) (string, error) {
+	path = FromFileURL(path)
+	if IsURL(path) {
+		return path, nil
+	}
+
+	return filepath.Abs(path)
+}
+
+// As filepath.Dir but URLs are split at their last '/' with the separator
+// following the scheme left intact.
+func Dir(path string) string {
+	if !IsURL(path) {
+		return filepath.Dir(path)
+	}
+
+	index := strings.LastIndex(path, "/")
+	if index < len(urlPattern.FindString(path)) {
+		return urlPattern.FindString(path)
+	}
+
+	return path[:index]
+}
+
+// As filepath.Base but for URLs the text following the last '/'.
+func Base(path string) string {
+	if !IsURL(path) {
+		return filepath.Base(path)
+	}
+
+	index := strings.LastIndex(path, "/")
+	if index < len(urlPattern.FindString(path)) {
+		return path[len(urlPattern.FindString(path)):]
+	}
+
+	return path[index+1:]
+}
+
+// As filepath.Join for a directory and name as split by Dir and Base, so that
+// URLs are rejoined as they were.
+func Join(dir, name string) string {
+	if !IsURL(dir) {
+		return filepath.Join(dir, name)
+	}
+
+	if strings.HasSuffix(dir, "/") {
+		return dir + name
+	}
+
+	return dir + "/" + name
+}
+
+// unexported
+
+var urlPattern = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9+.-]+://`)
@@ -0,0 +1,69 @@
+// Copyright 2011-2015 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package path
+
+import (
+	"testing"
+)
+
+func TestIsURL(test *testing.T) {
+	paths := map[string]bool{
+		"https://example.com/page": true,
+		"ftp://example.com":        true,
+		"/some/path":               false,
+		"relative/path":            false,
+		`C:\Music\jazz.mp3`:        false,
+		"c://Music":                false,
+		"not a url: https://":      false}
+
+	for path, expected := range paths {
+		if actual := IsURL(path); actual != expected {
+			test.Fatalf("Expected IsURL('%v') to be %v but was %v", path, expected, actual)
+		}
+	}
+}
+
+func TestURLDirAndBase(test *testing.T) {
+	paths := map[string][2]string{
+		"https://example.com/a/page.html": {"https://example.com/a", "page.html"},
+		"https://example.com/page":        {"https://example.com", "page"},
+		"https://example.com":             {"https://", "example.com"},
+		"https://example.com/":            {"https://example.com", ""}}
+
+	for path, expected := range paths {
+		dir, base := Dir(path), Base(path)
+		if dir != expected[0] || base != expected[1] {
+			test.Fatalf("Expected '%v' to be split as %v but was ['%v' '%v']", path, expected, dir, base)
+		}
+
+		if joined := Join(dir, base); joined != path {
+			test.Fatalf("Expected '%v' to be rejoined but was '%v'", path, joined)
+		}
+	}
+}
+
+func TestFromFileURL(test *testing.T) {
+	paths := map[string]string{
+		"file:///home/bob/a%20b.txt": "/home/bob/a b.txt",
+		"https://example.com/page":   "https://example.com/page",
+		"/home/bob":                  "/home/bob"}
+
+	for path, expected := range paths {
+		if actual := FromFileURL(path); actual != expected {
+			test.Fatalf("Expected '%v' to be converted to '%v' but was '%v'", path, expected, actual)
+		}
+	}
+}
@@ -0,0 +1,152 @@
+// Copyright 2011-2015 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package path
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"sync"
+	"tmsu/common/timing"
+)
+
+// An entry within a directory.
+type Entry struct {
+	Path string
+	Info os.FileInfo // nil if the entry could not be stat'd
+	Err  error       // the error from stat-ing the entry, if any
+}
+
+// The maximum number of entries stat'd concurrently by Walk.
+var WalkConcurrency = 4 * runtime.NumCPU()
+
+// The number of directory entries read at a time by Walk.
+var WalkChunkSize = 4096
+
+// Walks the directory tree rooted at the specified directory, calling visit
+// with the entries of each directory or the error from reading it. Large
+// directories are read in chunks of WalkChunkSize entries, with visit called
+// for each chunk, so that their entries are never all held in memory at once:
+// the entries are sorted by name within each chunk. A directory is closed
+// before its subdirectories are walked, in name order, so only one directory
+// is open at a time. Entries are stat'd concurrently but visit is called for
+// one chunk at a time, in depth-first order. Symbolic links to directories
+// are followed. The walk stops at the first error returned by visit.
+func Walk(dir string, visit func(dir string, entries []Entry, err error) error) error {
+	subdirs, err := walkDir(dir, visit)
+	if err != nil {
+		return err
+	}
+
+	for _, subdir := range subdirs {
+		if err := Walk(subdir, visit); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// unexported
+
+// Visits the entries of the directory a chunk at a time, returning the paths
+// of its subdirectories.
+func walkDir(dir string, visit func(dir string, entries []Entry, err error) error) ([]string, error) {
+	file, err := os.Open(dir)
+	if err != nil {
+		return nil, visit(dir, nil, err)
+	}
+	defer file.Close()
+
+	subdirs := make([]string, 0, 10)
+	visited := false
+
+	for {
+		stop := timing.Start(timing.Walk)
+		names, err := file.Readdirnames(WalkChunkSize)
+		stop()
+
+		if len(names) > 0 {
+			sort.Strings(names)
+
+			entries := statEntries(dir, names)
+			for _, entry := range entries {
+				if entry.Info != nil && entry.Info.IsDir() {
+					subdirs = append(subdirs, entry.Path)
+				}
+			}
+
+			if err := visit(dir, entries, nil); err != nil {
+				return nil, err
+			}
+
+			visited = true
+		}
+
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, visit(dir, nil, err)
+		}
+	}
+
+	if !visited {
+		if err := visit(dir, []Entry{}, nil); err != nil {
+			return nil, err
+		}
+	}
+
+	sort.Strings(subdirs)
+
+	return subdirs, nil
+}
+
+// Stats the named entries of the directory using up to WalkConcurrency
+// goroutines.
+func statEntries(dir string, names []string) []Entry {
+	entries := make([]Entry, len(names))
+	indices := make(chan int)
+
+	var wait sync.WaitGroup
+	for worker := 0; worker < WalkConcurrency && worker < len(names); worker++ {
+		wait.Add(1)
+
+		go func() {
+			defer wait.Done()
+
+			for index := range indices {
+				path := filepath.Join(dir, names[index])
+				stop := timing.Start(timing.Stat)
+				info, err := os.Stat(path)
+				stop()
+
+				entries[index] = Entry{path, info, err}
+			}
+		}()
+	}
+
+	for index := range names {
+		indices <- index
+	}
+	close(indices)
+
+	wait.Wait()
+
+	return entries
+}
@@ -0,0 +1,139 @@
+// Copyright 2011-2015 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package path
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestWalk(test *testing.T) {
+	// set-up
+
+	root, err := ioutil.TempDir("", "tmsu")
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	for _, dir := range []string{"b/d", "b/c", "a"} {
+		if err := os.MkdirAll(filepath.Join(root, dir), 0755); err != nil {
+			test.Fatal(err)
+		}
+	}
+	for _, file := range []string{"b/d/f", "b/e", "g"} {
+		if err := ioutil.WriteFile(filepath.Join(root, file), []byte{}, 0644); err != nil {
+			test.Fatal(err)
+		}
+	}
+
+	// test
+
+	dirs := make([]string, 0, 5)
+	paths := make([]string, 0, 10)
+	err = Walk(root, func(dir string, entries []Entry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		dirs = append(dirs, dir[len(root):])
+		for _, entry := range entries {
+			paths = append(paths, entry.Path[len(root):])
+		}
+
+		return nil
+	})
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	// validate
+
+	expectedDirs := []string{"", "/a", "/b", "/b/c", "/b/d"}
+	if len(dirs) != len(expectedDirs) {
+		test.Fatalf("Expected %v directories to be visited but were %v: %v", len(expectedDirs), len(dirs), dirs)
+	}
+	for index, dir := range expectedDirs {
+		if dirs[index] != dir {
+			test.Fatalf("Expected directory %v to be '%v' but was '%v'.", index, dir, dirs[index])
+		}
+	}
+
+	expectedPaths := []string{"/a", "/b", "/g", "/b/c", "/b/d", "/b/e", "/b/d/f"}
+	if len(paths) != len(expectedPaths) {
+		test.Fatalf("Expected %v entries but were %v: %v", len(expectedPaths), len(paths), paths)
+	}
+	for index, path := range expectedPaths {
+		if paths[index] != path {
+			test.Fatalf("Expected entry %v to be '%v' but was '%v'.", index, path, paths[index])
+		}
+	}
+}
+
+func TestWalkInChunks(test *testing.T) {
+	// set-up
+
+	root, err := ioutil.TempDir("", "tmsu")
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	for _, file := range []string{"a", "b", "c", "d", "e"} {
+		if err := ioutil.WriteFile(filepath.Join(root, file), []byte{}, 0644); err != nil {
+			test.Fatal(err)
+		}
+	}
+
+	chunkSize := WalkChunkSize
+	WalkChunkSize = 2
+	defer func() { WalkChunkSize = chunkSize }()
+
+	// test
+
+	visits := 0
+	seen := make(map[string]bool)
+	err = Walk(root, func(dir string, entries []Entry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if len(entries) > WalkChunkSize {
+			test.Fatalf("Expected at most %v entries per visit but were %v", WalkChunkSize, len(entries))
+		}
+
+		visits++
+		for _, entry := range entries {
+			seen[entry.Path[len(root):]] = true
+		}
+
+		return nil
+	})
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	// validate
+
+	if visits != 3 {
+		test.Fatalf("Expected 3 visits but were %v", visits)
+	}
+	if len(seen) != 5 {
+		test.Fatalf("Expected 5 entries but were %v: %v", len(seen), seen)
+	}
+}
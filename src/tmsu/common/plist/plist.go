@@ -0,0 +1,182 @@
+// Copyright 2011-2015 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+// Package plist reads the binary property lists of macOS.
+package plist
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"unicode/utf16"
+)
+
+var NotBinaryPlistError = errors.New("not a binary property list")
+
+// Reads the array of strings that is the top object of the binary property
+// list, as in the extended attribute holding a file's Finder tags.
+func ReadStrings(data []byte) ([]string, error) {
+	reader, err := newReader(data)
+	if err != nil {
+		return nil, err
+	}
+
+	refs, err := reader.array(reader.top)
+	if err != nil {
+		return nil, err
+	}
+
+	strings := make([]string, len(refs))
+	for index, ref := range refs {
+		if strings[index], err = reader.string(ref); err != nil {
+			return nil, err
+		}
+	}
+
+	return strings, nil
+}
+
+// unexported
+
+const header = "bplist00"
+const trailerSize = 32
+
+type reader struct {
+	data          []byte
+	offsets       []uint64
+	objectRefSize int
+	top           uint64
+}
+
+func newReader(data []byte) (*reader, error) {
+	if len(data) < len(header)+trailerSize || string(data[:len(header)]) != header {
+		return nil, NotBinaryPlistError
+	}
+
+	trailer := data[len(data)-trailerSize:]
+	offsetSize := int(trailer[6])
+	objectRefSize := int(trailer[7])
+	count := binary.BigEndian.Uint64(trailer[8:16])
+	top := binary.BigEndian.Uint64(trailer[16:24])
+	tableOffset := binary.BigEndian.Uint64(trailer[24:32])
+
+	if offsetSize < 1 || offsetSize > 8 || objectRefSize < 1 || objectRefSize > 8 || top >= count {
+		return nil, fmt.Errorf("invalid binary property list trailer")
+	}
+	if tableOffset+count*uint64(offsetSize) > uint64(len(data)-trailerSize) {
+		return nil, fmt.Errorf("binary property list offset table is truncated")
+	}
+
+	offsets := make([]uint64, count)
+	for index := range offsets {
+		start := tableOffset + uint64(index*offsetSize)
+		offsets[index] = readUint(data[start : start+uint64(offsetSize)])
+	}
+
+	return &reader{data, offsets, objectRefSize, top}, nil
+}
+
+// Reads the marker of the object, returning its type, its length and the
+// position of its content.
+func (reader *reader) object(ref uint64) (byte, uint64, uint64, error) {
+	if ref >= uint64(len(reader.offsets)) || reader.offsets[ref] >= uint64(len(reader.data)) {
+		return 0, 0, 0, fmt.Errorf("invalid object reference %v", ref)
+	}
+
+	position := reader.offsets[ref]
+	marker := reader.data[position]
+	kind, length := marker>>4, uint64(marker&0x0f)
+	position++
+
+	if length == 0x0f && kind != 0x0 {
+		// the length follows as an integer object
+		if position >= uint64(len(reader.data)) || reader.data[position]>>4 != 0x1 {
+			return 0, 0, 0, fmt.Errorf("invalid object length")
+		}
+
+		size := uint64(1) << (reader.data[position] & 0x0f)
+		position++
+		if position+size > uint64(len(reader.data)) {
+			return 0, 0, 0, fmt.Errorf("object length is truncated")
+		}
+
+		length = readUint(reader.data[position : position+size])
+		position += size
+	}
+
+	return kind, length, position, nil
+}
+
+func (reader *reader) array(ref uint64) ([]uint64, error) {
+	kind, length, position, err := reader.object(ref)
+	if err != nil {
+		return nil, err
+	}
+	if kind != 0xa {
+		return nil, fmt.Errorf("expected an array but found object type %x", kind)
+	}
+
+	size := uint64(reader.objectRefSize)
+	if position+length*size > uint64(len(reader.data)) {
+		return nil, fmt.Errorf("array is truncated")
+	}
+
+	refs := make([]uint64, length)
+	for index := range refs {
+		start := position + uint64(index)*size
+		refs[index] = readUint(reader.data[start : start+size])
+	}
+
+	return refs, nil
+}
+
+func (reader *reader) string(ref uint64) (string, error) {
+	kind, length, position, err := reader.object(ref)
+	if err != nil {
+		return "", err
+	}
+
+	switch kind {
+	case 0x5: // ASCII
+		if position+length > uint64(len(reader.data)) {
+			return "", fmt.Errorf("string is truncated")
+		}
+
+		return string(reader.data[position : position+length]), nil
+	case 0x6: // UTF-16, big-endian
+		if position+2*length > uint64(len(reader.data)) {
+			return "", fmt.Errorf("string is truncated")
+		}
+
+		units := make([]uint16, length)
+		for index := range units {
+			start := position + uint64(2*index)
+			units[index] = binary.BigEndian.Uint16(reader.data[start : start+2])
+		}
+
+		return string(utf16.Decode(units)), nil
+	default:
+		return "", fmt.Errorf("expected a string but found object type %x", kind)
+	}
+}
+
+func readUint(bytes []byte) uint64 {
+	value := uint64(0)
+	for _, b := range bytes {
+		value = value<<8 | uint64(b)
+	}
+
+	return value
+}
@@ -0,0 +1,104 @@
+// Copyright 2011-2015 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package plist
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+	"unicode/utf16"
+)
+
+func TestReadStrings(test *testing.T) {
+	data := encodeStrings("Red\n6", "Work", "café")
+
+	strings, err := ReadStrings(data)
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	expected := []string{"Red\n6", "Work", "café"}
+	if len(strings) != len(expected) {
+		test.Fatalf("Expected %v strings but got %v: %v", len(expected), len(strings), strings)
+	}
+	for index := range expected {
+		if strings[index] != expected[index] {
+			test.Fatalf("Expected '%v' but got '%v'.", expected[index], strings[index])
+		}
+	}
+}
+
+func TestReadStringsNotBinaryPlist(test *testing.T) {
+	if _, err := ReadStrings([]byte("<?xml version=\"1.0\"?><plist></plist>")); err != NotBinaryPlistError {
+		test.Fatalf("Expected NotBinaryPlistError but got %v.", err)
+	}
+}
+
+func TestReadStringsTruncated(test *testing.T) {
+	data := encodeStrings("Work")
+
+	if _, err := ReadStrings(append(data[:12], data[len(data)-trailerSize:]...)); err == nil {
+		test.Fatalf("Expected an error for a truncated property list.")
+	}
+}
+
+// unexported
+
+// Encodes an array of strings as a binary property list with one byte offsets
+// and object references.
+func encodeStrings(values ...string) []byte {
+	var buffer bytes.Buffer
+	buffer.WriteString(header)
+
+	offsets := make([]byte, 0, len(values)+1)
+
+	offsets = append(offsets, byte(buffer.Len()))
+	buffer.WriteByte(0xa0 | byte(len(values)))
+	for index := range values {
+		buffer.WriteByte(byte(index + 1))
+	}
+
+	for _, value := range values {
+		offsets = append(offsets, byte(buffer.Len()))
+
+		ascii := true
+		for _, r := range value {
+			if r > 0x7f {
+				ascii = false
+			}
+		}
+
+		if ascii {
+			buffer.WriteByte(0x50 | byte(len(value)))
+			buffer.WriteString(value)
+		} else {
+			units := utf16.Encode([]rune(value))
+			buffer.WriteByte(0x60 | byte(len(units)))
+			binary.Write(&buffer, binary.BigEndian, units)
+		}
+	}
+
+	tableOffset := buffer.Len()
+	buffer.Write(offsets)
+
+	trailer := make([]byte, trailerSize)
+	trailer[6], trailer[7] = 1, 1
+	binary.BigEndian.PutUint64(trailer[8:16], uint64(len(offsets)))
+	binary.BigEndian.PutUint64(trailer[24:32], uint64(tableOffset))
+	buffer.Write(trailer)
+
+	return buffer.Bytes()
+}
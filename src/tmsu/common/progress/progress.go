@@ -0,0 +1,128 @@
+// Copyright 2011-2015 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package progress
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+	"tmsu/common/log"
+	"tmsu/common/terminal"
+)
+
+// The minimum interval between redraws of the progress line.
+var Interval = 100 * time.Millisecond
+
+// Reports the progress of a long running operation on a single, periodically
+// redrawn line. Progress is only shown when standard output is a terminal and
+// neither quiet nor verbose logging is in effect, otherwise all of the methods
+// do nothing.
+type Reporter struct {
+	label   string
+	total   int
+	count   int
+	enabled bool
+	drawn   int
+	last    time.Time
+	dest    io.Writer
+}
+
+// Creates a new reporter. A total of zero indicates that the amount of work is
+// not known up front, in which case only a running count is shown.
+func New(label string, total int) *Reporter {
+	enabled := log.Verbosity == 1 && terminal.Width() > 0
+
+	return &Reporter{label, total, 0, enabled, 0, time.Time{}, os.Stderr}
+}
+
+// Creates a reporter that never shows progress.
+func None() *Reporter {
+	return &Reporter{"", 0, 0, false, 0, time.Time{}, os.Stderr}
+}
+
+// Records the completion of a single item of work.
+func (reporter *Reporter) Increment() {
+	reporter.Add(1)
+}
+
+// Records the completion of the specified number of items of work.
+func (reporter *Reporter) Add(count int) {
+	reporter.count += count
+
+	if !reporter.enabled {
+		return
+	}
+
+	now := time.Now()
+	if now.Sub(reporter.last) < Interval && reporter.count != reporter.total {
+		return
+	}
+	reporter.last = now
+
+	reporter.draw()
+}
+
+// Erases the progress line so that other output can be written. The line is
+// redrawn upon the next update.
+func (reporter *Reporter) Clear() {
+	if !reporter.enabled || reporter.drawn == 0 {
+		return
+	}
+
+	fmt.Fprint(reporter.dest, "\r"+strings.Repeat(" ", reporter.drawn)+"\r")
+	reporter.drawn = 0
+	reporter.last = time.Time{}
+}
+
+// Erases the progress line once the operation is complete.
+func (reporter *Reporter) Done() {
+	reporter.Clear()
+	reporter.enabled = false
+}
+
+// unexported
+
+func (reporter *Reporter) draw() {
+	var text string
+	if reporter.total > 0 {
+		percent := reporter.count * 100 / reporter.total
+		text = fmt.Sprintf("tmsu: %v: %3v%% %v (%v/%v)", reporter.label, percent, bar(percent), reporter.count, reporter.total)
+	} else {
+		text = fmt.Sprintf("tmsu: %v: %v", reporter.label, reporter.count)
+	}
+
+	width := terminal.Width() - 1
+	if width > 0 && len(text) > width {
+		text = text[:width]
+	}
+
+	padding := ""
+	if len(text) < reporter.drawn {
+		padding = strings.Repeat(" ", reporter.drawn-len(text))
+	}
+
+	fmt.Fprint(reporter.dest, "\r"+text+padding)
+	reporter.drawn = len(text)
+}
+
+func bar(percent int) string {
+	const length = 20
+
+	filled := percent * length / 100
+	return "[" + strings.Repeat("=", filled) + strings.Repeat(" ", length-filled) + "]"
+}
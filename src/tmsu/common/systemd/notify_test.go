@@ -0,0 +1,68 @@
+// Copyright 2011-2015 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package systemd
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestNotify(test *testing.T) {
+	// set-up
+
+	socketPath := filepath.Join(os.TempDir(), "tmsu_test_notify.sock")
+	os.Remove(socketPath)
+	defer os.Remove(socketPath)
+
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: socketPath, Net: "unixgram"})
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer conn.Close()
+
+	previous := os.Getenv("NOTIFY_SOCKET")
+	os.Setenv("NOTIFY_SOCKET", socketPath)
+	defer os.Setenv("NOTIFY_SOCKET", previous)
+
+	// test
+
+	if err := Notify("READY=1"); err != nil {
+		test.Fatal(err)
+	}
+
+	// validate
+
+	buffer := make([]byte, 64)
+	count, err := conn.Read(buffer)
+	if err != nil {
+		test.Fatal(err)
+	}
+	if string(buffer[:count]) != "READY=1" {
+		test.Fatalf("Expected 'READY=1' but was '%v'.", string(buffer[:count]))
+	}
+}
+
+func TestNotifyWithoutSocket(test *testing.T) {
+	previous := os.Getenv("NOTIFY_SOCKET")
+	os.Setenv("NOTIFY_SOCKET", "")
+	defer os.Setenv("NOTIFY_SOCKET", previous)
+
+	if err := Notify("READY=1"); err != nil {
+		test.Fatal(err)
+	}
+}
@@ -18,6 +18,7 @@ package ansi
 import (
 	"regexp"
 	"sort"
+	"tmsu/common/text"
 )
 
 func Bold(text string) string {
@@ -88,7 +89,7 @@ func (items ansiStrings) Len() int {
 }
 
 func (items ansiStrings) Less(i, j int) bool {
-	return Strip(items[i]) < Strip(items[j])
+	return text.Less(Strip(items[i]), Strip(items[j]))
 }
 
 func (items ansiStrings) Swap(i, j int) {
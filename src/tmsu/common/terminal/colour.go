@@ -0,0 +1,66 @@
+// Copyright 2011-2015 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package terminal
+
+import (
+	"fmt"
+	"os"
+)
+
+var colourWhen = "auto"
+
+// Sets when output is coloured: 'auto' (only when writing to a terminal),
+// 'always' or 'never'.
+func SetColourWhen(when string) error {
+	switch when {
+	case "auto", "always", "never":
+		colourWhen = when
+		return nil
+	}
+
+	return fmt.Errorf("invalid colour mode '%v': must be one of auto, always, never", when)
+}
+
+// Determines whether output written to the file is to be coloured.
+func ColourFor(file *os.File) bool {
+	switch colourWhen {
+	case "always":
+		return true
+	case "never":
+		return false
+	}
+
+	if !Colour() {
+		return false
+	}
+
+	stat, err := file.Stat()
+	if err != nil {
+		return false
+	}
+
+	return stat.Mode()&os.ModeCharDevice != 0
+}
+
+// Formats the text using the colour function, if output to the file is
+// coloured.
+func Colourise(file *os.File, colour func(string) string, text string) string {
+	if !ColourFor(file) {
+		return text
+	}
+
+	return colour(text)
+}
@@ -0,0 +1,59 @@
+// Copyright 2011-2015 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package terminal
+
+import (
+	"errors"
+	"io"
+	"os"
+)
+
+var InterruptedError = errors.New("interrupted")
+
+// Reads a line from the terminal without echoing it, as when prompting for a
+// passphrase.
+func ReadPassword(file *os.File) (string, error) {
+	state, err := MakeRaw(file)
+	if err != nil {
+		return "", err
+	}
+	defer Restore(file, state)
+
+	line := make([]byte, 0, 64)
+	buffer := make([]byte, 1)
+	for {
+		if _, err := file.Read(buffer); err != nil {
+			return "", err
+		}
+
+		switch buffer[0] {
+		case '\r', '\n':
+			return string(line), nil
+		case 3: // Ctrl+C
+			return "", InterruptedError
+		case 4: // Ctrl+D
+			if len(line) == 0 {
+				return "", io.EOF
+			}
+		case 8, 127: // backspace
+			if len(line) > 0 {
+				line = line[:len(line)-1]
+			}
+		default:
+			line = append(line, buffer[0])
+		}
+	}
+}
@@ -0,0 +1,74 @@
+// Copyright 2011-2015 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+// +build linux darwin dragonfly freebsd netbsd openbsd
+
+package terminal
+
+import (
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+// The terminal settings in force before MakeRaw, for restoring with Restore.
+type State struct {
+	termios syscall.Termios
+}
+
+// Whether the file is a terminal.
+func IsTerminal(file *os.File) bool {
+	var termios syscall.Termios
+	return ioctlTermios(file.Fd(), ioctlGetTermios, &termios) == nil
+}
+
+// Puts the terminal into raw mode, so that key presses are read as they are
+// typed without being echoed. Output processing is left enabled.
+func MakeRaw(file *os.File) (*State, error) {
+	var state State
+	if err := ioctlTermios(file.Fd(), ioctlGetTermios, &state.termios); err != nil {
+		return nil, err
+	}
+
+	raw := state.termios
+	raw.Iflag &^= syscall.IGNBRK | syscall.BRKINT | syscall.PARMRK | syscall.ISTRIP | syscall.INLCR | syscall.IGNCR | syscall.ICRNL | syscall.IXON
+	raw.Lflag &^= syscall.ECHO | syscall.ECHONL | syscall.ICANON | syscall.ISIG | syscall.IEXTEN
+	raw.Cflag &^= syscall.CSIZE | syscall.PARENB
+	raw.Cflag |= syscall.CS8
+	raw.Cc[syscall.VMIN] = 1
+	raw.Cc[syscall.VTIME] = 0
+
+	if err := ioctlTermios(file.Fd(), ioctlSetTermios, &raw); err != nil {
+		return nil, err
+	}
+
+	return &state, nil
+}
+
+// Restores the terminal settings saved by MakeRaw.
+func Restore(file *os.File, state *State) error {
+	return ioctlTermios(file.Fd(), ioctlSetTermios, &state.termios)
+}
+
+// unexported
+
+func ioctlTermios(fd uintptr, request uintptr, termios *syscall.Termios) error {
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, fd, request, uintptr(unsafe.Pointer(termios)))
+	if errno != 0 {
+		return errno
+	}
+
+	return nil
+}
@@ -0,0 +1,41 @@
+// Copyright 2011-2015 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+// +build !linux,!darwin,!dragonfly,!freebsd,!netbsd,!openbsd
+
+package terminal
+
+import (
+	"errors"
+	"os"
+)
+
+// The terminal settings in force before MakeRaw, for restoring with Restore.
+type State struct{}
+
+// Whether the file is a terminal.
+func IsTerminal(file *os.File) bool {
+	return false
+}
+
+// Raw mode is not supported on this platform.
+func MakeRaw(file *os.File) (*State, error) {
+	return nil, errors.New("raw terminal mode is not supported on this platform")
+}
+
+// Restores the terminal settings saved by MakeRaw.
+func Restore(file *os.File, state *State) error {
+	return nil
+}
@@ -28,11 +28,21 @@ func Colour() bool {
 }
 
 func Width() int {
+	return int(windowSize().cols)
+}
+
+func Height() int {
+	return int(windowSize().rows)
+}
+
+// unexported
+
+func windowSize() winsize {
 	var s winsize
 
 	_, _, _ = syscall.Syscall(syscall.SYS_IOCTL, os.Stdout.Fd(), uintptr(syscall.TIOCGWINSZ), uintptr(unsafe.Pointer(&s)))
 
-	return int(s.cols)
+	return s
 }
 
 type winsize struct {
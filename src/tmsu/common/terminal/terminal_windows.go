@@ -28,14 +28,8 @@ func Colour() bool {
 }
 
 func Width() int {
-	outHandle, err := syscall.GetStdHandle(syscall.STD_OUTPUT_HANDLE)
-	if err != nil {
-		return 0
-	}
-
-	info := &consoleScreenBufferInfo{}
-	success, _, _ := syscall.Syscall(getConsoleScreenBufferInfo.Addr(), 2, uintptr(outHandle), uintptr(unsafe.Pointer(info)), 0)
-	if int(success) == 0 {
+	info := screenBufferInfo()
+	if info == nil {
 		return 0
 	}
 
@@ -47,6 +41,32 @@ func Width() int {
 	return cols
 }
 
+func Height() int {
+	info := screenBufferInfo()
+	if info == nil {
+		return 0
+	}
+
+	return int(info.window.bottom-info.window.top) + 1
+}
+
+// unexported
+
+func screenBufferInfo() *consoleScreenBufferInfo {
+	outHandle, err := syscall.GetStdHandle(syscall.STD_OUTPUT_HANDLE)
+	if err != nil {
+		return nil
+	}
+
+	info := &consoleScreenBufferInfo{}
+	success, _, _ := syscall.Syscall(getConsoleScreenBufferInfo.Addr(), 2, uintptr(outHandle), uintptr(unsafe.Pointer(info)), 0)
+	if int(success) == 0 {
+		return nil
+	}
+
+	return info
+}
+
 type (
 	short int16
 	word  uint16
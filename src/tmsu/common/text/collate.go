@@ -0,0 +1,255 @@
+// Copyright 2011-2015 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package text
+
+import (
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// How names are ordered in listings. The zero value orders them by their bytes.
+type Collation struct {
+	// Order as in a dictionary: ignoring case and accents except to break ties
+	// (unaccented before accented, lower case before upper case), much like the
+	// C library's collation for Western European locales.
+	Locale bool
+
+	// Order runs of digits by their numeric value so that 'file2' precedes
+	// 'file10'.
+	Numeric bool
+}
+
+var collation Collation
+
+// Sets the collation used to order listings.
+func SetCollation(newCollation Collation) {
+	collation = newCollation
+}
+
+// The collation used to order listings.
+func CurrentCollation() Collation {
+	return collation
+}
+
+// Whether a precedes b in the current collation.
+func Less(a, b string) bool {
+	return collation.Compare(a, b) < 0
+}
+
+// Sorts the strings in the current collation.
+func Sort(items []string) {
+	sort.Sort(collatedStrings(items))
+}
+
+// Compares a with b, returning a negative number if a precedes b, a positive
+// number if it follows b and zero if they are identical.
+func (collation Collation) Compare(a, b string) int {
+	if !collation.Locale && !collation.Numeric {
+		return strings.Compare(a, b)
+	}
+
+	levels := []collationLevel{primaryLevel}
+	if collation.Locale {
+		levels = append(levels, secondaryLevel, tertiaryLevel)
+	} else {
+		levels = append(levels, secondaryLevel)
+	}
+
+	for _, level := range levels {
+		if result := collation.compareAt(level, []rune(a), []rune(b)); result != 0 {
+			return result
+		}
+	}
+
+	return strings.Compare(a, b)
+}
+
+// unexported
+
+type collationLevel int
+
+const (
+	primaryLevel   collationLevel = iota // base letters and numeric values
+	secondaryLevel                       // accents and leading zeros
+	tertiaryLevel                        // case
+)
+
+func (collation Collation) compareAt(level collationLevel, a, b []rune) int {
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		if collation.Numeric && isDigit(a[i]) && isDigit(b[j]) {
+			aEnd, bEnd := digitsEnd(a, i), digitsEnd(b, j)
+			if result := compareNumbers(level, a[i:aEnd], b[j:bEnd]); result != 0 {
+				return result
+			}
+
+			i, j = aEnd, bEnd
+			continue
+		}
+
+		if result := collation.compareRunes(level, a[i], b[j]); result != 0 {
+			return result
+		}
+
+		i++
+		j++
+	}
+
+	return compareInts(len(a)-i, len(b)-j)
+}
+
+func (collation Collation) compareRunes(level collationLevel, a, b rune) int {
+	if !collation.Locale {
+		if level == primaryLevel {
+			return compareInts(int(a), int(b))
+		}
+
+		return 0
+	}
+
+	switch level {
+	case primaryLevel:
+		return compareInts(int(baseLetter(unicode.ToLower(a))), int(baseLetter(unicode.ToLower(b))))
+	case secondaryLevel:
+		return compareInts(accentWeight(unicode.ToLower(a)), accentWeight(unicode.ToLower(b)))
+	case tertiaryLevel:
+		return compareInts(caseWeight(a), caseWeight(b))
+	}
+
+	return 0
+}
+
+// Compares runs of digits: by value and then, at the secondary level, the
+// fewer leading zeros first.
+func compareNumbers(level collationLevel, a, b []rune) int {
+	switch level {
+	case primaryLevel:
+		a, b = trimLeadingZeros(a), trimLeadingZeros(b)
+		if result := compareInts(len(a), len(b)); result != 0 {
+			return result
+		}
+
+		return strings.Compare(string(a), string(b))
+	case secondaryLevel:
+		return compareInts(len(a), len(b))
+	}
+
+	return 0
+}
+
+func isDigit(r rune) bool {
+	return r >= '0' && r <= '9'
+}
+
+func digitsEnd(runes []rune, start int) int {
+	end := start
+	for end < len(runes) && isDigit(runes[end]) {
+		end++
+	}
+
+	return end
+}
+
+func trimLeadingZeros(digits []rune) []rune {
+	for len(digits) > 1 && digits[0] == '0' {
+		digits = digits[1:]
+	}
+
+	return digits
+}
+
+func compareInts(a, b int) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+
+	return 0
+}
+
+// The unaccented letter for accented Latin letters.
+var baseLetters = map[rune]rune{}
+
+func init() {
+	for base, accented := range map[rune]string{
+		'a': "àáâãäåāăąǎ",
+		'c': "çćĉċč",
+		'd': "ďđ",
+		'e': "èéêëēĕėęě",
+		'g': "ĝğġģ",
+		'h': "ĥħ",
+		'i': "ìíîïĩīĭįı",
+		'j': "ĵ",
+		'k': "ķ",
+		'l': "ĺļľŀł",
+		'n': "ñńņňŉ",
+		'o': "òóôõöøōŏőǒ",
+		'r': "ŕŗř",
+		's': "śŝşšß",
+		't': "ţťŧ",
+		'u': "ùúûüũūŭůűųǔ",
+		'w': "ŵ",
+		'y': "ýÿŷ",
+		'z': "źżž",
+	} {
+		for _, letter := range accented {
+			baseLetters[letter] = base
+		}
+	}
+}
+
+func baseLetter(r rune) rune {
+	if base, ok := baseLetters[r]; ok {
+		return base
+	}
+
+	return r
+}
+
+// Unaccented letters precede accented ones, which are ordered by code point.
+func accentWeight(r rune) int {
+	if _, ok := baseLetters[r]; ok {
+		return int(r)
+	}
+
+	return 0
+}
+
+// Lower case precedes upper case.
+func caseWeight(r rune) int {
+	if unicode.IsUpper(r) {
+		return 1
+	}
+
+	return 0
+}
+
+type collatedStrings []string
+
+func (items collatedStrings) Len() int {
+	return len(items)
+}
+
+func (items collatedStrings) Less(i, j int) bool {
+	return Less(items[i], items[j])
+}
+
+func (items collatedStrings) Swap(i, j int) {
+	items[i], items[j] = items[j], items[i]
+}
@@ -0,0 +1,52 @@
+// Copyright 2011-2015 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package text
+
+import (
+	"testing"
+)
+
+func TestBinaryCollation(test *testing.T) {
+	validateCollation(test, Collation{}, []string{"file2", "été", "a", "file10", "B"}, []string{"B", "a", "file10", "file2", "été"})
+}
+
+func TestNumericCollation(test *testing.T) {
+	validateCollation(test, Collation{Numeric: true}, []string{"file10", "file2", "file02", "file1b", "file"}, []string{"file", "file1b", "file2", "file02", "file10"})
+}
+
+func TestLocaleCollation(test *testing.T) {
+	validateCollation(test, Collation{Locale: true}, []string{"Zebra", "apple", "Éclair", "eclair", "Eclair", "ecole", "école"}, []string{"apple", "eclair", "Eclair", "Éclair", "ecole", "école", "Zebra"})
+}
+
+func TestLocaleNumericCollation(test *testing.T) {
+	validateCollation(test, Collation{Locale: true, Numeric: true}, []string{"Track10", "track9", "Track1"}, []string{"Track1", "track9", "Track10"})
+}
+
+// unexported
+
+func validateCollation(test *testing.T, collation Collation, items, expected []string) {
+	previous := CurrentCollation()
+	SetCollation(collation)
+	defer SetCollation(previous)
+
+	Sort(items)
+
+	for index := range expected {
+		if items[index] != expected[index] {
+			test.Fatalf("Expected %v but was %v.", expected, items)
+		}
+	}
+}
@@ -15,6 +15,16 @@
 
 package text
 
+import "strings"
+
+var escaper = strings.NewReplacer(`\`, `\\`, " ", `\ `, "\t", "\\\t", `"`, `\"`, "'", `\'`)
+
+// Escapes the spaces, tabs, quotation marks and backslashes within the text
+// with a backslash so that Tokenize reads it back as a single token.
+func Escape(text string) string {
+	return escaper.Replace(text)
+}
+
 func Tokenize(text string) []string {
 	tokens := make([]string, 0, 10)
 	token := make([]rune, 0, 100)
@@ -16,6 +16,7 @@
 package text
 
 import (
+	"strings"
 	"testing"
 )
 
@@ -82,3 +83,23 @@ func TestComplex(test *testing.T) {
 		test.Fatalf("tokenization failed: %v", words)
 	}
 }
+
+func TestEscapedRoundTrip(test *testing.T) {
+	names := []string{"city", "new york", `it's`, `say "hi"`, `back\slash`}
+
+	escaped := make([]string, len(names))
+	for index, name := range names {
+		escaped[index] = Escape(name)
+	}
+
+	words := Tokenize(strings.Join(escaped, " "))
+
+	if len(words) != len(names) {
+		test.Fatalf("tokenization failed: %v", words)
+	}
+	for index, name := range names {
+		if words[index] != name {
+			test.Fatalf("tokenization failed: %v", words)
+		}
+	}
+}
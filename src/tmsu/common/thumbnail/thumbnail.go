@@ -0,0 +1,172 @@
+// Copyright 2011-2015 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+// Package thumbnail creates preview images of image and video files.
+package thumbnail
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	_ "image/gif"
+	_ "image/jpeg"
+	"image/png"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+var imageExtensions = map[string]bool{".gif": true, ".jpeg": true, ".jpg": true, ".png": true}
+
+var videoExtensions = map[string]bool{".avi": true, ".flv": true, ".m4v": true, ".mkv": true, ".mov": true, ".mp4": true, ".mpeg": true, ".mpg": true, ".webm": true, ".wmv": true}
+
+// Determines whether a thumbnail can be created for the file, judging by its
+// extension.
+func Supported(path string) bool {
+	extension := strings.ToLower(filepath.Ext(path))
+	return imageExtensions[extension] || videoExtensions[extension]
+}
+
+// Creates a PNG thumbnail, no larger than size pixels in either dimension, of
+// the image or video at path and writes it to destPath. Video thumbnails
+// require 'ffmpeg'.
+func Create(path, destPath string, size int) error {
+	extension := strings.ToLower(filepath.Ext(path))
+
+	// written alongside then renamed so a partial thumbnail is never visible
+	tempPath := destPath + ".tmp"
+
+	var err error
+	switch {
+	case imageExtensions[extension]:
+		err = createImageThumbnail(path, tempPath, size)
+	case videoExtensions[extension]:
+		err = createVideoThumbnail(path, tempPath, size)
+	default:
+		return fmt.Errorf("unsupported file type '%v'", extension)
+	}
+
+	if err != nil {
+		os.Remove(tempPath)
+		return err
+	}
+
+	return os.Rename(tempPath, destPath)
+}
+
+// unexported
+
+func createImageThumbnail(path, destPath string, size int) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	img, _, err := image.Decode(file)
+	if err != nil {
+		return fmt.Errorf("could not decode image: %v", err)
+	}
+
+	dest, err := os.Create(destPath)
+	if err != nil {
+		return err
+	}
+
+	if err := png.Encode(dest, scale(img, size)); err != nil {
+		dest.Close()
+		return err
+	}
+
+	return dest.Close()
+}
+
+func createVideoThumbnail(path, destPath string, size int) error {
+	ffmpeg, err := exec.LookPath("ffmpeg")
+	if err != nil {
+		return fmt.Errorf("'ffmpeg' is required for video thumbnails")
+	}
+
+	// the 'thumbnail' filter picks a representative frame, avoiding the black
+	// frame many videos open with
+	filter := fmt.Sprintf("thumbnail,scale=w='min(%[1]v,iw)':h='min(%[1]v,ih)':force_original_aspect_ratio=decrease", size)
+
+	var stderr bytes.Buffer
+	command := exec.Command(ffmpeg, "-loglevel", "error", "-nostdin", "-y", "-i", path, "-vf", filter, "-frames:v", "1", "-f", "image2", "-c:v", "png", destPath)
+	command.Stderr = &stderr
+
+	if err := command.Run(); err != nil {
+		if stderr.Len() > 0 {
+			return fmt.Errorf("ffmpeg failed: %v: %v", err, string(bytes.TrimSpace(stderr.Bytes())))
+		}
+
+		return fmt.Errorf("ffmpeg failed: %v", err)
+	}
+
+	return nil
+}
+
+// Scales the image down, preserving its aspect ratio, by averaging the source
+// pixels covered by each destination pixel.
+func scale(src image.Image, size int) image.Image {
+	bounds := src.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	if width <= size && height <= size {
+		return src
+	}
+
+	destWidth, destHeight := size, size
+	if width > height {
+		destHeight = height * size / width
+	} else {
+		destWidth = width * size / height
+	}
+	if destWidth < 1 {
+		destWidth = 1
+	}
+	if destHeight < 1 {
+		destHeight = 1
+	}
+
+	dest := image.NewRGBA(image.Rect(0, 0, destWidth, destHeight))
+
+	for y := 0; y < destHeight; y++ {
+		y0 := bounds.Min.Y + y*height/destHeight
+		y1 := bounds.Min.Y + (y+1)*height/destHeight
+
+		for x := 0; x < destWidth; x++ {
+			x0 := bounds.Min.X + x*width/destWidth
+			x1 := bounds.Min.X + (x+1)*width/destWidth
+
+			var r, g, b, a, count uint64
+			for sourceY := y0; sourceY < y1; sourceY++ {
+				for sourceX := x0; sourceX < x1; sourceX++ {
+					pixelR, pixelG, pixelB, pixelA := src.At(sourceX, sourceY).RGBA()
+					r += uint64(pixelR)
+					g += uint64(pixelG)
+					b += uint64(pixelB)
+					a += uint64(pixelA)
+					count++
+				}
+			}
+
+			dest.Set(x, y, color.RGBA64{R: uint16(r / count), G: uint16(g / count), B: uint16(b / count), A: uint16(a / count)})
+		}
+	}
+
+	return dest
+}
@@ -0,0 +1,99 @@
+// Copyright 2011-2015 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package thumbnail
+
+import (
+	"image"
+	"image/color"
+	"image/png"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCreateImageThumbnail(test *testing.T) {
+	// set-up
+
+	root, err := ioutil.TempDir("", "tmsu")
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	src := image.NewRGBA(image.Rect(0, 0, 600, 300))
+	for y := 0; y < 300; y++ {
+		for x := 0; x < 600; x++ {
+			src.Set(x, y, color.RGBA{R: 255, A: 255})
+		}
+	}
+
+	path := filepath.Join(root, "photo.png")
+	file, err := os.Create(path)
+	if err != nil {
+		test.Fatal(err)
+	}
+	if err := png.Encode(file, src); err != nil {
+		test.Fatal(err)
+	}
+	file.Close()
+
+	// test
+
+	destPath := filepath.Join(root, "thumb.png")
+	if err := Create(path, destPath, 256); err != nil {
+		test.Fatal(err)
+	}
+
+	// validate
+
+	dest, err := os.Open(destPath)
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer dest.Close()
+
+	thumb, err := png.Decode(dest)
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	if thumb.Bounds().Dx() != 256 || thumb.Bounds().Dy() != 128 {
+		test.Fatalf("Expected 256x128 thumbnail but was %vx%v.", thumb.Bounds().Dx(), thumb.Bounds().Dy())
+	}
+
+	r, g, b, a := thumb.At(100, 100).RGBA()
+	if r != 0xffff || g != 0 || b != 0 || a != 0xffff {
+		test.Fatalf("Expected red pixel but was %v, %v, %v, %v.", r, g, b, a)
+	}
+
+	if _, err := os.Stat(destPath + ".tmp"); !os.IsNotExist(err) {
+		test.Fatalf("Expected temporary file to be removed.")
+	}
+}
+
+func TestCreateUnsupported(test *testing.T) {
+	if Supported("/some/document.pdf") {
+		test.Fatalf("Expected PDF to be unsupported.")
+	}
+	if !Supported("/some/PHOTO.JPG") {
+		test.Fatalf("Expected JPEG to be supported.")
+	}
+
+	if err := Create("/some/document.pdf", "/tmp/thumb.png", 256); err == nil {
+		test.Fatalf("Expected error for unsupported file.")
+	}
+}
@@ -0,0 +1,101 @@
+// Copyright 2011-2015 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package timing
+
+import (
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+// The phases of work that are timed.
+const (
+	Walk = "walk" // reading directories
+	Stat = "stat" // stat-ing files
+	Hash = "hash" // fingerprinting files
+	SQL  = "sql"  // executing database statements
+)
+
+// Whether durations are recorded. Timing is off by default so that the
+// instrumented code pays nothing for it.
+var Enabled = false
+
+// Starts timing an occurrence of the phase, returning the function that stops
+// it, e.g. defer timing.Start(timing.Hash)().
+func Start(phase string) func() {
+	if !Enabled {
+		return func() {}
+	}
+
+	started := time.Now()
+
+	return func() {
+		Add(phase, time.Since(started))
+	}
+}
+
+// Records an occurrence of the phase that took the specified duration.
+func Add(phase string, duration time.Duration) {
+	if !Enabled {
+		return
+	}
+
+	lock.Lock()
+	defer lock.Unlock()
+
+	total := totals[phase]
+	total.count++
+	total.duration += duration
+	totals[phase] = total
+}
+
+// Writes the time spent in each phase, and the elapsed time, to the writer.
+// Phases that occur concurrently, such as stat-ing the entries of a directory,
+// may account for more time than has elapsed.
+func Report(dest io.Writer, elapsed time.Duration) {
+	lock.Lock()
+	defer lock.Unlock()
+
+	for _, phase := range []string{Walk, Stat, Hash, SQL} {
+		total := totals[phase]
+		fmt.Fprintf(dest, "%-7v %12v %8v\n", phase+":", round(total.duration), total.count)
+	}
+
+	fmt.Fprintf(dest, "%-7v %12v\n", "total:", round(elapsed))
+}
+
+// Discards the recorded durations.
+func Reset() {
+	lock.Lock()
+	defer lock.Unlock()
+
+	totals = make(map[string]phaseTotal)
+}
+
+// unexported
+
+type phaseTotal struct {
+	count    uint
+	duration time.Duration
+}
+
+var lock sync.Mutex
+var totals = make(map[string]phaseTotal)
+
+func round(duration time.Duration) time.Duration {
+	return duration - duration%time.Microsecond
+}
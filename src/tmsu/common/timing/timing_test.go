@@ -0,0 +1,65 @@
+// Copyright 2011-2015 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package timing
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestReport(test *testing.T) {
+	Enabled = true
+	defer func() { Enabled = false }()
+	defer Reset()
+
+	Add(Hash, 2*time.Second)
+	Add(Hash, time.Second)
+	Add(SQL, time.Millisecond)
+
+	var buffer bytes.Buffer
+	Report(&buffer, 5*time.Second)
+
+	lines := strings.Split(strings.TrimSpace(buffer.String()), "\n")
+	if len(lines) != 5 {
+		test.Fatalf("Expected 5 lines but got %v: %v", len(lines), lines)
+	}
+	assertFields(test, lines[0], "walk:", "0s", "0")
+	assertFields(test, lines[2], "hash:", "3s", "2")
+	assertFields(test, lines[3], "sql:", "1ms", "1")
+	assertFields(test, lines[4], "total:", "5s")
+}
+
+func TestDisabled(test *testing.T) {
+	defer Reset()
+
+	Start(Walk)()
+	Add(Stat, time.Second)
+
+	if len(totals) != 0 {
+		test.Fatalf("Expected nothing to be recorded but got %v.", totals)
+	}
+}
+
+// unexported
+
+func assertFields(test *testing.T, line string, expected ...string) {
+	fields := strings.Fields(line)
+	if strings.Join(fields, " ") != strings.Join(expected, " ") {
+		test.Fatalf("Expected '%v' but got '%v'.", strings.Join(expected, " "), line)
+	}
+}
@@ -53,9 +53,16 @@ func (version Version) String() string {
 }
 
 func (this Version) LessThan(that Version) bool {
-	return this.Major < that.Major || this.Minor < that.Minor || this.Patch < that.Patch
+	if this.Major != that.Major {
+		return this.Major < that.Major
+	}
+	if this.Minor != that.Minor {
+		return this.Minor < that.Minor
+	}
+
+	return this.Patch < that.Patch
 }
 
 func (this Version) GreaterThan(that Version) bool {
-	return this.Major > that.Major || this.Minor > that.Minor || this.Patch > that.Patch
+	return that.LessThan(this)
 }
@@ -0,0 +1,76 @@
+// Copyright 2011-2015 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package xattr
+
+import (
+	"syscall"
+)
+
+// Retrieves the value of the named attribute, or nil if the file does not
+// have the attribute.
+func Get(path, name string) ([]byte, error) {
+	size, err := syscall.Getxattr(path, name, nil)
+	if err != nil {
+		return nil, translateError(err)
+	}
+
+	for {
+		value := make([]byte, size)
+
+		size, err = syscall.Getxattr(path, name, value)
+		switch {
+		case err == syscall.ERANGE:
+			// the value grew since its size was read
+			if size, err = syscall.Getxattr(path, name, nil); err != nil {
+				return nil, translateError(err)
+			}
+			continue
+		case err != nil:
+			return nil, translateError(err)
+		}
+
+		return value[:size], nil
+	}
+}
+
+// Sets the value of the named attribute.
+func Set(path, name string, value []byte) error {
+	return translateError(syscall.Setxattr(path, name, value, 0))
+}
+
+// Removes the named attribute. It is not an error if the file does not have
+// the attribute.
+func Remove(path, name string) error {
+	err := syscall.Removexattr(path, name)
+	if err == syscall.ENODATA {
+		return nil
+	}
+
+	return translateError(err)
+}
+
+// unexported
+
+func translateError(err error) error {
+	switch err {
+	case nil, syscall.ENODATA:
+		return nil
+	case syscall.ENOTSUP:
+		return NotSupportedError
+	}
+
+	return err
+}
@@ -0,0 +1,39 @@
+// Copyright 2011-2015 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package entities
+
+// The statistics of a database's storage, for diagnosing problems.
+type DatabaseStatistics struct {
+	Engine        string // the database engine and its version
+	SchemaVersion string
+	PageSize      uint
+	PageCount     uint
+	FreePages     uint
+	Tables        []TableStatistic
+	Indexes       []IndexStatistic
+	Integrity     []string // the problems found by the integrity check
+}
+
+type TableStatistic struct {
+	Name string
+	Rows uint
+}
+
+type IndexStatistic struct {
+	Name  string
+	Table string
+	Stat  string // the engine's statistics for the query planner, if gathered
+}
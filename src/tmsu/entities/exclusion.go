@@ -0,0 +1,44 @@
+// Copyright 2011-2015 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package entities
+
+// Membership of a tag in a named set of mutually exclusive tags: no more than
+// one tag of a set may be applied to a file.
+type Exclusion struct {
+	Set string
+	Tag Tag
+}
+
+type Exclusions []*Exclusion
+
+// Retrieves the tags that are mutually exclusive with the specified tag.
+func (exclusions Exclusions) ExcludedBy(tagId TagId) TagIds {
+	sets := make(map[string]bool)
+	for _, exclusion := range exclusions {
+		if exclusion.Tag.Id == tagId {
+			sets[exclusion.Set] = true
+		}
+	}
+
+	excluded := make(TagIds, 0, 10)
+	for _, exclusion := range exclusions {
+		if sets[exclusion.Set] && exclusion.Tag.Id != tagId {
+			excluded = append(excluded, exclusion.Tag.Id)
+		}
+	}
+
+	return excluded.Uniq()
+}
@@ -16,10 +16,10 @@
 package entities
 
 import (
-	"path/filepath"
 	"sort"
 	"time"
 	"tmsu/common/fingerprint"
+	"tmsu/common/path"
 )
 
 type FileId uint
@@ -68,7 +68,7 @@ type File struct {
 }
 
 func (file File) Path() string {
-	return filepath.Join(file.Directory, file.Name)
+	return path.Join(file.Directory, file.Name)
 }
 
 type Files []*File
@@ -85,6 +85,14 @@ func (files Files) Where(predicate func(*File) bool) Files {
 	return result
 }
 
+// A set of files sharing a tag, value or other attribute.
+type FileGroup struct {
+	Name    string
+	FileIds FileIds
+}
+
+type FileGroups []*FileGroup
+
 type FileTagCount struct {
 	FileId    FileId
 	Directory string
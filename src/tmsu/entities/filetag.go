@@ -15,16 +15,38 @@
 
 package entities
 
+import (
+	"time"
+)
+
 type FileTag struct {
 	FileId   FileId
 	TagId    TagId
 	ValueId  ValueId
 	Explicit bool
 	Implicit bool
+	Username string    // the user that applied the tag
+	Time     time.Time // when the tag was applied (zero if not known)
 }
 
 type FileTags []*FileTag
 
+// A tag and value, zero for none, to apply to a file.
+type TagValuePair struct {
+	TagId   TagId
+	ValueId ValueId
+}
+
+// When a file's tag, with its value, is to be removed.
+type FileTagExpiry struct {
+	FileId  FileId
+	TagId   TagId
+	ValueId ValueId
+	Expires time.Time
+}
+
+type FileTagExpiries []*FileTagExpiry
+
 func (fileTags FileTags) Contains(tagId TagId, valueId ValueId) bool {
 	for _, fileTag := range fileTags {
 		if fileTag.TagId == tagId && fileTag.ValueId == valueId {
@@ -71,3 +93,14 @@ func (fileTags FileTags) Find(fileId FileId, tagId TagId, valueId ValueId) *File
 
 	return nil
 }
+
+// The numbers of rows that refer to files, tags or values that do not exist.
+type OrphanCounts struct {
+	FileTags     uint
+	Implications uint
+	Exclusions   uint
+}
+
+func (counts OrphanCounts) Total() uint {
+	return counts.FileTags + counts.Implications + counts.Exclusions
+}
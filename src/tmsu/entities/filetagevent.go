@@ -0,0 +1,40 @@
+// Copyright 2011-2015 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package entities
+
+import (
+	"path/filepath"
+	"time"
+	"tmsu/common/fingerprint"
+)
+
+// A tag being applied to or removed from a file.
+type FileTagEvent struct {
+	Directory   string
+	Name        string
+	Fingerprint fingerprint.Fingerprint
+	TagName     string
+	ValueName   string
+	Tagged      bool // whether the tag was applied rather than removed
+	Username    string
+	Time        time.Time
+}
+
+func (event FileTagEvent) Path() string {
+	return filepath.Join(event.Directory, event.Name)
+}
+
+type FileTagEvents []*FileTagEvent
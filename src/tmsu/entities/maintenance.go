@@ -0,0 +1,39 @@
+// Copyright 2011-2015 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package entities
+
+import (
+	"time"
+)
+
+// The last run of a scheduled maintenance job.
+type MaintenanceJob struct {
+	Name    string
+	LastRun time.Time
+	Result  string
+}
+
+type MaintenanceJobs []*MaintenanceJob
+
+func (jobs MaintenanceJobs) Find(name string) *MaintenanceJob {
+	for _, job := range jobs {
+		if job.Name == name {
+			return job
+		}
+	}
+
+	return nil
+}
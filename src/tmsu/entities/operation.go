@@ -0,0 +1,59 @@
+// Copyright 2011-2015 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package entities
+
+import (
+	"time"
+)
+
+type OperationId uint
+
+// A recorded mutating operation, such as a single invocation of a command.
+type Operation struct {
+	Id          OperationId
+	Description string
+	Time        time.Time
+}
+
+type Operations []*Operation
+
+// The actions that can be recorded in the journal.
+const (
+	JournalAddFile           = "add_file"
+	JournalUpdateFile        = "update_file"
+	JournalDeleteFile        = "delete_file"
+	JournalAddTag            = "add_tag"
+	JournalRenameTag         = "rename_tag"
+	JournalDeleteTag         = "delete_tag"
+	JournalAddValue          = "add_value"
+	JournalDeleteValue       = "delete_value"
+	JournalAddFileTag        = "add_file_tag"
+	JournalDeleteFileTag     = "delete_file_tag"
+	JournalAddImplication    = "add_implication"
+	JournalDeleteImplication = "delete_implication"
+)
+
+// A change recorded in the journal along with the prior state necessary to
+// revert it.
+type JournalEntry struct {
+	Action       string
+	FileId       FileId
+	TagId        TagId
+	ValueId      ValueId
+	ImpliedTagId TagId
+	Name         string // tag or value name, file name or file-tag username
+	File         File   // prior file state; ModTime holds a file-tag's time
+}
@@ -15,6 +15,11 @@
 
 package entities
 
+import (
+	"strconv"
+	"time"
+)
+
 type Setting struct {
 	Name  string
 	Value string
@@ -38,6 +43,99 @@ func (settings Settings) DirectoryFingerprintAlgorithm() string {
 	return settings.Value("directoyFingerprintAlgorithm")
 }
 
+func (settings Settings) ReadOnly() bool {
+	return settings.BoolValue("readOnly")
+}
+
+func (settings Settings) TextDatabase() bool {
+	return settings.BoolValue("textDatabase")
+}
+
+func (settings Settings) InheritDupeTags() bool {
+	return settings.BoolValue("inheritDupeTags")
+}
+
+func (settings Settings) Colour() string {
+	return settings.Value("color")
+}
+
+func (settings Settings) AllowSpacesInNames() bool {
+	return settings.BoolValue("allowSpacesInNames")
+}
+
+func (settings Settings) ReservedNameChars() string {
+	return settings.Value("reservedNameChars")
+}
+
+func (settings Settings) ContentIndexer() string {
+	return settings.Value("contentIndexer")
+}
+
+func (settings Settings) AudioFingerprinter() string {
+	return settings.Value("audioFingerprinter")
+}
+
+// The time for which the virtual filesystem caches file attributes, or zero if
+// the setting is not a valid duration.
+func (settings Settings) VfsCacheTimeout() time.Duration {
+	timeout, err := time.ParseDuration(settings.Value("vfsCacheTimeout"))
+	if err != nil || timeout < 0 {
+		return 0
+	}
+
+	return timeout
+}
+
+func (settings Settings) Collation() string {
+	return settings.Value("collation")
+}
+
+func (settings Settings) NumericSort() bool {
+	return settings.BoolValue("numericSort")
+}
+
+func (settings Settings) AuditLog() bool {
+	return settings.BoolValue("auditLog")
+}
+
+func (settings Settings) ExpiredTags() string {
+	return settings.Value("expiredTags")
+}
+
+func (settings Settings) VerifySchedule() string {
+	return settings.Value("verifySchedule")
+}
+
+// The number of files verified by each run of the scheduled verify job, or
+// zero if the setting is not a valid count.
+func (settings Settings) VerifyFiles() uint {
+	count, err := strconv.ParseUint(settings.Value("verifyFiles"), 10, 32)
+	if err != nil {
+		return 0
+	}
+
+	return uint(count)
+}
+
+func (settings Settings) VacuumSchedule() string {
+	return settings.Value("vacuumSchedule")
+}
+
+func (settings Settings) PruneSchedule() string {
+	return settings.Value("pruneSchedule")
+}
+
+// The number of files above which destructive operations must be confirmed,
+// or zero if they need not be or the setting is not a valid count.
+func (settings Settings) ConfirmFileCount() uint {
+	count, err := strconv.ParseUint(settings.Value("confirmFileCount"), 10, 32)
+	if err != nil {
+		return 0
+	}
+
+	return uint(count)
+}
+
 func (settings Settings) ContainsName(name string) bool {
 	for _, setting := range settings {
 		if setting.Name == name {
@@ -64,7 +162,7 @@ func (settings Settings) BoolValue(name string) bool {
 			switch setting.Value {
 			case "yes", "Yes", "YES", "true", "True", "TRUE":
 				return true
-			case "no", "No", "false", "False", "FALSE":
+			case "no", "No", "NO", "false", "False", "FALSE":
 				return false
 			default:
 				panic("invalid boolean value")
@@ -74,3 +172,33 @@ func (settings Settings) BoolValue(name string) bool {
 
 	return false
 }
+
+// Whether the text is a valid boolean setting value.
+func IsBoolValue(value string) bool {
+	switch value {
+	case "yes", "Yes", "YES", "true", "True", "TRUE", "no", "No", "NO", "false", "False", "FALSE":
+		return true
+	}
+
+	return false
+}
+
+// Whether the text is a valid colour setting value.
+func IsColourValue(value string) bool {
+	switch value {
+	case "auto", "always", "never":
+		return true
+	}
+
+	return false
+}
+
+// Whether the text is a valid maintenance schedule setting value.
+func IsScheduleValue(value string) bool {
+	switch value {
+	case "never", "daily", "weekly", "monthly":
+		return true
+	}
+
+	return false
+}
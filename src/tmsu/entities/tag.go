@@ -17,6 +17,7 @@ package entities
 
 import (
 	"sort"
+	"tmsu/common/text"
 )
 
 type TagId uint
@@ -70,7 +71,7 @@ func (tags Tags) Swap(i, j int) {
 }
 
 func (tags Tags) Less(i, j int) bool {
-	return tags[i].Name < tags[j].Name
+	return text.Less(tags[i].Name, tags[j].Name)
 }
 
 func (tags Tags) Contains(searchTag *Tag) bool {
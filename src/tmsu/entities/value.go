@@ -17,6 +17,7 @@ package entities
 
 import (
 	"sort"
+	"tmsu/common/text"
 )
 
 type ValueId uint
@@ -61,6 +62,12 @@ type Value struct {
 
 type Values []*Value
 
+type ValueFileCount struct {
+	Id        ValueId
+	Name      string
+	FileCount uint
+}
+
 func (values Values) Len() int {
 	return len(values)
 }
@@ -70,7 +77,7 @@ func (values Values) Swap(i, j int) {
 }
 
 func (values Values) Less(i, j int) bool {
-	return values[i].Name < values[j].Name
+	return text.Less(values[i].Name, values[j].Name)
 }
 
 func (values Values) Contains(searchValue *Value) bool {
@@ -0,0 +1,75 @@
+// Copyright 2011-2015 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package query
+
+import (
+	"strconv"
+	"time"
+)
+
+// The layouts of the dates, with optional times, recognised in values.
+var dateLayouts = []string{"2006-01-02", "2006-01-02T15:04", "2006-01-02 15:04", "2006-01-02T15:04:05", "2006-01-02 15:04:05", time.RFC3339}
+
+// The layout to which relative dates are resolved.
+const DateLayout = "2006-01-02 15:04:05"
+
+// Parses a value as a date: either an ISO 8601 date, optionally with a time,
+// or a date relative to now such as '-30d'. Relative dates are a signed count
+// of hours (h), days (d), weeks (w), months (m) or years (y).
+func ParseDate(text string, now time.Time) (date time.Time, relative bool, ok bool) {
+	if date, ok := parseRelativeDate(text, now); ok {
+		return date, true, true
+	}
+
+	for _, layout := range dateLayouts {
+		if date, err := time.ParseInLocation(layout, text, time.Local); err == nil {
+			return date, false, true
+		}
+	}
+
+	return time.Time{}, false, false
+}
+
+// unexported
+
+func parseRelativeDate(text string, now time.Time) (time.Time, bool) {
+	if len(text) < 3 || (text[0] != '-' && text[0] != '+') {
+		return time.Time{}, false
+	}
+
+	count, err := strconv.Atoi(text[1 : len(text)-1])
+	if err != nil || count < 0 {
+		return time.Time{}, false
+	}
+	if text[0] == '-' {
+		count = -count
+	}
+
+	switch text[len(text)-1] {
+	case 'h':
+		return now.Add(time.Duration(count) * time.Hour), true
+	case 'd':
+		return now.AddDate(0, 0, count), true
+	case 'w':
+		return now.AddDate(0, 0, count*7), true
+	case 'm':
+		return now.AddDate(0, count, 0), true
+	case 'y':
+		return now.AddDate(count, 0, 0), true
+	}
+
+	return time.Time{}, false
+}
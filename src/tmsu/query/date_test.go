@@ -0,0 +1,54 @@
+// Copyright 2011-2015 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package query
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseDate(test *testing.T) {
+	now := time.Date(2020, 3, 31, 12, 0, 0, 0, time.Local)
+
+	validateDate("2020-01-02", now, time.Date(2020, 1, 2, 0, 0, 0, 0, time.Local), false, test)
+	validateDate("2020-01-02T03:04", now, time.Date(2020, 1, 2, 3, 4, 0, 0, time.Local), false, test)
+	validateDate("2020-01-02 03:04:05", now, time.Date(2020, 1, 2, 3, 4, 5, 0, time.Local), false, test)
+	validateDate("-30d", now, time.Date(2020, 3, 1, 12, 0, 0, 0, time.Local), true, test)
+	validateDate("-2w", now, time.Date(2020, 3, 17, 12, 0, 0, 0, time.Local), true, test)
+	validateDate("+1y", now, time.Date(2021, 3, 31, 12, 0, 0, 0, time.Local), true, test)
+	validateDate("-12h", now, time.Date(2020, 3, 31, 0, 0, 0, 0, time.Local), true, test)
+
+	for _, text := range []string{"2020", "2020-13-01", "-30", "-d", "-30x", "30d", "cheese"} {
+		if _, _, ok := ParseDate(text, now); ok {
+			test.Fatalf("expected '%v' not to be a date", text)
+		}
+	}
+}
+
+// unexported
+
+func validateDate(text string, now, expected time.Time, expectedRelative bool, test *testing.T) {
+	date, relative, ok := ParseDate(text, now)
+	if !ok {
+		test.Fatalf("expected '%v' to be a date", text)
+	}
+	if !date.Equal(expected) {
+		test.Fatalf("expected '%v' to be %v but was %v", text, expected, date)
+	}
+	if relative != expectedRelative {
+		test.Fatalf("expected '%v' relative to be %v", text, expectedRelative)
+	}
+}
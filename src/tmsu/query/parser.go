@@ -17,8 +17,20 @@ package query
 
 import (
 	"fmt"
+	"strings"
 )
 
+// The prefix of a query term that searches file notes rather than tags.
+const NotePrefix = "note:"
+
+// The prefix of a query term that searches the text extracted from files by
+// the content indexer.
+const ContentPrefix = "content:"
+
+// The prefix of a query term that is always taken as a tag name, so that tags
+// whose names begin with '-' or another prefix may be queried.
+const TagPrefix = "tag:"
+
 type Parser struct {
 	scanner *Scanner
 }
@@ -65,6 +77,22 @@ type ValueExpression struct {
 	Name string
 }
 
+// Matches files whose note contains the text, using SQLite's full-text query
+// syntax.
+type NoteExpression struct {
+	Text string
+}
+
+// Matches files whose indexed content contains the text, using SQLite's
+// full-text query syntax.
+type ContentExpression struct {
+	Text string
+}
+
+// Matches directories rather than regular files.
+type DirectoryExpression struct {
+}
+
 // unexported
 
 func (parser Parser) expression() (Expression, error) {
@@ -193,6 +221,28 @@ func (parser Parser) not() (Expression, error) {
 			return nil, fmt.Errorf("unexpected token: %v", Type(token2))
 		}
 	case SymbolToken:
+		name := token.(SymbolToken).name
+		switch {
+		case strings.HasPrefix(name, NotePrefix):
+			parser.scanner.Next()
+
+			text := name[len(NotePrefix):]
+			if text == "" {
+				return nil, fmt.Errorf("note text must be specified.")
+			}
+
+			return NoteExpression{text}, nil
+		case strings.HasPrefix(name, ContentPrefix):
+			parser.scanner.Next()
+
+			text := name[len(ContentPrefix):]
+			if text == "" {
+				return nil, fmt.Errorf("content text must be specified.")
+			}
+
+			return ContentExpression{text}, nil
+		}
+
 		operand, err := parser.comparison()
 		if err != nil {
 			return nil, err
@@ -238,7 +288,15 @@ func (parser Parser) tag() (TagExpression, error) {
 
 	switch typedToken := token.(type) {
 	case SymbolToken:
-		return TagExpression{typedToken.name}, nil
+		name := typedToken.name
+		if strings.HasPrefix(name, TagPrefix) {
+			name = name[len(TagPrefix):]
+			if name == "" {
+				return TagExpression{}, fmt.Errorf("tag name must be specified.")
+			}
+		}
+
+		return TagExpression{name}, nil
 	default:
 		return TagExpression{}, fmt.Errorf("unexpected token: %v.", Type(token))
 	}
@@ -129,6 +129,44 @@ func TestNotParsing(test *testing.T) {
 	validateTag(not.Operand, "cheese", test)
 }
 
+func TestBangNotParsing(test *testing.T) {
+	scanner := NewScanner("!cheese")
+	parser := NewParser(scanner)
+
+	expression, err := parser.Parse()
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	dump(expression)
+
+	not := validateNot(expression)
+	validateTag(not.Operand, "cheese", test)
+}
+
+func TestTagPrefixParsing(test *testing.T) {
+	scanner := NewScanner("tag:-funny not tag:note:x=1")
+	parser := NewParser(scanner)
+
+	expression, err := parser.Parse()
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	dump(expression)
+
+	and := validateAnd(expression)
+	validateTag(and.LeftOperand, "-funny", test)
+	not := validateNot(and.RightOperand)
+	comparison := validateComparison(not.Operand, "=", test)
+	validateTag(comparison.Tag, "note:x", test)
+	validateValue(comparison.Value, "1", test)
+
+	if _, err := Parse("tag:"); err == nil {
+		test.Fatal("Expected empty tag name to be rejected.")
+	}
+}
+
 func TestImplicitAndParsing(test *testing.T) {
 	scanner := NewScanner("cheese tomato")
 	parser := NewParser(scanner)
@@ -379,6 +417,36 @@ func TestAndParenOrParsing(test *testing.T) {
 
 // unexported
 
+func TestQuotedNames(test *testing.T) {
+	scanner := NewScanner(`"new york" and not 'and' and city\ name == "big apple"`)
+	parser := NewParser(scanner)
+
+	expression, err := parser.Parse()
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	dump(expression)
+
+	and := validateAnd(expression)
+	comparison := validateComparison(and.RightOperand, "==", test)
+	validateTag(comparison.Tag, "city name", test)
+	validateValue(comparison.Value, "big apple", test)
+	and = validateAnd(and.LeftOperand)
+	validateTag(and.LeftOperand, "new york", test)
+	not := validateNot(and.RightOperand)
+	validateTag(not.Operand, "and", test)
+}
+
+func TestUnterminatedQuote(test *testing.T) {
+	scanner := NewScanner(`"new york`)
+	parser := NewParser(scanner)
+
+	if _, err := parser.Parse(); err == nil {
+		test.Fatal("expected error for unterminated quotation")
+	}
+}
+
 func validateNot(expression Expression) NotExpression {
 	return expression.(NotExpression)
 }
@@ -445,3 +513,22 @@ func dumpBranch(expression Expression) {
 		fmt.Printf(")")
 	}
 }
+
+func TestTree(test *testing.T) {
+	expression, err := Parse("a and not (b or c >= 2)")
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	expected := `and
+  tag 'a'
+  not
+    or
+      tag 'b'
+      tag 'c' >= value '2'
+`
+
+	if actual := Tree(expression); actual != expected {
+		test.Fatalf("Expected tree:\n%vbut got:\n%v", expected, actual)
+	}
+}
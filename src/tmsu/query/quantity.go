@@ -0,0 +1,101 @@
+// Copyright 2011-2015 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package query
+
+import (
+	"strconv"
+	"strings"
+	"time"
+)
+
+type QuantityKind string
+
+const (
+	SizeQuantity     QuantityKind = "size"     // a number of bytes, e.g. '1.2GB' or '700MiB'
+	DurationQuantity QuantityKind = "duration" // a number of seconds, e.g. '3m20s' or '1h30m'
+)
+
+var sizeUnits = map[string]float64{
+	"b":   1,
+	"kb":  1e3,
+	"mb":  1e6,
+	"gb":  1e9,
+	"tb":  1e12,
+	"pb":  1e15,
+	"kib": 1 << 10,
+	"mib": 1 << 20,
+	"gib": 1 << 30,
+	"tib": 1 << 40,
+	"pib": 1 << 50,
+}
+
+// Parses a value with a unit, normalising it to bytes for a size or seconds
+// for a duration. Sizes use decimal (KB, MB, GB, ...) or binary (KiB, MiB,
+// GiB, ...) units, which are not case-sensitive, and durations use hours (h),
+// minutes (m), seconds (s) and milliseconds (ms) in any combination.
+func ParseQuantity(text string) (quantity float64, kind QuantityKind, ok bool) {
+	if text == "" || text[0] == '-' || text[0] == '+' {
+		return 0, "", false
+	}
+
+	if size, ok := parseSize(text); ok {
+		return size, SizeQuantity, true
+	}
+
+	if duration, err := time.ParseDuration(text); err == nil {
+		return duration.Seconds(), DurationQuantity, true
+	}
+
+	return 0, "", false
+}
+
+// Parses a value as a quantity of the specified kind. Values that are plain
+// numbers are taken to be in bytes or seconds.
+func ParseQuantityOf(text string, kind QuantityKind) (float64, bool) {
+	if number, err := strconv.ParseFloat(text, 64); err == nil {
+		return number, true
+	}
+
+	quantity, quantityKind, ok := ParseQuantity(text)
+	if !ok || quantityKind != kind {
+		return 0, false
+	}
+
+	return quantity, true
+}
+
+// unexported
+
+func parseSize(text string) (float64, bool) {
+	index := strings.IndexFunc(text, func(r rune) bool {
+		return (r < '0' || r > '9') && r != '.'
+	})
+	if index < 1 {
+		return 0, false
+	}
+
+	multiplier, ok := sizeUnits[strings.ToLower(text[index:])]
+	if !ok {
+		return 0, false
+	}
+
+	number, err := strconv.ParseFloat(text[:index], 64)
+	if err != nil {
+		return 0, false
+	}
+
+	return number * multiplier, true
+}
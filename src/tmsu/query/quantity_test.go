@@ -0,0 +1,55 @@
+// Copyright 2011-2015 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package query
+
+import (
+	"testing"
+)
+
+func TestParseQuantity(test *testing.T) {
+	validateQuantity("1.2GB", 1.2e9, SizeQuantity, test)
+	validateQuantity("700mb", 700e6, SizeQuantity, test)
+	validateQuantity("2KiB", 2048, SizeQuantity, test)
+	validateQuantity("3m20s", 200, DurationQuantity, test)
+	validateQuantity("1h30m", 5400, DurationQuantity, test)
+
+	for _, text := range []string{"", "GB", "1.2XB", "-3m", "2015", "cheese"} {
+		if _, _, ok := ParseQuantity(text); ok {
+			test.Fatalf("expected '%v' not to be a quantity", text)
+		}
+	}
+}
+
+func TestParseQuantityOf(test *testing.T) {
+	if quantity, ok := ParseQuantityOf("512", SizeQuantity); !ok || quantity != 512 {
+		test.Fatalf("expected plain number to be 512 bytes")
+	}
+	if _, ok := ParseQuantityOf("3m20s", SizeQuantity); ok {
+		test.Fatalf("expected duration not to be a size")
+	}
+}
+
+// unexported
+
+func validateQuantity(text string, expected float64, expectedKind QuantityKind, test *testing.T) {
+	quantity, kind, ok := ParseQuantity(text)
+	if !ok {
+		test.Fatalf("expected '%v' to be a quantity", text)
+	}
+	if quantity != expected || kind != expectedKind {
+		test.Fatalf("expected '%v' to be %v %v but was %v %v", text, expected, expectedKind, quantity, kind)
+	}
+}
@@ -15,6 +15,8 @@
 
 package query
 
+import "strings"
+
 func Parse(query string) (Expression, error) {
 	scanner := NewScanner(query)
 	parser := NewParser(scanner)
@@ -37,6 +39,40 @@ func HasAll(tagNames []string) Expression {
 	return expression
 }
 
+// Combines the terms of an expression with 'or' rather than 'and', so that
+// files matching any of them are matched. Negated terms remain exclusions and
+// so are still combined with 'and'.
+func AnyOf(expression Expression) Expression {
+	var matches, exclusions Expression
+
+	for _, term := range andTerms(expression, nil) {
+		if _, isNot := term.(NotExpression); isNot {
+			if exclusions == nil {
+				exclusions = term
+			} else {
+				exclusions = AndExpression{exclusions, term}
+			}
+		} else {
+			if matches == nil {
+				matches = term
+			} else {
+				matches = OrExpression{matches, term}
+			}
+		}
+	}
+
+	switch {
+	case matches == nil && exclusions == nil:
+		return EmptyExpression{}
+	case matches == nil:
+		return exclusions
+	case exclusions == nil:
+		return matches
+	default:
+		return AndExpression{matches, exclusions}
+	}
+}
+
 // Retrieves the set of tag names from an expression
 func TagNames(expression Expression) []string {
 	names := make([]string, 0, 10)
@@ -53,11 +89,76 @@ func ValueNames(expression Expression) []string {
 	return names
 }
 
+// Determines whether a value name is a pattern, containing the wildcards '*'
+// or '?' or a '[...]' character class, rather than a literal value.
+func IsValuePattern(name string) bool {
+	return strings.ContainsAny(name, "*?[")
+}
+
+// Renders an expression as an indented tree with one node per line
+func Tree(expression Expression) string {
+	return tree(expression, "")
+}
+
+// Restricts an expression to match only directories or, if directories is
+// false, only regular files.
+func OfType(expression Expression, directories bool) Expression {
+	var restriction Expression = DirectoryExpression{}
+	if !directories {
+		restriction = NotExpression{restriction}
+	}
+
+	if _, isEmpty := expression.(EmptyExpression); isEmpty {
+		return restriction
+	}
+
+	return AndExpression{expression, restriction}
+}
+
 // unexported
 
-func tagNames(expression Expression, names []string) []string {
+func tree(expression Expression, indent string) string {
+	childIndent := indent + "  "
+
 	switch exp := expression.(type) {
 	case EmptyExpression:
+		return indent + "all\n"
+	case TagExpression:
+		return indent + "tag '" + exp.Name + "'\n"
+	case ComparisonExpression:
+		return indent + "tag '" + exp.Tag.Name + "' " + exp.Operator + " value '" + exp.Value.Name + "'\n"
+	case NoteExpression:
+		return indent + "note matching '" + exp.Text + "'\n"
+	case ContentExpression:
+		return indent + "content matching '" + exp.Text + "'\n"
+	case DirectoryExpression:
+		return indent + "directory\n"
+	case NotExpression:
+		return indent + "not\n" + tree(exp.Operand, childIndent)
+	case AndExpression:
+		return indent + "and\n" + tree(exp.LeftOperand, childIndent) + tree(exp.RightOperand, childIndent)
+	case OrExpression:
+		return indent + "or\n" + tree(exp.LeftOperand, childIndent) + tree(exp.RightOperand, childIndent)
+	default:
+		panic("unsupported expression type")
+	}
+}
+
+func andTerms(expression Expression, terms []Expression) []Expression {
+	switch exp := expression.(type) {
+	case EmptyExpression:
+		return terms
+	case AndExpression:
+		terms = andTerms(exp.LeftOperand, terms)
+		return andTerms(exp.RightOperand, terms)
+	default:
+		return append(terms, expression)
+	}
+}
+
+func tagNames(expression Expression, names []string) []string {
+	switch exp := expression.(type) {
+	case EmptyExpression, NoteExpression, ContentExpression, DirectoryExpression:
 		// nowt
 	case TagExpression:
 		names = append(names, exp.Name)
@@ -80,7 +181,7 @@ func tagNames(expression Expression, names []string) []string {
 
 func valueNames(expression Expression, names []string) []string {
 	switch exp := expression.(type) {
-	case EmptyExpression:
+	case EmptyExpression, NoteExpression, ContentExpression, DirectoryExpression:
 		// nowt
 	case TagExpression:
 		// nowt
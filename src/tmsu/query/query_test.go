@@ -0,0 +1,63 @@
+// Copyright 2011-2015 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package query
+
+import (
+	"testing"
+)
+
+func TestAnyOf(test *testing.T) {
+	expression, err := Parse("jazz blues year < 1950 not live")
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	expected := `and
+  or
+    or
+      tag 'jazz'
+      tag 'blues'
+    tag 'year' < value '1950'
+  not
+    tag 'live'
+`
+	if actual := Tree(AnyOf(expression)); actual != expected {
+		test.Fatalf("Expected\n%v\nbut was\n%v", expected, actual)
+	}
+}
+
+func TestOfType(test *testing.T) {
+	expression, err := Parse("jazz or blues")
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	expected := `and
+  or
+    tag 'jazz'
+    tag 'blues'
+  not
+    directory
+`
+	if actual := Tree(OfType(expression, false)); actual != expected {
+		test.Fatalf("Expected\n%v\nbut was\n%v", expected, actual)
+	}
+
+	expected = "directory\n"
+	if actual := Tree(OfType(EmptyExpression{}, true)); actual != expected {
+		test.Fatalf("Expected\n%v\nbut was\n%v", expected, actual)
+	}
+}
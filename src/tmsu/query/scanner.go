@@ -137,7 +137,8 @@ func (scanner *Scanner) readToken() (Token, error) {
 	case r == rune('!'), r == rune('='), r == rune('<'), r == rune('>'):
 		return scanner.readComparisonOperatorToken(r)
 	case unicode.IsOneOf(symbolChars, r):
-		return scanner.readTextToken(r)
+		scanner.stream.UnreadRune()
+		return scanner.readTextToken()
 	default:
 		return nil, fmt.Errorf("Unepxected character '%v'.", r)
 	}
@@ -145,12 +146,17 @@ func (scanner *Scanner) readToken() (Token, error) {
 	panic("unreachable")
 }
 
-func (scanner *Scanner) readTextToken(r rune) (Token, error) {
-	text, err := scanner.readString(r)
+func (scanner *Scanner) readTextToken() (Token, error) {
+	text, quoted, err := scanner.readString()
 	if err != nil {
 		return nil, err
 	}
 
+	if quoted {
+		// quoted or escaped text is always a tag or value name
+		return SymbolToken{text}, nil
+	}
+
 	switch text {
 	case "not", "NOT":
 		return NotOperatorToken{}, nil
@@ -183,9 +189,13 @@ func (scanner *Scanner) readComparisonOperatorToken(r rune) (Token, error) {
 			return nil, err
 		}
 
-		switch r2 {
-		case rune('='):
+		switch {
+		case r2 == rune('='):
 			return ComparisonOperatorToken{string(r) + "="}, nil
+		case r == rune('!'):
+			// '!' on its own is a synonym for 'not'
+			scanner.stream.UnreadRune()
+			return NotOperatorToken{}, nil
 		default:
 			scanner.stream.UnreadRune()
 			return ComparisonOperatorToken{string(r)}, nil
@@ -195,30 +205,53 @@ func (scanner *Scanner) readComparisonOperatorToken(r rune) (Token, error) {
 	}
 }
 
-func (scanner *Scanner) readString(initialRune rune) (string, error) {
-	text := string(initialRune)
+// Reads a tag or value name. As with tag arguments (see text.Tokenize), a
+// backslash escapes the character that follows it and text between double or
+// single quotes is taken literally, so that names may contain spaces and the
+// characters otherwise used by the query language.
+func (scanner *Scanner) readString() (text string, quoted bool, err error) {
+	var quote rune
 
-	stop := false
-	for !stop {
+	for {
 		r, _, err := scanner.stream.ReadRune()
 
 		if err == io.EOF {
-			return text, nil
+			if quote != 0 {
+				return "", false, fmt.Errorf("Unterminated quotation: missing %c.", quote)
+			}
+
+			return text, quoted, nil
 		}
 		if err != nil {
-			return "", err
+			return "", false, err
 		}
 
 		switch {
+		case r == quote:
+			quote = 0
+		case r == rune('\\'):
+			r, _, err = scanner.stream.ReadRune()
+			if err == io.EOF {
+				return "", false, fmt.Errorf("Unterminated escape sequence: '\\' at end of query.")
+			}
+			if err != nil {
+				return "", false, err
+			}
+
+			text += string(r)
+			quoted = true
+		case quote != 0:
+			text += string(r)
+		case r == rune('"'), r == rune('\''):
+			quote = r
+			quoted = true
 		case unicode.IsSpace(r), r == rune(')'), r == rune('('), r == rune('='), r == rune('!'), r == rune('<'), r == rune('>'):
 			scanner.stream.UnreadRune()
-			return text, nil
+			return text, quoted, nil
 		case unicode.IsOneOf(symbolChars, r):
 			text += string(r)
 		default:
-			return "", fmt.Errorf("Unexpected character '%v'.", r)
+			return "", false, fmt.Errorf("Unexpected character '%v'.", r)
 		}
 	}
-
-	panic("unreachable")
 }
@@ -0,0 +1,68 @@
+// Copyright 2011-2015 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package server
+
+import (
+	"io"
+	"net"
+	"net/rpc"
+	"net/rpc/jsonrpc"
+	"time"
+	"tmsu/api"
+)
+
+// A connection to a server, through which its database can be synchronised
+// with.
+type Client struct {
+	client *rpc.Client
+}
+
+// Connects to the server listening on the Unix socket at the specified path.
+func Dial(socketPath string) (*Client, error) {
+	conn, err := net.Dial("unix", socketPath)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewClient(conn), nil
+}
+
+// Creates a client communicating over an established connection.
+func NewClient(conn io.ReadWriteCloser) *Client {
+	return &Client{jsonrpc.NewClient(conn)}
+}
+
+func (client *Client) DatabaseId() (string, error) {
+	var id string
+	err := client.client.Call("Tmsu.DatabaseId", Empty{}, &id)
+	return id, err
+}
+
+func (client *Client) Changes(since time.Time) (api.ChangeSet, error) {
+	var changeSet api.ChangeSet
+	err := client.client.Call("Tmsu.Changes", ChangesArgs{since}, &changeSet)
+	return changeSet, err
+}
+
+func (client *Client) Apply(changes []api.Change) (api.ApplyResult, error) {
+	var result api.ApplyResult
+	err := client.client.Call("Tmsu.Apply", ApplyArgs{changes}, &result)
+	return result, err
+}
+
+func (client *Client) Close() error {
+	return client.client.Close()
+}
@@ -0,0 +1,85 @@
+// Copyright 2011-2015 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package server
+
+import (
+	"bufio"
+	"net"
+	"strings"
+	"time"
+	"tmsu/api"
+	"tmsu/common/log"
+)
+
+// Serves queries on the Unix socket at the specified path using a minimal
+// protocol intended for desktop search integrations, which may issue
+// hundreds of queries a second.
+//
+// Each request is a single line of query text. The response is the absolute
+// path of each matching file followed by a NUL character, in no particular
+// order, and then a further NUL to mark its end. Should the query fail the
+// response is instead 'error: ' and the message, followed by two NULs: as
+// paths are absolute this cannot be mistaken for a match. Any number of
+// queries may be sent on a connection.
+func ServeQueries(db *api.Database, socketPath string, idleTimeout time.Duration) error {
+	service := &Service{db: db}
+
+	return serveSocket(service, socketPath, idleTimeout, service.serveQueries)
+}
+
+// unexported
+
+const queryErrorPrefix = "error: "
+
+func (service *Service) serveQueries(conn net.Conn) {
+	defer conn.Close()
+
+	scanner := bufio.NewScanner(conn)
+	writer := bufio.NewWriter(conn)
+
+	for scanner.Scan() {
+		queryText := strings.TrimSpace(scanner.Text())
+
+		var paths []string
+		err := service.run("files "+queryText, func() error {
+			files, err := service.db.Query(queryText, api.QueryOptions{})
+			if err != nil {
+				return err
+			}
+
+			paths = make([]string, len(files))
+			for index, file := range files {
+				paths[index] = file.Path()
+			}
+
+			return nil
+		})
+
+		if err != nil {
+			writer.WriteString(queryErrorPrefix + strings.Replace(err.Error(), "\x00", "", -1) + "\x00")
+		} else {
+			for _, path := range paths {
+				writer.WriteString(path + "\x00")
+			}
+		}
+		writer.WriteByte(0)
+
+		if err := writer.Flush(); err != nil {
+			log.Infof(2, "could not write query response: %v", err)
+			return
+		}
+	}
+}
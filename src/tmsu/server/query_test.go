@@ -0,0 +1,124 @@
+// Copyright 2011-2015 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package server
+
+import (
+	"bufio"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+	"tmsu/api"
+)
+
+func TestServeQueries(test *testing.T) {
+	// set-up
+
+	databasePath := filepath.Join(os.TempDir(), "tmsu_server_test.db")
+	defer os.Remove(databasePath)
+
+	db, err := api.Open(databasePath)
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer db.Close()
+
+	if err := os.MkdirAll("/tmp/tmsu", 0777); err != nil {
+		test.Fatal(err)
+	}
+	if err := ioutil.WriteFile("/tmp/tmsu/a", []byte("hello"), 0666); err != nil {
+		test.Fatal(err)
+	}
+	defer os.Remove("/tmp/tmsu/a")
+
+	if err := db.Tag([]string{"/tmp/tmsu/a"}, []api.TagValue{{Tag: "apple"}}, api.TagOptions{}); err != nil {
+		test.Fatal(err)
+	}
+
+	socketPath := filepath.Join(os.TempDir(), "tmsu_server_query_test.sock")
+	done := make(chan error)
+	go func() { done <- ServeQueries(db, socketPath, 500*time.Millisecond) }()
+
+	var conn net.Conn
+	for attempt := 0; attempt < 50; attempt++ {
+		if conn, err = net.Dial("unix", socketPath); err == nil {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	// test
+
+	reader := bufio.NewReader(conn)
+
+	if _, err := conn.Write([]byte("apple\nbanana\n")); err != nil {
+		test.Fatal(err)
+	}
+
+	match, err := readResponse(reader)
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	failure, err := readResponse(reader)
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	conn.Close()
+
+	// validate
+
+	if len(match) != 1 || match[0] != "/tmp/tmsu/a" {
+		test.Fatalf("Expected '/tmp/tmsu/a' to match but matches are %v.", match)
+	}
+
+	if len(failure) != 1 || !strings.HasPrefix(failure[0], "error: ") {
+		test.Fatalf("Expected an error for an unknown tag but was %v.", failure)
+	}
+
+	select {
+	case err := <-done:
+		if err != nil {
+			test.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		test.Fatalf("Expected server to shut down once idle.")
+	}
+}
+
+func readResponse(reader *bufio.Reader) ([]string, error) {
+	records := make([]string, 0)
+	for {
+		record, err := reader.ReadString(0)
+		if err != nil {
+			return nil, err
+		}
+
+		record = record[:len(record)-1]
+		if record == "" {
+			return records, nil
+		}
+
+		records = append(records, record)
+	}
+}
@@ -0,0 +1,346 @@
+// Copyright 2011-2015 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+// Package server exposes the TMSU operations over a Unix socket using JSON-RPC
+// so that long-lived clients need not start a process and open the database
+// for every request.
+//
+// Requests are JSON-RPC 1.0 calls to the methods of the "Tmsu" service, e.g.:
+//
+//	{"method": "Tmsu.Query", "params": [{"Query": "music and mp3"}], "id": 1}
+//
+// Paths must be absolute as the server's working directory is unrelated to
+// that of the client.
+//
+// The "DatabaseId", "Changes" and "Apply" methods allow the database to be
+// synchronised with another: see Client.
+//
+// ServeQueries instead offers a minimal, query-only protocol for clients, such
+// as desktop search integrations, for which latency matters most.
+package server
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"net/rpc"
+	"net/rpc/jsonrpc"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+	"tmsu/api"
+	"tmsu/common/log"
+)
+
+type TagArgs struct {
+	Paths     []string // absolute paths of the files to tag
+	Tags      []string // tags to apply, as 'tag' or 'tag=value'
+	Recursive bool     // also tag the contents of directories
+	Explicit  bool     // apply tags even if they are already implied
+	Force     bool     // tag paths that do not exist
+}
+
+type UntagArgs struct {
+	Paths     []string // absolute paths of the files to untag
+	Tags      []string // tags to remove, as 'tag' or 'tag=value'
+	Recursive bool     // also untag the contents of directories
+}
+
+type QueryArgs struct {
+	Query    string // query text
+	Path     string // only match files under this absolute path
+	Explicit bool   // only match explicitly applied tags
+	Sort     string // id, none, name, size or time
+}
+
+type FileTagsArgs struct {
+	Path     string // absolute path of the file
+	Explicit bool   // only list explicitly applied tags
+}
+
+type ChangesArgs struct {
+	Since time.Time // only changes made after this time
+}
+
+type ApplyArgs struct {
+	Changes []api.Change
+}
+
+type Empty struct{}
+
+// The RPC service.
+type Service struct {
+	db    *api.Database
+	mutex sync.Mutex
+	touch func()
+}
+
+// Applies tags to files.
+func (service *Service) Tag(args TagArgs, reply *Empty) error {
+	if err := checkPaths(args.Paths); err != nil {
+		return err
+	}
+
+	return service.run(fmt.Sprintf("tag %v %v", strings.Join(args.Paths, " "), strings.Join(args.Tags, " ")), func() error {
+		options := api.TagOptions{Explicit: args.Explicit, Recursive: args.Recursive, Force: args.Force}
+		return service.db.Tag(args.Paths, parseTagValues(args.Tags), options)
+	})
+}
+
+// Removes tags from files.
+func (service *Service) Untag(args UntagArgs, reply *Empty) error {
+	if err := checkPaths(args.Paths); err != nil {
+		return err
+	}
+
+	return service.run(fmt.Sprintf("untag %v %v", strings.Join(args.Paths, " "), strings.Join(args.Tags, " ")), func() error {
+		return service.db.Untag(args.Paths, parseTagValues(args.Tags), args.Recursive)
+	})
+}
+
+// Lists the paths of the files matching a query.
+func (service *Service) Query(args QueryArgs, reply *[]string) error {
+	if args.Path != "" {
+		if err := checkPaths([]string{args.Path}); err != nil {
+			return err
+		}
+	}
+
+	return service.run("files "+args.Query, func() error {
+		files, err := service.db.Query(args.Query, api.QueryOptions{Path: args.Path, ExplicitOnly: args.Explicit, Sort: args.Sort})
+		if err != nil {
+			return err
+		}
+
+		paths := make([]string, len(files))
+		for index, file := range files {
+			paths[index] = file.Path()
+		}
+
+		*reply = paths
+		return nil
+	})
+}
+
+// Lists the tags applied to a file.
+func (service *Service) FileTags(args FileTagsArgs, reply *[]string) error {
+	if err := checkPaths([]string{args.Path}); err != nil {
+		return err
+	}
+
+	return service.run("tags "+args.Path, func() error {
+		tagValues, err := service.db.FileTags(args.Path, args.Explicit)
+		if err != nil {
+			return err
+		}
+
+		names := make([]string, len(tagValues))
+		for index, tagValue := range tagValues {
+			names[index] = tagValue.String()
+		}
+
+		*reply = names
+		return nil
+	})
+}
+
+// Lists the names of all tags.
+func (service *Service) Tags(args Empty, reply *[]string) error {
+	return service.run("tags", func() error {
+		names, err := service.db.Tags()
+		if err != nil {
+			return err
+		}
+
+		*reply = names
+		return nil
+	})
+}
+
+// Identifies the database, for synchronisation.
+func (service *Service) DatabaseId(args Empty, reply *string) error {
+	return service.run("sync", func() error {
+		var err error
+		*reply, err = service.db.DatabaseId()
+		return err
+	})
+}
+
+// Retrieves the tagging changes made since a point in time, for
+// synchronisation.
+func (service *Service) Changes(args ChangesArgs, reply *api.ChangeSet) error {
+	return service.run("sync", func() error {
+		var err error
+		*reply, err = service.db.Changes(args.Since)
+		return err
+	})
+}
+
+// Applies tagging changes made to another database, for synchronisation.
+func (service *Service) Apply(args ApplyArgs, reply *api.ApplyResult) error {
+	return service.run("sync", func() error {
+		var err error
+		*reply, err = service.db.Apply(args.Changes)
+		return err
+	})
+}
+
+// Serves requests on the Unix socket at the specified path until the listener
+// fails or, if idleTimeout is non-zero, no request is received for that long.
+func Serve(db *api.Database, socketPath string, idleTimeout time.Duration) error {
+	service := &Service{db: db}
+	server := rpc.NewServer()
+	if err := server.RegisterName("Tmsu", service); err != nil {
+		return err
+	}
+
+	return serveSocket(service, socketPath, idleTimeout, func(conn net.Conn) {
+		server.ServeCodec(jsonrpc.NewServerCodec(conn))
+	})
+}
+
+// Serves requests on a single connection, such as a pipe to a remote shell,
+// until it is closed.
+func ServeConn(db *api.Database, conn io.ReadWriteCloser) error {
+	server := rpc.NewServer()
+	if err := server.RegisterName("Tmsu", &Service{db: db, touch: func() {}}); err != nil {
+		return err
+	}
+
+	server.ServeCodec(jsonrpc.NewServerCodec(conn))
+
+	return nil
+}
+
+// unexported
+
+// Runs the operation, one at a time, attributing any changes to the command.
+func (service *Service) run(command string, operation func() error) error {
+	service.mutex.Lock()
+	defer service.mutex.Unlock()
+
+	service.touch()
+	service.db.Storage().Command = command
+
+	return operation()
+}
+
+func parseTagValues(texts []string) []api.TagValue {
+	tagValues := make([]api.TagValue, len(texts))
+	for index, text := range texts {
+		tagValues[index] = api.ParseTagValue(text)
+	}
+
+	return tagValues
+}
+
+func checkPaths(paths []string) error {
+	for _, path := range paths {
+		if !filepath.IsAbs(path) {
+			return fmt.Errorf("%v: path must be absolute", path)
+		}
+	}
+
+	return nil
+}
+
+// Accepts connections on the Unix socket at the specified path, handling each
+// in its own goroutine, until the listener fails or, if idleTimeout is
+// non-zero, no request is received for that long.
+func serveSocket(service *Service, socketPath string, idleTimeout time.Duration, handle func(conn net.Conn)) error {
+	if err := removeStaleSocket(socketPath); err != nil {
+		return err
+	}
+
+	listener, err := net.Listen("unix", socketPath)
+	if err != nil {
+		return fmt.Errorf("could not listen on '%v': %v", socketPath, err)
+	}
+	defer os.Remove(socketPath)
+
+	if err := os.Chmod(socketPath, 0600); err != nil {
+		listener.Close()
+		return fmt.Errorf("could not set permissions on '%v': %v", socketPath, err)
+	}
+
+	idle := false
+	var timer *time.Timer
+	service.touch = func() {}
+	if idleTimeout > 0 {
+		var idleMutex sync.Mutex
+		timer = time.AfterFunc(idleTimeout, func() {
+			idleMutex.Lock()
+			idle = true
+			idleMutex.Unlock()
+
+			listener.Close()
+		})
+		service.touch = func() {
+			idleMutex.Lock()
+			defer idleMutex.Unlock()
+
+			if !idle {
+				timer.Reset(idleTimeout)
+			}
+		}
+	}
+
+	log.Infof(1, "listening on '%v'", socketPath)
+
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			// wait for any request in progress
+			service.mutex.Lock()
+			defer service.mutex.Unlock()
+
+			if idle {
+				log.Info(1, "idle timeout expired: shutting down")
+				return nil
+			}
+
+			return fmt.Errorf("could not accept connection: %v", err)
+		}
+
+		service.touch()
+		go handle(conn)
+	}
+}
+
+// Removes a socket left behind by a server that is no longer running.
+func removeStaleSocket(socketPath string) error {
+	stat, err := os.Lstat(socketPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+
+		return fmt.Errorf("could not stat '%v': %v", socketPath, err)
+	}
+
+	if stat.Mode()&os.ModeSocket == 0 {
+		return fmt.Errorf("%v: file exists and is not a socket", socketPath)
+	}
+
+	conn, err := net.Dial("unix", socketPath)
+	if err == nil {
+		conn.Close()
+		return fmt.Errorf("%v: a server is already listening on this socket", socketPath)
+	}
+
+	return os.Remove(socketPath)
+}
@@ -0,0 +1,110 @@
+// Copyright 2011-2015 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package server
+
+import (
+	"io/ioutil"
+	"net/rpc"
+	"net/rpc/jsonrpc"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+	"tmsu/api"
+)
+
+func TestServeTagAndQuery(test *testing.T) {
+	// set-up
+
+	databasePath := filepath.Join(os.TempDir(), "tmsu_server_test.db")
+	defer os.Remove(databasePath)
+
+	db, err := api.Open(databasePath)
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer db.Close()
+
+	if err := os.MkdirAll("/tmp/tmsu", 0777); err != nil {
+		test.Fatal(err)
+	}
+	if err := ioutil.WriteFile("/tmp/tmsu/a", []byte("hello"), 0666); err != nil {
+		test.Fatal(err)
+	}
+	defer os.Remove("/tmp/tmsu/a")
+
+	socketPath := filepath.Join(os.TempDir(), "tmsu_server_test.sock")
+	done := make(chan error)
+	go func() { done <- Serve(db, socketPath, 500*time.Millisecond) }()
+
+	var client *rpc.Client
+	for attempt := 0; attempt < 50; attempt++ {
+		if client, err = jsonrpc.Dial("unix", socketPath); err == nil {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	// test
+
+	if err := client.Call("Tmsu.Tag", TagArgs{Paths: []string{"/tmp/tmsu/a"}, Tags: []string{"apple", "year=2015"}}, &Empty{}); err != nil {
+		test.Fatal(err)
+	}
+
+	var paths []string
+	if err := client.Call("Tmsu.Query", QueryArgs{Query: "apple and year = 2015"}, &paths); err != nil {
+		test.Fatal(err)
+	}
+
+	var tags []string
+	if err := client.Call("Tmsu.FileTags", FileTagsArgs{Path: "/tmp/tmsu/a"}, &tags); err != nil {
+		test.Fatal(err)
+	}
+
+	relativeErr := client.Call("Tmsu.Tag", TagArgs{Paths: []string{"a"}, Tags: []string{"apple"}}, &Empty{})
+
+	client.Close()
+
+	// validate
+
+	if len(paths) != 1 || paths[0] != "/tmp/tmsu/a" {
+		test.Fatalf("Expected '/tmp/tmsu/a' to match but matches are %v.", paths)
+	}
+
+	if len(tags) != 2 || tags[0] != "apple" || tags[1] != "year=2015" {
+		test.Fatalf("Expected tags 'apple' and 'year=2015' but were %v.", tags)
+	}
+
+	if relativeErr == nil {
+		test.Fatalf("Expected an error for a relative path.")
+	}
+
+	select {
+	case err := <-done:
+		if err != nil {
+			test.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		test.Fatalf("Expected server to shut down once idle.")
+	}
+
+	if _, err := os.Stat(socketPath); !os.IsNotExist(err) {
+		test.Fatalf("Expected socket to be removed.")
+	}
+}
@@ -0,0 +1,218 @@
+// Copyright 2011-2015 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package storage
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+	"tmsu/common/log"
+)
+
+const auditLogSettingName = "auditLog"
+
+const auditLogMaxSizeSettingName = "auditLogMaxSize"
+
+// The number of rotated audit logs kept, as audit.log.1 (the most recent)
+// onwards.
+const auditLogBackups = 3
+
+// A mutating operation recorded in the audit log.
+type AuditRecord struct {
+	Time     time.Time `json:"time"`
+	User     string    `json:"user"`
+	Pid      int       `json:"pid"`
+	Command  string    `json:"command"`
+	Args     []string  `json:"args"`
+	Rows     int64     `json:"rows"`     // of files, tags, values, taggings &c.
+	Duration float64   `json:"duration"` // in seconds
+	Error    string    `json:"error,omitempty"`
+}
+
+// The path of the audit log: audit.log within the .tmsu directory holding the
+// database or, for a database elsewhere, alongside it. Databases that are not
+// SQLite files have no audit log.
+func (storage *Storage) AuditLogPath() string {
+	backendName, path := ParseLocation(storage.DbPath)
+	if backendName != DefaultBackend {
+		return ""
+	}
+
+	if filepath.Base(filepath.Dir(path)) == ".tmsu" {
+		return filepath.Join(filepath.Dir(path), "audit.log")
+	}
+
+	return path + ".audit.log"
+}
+
+// The number of rows of user data (files, tags, values, taggings &c.) changed
+// by the transactions committed so far.
+func (storage *Storage) RowsAffected() int64 {
+	return atomic.LoadInt64(storage.rowsAffected)
+}
+
+// Starts recording an operation that modifies the database, returning the
+// function to call with its outcome once it has finished, which appends it to
+// the audit log. Dry runs, which change nothing, are not recorded.
+func (storage *Storage) StartAudit(command string, args []string) func(error) {
+	started := time.Now()
+	rowsBefore := storage.RowsAffected()
+
+	return func(err error) {
+		if storage.DryRun {
+			return
+		}
+
+		record := AuditRecord{
+			Time:     started,
+			Pid:      os.Getpid(),
+			Command:  command,
+			Args:     args,
+			Rows:     storage.RowsAffected() - rowsBefore,
+			Duration: time.Since(started).Seconds(),
+		}
+		if err != nil {
+			record.Error = err.Error()
+		}
+
+		if err := storage.Audit(record); err != nil {
+			log.Warnf("could not record %v in audit log: %v", command, err)
+		}
+	}
+}
+
+// Appends the record, as a line of JSON, to the audit log if the auditLog
+// setting is enabled, first rotating the log if it has reached the size given
+// by the auditLogMaxSize setting.
+func (storage *Storage) Audit(record AuditRecord) error {
+	path := storage.AuditLogPath()
+	if path == "" {
+		return nil
+	}
+
+	tx, err := storage.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	settings, err := storage.Settings(tx)
+	if err != nil {
+		return fmt.Errorf("could not retrieve settings: %v", err)
+	}
+	if !settings.AuditLog() {
+		return nil
+	}
+
+	if record.User == "" {
+		record.User = storage.Username
+	}
+
+	maxSize, _ := parseByteSize(settings.Value(auditLogMaxSizeSettingName))
+	if err := rotateAuditLog(path, maxSize); err != nil {
+		return fmt.Errorf("could not rotate audit log '%v': %v", path, err)
+	}
+
+	line, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+
+	mode := auditLogMode(storage.DbPath)
+
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, mode)
+	if err != nil {
+		return fmt.Errorf("could not open audit log '%v': %v", path, err)
+	}
+
+	// a log created by an earlier version may be more widely readable
+	file.Chmod(mode)
+
+	if _, err := file.Write(append(line, '\n')); err != nil {
+		file.Close()
+		return fmt.Errorf("could not write audit log '%v': %v", path, err)
+	}
+
+	return file.Close()
+}
+
+// unexported
+
+// The permissions of the audit log: those of the database, so that the log
+// is no more readable than the database whose changes it records.
+func auditLogMode(dbPath string) os.FileMode {
+	_, path := ParseLocation(dbPath)
+
+	stat, err := os.Stat(path)
+	if err != nil {
+		return 0600
+	}
+
+	return stat.Mode().Perm()
+}
+
+// Renames the log to path.1, and the earlier backups to path.2 and so on, once
+// it has reached the maximum size. A maximum of zero disables rotation.
+func rotateAuditLog(path string, maxSize int64) error {
+	if maxSize <= 0 {
+		return nil
+	}
+
+	stat, err := os.Stat(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+
+		return err
+	}
+	if stat.Size() < maxSize {
+		return nil
+	}
+
+	for index := auditLogBackups - 1; index > 0; index-- {
+		backupPath := path + "." + strconv.Itoa(index)
+		if err := os.Rename(backupPath, path+"."+strconv.Itoa(index+1)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+
+	return os.Rename(path, path+".1")
+}
+
+var byteSizeUnits = map[string]int64{"": 1, "k": 1 << 10, "m": 1 << 20, "g": 1 << 30}
+
+// Parses a size in bytes with an optional K, M or G suffix, e.g. '10M'.
+func parseByteSize(text string) (int64, error) {
+	number := strings.TrimRight(text, "kKmMgG")
+
+	multiplier, ok := byteSizeUnits[strings.ToLower(text[len(number):])]
+	if !ok {
+		return 0, fmt.Errorf("invalid size '%v'", text)
+	}
+
+	size, err := strconv.ParseInt(number, 10, 64)
+	if err != nil || size < 0 {
+		return 0, fmt.Errorf("invalid size '%v'", text)
+	}
+
+	return size * multiplier, nil
+}
@@ -0,0 +1,294 @@
+// Copyright 2011-2015 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package storage
+
+import (
+	"path/filepath"
+	"strings"
+	"time"
+	"tmsu/common/fingerprint"
+	"tmsu/entities"
+	"tmsu/query"
+)
+
+// The backend used for database locations that do not name one.
+const DefaultBackend = "sqlite"
+
+// A Backend holds the data for a database.
+type Backend interface {
+	Begin() (BackendTx, error)
+	Close() error
+}
+
+// A BackendTx is a transaction against a backend. Paths are relative to the
+// storage root path.
+type BackendTx interface {
+	Commit() error
+	Rollback() error
+
+	// Whether statements that modify the database are rejected with a
+	// ReadOnlyError.
+	ReadOnly() bool
+	SetReadOnly(readOnly bool)
+
+	// Whether the transaction has modified the database.
+	Modified() bool
+
+	// The number of rows of user data (files, tags, values, taggings &c.)
+	// changed by the transaction, excluding bookkeeping such as the journal.
+	RowsAffected() int64
+
+	// files
+	FileCount() (uint, error)
+	Files(sort string) (entities.Files, error)
+	File(id entities.FileId) (*entities.File, error)
+	FileByPath(path string) (*entities.File, error)
+	FilesByPaths(paths []string) (entities.Files, error)
+	FilesByDirectory(path string) (entities.Files, error)
+	FileCountByFingerprint(fingerprint fingerprint.Fingerprint) (uint, error)
+	FilesByFingerprint(fingerprint fingerprint.Fingerprint) (entities.Files, error)
+	UntaggedFiles() (entities.Files, error)
+	QueryFileCount(expression query.Expression, path string) (uint, error)
+	QueryFiles(expression query.Expression, path, sort string, limit uint) (entities.Files, error)
+	DuplicateFiles() ([]entities.Files, error)
+	InsertFile(path string, fingerprint fingerprint.Fingerprint, modTime time.Time, size int64, isDir bool) (*entities.File, error)
+	UpdateFile(fileId entities.FileId, path string, fingerprint fingerprint.Fingerprint, modTime time.Time, size int64, isDir bool) (*entities.File, error)
+	RewriteFilePaths(fromPath, toPath string) (uint, error)
+	DeleteFile(fileId entities.FileId) error
+	DeleteUntaggedFiles(fileIds entities.FileIds) error
+
+	// taggings
+	FileTagExists(fileId entities.FileId, tagId entities.TagId, valueId entities.ValueId) (bool, error)
+	FileTagCount() (uint, error)
+	FileTags() (entities.FileTags, error)
+	FileTag(fileId entities.FileId, tagId entities.TagId, valueId entities.ValueId) (*entities.FileTag, error)
+	FileTagsByAttribution(username string, after time.Time) (entities.FileTags, error)
+	FileTagCountByFileId(fileId entities.FileId) (uint, error)
+	FileTagCountByTagId(tagId entities.TagId) (uint, error)
+	FileTagsByTagId(tagId entities.TagId) (entities.FileTags, error)
+	FileTagCountByValueId(valueId entities.ValueId) (uint, error)
+	FileTagsByValueId(valueId entities.ValueId) (entities.FileTags, error)
+	FileTagsByFileId(fileId entities.FileId) (entities.FileTags, error)
+	AddFileTag(fileId entities.FileId, tagId entities.TagId, valueId entities.ValueId, username string, time time.Time) (*entities.FileTag, error)
+	AddFileTags(fileId entities.FileId, pairs []entities.TagValuePair, username string, time time.Time) error
+	DeleteFileTag(fileId entities.FileId, tagId entities.TagId, valueId entities.ValueId) error
+	DeleteFileTagsByFileId(fileId entities.FileId) error
+	DeleteFileTagsByTagId(tagId entities.TagId) error
+	CopyFileTags(sourceTagId entities.TagId, destTagId entities.TagId, username string, time time.Time) error
+
+	// tag history
+	InsertFileTagEvent(fileId entities.FileId, tagId entities.TagId, valueId entities.ValueId, tagged bool, username string, time time.Time) error
+	FileTagEvents(path string) (entities.FileTagEvents, error)
+	FileTagEventsSince(since time.Time) (entities.FileTagEvents, error)
+
+	// implications
+	Implications() (entities.Implications, error)
+	ImplicationsForTags(tagIds entities.TagIds) (entities.Implications, error)
+	UpdateImplicationsForTagId(implyingTagId, impliedTagId entities.TagId) error
+	AddImplication(tagId, impliedTagId entities.TagId) error
+	DeleteImplication(tagId, impliedTagId entities.TagId) error
+	DeleteImplicationsForTagId(tagId entities.TagId) error
+
+	// exclusions
+	Exclusions() (entities.Exclusions, error)
+	AddExclusion(set string, tagId entities.TagId) error
+	DeleteExclusion(set string, tagId entities.TagId) error
+	DeleteExclusionSet(set string) error
+	DeleteExclusionsForTagId(tagId entities.TagId) error
+
+	// consistency
+	OrphanCounts() (entities.OrphanCounts, error)
+	DeleteOrphans() error
+
+	// undo journal
+	InsertOperation(description string, time time.Time) (*entities.Operation, error)
+	Operations(count uint) (entities.Operations, error)
+	DeleteOperation(operationId entities.OperationId) error
+	PruneOperations(keep uint) error
+	InsertJournalEntry(operationId entities.OperationId, entry entities.JournalEntry) error
+	JournalEntries(operationId entities.OperationId) ([]entities.JournalEntry, error)
+	RestoreFile(file entities.File) error
+	RevertFile(file entities.File) error
+	RestoreTag(tagId entities.TagId, name string) error
+	RestoreValue(valueId entities.ValueId, name string) error
+
+	// saved queries
+	Queries() (entities.Queries, error)
+	Query(text string) (*entities.Query, error)
+	InsertQuery(text string) (*entities.Query, error)
+	DeleteQuery(text string) error
+
+	// rebuilding
+	Clear() error
+
+	// settings
+	Settings() (entities.Settings, error)
+	Setting(name string) (*entities.Setting, error)
+	UpdateSetting(name, value string) (*entities.Setting, error)
+
+	// synchronisation
+	SyncPeer(databaseId string) (*entities.SyncPeer, error)
+	UpdateSyncPeer(peer entities.SyncPeer) error
+
+	// tags
+	TagCount() (uint, error)
+	Tags() (entities.Tags, error)
+	Tag(id entities.TagId) (*entities.Tag, error)
+	TagsByIds(ids entities.TagIds) (entities.Tags, error)
+	TagByName(name string) (*entities.Tag, error)
+	TagsByNames(names []string) (entities.Tags, error)
+	InsertTag(name string) (*entities.Tag, error)
+	RenameTag(tagId entities.TagId, name string) (*entities.Tag, error)
+	DeleteTag(tagId entities.TagId) error
+	TagUsage() ([]entities.TagFileCount, error)
+
+	// values
+	ValueCount() (uint, error)
+	Values() (entities.Values, error)
+	Value(id entities.ValueId) (*entities.Value, error)
+	ValuesByIds(ids entities.ValueIds) (entities.Values, error)
+	UnusedValues() (entities.Values, error)
+	ValueByName(name string) (*entities.Value, error)
+	ValuesByNames(names []string) (entities.Values, error)
+	ValuesByTagId(tagId entities.TagId) (entities.Values, error)
+	ValueUsageByTagId(tagId entities.TagId) ([]entities.ValueFileCount, error)
+	InsertValue(name string) (*entities.Value, error)
+	DeleteValue(valueId entities.ValueId) error
+	DeleteUnusedValues(valueIds entities.ValueIds) error
+
+	// volumes
+	FileVolume(fileId entities.FileId) (string, error)
+	FileVolumes() (map[entities.FileId]string, error)
+	UpdateFileVolume(fileId entities.FileId, volume string) error
+
+	// file tag expiries
+	FileTagExpiriesByFileId(fileId entities.FileId) (entities.FileTagExpiries, error)
+	ExpiredFileTags(now time.Time) (entities.FileTagExpiries, error)
+	UpdateFileTagExpiry(fileId entities.FileId, tagId entities.TagId, valueId entities.ValueId, expires time.Time) error
+	DeleteFileTagExpiry(fileId entities.FileId, tagId entities.TagId, valueId entities.ValueId) error
+
+	// file identities
+	FileIdentity(fileId entities.FileId) (device, inode uint64, ok bool, err error)
+	UpdateFileIdentity(fileId entities.FileId, device, inode uint64) error
+	DeleteFileIdentity(fileId entities.FileId) error
+
+	// path-only files
+	FilePathOnly(fileId entities.FileId) (bool, error)
+	PathOnlyFiles() (map[entities.FileId]bool, error)
+	UpdateFilePathOnly(fileId entities.FileId, pathOnly bool) error
+
+	// virtual files
+	FileVirtual(fileId entities.FileId) (bool, error)
+	VirtualFiles() (map[entities.FileId]bool, error)
+	UpdateFileVirtual(fileId entities.FileId, virtual bool) error
+
+	// checkpoints
+	Checkpoint(name string) (string, error)
+	UpdateCheckpoint(name, position string) error
+	DeleteCheckpoint(name string) error
+
+	// maintenance jobs
+	MaintenanceJobs() (entities.MaintenanceJobs, error)
+	UpdateMaintenanceJob(name string, lastRun time.Time, result string) error
+
+	// pending tags
+	PendingTags() (entities.PendingTags, error)
+	PendingTagCount() (uint, error)
+	InsertPendingTag(path, tag, value string, queued time.Time) error
+	DeletePendingTags(path string) error
+
+	// fingerprints by algorithm
+	FileFingerprint(fileId entities.FileId, algorithm string) (fingerprint.Fingerprint, error)
+	FileFingerprints() (map[entities.FileId]map[string]fingerprint.Fingerprint, error)
+	UpdateFileFingerprint(fileId entities.FileId, algorithm string, fp fingerprint.Fingerprint) error
+	PreserveFileFingerprints(algorithm string) error
+	DeleteFileFingerprints(fileId entities.FileId) error
+
+	// fingerprint cache
+	CachedFingerprint(device, inode uint64, algorithm string, size int64, modTime time.Time) (fingerprint.Fingerprint, error)
+	UpdateCachedFingerprint(device, inode uint64, algorithm string, size int64, modTime time.Time, fp fingerprint.Fingerprint) error
+	ClearFingerprintCache() error
+
+	// notes
+	FileNote(fileId entities.FileId) (string, error)
+	FileNotes() (map[entities.FileId]string, error)
+	UpdateFileNote(fileId entities.FileId, text string) error
+	UpdateFileContent(fileId entities.FileId, text string) error
+
+	QueryFilesWithPaths(expression query.Expression, path string, paths []string, operation, sort string, limit uint) (entities.Files, error)
+
+	// file groups
+	FileGroupsByTag(fileIds entities.FileIds) (entities.FileGroups, error)
+	FileGroupsByValue(fileIds entities.FileIds, tagName string) (entities.FileGroups, error)
+}
+
+// A QueryExplainer is a BackendTx that can describe how queries are run.
+type QueryExplainer interface {
+	QueryFilesSql(expression query.Expression, path, sort string) (string, []interface{})
+	QueryPlan(sql string, params ...interface{}) ([]string, error)
+}
+
+// A Vacuumer is a Backend that can reclaim the space left by deleted rows.
+type Vacuumer interface {
+	Vacuum() error
+}
+
+// Opens the backend at the specified location.
+type BackendOpener func(location string) (Backend, error)
+
+// Registers a backend so that it can be selected by prefixing a database
+// location with its name, e.g. 'postgres:dbname=tmsu host=server'.
+func RegisterBackend(name string, open BackendOpener) {
+	backends[name] = open
+}
+
+// Splits a database location into the name of the backend and the location
+// within it.
+func ParseLocation(location string) (backendName, path string) {
+	index := strings.Index(location, ":")
+	if index > 1 {
+		if _, ok := backends[location[:index]]; ok {
+			return location[:index], location[index+1:]
+		}
+	}
+
+	return DefaultBackend, location
+}
+
+// unexported
+
+var backends = map[string]BackendOpener{DefaultBackend: openSqliteBackend}
+
+func openBackend(location string) (Backend, string, error) {
+	backendName, path := ParseLocation(location)
+
+	backend, err := backends[backendName](path)
+	if err != nil {
+		return nil, "", err
+	}
+
+	if backendName != DefaultBackend {
+		return backend, string(filepath.Separator), nil
+	}
+
+	rootPath, err := determineRootPath(path)
+	if err != nil {
+		backend.Close()
+		return nil, "", err
+	}
+
+	return backend, rootPath, nil
+}
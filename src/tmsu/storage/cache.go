@@ -0,0 +1,133 @@
+// Copyright 2011-2015 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package storage
+
+import (
+	"tmsu/entities"
+)
+
+// Memoises the lookups that commands processing many files make repeatedly.
+// Each transaction has its own cache, so that transactions in concurrent use,
+// such as those of the virtual filesystem, share nothing. The cache lasts only
+// as long as the transaction and is invalidated as the database is modified.
+type cache struct {
+	tags     map[string]*entities.Tag     // by name: nil if there is no such tag
+	files    map[string]*entities.File    // by path: nil if the file is not tracked
+	settings map[string]*entities.Setting // by name: nil if there is no such setting
+	all      entities.Settings            // the complete set of settings, once retrieved
+}
+
+func newCache() *cache {
+	cache := &cache{}
+	cache.clear()
+
+	return cache
+}
+
+func (cache *cache) clear() {
+	cache.clearTags()
+	cache.clearFiles()
+	cache.clearSettings()
+}
+
+func (cache *cache) clearTags() {
+	cache.tags = make(map[string]*entities.Tag)
+}
+
+func (cache *cache) clearFiles() {
+	cache.files = make(map[string]*entities.File)
+}
+
+func (cache *cache) clearSettings() {
+	cache.settings = make(map[string]*entities.Setting)
+	cache.all = nil
+}
+
+func (cache *cache) tag(name string) (*entities.Tag, bool) {
+	tag, ok := cache.tags[name]
+	return copyTag(tag), ok
+}
+
+func (cache *cache) addTag(name string, tag *entities.Tag) {
+	cache.tags[name] = copyTag(tag)
+}
+
+func (cache *cache) file(path string) (*entities.File, bool) {
+	file, ok := cache.files[path]
+	return copyFile(file), ok
+}
+
+func (cache *cache) addFile(path string, file *entities.File) {
+	cache.files[path] = copyFile(file)
+}
+
+func (cache *cache) setting(name string) (*entities.Setting, bool) {
+	setting, ok := cache.settings[name]
+	return copySetting(setting), ok
+}
+
+func (cache *cache) addSetting(name string, setting *entities.Setting) {
+	cache.settings[name] = copySetting(setting)
+}
+
+func (cache *cache) allSettings() entities.Settings {
+	if cache.all == nil {
+		return nil
+	}
+
+	settings := make(entities.Settings, len(cache.all))
+	for index, setting := range cache.all {
+		settings[index] = copySetting(setting)
+	}
+
+	return settings
+}
+
+func (cache *cache) setAllSettings(settings entities.Settings) {
+	cache.all = make(entities.Settings, len(settings))
+	for index, setting := range settings {
+		cache.all[index] = copySetting(setting)
+	}
+}
+
+// the cached entities are copied so that callers cannot modify them
+
+func copyTag(tag *entities.Tag) *entities.Tag {
+	if tag == nil {
+		return nil
+	}
+
+	copy := *tag
+	return &copy
+}
+
+func copyFile(file *entities.File) *entities.File {
+	if file == nil {
+		return nil
+	}
+
+	copy := *file
+	return &copy
+}
+
+func copySetting(setting *entities.Setting) *entities.Setting {
+	if setting == nil {
+		return nil
+	}
+
+	copy := *setting
+	return &copy
+}
@@ -0,0 +1,221 @@
+// Copyright 2011-2015 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package storage
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+	"tmsu/common/fingerprint"
+)
+
+func TestCacheInvalidation(test *testing.T) {
+	// set-up
+
+	store := openTestStorage(test)
+	defer closeTestStorage(store)
+
+	tx, err := store.Begin()
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer tx.Commit()
+
+	// test
+
+	if tag, err := store.TagByName(tx, "apple"); err != nil || tag != nil {
+		test.Fatalf("Expected no such tag but got %v, %v", tag, err)
+	}
+	if _, err := store.AddTag(tx, "apple"); err != nil {
+		test.Fatal(err)
+	}
+	apple, err := store.TagByName(tx, "apple")
+	if err != nil || apple == nil {
+		test.Fatalf("Expected added tag to be found but got %v, %v", apple, err)
+	}
+
+	if _, err := store.RenameTag(tx, apple.Id, "banana"); err != nil {
+		test.Fatal(err)
+	}
+	if tag, err := store.TagByName(tx, "apple"); err != nil || tag != nil {
+		test.Fatalf("Expected renamed tag not to be found by its old name but got %v, %v", tag, err)
+	}
+	if tag, err := store.TagByName(tx, "banana"); err != nil || tag == nil || tag.Id != apple.Id {
+		test.Fatalf("Expected renamed tag to be found by its new name but got %v, %v", tag, err)
+	}
+
+	if file, err := store.FileByPath(tx, "/tmp/tmsu/a"); err != nil || file != nil {
+		test.Fatalf("Expected no such file but got %v, %v", file, err)
+	}
+	added, err := store.AddFile(tx, "/tmp/tmsu/a", fingerprint.Fingerprint("abc"), time.Now(), 3, false)
+	if err != nil {
+		test.Fatal(err)
+	}
+	if file, err := store.FileByPath(tx, "/tmp/tmsu/a"); err != nil || file == nil || file.Id != added.Id {
+		test.Fatalf("Expected added file to be found but got %v, %v", file, err)
+	}
+	if err := store.DeleteFile(tx, added.Id); err != nil {
+		test.Fatal(err)
+	}
+	if file, err := store.FileByPath(tx, "/tmp/tmsu/a"); err != nil || file != nil {
+		test.Fatalf("Expected deleted file not to be found but got %v, %v", file, err)
+	}
+
+	if _, err := store.Setting(tx, "autoCreateTags"); err != nil {
+		test.Fatal(err)
+	}
+	if _, err := store.UpdateSetting(tx, "autoCreateTags", "no"); err != nil {
+		test.Fatal(err)
+	}
+	if setting, err := store.Setting(tx, "autoCreateTags"); err != nil || setting.Value != "no" {
+		test.Fatalf("Expected updated setting but got %v, %v", setting, err)
+	}
+}
+
+func TestCacheScopedToTransaction(test *testing.T) {
+	// set-up
+
+	store := openTestStorage(test)
+	defer closeTestStorage(store)
+
+	// test
+
+	tx, err := store.Begin()
+	if err != nil {
+		test.Fatal(err)
+	}
+	if _, err := store.TagByName(tx, "apple"); err != nil {
+		test.Fatal(err)
+	}
+
+	other, err := store.Begin()
+	if err != nil {
+		test.Fatal(err)
+	}
+	if other.cache == tx.cache {
+		test.Fatal("Expected transactions not to share a cache.")
+	}
+	if _, ok := other.cache.tag("apple"); ok {
+		test.Fatal("Expected one transaction's cached entries not to be visible to another.")
+	}
+	other.Rollback()
+	tx.Rollback()
+
+	batch, err := store.BeginBatch()
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer batch.Commit()
+
+	joined, err := store.Begin()
+	if err != nil {
+		test.Fatal(err)
+	}
+	if joined.cache != batch.cache {
+		test.Fatal("Expected a transaction joining a batch to share its cache.")
+	}
+}
+
+func TestCacheConcurrentTransactions(test *testing.T) {
+	// set-up
+
+	store := openTestStorage(test)
+	defer closeTestStorage(store)
+
+	tx, err := store.Begin()
+	if err != nil {
+		test.Fatal(err)
+	}
+	if _, err := store.AddTag(tx, "apple"); err != nil {
+		test.Fatal(err)
+	}
+	if _, err := store.AddFile(tx, "/tmp/tmsu/a", fingerprint.Fingerprint("abc"), time.Now(), 3, false); err != nil {
+		test.Fatal(err)
+	}
+	if err := tx.Commit(); err != nil {
+		test.Fatal(err)
+	}
+
+	// test
+
+	var group sync.WaitGroup
+	errors := make(chan error, 8)
+	for routine := 0; routine < 8; routine++ {
+		group.Add(1)
+		go func() {
+			defer group.Done()
+
+			for iteration := 0; iteration < 50; iteration++ {
+				tx, err := store.Begin()
+				if err != nil {
+					errors <- err
+					return
+				}
+
+				if tag, err := store.TagByName(tx, "apple"); err != nil || tag == nil {
+					tx.Rollback()
+					errors <- err
+					return
+				}
+				if _, err := store.FileByPath(tx, "/tmp/tmsu/a"); err != nil {
+					tx.Rollback()
+					errors <- err
+					return
+				}
+				if _, err := store.Settings(tx); err != nil {
+					tx.Rollback()
+					errors <- err
+					return
+				}
+
+				if err := tx.Commit(); err != nil {
+					errors <- err
+					return
+				}
+			}
+		}()
+	}
+
+	group.Wait()
+	close(errors)
+
+	// validate
+
+	for err := range errors {
+		test.Fatalf("Concurrent lookup failed: %v", err)
+	}
+}
+
+// unexported
+
+func openTestStorage(test *testing.T) *Storage {
+	path := filepath.Join(os.TempDir(), "tmsu_storage_test.db")
+	os.Remove(path)
+
+	store, err := OpenAt(path)
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	return store
+}
+
+func closeTestStorage(store *Storage) {
+	store.Close()
+	os.Remove(store.DbPath)
+}
@@ -0,0 +1,67 @@
+// Copyright 2011-2015 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package storage
+
+import (
+	"sync/atomic"
+)
+
+// Retrieves the position recorded by the named checkpoint, from which an
+// interrupted operation can resume, or an empty string if there is none.
+func (storage *Storage) Checkpoint(tx *Tx, name string) (string, error) {
+	return tx.tx.Checkpoint(name)
+}
+
+// Records the position reached by the named operation.
+func (storage *Storage) UpdateCheckpoint(tx *Tx, name, position string) error {
+	return tx.tx.UpdateCheckpoint(name, position)
+}
+
+// Removes the named checkpoint, once its operation has completed.
+func (storage *Storage) DeleteCheckpoint(tx *Tx, name string) error {
+	return tx.tx.DeleteCheckpoint(name)
+}
+
+// Commits the changes made so far, so that they survive should the process be
+// interrupted, and continues in a new transaction. Does nothing for a dry run
+// or a transaction that is part of a batch.
+func (tx *Tx) Checkpoint() error {
+	if tx.dryRun || tx.joined || tx.batch != nil {
+		return nil
+	}
+
+	tx.cache.clear()
+
+	if err := tx.tx.Commit(); err != nil {
+		return err
+	}
+
+	atomic.AddInt64(tx.storage.rowsAffected, tx.tx.RowsAffected())
+
+	if tx.tx.Modified() {
+		tx.storage.updateText()
+	}
+
+	backendTx, err := tx.storage.beginDatabase()
+	if err != nil {
+		return err
+	}
+
+	tx.tx = backendTx
+	tx.operationId = 0
+
+	return nil
+}
@@ -0,0 +1,73 @@
+// Copyright 2011-2015 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package storage
+
+import (
+	"sort"
+	"tmsu/common/text"
+	"tmsu/entities"
+)
+
+// unexported
+
+// Whether listings are ordered other than by the bytes of the names, as the
+// database orders them.
+func isCollated() bool {
+	return text.CurrentCollation() != text.Collation{}
+}
+
+// Reorders files sorted by name in the current collation.
+func collateFiles(files entities.Files, sortBy string) {
+	if sortBy != "name" || !isCollated() {
+		return
+	}
+
+	sort.Stable(filesByPath(files))
+}
+
+// Determines the limit that can be passed to the backend: when the files are
+// reordered in the current collation the first rows of the backend's ordering
+// are not necessarily the first files once collated.
+func collatedLimit(sortBy string, limit uint) uint {
+	if sortBy == "name" && isCollated() {
+		return 0
+	}
+
+	return limit
+}
+
+// Truncates the files to the limit. A limit of zero retains all of the files.
+func limitFiles(files entities.Files, limit uint) entities.Files {
+	if limit > 0 && uint(len(files)) > limit {
+		return files[:limit]
+	}
+
+	return files
+}
+
+type filesByPath entities.Files
+
+func (files filesByPath) Len() int {
+	return len(files)
+}
+
+func (files filesByPath) Less(i, j int) bool {
+	return text.Less(files[i].Path(), files[j].Path())
+}
+
+func (files filesByPath) Swap(i, j int) {
+	files[i], files[j] = files[j], files[i]
+}
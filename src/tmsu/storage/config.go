@@ -0,0 +1,285 @@
+// Copyright 2011-2015 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package storage
+
+import (
+	"bufio"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/user"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"tmsu/common/log"
+	"tmsu/entities"
+)
+
+// The path of the global configuration file, which holds the defaults for
+// settings that a database does not set itself.
+func GlobalConfigPath() string {
+	if configHome := os.Getenv("XDG_CONFIG_HOME"); configHome != "" {
+		return filepath.Join(configHome, "tmsu", "tmsu.conf")
+	}
+
+	u, err := user.Current()
+	if err != nil {
+		return ""
+	}
+
+	return filepath.Join(u.HomeDir, ".config", "tmsu", "tmsu.conf")
+}
+
+// The settings in the global configuration file. The file holds a NAME=VALUE
+// line per setting: blank lines and lines starting with '#' are ignored.
+func GlobalSettings() (entities.Settings, error) {
+	settings, _, err := readGlobalConfig()
+	return settings, err
+}
+
+// A user-defined command alias: a name that expands to a command and,
+// optionally, some of its options and arguments.
+type Alias struct {
+	Name      string
+	Expansion string
+}
+
+// The command aliases in the global configuration file, which are specified
+// as 'alias NAME = EXPANSION' lines.
+func GlobalAliases() ([]Alias, error) {
+	_, aliases, err := readGlobalConfig()
+	return aliases, err
+}
+
+// Sets a setting in the global configuration file, creating the file if
+// necessary. Other lines in the file are preserved.
+func UpdateGlobalSetting(name, value string) error {
+	if _, ok := defaultSettings[name]; !ok {
+		return fmt.Errorf("no such setting '%v'", name)
+	}
+	if err := ValidateSetting(name, value); err != nil {
+		return err
+	}
+
+	path := GlobalConfigPath()
+	if path == "" {
+		return fmt.Errorf("could not identify the configuration file")
+	}
+
+	var lines []string
+
+	content, err := ioutil.ReadFile(path)
+	switch {
+	case err == nil:
+		lines = strings.Split(strings.TrimRight(string(content), "\n"), "\n")
+	case os.IsNotExist(err):
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return fmt.Errorf("%v: could not create directory: %v", filepath.Dir(path), err)
+		}
+	default:
+		return fmt.Errorf("%v: could not read configuration: %v", path, err)
+	}
+
+	updated := false
+	for index, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || trimmed[0] == '#' {
+			continue
+		}
+
+		if equals := strings.Index(trimmed, "="); equals != -1 && strings.TrimSpace(trimmed[:equals]) == name {
+			lines[index] = name + "=" + value
+			updated = true
+		}
+	}
+	if !updated {
+		lines = append(lines, name+"="+value)
+	}
+
+	if err := ioutil.WriteFile(path, []byte(strings.Join(lines, "\n")+"\n"), 0644); err != nil {
+		return fmt.Errorf("%v: could not write configuration: %v", path, err)
+	}
+
+	return nil
+}
+
+// The default value of each setting: the built-in default unless overridden by
+// the global configuration file.
+func DefaultSettings() entities.Settings {
+	defaults := settingDefaults()
+
+	names := make([]string, 0, len(defaults))
+	for name := range defaults {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	settings := make(entities.Settings, len(names))
+	for index, name := range names {
+		settings[index] = &entities.Setting{Name: name, Value: defaults[name]}
+	}
+
+	return settings
+}
+
+// Checks that the value is valid for the setting.
+func ValidateSetting(name, value string) error {
+	switch name {
+	case readOnlySettingName, textDatabaseSettingName, inheritDupeTagsSettingName, allowSpacesSettingName, fingerprintCacheSettingName, numericSortSettingName, auditLogSettingName:
+		if !entities.IsBoolValue(value) {
+			return fmt.Errorf("invalid boolean value '%v' for setting '%v'", value, name)
+		}
+	case colourSettingName:
+		if !entities.IsColourValue(value) {
+			return fmt.Errorf("invalid colour value '%v' for setting '%v': must be one of auto, always, never", value, name)
+		}
+	case canonicalPathsSettingName:
+		if !isCanonicalPathsValue(value) {
+			return fmt.Errorf("invalid value '%v' for setting '%v': must be one of none, symlinks, mounts", value, name)
+		}
+	case pathOnlyFilesSettingName:
+		return validatePathOnlyPatterns(value)
+	case openersSettingName:
+		return validateOpeners(value)
+	case collationSettingName:
+		if value != "binary" && value != "locale" {
+			return fmt.Errorf("invalid value '%v' for setting '%v': must be one of binary, locale", value, name)
+		}
+	case expiredTagsSettingName:
+		if value != "remove" && value != "archive" {
+			return fmt.Errorf("invalid value '%v' for setting '%v': must be one of remove, archive", value, name)
+		}
+	case verifyScheduleSettingName, vacuumScheduleSettingName, pruneScheduleSettingName:
+		if !entities.IsScheduleValue(value) {
+			return fmt.Errorf("invalid value '%v' for setting '%v': must be one of never, daily, weekly, monthly", value, name)
+		}
+	case verifyFilesSettingName:
+		if count, err := strconv.ParseUint(value, 10, 32); err != nil || count == 0 {
+			return fmt.Errorf("invalid count '%v' for setting '%v': must be a positive number", value, name)
+		}
+	case confirmFileCountSettingName:
+		if _, err := strconv.ParseUint(value, 10, 32); err != nil {
+			return fmt.Errorf("invalid count '%v' for setting '%v': must be a number or '0' to disable confirmation", value, name)
+		}
+	case auditLogMaxSizeSettingName:
+		if _, err := parseByteSize(value); err != nil {
+			return fmt.Errorf("invalid size '%v' for setting '%v': must be e.g. '10M', '512K' or '0' to disable rotation", value, name)
+		}
+	case vfsCacheTimeoutSettingName:
+		if timeout, err := time.ParseDuration(value); err != nil || timeout < 0 {
+			return fmt.Errorf("invalid duration '%v' for setting '%v': must be e.g. '1s', '500ms' or '0' to disable caching", value, name)
+		}
+	}
+
+	return nil
+}
+
+// unexported
+
+const aliasPrefix = "alias "
+
+func readGlobalConfig() (entities.Settings, []Alias, error) {
+	path := GlobalConfigPath()
+	if path == "" {
+		return entities.Settings{}, []Alias{}, nil
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return entities.Settings{}, []Alias{}, nil
+		}
+
+		return nil, nil, fmt.Errorf("%v: could not open configuration: %v", path, err)
+	}
+	defer file.Close()
+
+	settings := make(entities.Settings, 0, 10)
+	aliases := make([]Alias, 0, 10)
+
+	scanner := bufio.NewScanner(file)
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || line[0] == '#' {
+			continue
+		}
+
+		isAlias := strings.HasPrefix(line, aliasPrefix)
+		if isAlias {
+			line = line[len(aliasPrefix):]
+		}
+
+		index := strings.Index(line, "=")
+		if index == -1 {
+			if isAlias {
+				return nil, nil, fmt.Errorf("%v:%v: expected alias NAME = EXPANSION", path, lineNumber)
+			}
+
+			return nil, nil, fmt.Errorf("%v:%v: expected NAME=VALUE", path, lineNumber)
+		}
+
+		name := strings.TrimSpace(line[:index])
+		value := strings.TrimSpace(line[index+1:])
+
+		if isAlias {
+			if name == "" || strings.ContainsAny(name, " \t") || value == "" {
+				return nil, nil, fmt.Errorf("%v:%v: expected alias NAME = EXPANSION", path, lineNumber)
+			}
+
+			aliases = append(aliases, Alias{name, value})
+		} else {
+			settings = append(settings, &entities.Setting{Name: name, Value: value})
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, nil, fmt.Errorf("%v: could not read configuration: %v", path, err)
+	}
+
+	return settings, aliases, nil
+}
+
+// The default value of each setting: the built-in defaults overridden by the
+// global configuration file. Invalid entries in the file are ignored.
+func settingDefaults() map[string]string {
+	defaults := make(map[string]string, len(defaultSettings))
+	for name, value := range defaultSettings {
+		defaults[name] = value
+	}
+
+	settings, err := GlobalSettings()
+	if err != nil {
+		log.Warnf("%v", err)
+		return defaults
+	}
+
+	for _, setting := range settings {
+		if _, ok := defaults[setting.Name]; !ok {
+			log.Warnf("%v: no such setting '%v'", GlobalConfigPath(), setting.Name)
+			continue
+		}
+		if err := ValidateSetting(setting.Name, setting.Value); err != nil {
+			log.Warnf("%v: %v", GlobalConfigPath(), err)
+			continue
+		}
+
+		defaults[setting.Name] = setting.Value
+	}
+
+	return defaults
+}
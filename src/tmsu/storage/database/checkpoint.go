@@ -0,0 +1,67 @@
+// Copyright 2011-2015 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package database
+
+// Retrieves the position recorded by the named checkpoint, or an empty string
+// if there is no such checkpoint.
+func Checkpoint(tx *Tx, name string) (string, error) {
+	sql := `SELECT position
+            FROM checkpoint
+            WHERE name = ?`
+
+	rows, err := tx.Query(sql, name)
+	if err != nil {
+		return "", err
+	}
+	defer rows.Close()
+
+	if !rows.Next() {
+		return "", rows.Err()
+	}
+
+	var position string
+	if err := rows.Scan(&position); err != nil {
+		return "", err
+	}
+
+	return position, nil
+}
+
+// Records the position reached by the named operation.
+func UpdateCheckpoint(tx *Tx, name, position string) error {
+	sql := `INSERT OR REPLACE INTO checkpoint (name, position)
+            VALUES (?, ?)`
+
+	_, err := tx.Exec(sql, name, position)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// Removes the named checkpoint.
+func DeleteCheckpoint(tx *Tx, name string) error {
+	sql := `DELETE FROM checkpoint
+            WHERE name = ?`
+
+	_, err := tx.Exec(sql, name)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,54 @@
+// Copyright 2011-2015 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package database
+
+import (
+	"tmsu/entities"
+)
+
+// Replaces the indexed content of the specified file.
+func UpdateFileContent(tx *Tx, fileId entities.FileId, text string) error {
+	if err := DeleteFileContent(tx, fileId); err != nil {
+		return err
+	}
+
+	if text == "" {
+		return nil
+	}
+
+	sql := `INSERT INTO file_content (rowid, text)
+            VALUES (?, ?)`
+
+	_, err := tx.Exec(sql, fileId, text)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// Removes the indexed content of the specified file.
+func DeleteFileContent(tx *Tx, fileId entities.FileId) error {
+	sql := `DELETE FROM file_content
+            WHERE rowid = ?`
+
+	_, err := tx.Exec(sql, fileId)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
@@ -18,12 +18,22 @@ package database
 import (
 	"database/sql"
 	"errors"
-	_ "github.com/mattn/go-sqlite3"
+	"github.com/mattn/go-sqlite3"
 	"os"
 	"path/filepath"
+	"strings"
 	"tmsu/common/log"
+	"tmsu/common/timing"
+	"tmsu/query"
 )
 
+// The name of the SQLite driver extended with TMSU's own SQL functions.
+const driverName = "sqlite3_tmsu"
+
+func init() {
+	sql.Register(driverName, &sqlite3.SQLiteDriver{ConnectHook: registerFunctions})
+}
+
 type Database struct {
 	db *sql.DB
 }
@@ -44,7 +54,7 @@ func OpenAt(path string) (*Database, error) {
 		}
 	}
 
-	db, err := sql.Open("sqlite3", path)
+	db, err := sql.Open(driverName, path)
 	if err != nil {
 		return nil, DatabaseAccessError{path, err}
 	}
@@ -75,30 +85,48 @@ func (database *Database) Begin() (*Tx, error) {
 		return nil, err
 	}
 
-	return &Tx{tx}, nil
+	return &Tx{tx, false, false, 0}, nil
 }
 
 type Tx struct {
-	tx *sql.Tx
+	tx       *sql.Tx
+	ReadOnly bool // reject statements that modify the database
+	Modified bool // whether any statement has modified the database
+
+	RowsAffected int64 // the number of rows of user data changed by the statements executed
 }
 
 func (tx *Tx) Exec(query string, args ...interface{}) (sql.Result, error) {
-	log.Infof(3, query)
-	log.Infof(3, "Params: %v", args)
+	if tx.ReadOnly {
+		return nil, ReadOnlyError{}
+	}
 
-	return tx.tx.Exec(query, args...)
+	result, err := tx.execTemporary(query, args...)
+	if err == nil {
+		tx.Modified = true
+
+		if rows, err := result.RowsAffected(); err == nil && userTables[statementTable(query)] {
+			tx.RowsAffected += rows
+		}
+	}
+
+	return result, err
 }
 
 func (tx *Tx) Query(query string, args ...interface{}) (*sql.Rows, error) {
 	log.Infof(3, query)
 	log.Infof(3, "Params: %v", args)
 
+	defer timing.Start(timing.SQL)()
+
 	return tx.tx.Query(query, args...)
 }
 
 func (tx *Tx) Commit() error {
 	log.Infof(2, "Committing transaction")
 
+	defer timing.Start(timing.SQL)()
+
 	return tx.tx.Commit()
 }
 
@@ -110,6 +138,53 @@ func (tx *Tx) Rollback() error {
 
 // unexported
 
+// The tables holding the data the user sees, as opposed to the bookkeeping,
+// such as the journal, history and fingerprints, kept alongside it. Only the
+// changes to these are counted in RowsAffected.
+var userTables = map[string]bool{
+	"file":        true,
+	"tag":         true,
+	"value":       true,
+	"file_tag":    true,
+	"implication": true,
+	"exclusion":   true,
+	"file_note":   true,
+	"query":       true,
+	"setting":     true,
+}
+
+// The table an INSERT, UPDATE or DELETE statement modifies.
+func statementTable(sql string) string {
+	words := strings.Fields(strings.ToLower(sql))
+	for index, word := range words {
+		switch word {
+		case "into", "update", "from":
+			index++
+			if index < len(words) && words[index] == "or" {
+				index += 2 // UPDATE OR REPLACE &c.
+			}
+			if index < len(words) {
+				return strings.SplitN(words[index], "(", 2)[0]
+			}
+
+			return ""
+		}
+	}
+
+	return ""
+}
+
+// Executes a statement without the read-only check: for statements that only
+// modify temporary tables.
+func (tx *Tx) execTemporary(query string, args ...interface{}) (sql.Result, error) {
+	log.Infof(3, query)
+	log.Infof(3, "Params: %v", args)
+
+	defer timing.Start(timing.SQL)()
+
+	return tx.tx.Exec(query, args...)
+}
+
 func readCount(rows *sql.Rows) (uint, error) {
 	if !rows.Next() {
 		return 0, errors.New("Could not get count.")
@@ -126,3 +201,17 @@ func readCount(rows *sql.Rows) (uint, error) {
 
 	return count, nil
 }
+
+// Registers the SQL functions used by queries:
+//
+// quantity(value, kind) - the value as a number of bytes ('size') or seconds
+// ('duration'), or NULL if it is not such a quantity.
+func registerFunctions(conn *sqlite3.SQLiteConn) error {
+	return conn.RegisterFunc("quantity", func(value, kind string) interface{} {
+		if quantity, ok := query.ParseQuantityOf(value, query.QuantityKind(kind)); ok {
+			return quantity
+		}
+
+		return nil
+	}, true)
+}
@@ -0,0 +1,198 @@
+// Copyright 2011-2015 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package database
+
+import (
+	"database/sql"
+	"strconv"
+	"tmsu/entities"
+)
+
+// The maximum number of problems reported by the integrity check.
+const integrityCheckLimit = 20
+
+// Retrieves the statistics of the database's storage: its schema version,
+// pages, row counts and indexes and the problems found by a quick integrity
+// check.
+func DatabaseStatistics(tx *Tx) (*entities.DatabaseStatistics, error) {
+	var stats entities.DatabaseStatistics
+
+	version, err := queryString(tx, "SELECT sqlite_version()")
+	if err != nil {
+		return nil, err
+	}
+	stats.Engine = "SQLite " + version
+	stats.SchemaVersion = schemaVersion(tx.tx).String()
+
+	if stats.PageSize, err = queryCount(tx, "PRAGMA page_size"); err != nil {
+		return nil, err
+	}
+	if stats.PageCount, err = queryCount(tx, "PRAGMA page_count"); err != nil {
+		return nil, err
+	}
+	if stats.FreePages, err = queryCount(tx, "PRAGMA freelist_count"); err != nil {
+		return nil, err
+	}
+
+	if stats.Tables, err = tableStatistics(tx); err != nil {
+		return nil, err
+	}
+	if stats.Indexes, err = indexStatistics(tx); err != nil {
+		return nil, err
+	}
+	if stats.Integrity, err = integrityCheck(tx); err != nil {
+		return nil, err
+	}
+
+	return &stats, nil
+}
+
+// unexported
+
+func tableStatistics(tx *Tx) ([]entities.TableStatistic, error) {
+	names, err := queryStrings(tx, `SELECT name
+                                     FROM sqlite_master
+                                     WHERE type = 'table' AND name NOT LIKE 'sqlite_%'
+                                     ORDER BY name`)
+	if err != nil {
+		return nil, err
+	}
+
+	tables := make([]entities.TableStatistic, len(names))
+	for index, name := range names {
+		rows, err := queryCount(tx, `SELECT count(1) FROM "`+name+`"`)
+		if err != nil {
+			return nil, err
+		}
+
+		tables[index] = entities.TableStatistic{Name: name, Rows: rows}
+	}
+
+	return tables, nil
+}
+
+func indexStatistics(tx *Tx) ([]entities.IndexStatistic, error) {
+	sql := `SELECT name, tbl_name
+            FROM sqlite_master
+            WHERE type = 'index'
+            ORDER BY tbl_name, name`
+
+	rows, err := tx.Query(sql)
+	if err != nil {
+		return nil, err
+	}
+
+	indexes := make([]entities.IndexStatistic, 0, 10)
+	for rows.Next() {
+		if rows.Err() != nil {
+			rows.Close()
+			return nil, rows.Err()
+		}
+
+		var index entities.IndexStatistic
+		if err := rows.Scan(&index.Name, &index.Table); err != nil {
+			rows.Close()
+			return nil, err
+		}
+
+		indexes = append(indexes, index)
+	}
+	rows.Close()
+
+	// statistics are only present once the database has been analysed
+	analysed, err := queryCount(tx, "SELECT count(1) FROM sqlite_master WHERE name = 'sqlite_stat1'")
+	if err != nil {
+		return nil, err
+	}
+	if analysed == 0 {
+		return indexes, nil
+	}
+
+	for position := range indexes {
+		stats, err := queryStrings(tx, "SELECT stat FROM sqlite_stat1 WHERE idx = ?", indexes[position].Name)
+		if err != nil {
+			return nil, err
+		}
+		if len(stats) > 0 {
+			indexes[position].Stat = stats[0]
+		}
+	}
+
+	return indexes, nil
+}
+
+func integrityCheck(tx *Tx) ([]string, error) {
+	results, err := queryStrings(tx, "PRAGMA quick_check("+strconv.Itoa(integrityCheckLimit)+")")
+	if err != nil {
+		return nil, err
+	}
+
+	if len(results) == 1 && results[0] == "ok" {
+		return []string{}, nil
+	}
+
+	return results, nil
+}
+
+func queryCount(tx *Tx, sql string, args ...interface{}) (uint, error) {
+	rows, err := tx.Query(sql, args...)
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	return readCount(rows)
+}
+
+func queryString(tx *Tx, sql string, args ...interface{}) (string, error) {
+	values, err := queryStrings(tx, sql, args...)
+	if err != nil {
+		return "", err
+	}
+	if len(values) == 0 {
+		return "", nil
+	}
+
+	return values[0], nil
+}
+
+func queryStrings(tx *Tx, sql string, args ...interface{}) ([]string, error) {
+	rows, err := tx.Query(sql, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return readStrings(rows)
+}
+
+func readStrings(rows *sql.Rows) ([]string, error) {
+	values := make([]string, 0, 10)
+	for rows.Next() {
+		if rows.Err() != nil {
+			return nil, rows.Err()
+		}
+
+		var value string
+		if err := rows.Scan(&value); err != nil {
+			return nil, err
+		}
+
+		values = append(values, value)
+	}
+
+	return values, nil
+}
@@ -92,6 +92,15 @@ func (err NoSuchImplicationError) Error() string {
 	return fmt.Sprintf("no such implication where tag #%v implies tag #%v", err.TagId, err.ImpliedTagId)
 }
 
+type NoSuchExclusionError struct {
+	Set   string
+	TagId entities.TagId
+}
+
+func (err NoSuchExclusionError) Error() string {
+	return fmt.Sprintf("no such exclusion where tag #%v is in set '%v'", err.TagId, err.Set)
+}
+
 type NoSuchSettingError struct {
 	Name string
 }
@@ -99,3 +108,9 @@ type NoSuchSettingError struct {
 func (err NoSuchSettingError) Error() string {
 	return fmt.Sprintf("no such setting '%v'", err.Name)
 }
+
+type ReadOnlyError struct{}
+
+func (err ReadOnlyError) Error() string {
+	return "the database is read-only"
+}
@@ -0,0 +1,118 @@
+// Copyright 2011-2015 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package database
+
+import (
+	"database/sql"
+	"tmsu/entities"
+)
+
+// Retrieves the complete set of tag exclusions.
+func Exclusions(tx *Tx) (entities.Exclusions, error) {
+	sql := `SELECT exclusion.name, tag.id, tag.name
+            FROM exclusion, tag
+            WHERE exclusion.tag_id = tag.id
+            ORDER BY exclusion.name, tag.name`
+
+	rows, err := tx.Query(sql)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return readExclusions(rows, make(entities.Exclusions, 0, 10))
+}
+
+// Adds the tag to the named set of mutually exclusive tags.
+func AddExclusion(tx *Tx, set string, tagId entities.TagId) error {
+	sql := `INSERT OR IGNORE INTO exclusion (name, tag_id)
+            VALUES (?1, ?2)`
+
+	if _, err := tx.Exec(sql, set, tagId); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// Removes the tag from the named set of mutually exclusive tags.
+func DeleteExclusion(tx *Tx, set string, tagId entities.TagId) error {
+	sql := `DELETE FROM exclusion
+            WHERE name = ?1 AND tag_id = ?2`
+
+	result, err := tx.Exec(sql, set, tagId)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return NoSuchExclusionError{set, tagId}
+	}
+	if rowsAffected > 1 {
+		panic("expected exactly one row to be affected")
+	}
+
+	return nil
+}
+
+// Deletes the named set of mutually exclusive tags.
+func DeleteExclusionSet(tx *Tx, set string) error {
+	sql := `DELETE FROM exclusion
+            WHERE name = ?1`
+
+	if _, err := tx.Exec(sql, set); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// Removes the tag from every set of mutually exclusive tags.
+func DeleteExclusionsForTagId(tx *Tx, tagId entities.TagId) error {
+	sql := `DELETE FROM exclusion
+            WHERE tag_id = ?1`
+
+	if _, err := tx.Exec(sql, tagId); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// unexported
+
+func readExclusions(rows *sql.Rows, exclusions entities.Exclusions) (entities.Exclusions, error) {
+	for rows.Next() {
+		if rows.Err() != nil {
+			return nil, rows.Err()
+		}
+
+		var set string
+		var tagId entities.TagId
+		var tagName string
+		if err := rows.Scan(&set, &tagId, &tagName); err != nil {
+			return nil, err
+		}
+
+		exclusions = append(exclusions, &entities.Exclusion{Set: set, Tag: entities.Tag{Id: tagId, Name: tagName}})
+	}
+
+	return exclusions, nil
+}
@@ -0,0 +1,100 @@
+// Copyright 2011-2015 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package database
+
+import (
+	"database/sql"
+	"time"
+	"tmsu/entities"
+)
+
+// Retrieves the expiries of the specified file's tags.
+func FileTagExpiriesByFileId(tx *Tx, fileId entities.FileId) (entities.FileTagExpiries, error) {
+	sql := `SELECT file_id, tag_id, value_id, expires
+            FROM file_tag_expiry
+            WHERE file_id = ?
+            ORDER BY expires, tag_id, value_id`
+
+	rows, err := tx.Query(sql, fileId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return readFileTagExpiries(rows)
+}
+
+// Retrieves the expiries of the file tags that are due to be removed by the
+// time specified.
+func ExpiredFileTags(tx *Tx, now time.Time) (entities.FileTagExpiries, error) {
+	sql := `SELECT file_id, tag_id, value_id, expires
+            FROM file_tag_expiry
+            WHERE expires <= ?
+            ORDER BY expires, file_id, tag_id, value_id`
+
+	rows, err := tx.Query(sql, now.Unix())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return readFileTagExpiries(rows)
+}
+
+// Records when the specified file tag is to be removed.
+func UpdateFileTagExpiry(tx *Tx, fileId entities.FileId, tagId entities.TagId, valueId entities.ValueId, expires time.Time) error {
+	sql := `INSERT OR REPLACE INTO file_tag_expiry (file_id, tag_id, value_id, expires)
+            VALUES (?, ?, ?, ?)`
+
+	_, err := tx.Exec(sql, fileId, tagId, valueId, expires.Unix())
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// Removes the expiry of the specified file tag.
+func DeleteFileTagExpiry(tx *Tx, fileId entities.FileId, tagId entities.TagId, valueId entities.ValueId) error {
+	sql := `DELETE FROM file_tag_expiry
+            WHERE file_id = ? AND tag_id = ? AND value_id = ?`
+
+	_, err := tx.Exec(sql, fileId, tagId, valueId)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// unexported
+
+func readFileTagExpiries(rows *sql.Rows) (entities.FileTagExpiries, error) {
+	expiries := make(entities.FileTagExpiries, 0, 10)
+	for rows.Next() {
+		var fileId entities.FileId
+		var tagId entities.TagId
+		var valueId entities.ValueId
+		var expires int64
+		if err := rows.Scan(&fileId, &tagId, &valueId, &expires); err != nil {
+			return nil, err
+		}
+
+		expiries = append(expiries, &entities.FileTagExpiry{FileId: fileId, TagId: tagId, ValueId: valueId, Expires: time.Unix(expires, 0)})
+	}
+
+	return expiries, rows.Err()
+}
@@ -0,0 +1,67 @@
+// Copyright 2011-2015 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package database
+
+import (
+	"tmsu/query"
+)
+
+// Retrieves the SQL and parameters that would be used to retrieve the files matching the specified query.
+func QueryFilesSql(expression query.Expression, path, sort string) (string, []interface{}) {
+	builder := buildQuery(expression, path, sort, 0)
+	return builder.Sql, builder.Params
+}
+
+// Retrieves the SQLite query plan for the specified SQL.
+func QueryPlan(tx *Tx, sql string, params ...interface{}) ([]string, error) {
+	rows, err := tx.Query("EXPLAIN QUERY PLAN "+sql, params...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+
+	steps := make([]string, 0, 10)
+	for rows.Next() {
+		if rows.Err() != nil {
+			return nil, rows.Err()
+		}
+
+		values := make([]interface{}, len(columns))
+		pointers := make([]interface{}, len(columns))
+		for index := range values {
+			pointers[index] = &values[index]
+		}
+
+		if err := rows.Scan(pointers...); err != nil {
+			return nil, err
+		}
+
+		// the detail is the last column in all SQLite versions
+		switch detail := values[len(values)-1].(type) {
+		case string:
+			steps = append(steps, detail)
+		case []byte:
+			steps = append(steps, string(detail))
+		}
+	}
+
+	return steps, nil
+}
@@ -19,8 +19,10 @@ import (
 	"database/sql"
 	"path/filepath"
 	"strconv"
+	"strings"
 	"time"
 	"tmsu/common/fingerprint"
+	_path "tmsu/common/path"
 	"tmsu/entities"
 	"tmsu/query"
 )
@@ -73,8 +75,8 @@ func File(tx *Tx, id entities.FileId) (*entities.File, error) {
 
 // Retrieves the file with the specified path.
 func FileByPath(tx *Tx, path string) (*entities.File, error) {
-	directory := filepath.Dir(path)
-	name := filepath.Base(path)
+	directory := _path.Dir(path)
+	name := _path.Base(path)
 
 	sql := `SELECT id, directory, name, fingerprint, mod_time, size, is_dir
 	        FROM file
@@ -89,6 +91,45 @@ func FileByPath(tx *Tx, path string) (*entities.File, error) {
 	return readFile(rows)
 }
 
+// Retrieves the files with the specified paths. Paths that are not tracked
+// are omitted.
+func FilesByPaths(tx *Tx, paths []string) (entities.Files, error) {
+	files := make(entities.Files, 0, len(paths))
+
+	// in batches to keep within SQLite's limit on the number of parameters
+	for start := 0; start < len(paths); start += filesByPathsBatchSize {
+		end := start + filesByPathsBatchSize
+		if end > len(paths) {
+			end = len(paths)
+		}
+		batch := paths[start:end]
+
+		sql := `SELECT id, directory, name, fingerprint, mod_time, size, is_dir
+                FROM file
+                WHERE (directory, name) IN (VALUES (?, ?)`
+		sql += strings.Repeat(", (?, ?)", len(batch)-1)
+		sql += ")"
+
+		params := make([]interface{}, 0, len(batch)*2)
+		for _, path := range batch {
+			params = append(params, _path.Dir(path), _path.Base(path))
+		}
+
+		rows, err := tx.Query(sql, params...)
+		if err != nil {
+			return nil, err
+		}
+
+		files, err = readFiles(rows, files)
+		rows.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return files, nil
+}
+
 // Retrieves all files that are under the specified directory.
 func FilesByDirectory(tx *Tx, path string) (entities.Files, error) {
 	sql := `SELECT id, directory, name, fingerprint, mod_time, size, is_dir
@@ -168,8 +209,9 @@ func QueryFileCount(tx *Tx, expression query.Expression, path string) (uint, err
 }
 
 // Retrieves the set of files matching the specified query and matching the specified path.
-func QueryFiles(tx *Tx, expression query.Expression, path, sort string) (entities.Files, error) {
-	builder := buildQuery(expression, path, sort)
+// A limit of zero retrieves all of the matching files.
+func QueryFiles(tx *Tx, expression query.Expression, path, sort string, limit uint) (entities.Files, error) {
+	builder := buildQuery(expression, path, sort, limit)
 	rows, err := tx.Query(builder.Sql, builder.Params...)
 	if err != nil {
 		return nil, err
@@ -179,6 +221,46 @@ func QueryFiles(tx *Tx, expression query.Expression, path, sort string) (entitie
 	return readFiles(rows, make(entities.Files, 0, 10))
 }
 
+// Retrieves the set of files matching the specified query combined with the path set using the specified set operation.
+// A limit of zero retrieves all of the matching files.
+func QueryFilesWithPathSet(tx *Tx, expression query.Expression, path, operation, sort string, limit uint) (entities.Files, error) {
+	builder := buildPathSetQuery(expression, path, operation, sort, limit)
+	rows, err := tx.Query(builder.Sql, builder.Params...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return readFiles(rows, make(entities.Files, 0, 10))
+}
+
+// Replaces the contents of the path set with the specified paths.
+func LoadPathSet(tx *Tx, paths []string) error {
+	sql := `CREATE TEMPORARY TABLE IF NOT EXISTS path_set (
+                directory TEXT NOT NULL,
+                name TEXT NOT NULL
+            )`
+
+	if _, err := tx.execTemporary(sql); err != nil {
+		return err
+	}
+
+	if _, err := tx.execTemporary(`DELETE FROM path_set`); err != nil {
+		return err
+	}
+
+	sql = `INSERT INTO path_set (directory, name)
+           VALUES (?, ?)`
+
+	for _, path := range paths {
+		if _, err := tx.execTemporary(sql, _path.Dir(path), _path.Base(path)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
 // Retrieves the sets of duplicate files within the database.
 func DuplicateFiles(tx *Tx) ([]entities.Files, error) {
 	sql := `SELECT id, directory, name, fingerprint, mod_time, size, is_dir
@@ -240,8 +322,8 @@ func DuplicateFiles(tx *Tx) ([]entities.Files, error) {
 
 // Adds a file to the database.
 func InsertFile(tx *Tx, path string, fingerprint fingerprint.Fingerprint, modTime time.Time, size int64, isDir bool) (*entities.File, error) {
-	directory := filepath.Dir(path)
-	name := filepath.Base(path)
+	directory := _path.Dir(path)
+	name := _path.Base(path)
 
 	sql := `INSERT INTO file (directory, name, fingerprint, mod_time, size, is_dir)
 	        VALUES (?, ?, ?, ?, ?, ?)`
@@ -269,8 +351,8 @@ func InsertFile(tx *Tx, path string, fingerprint fingerprint.Fingerprint, modTim
 
 // Updates a file in the database.
 func UpdateFile(tx *Tx, fileId entities.FileId, path string, fingerprint fingerprint.Fingerprint, modTime time.Time, size int64, isDir bool) (*entities.File, error) {
-	directory := filepath.Dir(path)
-	name := filepath.Base(path)
+	directory := _path.Dir(path)
+	name := _path.Base(path)
 
 	sql := `UPDATE file
 	        SET directory = ?, name = ?, fingerprint = ?, mod_time = ?, size = ?, is_dir = ?
@@ -292,6 +374,36 @@ func UpdateFile(tx *Tx, fileId entities.FileId, path string, fingerprint fingerp
 	return &entities.File{entities.FileId(fileId), directory, name, fingerprint, modTime, size, isDir}, nil
 }
 
+// Rewrites the paths of the file at fromPath and of all files under it so
+// that they are under toPath instead, returning the number of files updated.
+func RewriteFilePaths(tx *Tx, fromPath, toPath string) (uint, error) {
+	fromPath = filepath.Clean(fromPath)
+	toPath = filepath.Clean(toPath)
+
+	sql := `UPDATE file
+            SET directory = CASE WHEN directory = ?1 THEN ?2
+                                 WHEN substr(directory, 1, length(?3)) = ?3 THEN ?4 || substr(directory, length(?3) + 1)
+                                 ELSE ?6 END,
+                name = CASE WHEN directory = ?5 AND name = ?7 THEN ?8
+                            ELSE name END
+            WHERE directory = ?1 OR
+                  substr(directory, 1, length(?3)) = ?3 OR
+                  (directory = ?5 AND name = ?7)`
+
+	result, err := tx.Exec(sql, fromPath, toPath, trailingSeparator(fromPath), trailingSeparator(toPath),
+		_path.Dir(fromPath), _path.Dir(toPath), _path.Base(fromPath), _path.Base(toPath))
+	if err != nil {
+		return 0, err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+
+	return uint(rowsAffected), nil
+}
+
 // Removes a file from the database.
 func DeleteFile(tx *Tx, fileId entities.FileId) error {
 	sql := `DELETE FROM file
@@ -313,22 +425,115 @@ func DeleteFile(tx *Tx, fileId entities.FileId) error {
 		panic("expected only one row to be affected.")
 	}
 
-	return nil
+	if err := DeleteFileNote(tx, fileId); err != nil {
+		return err
+	}
+
+	if err := DeleteFileContent(tx, fileId); err != nil {
+		return err
+	}
+
+	if err := DeleteFilePathOnly(tx, fileId); err != nil {
+		return err
+	}
+
+	if err := DeleteFileVirtual(tx, fileId); err != nil {
+		return err
+	}
+
+	if err := DeleteFileFingerprints(tx, fileId); err != nil {
+		return err
+	}
+
+	if err := DeleteFileIdentity(tx, fileId); err != nil {
+		return err
+	}
+
+	return DeleteFileVolume(tx, fileId)
 }
 
-// Deletes the specified files if they are untagged
+// Deletes the specified files if they are untagged and have no note
 func DeleteUntaggedFiles(tx *Tx, fileIds entities.FileIds) error {
 	for _, fileId := range fileIds {
 		sql := `DELETE FROM file
                 WHERE id = ?1
                 AND (SELECT count(1)
                      FROM file_tag
-                     WHERE file_id = ?1) == 0`
+                     WHERE file_id = ?1) == 0
+                AND NOT EXISTS (SELECT 1
+                                FROM file_note
+                                WHERE rowid = ?1)`
 
 		_, err := tx.Exec(sql, fileId)
 		if err != nil {
 			return err
 		}
+
+		sql = `DELETE FROM file_volume
+               WHERE file_id = ?1
+               AND NOT EXISTS (SELECT 1
+                               FROM file
+                               WHERE id = ?1)`
+
+		_, err = tx.Exec(sql, fileId)
+		if err != nil {
+			return err
+		}
+
+		sql = `DELETE FROM file_path_only
+               WHERE file_id = ?1
+               AND NOT EXISTS (SELECT 1
+                               FROM file
+                               WHERE id = ?1)`
+
+		_, err = tx.Exec(sql, fileId)
+		if err != nil {
+			return err
+		}
+
+		sql = `DELETE FROM file_virtual
+               WHERE file_id = ?1
+               AND NOT EXISTS (SELECT 1
+                               FROM file
+                               WHERE id = ?1)`
+
+		_, err = tx.Exec(sql, fileId)
+		if err != nil {
+			return err
+		}
+
+		sql = `DELETE FROM file_fingerprint
+               WHERE file_id = ?1
+               AND NOT EXISTS (SELECT 1
+                               FROM file
+                               WHERE id = ?1)`
+
+		_, err = tx.Exec(sql, fileId)
+		if err != nil {
+			return err
+		}
+
+		sql = `DELETE FROM file_identity
+               WHERE file_id = ?1
+               AND NOT EXISTS (SELECT 1
+                               FROM file
+                               WHERE id = ?1)`
+
+		_, err = tx.Exec(sql, fileId)
+		if err != nil {
+			return err
+		}
+
+		sql = `DELETE FROM file_content
+               WHERE rowid = ?1
+               AND NOT EXISTS (SELECT 1
+                               FROM file
+                               WHERE id = ?1)`
+
+		_, err = tx.Exec(sql, fileId)
+		if err != nil {
+			return err
+		}
 	}
 
 	return nil
@@ -336,6 +541,9 @@ func DeleteUntaggedFiles(tx *Tx, fileIds entities.FileIds) error {
 
 // unexported
 
+// The number of paths retrieved per query by FilesByPaths.
+const filesByPathsBatchSize = 400
+
 func readFile(rows *sql.Rows) (*entities.File, error) {
 	if !rows.Next() {
 		return nil, nil
@@ -373,6 +581,14 @@ func readFiles(rows *sql.Rows, files entities.Files) (entities.Files, error) {
 	return files, nil
 }
 
+func trailingSeparator(path string) string {
+	if strings.HasSuffix(path, string(filepath.Separator)) {
+		return path
+	}
+
+	return path + string(filepath.Separator)
+}
+
 func buildCountQuery(expression query.Expression, path string) *SqlBuilder {
 	builder := NewBuilder()
 
@@ -383,13 +599,45 @@ func buildCountQuery(expression query.Expression, path string) *SqlBuilder {
 	return builder
 }
 
-func buildQuery(expression query.Expression, path, sort string) *SqlBuilder {
+func buildQuery(expression query.Expression, path, sort string, limit uint) *SqlBuilder {
 	builder := NewBuilder()
 
 	builder.AppendSql("SELECT id, directory, name, fingerprint, mod_time, size, is_dir FROM file WHERE 1==1 AND\n")
 	buildQueryBranch(expression, builder)
 	buildPathClause(path, builder)
 	buildSort(sort, builder)
+	buildLimit(limit, builder)
+
+	return builder
+}
+
+func buildPathSetQuery(expression query.Expression, path, operation, sort string, limit uint) *SqlBuilder {
+	builder := NewBuilder()
+
+	builder.AppendSql("SELECT id, directory, name, fingerprint, mod_time, size, is_dir FROM file WHERE 1==1 AND\n")
+
+	pathSetClause := `id IN (SELECT file.id
+                             FROM file, path_set
+                             WHERE file.directory = path_set.directory AND file.name = path_set.name)`
+
+	switch operation {
+	case "intersect":
+		buildQueryBranch(expression, builder)
+		builder.AppendSql("\nAND\n" + pathSetClause + "\n")
+	case "union":
+		builder.AppendSql("(\n")
+		buildQueryBranch(expression, builder)
+		builder.AppendSql("\nOR\n" + pathSetClause + ")\n")
+	case "difference":
+		buildQueryBranch(expression, builder)
+		builder.AppendSql("\nAND NOT\n" + pathSetClause + "\n")
+	default:
+		panic("unsupported path set operation '" + operation + "'.")
+	}
+
+	buildPathClause(path, builder)
+	buildSort(sort, builder)
+	buildLimit(limit, builder)
 
 	return builder
 }
@@ -401,18 +649,37 @@ func buildQueryBranch(expression query.Expression, builder *SqlBuilder) {
 		builder.AppendParam(exp.Name)
 		builder.AppendSql(`))`)
 	case query.ComparisonExpression:
-		var valueExpression string
-		_, err := strconv.ParseFloat(exp.Value.Name, 64)
-		if err == nil {
+		var param interface{} = exp.Value.Name
+		valueExpression, operator, isDate := "name", exp.Operator, false
+		if query.IsValuePattern(exp.Value.Name) && (exp.Operator == "=" || exp.Operator == "==" || exp.Operator == "!=") {
+			// wildcard values match the value names against the pattern
+			operator = "GLOB"
+			if exp.Operator == "!=" {
+				operator = "NOT GLOB"
+			}
+		} else if _, err := strconv.ParseFloat(exp.Value.Name, 64); err == nil {
 			valueExpression = "CAST(name AS float)"
-		} else {
-			valueExpression = "name"
+		} else if date, relative, ok := query.ParseDate(exp.Value.Name, time.Now()); ok && (relative || isOrderingOperator(exp.Operator)) {
+			// dates are compared chronologically: values that are not dates do not match
+			valueExpression, isDate = "julianday(name)", true
+			if relative {
+				param = date.Format(query.DateLayout)
+			}
+		} else if quantity, kind, ok := query.ParseQuantity(exp.Value.Name); ok && isOrderingOperator(exp.Operator) {
+			// sizes and durations are compared in bytes or seconds, whatever their units
+			valueExpression, param = "quantity(name, '"+string(kind)+"')", quantity
 		}
 
 		builder.AppendSql(`id IN (SELECT file_id FROM file_tag WHERE tag_id = (SELECT id FROM tag WHERE name = `)
 		builder.AppendParam(exp.Tag.Name)
-		builder.AppendSql(`) AND value_id IN (SELECT id FROM value WHERE ` + valueExpression + ` ` + exp.Operator + ` `)
-		builder.AppendParam(exp.Value.Name)
+		builder.AppendSql(`) AND value_id IN (SELECT id FROM value WHERE ` + valueExpression + ` ` + operator + ` `)
+		if isDate {
+			builder.AppendSql(`julianday(`)
+			builder.AppendParam(param)
+			builder.AppendSql(`)`)
+		} else {
+			builder.AppendParam(param)
+		}
 		builder.AppendSql(`))`)
 	case query.NotExpression:
 		builder.AppendSql("\nNOT\n")
@@ -427,6 +694,16 @@ func buildQueryBranch(expression query.Expression, builder *SqlBuilder) {
 		builder.AppendSql("\nOR\n")
 		buildQueryBranch(exp.RightOperand, builder)
 		builder.AppendSql(")\n")
+	case query.NoteExpression:
+		builder.AppendSql(`id IN (SELECT rowid FROM file_note WHERE file_note MATCH `)
+		builder.AppendParam(exp.Text)
+		builder.AppendSql(`)`)
+	case query.ContentExpression:
+		builder.AppendSql(`id IN (SELECT rowid FROM file_content WHERE file_content MATCH `)
+		builder.AppendParam(exp.Text)
+		builder.AppendSql(`)`)
+	case query.DirectoryExpression:
+		builder.AppendSql("is_dir == 1\n")
 	case query.EmptyExpression:
 		builder.AppendSql("1 == 1\n")
 	default:
@@ -434,6 +711,15 @@ func buildQueryBranch(expression query.Expression, builder *SqlBuilder) {
 	}
 }
 
+func isOrderingOperator(operator string) bool {
+	switch operator {
+	case "<", ">", "<=", ">=":
+		return true
+	}
+
+	return false
+}
+
 func buildPathClause(path string, builder *SqlBuilder) {
 	path = filepath.Clean(path)
 
@@ -469,3 +755,10 @@ func buildSort(sort string, builder *SqlBuilder) {
 		builder.AppendSql("ORDER BY size, directory || '/' || name")
 	}
 }
+
+func buildLimit(limit uint, builder *SqlBuilder) {
+	if limit > 0 {
+		builder.AppendSql("\nLIMIT ")
+		builder.AppendParam(limit)
+	}
+}
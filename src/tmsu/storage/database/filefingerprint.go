@@ -0,0 +1,117 @@
+// Copyright 2011-2015 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package database
+
+import (
+	"tmsu/common/fingerprint"
+	"tmsu/entities"
+)
+
+// Retrieves the fingerprint of the specified file recorded for the algorithm.
+// An empty fingerprint is returned if there is none.
+func FileFingerprint(tx *Tx, fileId entities.FileId, algorithm string) (fingerprint.Fingerprint, error) {
+	sql := `SELECT fingerprint
+            FROM file_fingerprint
+            WHERE file_id = ? AND algorithm = ?`
+
+	rows, err := tx.Query(sql, fileId, algorithm)
+	if err != nil {
+		return fingerprint.Empty, err
+	}
+	defer rows.Close()
+
+	if !rows.Next() {
+		return fingerprint.Empty, rows.Err()
+	}
+
+	var fp string
+	if err := rows.Scan(&fp); err != nil {
+		return fingerprint.Empty, err
+	}
+
+	return fingerprint.Fingerprint(fp), nil
+}
+
+// Retrieves the fingerprints recorded for each file, keyed by file and then
+// by algorithm.
+func FileFingerprints(tx *Tx) (map[entities.FileId]map[string]fingerprint.Fingerprint, error) {
+	sql := `SELECT file_id, algorithm, fingerprint
+            FROM file_fingerprint`
+
+	rows, err := tx.Query(sql)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	fingerprints := make(map[entities.FileId]map[string]fingerprint.Fingerprint)
+	for rows.Next() {
+		var fileId entities.FileId
+		var algorithm, fp string
+		if err := rows.Scan(&fileId, &algorithm, &fp); err != nil {
+			return nil, err
+		}
+
+		if fingerprints[fileId] == nil {
+			fingerprints[fileId] = make(map[string]fingerprint.Fingerprint)
+		}
+		fingerprints[fileId][algorithm] = fingerprint.Fingerprint(fp)
+	}
+
+	return fingerprints, rows.Err()
+}
+
+// Records the fingerprint of the specified file for the algorithm.
+func UpdateFileFingerprint(tx *Tx, fileId entities.FileId, algorithm string, fp fingerprint.Fingerprint) error {
+	sql := `INSERT OR REPLACE INTO file_fingerprint (file_id, algorithm, fingerprint)
+            VALUES (?, ?, ?)`
+
+	_, err := tx.Exec(sql, fileId, algorithm, string(fp))
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// Records the fingerprint of every file under the specified algorithm, which
+// should be that used to calculate them.
+func PreserveFileFingerprints(tx *Tx, algorithm string) error {
+	sql := `INSERT OR REPLACE INTO file_fingerprint (file_id, algorithm, fingerprint)
+            SELECT id, ?, fingerprint
+            FROM file
+            WHERE fingerprint != ''`
+
+	_, err := tx.Exec(sql, algorithm)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// Removes the recorded fingerprints of the specified file.
+func DeleteFileFingerprints(tx *Tx, fileId entities.FileId) error {
+	sql := `DELETE FROM file_fingerprint
+            WHERE file_id = ?`
+
+	_, err := tx.Exec(sql, fileId)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
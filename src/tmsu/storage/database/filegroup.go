@@ -0,0 +1,116 @@
+// Copyright 2011-2015 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package database
+
+import (
+	"database/sql"
+	"tmsu/entities"
+)
+
+// Replaces the contents of the file set with the specified files, which
+// retain their order.
+func LoadFileSet(tx *Tx, fileIds entities.FileIds) error {
+	sql := `CREATE TEMPORARY TABLE IF NOT EXISTS file_set (
+                file_id INTEGER NOT NULL,
+                position INTEGER NOT NULL
+            )`
+
+	if _, err := tx.execTemporary(sql); err != nil {
+		return err
+	}
+
+	if _, err := tx.execTemporary(`DELETE FROM file_set`); err != nil {
+		return err
+	}
+
+	sql = `INSERT INTO file_set (file_id, position)
+           VALUES (?, ?)`
+
+	for position, fileId := range fileIds {
+		if _, err := tx.execTemporary(sql, fileId, position); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Groups the files in the file set by the tags applied to them. A file with
+// several tags is in several groups.
+func FileSetGroupsByTag(tx *Tx) (entities.FileGroups, error) {
+	sql := `SELECT tag.name, file_set.file_id
+            FROM file_set
+            INNER JOIN file_tag ON file_tag.file_id = file_set.file_id
+            INNER JOIN tag ON tag.id = file_tag.tag_id
+            GROUP BY tag.name, file_set.file_id
+            ORDER BY tag.name, min(file_set.position)`
+
+	rows, err := tx.Query(sql)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return readFileGroups(rows, make(entities.FileGroups, 0, 10))
+}
+
+// Groups the files in the file set by the values of the specified tag applied
+// to them, with those tagged without a value in a group with an empty name.
+// Files without the tag are omitted.
+func FileSetGroupsByValue(tx *Tx, tagName string) (entities.FileGroups, error) {
+	sql := `SELECT coalesce(value.name, ''), file_set.file_id
+            FROM file_set
+            INNER JOIN file_tag ON file_tag.file_id = file_set.file_id
+            INNER JOIN tag ON tag.id = file_tag.tag_id
+            LEFT OUTER JOIN value ON value.id = file_tag.value_id
+            WHERE tag.name = ?
+            GROUP BY coalesce(value.name, ''), file_set.file_id
+            ORDER BY coalesce(value.name, ''), min(file_set.position)`
+
+	rows, err := tx.Query(sql, tagName)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return readFileGroups(rows, make(entities.FileGroups, 0, 10))
+}
+
+// unexported
+
+func readFileGroups(rows *sql.Rows, groups entities.FileGroups) (entities.FileGroups, error) {
+	for rows.Next() {
+		if rows.Err() != nil {
+			return nil, rows.Err()
+		}
+
+		var name string
+		var fileId entities.FileId
+		err := rows.Scan(&name, &fileId)
+		if err != nil {
+			return nil, err
+		}
+
+		if len(groups) == 0 || groups[len(groups)-1].Name != name {
+			groups = append(groups, &entities.FileGroup{Name: name, FileIds: make(entities.FileIds, 0, 10)})
+		}
+
+		group := groups[len(groups)-1]
+		group.FileIds = append(group.FileIds, fileId)
+	}
+
+	return groups, nil
+}
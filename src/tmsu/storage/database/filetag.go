@@ -17,6 +17,7 @@ package database
 
 import (
 	"database/sql"
+	"time"
 	"tmsu/entities"
 )
 
@@ -54,7 +55,7 @@ func FileTagCount(tx *Tx) (uint, error) {
 
 // Retrieves the complete set of file tags.
 func FileTags(tx *Tx) (entities.FileTags, error) {
-	sql := `SELECT file_id, tag_id, value_id
+	sql := `SELECT file_id, tag_id, value_id, username, time
 	        FROM file_tag`
 
 	rows, err := tx.Query(sql)
@@ -66,6 +67,42 @@ func FileTags(tx *Tx) (entities.FileTags, error) {
 	return readFileTags(rows, make(entities.FileTags, 0, 10))
 }
 
+// Retrieves the file tag for the specified file, tag and value.
+func FileTag(tx *Tx, fileId entities.FileId, tagId entities.TagId, valueId entities.ValueId) (*entities.FileTag, error) {
+	sql := `SELECT file_id, tag_id, value_id, username, time
+	        FROM file_tag
+	        WHERE file_id = ?1 AND tag_id = ?2 AND value_id = ?3`
+
+	rows, err := tx.Query(sql, fileId, tagId, valueId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	fileTags, err := readFileTags(rows, make(entities.FileTags, 0, 1))
+	if err != nil || len(fileTags) == 0 {
+		return nil, err
+	}
+
+	return fileTags[0], nil
+}
+
+// Retrieves the file tags applied by the specified user, if not empty, and
+// after the specified time, if not zero.
+func FileTagsByAttribution(tx *Tx, username string, after time.Time) (entities.FileTags, error) {
+	sql := `SELECT file_id, tag_id, value_id, username, time
+	        FROM file_tag
+	        WHERE (?1 = '' OR username = ?1) AND (?2 IS NULL OR time > ?2)`
+
+	rows, err := tx.Query(sql, username, nullTime(after))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return readFileTags(rows, make(entities.FileTags, 0, 10))
+}
+
 // Retrieves the count of file tags for the specified file.
 func FileTagCountByFileId(tx *Tx, fileId entities.FileId) (uint, error) {
 	var sql string
@@ -102,7 +139,7 @@ func FileTagCountByTagId(tx *Tx, tagId entities.TagId) (uint, error) {
 
 // Retrieves the set of file tags with the specified tag ID.
 func FileTagsByTagId(tx *Tx, tagId entities.TagId) (entities.FileTags, error) {
-	sql := `SELECT file_id, tag_id, value_id
+	sql := `SELECT file_id, tag_id, value_id, username, time
 	        FROM file_tag
 	        WHERE tag_id = ?1`
 
@@ -134,7 +171,7 @@ func FileTagCountByValueId(tx *Tx, valueId entities.ValueId) (uint, error) {
 
 // Retrieves the set of file tags with the specified value ID.
 func FileTagsByValueId(tx *Tx, valueId entities.ValueId) (entities.FileTags, error) {
-	sql := `SELECT file_id, tag_id, value_id
+	sql := `SELECT file_id, tag_id, value_id, username, time
 	        FROM file_tag
 	        WHERE value_id = ?1`
 
@@ -149,7 +186,7 @@ func FileTagsByValueId(tx *Tx, valueId entities.ValueId) (entities.FileTags, err
 
 // Retrieves the set of file tags for the specified file.
 func FileTagsByFileId(tx *Tx, fileId entities.FileId) (entities.FileTags, error) {
-	sql := `SELECT file_id, tag_id, value_id
+	sql := `SELECT file_id, tag_id, value_id, username, time
             FROM file_tag
             WHERE file_id = ?1`
 
@@ -162,17 +199,60 @@ func FileTagsByFileId(tx *Tx, fileId entities.FileId) (entities.FileTags, error)
 	return readFileTags(rows, make(entities.FileTags, 0, 10))
 }
 
-// Adds a file tag.
-func AddFileTag(tx *Tx, fileId entities.FileId, tagId entities.TagId, valueId entities.ValueId) (*entities.FileTag, error) {
-	sql := `INSERT OR IGNORE INTO file_tag (file_id, tag_id, value_id)
-            VALUES (?1, ?2, ?3)`
+// Adds a file tag, attributed to the specified user.
+func AddFileTag(tx *Tx, fileId entities.FileId, tagId entities.TagId, valueId entities.ValueId, username string, time time.Time) (*entities.FileTag, error) {
+	sql := `INSERT OR IGNORE INTO file_tag (file_id, tag_id, value_id, username, time)
+            VALUES (?1, ?2, ?3, ?4, ?5)`
 
-	_, err := tx.Exec(sql, fileId, tagId, valueId)
+	_, err := tx.Exec(sql, fileId, tagId, valueId, username, nullTime(time))
 	if err != nil {
 		return nil, err
 	}
 
-	return &entities.FileTag{fileId, tagId, valueId, true, false}, nil
+	return &entities.FileTag{fileId, tagId, valueId, true, false, username, time}, nil
+}
+
+// The number of rows inserted by each statement of AddFileTags, which keeps
+// the number of parameters within SQLite's limit.
+const fileTagInsertBatchSize = 100
+
+// Adds file tags for the specified file with multi-row statements, ignoring
+// those that already exist.
+func AddFileTags(tx *Tx, fileId entities.FileId, pairs []entities.TagValuePair, username string, time time.Time) error {
+	for len(pairs) > 0 {
+		batch := pairs
+		if len(batch) > fileTagInsertBatchSize {
+			batch = batch[:fileTagInsertBatchSize]
+		}
+		pairs = pairs[len(batch):]
+
+		builder := NewBuilder()
+		builder.AppendSql(`INSERT INTO file_tag (file_id, tag_id, value_id, username, time)
+                           VALUES `)
+
+		for index, pair := range batch {
+			if index > 0 {
+				builder.AppendSql(",")
+			}
+
+			builder.AppendSql("(")
+			builder.AppendParam(fileId)
+			builder.AppendParam(pair.TagId)
+			builder.AppendParam(pair.ValueId)
+			builder.AppendParam(username)
+			builder.AppendParam(nullTime(time))
+			builder.AppendSql(")")
+		}
+
+		builder.AppendSql(`
+                           ON CONFLICT (file_id, tag_id, value_id) DO NOTHING`)
+
+		if _, err := tx.Exec(builder.Sql, builder.Params...); err != nil {
+			return err
+		}
+	}
+
+	return nil
 }
 
 // Removes a file tag.
@@ -196,7 +276,7 @@ func DeleteFileTag(tx *Tx, fileId entities.FileId, tagId entities.TagId, valueId
 		panic("expected only one row to be affected.")
 	}
 
-	return nil
+	return DeleteFileTagExpiry(tx, fileId, tagId, valueId)
 }
 
 // Removes all of the file tags for the specified file.
@@ -209,6 +289,14 @@ func DeleteFileTagsByFileId(tx *Tx, fileId entities.FileId) error {
 		return err
 	}
 
+	sql = `DELETE FROM file_tag_expiry
+           WHERE file_id = ?`
+
+	_, err = tx.Exec(sql, fileId)
+	if err != nil {
+		return err
+	}
+
 	return nil
 }
 
@@ -222,17 +310,26 @@ func DeleteFileTagsByTagId(tx *Tx, tagId entities.TagId) error {
 		return err
 	}
 
+	sql = `DELETE FROM file_tag_expiry
+           WHERE tag_id = ?`
+
+	_, err = tx.Exec(sql, tagId)
+	if err != nil {
+		return err
+	}
+
 	return nil
 }
 
-// Copies file tags from one tag to another.
-func CopyFileTags(tx *Tx, sourceTagId entities.TagId, destTagId entities.TagId) error {
-	sql := `INSERT INTO file_tag (file_id, tag_id, value_id)
-            SELECT file_id, ?2, value_id
+// Copies file tags from one tag to another, attributing the copies to the
+// specified user.
+func CopyFileTags(tx *Tx, sourceTagId entities.TagId, destTagId entities.TagId, username string, time time.Time) error {
+	sql := `INSERT INTO file_tag (file_id, tag_id, value_id, username, time)
+            SELECT file_id, ?2, value_id, ?3, ?4
             FROM file_tag
             WHERE tag_id = ?1`
 
-	_, err := tx.Exec(sql, sourceTagId, destTagId)
+	_, err := tx.Exec(sql, sourceTagId, destTagId, username, nullTime(time))
 	if err != nil {
 		return err
 	}
@@ -251,13 +348,29 @@ func readFileTags(rows *sql.Rows, fileTags entities.FileTags) (entities.FileTags
 		var fileId entities.FileId
 		var tagId entities.TagId
 		var valueId entities.ValueId
-		err := rows.Scan(&fileId, &tagId, &valueId)
+		var username string
+		var tagTime *time.Time
+		err := rows.Scan(&fileId, &tagId, &valueId, &username, &tagTime)
 		if err != nil {
 			return nil, err
 		}
 
-		fileTags = append(fileTags, &entities.FileTag{entities.FileId(fileId), tagId, valueId, true, false})
+		fileTag := entities.FileTag{entities.FileId(fileId), tagId, valueId, true, false, username, time.Time{}}
+		if tagTime != nil {
+			fileTag.Time = *tagTime
+		}
+
+		fileTags = append(fileTags, &fileTag)
 	}
 
 	return fileTags, nil
 }
+
+// The value to store for a time, which is null if the time is not known.
+func nullTime(time time.Time) interface{} {
+	if time.IsZero() {
+		return nil
+	}
+
+	return time
+}
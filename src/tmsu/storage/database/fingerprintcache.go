@@ -0,0 +1,73 @@
+// Copyright 2011-2015 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package database
+
+import (
+	"time"
+	"tmsu/common/fingerprint"
+)
+
+// Retrieves the cached fingerprint of the file with the specified device and
+// inode numbers, provided its size and modification time are unchanged. An
+// empty fingerprint is returned if there is no such entry.
+func CachedFingerprint(tx *Tx, device, inode uint64, algorithm string, size int64, modTime time.Time) (fingerprint.Fingerprint, error) {
+	sql := `SELECT fingerprint
+            FROM fingerprint_cache
+            WHERE device = ? AND inode = ? AND algorithm = ? AND size = ? AND mod_time = ?`
+
+	rows, err := tx.Query(sql, int64(device), int64(inode), algorithm, size, modTime.UnixNano())
+	if err != nil {
+		return fingerprint.Empty, err
+	}
+	defer rows.Close()
+
+	if !rows.Next() {
+		return fingerprint.Empty, rows.Err()
+	}
+
+	var fp string
+	if err := rows.Scan(&fp); err != nil {
+		return fingerprint.Empty, err
+	}
+
+	return fingerprint.Fingerprint(fp), nil
+}
+
+// Records the fingerprint of the file with the specified device and inode
+// numbers, replacing any previously cached for the algorithm.
+func UpdateCachedFingerprint(tx *Tx, device, inode uint64, algorithm string, size int64, modTime time.Time, fp fingerprint.Fingerprint) error {
+	sql := `INSERT OR REPLACE INTO fingerprint_cache (device, inode, algorithm, size, mod_time, fingerprint)
+            VALUES (?, ?, ?, ?, ?, ?)`
+
+	_, err := tx.Exec(sql, int64(device), int64(inode), algorithm, size, modTime.UnixNano(), string(fp))
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// Removes all cached fingerprints.
+func ClearFingerprintCache(tx *Tx) error {
+	sql := `DELETE FROM fingerprint_cache`
+
+	_, err := tx.Exec(sql)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,91 @@
+// Copyright 2011-2015 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package database
+
+import (
+	"database/sql"
+	"time"
+	"tmsu/common/fingerprint"
+	_path "tmsu/common/path"
+	"tmsu/entities"
+)
+
+// Records a tag being applied to or removed from a file. The file, tag and
+// value names are recorded so that the history survives their deletion.
+func InsertFileTagEvent(tx *Tx, fileId entities.FileId, tagId entities.TagId, valueId entities.ValueId, tagged bool, username string, time time.Time) error {
+	sql := `INSERT INTO file_tag_history (directory, name, fingerprint, tag_name, value_name, tagged, username, time)
+            SELECT f.directory, f.name, f.fingerprint, t.name, coalesce((SELECT name FROM value WHERE id = ?3), ''), ?4, ?5, ?6
+            FROM file f, tag t
+            WHERE f.id = ?1 AND t.id = ?2`
+
+	_, err := tx.Exec(sql, fileId, tagId, valueId, tagged, username, time)
+	return err
+}
+
+// Retrieves the history of the file at the specified path, oldest first.
+func FileTagEvents(tx *Tx, path string) (entities.FileTagEvents, error) {
+	sql := `SELECT directory, name, fingerprint, tag_name, value_name, tagged, username, time
+            FROM file_tag_history
+            WHERE directory = ?1 AND name = ?2
+            ORDER BY time, rowid`
+
+	rows, err := tx.Query(sql, _path.Dir(path), _path.Base(path))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return readFileTagEvents(rows, make(entities.FileTagEvents, 0, 10))
+}
+
+// Retrieves the history of all files since the specified time, oldest first.
+func FileTagEventsSince(tx *Tx, since time.Time) (entities.FileTagEvents, error) {
+	sql := `SELECT directory, name, fingerprint, tag_name, value_name, tagged, username, time
+            FROM file_tag_history
+            WHERE time > ?1
+            ORDER BY time, rowid`
+
+	rows, err := tx.Query(sql, since)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return readFileTagEvents(rows, make(entities.FileTagEvents, 0, 10))
+}
+
+// unexported
+
+func readFileTagEvents(rows *sql.Rows, events entities.FileTagEvents) (entities.FileTagEvents, error) {
+	for rows.Next() {
+		if rows.Err() != nil {
+			return nil, rows.Err()
+		}
+
+		var event entities.FileTagEvent
+		var fp string
+		err := rows.Scan(&event.Directory, &event.Name, &fp, &event.TagName, &event.ValueName, &event.Tagged, &event.Username, &event.Time)
+		if err != nil {
+			return nil, err
+		}
+
+		event.Fingerprint = fingerprint.Fingerprint(fp)
+
+		events = append(events, &event)
+	}
+
+	return events, nil
+}
@@ -0,0 +1,71 @@
+// Copyright 2011-2015 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package database
+
+import (
+	"tmsu/entities"
+)
+
+// Retrieves the device and inode numbers the specified file had when last
+// recorded, reporting whether these were recorded.
+func FileIdentity(tx *Tx, fileId entities.FileId) (device, inode uint64, ok bool, err error) {
+	sql := `SELECT device, inode
+            FROM file_identity
+            WHERE file_id = ?`
+
+	rows, err := tx.Query(sql, fileId)
+	if err != nil {
+		return 0, 0, false, err
+	}
+	defer rows.Close()
+
+	if !rows.Next() {
+		return 0, 0, false, rows.Err()
+	}
+
+	var storedDevice, storedInode int64
+	if err := rows.Scan(&storedDevice, &storedInode); err != nil {
+		return 0, 0, false, err
+	}
+
+	return uint64(storedDevice), uint64(storedInode), true, nil
+}
+
+// Records the device and inode numbers of the specified file.
+func UpdateFileIdentity(tx *Tx, fileId entities.FileId, device, inode uint64) error {
+	sql := `INSERT OR REPLACE INTO file_identity (file_id, device, inode)
+            VALUES (?, ?, ?)`
+
+	_, err := tx.Exec(sql, fileId, int64(device), int64(inode))
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// Removes the recorded device and inode numbers of the specified file.
+func DeleteFileIdentity(tx *Tx, fileId entities.FileId) error {
+	sql := `DELETE FROM file_identity
+            WHERE file_id = ?`
+
+	_, err := tx.Exec(sql, fileId)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
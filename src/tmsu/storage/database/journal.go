@@ -0,0 +1,230 @@
+// Copyright 2011-2015 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package database
+
+import (
+	"database/sql"
+	"time"
+	"tmsu/common/fingerprint"
+	_path "tmsu/common/path"
+	"tmsu/entities"
+)
+
+// Adds an operation.
+func InsertOperation(tx *Tx, description string, time time.Time) (*entities.Operation, error) {
+	sql := `INSERT INTO operation (description, time)
+            VALUES (?, ?)`
+
+	result, err := tx.Exec(sql, description, time)
+	if err != nil {
+		return nil, err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return nil, err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return nil, err
+	}
+	if rowsAffected != 1 {
+		panic("expected exactly one row to be affected.")
+	}
+
+	return &entities.Operation{entities.OperationId(id), description, time}, nil
+}
+
+// Retrieves the most recent operations, latest first.
+func Operations(tx *Tx, count uint) (entities.Operations, error) {
+	sql := `SELECT id, description, time
+            FROM operation
+            ORDER BY id DESC
+            LIMIT ?`
+
+	rows, err := tx.Query(sql, count)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return readOperations(rows, make(entities.Operations, 0, count))
+}
+
+// Deletes an operation along with its journal entries.
+func DeleteOperation(tx *Tx, operationId entities.OperationId) error {
+	sql := `DELETE FROM journal
+            WHERE operation_id = ?`
+
+	if _, err := tx.Exec(sql, operationId); err != nil {
+		return err
+	}
+
+	sql = `DELETE FROM operation
+           WHERE id = ?`
+
+	if _, err := tx.Exec(sql, operationId); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// Deletes all but the most recent operations.
+func PruneOperations(tx *Tx, keep uint) error {
+	sql := `DELETE FROM journal
+            WHERE operation_id NOT IN (SELECT id
+                                       FROM operation
+                                       ORDER BY id DESC
+                                       LIMIT ?1)`
+
+	if _, err := tx.Exec(sql, keep); err != nil {
+		return err
+	}
+
+	sql = `DELETE FROM operation
+           WHERE id NOT IN (SELECT id
+                            FROM operation
+                            ORDER BY id DESC
+                            LIMIT ?1)`
+
+	if _, err := tx.Exec(sql, keep); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// Adds an entry to the journal of the specified operation.
+func InsertJournalEntry(tx *Tx, operationId entities.OperationId, entry entities.JournalEntry) error {
+	sql := `INSERT INTO journal (operation_id, sequence, action, file_id, tag_id, value_id, implied_tag_id, name, directory, fingerprint, mod_time, size, is_dir)
+            VALUES (?1, (SELECT coalesce(max(sequence), 0) + 1
+                         FROM journal
+                         WHERE operation_id = ?1), ?2, ?3, ?4, ?5, ?6, ?7, ?8, ?9, ?10, ?11, ?12)`
+
+	file := entry.File
+	_, err := tx.Exec(sql, operationId, entry.Action, entry.FileId, entry.TagId, entry.ValueId, entry.ImpliedTagId, entry.Name, file.Directory, string(file.Fingerprint), file.ModTime, file.Size, file.IsDir)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// Retrieves the journal entries for the specified operation, latest first.
+func JournalEntries(tx *Tx, operationId entities.OperationId) ([]entities.JournalEntry, error) {
+	sql := `SELECT action, file_id, tag_id, value_id, implied_tag_id, name, directory, fingerprint, mod_time, size, is_dir
+            FROM journal
+            WHERE operation_id = ?
+            ORDER BY sequence DESC`
+
+	rows, err := tx.Query(sql, operationId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	entries := make([]entities.JournalEntry, 0, 10)
+	for rows.Next() {
+		if rows.Err() != nil {
+			return nil, rows.Err()
+		}
+
+		var entry entities.JournalEntry
+		var fp string
+		if err := rows.Scan(&entry.Action, &entry.FileId, &entry.TagId, &entry.ValueId, &entry.ImpliedTagId, &entry.Name, &entry.File.Directory, &fp, &entry.File.ModTime, &entry.File.Size, &entry.File.IsDir); err != nil {
+			return nil, err
+		}
+
+		entry.File.Id = entry.FileId
+		entry.File.Name = entry.Name
+		entry.File.Fingerprint = fingerprint.Fingerprint(fp)
+
+		entries = append(entries, entry)
+	}
+
+	return entries, nil
+}
+
+// Reinstates a deleted file with its original identifier.
+func RestoreFile(tx *Tx, file entities.File) error {
+	sql := `INSERT INTO file (id, directory, name, fingerprint, mod_time, size, is_dir)
+            VALUES (?, ?, ?, ?, ?, ?, ?)`
+
+	_, err := tx.Exec(sql, file.Id, file.Directory, file.Name, string(file.Fingerprint), file.ModTime, file.Size, file.IsDir)
+	return err
+}
+
+// Reverts a file to its recorded state.
+func RevertFile(tx *Tx, file entities.File) error {
+	_, err := UpdateFile(tx, file.Id, _path.Join(file.Directory, file.Name), file.Fingerprint, file.ModTime, file.Size, file.IsDir)
+	return err
+}
+
+// Reinstates a deleted tag with its original identifier.
+func RestoreTag(tx *Tx, tagId entities.TagId, name string) error {
+	sql := `INSERT INTO tag (id, name)
+            VALUES (?, ?)`
+
+	_, err := tx.Exec(sql, tagId, name)
+	return err
+}
+
+// Reinstates a deleted value with its original identifier.
+func RestoreValue(tx *Tx, valueId entities.ValueId, name string) error {
+	sql := `INSERT INTO value (id, name)
+            VALUES (?, ?)`
+
+	_, err := tx.Exec(sql, valueId, name)
+	return err
+}
+
+// unexported
+
+func readOperation(rows *sql.Rows) (*entities.Operation, error) {
+	if !rows.Next() {
+		return nil, nil
+	}
+	if rows.Err() != nil {
+		return nil, rows.Err()
+	}
+
+	var id entities.OperationId
+	var description string
+	var time time.Time
+	if err := rows.Scan(&id, &description, &time); err != nil {
+		return nil, err
+	}
+
+	return &entities.Operation{id, description, time}, nil
+}
+
+func readOperations(rows *sql.Rows, operations entities.Operations) (entities.Operations, error) {
+	for {
+		operation, err := readOperation(rows)
+		if err != nil {
+			return nil, err
+		}
+		if operation == nil {
+			break
+		}
+
+		operations = append(operations, operation)
+	}
+
+	return operations, nil
+}
@@ -0,0 +1,67 @@
+// Copyright 2011-2015 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package database
+
+import (
+	"time"
+	"tmsu/entities"
+)
+
+// Retrieves the last runs of the maintenance jobs.
+func MaintenanceJobs(tx *Tx) (entities.MaintenanceJobs, error) {
+	sql := `SELECT name, last_run, result
+            FROM maintenance_job
+            ORDER BY name`
+
+	rows, err := tx.Query(sql)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	jobs := make(entities.MaintenanceJobs, 0, 3)
+	for rows.Next() {
+		var name, result string
+		var lastRun int64
+		if err := rows.Scan(&name, &lastRun, &result); err != nil {
+			return nil, err
+		}
+
+		jobs = append(jobs, &entities.MaintenanceJob{Name: name, LastRun: time.Unix(lastRun, 0), Result: result})
+	}
+
+	return jobs, rows.Err()
+}
+
+// Records the last run of the named maintenance job.
+func UpdateMaintenanceJob(tx *Tx, name string, lastRun time.Time, result string) error {
+	sql := `INSERT OR REPLACE INTO maintenance_job (name, last_run, result)
+            VALUES (?, ?, ?)`
+
+	_, err := tx.Exec(sql, name, lastRun.Unix(), result)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// Rebuilds the database file, reclaiming the space left by deleted rows. This
+// cannot be done within a transaction.
+func (database *Database) Vacuum() error {
+	_, err := database.db.Exec("VACUUM")
+	return err
+}
@@ -0,0 +1,116 @@
+// Copyright 2011-2015 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package database
+
+import (
+	"database/sql"
+	"tmsu/entities"
+)
+
+// Retrieves the note attached to the specified file, or an empty string if
+// it has none.
+func FileNote(tx *Tx, fileId entities.FileId) (string, error) {
+	sql := `SELECT text
+            FROM file_note
+            WHERE rowid = ?`
+
+	rows, err := tx.Query(sql, fileId)
+	if err != nil {
+		return "", err
+	}
+	defer rows.Close()
+
+	return readNote(rows)
+}
+
+// Retrieves the notes attached to files, keyed by file.
+func FileNotes(tx *Tx) (map[entities.FileId]string, error) {
+	sql := `SELECT rowid, text
+            FROM file_note`
+
+	rows, err := tx.Query(sql)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	notes := make(map[entities.FileId]string)
+	for rows.Next() {
+		var fileId entities.FileId
+		var text string
+		if err := rows.Scan(&fileId, &text); err != nil {
+			return nil, err
+		}
+
+		notes[fileId] = text
+	}
+
+	return notes, rows.Err()
+}
+
+// Attaches a note to the specified file, replacing any it already has.
+func UpdateFileNote(tx *Tx, fileId entities.FileId, text string) error {
+	if err := DeleteFileNote(tx, fileId); err != nil {
+		return err
+	}
+
+	if text == "" {
+		return nil
+	}
+
+	// full-text tables do not support replacing rows on conflict
+	sql := `INSERT INTO file_note (rowid, text)
+            VALUES (?, ?)`
+
+	_, err := tx.Exec(sql, fileId, text)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// Removes the note attached to the specified file.
+func DeleteFileNote(tx *Tx, fileId entities.FileId) error {
+	sql := `DELETE FROM file_note
+            WHERE rowid = ?`
+
+	_, err := tx.Exec(sql, fileId)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// unexported
+
+func readNote(rows *sql.Rows) (string, error) {
+	if !rows.Next() {
+		return "", nil
+	}
+	if rows.Err() != nil {
+		return "", rows.Err()
+	}
+
+	var text string
+	err := rows.Scan(&text)
+	if err != nil {
+		return "", err
+	}
+
+	return text, nil
+}
@@ -0,0 +1,87 @@
+// Copyright 2011-2015 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package database
+
+import (
+	"tmsu/entities"
+)
+
+// Counts the taggings, implications and exclusions that refer to files, tags or
+// values that do not exist.
+func OrphanCounts(tx *Tx) (entities.OrphanCounts, error) {
+	var counts entities.OrphanCounts
+	var err error
+
+	if counts.FileTags, err = countOrphans(tx, "file_tag", orphanedFileTagCondition); err != nil {
+		return counts, err
+	}
+
+	if counts.Implications, err = countOrphans(tx, "implication", orphanedImplicationCondition); err != nil {
+		return counts, err
+	}
+
+	if counts.Exclusions, err = countOrphans(tx, "exclusion", orphanedExclusionCondition); err != nil {
+		return counts, err
+	}
+
+	return counts, nil
+}
+
+// Deletes the taggings, implications and exclusions that refer to files, tags
+// or values that do not exist.
+func DeleteOrphans(tx *Tx) error {
+	statements := []string{
+		`DELETE FROM file_tag
+         WHERE ` + orphanedFileTagCondition,
+		`DELETE FROM implication
+         WHERE ` + orphanedImplicationCondition,
+		`DELETE FROM exclusion
+         WHERE ` + orphanedExclusionCondition,
+	}
+
+	for _, sql := range statements {
+		if _, err := tx.Exec(sql); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// unexported
+
+const orphanedFileTagCondition = `file_id NOT IN (SELECT id FROM file)
+            OR tag_id NOT IN (SELECT id FROM tag)
+            OR (value_id != 0 AND value_id NOT IN (SELECT id FROM value))`
+
+const orphanedImplicationCondition = `tag_id NOT IN (SELECT id FROM tag)
+            OR implied_tag_id NOT IN (SELECT id FROM tag)`
+
+const orphanedExclusionCondition = `tag_id NOT IN (SELECT id FROM tag)`
+
+func countOrphans(tx *Tx, table, condition string) (uint, error) {
+	sql := `SELECT count(1)
+            FROM ` + table + `
+            WHERE ` + condition
+
+	rows, err := tx.Query(sql)
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	return readCount(rows)
+}
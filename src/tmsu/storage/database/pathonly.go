@@ -0,0 +1,93 @@
+// Copyright 2011-2015 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package database
+
+import (
+	"tmsu/entities"
+)
+
+// Determines whether the specified file is tracked by path only.
+func FilePathOnly(tx *Tx, fileId entities.FileId) (bool, error) {
+	sql := `SELECT 1
+            FROM file_path_only
+            WHERE file_id = ?`
+
+	rows, err := tx.Query(sql, fileId)
+	if err != nil {
+		return false, err
+	}
+	defer rows.Close()
+
+	if !rows.Next() {
+		return false, rows.Err()
+	}
+
+	return true, nil
+}
+
+// Retrieves the set of files that are tracked by path only.
+func PathOnlyFiles(tx *Tx) (map[entities.FileId]bool, error) {
+	sql := `SELECT file_id
+            FROM file_path_only`
+
+	rows, err := tx.Query(sql)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	fileIds := make(map[entities.FileId]bool)
+	for rows.Next() {
+		var fileId entities.FileId
+		if err := rows.Scan(&fileId); err != nil {
+			return nil, err
+		}
+
+		fileIds[fileId] = true
+	}
+
+	return fileIds, rows.Err()
+}
+
+// Records whether the specified file is tracked by path only.
+func UpdateFilePathOnly(tx *Tx, fileId entities.FileId, pathOnly bool) error {
+	if !pathOnly {
+		return DeleteFilePathOnly(tx, fileId)
+	}
+
+	sql := `INSERT OR IGNORE INTO file_path_only (file_id)
+            VALUES (?)`
+
+	_, err := tx.Exec(sql, fileId)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// Removes the path-only marker for the specified file.
+func DeleteFilePathOnly(tx *Tx, fileId entities.FileId) error {
+	sql := `DELETE FROM file_path_only
+            WHERE file_id = ?`
+
+	_, err := tx.Exec(sql, fileId)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,87 @@
+// Copyright 2011-2015 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package database
+
+import (
+	"time"
+	"tmsu/entities"
+)
+
+// Retrieves the queued tags, ordered by path.
+func PendingTags(tx *Tx) (entities.PendingTags, error) {
+	sql := `SELECT path, tag, value, queued
+            FROM pending_tag
+            ORDER BY path, queued, tag, value`
+
+	rows, err := tx.Query(sql)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	pendingTags := make(entities.PendingTags, 0, 10)
+	for rows.Next() {
+		var path, tag, value string
+		var queued int64
+		if err := rows.Scan(&path, &tag, &value, &queued); err != nil {
+			return nil, err
+		}
+
+		pendingTags = append(pendingTags, &entities.PendingTag{Path: path, Tag: tag, Value: value, Queued: time.Unix(queued, 0)})
+	}
+
+	return pendingTags, rows.Err()
+}
+
+// Retrieves the number of queued tags.
+func PendingTagCount(tx *Tx) (uint, error) {
+	sql := `SELECT count(1)
+            FROM pending_tag`
+
+	rows, err := tx.Query(sql)
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	return readCount(rows)
+}
+
+// Queues a tag for the file at the specified path.
+func InsertPendingTag(tx *Tx, path, tag, value string, queued time.Time) error {
+	sql := `INSERT OR REPLACE INTO pending_tag (path, tag, value, queued)
+            VALUES (?, ?, ?, ?)`
+
+	_, err := tx.Exec(sql, path, tag, value, queued.Unix())
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// Removes the tags queued for the file at the specified path.
+func DeletePendingTags(tx *Tx, path string) error {
+	sql := `DELETE FROM pending_tag
+            WHERE path = ?`
+
+	_, err := tx.Exec(sql, path)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,56 @@
+// Copyright 2011-2015 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package database
+
+// Removes the tags, values, files, taggings, implications, exclusions, queries
+// and settings, along with the undo journal that refers to them, so that they
+// can be rebuilt. The tag history, synchronisation state and database
+// identifier are kept.
+func Clear(tx *Tx) error {
+	statements := []string{
+		`DELETE FROM journal`,
+		`DELETE FROM operation`,
+		`DELETE FROM file_tag`,
+		`DELETE FROM file_tag_expiry`,
+		`DELETE FROM file_volume`,
+		`DELETE FROM file_identity`,
+		`DELETE FROM file_path_only`,
+		`DELETE FROM file_virtual`,
+		`DELETE FROM file_fingerprint`,
+		`DELETE FROM checkpoint`,
+		`DELETE FROM maintenance_job`,
+		`DELETE FROM pending_tag`,
+		`DELETE FROM fingerprint_cache`,
+		`DELETE FROM file_note`,
+		`DELETE FROM file_content`,
+		`DELETE FROM file`,
+		`DELETE FROM implication`,
+		`DELETE FROM exclusion`,
+		`DELETE FROM tag`,
+		`DELETE FROM value`,
+		`DELETE FROM query`,
+		`DELETE FROM setting
+         WHERE name != 'databaseId'`,
+	}
+
+	for _, sql := range statements {
+		if _, err := tx.Exec(sql); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -24,7 +24,7 @@ import (
 
 // unexported
 
-var latestSchemaVersion = common.Version{0, 5, 0}
+var latestSchemaVersion = common.Version{0, 6, 16}
 
 func schemaVersion(tx *sql.Tx) common.Version {
 	sql := `SELECT major, minor, patch
@@ -103,6 +103,70 @@ func createSchema(tx *sql.Tx) error {
 		return err
 	}
 
+	if err := createExclusionTable(tx); err != nil {
+		return err
+	}
+
+	if err := createFileVolumeTable(tx); err != nil {
+		return err
+	}
+
+	if err := createFileIdentityTable(tx); err != nil {
+		return err
+	}
+
+	if err := createFileTagExpiryTable(tx); err != nil {
+		return err
+	}
+
+	if err := createMaintenanceJobTable(tx); err != nil {
+		return err
+	}
+
+	if err := createPendingTagTable(tx); err != nil {
+		return err
+	}
+
+	if err := createFilePathOnlyTable(tx); err != nil {
+		return err
+	}
+
+	if err := createFileVirtualTable(tx); err != nil {
+		return err
+	}
+
+	if err := createFingerprintCacheTable(tx); err != nil {
+		return err
+	}
+
+	if err := createFileFingerprintTable(tx); err != nil {
+		return err
+	}
+
+	if err := createCheckpointTable(tx); err != nil {
+		return err
+	}
+
+	if err := createJournalTables(tx); err != nil {
+		return err
+	}
+
+	if err := createFileTagHistoryTable(tx); err != nil {
+		return err
+	}
+
+	if err := createSyncPeerTable(tx); err != nil {
+		return err
+	}
+
+	if err := createFileNoteTable(tx); err != nil {
+		return err
+	}
+
+	if err := createFileContentTable(tx); err != nil {
+		return err
+	}
+
 	if err := createQueryTable(tx); err != nil {
 		return err
 	}
@@ -187,6 +251,8 @@ func createFileTagTable(tx *sql.Tx) error {
                 file_id INTEGER NOT NULL,
                 tag_id INTEGER NOT NULL,
                 value_id INTEGER NOT NULL,
+                username TEXT NOT NULL DEFAULT '',
+                time DATETIME,
                 PRIMARY KEY (file_id, tag_id, value_id),
                 FOREIGN KEY (file_id) REFERENCES file(id),
                 FOREIGN KEY (tag_id) REFERENCES tag(id)
@@ -221,6 +287,91 @@ func createFileTagTable(tx *sql.Tx) error {
 	return nil
 }
 
+func addFileTagAttribution(tx *sql.Tx) error {
+	exists, err := columnExists(tx, "file_tag", "username")
+	if err != nil {
+		return err
+	}
+	if exists {
+		return nil
+	}
+
+	sql := `ALTER TABLE file_tag
+            ADD COLUMN username TEXT NOT NULL DEFAULT ''`
+
+	if _, err := tx.Exec(sql); err != nil {
+		return err
+	}
+
+	sql = `ALTER TABLE file_tag
+           ADD COLUMN time DATETIME`
+
+	if _, err := tx.Exec(sql); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func createFileTagHistoryTable(tx *sql.Tx) error {
+	sql := `CREATE TABLE IF NOT EXISTS file_tag_history (
+                directory TEXT NOT NULL,
+                name TEXT NOT NULL,
+                fingerprint TEXT NOT NULL DEFAULT '',
+                tag_name TEXT NOT NULL,
+                value_name TEXT NOT NULL,
+                tagged BOOLEAN NOT NULL,
+                username TEXT NOT NULL,
+                time DATETIME NOT NULL
+            )`
+
+	if _, err := tx.Exec(sql); err != nil {
+		return err
+	}
+
+	sql = `CREATE INDEX IF NOT EXISTS idx_file_tag_history_path
+           ON file_tag_history(directory, name)`
+
+	if _, err := tx.Exec(sql); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func addFileTagHistoryFingerprint(tx *sql.Tx) error {
+	exists, err := columnExists(tx, "file_tag_history", "fingerprint")
+	if err != nil {
+		return err
+	}
+	if exists {
+		return nil
+	}
+
+	sql := `ALTER TABLE file_tag_history
+            ADD COLUMN fingerprint TEXT NOT NULL DEFAULT ''`
+
+	if _, err := tx.Exec(sql); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func createSyncPeerTable(tx *sql.Tx) error {
+	sql := `CREATE TABLE IF NOT EXISTS sync_peer (
+                database_id TEXT PRIMARY KEY,
+                sent_until DATETIME NOT NULL,
+                received_until DATETIME NOT NULL
+            )`
+
+	if _, err := tx.Exec(sql); err != nil {
+		return err
+	}
+
+	return nil
+}
+
 func createImplicationTable(tx *sql.Tx) error {
 	sql := `CREATE TABLE IF NOT EXISTS implication (
                 tag_id INTEGER NOT NULL,
@@ -235,6 +386,270 @@ func createImplicationTable(tx *sql.Tx) error {
 	return nil
 }
 
+func createExclusionTable(tx *sql.Tx) error {
+	sql := `CREATE TABLE IF NOT EXISTS exclusion (
+                name TEXT NOT NULL,
+                tag_id INTEGER NOT NULL,
+                PRIMARY KEY (name, tag_id)
+            )`
+
+	if _, err := tx.Exec(sql); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func createJournalTables(tx *sql.Tx) error {
+	sql := `CREATE TABLE IF NOT EXISTS operation (
+                id INTEGER PRIMARY KEY,
+                description TEXT NOT NULL,
+                time DATETIME NOT NULL
+            )`
+
+	if _, err := tx.Exec(sql); err != nil {
+		return err
+	}
+
+	sql = `CREATE TABLE IF NOT EXISTS journal (
+               operation_id INTEGER NOT NULL,
+               sequence INTEGER NOT NULL,
+               action TEXT NOT NULL,
+               file_id INTEGER NOT NULL,
+               tag_id INTEGER NOT NULL,
+               value_id INTEGER NOT NULL,
+               implied_tag_id INTEGER NOT NULL,
+               name TEXT NOT NULL,
+               directory TEXT NOT NULL,
+               fingerprint TEXT NOT NULL,
+               mod_time DATETIME NOT NULL,
+               size INTEGER NOT NULL,
+               is_dir BOOLEAN NOT NULL,
+               PRIMARY KEY (operation_id, sequence),
+               FOREIGN KEY (operation_id) REFERENCES operation(id)
+           )`
+
+	if _, err := tx.Exec(sql); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func createFileVolumeTable(tx *sql.Tx) error {
+	sql := `CREATE TABLE IF NOT EXISTS file_volume (
+                file_id INTEGER PRIMARY KEY,
+                volume TEXT NOT NULL,
+                FOREIGN KEY (file_id) REFERENCES file(id)
+            )`
+
+	if _, err := tx.Exec(sql); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// Creates the table of the device and inode numbers of files, by which a file
+// replaced at the same path, as editors do when saving, is recognised.
+func createFileIdentityTable(tx *sql.Tx) error {
+	sql := `CREATE TABLE IF NOT EXISTS file_identity (
+                file_id INTEGER PRIMARY KEY,
+                device INTEGER NOT NULL,
+                inode INTEGER NOT NULL,
+                FOREIGN KEY (file_id) REFERENCES file(id)
+            )`
+
+	if _, err := tx.Exec(sql); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// Creates the table of the times at which file tags are to be removed, as Unix
+// times in seconds.
+func createFileTagExpiryTable(tx *sql.Tx) error {
+	sql := `CREATE TABLE IF NOT EXISTS file_tag_expiry (
+                file_id INTEGER NOT NULL,
+                tag_id INTEGER NOT NULL,
+                value_id INTEGER NOT NULL,
+                expires INTEGER NOT NULL,
+                PRIMARY KEY (file_id, tag_id, value_id)
+            )`
+
+	if _, err := tx.Exec(sql); err != nil {
+		return err
+	}
+
+	sql = `CREATE INDEX IF NOT EXISTS idx_file_tag_expiry_expires
+           ON file_tag_expiry(expires)`
+
+	if _, err := tx.Exec(sql); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// Creates the table of the last runs of the scheduled maintenance jobs, as Unix
+// times in seconds, with their results.
+func createMaintenanceJobTable(tx *sql.Tx) error {
+	sql := `CREATE TABLE IF NOT EXISTS maintenance_job (
+                name TEXT PRIMARY KEY,
+                last_run INTEGER NOT NULL,
+                result TEXT NOT NULL
+            )`
+
+	if _, err := tx.Exec(sql); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// Creates the table of the tags queued for files that could not yet be tagged,
+// by the paths of the files and the names of the tags and values.
+func createPendingTagTable(tx *sql.Tx) error {
+	sql := `CREATE TABLE IF NOT EXISTS pending_tag (
+                path TEXT NOT NULL,
+                tag TEXT NOT NULL,
+                value TEXT NOT NULL,
+                queued INTEGER NOT NULL,
+                PRIMARY KEY (path, tag, value)
+            )`
+
+	if _, err := tx.Exec(sql); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// Creates the table of files that are tracked by path only, i.e. that are
+// neither fingerprinted nor checked for modification.
+func createFilePathOnlyTable(tx *sql.Tx) error {
+	sql := `CREATE TABLE IF NOT EXISTS file_path_only (
+                file_id INTEGER PRIMARY KEY,
+                FOREIGN KEY (file_id) REFERENCES file(id)
+            )`
+
+	if _, err := tx.Exec(sql); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// Creates the table of virtual files: entries tracked although they do not
+// exist, such as files that are expected to arrive.
+func createFileVirtualTable(tx *sql.Tx) error {
+	sql := `CREATE TABLE IF NOT EXISTS file_virtual (
+                file_id INTEGER PRIMARY KEY,
+                FOREIGN KEY (file_id) REFERENCES file(id)
+            )`
+
+	if _, err := tx.Exec(sql); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// Creates the table of checkpoints recording the progress of long-running
+// operations, such as repair, so that they can resume once interrupted.
+func createCheckpointTable(tx *sql.Tx) error {
+	sql := `CREATE TABLE IF NOT EXISTS checkpoint (
+                name TEXT PRIMARY KEY,
+                position TEXT NOT NULL
+            )`
+
+	if _, err := tx.Exec(sql); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// Creates the table of fingerprints calculated for files by algorithms other
+// than that of the file's own fingerprint.
+func createFileFingerprintTable(tx *sql.Tx) error {
+	sql := `CREATE TABLE IF NOT EXISTS file_fingerprint (
+                file_id INTEGER NOT NULL,
+                algorithm TEXT NOT NULL,
+                fingerprint TEXT NOT NULL,
+                PRIMARY KEY (file_id, algorithm),
+                FOREIGN KEY (file_id) REFERENCES file(id)
+            )`
+
+	if _, err := tx.Exec(sql); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// Creates the table of fingerprints keyed by the device and inode numbers of
+// the files they were calculated for, so that unchanged files need not be
+// hashed again. The modification time is held in nanoseconds.
+func createFingerprintCacheTable(tx *sql.Tx) error {
+	sql := `CREATE TABLE IF NOT EXISTS fingerprint_cache (
+                device INTEGER NOT NULL,
+                inode INTEGER NOT NULL,
+                algorithm TEXT NOT NULL,
+                size INTEGER NOT NULL,
+                mod_time INTEGER NOT NULL,
+                fingerprint TEXT NOT NULL,
+                PRIMARY KEY (device, inode, algorithm)
+            )`
+
+	if _, err := tx.Exec(sql); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// Creates the full-text table of file notes, keyed by file identifier. FTS5 is
+// used where SQLite was built with it, otherwise FTS4.
+func createFileNoteTable(tx *sql.Tx) error {
+	sql := `CREATE VIRTUAL TABLE IF NOT EXISTS file_note
+            USING fts5 (text)`
+
+	if _, err := tx.Exec(sql); err == nil {
+		return nil
+	}
+
+	sql = `CREATE VIRTUAL TABLE IF NOT EXISTS file_note
+           USING fts4 (text)`
+
+	if _, err := tx.Exec(sql); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// Creates the full-text table of the text extracted from files by the content
+// indexer, keyed by file identifier.
+func createFileContentTable(tx *sql.Tx) error {
+	sql := `CREATE VIRTUAL TABLE IF NOT EXISTS file_content
+            USING fts5 (text)`
+
+	if _, err := tx.Exec(sql); err == nil {
+		return nil
+	}
+
+	sql = `CREATE VIRTUAL TABLE IF NOT EXISTS file_content
+           USING fts4 (text)`
+
+	if _, err := tx.Exec(sql); err != nil {
+		return err
+	}
+
+	return nil
+}
+
 func createQueryTable(tx *sql.Tx) error {
 	sql := `CREATE TABLE IF NOT EXISTS query (
                 text TEXT PRIMARY KEY
@@ -274,3 +689,16 @@ func createVersionTable(tx *sql.Tx) error {
 
 	return nil
 }
+
+func columnExists(tx *sql.Tx, table, column string) (bool, error) {
+	sql := `SELECT count(1)
+            FROM pragma_table_info(?)
+            WHERE name = ?`
+
+	var count uint
+	if err := tx.QueryRow(sql, table, column).Scan(&count); err != nil {
+		return false, err
+	}
+
+	return count > 0, nil
+}
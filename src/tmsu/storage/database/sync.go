@@ -0,0 +1,55 @@
+// Copyright 2011-2015 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package database
+
+import (
+	"time"
+	"tmsu/entities"
+)
+
+// Retrieves the synchronisation state for the specified database, or nil if
+// it has not been synchronised with.
+func SyncPeer(tx *Tx, databaseId string) (*entities.SyncPeer, error) {
+	sql := `SELECT sent_until, received_until
+            FROM sync_peer
+            WHERE database_id = ?`
+
+	rows, err := tx.Query(sql, databaseId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	if !rows.Next() {
+		return nil, rows.Err()
+	}
+
+	var sentUntil, receivedUntil time.Time
+	if err := rows.Scan(&sentUntil, &receivedUntil); err != nil {
+		return nil, err
+	}
+
+	return &entities.SyncPeer{databaseId, sentUntil, receivedUntil}, nil
+}
+
+// Records the synchronisation state for a database.
+func UpdateSyncPeer(tx *Tx, peer entities.SyncPeer) error {
+	sql := `INSERT OR REPLACE INTO sync_peer (database_id, sent_until, received_until)
+            VALUES (?, ?, ?)`
+
+	_, err := tx.Exec(sql, peer.DatabaseId, peer.SentUntil, peer.ReceivedUntil)
+	return err
+}
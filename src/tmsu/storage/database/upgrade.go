@@ -53,6 +53,112 @@ func upgrade(tx *sql.Tx) error {
 		}
 	}
 
+	if version.LessThan(common.Version{0, 6, 0}) {
+		if err := createFileVolumeTable(tx); err != nil {
+			return err
+		}
+	}
+
+	if version.LessThan(common.Version{0, 6, 1}) {
+		if err := createJournalTables(tx); err != nil {
+			return err
+		}
+	}
+
+	if version.LessThan(common.Version{0, 6, 2}) {
+		if err := addFileTagAttribution(tx); err != nil {
+			return err
+		}
+	}
+
+	if version.LessThan(common.Version{0, 6, 3}) {
+		if err := createFileTagHistoryTable(tx); err != nil {
+			return err
+		}
+	}
+
+	if version.LessThan(common.Version{0, 6, 4}) {
+		if err := addFileTagHistoryFingerprint(tx); err != nil {
+			return err
+		}
+
+		if err := createSyncPeerTable(tx); err != nil {
+			return err
+		}
+	}
+
+	if version.LessThan(common.Version{0, 6, 5}) {
+		if err := createFileNoteTable(tx); err != nil {
+			return err
+		}
+	}
+
+	if version.LessThan(common.Version{0, 6, 6}) {
+		if err := createFileContentTable(tx); err != nil {
+			return err
+		}
+	}
+
+	if version.LessThan(common.Version{0, 6, 7}) {
+		if err := createExclusionTable(tx); err != nil {
+			return err
+		}
+	}
+
+	if version.LessThan(common.Version{0, 6, 8}) {
+		if err := createFilePathOnlyTable(tx); err != nil {
+			return err
+		}
+	}
+
+	if version.LessThan(common.Version{0, 6, 9}) {
+		if err := createFingerprintCacheTable(tx); err != nil {
+			return err
+		}
+	}
+
+	if version.LessThan(common.Version{0, 6, 10}) {
+		if err := createFileFingerprintTable(tx); err != nil {
+			return err
+		}
+	}
+
+	if version.LessThan(common.Version{0, 6, 11}) {
+		if err := createFileVirtualTable(tx); err != nil {
+			return err
+		}
+	}
+
+	if version.LessThan(common.Version{0, 6, 12}) {
+		if err := createCheckpointTable(tx); err != nil {
+			return err
+		}
+	}
+
+	if version.LessThan(common.Version{0, 6, 13}) {
+		if err := createFileIdentityTable(tx); err != nil {
+			return err
+		}
+	}
+
+	if version.LessThan(common.Version{0, 6, 14}) {
+		if err := createFileTagExpiryTable(tx); err != nil {
+			return err
+		}
+	}
+
+	if version.LessThan(common.Version{0, 6, 15}) {
+		if err := createMaintenanceJobTable(tx); err != nil {
+			return err
+		}
+	}
+
+	if version.LessThan(common.Version{0, 6, 16}) {
+		if err := createPendingTagTable(tx); err != nil {
+			return err
+		}
+	}
+
 	if err := updateSchemaVersion(tx, latestSchemaVersion); err != nil {
 		return err
 	}
@@ -173,6 +173,44 @@ func ValuesByTagId(tx *Tx, tagId entities.TagId) (entities.Values, error) {
 	return readValues(rows, make(entities.Values, 0, 10))
 }
 
+// Retrieves the usage of each value of the specified tag: the number of files
+// tagged with the tag and value.
+func ValueUsageByTagId(tx *Tx, tagId entities.TagId) ([]entities.ValueFileCount, error) {
+	sql := `SELECT v.id, v.name, count(file_id)
+            FROM file_tag ft, value v
+            WHERE ft.tag_id = ?1 AND ft.value_id = v.id
+            GROUP BY v.id
+            ORDER BY v.name`
+
+	rows, err := tx.Query(sql, tagId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	values := make([]entities.ValueFileCount, 0, 10)
+	for {
+		if !rows.Next() {
+			break
+		}
+		if rows.Err() != nil {
+			return nil, rows.Err()
+		}
+
+		var valueId entities.ValueId
+		var name string
+		var count uint
+		err := rows.Scan(&valueId, &name, &count)
+		if err != nil {
+			return nil, err
+		}
+
+		values = append(values, entities.ValueFileCount{Id: valueId, Name: name, FileCount: count})
+	}
+
+	return values, nil
+}
+
 // Adds a value.
 func InsertValue(tx *Tx, name string) (*entities.Value, error) {
 	sql := `INSERT INTO value (name)
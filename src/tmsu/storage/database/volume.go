@@ -0,0 +1,110 @@
+// Copyright 2011-2015 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package database
+
+import (
+	"database/sql"
+	"tmsu/entities"
+)
+
+// Retrieves the identifier of the volume the specified file was on when last recorded.
+func FileVolume(tx *Tx, fileId entities.FileId) (string, error) {
+	sql := `SELECT volume
+            FROM file_volume
+            WHERE file_id = ?`
+
+	rows, err := tx.Query(sql, fileId)
+	if err != nil {
+		return "", err
+	}
+	defer rows.Close()
+
+	return readVolume(rows)
+}
+
+// Retrieves the volume identifiers of all files, keyed by file.
+func FileVolumes(tx *Tx) (map[entities.FileId]string, error) {
+	sql := `SELECT file_id, volume
+            FROM file_volume`
+
+	rows, err := tx.Query(sql)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	volumes := make(map[entities.FileId]string)
+	for rows.Next() {
+		var fileId entities.FileId
+		var volume string
+		if err := rows.Scan(&fileId, &volume); err != nil {
+			return nil, err
+		}
+
+		volumes[fileId] = volume
+	}
+
+	return volumes, rows.Err()
+}
+
+// Records the identifier of the volume the specified file is on.
+func UpdateFileVolume(tx *Tx, fileId entities.FileId, volume string) error {
+	if volume == "" {
+		return DeleteFileVolume(tx, fileId)
+	}
+
+	sql := `INSERT OR REPLACE INTO file_volume (file_id, volume)
+            VALUES (?, ?)`
+
+	_, err := tx.Exec(sql, fileId, volume)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// Removes the volume identifier for the specified file.
+func DeleteFileVolume(tx *Tx, fileId entities.FileId) error {
+	sql := `DELETE FROM file_volume
+            WHERE file_id = ?`
+
+	_, err := tx.Exec(sql, fileId)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// unexported
+
+func readVolume(rows *sql.Rows) (string, error) {
+	if !rows.Next() {
+		return "", nil
+	}
+	if rows.Err() != nil {
+		return "", rows.Err()
+	}
+
+	var volume string
+	err := rows.Scan(&volume)
+	if err != nil {
+		return "", err
+	}
+
+	return volume, nil
+}
@@ -0,0 +1,37 @@
+// Copyright 2011-2015 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package storage
+
+import (
+	"fmt"
+	"tmsu/entities"
+)
+
+// A Diagnoser is a BackendTx that can describe how its data is stored.
+type Diagnoser interface {
+	DatabaseStatistics() (*entities.DatabaseStatistics, error)
+}
+
+// Retrieves the statistics of the database's storage, for diagnosing
+// performance problems and corruption.
+func (storage *Storage) DatabaseStatistics(tx *Tx) (*entities.DatabaseStatistics, error) {
+	diagnoser, ok := tx.tx.(Diagnoser)
+	if !ok {
+		return nil, fmt.Errorf("statistics are not available for this database backend")
+	}
+
+	return diagnoser.DatabaseStatistics()
+}
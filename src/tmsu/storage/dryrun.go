@@ -0,0 +1,66 @@
+// Copyright 2011-2015 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package storage
+
+import (
+	"fmt"
+	"tmsu/common/log"
+	"tmsu/entities"
+)
+
+// unexported
+
+// Reports a change that would have been made had this not been a dry run.
+func (storage Storage) report(format string, values ...interface{}) {
+	log.Infof(0, "dry run: would "+format, values...)
+}
+
+func (storage Storage) describeFile(tx *Tx, fileId entities.FileId) string {
+	file, err := tx.tx.File(fileId)
+	if err != nil || file == nil {
+		return fmt.Sprintf("#%v", fileId)
+	}
+
+	storage.absPath(file)
+
+	return file.Path()
+}
+
+func (storage Storage) describeTag(tx *Tx, tagId entities.TagId) string {
+	tag, err := tx.tx.Tag(tagId)
+	if err != nil || tag == nil {
+		return fmt.Sprintf("#%v", tagId)
+	}
+
+	return tag.Name
+}
+
+func (storage Storage) describeValue(tx *Tx, valueId entities.ValueId) string {
+	value, err := tx.tx.Value(valueId)
+	if err != nil || value == nil {
+		return fmt.Sprintf("#%v", valueId)
+	}
+
+	return value.Name
+}
+
+func (storage Storage) describeTagValue(tx *Tx, tagId entities.TagId, valueId entities.ValueId) string {
+	if valueId == 0 {
+		return storage.describeTag(tx, tagId)
+	}
+
+	return storage.describeTag(tx, tagId) + "=" + storage.describeValue(tx, valueId)
+}
@@ -0,0 +1,306 @@
+// Copyright 2011-2015 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package storage
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"tmsu/common/encryption"
+	"tmsu/common/log"
+	"tmsu/storage/database"
+)
+
+// Supplies the passphrase of the encrypted database at the specified path,
+// e.g. by prompting for it. Encrypted databases cannot be opened if unset.
+var PassphraseFunc func(path string) ([]byte, error)
+
+// Encrypts the database with the specified passphrase or, if it is nil,
+// decrypts it. Encrypting an encrypted database changes its passphrase. The
+// database is rewritten when the storage is closed.
+func (storage *Storage) SetPassphrase(passphrase []byte) error {
+	if backendName, _ := ParseLocation(storage.DbPath); backendName != DefaultBackend {
+		return fmt.Errorf("only SQLite databases can be encrypted")
+	}
+
+	if storage.DryRun {
+		if passphrase == nil {
+			storage.report("decrypt the database")
+		} else {
+			storage.report("encrypt the database")
+		}
+
+		return nil
+	}
+
+	if backend, ok := storage.backend.(*encryptedBackend); ok {
+		backend.passphrase = passphrase
+		backend.rekeyed = true
+		return nil
+	}
+
+	if passphrase == nil {
+		return fmt.Errorf("the database is not encrypted")
+	}
+
+	if err := storage.backend.Close(); err != nil {
+		return fmt.Errorf("could not close database: %v", err)
+	}
+	storage.backend = nil
+
+	data, err := ioutil.ReadFile(storage.DbPath)
+	if err != nil {
+		return fmt.Errorf("could not read database: %v", err)
+	}
+
+	// the lock must be held until the database is encrypted back over it
+	lock := storage.lock.transfer()
+	if lock == nil {
+		lock, err = lockDatabase(storage.DbPath, "tmsu", true, waitingForLock)
+		if err != nil {
+			return err
+		}
+	}
+
+	backend, err := newEncryptedBackend(storage.DbPath, data, passphrase, lock)
+	if err != nil {
+		lock.Release()
+		return err
+	}
+	backend.rekeyed = true
+
+	storage.backend = backend
+
+	return nil
+}
+
+// unexported
+
+// A backend for an encrypted SQLite database, which is decrypted to a private
+// working copy that is encrypted back over the database when closed, if it has
+// changed. The writer lock is held throughout so that the processes using the
+// database do not overwrite each other's changes.
+type encryptedBackend struct {
+	Backend // the working copy
+
+	path       string
+	workDir    string
+	passphrase []byte   // nil to write the database decrypted
+	digest     [32]byte // of the working copy when opened
+	rekeyed    bool     // whether the database must be rewritten regardless
+	lock       *WriterLock
+}
+
+func openEncryptedBackend(path string) (Backend, error) {
+	if PassphraseFunc == nil {
+		return nil, fmt.Errorf("the database is encrypted but no passphrase was supplied")
+	}
+
+	passphrase, err := PassphraseFunc(path)
+	if err != nil {
+		return nil, err
+	}
+
+	lock, err := lockDatabase(path, "tmsu", true, waitingForLock)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		lock.Release()
+		return nil, err
+	}
+
+	data, err = encryption.Decrypt(data, passphrase)
+	if err != nil {
+		lock.Release()
+		return nil, fmt.Errorf("could not decrypt database: %v", err)
+	}
+
+	backend, err := newEncryptedBackend(path, data, passphrase, lock)
+	if err != nil {
+		lock.Release()
+		return nil, err
+	}
+
+	return backend, nil
+}
+
+func newEncryptedBackend(path string, data, passphrase []byte, lock *WriterLock) (*encryptedBackend, error) {
+	removeAbandonedWorkingCopies(workingCopyDir())
+
+	// named for the process so that it can be identified if abandoned
+	workDir, err := ioutil.TempDir(workingCopyDir(), fmt.Sprintf("tmsu-%v-", os.Getpid()))
+	if err != nil {
+		return nil, fmt.Errorf("could not create working copy: %v", err)
+	}
+
+	workPath := filepath.Join(workDir, "db")
+	log.Infof(2, "decrypting database to '%v'.", workPath)
+
+	if err := ioutil.WriteFile(workPath, data, 0600); err != nil {
+		os.RemoveAll(workDir)
+		return nil, fmt.Errorf("could not create working copy: %v", err)
+	}
+
+	db, err := database.OpenAt(workPath)
+	if err != nil {
+		os.RemoveAll(workDir)
+		return nil, err
+	}
+
+	backend := &encryptedBackend{sqliteBackend{db}, path, workDir, passphrase, sha256.Sum256(data), false, lock}
+	addWorkingCopy(backend)
+
+	return backend, nil
+}
+
+func (backend *encryptedBackend) Vacuum() error {
+	return backend.Backend.(Vacuumer).Vacuum()
+}
+
+func (backend *encryptedBackend) Close() error {
+	// the working copy is not removed from under an interrupted close
+	workingCopies.Lock()
+	defer workingCopies.Unlock()
+	delete(workingCopies.backends, backend)
+
+	defer backend.lock.Release()
+	defer os.RemoveAll(backend.workDir)
+
+	if err := backend.Backend.Close(); err != nil {
+		return err
+	}
+
+	data, err := ioutil.ReadFile(filepath.Join(backend.workDir, "db"))
+	if err != nil {
+		return err
+	}
+
+	if !backend.rekeyed && sha256.Sum256(data) == backend.digest {
+		return nil
+	}
+
+	if backend.passphrase != nil {
+		log.Infof(2, "encrypting database to '%v'.", backend.path)
+
+		data, err = encryption.Encrypt(data, backend.passphrase)
+		if err != nil {
+			return fmt.Errorf("could not encrypt database: %v", err)
+		}
+	}
+
+	tempPath := backend.path + ".tmp"
+	if err := ioutil.WriteFile(tempPath, data, 0600); err != nil {
+		return err
+	}
+
+	return os.Rename(tempPath, backend.path)
+}
+
+func waitingForLock(owner LockOwner) {
+	log.Warnf("waiting for %v...", owner)
+}
+
+// The directory for decrypted working copies: a memory file system, where
+// available, so that they are not written to disk.
+func workingCopyDir() string {
+	if info, err := os.Stat("/dev/shm"); err == nil && info.IsDir() {
+		return "/dev/shm"
+	}
+
+	return os.TempDir()
+}
+
+// The working copies of the encrypted databases open in this process.
+var workingCopies = struct {
+	sync.Mutex
+	backends map[*encryptedBackend]bool
+	handling bool // whether the signal handler is installed
+}{backends: make(map[*encryptedBackend]bool)}
+
+// Records the working copy so that it is removed should the process be
+// interrupted or terminated before the database is closed.
+func addWorkingCopy(backend *encryptedBackend) {
+	workingCopies.Lock()
+	defer workingCopies.Unlock()
+
+	workingCopies.backends[backend] = true
+
+	if !workingCopies.handling {
+		workingCopies.handling = true
+
+		signals := make(chan os.Signal, 1)
+		signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+		go func() {
+			sig := <-signals
+			removeWorkingCopies()
+
+			// the status the shell reports for a process killed by the signal
+			os.Exit(128 + int(sig.(syscall.Signal)))
+		}()
+	}
+}
+
+// Removes the working copies of the databases open in this process. The
+// changes made to them are discarded, for they may be part way through being
+// written, rather than encrypted back over the databases.
+func removeWorkingCopies() {
+	workingCopies.Lock()
+	defer workingCopies.Unlock()
+
+	for backend := range workingCopies.backends {
+		backend.Backend.Close()
+		os.RemoveAll(backend.workDir)
+		backend.lock.Release()
+
+		delete(workingCopies.backends, backend)
+	}
+}
+
+// Removes the working copies left in the directory by processes of this user
+// that did not close their databases, for instance as they were killed.
+func removeAbandonedWorkingCopies(dir string) {
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return
+	}
+
+	for _, entry := range entries {
+		fields := strings.SplitN(entry.Name(), "-", 3)
+		if !entry.IsDir() || len(fields) != 3 || fields[0] != "tmsu" {
+			continue
+		}
+
+		pid, err := strconv.Atoi(fields[1])
+		if err != nil || pid == os.Getpid() || !abandoned(entry, pid) {
+			continue
+		}
+
+		path := filepath.Join(dir, entry.Name())
+		log.Infof(2, "removing abandoned working copy '%v'.", path)
+
+		os.RemoveAll(path)
+	}
+}
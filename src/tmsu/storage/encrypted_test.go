@@ -0,0 +1,94 @@
+// Copyright 2011-2015 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package storage
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+func TestEncryptedAbandonedWorkingCopiesRemoved(test *testing.T) {
+	// set-up
+
+	store := openTestStorage(test)
+	defer closeTestStorage(store)
+	defer os.Remove(store.DbPath + ".lock")
+
+	process := exec.Command("true")
+	if err := process.Run(); err != nil {
+		test.Fatal(err)
+	}
+
+	abandonedDir := filepath.Join(workingCopyDir(), fmt.Sprintf("tmsu-%v-test", process.ProcessState.Pid()))
+	liveDir := filepath.Join(workingCopyDir(), fmt.Sprintf("tmsu-%v-test", os.Getppid()))
+
+	for _, dir := range []string{abandonedDir, liveDir} {
+		if err := os.MkdirAll(dir, 0700); err != nil {
+			test.Fatal(err)
+		}
+		defer os.RemoveAll(dir)
+
+		if err := ioutil.WriteFile(filepath.Join(dir, "db"), []byte("plaintext"), 0600); err != nil {
+			test.Fatal(err)
+		}
+	}
+
+	// test
+
+	if err := store.SetPassphrase([]byte("secret")); err != nil {
+		test.Fatal(err)
+	}
+
+	// validate
+
+	if _, err := os.Stat(abandonedDir); !os.IsNotExist(err) {
+		test.Fatalf("Expected abandoned working copy to be removed but was %v.", err)
+	}
+	if _, err := os.Stat(liveDir); err != nil {
+		test.Fatalf("Expected working copy of running process to be kept but was %v.", err)
+	}
+}
+
+func TestEncryptedWorkingCopiesRemoved(test *testing.T) {
+	// set-up
+
+	store := openTestStorage(test)
+	defer closeTestStorage(store)
+	defer os.Remove(store.DbPath + ".lock")
+
+	if err := store.SetPassphrase([]byte("secret")); err != nil {
+		test.Fatal(err)
+	}
+
+	workDir := store.backend.(*encryptedBackend).workDir
+	if _, err := os.Stat(workDir); err != nil {
+		test.Fatal(err)
+	}
+
+	// test
+
+	removeWorkingCopies()
+
+	// validate
+
+	if _, err := os.Stat(workDir); !os.IsNotExist(err) {
+		test.Fatalf("Expected working copy to be removed but was %v.", err)
+	}
+}
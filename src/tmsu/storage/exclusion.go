@@ -0,0 +1,53 @@
+// Copyright 2011-2015 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package storage
+
+import (
+	"tmsu/entities"
+)
+
+// Retrieves the complete set of tag exclusions.
+func (storage *Storage) Exclusions(tx *Tx) (entities.Exclusions, error) {
+	return tx.tx.Exclusions()
+}
+
+// Adds the tag to the named set of mutually exclusive tags, creating the set
+// if necessary.
+func (storage Storage) AddExclusion(tx *Tx, set string, tagId entities.TagId) error {
+	if storage.DryRun {
+		storage.report("add '%v' to exclusive set '%v'", storage.describeTag(tx, tagId), set)
+	}
+
+	return tx.tx.AddExclusion(set, tagId)
+}
+
+// Removes the tag from the named set of mutually exclusive tags.
+func (storage Storage) RemoveExclusion(tx *Tx, set string, tagId entities.TagId) error {
+	if storage.DryRun {
+		storage.report("remove '%v' from exclusive set '%v'", storage.describeTag(tx, tagId), set)
+	}
+
+	return tx.tx.DeleteExclusion(set, tagId)
+}
+
+// Removes the named set of mutually exclusive tags.
+func (storage Storage) RemoveExclusionSet(tx *Tx, set string) error {
+	if storage.DryRun {
+		storage.report("remove exclusive set '%v'", set)
+	}
+
+	return tx.tx.DeleteExclusionSet(set)
+}
@@ -0,0 +1,47 @@
+// Copyright 2011-2015 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package storage
+
+import (
+	"time"
+	"tmsu/entities"
+)
+
+// Retrieves the expiries of the specified file's tags.
+func (storage *Storage) FileTagExpiriesByFileId(tx *Tx, fileId entities.FileId) (entities.FileTagExpiries, error) {
+	return tx.tx.FileTagExpiriesByFileId(fileId)
+}
+
+// Retrieves the expiries of the file tags that are due to be removed by the
+// time specified.
+func (storage *Storage) ExpiredFileTags(tx *Tx, now time.Time) (entities.FileTagExpiries, error) {
+	return tx.tx.ExpiredFileTags(now)
+}
+
+// Records when the specified file tag is to be removed, replacing any expiry
+// it already has.
+func (storage *Storage) SetFileTagExpiry(tx *Tx, fileId entities.FileId, tagId entities.TagId, valueId entities.ValueId, expires time.Time) error {
+	if storage.DryRun {
+		storage.report("expire '%v' from '%v' at %v", storage.describeTagValue(tx, tagId, valueId), storage.describeFile(tx, fileId), expires.Format("2006-01-02 15:04:05"))
+	}
+
+	return tx.tx.UpdateFileTagExpiry(fileId, tagId, valueId, expires)
+}
+
+// Removes the expiry of the specified file tag, which is then kept.
+func (storage *Storage) DeleteFileTagExpiry(tx *Tx, fileId entities.FileId, tagId entities.TagId, valueId entities.ValueId) error {
+	return tx.tx.DeleteFileTagExpiry(fileId, tagId, valueId)
+}
@@ -0,0 +1,61 @@
+// Copyright 2011-2015 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package storage
+
+import (
+	"fmt"
+	"tmsu/query"
+)
+
+type QueryExplanation struct {
+	Expression query.Expression
+	Sql        string
+	Params     []interface{}
+	Plan       []string
+	FileCount  uint // the actual number of matching files, from running the query
+}
+
+// Explains how the specified query is run against the database. The query is
+// also run to count the matching files, as the query plan has no estimates.
+func (storage *Storage) ExplainQuery(tx *Tx, expression query.Expression, path string, explicitOnly bool, sort string) (*QueryExplanation, error) {
+	if !explicitOnly {
+		var err error
+		expression, err = storage.addImpliedTags(tx, expression)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	explainer, ok := tx.tx.(QueryExplainer)
+	if !ok {
+		return nil, fmt.Errorf("queries cannot be explained for this database backend")
+	}
+
+	relPath := storage.relPath(path)
+	sql, params := explainer.QueryFilesSql(expression, relPath, sort)
+
+	plan, err := explainer.QueryPlan(sql, params...)
+	if err != nil {
+		return nil, err
+	}
+
+	count, err := tx.tx.QueryFileCount(expression, relPath)
+	if err != nil {
+		return nil, err
+	}
+
+	return &QueryExplanation{expression, sql, params, plan, count}, nil
+}
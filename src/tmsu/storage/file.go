@@ -19,29 +19,30 @@ import (
 	"fmt"
 	"path/filepath"
 	"time"
+	"tmsu/common/filesystem"
 	"tmsu/common/fingerprint"
 	_path "tmsu/common/path"
 	"tmsu/entities"
 	"tmsu/query"
-	"tmsu/storage/database"
 )
 
 // Retrieves the total number of tracked files.
 func (storage *Storage) FileCount(tx *Tx) (uint, error) {
-	return database.FileCount(tx.tx)
+	return tx.tx.FileCount()
 }
 
 // The complete set of tracked files.
 func (storage *Storage) Files(tx *Tx, sort string) (entities.Files, error) {
-	files, err := database.Files(tx.tx, sort)
+	files, err := tx.tx.Files(sort)
 	storage.absPaths(files)
+	collateFiles(files, sort)
 
 	return files, err
 }
 
 // Retrieves a specific file.
 func (storage *Storage) File(tx *Tx, id entities.FileId) (*entities.File, error) {
-	file, err := database.File(tx.tx, id)
+	file, err := tx.tx.File(id)
 	storage.absPath(file)
 
 	return file, err
@@ -50,16 +51,51 @@ func (storage *Storage) File(tx *Tx, id entities.FileId) (*entities.File, error)
 // Retrieves the file with the specified path.
 func (storage *Storage) FileByPath(tx *Tx, path string) (*entities.File, error) {
 	relPath := storage.relPath(path)
-	file, err := database.FileByPath(tx.tx, relPath)
+	if file, ok := tx.cache.file(relPath); ok {
+		return file, nil
+	}
+
+	file, err := tx.tx.FileByPath(relPath)
+	if err != nil {
+		return nil, err
+	}
+
 	storage.absPath(file)
+	tx.cache.addFile(relPath, file)
 
-	return file, err
+	return file, nil
+}
+
+// Retrieves the files with the specified paths using as few queries as
+// possible. Paths that are not tracked are omitted.
+func (storage *Storage) FilesByPaths(tx *Tx, paths []string) (entities.Files, error) {
+	relPaths := make([]string, len(paths))
+	for index, path := range paths {
+		relPaths[index] = storage.relPath(path)
+	}
+
+	files, err := tx.tx.FilesByPaths(relPaths)
+	if err != nil {
+		return nil, err
+	}
+
+	storage.absPaths(files)
+
+	// subsequent lookups of these paths need not query
+	for _, relPath := range relPaths {
+		tx.cache.addFile(relPath, nil)
+	}
+	for _, file := range files {
+		tx.cache.addFile(storage.relPath(file.Path()), file)
+	}
+
+	return files, nil
 }
 
 // Retrieves all files that are under the specified directory.
 func (storage *Storage) FilesByDirectory(tx *Tx, path string) (entities.Files, error) {
 	relPath := storage.relPath(path)
-	files, err := database.FilesByDirectory(tx.tx, relPath)
+	files, err := tx.tx.FilesByDirectory(relPath)
 	storage.absPaths(files)
 
 	return files, err
@@ -71,7 +107,7 @@ func (storage *Storage) FilesByDirectories(tx *Tx, paths []string) (entities.Fil
 
 	for _, path := range paths {
 		relPath := storage.relPath(path)
-		pathFiles, err := database.FilesByDirectory(tx.tx, relPath)
+		pathFiles, err := tx.tx.FilesByDirectory(relPath)
 		if err != nil {
 			return nil, fmt.Errorf("'%v': could not retrieve files for directory: %v", path, err)
 		}
@@ -86,19 +122,19 @@ func (storage *Storage) FilesByDirectories(tx *Tx, paths []string) (entities.Fil
 
 // Retrieves the number of files with the specified fingerprint.
 func (storage *Storage) FileCountByFingerprint(tx *Tx, fingerprint fingerprint.Fingerprint) (uint, error) {
-	return database.FileCountByFingerprint(tx.tx, fingerprint)
+	return tx.tx.FileCountByFingerprint(fingerprint)
 }
 
 // Retrieves the set of files with the specified fingerprint.
 func (storage *Storage) FilesByFingerprint(tx *Tx, fingerprint fingerprint.Fingerprint) (entities.Files, error) {
-	files, err := database.FilesByFingerprint(tx.tx, fingerprint)
+	files, err := tx.tx.FilesByFingerprint(fingerprint)
 	storage.absPaths(files)
 	return files, err
 }
 
 // Retrieves the set of untagged files.
 func (storage *Storage) UntaggedFiles(tx *Tx) (entities.Files, error) {
-	files, err := database.UntaggedFiles(tx.tx)
+	files, err := tx.tx.UntaggedFiles()
 	storage.absPaths(files)
 	return files, err
 }
@@ -116,7 +152,7 @@ func (storage *Storage) FileCountWithTags(tx *Tx, tagNames []string, path string
 	}
 
 	relPath := storage.relPath(path)
-	return database.QueryFileCount(tx.tx, expression, relPath)
+	return tx.tx.QueryFileCount(expression, relPath)
 }
 
 // Retrieves the count of files that match the specified query and matching the specified path.
@@ -130,11 +166,12 @@ func (storage *Storage) QueryFileCount(tx *Tx, expression query.Expression, path
 	}
 
 	relPath := storage.relPath(path)
-	return database.QueryFileCount(tx.tx, expression, relPath)
+	return tx.tx.QueryFileCount(expression, relPath)
 }
 
-// Retrieves the set of files that match the specified query.
-func (storage *Storage) QueryFiles(tx *Tx, expression query.Expression, path string, explicitOnly bool, sort string) (entities.Files, error) {
+// Retrieves the set of files that match the specified query. A limit of zero
+// retrieves all of the matching files.
+func (storage *Storage) QueryFiles(tx *Tx, expression query.Expression, path string, explicitOnly bool, sort string, limit uint) (entities.Files, error) {
 	if !explicitOnly {
 		var err error
 		expression, err = storage.addImpliedTags(tx, expression)
@@ -144,14 +181,38 @@ func (storage *Storage) QueryFiles(tx *Tx, expression query.Expression, path str
 	}
 
 	relPath := storage.relPath(path)
-	files, err := database.QueryFiles(tx.tx, expression, relPath, sort)
+	files, err := tx.tx.QueryFiles(expression, relPath, sort, collatedLimit(sort, limit))
 	storage.absPaths(files)
-	return files, err
+	collateFiles(files, sort)
+	return limitFiles(files, limit), err
+}
+
+// Retrieves the set of files that match the specified query combined with the specified paths using the set operation ('intersect', 'union' or 'difference').
+// A limit of zero retrieves all of the matching files.
+func (storage *Storage) QueryFilesWithPaths(tx *Tx, expression query.Expression, path string, explicitOnly bool, paths []string, operation, sort string, limit uint) (entities.Files, error) {
+	if !explicitOnly {
+		var err error
+		expression, err = storage.addImpliedTags(tx, expression)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	relPaths := make([]string, len(paths))
+	for index, path := range paths {
+		relPaths[index] = storage.relPath(path)
+	}
+
+	relPath := storage.relPath(path)
+	files, err := tx.tx.QueryFilesWithPaths(expression, relPath, relPaths, operation, sort, collatedLimit(sort, limit))
+	storage.absPaths(files)
+	collateFiles(files, sort)
+	return limitFiles(files, limit), err
 }
 
 // Retrieves the sets of duplicate files within the database.
 func (storage *Storage) DuplicateFiles(tx *Tx) ([]entities.Files, error) {
-	fileSets, err := database.DuplicateFiles(tx.tx)
+	fileSets, err := tx.tx.DuplicateFiles()
 
 	for _, fileSet := range fileSets {
 		storage.absPaths(fileSet)
@@ -162,25 +223,132 @@ func (storage *Storage) DuplicateFiles(tx *Tx) ([]entities.Files, error) {
 
 // Adds a file to the database.
 func (storage *Storage) AddFile(tx *Tx, path string, fingerprint fingerprint.Fingerprint, modTime time.Time, size int64, isDir bool) (*entities.File, error) {
+	if storage.DryRun {
+		storage.report("add file '%v'", path)
+	}
+
 	relPath := storage.relPath(path)
-	file, err := database.InsertFile(tx.tx, relPath, fingerprint, modTime, size, isDir)
+	file, err := tx.tx.InsertFile(relPath, fingerprint, modTime, size, isDir)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.tx.UpdateFileVolume(file.Id, filesystem.VolumeId(path)); err != nil {
+		return nil, fmt.Errorf("could not record volume: %v", err)
+	}
+
+	if err := storage.recordFileIdentity(tx, file.Id, path); err != nil {
+		return nil, fmt.Errorf("could not record identity: %v", err)
+	}
+
+	if err := storage.journalFile(tx, entities.JournalAddFile, *file); err != nil {
+		return nil, err
+	}
+
 	storage.absPath(file)
+	tx.cache.addFile(relPath, file)
 
-	return file, err
+	return file, nil
 }
 
 // Updates a file in the database.
 func (storage *Storage) UpdateFile(tx *Tx, fileId entities.FileId, path string, fingerprint fingerprint.Fingerprint, modTime time.Time, size int64, isDir bool) (*entities.File, error) {
+	if storage.DryRun {
+		storage.report("update file '%v' (fingerprint %v)", path, fingerprint)
+	}
+
+	previous, err := tx.tx.File(fileId)
+	if err != nil {
+		return nil, err
+	}
+	if previous != nil {
+		if err := storage.journalFile(tx, entities.JournalUpdateFile, *previous); err != nil {
+			return nil, err
+		}
+
+		if previous.Size != size || !previous.ModTime.Equal(modTime.UTC()) {
+			// fingerprints by other algorithms are of the previous contents
+			if err := tx.tx.DeleteFileFingerprints(fileId); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	tx.cache.clearFiles()
+
 	relPath := storage.relPath(path)
-	file, err := database.UpdateFile(tx.tx, fileId, relPath, fingerprint, modTime, size, isDir)
+	file, err := tx.tx.UpdateFile(fileId, relPath, fingerprint, modTime, size, isDir)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.tx.UpdateFileVolume(fileId, filesystem.VolumeId(path)); err != nil {
+		return nil, fmt.Errorf("could not record volume: %v", err)
+	}
+
+	if err := storage.recordFileIdentity(tx, fileId, path); err != nil {
+		return nil, fmt.Errorf("could not record identity: %v", err)
+	}
+
 	storage.absPath(file)
 
-	return file, err
+	return file, nil
+}
+
+// Rewrites the paths of the file at fromPath and of all files under it so
+// that they are under toPath instead. The files are not examined: the paths
+// are updated in a single statement. Returns the number of files updated.
+func (storage *Storage) RewriteFilePaths(tx *Tx, fromPath, toPath string) (uint, error) {
+	if storage.DryRun {
+		storage.report("rewrite paths under '%v' to be under '%v'", fromPath, toPath)
+	}
+
+	relFromPath := storage.relPath(fromPath)
+	relToPath := storage.relPath(toPath)
+
+	files, err := tx.tx.FilesByDirectory(relFromPath)
+	if err != nil {
+		return 0, err
+	}
+
+	file, err := tx.tx.FileByPath(relFromPath)
+	if err != nil {
+		return 0, err
+	}
+	if file != nil {
+		files = append(files, file)
+	}
+
+	for _, file := range files {
+		if err := storage.journalFile(tx, entities.JournalUpdateFile, *file); err != nil {
+			return 0, err
+		}
+	}
+
+	tx.cache.clearFiles()
+
+	return tx.tx.RewriteFilePaths(relFromPath, relToPath)
 }
 
 // Deletes a file from the database.
 func (storage *Storage) DeleteFile(tx *Tx, fileId entities.FileId) error {
-	return database.DeleteFile(tx.tx, fileId)
+	if storage.DryRun {
+		storage.report("remove file '%v'", storage.describeFile(tx, fileId))
+	}
+
+	file, err := tx.tx.File(fileId)
+	if err != nil {
+		return err
+	}
+	if file != nil {
+		if err := storage.journalFile(tx, entities.JournalDeleteFile, *file); err != nil {
+			return err
+		}
+	}
+
+	tx.cache.clearFiles()
+
+	return tx.tx.DeleteFile(fileId)
 }
 
 // Deletes a file if it is untagged
@@ -198,19 +366,56 @@ func (storage *Storage) DeleteFileIfUntagged(tx *Tx, fileId entities.FileId) err
 	return nil
 }
 
-// Deletes the specified files if they are untagged
+// Deletes the specified files if they are untagged: files with a note are
+// kept.
 func (storage *Storage) DeleteUntaggedFiles(tx *Tx, fileIds entities.FileIds) error {
-	return database.DeleteUntaggedFiles(tx.tx, fileIds)
+	for _, fileId := range fileIds {
+		count, err := storage.FileTagCountByFileId(tx, fileId, true)
+		if err != nil {
+			return err
+		}
+		if count != 0 {
+			continue
+		}
+
+		note, err := tx.tx.FileNote(fileId)
+		if err != nil {
+			return err
+		}
+		if note != "" {
+			continue
+		}
+
+		file, err := tx.tx.File(fileId)
+		if err != nil {
+			return err
+		}
+		if file == nil {
+			continue
+		}
+
+		if storage.DryRun {
+			storage.report("remove untagged file '%v'", storage.describeFile(tx, fileId))
+		}
+
+		if err := storage.journalFile(tx, entities.JournalDeleteFile, *file); err != nil {
+			return err
+		}
+	}
+
+	tx.cache.clearFiles()
+
+	return tx.tx.DeleteUntaggedFiles(fileIds)
 }
 
 // unexported
 
 func (storage *Storage) relPath(path string) string {
-	if path == "" {
-		return "" // don't alter empty paths
+	if path == "" || _path.IsURL(path) {
+		return path // don't alter empty paths or URLs
 	}
 
-	return _path.RelTo(path, storage.RootPath)
+	return _path.RelTo(_path.Normalise(storage.CanonicalPath(path)), storage.RootPath)
 }
 
 func (storage *Storage) absPaths(files entities.Files) {
@@ -220,7 +425,7 @@ func (storage *Storage) absPaths(files entities.Files) {
 }
 
 func (storage *Storage) absPath(file *entities.File) {
-	if file == nil || file.Directory == "" || file.Directory[0] == filepath.Separator {
+	if file == nil || file.Directory == "" || filepath.IsAbs(file.Directory) || _path.IsURL(file.Directory) {
 		return
 	}
 
@@ -261,7 +466,7 @@ func (storage *Storage) addImpliedTagsRecursive(expression query.Expression, imp
 		return typedExpression
 	case query.TagExpression:
 		return applyImplicationsForTag(typedExpression, impliersByTag)
-	case query.ValueExpression, query.EmptyExpression, query.ComparisonExpression:
+	case query.ValueExpression, query.EmptyExpression, query.ComparisonExpression, query.NoteExpression, query.ContentExpression, query.DirectoryExpression:
 		return expression
 	default:
 		panic(fmt.Sprintf("unsupported expression type '%T'.", typedExpression))
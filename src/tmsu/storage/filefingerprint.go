@@ -0,0 +1,101 @@
+// Copyright 2011-2015 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package storage
+
+import (
+	"os"
+	"tmsu/common/fingerprint"
+	"tmsu/entities"
+)
+
+// Retrieves the fingerprint of the file by the specified algorithm. Where the
+// algorithm is not that of the file's own fingerprint, a fingerprint recorded
+// previously is used or, failing that, one is calculated and recorded. An empty
+// fingerprint is returned for files that are missing or have been modified
+// since they were last recorded.
+func (storage *Storage) FileFingerprint(tx *Tx, file *entities.File, algorithm string) (fingerprint.Fingerprint, error) {
+	settings, err := storage.Settings(tx)
+	if err != nil {
+		return fingerprint.Empty, err
+	}
+	if algorithm == settings.FileFingerprintAlgorithm() {
+		return file.Fingerprint, nil
+	}
+
+	fp, err := tx.tx.FileFingerprint(file.Id, algorithm)
+	if err != nil || fp != fingerprint.Empty {
+		return fp, err
+	}
+
+	stat, err := os.Stat(file.Path())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return fingerprint.Empty, nil
+		}
+
+		return fingerprint.Empty, err
+	}
+	if stat.Size() != file.Size || !stat.ModTime().UTC().Equal(file.ModTime) {
+		return fingerprint.Empty, nil
+	}
+
+	fp, err = storage.Fingerprint(tx, file.Path(), algorithm, settings.DirectoryFingerprintAlgorithm())
+	if err != nil {
+		return fingerprint.Empty, err
+	}
+
+	if fp != fingerprint.Empty && !tx.tx.ReadOnly() {
+		if err := tx.tx.UpdateFileFingerprint(file.Id, algorithm, fp); err != nil {
+			return fingerprint.Empty, err
+		}
+	}
+
+	return fp, nil
+}
+
+// Retrieves the fingerprint of the file recorded for the algorithm, without
+// calculating one if there is none.
+func (storage *Storage) RecordedFileFingerprint(tx *Tx, fileId entities.FileId, algorithm string) (fingerprint.Fingerprint, error) {
+	return tx.tx.FileFingerprint(fileId, algorithm)
+}
+
+// Records the fingerprint of the file for the algorithm.
+func (storage *Storage) UpdateFileFingerprint(tx *Tx, fileId entities.FileId, algorithm string, fp fingerprint.Fingerprint) error {
+	if tx.tx.ReadOnly() {
+		// fingerprints are recorded only to save calculating them again
+		return nil
+	}
+
+	return tx.tx.UpdateFileFingerprint(fileId, algorithm, fp)
+}
+
+// unexported
+
+// Records the files' fingerprints under the current algorithm before it is
+// changed, so that they are not lost when the files are fingerprinted again.
+func (storage *Storage) preserveFileFingerprints(tx *Tx, algorithm string) error {
+	settings, err := storage.Settings(tx)
+	if err != nil {
+		return err
+	}
+
+	previous := settings.FileFingerprintAlgorithm()
+	if previous == algorithm {
+		return nil
+	}
+
+	return tx.tx.PreserveFileFingerprints(previous)
+}
@@ -0,0 +1,31 @@
+// Copyright 2011-2015 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package storage
+
+import (
+	"tmsu/entities"
+)
+
+// Groups the specified files by the tags applied to them.
+func (storage *Storage) FileGroupsByTag(tx *Tx, fileIds entities.FileIds) (entities.FileGroups, error) {
+	return tx.tx.FileGroupsByTag(fileIds)
+}
+
+// Groups the specified files by the values of the specified tag applied to
+// them. Files without the tag are omitted.
+func (storage *Storage) FileGroupsByValue(tx *Tx, fileIds entities.FileIds, tagName string) (entities.FileGroups, error) {
+	return tx.tx.FileGroupsByValue(fileIds, tagName)
+}
@@ -16,14 +16,14 @@
 package storage
 
 import (
+	"time"
 	"tmsu/entities"
-	"tmsu/storage/database"
 )
 
 // Determines whether the specified file has the specified tag applied.
 func (storage *Storage) FileTagExists(tx *Tx, fileId entities.FileId, tagId entities.TagId, valueId entities.ValueId, explicitOnly bool) (bool, error) {
 	if explicitOnly {
-		return database.FileTagExists(tx.tx, fileId, tagId, valueId)
+		return tx.tx.FileTagExists(fileId, tagId, valueId)
 	}
 
 	fileTags, err := storage.FileTagsByFileId(tx, fileId, false)
@@ -36,18 +36,18 @@ func (storage *Storage) FileTagExists(tx *Tx, fileId entities.FileId, tagId enti
 
 // Retrieves the total count of file tags in the database.
 func (storage *Storage) FileTagCount(tx *Tx) (uint, error) {
-	return database.FileTagCount(tx.tx)
+	return tx.tx.FileTagCount()
 }
 
 // Retrieves the complete set of file tags.
 func (storage *Storage) FileTags(tx *Tx) (entities.FileTags, error) {
-	return database.FileTags(tx.tx)
+	return tx.tx.FileTags()
 }
 
 // Retrieves the count of file tags for the specified file.
 func (storage *Storage) FileTagCountByFileId(tx *Tx, fileId entities.FileId, explicitOnly bool) (uint, error) {
 	if explicitOnly {
-		return database.FileTagCountByFileId(tx.tx, fileId)
+		return tx.tx.FileTagCountByFileId(fileId)
 	}
 
 	fileTags, err := storage.FileTagsByFileId(tx, fileId, false)
@@ -61,7 +61,7 @@ func (storage *Storage) FileTagCountByFileId(tx *Tx, fileId entities.FileId, exp
 // Retrieves the count of file tags for the specified tag.
 func (storage *Storage) FileTagCountByTagId(tx *Tx, tagId entities.TagId, explicitOnly bool) (uint, error) {
 	if explicitOnly {
-		return database.FileTagCountByTagId(tx.tx, tagId)
+		return tx.tx.FileTagCountByTagId(tagId)
 	}
 
 	fileTags, err := storage.FileTagsByTagId(tx, tagId, false)
@@ -74,7 +74,7 @@ func (storage *Storage) FileTagCountByTagId(tx *Tx, tagId entities.TagId, explic
 
 // Retrieves the file tags with the specified tag ID.
 func (storage *Storage) FileTagsByTagId(tx *Tx, tagId entities.TagId, explicitOnly bool) (entities.FileTags, error) {
-	fileTags, err := database.FileTagsByTagId(tx.tx, tagId)
+	fileTags, err := tx.tx.FileTagsByTagId(tagId)
 	if err != nil {
 		return nil, err
 	}
@@ -92,17 +92,23 @@ func (storage *Storage) FileTagsByTagId(tx *Tx, tagId entities.TagId, explicitOn
 
 // Retrieves the count of file tags for the specified value.
 func (storage *Storage) FileTagCountByValueId(tx *Tx, valueId entities.ValueId) (uint, error) {
-	return database.FileTagCountByValueId(tx.tx, valueId)
+	return tx.tx.FileTagCountByValueId(valueId)
 }
 
 // Retrieves the file tags with the specified value ID.
 func (storage *Storage) FileTagsByValueId(tx *Tx, valueId entities.ValueId) (entities.FileTags, error) {
-	return database.FileTagsByValueId(tx.tx, valueId)
+	return tx.tx.FileTagsByValueId(valueId)
+}
+
+// Retrieves the file tags applied by the specified user, if not empty, and
+// after the specified time, if not zero.
+func (storage *Storage) FileTagsByAttribution(tx *Tx, username string, after time.Time) (entities.FileTags, error) {
+	return tx.tx.FileTagsByAttribution(username, after)
 }
 
 // Retrieves the file tags with the specified file ID.
 func (storage *Storage) FileTagsByFileId(tx *Tx, fileId entities.FileId, explicitOnly bool) (entities.FileTags, error) {
-	fileTags, err := database.FileTagsByFileId(tx.tx, fileId)
+	fileTags, err := tx.tx.FileTagsByFileId(fileId)
 	if err != nil {
 		return nil, err
 	}
@@ -120,20 +126,82 @@ func (storage *Storage) FileTagsByFileId(tx *Tx, fileId entities.FileId, explici
 
 // Adds a file tag.
 func (storage *Storage) AddFileTag(tx *Tx, fileId entities.FileId, tagId entities.TagId, valueId entities.ValueId) (*entities.FileTag, error) {
-	return database.AddFileTag(tx.tx, fileId, tagId, valueId)
+	exists, err := tx.tx.FileTagExists(fileId, tagId, valueId)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		if storage.DryRun {
+			storage.report("tag '%v' with '%v'", storage.describeFile(tx, fileId), storage.describeTagValue(tx, tagId, valueId))
+		}
+
+		if err := storage.journalFileTag(tx, entities.JournalAddFileTag, entities.FileTag{FileId: fileId, TagId: tagId, ValueId: valueId}); err != nil {
+			return nil, err
+		}
+	}
+
+	return tx.tx.AddFileTag(fileId, tagId, valueId, storage.Username, time.Now())
+}
+
+// Applies tags to a file, adding those it does not already have with as few
+// statements as possible. The file tags added are returned.
+func (storage *Storage) ApplyFileTags(tx *Tx, fileId entities.FileId, pairs []entities.TagValuePair) (entities.FileTags, error) {
+	existing, err := tx.tx.FileTagsByFileId(fileId)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	added := make(entities.FileTags, 0, len(pairs))
+	newPairs := make([]entities.TagValuePair, 0, len(pairs))
+	for _, pair := range pairs {
+		if existing.Contains(pair.TagId, pair.ValueId) || added.Contains(pair.TagId, pair.ValueId) {
+			continue
+		}
+
+		if storage.DryRun {
+			storage.report("tag '%v' with '%v'", storage.describeFile(tx, fileId), storage.describeTagValue(tx, pair.TagId, pair.ValueId))
+		}
+
+		fileTag := entities.FileTag{FileId: fileId, TagId: pair.TagId, ValueId: pair.ValueId, Explicit: true, Username: storage.Username, Time: now}
+		if err := storage.journalFileTag(tx, entities.JournalAddFileTag, fileTag); err != nil {
+			return nil, err
+		}
+
+		added = append(added, &fileTag)
+		newPairs = append(newPairs, pair)
+	}
+
+	if len(newPairs) == 0 {
+		return added, nil
+	}
+
+	if err := tx.tx.AddFileTags(fileId, newPairs, storage.Username, now); err != nil {
+		return nil, err
+	}
+
+	return added, nil
 }
 
 // Delete file tag.
 func (storage *Storage) DeleteFileTag(tx *Tx, fileId entities.FileId, tagId entities.TagId, valueId entities.ValueId) error {
-	exists, err := storage.FileTagExists(tx, fileId, tagId, valueId, true)
+	fileTag, err := tx.tx.FileTag(fileId, tagId, valueId)
 	if err != nil {
 		return err
 	}
-	if !exists {
+	if fileTag == nil {
 		return FileTagDoesNotExist{fileId, tagId, valueId}
 	}
 
-	if err := database.DeleteFileTag(tx.tx, fileId, tagId, valueId); err != nil {
+	if storage.DryRun {
+		storage.report("untag '%v' from '%v'", storage.describeTagValue(tx, tagId, valueId), storage.describeFile(tx, fileId))
+	}
+
+	if err := storage.journalFileTag(tx, entities.JournalDeleteFileTag, *fileTag); err != nil {
+		return err
+	}
+
+	if err := tx.tx.DeleteFileTag(fileId, tagId, valueId); err != nil {
 		return err
 	}
 
@@ -150,12 +218,20 @@ func (storage *Storage) DeleteFileTag(tx *Tx, fileId entities.FileId, tagId enti
 
 // Deletes all of the file tags for the specified file.
 func (storage *Storage) DeleteFileTagsByFileId(tx *Tx, fileId entities.FileId) error {
-	fileTags, err := database.FileTagsByFileId(tx.tx, fileId)
+	fileTags, err := tx.tx.FileTagsByFileId(fileId)
 	if err != nil {
 		return err
 	}
 
-	if err := database.DeleteFileTagsByFileId(tx.tx, fileId); err != nil {
+	if storage.DryRun {
+		storage.report("remove all %v tagging(s) from '%v'", len(fileTags), storage.describeFile(tx, fileId))
+	}
+
+	if err := storage.journalFileTags(tx, entities.JournalDeleteFileTag, fileTags); err != nil {
+		return err
+	}
+
+	if err := tx.tx.DeleteFileTagsByFileId(fileId); err != nil {
 		return err
 	}
 
@@ -172,12 +248,20 @@ func (storage *Storage) DeleteFileTagsByFileId(tx *Tx, fileId entities.FileId) e
 
 // Deletes all of the file tags for the specified tag.
 func (storage *Storage) DeleteFileTagsByTagId(tx *Tx, tagId entities.TagId) error {
-	fileTags, err := database.FileTagsByTagId(tx.tx, tagId)
+	fileTags, err := tx.tx.FileTagsByTagId(tagId)
 	if err != nil {
 		return err
 	}
 
-	if err := database.DeleteFileTagsByTagId(tx.tx, tagId); err != nil {
+	if storage.DryRun {
+		storage.report("remove %v tagging(s) with tag '%v'", len(fileTags), storage.describeTag(tx, tagId))
+	}
+
+	if err := storage.journalFileTags(tx, entities.JournalDeleteFileTag, fileTags); err != nil {
+		return err
+	}
+
+	if err := tx.tx.DeleteFileTagsByTagId(tagId); err != nil {
 		return err
 	}
 
@@ -194,7 +278,35 @@ func (storage *Storage) DeleteFileTagsByTagId(tx *Tx, tagId entities.TagId) erro
 
 // Copies file tags from one tag to another.
 func (storage *Storage) CopyFileTags(tx *Tx, sourceTagId, destTagId entities.TagId) error {
-	return database.CopyFileTags(tx.tx, sourceTagId, destTagId)
+	if storage.DryRun {
+		storage.report("copy taggings of '%v' to '%v'", storage.describeTag(tx, sourceTagId), storage.describeTag(tx, destTagId))
+	}
+
+	existing, err := tx.tx.FileTagsByTagId(destTagId)
+	if err != nil {
+		return err
+	}
+
+	if err := tx.tx.CopyFileTags(sourceTagId, destTagId, storage.Username, time.Now()); err != nil {
+		return err
+	}
+
+	fileTags, err := tx.tx.FileTagsByTagId(destTagId)
+	if err != nil {
+		return err
+	}
+
+	for _, fileTag := range fileTags {
+		if existing.Find(fileTag.FileId, fileTag.TagId, fileTag.ValueId) != nil {
+			continue
+		}
+
+		if err := storage.journalFileTag(tx, entities.JournalAddFileTag, *fileTag); err != nil {
+			return err
+		}
+	}
+
+	return nil
 }
 
 // unexported
@@ -220,7 +332,7 @@ func (storage *Storage) addImpliedFileTags(tx *Tx, fileTags entities.FileTags) (
 				if impliedFileTag != nil {
 					impliedFileTag.Implicit = true
 				} else {
-					impliedFileTag := entities.FileTag{fileTag.FileId, implication.ImpliedTag.Id, 0, false, true}
+					impliedFileTag := entities.FileTag{fileTag.FileId, implication.ImpliedTag.Id, 0, false, true, "", time.Time{}}
 					fileTags = append(fileTags, &impliedFileTag)
 				}
 			}
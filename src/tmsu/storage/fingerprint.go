@@ -0,0 +1,87 @@
+// Copyright 2011-2015 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package storage
+
+import (
+	"os"
+	"tmsu/common/filesystem"
+	"tmsu/common/fingerprint"
+	"tmsu/common/log"
+)
+
+const fingerprintCacheSettingName = "fingerprintCache"
+
+// Creates the fingerprint of the file at the specified path. Where the
+// fingerprintCache setting is enabled, the fingerprint previously calculated
+// for the file is reused if its size and modification time are unchanged.
+func (storage *Storage) Fingerprint(tx *Tx, path, fileAlgorithm, directoryAlgorithm string) (fingerprint.Fingerprint, error) {
+	return storage.fingerprint(tx, path, fileAlgorithm, directoryAlgorithm, true)
+}
+
+// Creates the fingerprint of the file at the specified path, ignoring any
+// cached fingerprint but updating the cache with the new one.
+func (storage *Storage) RecalculateFingerprint(tx *Tx, path, fileAlgorithm, directoryAlgorithm string) (fingerprint.Fingerprint, error) {
+	return storage.fingerprint(tx, path, fileAlgorithm, directoryAlgorithm, false)
+}
+
+// unexported
+
+func (storage *Storage) fingerprint(tx *Tx, path, fileAlgorithm, directoryAlgorithm string, useCache bool) (fingerprint.Fingerprint, error) {
+	stat, err := os.Stat(path)
+	if err != nil || stat.IsDir() || !fingerprint.IsContentAlgorithm(fileAlgorithm) {
+		// directory fingerprints depend upon their contents
+		return fingerprint.Create(path, fileAlgorithm, directoryAlgorithm)
+	}
+
+	settings, err := storage.Settings(tx)
+	if err != nil {
+		return fingerprint.Empty, err
+	}
+	if !settings.BoolValue(fingerprintCacheSettingName) {
+		return fingerprint.Create(path, fileAlgorithm, directoryAlgorithm)
+	}
+
+	device, inode, ok := filesystem.FileIdentity(stat)
+	if !ok {
+		return fingerprint.Create(path, fileAlgorithm, directoryAlgorithm)
+	}
+
+	if useCache {
+		fp, err := tx.tx.CachedFingerprint(device, inode, fileAlgorithm, stat.Size(), stat.ModTime())
+		if err != nil {
+			return fingerprint.Empty, err
+		}
+		if fp != fingerprint.Empty {
+			log.Infof(2, "%v: using cached fingerprint", path)
+			return fp, nil
+		}
+	}
+
+	fp, err := fingerprint.Create(path, fileAlgorithm, directoryAlgorithm)
+	if err != nil {
+		return fingerprint.Empty, err
+	}
+
+	if tx.tx.ReadOnly() {
+		return fp, nil
+	}
+
+	if err := tx.tx.UpdateCachedFingerprint(device, inode, fileAlgorithm, stat.Size(), stat.ModTime(), fp); err != nil {
+		return fingerprint.Empty, err
+	}
+
+	return fp, nil
+}
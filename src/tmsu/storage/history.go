@@ -0,0 +1,57 @@
+// Copyright 2011-2015 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package storage
+
+import (
+	"path/filepath"
+	"time"
+	"tmsu/entities"
+)
+
+// Retrieves the history of tags applied to and removed from the file at the
+// specified path, oldest first.
+func (storage *Storage) FileTagEvents(tx *Tx, path string) (entities.FileTagEvents, error) {
+	events, err := tx.tx.FileTagEvents(storage.relPath(path))
+	if err != nil {
+		return nil, err
+	}
+
+	storage.absEventPaths(events)
+
+	return events, nil
+}
+
+// Retrieves the history of all files since the specified time, oldest first.
+func (storage *Storage) FileTagEventsSince(tx *Tx, since time.Time) (entities.FileTagEvents, error) {
+	events, err := tx.tx.FileTagEventsSince(since)
+	if err != nil {
+		return nil, err
+	}
+
+	storage.absEventPaths(events)
+
+	return events, nil
+}
+
+// unexported
+
+func (storage *Storage) absEventPaths(events entities.FileTagEvents) {
+	for _, event := range events {
+		if event.Directory != "" && !filepath.IsAbs(event.Directory) {
+			event.Directory = filepath.Join(storage.RootPath, event.Directory)
+		}
+	}
+}
@@ -0,0 +1,61 @@
+// Copyright 2011-2015 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package storage
+
+import (
+	"os"
+	"tmsu/common/filesystem"
+	"tmsu/entities"
+)
+
+// Determines whether the file described by the stat information has replaced
+// the specified file at its path since it was recorded, as happens when an
+// editor saves by writing a new file and renaming it over the original. Files
+// whose identity was not recorded are not considered replaced.
+func (storage *Storage) FileReplaced(tx *Tx, fileId entities.FileId, stat os.FileInfo) (bool, error) {
+	device, inode, ok := filesystem.FileIdentity(stat)
+	if !ok {
+		return false, nil
+	}
+
+	recordedDevice, recordedInode, recorded, err := tx.tx.FileIdentity(fileId)
+	if err != nil {
+		return false, err
+	}
+	if !recorded {
+		return false, nil
+	}
+
+	return device != recordedDevice || inode != recordedInode, nil
+}
+
+// unexported
+
+// Records the device and inode numbers of the file at the path, where the
+// file exists and these are available.
+func (storage *Storage) recordFileIdentity(tx *Tx, fileId entities.FileId, path string) error {
+	stat, err := os.Stat(path)
+	if err != nil {
+		return tx.tx.DeleteFileIdentity(fileId)
+	}
+
+	device, inode, ok := filesystem.FileIdentity(stat)
+	if !ok {
+		return tx.tx.DeleteFileIdentity(fileId)
+	}
+
+	return tx.tx.UpdateFileIdentity(fileId, device, inode)
+}
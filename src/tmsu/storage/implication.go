@@ -17,12 +17,11 @@ package storage
 
 import (
 	"tmsu/entities"
-	"tmsu/storage/database"
 )
 
 // Retrieves the complete set of tag implications.
 func (storage *Storage) Implications(tx *Tx) (entities.Implications, error) {
-	return database.Implications(tx.tx)
+	return tx.tx.Implications()
 }
 
 // Retrieves the set of implications for the specified tags.
@@ -33,7 +32,7 @@ func (storage *Storage) ImplicationsForTags(tx *Tx, tagIds ...entities.TagId) (e
 	copy(impliedTagIds, tagIds)
 
 	for len(impliedTagIds) > 0 {
-		implications, err := database.ImplicationsForTags(tx.tx, impliedTagIds)
+		implications, err := tx.tx.ImplicationsForTags(impliedTagIds)
 		if err != nil {
 			return nil, err
 		}
@@ -52,26 +51,71 @@ func (storage *Storage) ImplicationsForTags(tx *Tx, tagIds ...entities.TagId) (e
 
 // Adds the specified implication.
 func (storage Storage) AddImplication(tx *Tx, tagId, impliedTagId entities.TagId) error {
-	return database.AddImplication(tx.tx, tagId, impliedTagId)
+	if storage.DryRun {
+		storage.report("add implication '%v' -> '%v'", storage.describeTag(tx, tagId), storage.describeTag(tx, impliedTagId))
+	}
+
+	return storage.journalImplicationChanges(tx, func() error {
+		return tx.tx.AddImplication(tagId, impliedTagId)
+	})
 }
 
 // Updates implications featuring the specified tag.
 func (storage Storage) UpdateImplicationsForTagId(tx *Tx, tagId, impliedTagId entities.TagId) error {
-	return database.UpdateImplicationsForTagId(tx.tx, tagId, impliedTagId)
+	if storage.DryRun {
+		storage.report("move implications of '%v' to '%v'", storage.describeTag(tx, tagId), storage.describeTag(tx, impliedTagId))
+	}
+
+	return storage.journalImplicationChanges(tx, func() error {
+		return tx.tx.UpdateImplicationsForTagId(tagId, impliedTagId)
+	})
 }
 
 // Removes the specified implication
 func (storage Storage) RemoveImplication(tx *Tx, tagId, impliedTagId entities.TagId) error {
-	return database.DeleteImplication(tx.tx, tagId, impliedTagId)
+	if storage.DryRun {
+		storage.report("remove implication '%v' -> '%v'", storage.describeTag(tx, tagId), storage.describeTag(tx, impliedTagId))
+	}
+
+	if err := tx.tx.DeleteImplication(tagId, impliedTagId); err != nil {
+		return err
+	}
+
+	return storage.journal(tx, entities.JournalEntry{Action: entities.JournalDeleteImplication, TagId: tagId, ImpliedTagId: impliedTagId})
 }
 
 // Removes implications featuring the specified tag.
 func (storage Storage) RemoveImplicationsForTagId(tx *Tx, tagId entities.TagId) error {
-	return database.DeleteImplicationsForTagId(tx.tx, tagId)
+	if storage.DryRun {
+		storage.report("remove implications featuring '%v'", storage.describeTag(tx, tagId))
+	}
+
+	return storage.journalImplicationChanges(tx, func() error {
+		return tx.tx.DeleteImplicationsForTagId(tagId)
+	})
 }
 
 // unexported
 
+// Journals the implications added or removed by the specified change.
+func (storage Storage) journalImplicationChanges(tx *Tx, change func() error) error {
+	before, err := tx.tx.Implications()
+	if err != nil {
+		return err
+	}
+
+	if err := change(); err != nil {
+		return err
+	}
+
+	after, err := tx.tx.Implications()
+	if err != nil {
+		return err
+	}
+
+	return storage.journalImplications(tx, before, after)
+}
+
 func containsImplication(implications entities.Implications, implication *entities.Implication) bool {
 	for index := 0; index < len(implications); index++ {
 		if implications[index].ImplyingTag.Id == implication.ImplyingTag.Id && implications[index].ImpliedTag.Id == implication.ImpliedTag.Id {
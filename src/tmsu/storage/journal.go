@@ -0,0 +1,183 @@
+// Copyright 2011-2015 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package storage
+
+import (
+	"fmt"
+	"time"
+	"tmsu/entities"
+)
+
+// The number of operations retained in the journal.
+const journalLength = 100
+
+// Retrieves the most recent operations, latest first.
+func (storage *Storage) Operations(tx *Tx, count uint) (entities.Operations, error) {
+	return tx.tx.Operations(count)
+}
+
+// Reverts the specified number of most recent operations, returning those
+// that were undone.
+func (storage *Storage) Undo(tx *Tx, count uint) (entities.Operations, error) {
+	operations, err := tx.tx.Operations(count)
+	if err != nil {
+		return nil, fmt.Errorf("could not retrieve operations: %v", err)
+	}
+
+	for _, operation := range operations {
+		entries, err := tx.tx.JournalEntries(operation.Id)
+		if err != nil {
+			return nil, fmt.Errorf("could not retrieve journal for operation #%v: %v", operation.Id, err)
+		}
+
+		for _, entry := range entries {
+			if err := storage.revert(tx, entry); err != nil {
+				return nil, fmt.Errorf("could not undo '%v': %v", operation.Description, err)
+			}
+		}
+
+		if err := tx.tx.DeleteOperation(operation.Id); err != nil {
+			return nil, fmt.Errorf("could not remove operation #%v: %v", operation.Id, err)
+		}
+	}
+
+	return operations, nil
+}
+
+// unexported
+
+// Records a change in the journal of the transaction's operation, starting a
+// new operation upon the first change.
+func (storage Storage) journal(tx *Tx, entry entities.JournalEntry) error {
+	if tx.operationId == 0 {
+		operation, err := tx.tx.InsertOperation(tx.description, time.Now())
+		if err != nil {
+			return fmt.Errorf("could not record operation: %v", err)
+		}
+
+		if err := tx.tx.PruneOperations(journalLength); err != nil {
+			return fmt.Errorf("could not prune journal: %v", err)
+		}
+
+		tx.operationId = operation.Id
+	}
+
+	if err := tx.tx.InsertJournalEntry(tx.operationId, entry); err != nil {
+		return fmt.Errorf("could not record journal entry: %v", err)
+	}
+
+	return nil
+}
+
+func (storage Storage) journalFile(tx *Tx, action string, file entities.File) error {
+	return storage.journal(tx, entities.JournalEntry{Action: action, FileId: file.Id, Name: file.Name, File: file})
+}
+
+// Records a file tag change, both in the journal and in the file's tag
+// history. The attribution is kept so that a deleted file tag can be restored
+// as it was.
+func (storage Storage) journalFileTag(tx *Tx, action string, fileTag entities.FileTag) error {
+	entry := entities.JournalEntry{Action: action, FileId: fileTag.FileId, TagId: fileTag.TagId, ValueId: fileTag.ValueId, Name: fileTag.Username}
+	entry.File.ModTime = fileTag.Time
+
+	if err := storage.journal(tx, entry); err != nil {
+		return err
+	}
+
+	return storage.recordFileTagEvent(tx, fileTag, action == entities.JournalAddFileTag)
+}
+
+func (storage Storage) recordFileTagEvent(tx *Tx, fileTag entities.FileTag, tagged bool) error {
+	if err := tx.tx.InsertFileTagEvent(fileTag.FileId, fileTag.TagId, fileTag.ValueId, tagged, storage.Username, time.Now()); err != nil {
+		return fmt.Errorf("could not record tag history: %v", err)
+	}
+
+	return nil
+}
+
+func (storage Storage) journalFileTags(tx *Tx, action string, fileTags entities.FileTags) error {
+	for _, fileTag := range fileTags {
+		if err := storage.journalFileTag(tx, action, *fileTag); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (storage Storage) journalImplications(tx *Tx, before, after entities.Implications) error {
+	for _, implication := range before {
+		if !containsImplication(after, implication) {
+			entry := entities.JournalEntry{Action: entities.JournalDeleteImplication, TagId: implication.ImplyingTag.Id, ImpliedTagId: implication.ImpliedTag.Id}
+			if err := storage.journal(tx, entry); err != nil {
+				return err
+			}
+		}
+	}
+
+	for _, implication := range after {
+		if !containsImplication(before, implication) {
+			entry := entities.JournalEntry{Action: entities.JournalAddImplication, TagId: implication.ImplyingTag.Id, ImpliedTagId: implication.ImpliedTag.Id}
+			if err := storage.journal(tx, entry); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func (storage Storage) revert(tx *Tx, entry entities.JournalEntry) error {
+	tx.cache.clear()
+
+	switch entry.Action {
+	case entities.JournalAddFile:
+		return tx.tx.DeleteFile(entry.FileId)
+	case entities.JournalUpdateFile:
+		return tx.tx.RevertFile(entry.File)
+	case entities.JournalDeleteFile:
+		return tx.tx.RestoreFile(entry.File)
+	case entities.JournalAddTag:
+		return tx.tx.DeleteTag(entry.TagId)
+	case entities.JournalRenameTag:
+		_, err := tx.tx.RenameTag(entry.TagId, entry.Name)
+		return err
+	case entities.JournalDeleteTag:
+		return tx.tx.RestoreTag(entry.TagId, entry.Name)
+	case entities.JournalAddValue:
+		return tx.tx.DeleteValue(entry.ValueId)
+	case entities.JournalDeleteValue:
+		return tx.tx.RestoreValue(entry.ValueId, entry.Name)
+	case entities.JournalAddFileTag:
+		if err := storage.recordFileTagEvent(tx, entities.FileTag{FileId: entry.FileId, TagId: entry.TagId, ValueId: entry.ValueId}, false); err != nil {
+			return err
+		}
+
+		return tx.tx.DeleteFileTag(entry.FileId, entry.TagId, entry.ValueId)
+	case entities.JournalDeleteFileTag:
+		if _, err := tx.tx.AddFileTag(entry.FileId, entry.TagId, entry.ValueId, entry.Name, entry.File.ModTime); err != nil {
+			return err
+		}
+
+		return storage.recordFileTagEvent(tx, entities.FileTag{FileId: entry.FileId, TagId: entry.TagId, ValueId: entry.ValueId}, true)
+	case entities.JournalAddImplication:
+		return tx.tx.DeleteImplication(entry.TagId, entry.ImpliedTagId)
+	case entities.JournalDeleteImplication:
+		return tx.tx.AddImplication(entry.TagId, entry.ImpliedTagId)
+	}
+
+	return fmt.Errorf("unknown journal action '%v'", entry.Action)
+}
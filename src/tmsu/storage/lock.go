@@ -0,0 +1,204 @@
+// Copyright 2011-2015 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package storage
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// An advisory lock held by the one process modifying the database. The lock
+// file alongside the database records the owner's process ID and command so
+// that other processes can report whom they are waiting for.
+type WriterLock struct {
+	file    *os.File
+	storage *Storage // the storage whose lock this shares, if any
+}
+
+// The process holding the writer lock.
+type LockOwner struct {
+	Pid     int
+	Command string
+}
+
+func (owner LockOwner) String() string {
+	if owner.Pid == 0 {
+		return "another tmsu process"
+	}
+
+	return fmt.Sprintf("%v (pid %v)", owner.Command, owner.Pid)
+}
+
+// The database is locked by another process and the caller chose not to wait.
+type LockedError struct {
+	Owner LockOwner
+}
+
+func (err LockedError) Error() string {
+	return fmt.Sprintf("the database is locked by %v", err.Owner)
+}
+
+// Acquires the writer lock on behalf of the command specified. If another
+// process holds it then, unless wait is false in which case a LockedError is
+// returned, waiting is called with the owner and the lock awaited. Within the
+// process the lock is shared, being released once every holder releases it.
+// Databases that are not SQLite files are not locked.
+func (storage *Storage) LockForWriting(command string, wait bool, waiting func(LockOwner)) (*WriterLock, error) {
+	backendName, path := ParseLocation(storage.DbPath)
+	if backendName != DefaultBackend {
+		return &WriterLock{}, nil
+	}
+
+	if backend, ok := storage.backend.(*encryptedBackend); ok && backend.lock != nil {
+		// held from decryption until the database is encrypted back
+		backend.lock.setOwner(command)
+		return &WriterLock{}, nil
+	}
+
+	storage.holders.Lock()
+	defer storage.holders.Unlock()
+
+	if storage.lock == nil || storage.lock.file == nil {
+		lock, err := lockDatabase(path, command, wait, waiting)
+		if err != nil {
+			return nil, err
+		}
+
+		storage.lock = lock
+	}
+	storage.holders.count++
+
+	return &WriterLock{storage: storage}, nil
+}
+
+// Releases the writer lock.
+func (lock *WriterLock) Release() error {
+	if lock == nil {
+		return nil
+	}
+
+	if storage := lock.storage; storage != nil {
+		lock.storage = nil
+
+		storage.holders.Lock()
+		defer storage.holders.Unlock()
+
+		storage.holders.count--
+		if storage.holders.count > 0 {
+			return nil
+		}
+
+		return storage.lock.Release()
+	}
+
+	if lock.file == nil {
+		return nil
+	}
+
+	lock.file.Truncate(0)
+	err := unlockFile(lock.file)
+	lock.file.Close()
+	lock.file = nil
+
+	return err
+}
+
+// unexported
+
+// The holders of a storage's writer lock.
+type lockHolders struct {
+	sync.Mutex
+	count int
+}
+
+// Takes the writer lock on the SQLite database at the specified path.
+func lockDatabase(path, command string, wait bool, waiting func(LockOwner)) (*WriterLock, error) {
+	lockPath := path + ".lock"
+
+	file, err := os.OpenFile(lockPath, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("could not open lock file '%v': %v", lockPath, err)
+	}
+
+	locked, err := lockFile(file, false)
+	if err != nil {
+		file.Close()
+		return nil, fmt.Errorf("could not lock '%v': %v", lockPath, err)
+	}
+	if !locked {
+		owner := readLockOwner(lockPath)
+		if !wait {
+			file.Close()
+			return nil, LockedError{owner}
+		}
+
+		if waiting != nil {
+			waiting(owner)
+		}
+
+		if _, err := lockFile(file, true); err != nil {
+			file.Close()
+			return nil, fmt.Errorf("could not lock '%v': %v", lockPath, err)
+		}
+	}
+
+	lock := &WriterLock{file: file}
+	lock.setOwner(command)
+
+	return lock, nil
+}
+
+// Records the process and command holding the lock for those waiting for it.
+func (lock *WriterLock) setOwner(command string) {
+	if err := lock.file.Truncate(0); err == nil {
+		lock.file.WriteAt([]byte(fmt.Sprintf("%v\n%v\n", os.Getpid(), command)), 0)
+	}
+}
+
+// Passes the lock to a new holder, leaving this one to release nothing.
+func (lock *WriterLock) transfer() *WriterLock {
+	if lock == nil || lock.file == nil {
+		return nil
+	}
+
+	transferred := &WriterLock{file: lock.file}
+	lock.file = nil
+
+	return transferred
+}
+
+func readLockOwner(lockPath string) LockOwner {
+	data, err := ioutil.ReadFile(lockPath)
+	if err != nil {
+		return LockOwner{}
+	}
+
+	lines := strings.SplitN(string(data), "\n", 3)
+	if len(lines) < 2 {
+		return LockOwner{}
+	}
+
+	pid, err := strconv.Atoi(lines[0])
+	if err != nil {
+		return LockOwner{}
+	}
+
+	return LockOwner{pid, lines[1]}
+}
@@ -0,0 +1,48 @@
+// Copyright 2011-2015 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package storage
+
+import (
+	"fmt"
+	"time"
+	"tmsu/entities"
+)
+
+// Retrieves the last runs of the scheduled maintenance jobs.
+func (storage *Storage) MaintenanceJobs(tx *Tx) (entities.MaintenanceJobs, error) {
+	return tx.tx.MaintenanceJobs()
+}
+
+// Records the last run of the named maintenance job and its result.
+func (storage *Storage) UpdateMaintenanceJob(tx *Tx, name string, lastRun time.Time, result string) error {
+	return tx.tx.UpdateMaintenanceJob(name, lastRun, result)
+}
+
+// Reclaims the space left in the database by deleted rows. This must not be
+// called whilst a transaction is open.
+func (storage *Storage) Vacuum() error {
+	if storage.DryRun {
+		storage.report("vacuum the database")
+		return nil
+	}
+
+	vacuumer, ok := storage.backend.(Vacuumer)
+	if !ok {
+		return fmt.Errorf("this database backend cannot be vacuumed")
+	}
+
+	return vacuumer.Vacuum()
+}
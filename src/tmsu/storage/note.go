@@ -0,0 +1,54 @@
+// Copyright 2011-2015 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package storage
+
+import (
+	"tmsu/entities"
+)
+
+// Retrieves the note attached to the specified file, or an empty string if it
+// has none.
+func (storage *Storage) FileNote(tx *Tx, fileId entities.FileId) (string, error) {
+	return tx.tx.FileNote(fileId)
+}
+
+// Retrieves the notes attached to files, keyed by file.
+func (storage *Storage) FileNotes(tx *Tx) (map[entities.FileId]string, error) {
+	return tx.tx.FileNotes()
+}
+
+// Attaches a note to the specified file, replacing any it already has. An
+// empty note removes it.
+func (storage *Storage) UpdateFileNote(tx *Tx, fileId entities.FileId, text string) error {
+	if storage.DryRun {
+		if text == "" {
+			storage.report("remove note from '%v'", storage.describeFile(tx, fileId))
+		} else {
+			storage.report("attach note to '%v'", storage.describeFile(tx, fileId))
+		}
+	}
+
+	return tx.tx.UpdateFileNote(fileId, text)
+}
+
+// Replaces the text indexed for the specified file's content.
+func (storage *Storage) UpdateFileContent(tx *Tx, fileId entities.FileId, text string) error {
+	if storage.DryRun {
+		storage.report("index content of '%v'", storage.describeFile(tx, fileId))
+	}
+
+	return tx.tx.UpdateFileContent(fileId, text)
+}
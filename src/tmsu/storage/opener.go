@@ -0,0 +1,84 @@
+// Copyright 2011-2015 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package storage
+
+import (
+	"fmt"
+	"strings"
+	"tmsu/entities"
+)
+
+const openersSettingName = "openers"
+
+// The command configured by the openers setting to open files of the MIME
+// type, or an empty string if there is none. The setting lists
+// semicolon-separated TYPE=COMMAND entries, where TYPE is a MIME type or a
+// pattern such as 'image/*', and the first matching entry is used.
+func OpenerFor(settings entities.Settings, mimeType string) string {
+	for _, entry := range openerEntries(settings.Value(openersSettingName)) {
+		if matchesMimeType(entry[0], mimeType) {
+			return entry[1]
+		}
+	}
+
+	return ""
+}
+
+// unexported
+
+func openerEntries(value string) [][2]string {
+	entries := make([][2]string, 0, 1)
+	for _, entry := range strings.Split(value, ";") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		index := strings.Index(entry, "=")
+		if index == -1 {
+			entries = append(entries, [2]string{entry, ""})
+		} else {
+			entries = append(entries, [2]string{strings.TrimSpace(entry[:index]), strings.TrimSpace(entry[index+1:])})
+		}
+	}
+
+	return entries
+}
+
+func matchesMimeType(pattern, mimeType string) bool {
+	if pattern == "*" || pattern == "*/*" {
+		return true
+	}
+
+	if strings.HasSuffix(pattern, "/*") {
+		return strings.HasPrefix(strings.ToLower(mimeType), strings.ToLower(pattern[:len(pattern)-1]))
+	}
+
+	return strings.EqualFold(pattern, mimeType)
+}
+
+func validateOpeners(value string) error {
+	for _, entry := range openerEntries(value) {
+		if !strings.Contains(entry[0], "/") && entry[0] != "*" {
+			return fmt.Errorf("invalid MIME type '%v' for setting '%v': expected TYPE=COMMAND entries separated by semicolons", entry[0], openersSettingName)
+		}
+		if entry[1] == "" {
+			return fmt.Errorf("missing command for MIME type '%v' in setting '%v'", entry[0], openersSettingName)
+		}
+	}
+
+	return nil
+}
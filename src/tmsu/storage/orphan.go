@@ -0,0 +1,38 @@
+// Copyright 2011-2015 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package storage
+
+import (
+	"tmsu/entities"
+)
+
+// Counts the taggings, implications and exclusions that refer to files, tags or
+// values that do not exist.
+func (storage *Storage) OrphanCounts(tx *Tx) (entities.OrphanCounts, error) {
+	return tx.tx.OrphanCounts()
+}
+
+// Deletes the taggings, implications and exclusions that refer to files, tags
+// or values that do not exist.
+func (storage Storage) DeleteOrphans(tx *Tx) error {
+	if storage.DryRun {
+		storage.report("delete taggings, implications and exclusions referring to missing files, tags or values")
+	}
+
+	tx.cache.clear()
+
+	return tx.tx.DeleteOrphans()
+}
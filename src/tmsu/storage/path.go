@@ -0,0 +1,154 @@
+// Copyright 2011-2015 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package storage
+
+import (
+	"os"
+	"path/filepath"
+	"tmsu/common/filesystem"
+	"tmsu/common/log"
+)
+
+// The canonical form of the absolute path under the database's canonicalPaths
+// setting: with symbolic links in its directory resolved and, for 'mounts',
+// paths under bind mounts mapped to those under the mount of the whole file
+// system. Paths are canonicalised before they are stored or looked up so that
+// each file has a single path however it is reached.
+func (storage *Storage) CanonicalPath(path string) string {
+	if path == "" || storage.paths == nil {
+		return path
+	}
+
+	return storage.paths.canonical(path)
+}
+
+// The canonical form of the absolute directory path. Unlike CanonicalPath,
+// the directory itself is also resolved should it be a symbolic link, as is
+// needed to find the files within it.
+func (storage *Storage) CanonicalDirectory(path string) string {
+	if path == "" || storage.paths == nil {
+		return path
+	}
+
+	return filesystem.ResolveBindMounts(storage.paths.resolveDir(filepath.Clean(path)), storage.paths.bindMounts)
+}
+
+// unexported
+
+const canonicalPathsSettingName = "canonicalPaths"
+
+const (
+	canonicalPathsNone     = "none"     // paths are stored as specified
+	canonicalPathsSymlinks = "symlinks" // symbolic links in paths are resolved
+	canonicalPathsMounts   = "mounts"   // bind mounts are resolved too
+)
+
+// Whether the text is a valid canonicalPaths setting value.
+func isCanonicalPathsValue(value string) bool {
+	switch value {
+	case canonicalPathsNone, canonicalPathsSymlinks, canonicalPathsMounts:
+		return true
+	}
+
+	return false
+}
+
+type pathResolver struct {
+	bindMounts []filesystem.BindMount
+	dirs       map[string]string // the resolved path of each directory
+}
+
+func newPathResolver(policy string) *pathResolver {
+	switch policy {
+	case canonicalPathsSymlinks:
+		return &pathResolver{nil, make(map[string]string)}
+	case canonicalPathsMounts:
+		bindMounts, err := filesystem.BindMounts()
+		if err != nil {
+			log.Warnf("could not identify bind mounts: %v", err)
+		}
+
+		return &pathResolver{bindMounts, make(map[string]string)}
+	}
+
+	return nil
+}
+
+// Loads the path canonicalisation policy and canonicalises the root path
+// accordingly.
+func (storage *Storage) loadPathPolicy() error {
+	tx, err := storage.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	setting, err := storage.Setting(tx, canonicalPathsSettingName)
+	if err != nil {
+		return err
+	}
+
+	storage.setPathPolicy(setting.Value)
+
+	return nil
+}
+
+func (storage *Storage) setPathPolicy(policy string) {
+	storage.paths = newPathResolver(policy)
+
+	if storage.paths != nil && storage.RootPath != "" {
+		storage.RootPath = storage.paths.canonical(storage.RootPath)
+	}
+}
+
+// Resolves the symbolic links in the directory of the path, but not the path
+// itself so that a link is not confused with its target, and then any bind
+// mount.
+func (resolver *pathResolver) canonical(path string) string {
+	path = filepath.Clean(path)
+
+	dir, name := filepath.Split(path)
+	if name == "" {
+		// the root directory
+		return filesystem.ResolveBindMounts(path, resolver.bindMounts)
+	}
+
+	path = filepath.Join(resolver.resolveDir(filepath.Clean(dir)), name)
+
+	return filesystem.ResolveBindMounts(path, resolver.bindMounts)
+}
+
+// Resolves the symbolic links in the directory path. Where the directory does
+// not exist, its nearest existing ancestor is resolved instead.
+func (resolver *pathResolver) resolveDir(dir string) string {
+	if resolved, ok := resolver.dirs[dir]; ok {
+		return resolved
+	}
+
+	resolved, err := filepath.EvalSymlinks(dir)
+	if err != nil {
+		parent := filepath.Dir(dir)
+		if parent == dir || !os.IsNotExist(err) {
+			return dir
+		}
+
+		resolved = filepath.Join(resolver.resolveDir(parent), filepath.Base(dir))
+	}
+
+	resolver.dirs[dir] = resolved
+
+	return resolved
+}
@@ -0,0 +1,91 @@
+// Copyright 2011-2015 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package storage
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"tmsu/entities"
+)
+
+const pathOnlyFilesSettingName = "pathOnlyFiles"
+
+// Determines whether the specified file is tracked by path only, i.e. is
+// neither fingerprinted nor checked for modification.
+func (storage *Storage) FilePathOnly(tx *Tx, fileId entities.FileId) (bool, error) {
+	return tx.tx.FilePathOnly(fileId)
+}
+
+// Retrieves the set of files that are tracked by path only.
+func (storage *Storage) PathOnlyFiles(tx *Tx) (map[entities.FileId]bool, error) {
+	return tx.tx.PathOnlyFiles()
+}
+
+// Records whether the specified file is tracked by path only.
+func (storage *Storage) UpdateFilePathOnly(tx *Tx, fileId entities.FileId, pathOnly bool) error {
+	if storage.DryRun {
+		if pathOnly {
+			storage.report("track '%v' by path only", storage.describeFile(tx, fileId))
+		} else {
+			storage.report("track '%v' by fingerprint", storage.describeFile(tx, fileId))
+		}
+	}
+
+	return tx.tx.UpdateFilePathOnly(fileId, pathOnly)
+}
+
+// Whether the path matches one of the patterns of the pathOnlyFiles setting.
+// Patterns are separated by commas and match the file's name or, where they
+// contain a path separator, its whole path.
+func MatchesPathOnlyFiles(settings entities.Settings, path string) bool {
+	for _, pattern := range pathOnlyPatterns(settings.Value(pathOnlyFilesSettingName)) {
+		subject := filepath.Base(path)
+		if strings.ContainsRune(pattern, filepath.Separator) {
+			subject = path
+		}
+
+		if matched, _ := filepath.Match(pattern, subject); matched {
+			return true
+		}
+	}
+
+	return false
+}
+
+// unexported
+
+func pathOnlyPatterns(value string) []string {
+	patterns := make([]string, 0, 1)
+	for _, pattern := range strings.Split(value, ",") {
+		pattern = strings.TrimSpace(pattern)
+		if pattern != "" {
+			patterns = append(patterns, pattern)
+		}
+	}
+
+	return patterns
+}
+
+func validatePathOnlyPatterns(value string) error {
+	for _, pattern := range pathOnlyPatterns(value) {
+		if _, err := filepath.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid pattern '%v' for setting '%v'", pattern, pathOnlyFilesSettingName)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,65 @@
+// Copyright 2011-2015 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package storage
+
+import (
+	"path/filepath"
+	"time"
+	_path "tmsu/common/path"
+	"tmsu/entities"
+)
+
+// Retrieves the tags queued for files that could not yet be tagged, ordered
+// by path.
+func (storage *Storage) PendingTags(tx *Tx) (entities.PendingTags, error) {
+	pendingTags, err := tx.tx.PendingTags()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, pendingTag := range pendingTags {
+		if !filepath.IsAbs(pendingTag.Path) && !_path.IsURL(pendingTag.Path) {
+			pendingTag.Path = filepath.Join(storage.RootPath, pendingTag.Path)
+		}
+	}
+
+	return pendingTags, nil
+}
+
+// Retrieves the number of queued tags.
+func (storage *Storage) PendingTagCount(tx *Tx) (uint, error) {
+	return tx.tx.PendingTagCount()
+}
+
+// Queues the tag, with the value, for the file at the specified path.
+func (storage *Storage) AddPendingTag(tx *Tx, path, tagName, valueName string) error {
+	if storage.DryRun {
+		description := tagName
+		if valueName != "" {
+			description += "=" + valueName
+		}
+
+		storage.report("queue '%v' for '%v'", description, path)
+	}
+
+	return tx.tx.InsertPendingTag(storage.relPath(path), tagName, valueName, time.Now())
+}
+
+// Removes the tags queued for the file at the specified path, once they have
+// been applied.
+func (storage *Storage) DeletePendingTags(tx *Tx, path string) error {
+	return tx.tx.DeletePendingTags(storage.relPath(path))
+}
@@ -17,25 +17,32 @@ package storage
 
 import (
 	"tmsu/entities"
-	"tmsu/storage/database"
 )
 
 // The complete set of queries.
 func (storage *Storage) Queries(tx *Tx) (entities.Queries, error) {
-	return database.Queries(tx.tx)
+	return tx.tx.Queries()
 }
 
 // Retrievs the specified query.
 func (storage *Storage) Query(tx *Tx, text string) (*entities.Query, error) {
-	return database.Query(tx.tx, text)
+	return tx.tx.Query(text)
 }
 
 // Adds a query to the database.
 func (storage *Storage) AddQuery(tx *Tx, text string) (*entities.Query, error) {
-	return database.InsertQuery(tx.tx, text)
+	if storage.DryRun {
+		storage.report("save query '%v'", text)
+	}
+
+	return tx.tx.InsertQuery(text)
 }
 
 // Removes a query from the database.
 func (storage *Storage) DeleteQuery(tx *Tx, text string) error {
-	return database.DeleteQuery(tx.tx, text)
+	if storage.DryRun {
+		storage.report("delete query '%v'", text)
+	}
+
+	return tx.tx.DeleteQuery(text)
 }
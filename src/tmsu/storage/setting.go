@@ -17,7 +17,6 @@ package storage
 
 import (
 	"tmsu/entities"
-	"tmsu/storage/database"
 )
 
 var defaultSettings = map[string]string{
@@ -25,32 +24,95 @@ var defaultSettings = map[string]string{
 	"autoCreateValues":              "yes",
 	"fileFingerprintAlgorithm":      "dynamic:SHA256",
 	"directoryFingerprintAlgorithm": "none",
+	readOnlySettingName:             "no",
+	textDatabaseSettingName:         "no",
+	inheritDupeTagsSettingName:      "no",
+	colourSettingName:               "auto",
+	allowSpacesSettingName:          "no",
+	reservedCharsSettingName:        "",
+	"contentIndexer":                "",
+	canonicalPathsSettingName:       canonicalPathsNone,
+	pathOnlyFilesSettingName:        "",
+	fingerprintCacheSettingName:     "yes",
+	"audioFingerprinter":            "fpcalc -raw",
+	openersSettingName:              "",
+	vfsCacheTimeoutSettingName:      "1s",
+	collationSettingName:            "binary",
+	numericSortSettingName:          "no",
+	auditLogSettingName:             "no",
+	auditLogMaxSizeSettingName:      "10M",
+	expiredTagsSettingName:          "remove",
+	verifyScheduleSettingName:       "daily",
+	verifyFilesSettingName:          "100",
+	vacuumScheduleSettingName:       "weekly",
+	pruneScheduleSettingName:        "never",
+	confirmFileCountSettingName:     "100",
 }
 
+const fileFingerprintAlgorithmSettingName = "fileFingerprintAlgorithm"
+
+const readOnlySettingName = "readOnly"
+
+const inheritDupeTagsSettingName = "inheritDupeTags"
+
+const colourSettingName = "color"
+
+const allowSpacesSettingName = "allowSpacesInNames"
+
+const reservedCharsSettingName = "reservedNameChars"
+
+const vfsCacheTimeoutSettingName = "vfsCacheTimeout"
+
+const collationSettingName = "collation"
+
+const numericSortSettingName = "numericSort"
+
+const expiredTagsSettingName = "expiredTags"
+
+const verifyScheduleSettingName = "verifySchedule"
+
+const verifyFilesSettingName = "verifyFiles"
+
+const vacuumScheduleSettingName = "vacuumSchedule"
+
+const pruneScheduleSettingName = "pruneSchedule"
+
+const confirmFileCountSettingName = "confirmFileCount"
+
 // The complete set of settings.
 func (storage *Storage) Settings(tx *Tx) (entities.Settings, error) {
-	settings, err := database.Settings(tx.tx)
+	if settings := tx.cache.allSettings(); settings != nil {
+		return settings, nil
+	}
+
+	settings, err := tx.tx.Settings()
 	if err != nil {
 		return nil, err
 	}
 
 	// enrich with defaults
-	for name, value := range defaultSettings {
+	for name, value := range storage.defaults {
 		if !settings.ContainsName(name) {
 			settings = append(settings, &entities.Setting{name, value})
 		}
 	}
 
+	tx.cache.setAllSettings(settings)
+
 	return settings, nil
 }
 
 func (storage *Storage) Setting(tx *Tx, name string) (*entities.Setting, error) {
-	setting, err := database.Setting(tx.tx, name)
+	if setting, ok := tx.cache.setting(name); ok {
+		return setting, nil
+	}
+
+	setting, err := tx.tx.Setting(name)
 	if err != nil {
 		return nil, err
 	}
 	if setting == nil {
-		value, ok := defaultSettings[name]
+		value, ok := storage.defaults[name]
 		if !ok {
 			return nil, nil
 		}
@@ -58,9 +120,74 @@ func (storage *Storage) Setting(tx *Tx, name string) (*entities.Setting, error)
 		setting = &entities.Setting{name, value}
 	}
 
+	tx.cache.addSetting(name, setting)
+
 	return setting, nil
 }
 
 func (storage *Storage) UpdateSetting(tx *Tx, name, value string) (*entities.Setting, error) {
-	return database.UpdateSetting(tx.tx, name, value)
+	if err := ValidateSetting(name, value); err != nil {
+		return nil, err
+	}
+
+	if name == readOnlySettingName {
+		// the setting can be turned off again unless read-only mode was requested
+		if tx.tx.ReadOnly() && !storage.ReadOnly {
+			tx.tx.SetReadOnly(false)
+			defer tx.tx.SetReadOnly(true)
+		}
+	}
+
+	if storage.DryRun {
+		storage.report("set '%v' to '%v'", name, value)
+	}
+
+	if name == fileFingerprintAlgorithmSettingName {
+		if err := storage.preserveFileFingerprints(tx, value); err != nil {
+			return nil, err
+		}
+	}
+
+	tx.cache.clearSettings()
+
+	setting, err := tx.tx.UpdateSetting(name, value)
+	if err != nil {
+		return nil, err
+	}
+
+	if name == canonicalPathsSettingName {
+		tx.cache.clearFiles()
+		storage.setPathPolicy(value)
+	}
+
+	if name == fingerprintCacheSettingName && !(entities.Settings{setting}).BoolValue(name) {
+		// the cache is not maintained whilst disabled
+		if err := tx.tx.ClearFingerprintCache(); err != nil {
+			return nil, err
+		}
+	}
+
+	return setting, nil
+}
+
+// unexported
+
+// The rules for tag and value names beyond the fixed restrictions imposed by
+// the query language and the virtual filesystem.
+type namePolicy struct {
+	allowSpaces bool   // names may contain spaces, which must then be quoted in queries
+	reserved    string // further characters that names may not contain
+}
+
+func newNamePolicy(settings entities.Settings) namePolicy {
+	return namePolicy{settings.AllowSpacesInNames(), settings.ReservedNameChars()}
+}
+
+func (storage *Storage) namePolicy(tx *Tx) (namePolicy, error) {
+	settings, err := storage.Settings(tx)
+	if err != nil {
+		return namePolicy{}, err
+	}
+
+	return newNamePolicy(settings), nil
 }
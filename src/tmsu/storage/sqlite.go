@@ -0,0 +1,644 @@
+// Copyright 2011-2015 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package storage
+
+import (
+	"time"
+	"tmsu/common/encryption"
+	"tmsu/common/fingerprint"
+	"tmsu/entities"
+	"tmsu/query"
+	"tmsu/storage/database"
+)
+
+// The SQLite backend, which is the default.
+type sqliteBackend struct {
+	db *database.Database
+}
+
+func openSqliteBackend(path string) (Backend, error) {
+	encrypted, err := encryption.IsEncrypted(path)
+	if err != nil {
+		return nil, err
+	}
+	if encrypted {
+		return openEncryptedBackend(path)
+	}
+
+	db, err := database.OpenAt(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return sqliteBackend{db}, nil
+}
+
+func (backend sqliteBackend) Begin() (BackendTx, error) {
+	tx, err := backend.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+
+	return sqliteTx{tx}, nil
+}
+
+func (backend sqliteBackend) Close() error {
+	return backend.db.Close()
+}
+
+func (backend sqliteBackend) Vacuum() error {
+	return backend.db.Vacuum()
+}
+
+type sqliteTx struct {
+	tx *database.Tx
+}
+
+func (tx sqliteTx) Commit() error {
+	return tx.tx.Commit()
+}
+
+func (tx sqliteTx) Rollback() error {
+	return tx.tx.Rollback()
+}
+
+func (tx sqliteTx) ReadOnly() bool {
+	return tx.tx.ReadOnly
+}
+
+func (tx sqliteTx) SetReadOnly(readOnly bool) {
+	tx.tx.ReadOnly = readOnly
+}
+
+func (tx sqliteTx) Modified() bool {
+	return tx.tx.Modified
+}
+
+func (tx sqliteTx) RowsAffected() int64 {
+	return tx.tx.RowsAffected
+}
+
+func (tx sqliteTx) FileCount() (uint, error) {
+	return database.FileCount(tx.tx)
+}
+
+func (tx sqliteTx) Files(sort string) (entities.Files, error) {
+	return database.Files(tx.tx, sort)
+}
+
+func (tx sqliteTx) File(id entities.FileId) (*entities.File, error) {
+	return database.File(tx.tx, id)
+}
+
+func (tx sqliteTx) FileByPath(path string) (*entities.File, error) {
+	return database.FileByPath(tx.tx, path)
+}
+
+func (tx sqliteTx) FilesByPaths(paths []string) (entities.Files, error) {
+	return database.FilesByPaths(tx.tx, paths)
+}
+
+func (tx sqliteTx) FilesByDirectory(path string) (entities.Files, error) {
+	return database.FilesByDirectory(tx.tx, path)
+}
+
+func (tx sqliteTx) FileCountByFingerprint(fingerprint fingerprint.Fingerprint) (uint, error) {
+	return database.FileCountByFingerprint(tx.tx, fingerprint)
+}
+
+func (tx sqliteTx) FilesByFingerprint(fingerprint fingerprint.Fingerprint) (entities.Files, error) {
+	return database.FilesByFingerprint(tx.tx, fingerprint)
+}
+
+func (tx sqliteTx) UntaggedFiles() (entities.Files, error) {
+	return database.UntaggedFiles(tx.tx)
+}
+
+func (tx sqliteTx) QueryFileCount(expression query.Expression, path string) (uint, error) {
+	return database.QueryFileCount(tx.tx, expression, path)
+}
+
+func (tx sqliteTx) QueryFiles(expression query.Expression, path, sort string, limit uint) (entities.Files, error) {
+	return database.QueryFiles(tx.tx, expression, path, sort, limit)
+}
+
+func (tx sqliteTx) DuplicateFiles() ([]entities.Files, error) {
+	return database.DuplicateFiles(tx.tx)
+}
+
+func (tx sqliteTx) InsertFile(path string, fingerprint fingerprint.Fingerprint, modTime time.Time, size int64, isDir bool) (*entities.File, error) {
+	return database.InsertFile(tx.tx, path, fingerprint, modTime, size, isDir)
+}
+
+func (tx sqliteTx) UpdateFile(fileId entities.FileId, path string, fingerprint fingerprint.Fingerprint, modTime time.Time, size int64, isDir bool) (*entities.File, error) {
+	return database.UpdateFile(tx.tx, fileId, path, fingerprint, modTime, size, isDir)
+}
+
+func (tx sqliteTx) RewriteFilePaths(fromPath, toPath string) (uint, error) {
+	return database.RewriteFilePaths(tx.tx, fromPath, toPath)
+}
+
+func (tx sqliteTx) DeleteFile(fileId entities.FileId) error {
+	return database.DeleteFile(tx.tx, fileId)
+}
+
+func (tx sqliteTx) DeleteUntaggedFiles(fileIds entities.FileIds) error {
+	return database.DeleteUntaggedFiles(tx.tx, fileIds)
+}
+
+func (tx sqliteTx) FileTagExists(fileId entities.FileId, tagId entities.TagId, valueId entities.ValueId) (bool, error) {
+	return database.FileTagExists(tx.tx, fileId, tagId, valueId)
+}
+
+func (tx sqliteTx) FileTagCount() (uint, error) {
+	return database.FileTagCount(tx.tx)
+}
+
+func (tx sqliteTx) FileTags() (entities.FileTags, error) {
+	return database.FileTags(tx.tx)
+}
+
+func (tx sqliteTx) FileTag(fileId entities.FileId, tagId entities.TagId, valueId entities.ValueId) (*entities.FileTag, error) {
+	return database.FileTag(tx.tx, fileId, tagId, valueId)
+}
+
+func (tx sqliteTx) FileTagsByAttribution(username string, after time.Time) (entities.FileTags, error) {
+	return database.FileTagsByAttribution(tx.tx, username, after)
+}
+
+func (tx sqliteTx) FileTagCountByFileId(fileId entities.FileId) (uint, error) {
+	return database.FileTagCountByFileId(tx.tx, fileId)
+}
+
+func (tx sqliteTx) FileTagCountByTagId(tagId entities.TagId) (uint, error) {
+	return database.FileTagCountByTagId(tx.tx, tagId)
+}
+
+func (tx sqliteTx) FileTagsByTagId(tagId entities.TagId) (entities.FileTags, error) {
+	return database.FileTagsByTagId(tx.tx, tagId)
+}
+
+func (tx sqliteTx) FileTagCountByValueId(valueId entities.ValueId) (uint, error) {
+	return database.FileTagCountByValueId(tx.tx, valueId)
+}
+
+func (tx sqliteTx) FileTagsByValueId(valueId entities.ValueId) (entities.FileTags, error) {
+	return database.FileTagsByValueId(tx.tx, valueId)
+}
+
+func (tx sqliteTx) FileTagsByFileId(fileId entities.FileId) (entities.FileTags, error) {
+	return database.FileTagsByFileId(tx.tx, fileId)
+}
+
+func (tx sqliteTx) AddFileTag(fileId entities.FileId, tagId entities.TagId, valueId entities.ValueId, username string, time time.Time) (*entities.FileTag, error) {
+	return database.AddFileTag(tx.tx, fileId, tagId, valueId, username, time)
+}
+
+func (tx sqliteTx) AddFileTags(fileId entities.FileId, pairs []entities.TagValuePair, username string, time time.Time) error {
+	return database.AddFileTags(tx.tx, fileId, pairs, username, time)
+}
+
+func (tx sqliteTx) DeleteFileTag(fileId entities.FileId, tagId entities.TagId, valueId entities.ValueId) error {
+	return database.DeleteFileTag(tx.tx, fileId, tagId, valueId)
+}
+
+func (tx sqliteTx) DeleteFileTagsByFileId(fileId entities.FileId) error {
+	return database.DeleteFileTagsByFileId(tx.tx, fileId)
+}
+
+func (tx sqliteTx) DeleteFileTagsByTagId(tagId entities.TagId) error {
+	return database.DeleteFileTagsByTagId(tx.tx, tagId)
+}
+
+func (tx sqliteTx) CopyFileTags(sourceTagId entities.TagId, destTagId entities.TagId, username string, time time.Time) error {
+	return database.CopyFileTags(tx.tx, sourceTagId, destTagId, username, time)
+}
+
+func (tx sqliteTx) InsertFileTagEvent(fileId entities.FileId, tagId entities.TagId, valueId entities.ValueId, tagged bool, username string, time time.Time) error {
+	return database.InsertFileTagEvent(tx.tx, fileId, tagId, valueId, tagged, username, time)
+}
+
+func (tx sqliteTx) FileTagEvents(path string) (entities.FileTagEvents, error) {
+	return database.FileTagEvents(tx.tx, path)
+}
+
+func (tx sqliteTx) FileTagEventsSince(since time.Time) (entities.FileTagEvents, error) {
+	return database.FileTagEventsSince(tx.tx, since)
+}
+
+func (tx sqliteTx) Implications() (entities.Implications, error) {
+	return database.Implications(tx.tx)
+}
+
+func (tx sqliteTx) ImplicationsForTags(tagIds entities.TagIds) (entities.Implications, error) {
+	return database.ImplicationsForTags(tx.tx, tagIds)
+}
+
+func (tx sqliteTx) UpdateImplicationsForTagId(implyingTagId, impliedTagId entities.TagId) error {
+	return database.UpdateImplicationsForTagId(tx.tx, implyingTagId, impliedTagId)
+}
+
+func (tx sqliteTx) AddImplication(tagId, impliedTagId entities.TagId) error {
+	return database.AddImplication(tx.tx, tagId, impliedTagId)
+}
+
+func (tx sqliteTx) DeleteImplication(tagId, impliedTagId entities.TagId) error {
+	return database.DeleteImplication(tx.tx, tagId, impliedTagId)
+}
+
+func (tx sqliteTx) DeleteImplicationsForTagId(tagId entities.TagId) error {
+	return database.DeleteImplicationsForTagId(tx.tx, tagId)
+}
+
+func (tx sqliteTx) Exclusions() (entities.Exclusions, error) {
+	return database.Exclusions(tx.tx)
+}
+
+func (tx sqliteTx) AddExclusion(set string, tagId entities.TagId) error {
+	return database.AddExclusion(tx.tx, set, tagId)
+}
+
+func (tx sqliteTx) DeleteExclusion(set string, tagId entities.TagId) error {
+	return database.DeleteExclusion(tx.tx, set, tagId)
+}
+
+func (tx sqliteTx) DeleteExclusionSet(set string) error {
+	return database.DeleteExclusionSet(tx.tx, set)
+}
+
+func (tx sqliteTx) DeleteExclusionsForTagId(tagId entities.TagId) error {
+	return database.DeleteExclusionsForTagId(tx.tx, tagId)
+}
+
+func (tx sqliteTx) OrphanCounts() (entities.OrphanCounts, error) {
+	return database.OrphanCounts(tx.tx)
+}
+
+func (tx sqliteTx) DeleteOrphans() error {
+	return database.DeleteOrphans(tx.tx)
+}
+
+func (tx sqliteTx) InsertOperation(description string, time time.Time) (*entities.Operation, error) {
+	return database.InsertOperation(tx.tx, description, time)
+}
+
+func (tx sqliteTx) Operations(count uint) (entities.Operations, error) {
+	return database.Operations(tx.tx, count)
+}
+
+func (tx sqliteTx) DeleteOperation(operationId entities.OperationId) error {
+	return database.DeleteOperation(tx.tx, operationId)
+}
+
+func (tx sqliteTx) PruneOperations(keep uint) error {
+	return database.PruneOperations(tx.tx, keep)
+}
+
+func (tx sqliteTx) InsertJournalEntry(operationId entities.OperationId, entry entities.JournalEntry) error {
+	return database.InsertJournalEntry(tx.tx, operationId, entry)
+}
+
+func (tx sqliteTx) JournalEntries(operationId entities.OperationId) ([]entities.JournalEntry, error) {
+	return database.JournalEntries(tx.tx, operationId)
+}
+
+func (tx sqliteTx) RestoreFile(file entities.File) error {
+	return database.RestoreFile(tx.tx, file)
+}
+
+func (tx sqliteTx) RevertFile(file entities.File) error {
+	return database.RevertFile(tx.tx, file)
+}
+
+func (tx sqliteTx) RestoreTag(tagId entities.TagId, name string) error {
+	return database.RestoreTag(tx.tx, tagId, name)
+}
+
+func (tx sqliteTx) RestoreValue(valueId entities.ValueId, name string) error {
+	return database.RestoreValue(tx.tx, valueId, name)
+}
+
+func (tx sqliteTx) Queries() (entities.Queries, error) {
+	return database.Queries(tx.tx)
+}
+
+func (tx sqliteTx) Query(text string) (*entities.Query, error) {
+	return database.Query(tx.tx, text)
+}
+
+func (tx sqliteTx) InsertQuery(text string) (*entities.Query, error) {
+	return database.InsertQuery(tx.tx, text)
+}
+
+func (tx sqliteTx) DeleteQuery(text string) error {
+	return database.DeleteQuery(tx.tx, text)
+}
+
+func (tx sqliteTx) Clear() error {
+	return database.Clear(tx.tx)
+}
+
+func (tx sqliteTx) Settings() (entities.Settings, error) {
+	return database.Settings(tx.tx)
+}
+
+func (tx sqliteTx) Setting(name string) (*entities.Setting, error) {
+	return database.Setting(tx.tx, name)
+}
+
+func (tx sqliteTx) UpdateSetting(name, value string) (*entities.Setting, error) {
+	return database.UpdateSetting(tx.tx, name, value)
+}
+
+func (tx sqliteTx) SyncPeer(databaseId string) (*entities.SyncPeer, error) {
+	return database.SyncPeer(tx.tx, databaseId)
+}
+
+func (tx sqliteTx) UpdateSyncPeer(peer entities.SyncPeer) error {
+	return database.UpdateSyncPeer(tx.tx, peer)
+}
+
+func (tx sqliteTx) TagCount() (uint, error) {
+	return database.TagCount(tx.tx)
+}
+
+func (tx sqliteTx) Tags() (entities.Tags, error) {
+	return database.Tags(tx.tx)
+}
+
+func (tx sqliteTx) Tag(id entities.TagId) (*entities.Tag, error) {
+	return database.Tag(tx.tx, id)
+}
+
+func (tx sqliteTx) TagsByIds(ids entities.TagIds) (entities.Tags, error) {
+	return database.TagsByIds(tx.tx, ids)
+}
+
+func (tx sqliteTx) TagByName(name string) (*entities.Tag, error) {
+	return database.TagByName(tx.tx, name)
+}
+
+func (tx sqliteTx) TagsByNames(names []string) (entities.Tags, error) {
+	return database.TagsByNames(tx.tx, names)
+}
+
+func (tx sqliteTx) InsertTag(name string) (*entities.Tag, error) {
+	return database.InsertTag(tx.tx, name)
+}
+
+func (tx sqliteTx) RenameTag(tagId entities.TagId, name string) (*entities.Tag, error) {
+	return database.RenameTag(tx.tx, tagId, name)
+}
+
+func (tx sqliteTx) DeleteTag(tagId entities.TagId) error {
+	return database.DeleteTag(tx.tx, tagId)
+}
+
+func (tx sqliteTx) TagUsage() ([]entities.TagFileCount, error) {
+	return database.TagUsage(tx.tx)
+}
+
+func (tx sqliteTx) ValueCount() (uint, error) {
+	return database.ValueCount(tx.tx)
+}
+
+func (tx sqliteTx) Values() (entities.Values, error) {
+	return database.Values(tx.tx)
+}
+
+func (tx sqliteTx) Value(id entities.ValueId) (*entities.Value, error) {
+	return database.Value(tx.tx, id)
+}
+
+func (tx sqliteTx) ValuesByIds(ids entities.ValueIds) (entities.Values, error) {
+	return database.ValuesByIds(tx.tx, ids)
+}
+
+func (tx sqliteTx) UnusedValues() (entities.Values, error) {
+	return database.UnusedValues(tx.tx)
+}
+
+func (tx sqliteTx) ValueByName(name string) (*entities.Value, error) {
+	return database.ValueByName(tx.tx, name)
+}
+
+func (tx sqliteTx) ValuesByNames(names []string) (entities.Values, error) {
+	return database.ValuesByNames(tx.tx, names)
+}
+
+func (tx sqliteTx) ValuesByTagId(tagId entities.TagId) (entities.Values, error) {
+	return database.ValuesByTagId(tx.tx, tagId)
+}
+
+func (tx sqliteTx) ValueUsageByTagId(tagId entities.TagId) ([]entities.ValueFileCount, error) {
+	return database.ValueUsageByTagId(tx.tx, tagId)
+}
+
+func (tx sqliteTx) InsertValue(name string) (*entities.Value, error) {
+	return database.InsertValue(tx.tx, name)
+}
+
+func (tx sqliteTx) DeleteValue(valueId entities.ValueId) error {
+	return database.DeleteValue(tx.tx, valueId)
+}
+
+func (tx sqliteTx) DeleteUnusedValues(valueIds entities.ValueIds) error {
+	return database.DeleteUnusedValues(tx.tx, valueIds)
+}
+
+func (tx sqliteTx) FileVolume(fileId entities.FileId) (string, error) {
+	return database.FileVolume(tx.tx, fileId)
+}
+
+func (tx sqliteTx) FileVolumes() (map[entities.FileId]string, error) {
+	return database.FileVolumes(tx.tx)
+}
+
+func (tx sqliteTx) UpdateFileVolume(fileId entities.FileId, volume string) error {
+	return database.UpdateFileVolume(tx.tx, fileId, volume)
+}
+
+func (tx sqliteTx) FileTagExpiriesByFileId(fileId entities.FileId) (entities.FileTagExpiries, error) {
+	return database.FileTagExpiriesByFileId(tx.tx, fileId)
+}
+
+func (tx sqliteTx) ExpiredFileTags(now time.Time) (entities.FileTagExpiries, error) {
+	return database.ExpiredFileTags(tx.tx, now)
+}
+
+func (tx sqliteTx) UpdateFileTagExpiry(fileId entities.FileId, tagId entities.TagId, valueId entities.ValueId, expires time.Time) error {
+	return database.UpdateFileTagExpiry(tx.tx, fileId, tagId, valueId, expires)
+}
+
+func (tx sqliteTx) DeleteFileTagExpiry(fileId entities.FileId, tagId entities.TagId, valueId entities.ValueId) error {
+	return database.DeleteFileTagExpiry(tx.tx, fileId, tagId, valueId)
+}
+
+func (tx sqliteTx) FileIdentity(fileId entities.FileId) (uint64, uint64, bool, error) {
+	return database.FileIdentity(tx.tx, fileId)
+}
+
+func (tx sqliteTx) UpdateFileIdentity(fileId entities.FileId, device, inode uint64) error {
+	return database.UpdateFileIdentity(tx.tx, fileId, device, inode)
+}
+
+func (tx sqliteTx) DeleteFileIdentity(fileId entities.FileId) error {
+	return database.DeleteFileIdentity(tx.tx, fileId)
+}
+
+func (tx sqliteTx) FilePathOnly(fileId entities.FileId) (bool, error) {
+	return database.FilePathOnly(tx.tx, fileId)
+}
+
+func (tx sqliteTx) PathOnlyFiles() (map[entities.FileId]bool, error) {
+	return database.PathOnlyFiles(tx.tx)
+}
+
+func (tx sqliteTx) UpdateFilePathOnly(fileId entities.FileId, pathOnly bool) error {
+	return database.UpdateFilePathOnly(tx.tx, fileId, pathOnly)
+}
+
+func (tx sqliteTx) FileVirtual(fileId entities.FileId) (bool, error) {
+	return database.FileVirtual(tx.tx, fileId)
+}
+
+func (tx sqliteTx) VirtualFiles() (map[entities.FileId]bool, error) {
+	return database.VirtualFiles(tx.tx)
+}
+
+func (tx sqliteTx) UpdateFileVirtual(fileId entities.FileId, virtual bool) error {
+	return database.UpdateFileVirtual(tx.tx, fileId, virtual)
+}
+
+func (tx sqliteTx) Checkpoint(name string) (string, error) {
+	return database.Checkpoint(tx.tx, name)
+}
+
+func (tx sqliteTx) UpdateCheckpoint(name, position string) error {
+	return database.UpdateCheckpoint(tx.tx, name, position)
+}
+
+func (tx sqliteTx) DeleteCheckpoint(name string) error {
+	return database.DeleteCheckpoint(tx.tx, name)
+}
+
+func (tx sqliteTx) MaintenanceJobs() (entities.MaintenanceJobs, error) {
+	return database.MaintenanceJobs(tx.tx)
+}
+
+func (tx sqliteTx) UpdateMaintenanceJob(name string, lastRun time.Time, result string) error {
+	return database.UpdateMaintenanceJob(tx.tx, name, lastRun, result)
+}
+
+func (tx sqliteTx) PendingTags() (entities.PendingTags, error) {
+	return database.PendingTags(tx.tx)
+}
+
+func (tx sqliteTx) PendingTagCount() (uint, error) {
+	return database.PendingTagCount(tx.tx)
+}
+
+func (tx sqliteTx) InsertPendingTag(path, tag, value string, queued time.Time) error {
+	return database.InsertPendingTag(tx.tx, path, tag, value, queued)
+}
+
+func (tx sqliteTx) DeletePendingTags(path string) error {
+	return database.DeletePendingTags(tx.tx, path)
+}
+
+func (tx sqliteTx) FileFingerprint(fileId entities.FileId, algorithm string) (fingerprint.Fingerprint, error) {
+	return database.FileFingerprint(tx.tx, fileId, algorithm)
+}
+
+func (tx sqliteTx) FileFingerprints() (map[entities.FileId]map[string]fingerprint.Fingerprint, error) {
+	return database.FileFingerprints(tx.tx)
+}
+
+func (tx sqliteTx) UpdateFileFingerprint(fileId entities.FileId, algorithm string, fp fingerprint.Fingerprint) error {
+	return database.UpdateFileFingerprint(tx.tx, fileId, algorithm, fp)
+}
+
+func (tx sqliteTx) PreserveFileFingerprints(algorithm string) error {
+	return database.PreserveFileFingerprints(tx.tx, algorithm)
+}
+
+func (tx sqliteTx) DeleteFileFingerprints(fileId entities.FileId) error {
+	return database.DeleteFileFingerprints(tx.tx, fileId)
+}
+
+func (tx sqliteTx) CachedFingerprint(device, inode uint64, algorithm string, size int64, modTime time.Time) (fingerprint.Fingerprint, error) {
+	return database.CachedFingerprint(tx.tx, device, inode, algorithm, size, modTime)
+}
+
+func (tx sqliteTx) UpdateCachedFingerprint(device, inode uint64, algorithm string, size int64, modTime time.Time, fp fingerprint.Fingerprint) error {
+	return database.UpdateCachedFingerprint(tx.tx, device, inode, algorithm, size, modTime, fp)
+}
+
+func (tx sqliteTx) ClearFingerprintCache() error {
+	return database.ClearFingerprintCache(tx.tx)
+}
+
+func (tx sqliteTx) FileNote(fileId entities.FileId) (string, error) {
+	return database.FileNote(tx.tx, fileId)
+}
+
+func (tx sqliteTx) FileNotes() (map[entities.FileId]string, error) {
+	return database.FileNotes(tx.tx)
+}
+
+func (tx sqliteTx) UpdateFileNote(fileId entities.FileId, text string) error {
+	return database.UpdateFileNote(tx.tx, fileId, text)
+}
+
+func (tx sqliteTx) UpdateFileContent(fileId entities.FileId, text string) error {
+	return database.UpdateFileContent(tx.tx, fileId, text)
+}
+
+func (tx sqliteTx) QueryFilesWithPaths(expression query.Expression, path string, paths []string, operation, sort string, limit uint) (entities.Files, error) {
+	if err := database.LoadPathSet(tx.tx, paths); err != nil {
+		return nil, err
+	}
+
+	return database.QueryFilesWithPathSet(tx.tx, expression, path, operation, sort, limit)
+}
+
+func (tx sqliteTx) FileGroupsByTag(fileIds entities.FileIds) (entities.FileGroups, error) {
+	if err := database.LoadFileSet(tx.tx, fileIds); err != nil {
+		return nil, err
+	}
+
+	return database.FileSetGroupsByTag(tx.tx)
+}
+
+func (tx sqliteTx) FileGroupsByValue(fileIds entities.FileIds, tagName string) (entities.FileGroups, error) {
+	if err := database.LoadFileSet(tx.tx, fileIds); err != nil {
+		return nil, err
+	}
+
+	return database.FileSetGroupsByValue(tx.tx, tagName)
+}
+
+func (tx sqliteTx) QueryFilesSql(expression query.Expression, path, sort string) (string, []interface{}) {
+	return database.QueryFilesSql(expression, path, sort)
+}
+
+func (tx sqliteTx) DatabaseStatistics() (*entities.DatabaseStatistics, error) {
+	return database.DatabaseStatistics(tx.tx)
+}
+
+func (tx sqliteTx) QueryPlan(sql string, params ...interface{}) ([]string, error) {
+	return database.QueryPlan(tx.tx, sql, params...)
+}
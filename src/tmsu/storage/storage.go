@@ -17,71 +17,210 @@ package storage
 
 import (
 	"fmt"
+	"os"
+	"os/user"
 	"path/filepath"
+	"sync/atomic"
 	"tmsu/common/log"
-	"tmsu/storage/database"
+	"tmsu/entities"
 )
 
 type Storage struct {
-	db       *database.Database
+	backend  Backend
 	DbPath   string
 	RootPath string
+	DryRun   bool
+	ReadOnly bool
+	Command  string
+	Username string // the user to whom changes are attributed
+	Audited  bool   // the command running records its changes in the audit log itself
+	batch    *Tx
+	defaults map[string]string // setting defaults, from the global configuration
+	paths    *pathResolver     // canonicalises paths, if the policy requires
+	lock     *WriterLock       // the writer lock, if taken
+	holders  *lockHolders      // those sharing the writer lock within this process
+
+	rowsAffected *int64 // rows of user data changed by the committed transactions
 }
 
+// Opens the database at the specified location: a path to an SQLite database
+// or, for other backends, the backend's name and location separated by a colon.
 func OpenAt(path string) (*Storage, error) {
-	db, err := database.OpenAt(path)
+	backend, rootPath, err := openBackend(path)
 	if err != nil {
 		return nil, fmt.Errorf("could not open database at '%v': %v", path, err)
 	}
 
-	rootPath, err := determineRootPath(path)
+	log.Infof(2, "files are stored relative to root path '%v'", rootPath)
+
+	storage := &Storage{backend, path, rootPath, false, false, "", currentUsername(), false, nil, settingDefaults(), nil, nil, &lockHolders{}, new(int64)}
+
+	if err := storage.loadPathPolicy(); err != nil {
+		storage.Close()
+		return nil, fmt.Errorf("could not load path policy: %v", err)
+	}
+
+	return storage, nil
+}
+
+func (storage *Storage) Begin() (*Tx, error) {
+	if storage.batch != nil {
+		return &Tx{storage.batch.tx, storage.DryRun, storage.Command, 0, true, nil, storage, storage.batch.cache}, nil
+	}
+
+	tx, err := storage.beginDatabase()
 	if err != nil {
 		return nil, err
 	}
 
-	log.Infof(2, "files are stored relative to root path '%v'", rootPath)
-
-	return &Storage{db, path, rootPath}, nil
+	return &Tx{tx, storage.DryRun, storage.Command, 0, false, nil, storage, newCache()}, nil
 }
 
-func (storage *Storage) Begin() (*Tx, error) {
-	tx, err := storage.db.Begin()
+// Begins a batch transaction: subsequent transactions join it, with their
+// commits and rollbacks deferred until the batch itself is committed or rolled
+// back.
+func (storage *Storage) BeginBatch() (*Tx, error) {
+	if storage.batch != nil {
+		return nil, fmt.Errorf("a batch is already in progress")
+	}
+
+	tx, err := storage.beginDatabase()
 	if err != nil {
 		return nil, err
 	}
 
-	return &Tx{tx}, nil
+	storage.batch = &Tx{tx, storage.DryRun, storage.Command, 0, false, storage, storage, newCache()}
+
+	return storage.batch, nil
+}
+
+// Determines whether the database may be modified, which is not the case if
+// read-only mode was requested or the database's readOnly setting is enabled.
+func (storage *Storage) IsReadOnly() (bool, error) {
+	tx, err := storage.Begin()
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	return tx.tx.ReadOnly(), nil
 }
 
 func (storage *Storage) Close() error {
-	if storage.db == nil {
+	if storage.backend == nil {
 		return nil
 	}
 
-	err := storage.db.Close()
+	err := storage.backend.Close()
 	if err != nil {
 		return fmt.Errorf("could not close database: %v", err)
 	}
 
-	storage.db = nil
+	storage.backend = nil
 
 	return nil
 }
 
 type Tx struct {
-	tx *database.Tx
+	tx          BackendTx
+	dryRun      bool
+	description string
+	operationId entities.OperationId
+	joined      bool
+	batch       *Storage
+	storage     *Storage
+	cache       *cache // shared by the transactions joining a batch
 }
 
+// Commits the transaction or, for a dry run, rolls it back so that none of
+// the changes are written. Does nothing for a transaction that has joined a
+// batch. The text database, if enabled, is rewritten after any changes.
 func (tx *Tx) Commit() error {
-	return tx.tx.Commit()
+	if tx.joined {
+		return nil
+	}
+
+	tx.endBatch()
+	tx.cache.clear()
+
+	if tx.dryRun {
+		return tx.tx.Rollback()
+	}
+
+	if err := tx.tx.Commit(); err != nil {
+		return err
+	}
+
+	atomic.AddInt64(tx.storage.rowsAffected, tx.tx.RowsAffected())
+
+	if tx.tx.Modified() {
+		tx.storage.updateText()
+	}
+
+	return nil
 }
 
+// Rolls back the transaction. Does nothing for a transaction that has joined
+// a batch.
 func (tx *Tx) Rollback() error {
+	if tx.joined {
+		return nil
+	}
+
+	tx.endBatch()
+	tx.cache.clear()
+
 	return tx.tx.Rollback()
 }
 
 // unexported
 
+// Begins a database transaction, guarding it against modification if the
+// database is read-only.
+func (storage *Storage) beginDatabase() (BackendTx, error) {
+	tx, err := storage.backend.Begin()
+	if err != nil {
+		return nil, err
+	}
+
+	if storage.ReadOnly {
+		tx.SetReadOnly(true)
+		return tx, nil
+	}
+
+	setting, err := tx.Setting(readOnlySettingName)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	if setting != nil {
+		tx.SetReadOnly(entities.Settings{setting}.ReadOnly())
+	}
+
+	return tx, nil
+}
+
+func (tx *Tx) endBatch() {
+	if tx.batch != nil {
+		tx.batch.batch = nil
+		tx.batch = nil
+	}
+}
+
+// The name of the current user, or an empty string if it cannot be
+// determined.
+func currentUsername() string {
+	if u, err := user.Current(); err == nil {
+		return u.Username
+	}
+
+	if username := os.Getenv("USER"); username != "" {
+		return username
+	}
+
+	return os.Getenv("USERNAME")
+}
+
 func determineRootPath(dbPath string) (string, error) {
 	absDbPath, err := filepath.Abs(dbPath)
 	if err != nil {
@@ -93,5 +232,6 @@ func determineRootPath(dbPath string) (string, error) {
 		return filepath.Dir(absDbDirPath), nil
 	}
 
-	return string(filepath.Separator), nil //TODO Windows
+	// the root of the drive holding the database on Windows
+	return filepath.VolumeName(absDbPath) + string(filepath.Separator), nil
 }
@@ -0,0 +1,69 @@
+// Copyright 2011-2015 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package storage
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"tmsu/entities"
+)
+
+const databaseIdSettingName = "databaseId"
+
+// The unique identifier of the database, which is generated when first
+// needed.
+func (storage *Storage) DatabaseId(tx *Tx) (string, error) {
+	setting, err := tx.tx.Setting(databaseIdSettingName)
+	if err != nil {
+		return "", err
+	}
+	if setting != nil {
+		return setting.Value, nil
+	}
+
+	bytes := make([]byte, 16)
+	if _, err := rand.Read(bytes); err != nil {
+		return "", fmt.Errorf("could not generate database identifier: %v", err)
+	}
+	id := hex.EncodeToString(bytes)
+
+	if _, err := tx.tx.UpdateSetting(databaseIdSettingName, id); err != nil {
+		return "", fmt.Errorf("could not store database identifier: %v", err)
+	}
+
+	tx.cache.clearSettings()
+
+	return id, nil
+}
+
+// Retrieves the synchronisation state for the specified database.
+func (storage *Storage) SyncPeer(tx *Tx, databaseId string) (*entities.SyncPeer, error) {
+	peer, err := tx.tx.SyncPeer(databaseId)
+	if err != nil {
+		return nil, err
+	}
+	if peer == nil {
+		peer = &entities.SyncPeer{DatabaseId: databaseId}
+	}
+
+	return peer, nil
+}
+
+// Records the synchronisation state for a database.
+func (storage *Storage) UpdateSyncPeer(tx *Tx, peer entities.SyncPeer) error {
+	return tx.tx.UpdateSyncPeer(peer)
+}
@@ -18,71 +18,134 @@ package storage
 import (
 	"errors"
 	"fmt"
+	"sort"
+	"strings"
 	"tmsu/entities"
-	"tmsu/storage/database"
 	"unicode"
 )
 
 // The number of tags in the database.
 func (storage *Storage) TagCount(tx *Tx) (uint, error) {
-	return database.TagCount(tx.tx)
+	return tx.tx.TagCount()
 }
 
 // The set of tags.
 func (storage *Storage) Tags(tx *Tx) (entities.Tags, error) {
-	return database.Tags(tx.tx)
+	tags, err := tx.tx.Tags()
+	if err == nil && isCollated() {
+		sort.Sort(tags)
+	}
+
+	return tags, err
 }
 
 // Retrieves a specific tag.
 func (storage Storage) Tag(tx *Tx, id entities.TagId) (*entities.Tag, error) {
-	return database.Tag(tx.tx, id)
+	return tx.tx.Tag(id)
 }
 
 // Retrieves a specific set of tags.
 func (storage Storage) TagsByIds(tx *Tx, ids entities.TagIds) (entities.Tags, error) {
-	return database.TagsByIds(tx.tx, ids)
+	return tx.tx.TagsByIds(ids)
 }
 
 // Retrieves a specific tag.
 func (storage Storage) TagByName(tx *Tx, name string) (*entities.Tag, error) {
-	return database.TagByName(tx.tx, name)
+	if tag, ok := tx.cache.tag(name); ok {
+		return tag, nil
+	}
+
+	tag, err := tx.tx.TagByName(name)
+	if err != nil {
+		return nil, err
+	}
+
+	tx.cache.addTag(name, tag)
+
+	return tag, nil
 }
 
 // Retrieves the set of named tags.
 func (storage Storage) TagsByNames(tx *Tx, names []string) (entities.Tags, error) {
-	return database.TagsByNames(tx.tx, names)
+	return tx.tx.TagsByNames(names)
 }
 
 // Adds a tag.
 func (storage *Storage) AddTag(tx *Tx, name string) (*entities.Tag, error) {
-	if err := validateTagName(name); err != nil {
+	policy, err := storage.namePolicy(tx)
+	if err != nil {
 		return nil, err
 	}
 
-	return database.InsertTag(tx.tx, name)
+	if err := validateTagName(name, policy); err != nil {
+		return nil, err
+	}
+
+	if storage.DryRun {
+		storage.report("create tag '%v'", name)
+	}
+
+	tag, err := tx.tx.InsertTag(name)
+	if err != nil {
+		return nil, err
+	}
+
+	tx.cache.addTag(name, tag)
+
+	if err := storage.journal(tx, entities.JournalEntry{Action: entities.JournalAddTag, TagId: tag.Id}); err != nil {
+		return nil, err
+	}
+
+	return tag, nil
 }
 
 // Renames a tag.
 func (storage Storage) RenameTag(tx *Tx, tagId entities.TagId, name string) (*entities.Tag, error) {
-	if err := validateTagName(name); err != nil {
+	policy, err := storage.namePolicy(tx)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := validateTagName(name, policy); err != nil {
 		return nil, err
 	}
 
-	return database.RenameTag(tx.tx, tagId, name)
+	if storage.DryRun {
+		storage.report("rename tag '%v' to '%v'", storage.describeTag(tx, tagId), name)
+	}
+
+	previous, err := tx.tx.Tag(tagId)
+	if err != nil {
+		return nil, err
+	}
+	if previous != nil {
+		if err := storage.journal(tx, entities.JournalEntry{Action: entities.JournalRenameTag, TagId: tagId, Name: previous.Name}); err != nil {
+			return nil, err
+		}
+	}
+
+	tx.cache.clearTags()
+
+	return tx.tx.RenameTag(tagId, name)
 }
 
 // Copies a tag.
 func (storage Storage) CopyTag(tx *Tx, sourceTagId entities.TagId, name string) (*entities.Tag, error) {
-	if err := validateTagName(name); err != nil {
+	policy, err := storage.namePolicy(tx)
+	if err != nil {
 		return nil, err
 	}
 
-	tag, err := database.InsertTag(tx.tx, name)
+	if err := validateTagName(name, policy); err != nil {
+		return nil, err
+	}
+
+	tag, err := storage.AddTag(tx, name)
 	if err != nil {
 		return nil, fmt.Errorf("could not create tag '%v': %v", name, err)
 	}
 
-	err = database.CopyFileTags(tx.tx, sourceTagId, tag.Id)
+	err = storage.CopyFileTags(tx, sourceTagId, tag.Id)
 	if err != nil {
 		return nil, fmt.Errorf("could not copy file tags for tag #%v to tag '%v': %v", sourceTagId, name, err)
 	}
@@ -97,7 +160,27 @@ func (storage Storage) DeleteTag(tx *Tx, tagId entities.TagId) error {
 		return err
 	}
 
-	err = database.DeleteTag(tx.tx, tagId)
+	if storage.DryRun {
+		storage.report("delete tag '%v'", storage.describeTag(tx, tagId))
+	}
+
+	tag, err := tx.tx.Tag(tagId)
+	if err != nil {
+		return err
+	}
+	if tag != nil {
+		if err := storage.journal(tx, entities.JournalEntry{Action: entities.JournalDeleteTag, TagId: tagId, Name: tag.Name}); err != nil {
+			return err
+		}
+	}
+
+	if err := tx.tx.DeleteExclusionsForTagId(tagId); err != nil {
+		return err
+	}
+
+	tx.cache.clearTags()
+
+	err = tx.tx.DeleteTag(tagId)
 	if err != nil {
 		return fmt.Errorf("could not delete tag '%v': %v", tagId, err)
 	}
@@ -107,14 +190,14 @@ func (storage Storage) DeleteTag(tx *Tx, tagId entities.TagId) error {
 
 // Retrieves the tag usage.
 func (storage Storage) TagUsage(tx *Tx) ([]entities.TagFileCount, error) {
-	return database.TagUsage(tx.tx)
+	return tx.tx.TagUsage()
 }
 
 // unexported
 
 var validTagChars = []*unicode.RangeTable{unicode.Letter, unicode.Number, unicode.Punct, unicode.Symbol}
 
-func validateTagName(tagName string) error {
+func validateTagName(tagName string, policy namePolicy) error {
 	switch tagName {
 	case "":
 		return errors.New("tag name cannot be empty.")
@@ -126,8 +209,8 @@ func validateTagName(tagName string) error {
 		return errors.New("tag name cannot be a comparison operator: 'eq', 'ne', 'gt', 'lt', 'ge' or 'le'.") // used in query language
 	}
 
-	if tagName[0] == '-' {
-		return errors.New("tag name cannot start with a minus: '-'.") // used in query language
+	if tagName[0] == ' ' || tagName[len(tagName)-1] == ' ' {
+		return errors.New("tag name cannot start or end with a space.")
 	}
 
 	for _, ch := range tagName {
@@ -138,12 +221,22 @@ func validateTagName(tagName string) error {
 			return errors.New("tag names cannot contain comma: ','.") // reserved for tag delimiter
 		case '=', '!', '<', '>':
 			return errors.New("tag names cannot contain a comparison operator: '=', '!', '<' or '>'.") // reserved for tag values
-		case ' ', '\t':
+		case ' ':
+			if policy.allowSpaces {
+				continue
+			}
+
+			return errors.New("tag names cannot contain space or tab.") // used as tag delimiter
+		case '\t':
 			return errors.New("tag names cannot contain space or tab.") // used as tag delimiter
 		case '/':
 			return errors.New("tag names cannot contain slash: '/'.") // cannot be used in the VFS
 		}
 
+		if strings.ContainsRune(policy.reserved, ch) {
+			return fmt.Errorf("tag names cannot contain '%c': reserved by the '%v' setting.", ch, reservedCharsSettingName)
+		}
+
 		if !unicode.IsOneOf(validTagChars, ch) {
 			return fmt.Errorf("tag names cannot contain '%c'.", ch)
 		}
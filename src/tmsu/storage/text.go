@@ -0,0 +1,635 @@
+// Copyright 2011-2015 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package storage
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"tmsu/common/fingerprint"
+	"tmsu/common/log"
+	"tmsu/entities"
+)
+
+const textDatabaseSettingName = "textDatabase"
+
+// The markers of the tracking field of a file record, separated by commas,
+// for a file tracked by path only and for a virtual file.
+const (
+	textPathOnly = "path-only"
+	textVirtual  = "virtual"
+)
+
+const textHeader = "# TMSU text database: regenerate the SQLite database from this file with 'tmsu rebuild'."
+
+// The path of the text database maintained alongside the database.
+func (storage *Storage) TextPath() string {
+	return storage.DbPath + ".txt"
+}
+
+// Writes the database's contents to a text file with one sorted line per
+// setting, tag, value, implication, exclusion, query, file, further file
+// fingerprint, tagging and note.
+func (storage *Storage) WriteText(tx *Tx, path string) error {
+	return writeText(tx.tx, path)
+}
+
+// Replaces the database's contents with those read from a text file written
+// by WriteText.
+func (storage *Storage) Rebuild(tx *Tx, path string) error {
+	records, err := readText(path)
+	if err != nil {
+		return err
+	}
+
+	if storage.DryRun {
+		storage.report("rebuild database from '%v'", path)
+	}
+
+	if err := tx.tx.Clear(); err != nil {
+		return fmt.Errorf("could not clear database: %v", err)
+	}
+
+	tx.cache.clear()
+
+	builder := rebuilder{tx.tx, path, make(map[string]entities.TagId), make(map[string]entities.ValueId), make(map[string]entities.FileId), make(map[string]bool), nil}
+
+	// dependencies first, regardless of the order of the lines
+	for _, kind := range []string{"setting", "tag", "value", "file", "fingerprint", "implication", "exclusion", "query", "filetag", "note"} {
+		for _, record := range records {
+			if record.fields[0] != kind {
+				continue
+			}
+
+			if err := builder.add(record); err != nil {
+				return fmt.Errorf("%v:%v: %v", path, record.line, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// unexported
+
+// Rewrites the text database if the textDatabase setting is enabled.
+func (storage *Storage) updateText() {
+	tx, err := storage.backend.Begin()
+	if err != nil {
+		log.Warnf("could not update text database: %v", err)
+		return
+	}
+	defer tx.Rollback()
+
+	setting, err := tx.Setting(textDatabaseSettingName)
+	if err != nil {
+		log.Warnf("could not update text database: %v", err)
+		return
+	}
+	if setting == nil || !(entities.Settings{setting}).TextDatabase() {
+		return
+	}
+
+	path := storage.TextPath()
+	if err := writeText(tx, path); err != nil {
+		log.Warnf("could not update text database '%v': %v", path, err)
+	}
+}
+
+func writeText(tx BackendTx, path string) error {
+	settings, err := tx.Settings()
+	if err != nil {
+		return err
+	}
+
+	tags, err := tx.Tags()
+	if err != nil {
+		return err
+	}
+
+	values, err := tx.Values()
+	if err != nil {
+		return err
+	}
+
+	implications, err := tx.Implications()
+	if err != nil {
+		return err
+	}
+
+	exclusions, err := tx.Exclusions()
+	if err != nil {
+		return err
+	}
+
+	queries, err := tx.Queries()
+	if err != nil {
+		return err
+	}
+
+	files, err := tx.Files("none")
+	if err != nil {
+		return err
+	}
+
+	volumes, err := tx.FileVolumes()
+	if err != nil {
+		return err
+	}
+
+	pathOnly, err := tx.PathOnlyFiles()
+	if err != nil {
+		return err
+	}
+
+	virtual, err := tx.VirtualFiles()
+	if err != nil {
+		return err
+	}
+
+	fingerprints, err := tx.FileFingerprints()
+	if err != nil {
+		return err
+	}
+
+	fileTags, err := tx.FileTags()
+	if err != nil {
+		return err
+	}
+
+	notes, err := tx.FileNotes()
+	if err != nil {
+		return err
+	}
+
+	sections := make([][]string, 0, 10)
+
+	lines := make([]string, 0, len(settings))
+	for _, setting := range settings {
+		if setting.Name != databaseIdSettingName {
+			lines = append(lines, textLine("setting", setting.Name, setting.Value))
+		}
+	}
+	sections = append(sections, lines)
+
+	tagNames := make(map[entities.TagId]string, len(tags))
+	lines = make([]string, len(tags))
+	for index, tag := range tags {
+		tagNames[tag.Id] = tag.Name
+		lines[index] = textLine("tag", tag.Name)
+	}
+	sections = append(sections, lines)
+
+	valueNames := map[entities.ValueId]string{0: ""}
+	lines = make([]string, len(values))
+	for index, value := range values {
+		valueNames[value.Id] = value.Name
+		lines[index] = textLine("value", value.Name)
+	}
+	sections = append(sections, lines)
+
+	lines = make([]string, len(implications))
+	for index, implication := range implications {
+		lines[index] = textLine("implication", implication.ImplyingTag.Name, implication.ImpliedTag.Name)
+	}
+	sections = append(sections, lines)
+
+	lines = make([]string, len(exclusions))
+	for index, exclusion := range exclusions {
+		lines[index] = textLine("exclusion", exclusion.Set, exclusion.Tag.Name)
+	}
+	sections = append(sections, lines)
+
+	lines = make([]string, len(queries))
+	for index, query := range queries {
+		lines[index] = textLine("query", query.Text)
+	}
+	sections = append(sections, lines)
+
+	paths := make(map[entities.FileId]string, len(files))
+	lines = make([]string, len(files))
+	for index, file := range files {
+		paths[file.Id] = file.Path()
+
+		kind := "file"
+		if file.IsDir {
+			kind = "dir"
+		}
+
+		markers := make([]string, 0, 2)
+		if pathOnly[file.Id] {
+			markers = append(markers, textPathOnly)
+		}
+		if virtual[file.Id] {
+			markers = append(markers, textVirtual)
+		}
+		tracking := strings.Join(markers, ",")
+
+		lines[index] = textLine("file", file.Path(), string(file.Fingerprint), formatTextTime(file.ModTime), strconv.FormatInt(file.Size, 10), kind, volumes[file.Id], tracking)
+	}
+	sections = append(sections, lines)
+
+	lines = make([]string, 0, len(fingerprints))
+	for fileId, fingerprintsByAlgorithm := range fingerprints {
+		for algorithm, fp := range fingerprintsByAlgorithm {
+			lines = append(lines, textLine("fingerprint", paths[fileId], algorithm, string(fp)))
+		}
+	}
+	sections = append(sections, lines)
+
+	lines = make([]string, len(fileTags))
+	for index, fileTag := range fileTags {
+		lines[index] = textLine("filetag", paths[fileTag.FileId], tagNames[fileTag.TagId], valueNames[fileTag.ValueId], fileTag.Username, formatTextTime(fileTag.Time))
+	}
+	sections = append(sections, lines)
+
+	lines = make([]string, 0, len(notes))
+	for fileId, text := range notes {
+		lines = append(lines, textLine("note", paths[fileId], text))
+	}
+	sections = append(sections, lines)
+
+	tempPath := path + ".tmp"
+	file, err := os.Create(tempPath)
+	if err != nil {
+		return err
+	}
+
+	writer := bufio.NewWriter(file)
+	fmt.Fprintln(writer, textHeader)
+	for _, lines := range sections {
+		sort.Strings(lines)
+		for _, line := range lines {
+			fmt.Fprintln(writer, line)
+		}
+	}
+
+	if err := writer.Flush(); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tempPath, path)
+}
+
+type textRecord struct {
+	line   int
+	fields []string
+}
+
+var textFieldCounts = map[string]int{
+	"setting":     3,
+	"tag":         2,
+	"value":       2,
+	"implication": 3,
+	"exclusion":   3,
+	"query":       2,
+	"file":        8,
+	"fingerprint": 4,
+	"filetag":     6,
+	"note":        3,
+}
+
+func readText(path string) ([]textRecord, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("could not open text database: %v", err)
+	}
+	defer file.Close()
+
+	records := make([]textRecord, 0, 100)
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		line := scanner.Text()
+		if line == "" || line[0] == '#' {
+			continue
+		}
+
+		fields := strings.Split(line, "\t")
+
+		count, ok := textFieldCounts[fields[0]]
+		if !ok {
+			return nil, fmt.Errorf("%v:%v: unknown record type '%v'", path, lineNumber, fields[0])
+		}
+		if len(fields) > count {
+			return nil, fmt.Errorf("%v:%v: too many fields for '%v'", path, lineNumber, fields[0])
+		}
+
+		// trailing empty fields are omitted
+		for len(fields) < count {
+			fields = append(fields, "")
+		}
+
+		for index, field := range fields {
+			fields[index] = unescapeTextField(field)
+		}
+
+		records = append(records, textRecord{lineNumber, fields})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("could not read text database: %v", err)
+	}
+
+	return records, nil
+}
+
+type rebuilder struct {
+	tx       BackendTx
+	path     string
+	tagIds   map[string]entities.TagId
+	valueIds map[string]entities.ValueId
+	fileIds  map[string]entities.FileId
+	tagged   map[string]bool
+	policy   *namePolicy // loaded once the settings have been added
+}
+
+func (builder *rebuilder) add(record textRecord) error {
+	fields := record.fields
+
+	switch fields[0] {
+	case "setting":
+		if err := ValidateSetting(fields[1], fields[2]); err != nil {
+			return err
+		}
+
+		_, err := builder.tx.UpdateSetting(fields[1], fields[2])
+		return err
+	case "tag":
+		_, err := builder.tagId(fields[1])
+		return err
+	case "value":
+		_, err := builder.valueId(fields[1])
+		return err
+	case "implication":
+		tagId, err := builder.tagId(fields[1])
+		if err != nil {
+			return err
+		}
+
+		impliedTagId, err := builder.tagId(fields[2])
+		if err != nil {
+			return err
+		}
+
+		return builder.tx.AddImplication(tagId, impliedTagId)
+	case "exclusion":
+		tagId, err := builder.tagId(fields[2])
+		if err != nil {
+			return err
+		}
+
+		return builder.tx.AddExclusion(fields[1], tagId)
+	case "query":
+		query, err := builder.tx.Query(fields[1])
+		if err != nil || query != nil {
+			return err
+		}
+
+		_, err = builder.tx.InsertQuery(fields[1])
+		return err
+	case "file":
+		return builder.addFile(fields[1:])
+	case "fingerprint":
+		fileId, ok := builder.fileIds[fields[1]]
+		if !ok {
+			return fmt.Errorf("no such file '%v'", fields[1])
+		}
+
+		return builder.tx.UpdateFileFingerprint(fileId, fields[2], fingerprint.Fingerprint(fields[3]))
+	case "filetag":
+		return builder.addFileTag(fields[1:])
+	case "note":
+		fileId, ok := builder.fileIds[fields[1]]
+		if !ok {
+			return fmt.Errorf("no such file '%v'", fields[1])
+		}
+
+		return builder.tx.UpdateFileNote(fileId, fields[2])
+	}
+
+	return nil
+}
+
+func (builder *rebuilder) addFile(fields []string) error {
+	path, fingerprintText, modTimeText, sizeText, kind, volume, tracking := fields[0], fields[1], fields[2], fields[3], fields[4], fields[5], fields[6]
+
+	if _, exists := builder.fileIds[path]; exists {
+		return fmt.Errorf("duplicate file '%v'", path)
+	}
+
+	modTime, err := parseTextTime(modTimeText)
+	if err != nil {
+		return fmt.Errorf("invalid modification time '%v'", modTimeText)
+	}
+
+	size, err := strconv.ParseInt(sizeText, 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid size '%v'", sizeText)
+	}
+
+	if kind != "file" && kind != "dir" {
+		return fmt.Errorf("invalid file type '%v': expected 'file' or 'dir'", kind)
+	}
+
+	pathOnly, virtual := false, false
+	if tracking != "" {
+		for _, marker := range strings.Split(tracking, ",") {
+			switch marker {
+			case textPathOnly:
+				pathOnly = true
+			case textVirtual:
+				virtual = true
+			default:
+				return fmt.Errorf("invalid tracking '%v': expected '%v' or '%v'", marker, textPathOnly, textVirtual)
+			}
+		}
+	}
+
+	file, err := builder.tx.InsertFile(path, fingerprint.Fingerprint(fingerprintText), modTime, size, kind == "dir")
+	if err != nil {
+		return err
+	}
+
+	if err := builder.tx.UpdateFileVolume(file.Id, volume); err != nil {
+		return err
+	}
+
+	if err := builder.tx.UpdateFilePathOnly(file.Id, pathOnly); err != nil {
+		return err
+	}
+
+	if err := builder.tx.UpdateFileVirtual(file.Id, virtual); err != nil {
+		return err
+	}
+
+	builder.fileIds[path] = file.Id
+
+	return nil
+}
+
+func (builder *rebuilder) addFileTag(fields []string) error {
+	path, tagName, valueName, username, timeText := fields[0], fields[1], fields[2], fields[3], fields[4]
+
+	// duplicates arise when merging changes to the text
+	key := strings.Join(fields[0:3], "\t")
+	if builder.tagged[key] {
+		return nil
+	}
+
+	fileId, ok := builder.fileIds[path]
+	if !ok {
+		return fmt.Errorf("no such file '%v'", path)
+	}
+
+	tagId, err := builder.tagId(tagName)
+	if err != nil {
+		return err
+	}
+
+	var valueId entities.ValueId
+	if valueName != "" {
+		valueId, err = builder.valueId(valueName)
+		if err != nil {
+			return err
+		}
+	}
+
+	taggedAt, err := parseTextTime(timeText)
+	if err != nil {
+		return fmt.Errorf("invalid time '%v'", timeText)
+	}
+
+	if _, err := builder.tx.AddFileTag(fileId, tagId, valueId, username, taggedAt); err != nil {
+		return err
+	}
+
+	builder.tagged[key] = true
+
+	return nil
+}
+
+func (builder *rebuilder) tagId(name string) (entities.TagId, error) {
+	if tagId, ok := builder.tagIds[name]; ok {
+		return tagId, nil
+	}
+
+	policy, err := builder.namePolicy()
+	if err != nil {
+		return 0, err
+	}
+
+	if err := validateTagName(name, policy); err != nil {
+		return 0, err
+	}
+
+	tag, err := builder.tx.InsertTag(name)
+	if err != nil {
+		return 0, err
+	}
+
+	builder.tagIds[name] = tag.Id
+
+	return tag.Id, nil
+}
+
+func (builder *rebuilder) valueId(name string) (entities.ValueId, error) {
+	if valueId, ok := builder.valueIds[name]; ok {
+		return valueId, nil
+	}
+
+	policy, err := builder.namePolicy()
+	if err != nil {
+		return 0, err
+	}
+
+	if err := validateValueName(name, policy); err != nil {
+		return 0, err
+	}
+
+	value, err := builder.tx.InsertValue(name)
+	if err != nil {
+		return 0, err
+	}
+
+	builder.valueIds[name] = value.Id
+
+	return value.Id, nil
+}
+
+// The name policy of the database being rebuilt, read once from its settings.
+func (builder *rebuilder) namePolicy() (namePolicy, error) {
+	if builder.policy == nil {
+		settings, err := builder.tx.Settings()
+		if err != nil {
+			return namePolicy{}, err
+		}
+
+		policy := newNamePolicy(settings)
+		builder.policy = &policy
+	}
+
+	return *builder.policy, nil
+}
+
+// Joins the fields with tabs, omitting trailing empty fields.
+func textLine(fields ...string) string {
+	for len(fields) > 1 && fields[len(fields)-1] == "" {
+		fields = fields[:len(fields)-1]
+	}
+
+	for index, field := range fields {
+		fields[index] = escapeTextField(field)
+	}
+
+	return strings.Join(fields, "\t")
+}
+
+var textFieldEscaper = strings.NewReplacer(`\`, `\\`, "\t", `\t`, "\n", `\n`, "\r", `\r`)
+
+var textFieldUnescaper = strings.NewReplacer(`\\`, `\`, `\t`, "\t", `\n`, "\n", `\r`, "\r")
+
+func escapeTextField(field string) string {
+	return textFieldEscaper.Replace(field)
+}
+
+func unescapeTextField(field string) string {
+	return textFieldUnescaper.Replace(field)
+}
+
+func formatTextTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+
+	return t.UTC().Format(time.RFC3339Nano)
+}
+
+func parseTextTime(text string) (time.Time, error) {
+	if text == "" {
+		return time.Time{}, nil
+	}
+
+	return time.Parse(time.RFC3339Nano, text)
+}
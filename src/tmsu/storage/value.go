@@ -18,34 +18,40 @@ package storage
 import (
 	"errors"
 	"fmt"
+	"sort"
+	"strings"
 	"tmsu/entities"
-	"tmsu/storage/database"
 	"unicode"
 )
 
 // Retrievse the count of values.
 func (storage *Storage) ValueCount(tx *Tx) (uint, error) {
-	return database.ValueCount(tx.tx)
+	return tx.tx.ValueCount()
 }
 
 // Retrieves the complete set of values.
 func (storage *Storage) Values(tx *Tx) (entities.Values, error) {
-	return database.Values(tx.tx)
+	values, err := tx.tx.Values()
+	if err == nil && isCollated() {
+		sort.Sort(values)
+	}
+
+	return values, err
 }
 
 // Retrieves a specific value.
 func (storage *Storage) Value(tx *Tx, id entities.ValueId) (*entities.Value, error) {
-	return database.Value(tx.tx, id)
+	return tx.tx.Value(id)
 }
 
 // Retrieves a specific set of values.
 func (storage Storage) ValuesByIds(tx *Tx, ids entities.ValueIds) (entities.Values, error) {
-	return database.ValuesByIds(tx.tx, ids)
+	return tx.tx.ValuesByIds(ids)
 }
 
 // Retrievse the set of unused values.
 func (storage *Storage) UnusedValues(tx *Tx) (entities.Values, error) {
-	return database.UnusedValues(tx.tx)
+	return tx.tx.UnusedValues()
 }
 
 // Retrieves a specific value by name.
@@ -54,26 +60,54 @@ func (storage *Storage) ValueByName(tx *Tx, name string) (*entities.Value, error
 		return &entities.Value{0, ""}, nil
 	}
 
-	return database.ValueByName(tx.tx, name)
+	return tx.tx.ValueByName(name)
 }
 
 // Retrieves the set of values for the specified tag.
 func (storage *Storage) ValuesByTag(tx *Tx, tagId entities.TagId) (entities.Values, error) {
-	return database.ValuesByTagId(tx.tx, tagId)
+	values, err := tx.tx.ValuesByTagId(tagId)
+	if err == nil && isCollated() {
+		sort.Sort(values)
+	}
+
+	return values, err
+}
+
+// Retrieves the usage of each of the tag's values.
+func (storage *Storage) ValueUsage(tx *Tx, tagId entities.TagId) ([]entities.ValueFileCount, error) {
+	return tx.tx.ValueUsageByTagId(tagId)
 }
 
 // Retrieves the set of values with the specified names.
 func (storage *Storage) ValuesByNames(tx *Tx, names []string) (entities.Values, error) {
-	return database.ValuesByNames(tx.tx, names)
+	return tx.tx.ValuesByNames(names)
 }
 
 // Adds a value.
 func (storage *Storage) AddValue(tx *Tx, name string) (*entities.Value, error) {
-	if err := validateValueName(name); err != nil {
+	policy, err := storage.namePolicy(tx)
+	if err != nil {
 		return nil, err
 	}
 
-	return database.InsertValue(tx.tx, name)
+	if err := validateValueName(name, policy); err != nil {
+		return nil, err
+	}
+
+	if storage.DryRun {
+		storage.report("create value '%v'", name)
+	}
+
+	value, err := tx.tx.InsertValue(name)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := storage.journal(tx, entities.JournalEntry{Action: entities.JournalAddValue, ValueId: value.Id}); err != nil {
+		return nil, err
+	}
+
+	return value, nil
 }
 
 // Deletes a value.
@@ -83,13 +117,25 @@ func (storage *Storage) DeleteValue(tx *Tx, valueId entities.ValueId) error {
 		return err
 	}
 
+	if storage.DryRun {
+		storage.report("delete value '%v' and %v tagging(s) using it", storage.describeValue(tx, valueId), len(fileTags))
+	}
+
+	if err := storage.journalFileTags(tx, entities.JournalDeleteFileTag, fileTags); err != nil {
+		return err
+	}
+
 	for _, fileTag := range fileTags {
-		if err := database.DeleteFileTag(tx.tx, fileTag.FileId, fileTag.TagId, fileTag.ValueId); err != nil {
+		if err := tx.tx.DeleteFileTag(fileTag.FileId, fileTag.TagId, fileTag.ValueId); err != nil {
 			return err
 		}
 	}
 
-	return database.DeleteValue(tx.tx, valueId)
+	if err := storage.journalValueDeletion(tx, valueId); err != nil {
+		return err
+	}
+
+	return tx.tx.DeleteValue(valueId)
 }
 
 // Deletes the value if it is unused.
@@ -103,7 +149,15 @@ func (storage *Storage) DeleteValueIfUnused(tx *Tx, valueId entities.ValueId) er
 		return err
 	}
 	if count == 0 {
-		if err := database.DeleteValue(tx.tx, valueId); err != nil {
+		if storage.DryRun {
+			storage.report("delete unused value '%v'", storage.describeValue(tx, valueId))
+		}
+
+		if err := storage.journalValueDeletion(tx, valueId); err != nil {
+			return err
+		}
+
+		if err := tx.tx.DeleteValue(valueId); err != nil {
 			return err
 		}
 	}
@@ -113,14 +167,48 @@ func (storage *Storage) DeleteValueIfUnused(tx *Tx, valueId entities.ValueId) er
 
 // Deletes unused values.
 func (storage *Storage) DeleteUnusedValues(tx *Tx, valueIds entities.ValueIds) error {
-	return database.DeleteUnusedValues(tx.tx, valueIds)
+	for _, valueId := range valueIds {
+		if valueId == 0 {
+			continue
+		}
+
+		count, err := storage.FileTagCountByValueId(tx, valueId)
+		if err != nil {
+			return err
+		}
+		if count != 0 {
+			continue
+		}
+
+		if storage.DryRun {
+			storage.report("delete unused value '%v'", storage.describeValue(tx, valueId))
+		}
+
+		if err := storage.journalValueDeletion(tx, valueId); err != nil {
+			return err
+		}
+	}
+
+	return tx.tx.DeleteUnusedValues(valueIds)
 }
 
 // unexported
 
+func (storage *Storage) journalValueDeletion(tx *Tx, valueId entities.ValueId) error {
+	value, err := tx.tx.Value(valueId)
+	if err != nil {
+		return err
+	}
+	if value == nil {
+		return nil
+	}
+
+	return storage.journal(tx, entities.JournalEntry{Action: entities.JournalDeleteValue, ValueId: valueId, Name: value.Name})
+}
+
 var validValueChars = []*unicode.RangeTable{unicode.Letter, unicode.Number, unicode.Punct, unicode.Symbol}
 
-func validateValueName(valueName string) error {
+func validateValueName(valueName string, policy namePolicy) error {
 	switch valueName {
 	case "":
 		return errors.New("tag value cannot be empty.")
@@ -132,6 +220,10 @@ func validateValueName(valueName string) error {
 		return errors.New("tag value cannot be a comparison operator: 'eq', 'ne', 'lt', 'gt', 'le' or 'ge'.") // used in query language
 	}
 
+	if valueName[0] == ' ' || valueName[len(valueName)-1] == ' ' {
+		return errors.New("tag value cannot start or end with a space.")
+	}
+
 	for _, ch := range valueName {
 		switch ch {
 		case '(', ')':
@@ -140,12 +232,22 @@ func validateValueName(valueName string) error {
 			return errors.New("tag value cannot contain comma: ','.") // reserved for tag delimiter
 		case '=', '!', '<', '>':
 			return errors.New("tag value cannot contain a comparison operator: '=', '!', '<' or '>'.") // reserved for tag values
-		case ' ', '\t':
+		case ' ':
+			if policy.allowSpaces {
+				continue
+			}
+
+			return errors.New("tag value cannot contain space or tab.") // used as tag delimiter
+		case '\t':
 			return errors.New("tag value cannot contain space or tab.") // used as tag delimiter
 		case '/':
 			return errors.New("tag value cannot contain slash: '/'.") // cannot be used in the VFS
 		}
 
+		if strings.ContainsRune(policy.reserved, ch) {
+			return fmt.Errorf("tag value cannot contain '%c': reserved by the '%v' setting.", ch, reservedCharsSettingName)
+		}
+
 		if !unicode.IsOneOf(validValueChars, ch) {
 			return fmt.Errorf("tag value cannot contain '%c'.", ch)
 		}
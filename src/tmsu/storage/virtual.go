@@ -0,0 +1,44 @@
+// Copyright 2011-2015 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package storage
+
+import (
+	"tmsu/entities"
+)
+
+// Determines whether the specified file is virtual, i.e. tracked although it
+// does not exist, as when tagged with 'tag --force'.
+func (storage *Storage) FileVirtual(tx *Tx, fileId entities.FileId) (bool, error) {
+	return tx.tx.FileVirtual(fileId)
+}
+
+// Retrieves the set of virtual files.
+func (storage *Storage) VirtualFiles(tx *Tx) (map[entities.FileId]bool, error) {
+	return tx.tx.VirtualFiles()
+}
+
+// Records whether the specified file is virtual.
+func (storage *Storage) UpdateFileVirtual(tx *Tx, fileId entities.FileId, virtual bool) error {
+	if storage.DryRun {
+		if virtual {
+			storage.report("mark '%v' as virtual", storage.describeFile(tx, fileId))
+		} else {
+			storage.report("mark '%v' as existing", storage.describeFile(tx, fileId))
+		}
+	}
+
+	return tx.tx.UpdateFileVirtual(fileId, virtual)
+}
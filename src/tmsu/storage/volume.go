@@ -0,0 +1,39 @@
+// Copyright 2011-2015 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package storage
+
+import (
+	"tmsu/common/filesystem"
+	"tmsu/entities"
+)
+
+// Retrieves the identifier of the volume the specified file was on when last recorded.
+func (storage *Storage) FileVolume(tx *Tx, fileId entities.FileId) (string, error) {
+	return tx.tx.FileVolume(fileId)
+}
+
+// Determines whether the specified file is on a volume that is not currently mounted.
+func (storage *Storage) FileOffline(tx *Tx, fileId entities.FileId) (bool, error) {
+	volume, err := tx.tx.FileVolume(fileId)
+	if err != nil {
+		return false, err
+	}
+	if volume == "" {
+		return false, nil
+	}
+
+	return !filesystem.VolumeMounted(volume), nil
+}
@@ -0,0 +1,66 @@
+// Copyright 2011-2015 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+// +build !windows
+
+package vfs
+
+import (
+	"sync"
+	"time"
+)
+
+// Records when the virtual filesystem was last accessed.
+type activity struct {
+	mutex sync.Mutex
+	last  time.Time
+}
+
+func newActivity() *activity {
+	return &activity{last: time.Now()}
+}
+
+func (activity *activity) touch() {
+	if activity == nil {
+		return
+	}
+
+	activity.mutex.Lock()
+	defer activity.mutex.Unlock()
+
+	activity.last = time.Now()
+}
+
+// The time since the virtual filesystem was last accessed.
+func (activity *activity) idleFor() time.Duration {
+	activity.mutex.Lock()
+	defer activity.mutex.Unlock()
+
+	return time.Since(activity.last)
+}
+
+// How often to check whether the idle timeout has expired: often enough that
+// the virtual filesystem is unmounted soon after.
+func idleCheckInterval(idleTimeout time.Duration) time.Duration {
+	interval := idleTimeout / 10
+	if interval < time.Second {
+		interval = time.Second
+	}
+	if interval > time.Minute {
+		interval = time.Minute
+	}
+
+	return interval
+}
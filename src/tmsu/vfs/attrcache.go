@@ -0,0 +1,90 @@
+// Copyright 2011-2015 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+// +build !windows
+
+package vfs
+
+import (
+	"github.com/hanwen/go-fuse/fuse"
+	"sync"
+	"time"
+	"tmsu/entities"
+)
+
+// Caches the attributes of the file symlinks so that listing a directory does
+// not query the database and stat each file every time.
+type attrCache struct {
+	timeout time.Duration
+	mutex   sync.Mutex
+	entries map[entities.FileId]attrCacheEntry
+}
+
+type attrCacheEntry struct {
+	attr    *fuse.Attr
+	expires time.Time
+}
+
+func newAttrCache(timeout time.Duration) *attrCache {
+	return &attrCache{timeout: timeout, entries: make(map[entities.FileId]attrCacheEntry)}
+}
+
+// Retrieves the file's cached attributes, or nil if they have not been cached
+// or have expired.
+func (cache *attrCache) get(fileId entities.FileId) *fuse.Attr {
+	if cache == nil || cache.timeout <= 0 {
+		return nil
+	}
+
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+
+	entry, ok := cache.entries[fileId]
+	if !ok {
+		return nil
+	}
+	if time.Now().After(entry.expires) {
+		delete(cache.entries, fileId)
+		return nil
+	}
+
+	// copy so that callers cannot amend the cached attributes
+	attr := *entry.attr
+	return &attr
+}
+
+func (cache *attrCache) put(fileId entities.FileId, attr *fuse.Attr) {
+	if cache == nil || cache.timeout <= 0 {
+		return
+	}
+
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+
+	copied := *attr
+	cache.entries[fileId] = attrCacheEntry{&copied, time.Now().Add(cache.timeout)}
+}
+
+// Discards the file's cached attributes, e.g. once it has been untagged.
+func (cache *attrCache) remove(fileId entities.FileId) {
+	if cache == nil {
+		return
+	}
+
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+
+	delete(cache.entries, fileId)
+}
@@ -28,7 +28,9 @@ import (
 	"strings"
 	"syscall"
 	"time"
+	"tmsu/api"
 	"tmsu/common/log"
+	"tmsu/common/thumbnail"
 	"tmsu/entities"
 	"tmsu/query"
 	"tmsu/storage"
@@ -52,6 +54,14 @@ Descend the tag directories to hone in on the files you want:
     edam_blanc.14  funghi.11  margherita.7  mushroom  pino_cheddar.12  tomato  wine
     $ ls cheese/tomato
     margherita.7
+
+Tags with values have a subdirectory for each value, and an '=unset' directory
+for the files that have the tag without a value:
+
+    $ ls year
+    2014  2015  =unset  cheese  margherita.7
+    $ ls year/2014
+    cheese  margherita.7
     
 The tags directory also allows some operations to be performed:
 
@@ -62,6 +72,18 @@ The tags directory also allows some operations to be performed:
   
 (This file will hide once you have created a few tags.)`
 
+// Holds the files that have the parent tag directory's tag without a value.
+const unsetValueDir = "=unset"
+
+// Holds a symlink to a cached thumbnail for each image and video file, named
+// after the file's link name in the tag directories with '.png' appended.
+const thumbnailsDir = ".thumbnails"
+const thumbnailExtension = ".png"
+
+// Holds a symlink to each file tagged in the last week.
+const recentDir = ".recent"
+const recentDays = 7
+
 const queriesDir = "queries"
 const queryDirHelp = `Query Directories
 -----------------
@@ -90,13 +112,21 @@ type FuseVfs struct {
 	store     *storage.Storage
 	mountPath string
 	server    *fuse.Server
+	attrs     *attrCache
+	activity  *activity
 }
 
 func MountVfs(store *storage.Storage, mountPath string, options []string) (*FuseVfs, error) {
-	fuseVfs := FuseVfs{nil, "", nil}
+	fuseVfs := FuseVfs{nil, "", nil, nil, nil}
+
+	timeout, err := cacheTimeout(store)
+	if err != nil {
+		return nil, err
+	}
 
 	pathFs := pathfs.NewPathNodeFs(&fuseVfs, nil)
-	conn := nodefs.NewFileSystemConnector(pathFs.Root(), nil)
+	connectorOptions := &nodefs.Options{EntryTimeout: timeout, AttrTimeout: timeout, NegativeTimeout: timeout}
+	conn := nodefs.NewFileSystemConnector(pathFs.Root(), connectorOptions)
 	mountOptions := &fuse.MountOptions{Options: options}
 
 	server, err := fuse.NewServer(conn.RawFS(), mountPath, mountOptions)
@@ -107,6 +137,8 @@ func MountVfs(store *storage.Storage, mountPath string, options []string) (*Fuse
 	fuseVfs.store = store
 	fuseVfs.mountPath = mountPath
 	fuseVfs.server = server
+	fuseVfs.attrs = newAttrCache(timeout)
+	fuseVfs.activity = newActivity()
 
 	return &fuseVfs, nil
 }
@@ -119,6 +151,43 @@ func (vfs FuseVfs) Serve() {
 	vfs.server.Serve()
 }
 
+// Serves requests until the virtual filesystem is unmounted or, if idleTimeout
+// is non-zero, it has not been accessed for that long, whereupon it unmounts
+// itself. A busy virtual filesystem is not unmounted.
+func (vfs FuseVfs) ServeUntilIdle(idleTimeout time.Duration) {
+	if idleTimeout <= 0 {
+		vfs.Serve()
+		return
+	}
+
+	done := make(chan struct{})
+	defer close(done)
+
+	go func() {
+		ticker := time.NewTicker(idleCheckInterval(idleTimeout))
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				if vfs.activity.idleFor() < idleTimeout {
+					continue
+				}
+
+				log.Info(1, "idle timeout expired: unmounting")
+				if err := vfs.server.Unmount(); err != nil {
+					log.Infof(1, "could not unmount: %v", err)
+					vfs.activity.touch()
+				}
+			}
+		}
+	}()
+
+	vfs.Serve()
+}
+
 func (vfs FuseVfs) SetDebug(debug bool) {
 	vfs.SetDebug(debug)
 }
@@ -155,6 +224,8 @@ func (vfs FuseVfs) GetAttr(name string, context *fuse.Context) (*fuse.Attr, fuse
 	log.Infof(2, "BEGIN GetAttr(%v)", name)
 	defer log.Infof(2, "END GetAttr(%v)", name)
 
+	vfs.activity.touch()
+
 	switch name {
 	case databaseFilename:
 		return vfs.getDatabaseFileAttr()
@@ -162,7 +233,7 @@ func (vfs FuseVfs) GetAttr(name string, context *fuse.Context) (*fuse.Attr, fuse
 		fallthrough
 	case tagsDir:
 		return vfs.getTagsAttr()
-	case queriesDir:
+	case queriesDir, thumbnailsDir, recentDir:
 		return vfs.getQueryAttr()
 	}
 
@@ -173,6 +244,10 @@ func (vfs FuseVfs) GetAttr(name string, context *fuse.Context) (*fuse.Attr, fuse
 		return vfs.getTaggedEntryAttr(path[1:])
 	case queriesDir:
 		return vfs.getQueryEntryAttr(path[1:])
+	case thumbnailsDir:
+		return vfs.getThumbnailEntryAttr(path[1:])
+	case recentDir:
+		return vfs.getRecentEntryAttr(path[1:])
 	}
 
 	return nil, fuse.ENOENT
@@ -199,7 +274,7 @@ func (vfs FuseVfs) ListXAttr(name string, context *fuse.Context) ([]string, fuse
 	return nil, fuse.ENOSYS
 }
 
-func (vfs FuseVfs) Mkdir(name string, mode uint32, context *fuse.Context) fuse.Status {
+func (vfs FuseVfs) Mkdir(name string, mode uint32, context *fuse.Context) (code fuse.Status) {
 	log.Infof(2, "BEGIN Mkdir(%v)", name)
 	defer log.Infof(2, "END Mkdir(%v)", name)
 
@@ -209,6 +284,12 @@ func (vfs FuseVfs) Mkdir(name string, mode uint32, context *fuse.Context) fuse.S
 		return fuse.EPERM
 	}
 
+	finish, status := vfs.lockForWriting("mkdir", name)
+	if status != fuse.OK {
+		return status
+	}
+	defer func() { finish(code) }()
+
 	tx, err := vfs.store.Begin()
 	if err != nil {
 		log.Fatalf("could not begin transaction: %v", err)
@@ -256,6 +337,8 @@ func (vfs FuseVfs) Open(name string, flags uint32, context *fuse.Context) (nodef
 	log.Infof(2, "BEGIN Open(%v)", name)
 	defer log.Infof(2, "END Open(%v)", name)
 
+	vfs.activity.touch()
+
 	switch name {
 	case filepath.Join(queriesDir, helpFilename):
 		return nodefs.NewDataFile([]byte(queryDirHelp)), fuse.OK
@@ -270,6 +353,8 @@ func (vfs FuseVfs) OpenDir(name string, context *fuse.Context) ([]fuse.DirEntry,
 	log.Infof(2, "BEGIN OpenDir(%v)", name)
 	defer log.Infof(2, "END OpenDir(%v)", name)
 
+	vfs.activity.touch()
+
 	tx, err := vfs.store.Begin()
 	if err != nil {
 		log.Fatalf("could not begin transaction: %v", err)
@@ -283,6 +368,10 @@ func (vfs FuseVfs) OpenDir(name string, context *fuse.Context) ([]fuse.DirEntry,
 		return vfs.tagDirectories(tx)
 	case queriesDir:
 		return vfs.queriesDirectories(tx)
+	case thumbnailsDir:
+		return vfs.thumbnailEntries(tx)
+	case recentDir:
+		return vfs.recentEntries(tx)
 	}
 
 	path := vfs.splitPath(name)
@@ -300,6 +389,8 @@ func (vfs FuseVfs) Readlink(name string, context *fuse.Context) (string, fuse.St
 	log.Infof(2, "BEGIN Readlink(%v)", name)
 	defer log.Infof(2, "END Readlink(%v)", name)
 
+	vfs.activity.touch()
+
 	tx, err := vfs.store.Begin()
 	if err != nil {
 		log.Fatalf("could not begin transaction: %v", err)
@@ -312,8 +403,10 @@ func (vfs FuseVfs) Readlink(name string, context *fuse.Context) (string, fuse.St
 
 	path := vfs.splitPath(name)
 	switch path[0] {
-	case tagsDir, queriesDir:
+	case tagsDir, queriesDir, recentDir:
 		return vfs.readTaggedEntryLink(tx, path[1:])
+	case thumbnailsDir:
+		return vfs.readThumbnailLink(tx, path[1:])
 	}
 
 	return "", fuse.ENOENT
@@ -326,10 +419,16 @@ func (vfs FuseVfs) RemoveXAttr(name string, attr string, context *fuse.Context)
 	return fuse.ENOSYS
 }
 
-func (vfs FuseVfs) Rename(oldName string, newName string, context *fuse.Context) fuse.Status {
+func (vfs FuseVfs) Rename(oldName string, newName string, context *fuse.Context) (code fuse.Status) {
 	log.Infof(2, "BEGIN Rename(%v, %v)", oldName, newName)
 	defer log.Infof(2, "END Rename(%v, %v)", oldName, newName)
 
+	finish, status := vfs.lockForWriting("rename", oldName, newName)
+	if status != fuse.OK {
+		return status
+	}
+	defer func() { finish(code) }()
+
 	tx, err := vfs.store.Begin()
 	if err != nil {
 		log.Fatalf("could not begin transaction: %v", err)
@@ -369,10 +468,16 @@ func (vfs FuseVfs) Rename(oldName string, newName string, context *fuse.Context)
 	return fuse.OK
 }
 
-func (vfs FuseVfs) Rmdir(name string, context *fuse.Context) fuse.Status {
+func (vfs FuseVfs) Rmdir(name string, context *fuse.Context) (code fuse.Status) {
 	log.Infof(2, "BEGIN Rmdir(%v)", name)
 	defer log.Infof(2, "END Rmdir(%v)", name)
 
+	finish, status := vfs.lockForWriting("rmdir", name)
+	if status != fuse.OK {
+		return status
+	}
+	defer func() { finish(code) }()
+
 	tx, err := vfs.store.Begin()
 	if err != nil {
 		log.Fatalf("could not begin transaction: %v", err)
@@ -468,10 +573,16 @@ func (vfs FuseVfs) Truncate(name string, offset uint64, context *fuse.Context) f
 	return fuse.ENOSYS
 }
 
-func (vfs FuseVfs) Unlink(name string, context *fuse.Context) fuse.Status {
+func (vfs FuseVfs) Unlink(name string, context *fuse.Context) (code fuse.Status) {
 	log.Infof(2, "BEGIN Unlink(%v)", name)
 	defer log.Infof(2, "END Unlink(%v)", name)
 
+	finish, status := vfs.lockForWriting("unlink", name)
+	if status != fuse.OK {
+		return status
+	}
+	defer func() { finish(code) }()
+
 	tx, err := vfs.store.Begin()
 	if err != nil {
 		log.Fatalf("could not begin transaction: %v", err)
@@ -496,16 +607,16 @@ func (vfs FuseVfs) Unlink(name string, context *fuse.Context) fuse.Status {
 
 	switch path[0] {
 	case tagsDir:
-		dirName := path[len(path)-2]
-
-		var tagName, valueName string
-		if dirName[0] == '=' {
-			tagName = path[len(path)-3]
-			valueName = dirName[1:len(dirName)]
-		} else {
-			tagName = dirName
-			valueName = ""
+		elements, err := vfs.parseTagPath(tx, path[1:len(path)-1])
+		if err != nil {
+			log.Fatal(err)
 		}
+		if len(elements) == 0 {
+			return fuse.EPERM
+		}
+
+		lastElement := elements[len(elements)-1]
+		tagName, valueName := lastElement.tagName, lastElement.valueName
 
 		tag, err := vfs.store.TagByName(tx, tagName)
 		if err != nil {
@@ -527,6 +638,8 @@ func (vfs FuseVfs) Unlink(name string, context *fuse.Context) fuse.Status {
 			log.Fatal(err)
 		}
 
+		vfs.attrs.remove(fileId)
+
 		if err := tx.Commit(); err != nil {
 			log.Fatalf("could not commit transaction: %v", err)
 		}
@@ -545,6 +658,34 @@ func (vfs FuseVfs) Utimens(name string, Atime *time.Time, Mtime *time.Time, cont
 
 // unexported
 
+// Takes the writer lock for a change to the database, failing with EBUSY
+// rather than waiting if another process is modifying it, and starts recording
+// the change in the audit log. The function returned, called with the outcome,
+// records the change and releases the lock.
+func (vfs FuseVfs) lockForWriting(operation string, names ...string) (func(fuse.Status), fuse.Status) {
+	lock, err := vfs.store.LockForWriting("tmsu mount ("+operation+")", false, nil)
+	if err != nil {
+		if lockedErr, ok := err.(storage.LockedError); ok {
+			log.Warnf("cannot %v: %v", operation, lockedErr)
+			return nil, fuse.EBUSY
+		}
+
+		log.Fatalf("could not lock database: %v", err)
+	}
+
+	finishAudit := vfs.store.StartAudit("mount", append([]string{operation}, names...))
+
+	return func(status fuse.Status) {
+		if status == fuse.OK {
+			finishAudit(nil)
+		} else {
+			finishAudit(fmt.Errorf("%v: %v", operation, status))
+		}
+
+		lock.Release()
+	}, fuse.OK
+}
+
 func (vfs FuseVfs) splitPath(path string) []string {
 	return strings.Split(path, string(filepath.Separator))
 }
@@ -577,7 +718,9 @@ func (vfs FuseVfs) topFiles() ([]fuse.DirEntry, fuse.Status) {
 	entries := []fuse.DirEntry{
 		fuse.DirEntry{Name: databaseFilename, Mode: fuse.S_IFLNK},
 		fuse.DirEntry{Name: tagsDir, Mode: fuse.S_IFDIR},
-		fuse.DirEntry{Name: queriesDir, Mode: fuse.S_IFDIR}}
+		fuse.DirEntry{Name: queriesDir, Mode: fuse.S_IFDIR},
+		fuse.DirEntry{Name: thumbnailsDir, Mode: fuse.S_IFDIR},
+		fuse.DirEntry{Name: recentDir, Mode: fuse.S_IFDIR}}
 	return entries, fuse.OK
 }
 
@@ -623,6 +766,47 @@ func (vfs FuseVfs) queriesDirectories(tx *storage.Tx) ([]fuse.DirEntry, fuse.Sta
 	return entries, fuse.OK
 }
 
+func (vfs FuseVfs) thumbnailEntries(tx *storage.Tx) ([]fuse.DirEntry, fuse.Status) {
+	log.Infof(2, "BEGIN thumbnailEntries")
+	defer log.Infof(2, "END thumbnailEntries")
+
+	files, err := vfs.store.Files(tx, "none")
+	if err != nil {
+		log.Fatalf("could not retrieve files: %v", err)
+	}
+
+	entries := make([]fuse.DirEntry, 0, len(files))
+	for _, file := range files {
+		if file.IsDir || !thumbnail.Supported(file.Path()) {
+			continue
+		}
+
+		linkName := vfs.getLinkName(file) + thumbnailExtension
+		entries = append(entries, fuse.DirEntry{Name: linkName, Mode: fuse.S_IFLNK})
+	}
+
+	return entries, fuse.OK
+}
+
+func (vfs FuseVfs) recentEntries(tx *storage.Tx) ([]fuse.DirEntry, fuse.Status) {
+	log.Infof(2, "BEGIN recentEntries")
+	defer log.Infof(2, "END recentEntries")
+
+	since := time.Now().AddDate(0, 0, -recentDays)
+	recent, err := api.RecentFiles(vfs.store, tx, since, false)
+	if err != nil {
+		log.Fatalf("could not retrieve recent files: %v", err)
+	}
+
+	entries := make([]fuse.DirEntry, len(recent))
+	for index, recentFile := range recent {
+		linkName := vfs.getLinkName(recentFile.File)
+		entries[index] = fuse.DirEntry{Name: linkName, Mode: fuse.S_IFLNK}
+	}
+
+	return entries, fuse.OK
+}
+
 func (vfs FuseVfs) getTagsAttr() (*fuse.Attr, fuse.Status) {
 	log.Infof(2, "BEGIN getTagsAttr")
 	defer log.Infof(2, "END getTagsAttr")
@@ -650,6 +834,38 @@ func (vfs FuseVfs) getQueryAttr() (*fuse.Attr, fuse.Status) {
 	return &fuse.Attr{Mode: fuse.S_IFDIR | 0755, Nlink: 2, Size: 0, Mtime: uint64(now.Unix()), Mtimensec: uint32(now.Nanosecond())}, fuse.OK
 }
 
+func (vfs FuseVfs) getThumbnailEntryAttr(path []string) (*fuse.Attr, fuse.Status) {
+	log.Infof(2, "BEGIN getThumbnailEntryAttr(%v)", path)
+	defer log.Infof(2, "END getThumbnailEntryAttr(%v)", path)
+
+	if len(path) != 1 || !strings.HasSuffix(path[0], thumbnailExtension) {
+		return nil, fuse.ENOENT
+	}
+
+	fileId := vfs.parseFileId(strings.TrimSuffix(path[0], thumbnailExtension))
+	if fileId == 0 {
+		return nil, fuse.ENOENT
+	}
+
+	return vfs.getFileEntryAttr(fileId)
+}
+
+func (vfs FuseVfs) getRecentEntryAttr(path []string) (*fuse.Attr, fuse.Status) {
+	log.Infof(2, "BEGIN getRecentEntryAttr(%v)", path)
+	defer log.Infof(2, "END getRecentEntryAttr(%v)", path)
+
+	if len(path) != 1 {
+		return nil, fuse.ENOENT
+	}
+
+	fileId := vfs.parseFileId(path[0])
+	if fileId == 0 {
+		return nil, fuse.ENOENT
+	}
+
+	return vfs.getFileEntryAttr(fileId)
+}
+
 func (vfs FuseVfs) getTaggedEntryAttr(path []string) (*fuse.Attr, fuse.Status) {
 	log.Infof(2, "BEGIN getTaggedEntryAttr(%v)", path)
 	defer log.Infof(2, "END getTaggedEntryAttr(%v)", path)
@@ -666,19 +882,24 @@ func (vfs FuseVfs) getTaggedEntryAttr(path []string) (*fuse.Attr, fuse.Status) {
 		return vfs.getFileEntryAttr(fileId)
 	}
 
-	tagNames := make([]string, 0, len(path))
-	for _, pathElement := range path {
-		if pathElement[0] != '=' {
-			tagNames = append(tagNames, pathElement)
-		}
-	}
-
 	tx, err := vfs.store.Begin()
 	if err != nil {
 		log.Fatalf("could not begin transaction: %v", err)
 	}
 	defer tx.Commit()
 
+	elements, err := vfs.parseTagPath(tx, path)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	tagNames := make([]string, 0, len(path))
+	for _, element := range elements {
+		if !element.isValue {
+			tagNames = append(tagNames, element.tagName)
+		}
+	}
+
 	tagIds, err := vfs.tagNamesToIds(tx, tagNames)
 	if err != nil {
 		log.Fatalf("could not lookup tag IDs: %v.", err)
@@ -765,7 +986,13 @@ func (vfs FuseVfs) getDatabaseFileAttr() (*fuse.Attr, fuse.Status) {
 	return &fuse.Attr{Mode: fuse.S_IFLNK | 0755, Size: uint64(fileInfo.Size()), Mtime: uint64(modTime.Unix()), Mtimensec: uint32(modTime.Nanosecond())}, fuse.OK
 }
 
+// Reports the attributes of the file the symlink points to, other than its type,
+// so that file managers show the file's size, times and permissions.
 func (vfs FuseVfs) getFileEntryAttr(fileId entities.FileId) (*fuse.Attr, fuse.Status) {
+	if attr := vfs.attrs.get(fileId); attr != nil {
+		return attr, fuse.OK
+	}
+
 	tx, err := vfs.store.Begin()
 	if err != nil {
 		log.Fatalf("could not begin transaction: %v", err)
@@ -780,42 +1007,49 @@ func (vfs FuseVfs) getFileEntryAttr(fileId entities.FileId) (*fuse.Attr, fuse.St
 		return &fuse.Attr{Mode: fuse.S_IFREG}, fuse.ENOENT
 	}
 
-	fileInfo, err := os.Stat(file.Path())
-	var size int64
-	var modTime time.Time
-	if err == nil {
-		size = fileInfo.Size()
-		modTime = fileInfo.ModTime()
-	} else {
-		size = 0
-		modTime = time.Time{}
+	attr := &fuse.Attr{Mode: fuse.S_IFLNK | 0755}
+	if fileInfo, err := os.Stat(file.Path()); err == nil {
+		if targetAttr := fuse.ToAttr(fileInfo); targetAttr != nil {
+			attr = targetAttr
+			attr.Mode = fuse.S_IFLNK | uint32(fileInfo.Mode().Perm())
+			attr.Nlink = 1
+		} else {
+			attr.Size = uint64(fileInfo.Size())
+			attr.SetTimes(nil, &file.ModTime, nil)
+		}
 	}
 
-	return &fuse.Attr{Mode: fuse.S_IFLNK | 0755, Size: uint64(size), Mtime: uint64(modTime.Unix()), Mtimensec: uint32(modTime.Nanosecond())}, fuse.OK
+	vfs.attrs.put(fileId, attr)
+
+	return attr, fuse.OK
 }
 
 func (vfs FuseVfs) openTaggedEntryDir(tx *storage.Tx, path []string) ([]fuse.DirEntry, fuse.Status) {
 	log.Infof(2, "BEGIN openTaggedEntryDir(%v)", path)
 	defer log.Infof(2, "END openTaggedEntryDir(%v)", path)
 
-	expression := pathToExpression(path)
-	files, err := vfs.store.QueryFiles(tx, expression, "", false, "name")
+	elements, err := vfs.parseTagPath(tx, path)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	expression := pathToExpression(elements)
+	files, err := vfs.store.QueryFiles(tx, expression, "", false, "name", 0)
 	if err != nil {
 		log.Fatalf("could not query files: %v", err)
 	}
 
-	lastPathElement := path[len(path)-1]
+	lastElement := elements[len(elements)-1]
 
-	var valueNames []string
-	if lastPathElement[0] != '=' {
-		tagName := lastPathElement
+	valueNames := []string{}
+	hasUnset := false
+	if !lastElement.isValue {
+		tagName := lastElement.tagName
 
-		valueNames, err = vfs.tagValueNamesForFiles(tx, tagName, files)
+		valueNames, hasUnset, err = vfs.tagValueNamesForFiles(tx, tagName, files)
 		if err != nil {
-			log.Fatalf("could not retrieve values for '%v': %v", err)
+			log.Fatalf("could not retrieve values for '%v': %v", tagName, err)
 		}
-	} else {
-		valueNames = []string{}
 	}
 
 	furtherTagNames, err := vfs.tagNamesForFiles(tx, files)
@@ -831,7 +1065,16 @@ func (vfs FuseVfs) openTaggedEntryDir(tx *storage.Tx, path []string) ([]fuse.Dir
 	}
 
 	for _, valueName := range valueNames {
-		entries = append(entries, fuse.DirEntry{Name: "=" + valueName, Mode: fuse.S_IFDIR | 0755})
+		if containsString(furtherTagNames, valueName) {
+			// the tag directory takes precedence: the value remains reachable as '=VALUE'
+			continue
+		}
+
+		entries = append(entries, fuse.DirEntry{Name: valueName, Mode: fuse.S_IFDIR | 0755})
+	}
+
+	if hasUnset {
+		entries = append(entries, fuse.DirEntry{Name: unsetValueDir, Mode: fuse.S_IFDIR | 0755})
 	}
 
 	for _, file := range files {
@@ -861,7 +1104,7 @@ func (vfs FuseVfs) openQueryEntryDir(tx *storage.Tx, path []string) ([]fuse.DirE
 		}
 	}
 
-	files, err := vfs.store.QueryFiles(tx, expression, "", false, "name")
+	files, err := vfs.store.QueryFiles(tx, expression, "", false, "name", 0)
 	if err != nil {
 		log.Fatalf("could not query files: %v", err)
 	}
@@ -901,6 +1144,38 @@ func (vfs FuseVfs) readTaggedEntryLink(tx *storage.Tx, path []string) (string, f
 	return file.Path(), fuse.OK
 }
 
+// Creates the file's thumbnail, if it is not already cached, so that the link
+// can resolve to it.
+func (vfs FuseVfs) readThumbnailLink(tx *storage.Tx, path []string) (string, fuse.Status) {
+	log.Infof(2, "BEGIN readThumbnailLink(%v)", path)
+	defer log.Infof(2, "END readThumbnailLink(%v)", path)
+
+	if len(path) != 1 || !strings.HasSuffix(path[0], thumbnailExtension) {
+		return "", fuse.ENOENT
+	}
+
+	fileId := vfs.parseFileId(strings.TrimSuffix(path[0], thumbnailExtension))
+	if fileId == 0 {
+		return "", fuse.ENOENT
+	}
+
+	file, err := vfs.store.File(tx, fileId)
+	if err != nil {
+		log.Fatalf("could not find file %v in database.", fileId)
+	}
+	if file == nil {
+		return "", fuse.ENOENT
+	}
+
+	thumbnailPath, err := api.Thumbnail(vfs.store, file)
+	if err != nil {
+		log.Warnf("%v", err)
+		return "", fuse.EIO
+	}
+
+	return thumbnailPath, fuse.OK
+}
+
 func (vfs FuseVfs) getLinkName(file *entities.File) string {
 	extension := filepath.Ext(file.Path())
 	fileName := filepath.Base(file.Path())
@@ -932,86 +1207,152 @@ func (vfs FuseVfs) tagNamesToIds(tx *storage.Tx, tagNames []string) (entities.Ta
 	return tagIds, nil
 }
 
-func (vfs FuseVfs) tagValueNamesForFiles(tx *storage.Tx, tagName string, files entities.Files) ([]string, error) {
+// Retrieves the distinct names of the values the files have for the tag, and
+// whether any of the files has the tag without a value.
+func (vfs FuseVfs) tagValueNamesForFiles(tx *storage.Tx, tagName string, files entities.Files) ([]string, bool, error) {
 	tag, err := vfs.store.TagByName(tx, tagName)
 	if err != nil {
 		log.Fatalf("could not look up tag '%v': %v", tagName, err)
 	}
 	if tag == nil {
-		return []string{}, nil
+		return []string{}, false, nil
 	}
 
-	valueNames := make([]string, 0, 10)
+	valueIds := make(entities.ValueIds, 0, 10)
+	hasUnset := false
 
 	for _, file := range files {
 		fileTags, err := vfs.store.FileTagsByFileId(tx, file.Id, false)
 		if err != nil {
-			return nil, fmt.Errorf("could not retrieve file-tags for file '%v': %v", file.Id, err)
+			return nil, false, fmt.Errorf("could not retrieve file-tags for file '%v': %v", file.Id, err)
 		}
 
-		valueIds := make(entities.ValueIds, len(fileTags))
-		for index, fileTag := range fileTags {
-			if fileTag.TagId == tag.Id {
-				valueIds[index] = fileTag.ValueId
+		for _, fileTag := range fileTags {
+			if fileTag.TagId != tag.Id {
+				continue
 			}
-		}
 
-		values, err := vfs.store.ValuesByIds(tx, valueIds)
-		if err != nil {
-			return nil, fmt.Errorf("could not retrieve values: %v", err)
+			if fileTag.ValueId == 0 {
+				hasUnset = true
+			} else {
+				valueIds = append(valueIds, fileTag.ValueId)
+			}
 		}
+	}
 
-		for _, value := range values {
-			valueNames = append(valueNames, value.Name)
-		}
+	values, err := vfs.store.ValuesByIds(tx, valueIds.Uniq())
+	if err != nil {
+		return nil, false, fmt.Errorf("could not retrieve values: %v", err)
 	}
 
-	return valueNames, nil
-}
+	valueNames := make([]string, len(values))
+	for index, value := range values {
+		valueNames[index] = value.Name
+	}
 
-func (vfs FuseVfs) tagNamesForFiles(tx *storage.Tx, files entities.Files) ([]string, error) {
-	tagNames := make([]string, 0, 10)
+	return valueNames, hasUnset, nil
+}
 
-	for _, file := range files {
-		fileTags, err := vfs.store.FileTagsByFileId(tx, file.Id, false)
-		if err != nil {
-			return nil, fmt.Errorf("could not retrieve file-tags for file '%v': %v", file.Id, err)
-		}
+// A tag directory path element: either a tag or one of the values of the
+// preceding tag.
+type tagPathElement struct {
+	tagName   string
+	valueName string
+	isValue   bool
+	isUnset   bool
+}
 
-		tagIds := make(entities.TagIds, len(fileTags))
-		for index, fileTag := range fileTags {
-			tagIds[index] = fileTag.TagId
-		}
+// Parses the tag directory path. An element following a tag names one of that
+// tag's values, either plainly or prefixed with '=', unless it is the name of a
+// tag itself; '=unset' stands for the tag without a value.
+func (vfs FuseVfs) parseTagPath(tx *storage.Tx, path []string) ([]tagPathElement, error) {
+	elements := make([]tagPathElement, 0, len(path))
 
-		tags, err := vfs.store.TagsByIds(tx, tagIds)
-		if err != nil {
-			return nil, fmt.Errorf("could not retrieve tags: %v", err)
+	for index, name := range path {
+		var previous *tagPathElement
+		if index > 0 && !elements[index-1].isValue {
+			previous = &elements[index-1]
 		}
 
-		for _, tag := range tags {
-			if !containsString(tagNames, tag.Name) {
-				tagNames = append(tagNames, tag.Name)
+		switch {
+		case previous != nil && name == unsetValueDir:
+			elements = append(elements, tagPathElement{previous.tagName, "", true, true})
+			continue
+		case previous != nil && name[0] == '=':
+			elements = append(elements, tagPathElement{previous.tagName, name[1:], true, false})
+			continue
+		case previous != nil:
+			isValue, err := vfs.isTagValue(tx, previous.tagName, name)
+			if err != nil {
+				return nil, err
+			}
+			if isValue {
+				elements = append(elements, tagPathElement{previous.tagName, name, true, false})
+				continue
 			}
 		}
+
+		elements = append(elements, tagPathElement{name, "", false, false})
+	}
+
+	return elements, nil
+}
+
+// Determines whether the name is one of the tag's values rather than a tag.
+func (vfs FuseVfs) isTagValue(tx *storage.Tx, tagName, name string) (bool, error) {
+	otherTag, err := vfs.store.TagByName(tx, name)
+	if err != nil {
+		return false, fmt.Errorf("could not retrieve tag '%v': %v", name, err)
+	}
+	if otherTag != nil {
+		return false, nil
+	}
+
+	tag, err := vfs.store.TagByName(tx, tagName)
+	if err != nil {
+		return false, fmt.Errorf("could not retrieve tag '%v': %v", tagName, err)
+	}
+	if tag == nil {
+		return false, nil
+	}
+
+	values, err := vfs.store.ValuesByTag(tx, tag.Id)
+	if err != nil {
+		return false, fmt.Errorf("could not retrieve values for tag '%v': %v", tagName, err)
+	}
+
+	return containsValue(values, name), nil
+}
+
+func (vfs FuseVfs) tagNamesForFiles(tx *storage.Tx, files entities.Files) ([]string, error) {
+	usage, err := api.TagUsage(vfs.store, tx, files, false)
+	if err != nil {
+		return nil, err
+	}
+
+	tagNames := make([]string, len(usage))
+	for index, tagStat := range usage {
+		tagNames[index] = tagStat.Name
 	}
 
 	return tagNames, nil
 }
 
-func pathToExpression(path []string) query.Expression {
+func pathToExpression(elements []tagPathElement) query.Expression {
 	var expression query.Expression = query.EmptyExpression{}
 
-	for index, element := range path {
+	for _, element := range elements {
 		var elementExpression query.Expression
 
-		if element[0] == '=' {
-			tagName := path[index-1]
-			valueName := element[1:len(element)]
-
-			elementExpression = query.ComparisonExpression{query.TagExpression{tagName}, "==", query.ValueExpression{valueName}}
-		} else {
-			tagName := element
-			elementExpression = query.TagExpression{tagName}
+		switch {
+		case element.isUnset:
+			// files with the tag but none of its values
+			anyValue := query.ComparisonExpression{query.TagExpression{element.tagName}, "==", query.ValueExpression{"*"}}
+			elementExpression = query.NotExpression{anyValue}
+		case element.isValue:
+			elementExpression = query.ComparisonExpression{query.TagExpression{element.tagName}, "==", query.ValueExpression{element.valueName}}
+		default:
+			elementExpression = query.TagExpression{element.tagName}
 		}
 
 		expression = query.AndExpression{expression, elementExpression}
@@ -1020,6 +1361,23 @@ func pathToExpression(path []string) query.Expression {
 	return expression
 }
 
+// The time for which attributes and directory entries are cached, from the
+// vfsCacheTimeout setting.
+func cacheTimeout(store *storage.Storage) (time.Duration, error) {
+	tx, err := store.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Commit()
+
+	settings, err := store.Settings(tx)
+	if err != nil {
+		return 0, fmt.Errorf("could not retrieve settings: %v", err)
+	}
+
+	return settings.VfsCacheTimeout(), nil
+}
+
 func fileIdToAscii(fileId entities.FileId) string {
 	return strconv.FormatUint(uint64(fileId), 10)
 }
@@ -1039,6 +1397,16 @@ func containsTag(tags entities.Tags, tagName string) bool {
 	return false
 }
 
+func containsValue(values entities.Values, name string) bool {
+	for _, value := range values {
+		if value.Name == name {
+			return true
+		}
+	}
+
+	return false
+}
+
 func containsString(values []string, value string) bool {
 	for _, v := range values {
 		if v == value {
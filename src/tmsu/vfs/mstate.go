@@ -0,0 +1,150 @@
+// Copyright 2011-2015 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+// +build !windows
+
+package vfs
+
+import (
+	"bufio"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// A mount recorded in the runtime state file by the process hosting it.
+type TrackedMount struct {
+	Pid          int
+	DatabasePath string
+	MountPath    string
+}
+
+// Whether the process hosting the mount is no longer running, e.g. because it
+// crashed, leaving the mount point disconnected.
+func (mount TrackedMount) Stale() bool {
+	err := syscall.Kill(mount.Pid, 0)
+	return err != nil && err != syscall.EPERM
+}
+
+// The path of the runtime state file listing the mounts hosted by this user's
+// 'tmsu vfs' processes: $XDG_RUNTIME_DIR/tmsu/mounts or, if XDG_RUNTIME_DIR is
+// not set, tmsu-UID/mounts in the temporary directory.
+func MountStatePath() string {
+	if runtimeDir := os.Getenv("XDG_RUNTIME_DIR"); runtimeDir != "" {
+		return filepath.Join(runtimeDir, "tmsu", "mounts")
+	}
+
+	return filepath.Join(os.TempDir(), "tmsu-"+strconv.Itoa(os.Getuid()), "mounts")
+}
+
+// Retrieves the mounts recorded in the runtime state file.
+func TrackedMounts() ([]TrackedMount, error) {
+	file, err := os.Open(MountStatePath())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return []TrackedMount{}, nil
+		}
+
+		return nil, fmt.Errorf("could not open mount state file: %v", err)
+	}
+	defer file.Close()
+
+	mounts := make([]TrackedMount, 0, 10)
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		parts := strings.SplitN(scanner.Text(), "\t", 3)
+		if len(parts) != 3 {
+			continue
+		}
+
+		pid, err := strconv.Atoi(parts[0])
+		if err != nil {
+			continue
+		}
+
+		mounts = append(mounts, TrackedMount{pid, parts[1], parts[2]})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("could not read mount state file: %v", err)
+	}
+
+	return mounts, nil
+}
+
+// Records that this process is hosting the database's mount at the mount path.
+func RecordMount(databasePath, mountPath string) error {
+	mounts, err := TrackedMounts()
+	if err != nil {
+		return err
+	}
+
+	mounts = withoutMount(mounts, mountPath)
+	mounts = append(mounts, TrackedMount{os.Getpid(), databasePath, mountPath})
+
+	return writeTrackedMounts(mounts)
+}
+
+// Removes the mount at the mount path from the runtime state file.
+func ForgetMount(mountPath string) error {
+	mounts, err := TrackedMounts()
+	if err != nil {
+		return err
+	}
+
+	return writeTrackedMounts(withoutMount(mounts, mountPath))
+}
+
+// unexported
+
+func withoutMount(mounts []TrackedMount, mountPath string) []TrackedMount {
+	remaining := make([]TrackedMount, 0, len(mounts))
+	for _, mount := range mounts {
+		if mount.MountPath != mountPath {
+			remaining = append(remaining, mount)
+		}
+	}
+
+	return remaining
+}
+
+func writeTrackedMounts(mounts []TrackedMount) error {
+	path := MountStatePath()
+
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return fmt.Errorf("could not create mount state directory: %v", err)
+	}
+
+	lines := make([]string, len(mounts))
+	for index, mount := range mounts {
+		lines[index] = fmt.Sprintf("%v\t%v\t%v\n", mount.Pid, mount.DatabasePath, mount.MountPath)
+	}
+
+	// write then rename so that concurrent readers never see a partial file
+	tempPath := path + "." + strconv.Itoa(os.Getpid())
+	if err := ioutil.WriteFile(tempPath, []byte(strings.Join(lines, "")), 0600); err != nil {
+		return fmt.Errorf("could not write mount state file: %v", err)
+	}
+	if err := os.Rename(tempPath, path); err != nil {
+		os.Remove(tempPath)
+		return fmt.Errorf("could not write mount state file: %v", err)
+	}
+
+	return nil
+}
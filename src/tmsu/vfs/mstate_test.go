@@ -0,0 +1,66 @@
+// Copyright 2011-2015 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+// +build !windows
+
+package vfs
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestRecordAndForgetMount(test *testing.T) {
+	// set-up
+
+	runtimeDir, err := ioutil.TempDir("", "tmsu_test_runtime")
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer os.RemoveAll(runtimeDir)
+
+	previous := os.Getenv("XDG_RUNTIME_DIR")
+	os.Setenv("XDG_RUNTIME_DIR", runtimeDir)
+	defer os.Setenv("XDG_RUNTIME_DIR", previous)
+
+	// test
+
+	if err := RecordMount("/tmp/a.db", "/tmp/a"); err != nil {
+		test.Fatal(err)
+	}
+	if err := RecordMount("/tmp/b.db", "/tmp/b"); err != nil {
+		test.Fatal(err)
+	}
+	if err := ForgetMount("/tmp/a"); err != nil {
+		test.Fatal(err)
+	}
+
+	// validate
+
+	mounts, err := TrackedMounts()
+	if err != nil {
+		test.Fatal(err)
+	}
+	if len(mounts) != 1 {
+		test.Fatalf("Expected one tracked mount but were %v.", len(mounts))
+	}
+	if mounts[0].DatabasePath != "/tmp/b.db" || mounts[0].MountPath != "/tmp/b" || mounts[0].Pid != os.Getpid() {
+		test.Fatalf("Unexpected tracked mount %+v.", mounts[0])
+	}
+	if mounts[0].Stale() {
+		test.Fatal("Mount hosted by a running process should not be stale.")
+	}
+}
@@ -32,11 +32,17 @@ import (
 type Mount struct {
 	DatabasePath string
 	MountPath    string
+	Stale        bool
 }
 
 func GetMountTable() ([]Mount, error) {
 	mountTable := make([]Mount, 0, 10)
 
+	trackedMounts, err := TrackedMounts()
+	if err != nil {
+		return nil, err
+	}
+
 	file, err := os.Open("/proc/mounts")
 	if err != nil {
 		return nil, fmt.Errorf("could not open system mount table")
@@ -60,10 +66,19 @@ func GetMountTable() ([]Mount, error) {
 		databaseSymlink := filepath.Join(mountpoint, ".database")
 		databasePath, err := os.Readlink(databaseSymlink)
 		if err != nil {
-			return nil, err
+			// the hosting process has gone, e.g. crashed, leaving the mount disconnected
+			databasePath = ""
+			for _, trackedMount := range trackedMounts {
+				if trackedMount.MountPath == mountpoint {
+					databasePath = trackedMount.DatabasePath
+				}
+			}
+
+			mountTable = append(mountTable, Mount{databasePath, mountpoint, true})
+			continue
 		}
 
-		mountTable = append(mountTable, Mount{databasePath, mountpoint})
+		mountTable = append(mountTable, Mount{databasePath, mountpoint, false})
 	}
 
 	return mountTable, nil
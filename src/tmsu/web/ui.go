@@ -0,0 +1,141 @@
+// Copyright 2011-2015 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package web
+
+// The single-page browser interface.
+const indexPage = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>TMSU</title>
+<style>
+body { font-family: sans-serif; margin: 0; display: flex; height: 100vh; }
+nav { width: 14em; overflow-y: auto; background: #f4f4f4; padding: 0.5em; }
+main { flex: 1; overflow-y: auto; padding: 0.5em 1em; }
+nav a, #files a { display: block; cursor: pointer; padding: 0.1em 0; }
+#query { width: 60%; }
+#error { color: #b00; }
+.tag { display: inline-block; background: #dde; margin: 0.2em; padding: 0.1em 0.4em; border-radius: 0.3em; }
+.tag button { border: none; background: none; cursor: pointer; }
+</style>
+</head>
+<body>
+<nav><strong>Tags</strong><div id="tags"></div></nav>
+<main>
+<form id="search"><input id="query" placeholder="query, e.g. music and not mp3"> <button>Search</button></form>
+<p id="error"></p>
+<div id="detail" hidden>
+<h3 id="path"></h3>
+<div id="fileTags"></div>
+<form id="add"><input id="newTag" placeholder="tag or tag=value"> <button>Add</button></form>
+</div>
+<div id="files"></div>
+</main>
+<script>
+var current = null;
+
+function element(name, text) {
+	var node = document.createElement(name);
+	if (text !== undefined) node.textContent = text;
+	return node;
+}
+
+function request(method, url, body) {
+	var options = { method: method };
+	if (body) {
+		options.headers = { "Content-Type": "application/json" };
+		options.body = JSON.stringify(body);
+	}
+	return fetch(url, options).then(function(response) {
+		return response.json().then(function(result) {
+			if (!response.ok) throw new Error(result.error);
+			document.getElementById("error").textContent = "";
+			return result;
+		});
+	}).catch(function(err) {
+		document.getElementById("error").textContent = err.message;
+		throw err;
+	});
+}
+
+function loadTags() {
+	request("GET", "/api/tags").then(function(names) {
+		var list = document.getElementById("tags");
+		list.textContent = "";
+		names.forEach(function(name) {
+			var link = element("a", name);
+			link.onclick = function() { search(name); };
+			list.appendChild(link);
+		});
+	});
+}
+
+function search(query) {
+	document.getElementById("query").value = query;
+	request("GET", "/api/files?query=" + encodeURIComponent(query)).then(function(paths) {
+		var list = document.getElementById("files");
+		list.textContent = "";
+		paths.forEach(function(path) {
+			var link = element("a", path);
+			link.onclick = function() { show(path); };
+			list.appendChild(link);
+		});
+	});
+}
+
+function show(path) {
+	current = path;
+	request("GET", "/api/file?path=" + encodeURIComponent(path)).then(function(tags) {
+		document.getElementById("detail").hidden = false;
+		document.getElementById("path").textContent = path;
+		var list = document.getElementById("fileTags");
+		list.textContent = "";
+		tags.forEach(function(tag) {
+			var span = element("span", tag);
+			span.className = "tag";
+			var remove = element("button", "×");
+			remove.title = "remove";
+			remove.onclick = function() { change("/api/untag", tag); };
+			span.appendChild(remove);
+			list.appendChild(span);
+		});
+	});
+}
+
+function change(url, tag) {
+	request("POST", url, { paths: [current], tags: [tag] }).then(function() {
+		show(current);
+		loadTags();
+	});
+}
+
+document.getElementById("search").onsubmit = function(event) {
+	event.preventDefault();
+	search(document.getElementById("query").value);
+};
+
+document.getElementById("add").onsubmit = function(event) {
+	event.preventDefault();
+	var input = document.getElementById("newTag");
+	if (input.value) change("/api/tag", input.value);
+	input.value = "";
+};
+
+loadTags();
+</script>
+</body>
+</html>
+`
@@ -0,0 +1,389 @@
+// Copyright 2011-2015 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+// Package web serves a REST API and a minimal browser interface for browsing
+// and editing tags.
+//
+// The API comprises:
+//
+//	GET  /api/tags                     names of all tags
+//	GET  /api/files?query=Q&sort=S     paths of the files matching query Q
+//	GET  /api/file?path=P              tags applied to the file at path P
+//	GET  /api/note?path=P              note attached to the file at path P
+//	POST /api/note                     replace a note: {"path": "...", "note": "..."}
+//	GET  /api/thumbnail?path=P         PNG thumbnail of the image or video at path P
+//	POST /api/tag                      apply tags: {"paths": [...], "tags": [...]}
+//	POST /api/untag                    remove tags: {"paths": [...], "tags": [...]}
+//
+// Responses, other than thumbnails, are JSON. Errors are reported as
+// {"error": "message"} with a non-success status code.
+//
+// POST requests must have the content type application/json, which browsers
+// do not send across origins without a preflight the server does not answer,
+// and are refused if their Origin is another site or their Host a name other
+// than localhost or the one listened on.
+package web
+
+import (
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"sync"
+	"tmsu/api"
+	"tmsu/common/log"
+	"tmsu/storage"
+)
+
+type TagRequest struct {
+	Paths     []string `json:"paths"`
+	Tags      []string `json:"tags"`
+	Recursive bool     `json:"recursive"`
+}
+
+type Note struct {
+	Path string `json:"path"`
+	Note string `json:"note"`
+}
+
+// Serves the API and interface on the specified TCP address until the
+// listener fails.
+func Serve(db *api.Database, address string) error {
+	log.Infof(1, "listening on '%v'", address)
+
+	return http.ListenAndServe(address, newHandler(db, address))
+}
+
+// Creates a handler for the API and interface.
+func NewHandler(db *api.Database) http.Handler {
+	return newHandler(db, "")
+}
+
+// unexported
+
+func newHandler(db *api.Database, address string) http.Handler {
+	hostName, _, err := net.SplitHostPort(address)
+	if err != nil {
+		hostName = address
+	}
+
+	handler := &handler{db: db, hostName: hostName}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", handler.index)
+	mux.HandleFunc("/api/tags", handler.tags)
+	mux.HandleFunc("/api/files", handler.files)
+	mux.HandleFunc("/api/file", handler.file)
+	mux.HandleFunc("/api/note", handler.note)
+	mux.HandleFunc("/api/thumbnail", handler.thumbnail)
+	mux.HandleFunc("/api/tag", handler.tag)
+	mux.HandleFunc("/api/untag", handler.untag)
+
+	return handler.checkingHost(mux)
+}
+
+type handler struct {
+	db       *api.Database
+	hostName string // listened on, if a name rather than an address
+	mutex    sync.Mutex
+}
+
+type httpError struct {
+	status  int
+	message string
+}
+
+func (err httpError) Error() string {
+	return err.message
+}
+
+func (handler *handler) index(writer http.ResponseWriter, request *http.Request) {
+	if request.URL.Path != "/" {
+		http.NotFound(writer, request)
+		return
+	}
+
+	writer.Header().Set("Content-Type", "text/html; charset=utf-8")
+	fmt.Fprint(writer, indexPage)
+}
+
+func (handler *handler) tags(writer http.ResponseWriter, request *http.Request) {
+	handler.serve(writer, request, "GET", "tags", func() (interface{}, error) {
+		return handler.db.Tags()
+	})
+}
+
+func (handler *handler) files(writer http.ResponseWriter, request *http.Request) {
+	queryText := request.FormValue("query")
+	sort := request.FormValue("sort")
+	if sort == "" {
+		sort = "name"
+	}
+
+	handler.serve(writer, request, "GET", "files "+queryText, func() (interface{}, error) {
+		files, err := handler.db.Query(queryText, api.QueryOptions{Sort: sort})
+		if err != nil {
+			return nil, err
+		}
+
+		paths := make([]string, len(files))
+		for index, file := range files {
+			paths[index] = file.Path()
+		}
+
+		return paths, nil
+	})
+}
+
+func (handler *handler) file(writer http.ResponseWriter, request *http.Request) {
+	path := request.FormValue("path")
+
+	handler.serve(writer, request, "GET", "tags "+path, func() (interface{}, error) {
+		if err := checkPaths([]string{path}); err != nil {
+			return nil, err
+		}
+
+		tagValues, err := handler.db.FileTags(path, false)
+		if err != nil {
+			return nil, err
+		}
+
+		names := make([]string, len(tagValues))
+		for index, tagValue := range tagValues {
+			names[index] = tagValue.String()
+		}
+
+		return names, nil
+	})
+}
+
+// Retrieves a file's note or, when posted, replaces it.
+func (handler *handler) note(writer http.ResponseWriter, request *http.Request) {
+	if request.Method == "POST" {
+		var body Note
+		decodeErr := json.NewDecoder(request.Body).Decode(&body)
+
+		handler.serve(writer, request, "POST", "note "+body.Path, func() (interface{}, error) {
+			if decodeErr != nil {
+				return nil, httpError{http.StatusBadRequest, fmt.Sprintf("invalid request: %v", decodeErr)}
+			}
+			if err := checkPaths([]string{body.Path}); err != nil {
+				return nil, err
+			}
+
+			return nil, handler.db.SetNote(body.Path, body.Note)
+		})
+
+		return
+	}
+
+	path := request.FormValue("path")
+
+	handler.serve(writer, request, "GET", "note "+path, func() (interface{}, error) {
+		if err := checkPaths([]string{path}); err != nil {
+			return nil, err
+		}
+
+		text, err := handler.db.Note(path)
+		if err != nil {
+			return nil, err
+		}
+
+		return Note{path, text}, nil
+	})
+}
+
+// Serves the file's thumbnail, creating it if it is not yet cached.
+func (handler *handler) thumbnail(writer http.ResponseWriter, request *http.Request) {
+	path := request.FormValue("path")
+
+	var thumbnailPath string
+	var err error
+
+	if request.Method != "GET" {
+		err = httpError{http.StatusMethodNotAllowed, fmt.Sprintf("method %v not allowed", request.Method)}
+	} else if err = checkPaths([]string{path}); err == nil {
+		handler.mutex.Lock()
+		handler.db.Storage().Command = "thumbnail " + path
+		thumbnailPath, err = handler.db.Thumbnail(path)
+		handler.mutex.Unlock()
+	}
+
+	if err != nil {
+		writeError(writer, request, err)
+		return
+	}
+
+	writer.Header().Set("Content-Type", "image/png")
+	http.ServeFile(writer, request, thumbnailPath)
+}
+
+func (handler *handler) tag(writer http.ResponseWriter, request *http.Request) {
+	var body TagRequest
+	decodeErr := json.NewDecoder(request.Body).Decode(&body)
+
+	handler.serve(writer, request, "POST", "tag "+describe(body), func() (interface{}, error) {
+		if err := checkRequest(body, decodeErr); err != nil {
+			return nil, err
+		}
+
+		options := api.TagOptions{Recursive: body.Recursive}
+		return nil, handler.db.Tag(body.Paths, parseTagValues(body.Tags), options)
+	})
+}
+
+func (handler *handler) untag(writer http.ResponseWriter, request *http.Request) {
+	var body TagRequest
+	decodeErr := json.NewDecoder(request.Body).Decode(&body)
+
+	handler.serve(writer, request, "POST", "untag "+describe(body), func() (interface{}, error) {
+		if err := checkRequest(body, decodeErr); err != nil {
+			return nil, err
+		}
+
+		return nil, handler.db.Untag(body.Paths, parseTagValues(body.Tags), body.Recursive)
+	})
+}
+
+// Runs the operation, one at a time, and writes its result as JSON.
+func (handler *handler) serve(writer http.ResponseWriter, request *http.Request, method, command string, operation func() (interface{}, error)) {
+	var result interface{}
+	var err error
+
+	switch {
+	case request.Method != method:
+		err = httpError{http.StatusMethodNotAllowed, fmt.Sprintf("method %v not allowed", request.Method)}
+	case method == "POST":
+		err = checkSameSite(request)
+	}
+
+	if err == nil {
+		handler.mutex.Lock()
+		handler.db.Storage().Command = command
+		result, err = operation()
+		handler.mutex.Unlock()
+	}
+
+	if err != nil {
+		writeError(writer, request, err)
+		return
+	}
+
+	writer.Header().Set("Content-Type", "application/json")
+
+	if result == nil {
+		result = struct{}{}
+	}
+
+	json.NewEncoder(writer).Encode(result)
+}
+
+// Serves only the requests to the server's own host name, refusing those a
+// page on another site could send, and read the responses to, by rebinding
+// its name to the server's address.
+func (handler *handler) checkingHost(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		hostName, _, err := net.SplitHostPort(request.Host)
+		if err != nil {
+			hostName = request.Host
+		}
+		if net.ParseIP(hostName) == nil && hostName != "localhost" && hostName != handler.hostName {
+			writeError(writer, request, httpError{http.StatusForbidden, fmt.Sprintf("host '%v' not permitted", request.Host)})
+			return
+		}
+
+		next.ServeHTTP(writer, request)
+	})
+}
+
+// Refuses the changes that a web page on another site could have had the
+// browser send: those that are not JSON, which need no preflight, and those
+// from another origin.
+func checkSameSite(request *http.Request) error {
+	mediaType, _, err := mime.ParseMediaType(request.Header.Get("Content-Type"))
+	if err != nil || mediaType != "application/json" {
+		return httpError{http.StatusUnsupportedMediaType, "content type must be application/json"}
+	}
+
+	if origin := request.Header.Get("Origin"); origin != "" {
+		originUrl, err := url.Parse(origin)
+		if err != nil || originUrl.Host != request.Host {
+			return httpError{http.StatusForbidden, fmt.Sprintf("origin '%v' not permitted", origin)}
+		}
+	}
+
+	return nil
+}
+
+func writeError(writer http.ResponseWriter, request *http.Request, err error) {
+	log.Warnf("%v %v: %v", request.Method, request.URL.Path, err)
+
+	writer.Header().Set("Content-Type", "application/json")
+	writer.WriteHeader(statusOf(err))
+	json.NewEncoder(writer).Encode(map[string]string{"error": err.Error()})
+}
+
+func statusOf(err error) int {
+	switch typedErr := err.(type) {
+	case httpError:
+		return typedErr.status
+	case api.NoSuchTagError, api.NoSuchValueError, api.NoSuchTagsError, api.FileNotTaggedError, api.NoThumbnailError:
+		return http.StatusNotFound
+	case api.TagNotAppliedError, api.TagImpliedError, api.ExclusiveTagsError, api.QueryTooComplexError:
+		return http.StatusBadRequest
+	case storage.LockedError:
+		return http.StatusConflict
+	}
+
+	return http.StatusInternalServerError
+}
+
+func checkRequest(body TagRequest, decodeErr error) error {
+	if decodeErr != nil {
+		return httpError{http.StatusBadRequest, fmt.Sprintf("invalid request: %v", decodeErr)}
+	}
+	if len(body.Paths) == 0 || len(body.Tags) == 0 {
+		return httpError{http.StatusBadRequest, "paths and tags must be specified"}
+	}
+
+	return checkPaths(body.Paths)
+}
+
+func checkPaths(paths []string) error {
+	for _, path := range paths {
+		if !filepath.IsAbs(path) {
+			return httpError{http.StatusBadRequest, fmt.Sprintf("%v: path must be absolute", path)}
+		}
+	}
+
+	return nil
+}
+
+func parseTagValues(texts []string) []api.TagValue {
+	tagValues := make([]api.TagValue, len(texts))
+	for index, text := range texts {
+		tagValues[index] = api.ParseTagValue(text)
+	}
+
+	return tagValues
+}
+
+func describe(body TagRequest) string {
+	return strings.Join(body.Paths, " ") + " " + strings.Join(body.Tags, " ")
+}
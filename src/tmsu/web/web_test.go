@@ -0,0 +1,285 @@
+// Copyright 2011-2015 Paul Ruane.
+
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package web
+
+import (
+	"encoding/json"
+	"image"
+	"image/png"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"tmsu/api"
+)
+
+func TestTagAndQuery(test *testing.T) {
+	// set-up
+
+	databasePath := filepath.Join(os.TempDir(), "tmsu_web_test.db")
+	defer os.Remove(databasePath)
+
+	db, err := api.Open(databasePath)
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer db.Close()
+
+	if err := os.MkdirAll("/tmp/tmsu", 0777); err != nil {
+		test.Fatal(err)
+	}
+	if err := ioutil.WriteFile("/tmp/tmsu/a", []byte("hello"), 0666); err != nil {
+		test.Fatal(err)
+	}
+	defer os.Remove("/tmp/tmsu/a")
+
+	server := httptest.NewServer(NewHandler(db))
+	defer server.Close()
+
+	// test
+
+	response, err := http.Post(server.URL+"/api/tag", "application/json", strings.NewReader(`{"paths": ["/tmp/tmsu/a"], "tags": ["apple", "year=2015"]}`))
+	if err != nil {
+		test.Fatal(err)
+	}
+	response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		test.Fatalf("Expected tagging to succeed but status was %v.", response.StatusCode)
+	}
+
+	var paths []string
+	getJson(test, server.URL+"/api/files?query=apple+and+year+%3D+2015", http.StatusOK, &paths)
+
+	var tags []string
+	getJson(test, server.URL+"/api/tags", http.StatusOK, &tags)
+
+	var failure map[string]string
+	getJson(test, server.URL+"/api/files?query=banana", http.StatusNotFound, &failure)
+
+	// validate
+
+	if len(paths) != 1 || paths[0] != "/tmp/tmsu/a" {
+		test.Fatalf("Expected '/tmp/tmsu/a' to match but matches are %v.", paths)
+	}
+
+	if len(tags) != 2 || tags[0] != "apple" || tags[1] != "year" {
+		test.Fatalf("Expected tags 'apple' and 'year' but were %v.", tags)
+	}
+
+	if failure["error"] == "" {
+		test.Fatalf("Expected an error message for a non-existent tag.")
+	}
+}
+
+func TestThumbnail(test *testing.T) {
+	// set-up
+
+	root, err := ioutil.TempDir("", "tmsu")
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	db, err := api.Open(filepath.Join(root, "db"))
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer db.Close()
+
+	path := filepath.Join(root, "photo.png")
+	file, err := os.Create(path)
+	if err != nil {
+		test.Fatal(err)
+	}
+	if err := png.Encode(file, image.NewGray(image.Rect(0, 0, 512, 512))); err != nil {
+		test.Fatal(err)
+	}
+	file.Close()
+
+	if err := db.Tag([]string{path}, []api.TagValue{{Tag: "photo"}}, api.TagOptions{}); err != nil {
+		test.Fatal(err)
+	}
+
+	server := httptest.NewServer(NewHandler(db))
+	defer server.Close()
+
+	// test
+
+	response, err := http.Get(server.URL + "/api/thumbnail?path=" + path)
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer response.Body.Close()
+
+	// validate
+
+	if response.StatusCode != http.StatusOK {
+		test.Fatalf("Expected thumbnail but status was %v.", response.StatusCode)
+	}
+	if contentType := response.Header.Get("Content-Type"); contentType != "image/png" {
+		test.Fatalf("Expected content type 'image/png' but was '%v'.", contentType)
+	}
+
+	thumb, err := png.Decode(response.Body)
+	if err != nil {
+		test.Fatal(err)
+	}
+	if thumb.Bounds().Dx() != api.ThumbnailSize || thumb.Bounds().Dy() != api.ThumbnailSize {
+		test.Fatalf("Expected %[1]vx%[1]v thumbnail but was %vx%v.", api.ThumbnailSize, thumb.Bounds().Dx(), thumb.Bounds().Dy())
+	}
+
+	cached, err := ioutil.ReadDir(filepath.Join(root, "thumbs"))
+	if err != nil {
+		test.Fatal(err)
+	}
+	if len(cached) != 1 {
+		test.Fatalf("Expected one cached thumbnail but there were %v.", len(cached))
+	}
+}
+
+// unexported
+
+func TestCrossSiteRequestsRefused(test *testing.T) {
+	// set-up
+
+	databasePath := filepath.Join(os.TempDir(), "tmsu_web_test.db")
+	defer os.Remove(databasePath)
+
+	db, err := api.Open(databasePath)
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer db.Close()
+
+	if err := os.MkdirAll("/tmp/tmsu", 0777); err != nil {
+		test.Fatal(err)
+	}
+	if err := ioutil.WriteFile("/tmp/tmsu/a", []byte("hello"), 0666); err != nil {
+		test.Fatal(err)
+	}
+	defer os.Remove("/tmp/tmsu/a")
+
+	server := httptest.NewServer(NewHandler(db))
+	defer server.Close()
+
+	body := `{"paths": ["/tmp/tmsu/a"], "tags": ["apple"]}`
+
+	// test
+
+	cases := []struct {
+		path, contentType, origin, host string
+		expectedStatus                  int
+	}{
+		{"/api/tag", "text/plain", "", "", http.StatusUnsupportedMediaType},
+		{"/api/tag", "", "", "", http.StatusUnsupportedMediaType},
+		{"/api/tag", "application/json", "http://evil.example", "", http.StatusForbidden},
+		{"/api/untag", "application/json", "http://evil.example", "", http.StatusForbidden},
+		{"/api/note", "text/plain", "", "", http.StatusUnsupportedMediaType},
+		{"/api/tag", "application/json", "", "evil.example", http.StatusForbidden},
+		{"/api/tag", "application/json; charset=utf-8", server.URL, "", http.StatusOK},
+	}
+
+	for _, testCase := range cases {
+		request, err := http.NewRequest("POST", server.URL+testCase.path, strings.NewReader(body))
+		if err != nil {
+			test.Fatal(err)
+		}
+		if testCase.contentType != "" {
+			request.Header.Set("Content-Type", testCase.contentType)
+		}
+		if testCase.origin != "" {
+			request.Header.Set("Origin", testCase.origin)
+		}
+		if testCase.host != "" {
+			request.Host = testCase.host
+		}
+
+		response, err := http.DefaultClient.Do(request)
+		if err != nil {
+			test.Fatal(err)
+		}
+		response.Body.Close()
+
+		// validate
+
+		if response.StatusCode != testCase.expectedStatus {
+			test.Fatalf("%v %+v: expected status %v but was %v.", testCase.path, testCase, testCase.expectedStatus, response.StatusCode)
+		}
+	}
+
+	var tags []string
+	getJson(test, server.URL+"/api/file?path=/tmp/tmsu/a", http.StatusOK, &tags)
+	if len(tags) != 1 || tags[0] != "apple" {
+		test.Fatalf("Expected only the same-site request to tag the file but tags were %v.", tags)
+	}
+}
+
+func TestReboundHostRefused(test *testing.T) {
+	// set-up
+
+	databasePath := filepath.Join(os.TempDir(), "tmsu_web_test.db")
+	defer os.Remove(databasePath)
+
+	db, err := api.Open(databasePath)
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer db.Close()
+
+	server := httptest.NewServer(NewHandler(db))
+	defer server.Close()
+
+	// test
+
+	for _, path := range []string{"/", "/api/tags", "/api/files?query=apple", "/api/file?path=/tmp/tmsu/a", "/api/note?path=/tmp/tmsu/a", "/api/thumbnail?path=/tmp/tmsu/a"} {
+		request, err := http.NewRequest("GET", server.URL+path, nil)
+		if err != nil {
+			test.Fatal(err)
+		}
+		request.Host = "evil.example:8080"
+
+		response, err := http.DefaultClient.Do(request)
+		if err != nil {
+			test.Fatal(err)
+		}
+		response.Body.Close()
+
+		// validate
+
+		if response.StatusCode != http.StatusForbidden {
+			test.Fatalf("%v: expected status %v but was %v.", path, http.StatusForbidden, response.StatusCode)
+		}
+	}
+}
+
+func getJson(test *testing.T, url string, expectedStatus int, result interface{}) {
+	response, err := http.Get(url)
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != expectedStatus {
+		test.Fatalf("Expected status %v for '%v' but was %v.", expectedStatus, url, response.StatusCode)
+	}
+
+	if err := json.NewDecoder(response.Body).Decode(result); err != nil {
+		test.Fatal(err)
+	}
+}